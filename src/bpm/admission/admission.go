@@ -0,0 +1,129 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+// Package admission lets security teams veto the creation of containers
+// centrally. Admission hooks are given the final OCI spec of a process and
+// decide whether it may be started, enforcing policies such as "no unsafe
+// block in production" without each job having to be reviewed.
+package admission
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+
+	"bpm/config"
+)
+
+// CommandTimeout is how long a hook may take to decide before the process is
+// refused.
+const CommandTimeout = 10 * time.Second
+
+// RejectedError is returned when a hook refuses to admit a process.
+type RejectedError struct {
+	Hook   string
+	Reason string
+}
+
+func (e *RejectedError) Error() string {
+	return fmt.Sprintf("rejected by admission hook %s: %s", e.Hook, e.Reason)
+}
+
+// Controller runs each of its hooks in turn. Every hook must admit the
+// process for it to be started.
+type Controller struct {
+	hooks []string
+}
+
+// NewController builds a controller from the paths of the hooks'
+// executables.
+func NewController(paths []string) (*Controller, error) {
+	for _, path := range paths {
+		if !filepath.IsAbs(path) {
+			return nil, fmt.Errorf("admission hook path must be absolute: %s", path)
+		}
+	}
+
+	return &Controller{hooks: paths}, nil
+}
+
+// Admit runs the hooks with the spec as JSON on stdin. A hook admits the
+// process by exiting successfully. Any other outcome, including the hook
+// failing to run or taking longer than CommandTimeout, rejects it with the
+// first line which the hook wrote to stdout (or stderr) as the reason.
+func (c *Controller) Admit(ctx context.Context, logger lager.Logger, bpmCfg *config.BPMConfig, spec specs.Spec) error {
+	input, err := json.Marshal(spec)
+	if err != nil {
+		return err
+	}
+
+	for _, hook := range c.hooks {
+		if err := c.run(ctx, logger, hook, bpmCfg, input); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *Controller) run(ctx context.Context, logger lager.Logger, hook string, bpmCfg *config.BPMConfig, input []byte) error {
+	logger = logger.Session("admission-hook", lager.Data{"path": hook})
+	logger.Info("starting")
+	defer logger.Info("complete")
+
+	ctx, cancel := context.WithTimeout(ctx, CommandTimeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, hook)
+	cmd.Env = []string{
+		fmt.Sprintf("BPM_JOB=%s", bpmCfg.JobName()),
+		fmt.Sprintf("BPM_PROCESS=%s", bpmCfg.ProcName()),
+		"PATH=/usr/bin:/bin:/usr/sbin:/sbin",
+	}
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if err == nil {
+		return nil
+	}
+
+	reason := firstLine(stdout.String())
+	if reason == "" {
+		reason = firstLine(stderr.String())
+	}
+	if ctx.Err() != nil {
+		reason = fmt.Sprintf("did not decide within %s", CommandTimeout)
+	} else if reason == "" {
+		reason = err.Error()
+	}
+
+	logger.Info("rejected", lager.Data{"reason": reason})
+	return &RejectedError{Hook: hook, Reason: reason}
+}
+
+func firstLine(s string) string {
+	return strings.TrimSpace(strings.SplitN(strings.TrimSpace(s), "\n", 2)[0])
+}
@@ -0,0 +1,126 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package admission_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"code.cloudfoundry.org/lager/lagertest"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+
+	"bpm/admission"
+	"bpm/bosh"
+	"bpm/config"
+)
+
+var _ = Describe("Admission", func() {
+	var (
+		logger  *lagertest.TestLogger
+		bpmCfg  *config.BPMConfig
+		spec    specs.Spec
+		tempDir string
+	)
+
+	BeforeEach(func() {
+		var err error
+		tempDir, err = ioutil.TempDir("", "admission")
+		Expect(err).NotTo(HaveOccurred())
+
+		logger = lagertest.NewTestLogger("admission")
+		bpmCfg = config.NewBPMConfig(bosh.NewEnv(tempDir), "example", "server")
+		spec = specs.Spec{
+			Version:  "1.0.0",
+			Hostname: "example",
+			Process:  &specs.Process{Args: []string{"/bin/sleep"}},
+			Root:     &specs.Root{Path: "/"},
+			Linux:    &specs.Linux{},
+		}
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(tempDir)).To(Succeed())
+	})
+
+	writeHook := func(name, script string) string {
+		path := filepath.Join(tempDir, name)
+		Expect(ioutil.WriteFile(path, []byte("#!/bin/sh\n"+script), 0700)).To(Succeed())
+		return path
+	}
+
+	It("admits a process which every hook allows", func() {
+		controller, err := admission.NewController([]string{
+			writeHook("first", "exit 0"),
+			writeHook("second", "cat > /dev/null"),
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(controller.Admit(context.Background(), logger, bpmCfg, spec)).To(Succeed())
+	})
+
+	It("gives the hook the spec, job, and process", func() {
+		output := filepath.Join(tempDir, "output")
+		hook := writeHook("record", `cat > `+output+`; echo "$BPM_JOB $BPM_PROCESS" >> `+output)
+
+		controller, err := admission.NewController([]string{hook})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(controller.Admit(context.Background(), logger, bpmCfg, spec)).To(Succeed())
+
+		contents, err := ioutil.ReadFile(output)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(contents)).To(ContainSubstring(`"hostname":"example"`))
+		Expect(string(contents)).To(ContainSubstring("example server"))
+	})
+
+	It("rejects a process with the reason the hook gives", func() {
+		allow := writeHook("allow", "exit 0")
+		deny := writeHook("deny", "echo 'host network namespace is not allowed'\nexit 1")
+		never := filepath.Join(tempDir, "never-run")
+
+		controller, err := admission.NewController([]string{allow, deny, writeHook("later", "touch "+never)})
+		Expect(err).NotTo(HaveOccurred())
+
+		err = controller.Admit(context.Background(), logger, bpmCfg, spec)
+		Expect(err).To(Equal(&admission.RejectedError{Hook: deny, Reason: "host network namespace is not allowed"}))
+		Expect(err).To(MatchError(ContainSubstring("rejected by admission hook")))
+		Expect(never).NotTo(BeAnExistingFile())
+	})
+
+	It("uses stderr as the reason when the hook prints nothing to stdout", func() {
+		controller, err := admission.NewController([]string{writeHook("deny", "echo 'unsafe is not allowed' >&2\nexit 3")})
+		Expect(err).NotTo(HaveOccurred())
+
+		err = controller.Admit(context.Background(), logger, bpmCfg, spec)
+		Expect(err).To(MatchError(ContainSubstring("unsafe is not allowed")))
+	})
+
+	It("rejects a process when the hook cannot be run", func() {
+		controller, err := admission.NewController([]string{filepath.Join(tempDir, "missing")})
+		Expect(err).NotTo(HaveOccurred())
+
+		err = controller.Admit(context.Background(), logger, bpmCfg, spec)
+		Expect(err).To(BeAssignableToTypeOf(&admission.RejectedError{}))
+	})
+
+	It("requires absolute paths", func() {
+		_, err := admission.NewController([]string{"relative/hook"})
+		Expect(err).To(MatchError(ContainSubstring("must be absolute")))
+	})
+})
@@ -0,0 +1,307 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+// Package archive reads and writes the gzipped tarballs used by `bpm export`
+// and `bpm import`.
+package archive
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Source is a file or directory on the host which is stored in an archive
+// under Name. If Contents is set then it is stored as a regular file under
+// Name instead and Path is ignored.
+type Source struct {
+	Name     string
+	Path     string
+	Contents []byte
+}
+
+// Write writes each source into a gzipped tarball. Directories are stored
+// recursively along with their ownership and permissions. Sources which do
+// not exist are skipped.
+func Write(w io.Writer, sources []Source) error {
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+
+	for _, src := range sources {
+		if src.Contents != nil {
+			if err := writeContents(tw, src.Name, src.Contents); err != nil {
+				return fmt.Errorf("failed to archive %s: %s", src.Name, err)
+			}
+			continue
+		}
+
+		if _, err := os.Lstat(src.Path); os.IsNotExist(err) {
+			continue
+		}
+
+		err := filepath.Walk(src.Path, func(p string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+
+			rel, err := filepath.Rel(src.Path, p)
+			if err != nil {
+				return err
+			}
+
+			return writeEntry(tw, path.Join(src.Name, filepath.ToSlash(rel)), p, info)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to archive %s: %s", src.Path, err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+
+	return gw.Close()
+}
+
+func writeContents(tw *tar.Writer, name string, contents []byte) error {
+	hdr := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     0600,
+		Size:     int64(len(contents)),
+		ModTime:  time.Now(),
+	}
+
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+
+	_, err := tw.Write(contents)
+	return err
+}
+
+func writeEntry(tw *tar.Writer, name, p string, info os.FileInfo) error {
+	var link string
+	if info.Mode()&os.ModeSymlink != 0 {
+		var err error
+		link, err = os.Readlink(p)
+		if err != nil {
+			return err
+		}
+	} else if !info.Mode().IsRegular() && !info.IsDir() {
+		// Sockets, pipes, and devices cannot be usefully restored.
+		return nil
+	}
+
+	hdr, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return err
+	}
+	hdr.Name = name
+	if info.IsDir() {
+		hdr.Name += "/"
+	}
+
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+
+	if !info.Mode().IsRegular() {
+		return nil
+	}
+
+	f, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+// Extract restores the entries of a gzipped tarball written by Write. Each
+// top-level name in the archive which has a destination is extracted into
+// that directory; all other entries are ignored.
+//
+// Archives are not trusted, and neither is what is already in the
+// destinations, which belong to the job's unprivileged user. An entry is
+// refused if any directory between its destination and itself is a symlink,
+// and nothing is written through a symlink at the entry's own path. Symlinks
+// from the archive are only created once every other entry has been
+// extracted, so that no entry can be written through one of them.
+func Extract(r io.Reader, destinations map[string]string) error {
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer gr.Close()
+
+	type link struct {
+		hdr          *tar.Header
+		dest, target string
+	}
+	var links []link
+
+	tr := tar.NewReader(gr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		name := path.Clean(hdr.Name)
+		parts := strings.SplitN(name, "/", 2)
+		dest, ok := destinations[parts[0]]
+		if !ok {
+			continue
+		}
+
+		target := dest
+		if len(parts) == 2 {
+			target = filepath.Join(dest, filepath.FromSlash(parts[1]))
+		}
+
+		if target != dest && !strings.HasPrefix(target, dest+string(filepath.Separator)) {
+			return fmt.Errorf("invalid archive entry: %s is outside of %s", hdr.Name, parts[0])
+		}
+
+		if hdr.Typeflag == tar.TypeSymlink {
+			links = append(links, link{hdr: hdr, dest: dest, target: target})
+			continue
+		}
+
+		if err := extractEntry(tr, hdr, dest, target); err != nil {
+			return fmt.Errorf("failed to extract %s: %s", hdr.Name, err)
+		}
+	}
+
+	for _, l := range links {
+		if err := extractEntry(nil, l.hdr, l.dest, l.target); err != nil {
+			return fmt.Errorf("failed to extract %s: %s", l.hdr.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func extractEntry(tr *tar.Reader, hdr *tar.Header, dest, target string) error {
+	mode := os.FileMode(hdr.Mode).Perm()
+
+	switch hdr.Typeflag {
+	case tar.TypeDir:
+		if err := mkdirBeneath(dest, target); err != nil {
+			return err
+		}
+		if err := os.Chmod(target, mode); err != nil {
+			return err
+		}
+	case tar.TypeReg:
+		if err := mkdirBeneath(dest, filepath.Dir(target)); err != nil {
+			return err
+		}
+
+		// A symlink at the path is replaced rather than written through.
+		if info, err := os.Lstat(target); err == nil && info.Mode()&os.ModeSymlink != 0 {
+			if err := os.Remove(target); err != nil {
+				return err
+			}
+		}
+
+		f, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY|syscall.O_NOFOLLOW, mode)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(f, tr); err != nil {
+			f.Close()
+			return err
+		}
+		if err := f.Chmod(mode); err != nil {
+			f.Close()
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+	case tar.TypeSymlink:
+		if err := mkdirBeneath(dest, filepath.Dir(target)); err != nil {
+			return err
+		}
+		if err := os.RemoveAll(target); err != nil {
+			return err
+		}
+		if err := os.Symlink(hdr.Linkname, target); err != nil {
+			return err
+		}
+	default:
+		return nil
+	}
+
+	// Only root can give files away to other users.
+	if os.Geteuid() != 0 {
+		return nil
+	}
+
+	return os.Lchown(target, hdr.Uid, hdr.Gid)
+}
+
+// mkdirBeneath creates dir and any of its parents beneath dest which do not
+// exist yet. It refuses to pass through a symlink, which could lead anywhere
+// on the host.
+func mkdirBeneath(dest, dir string) error {
+	if err := os.MkdirAll(dest, 0700); err != nil {
+		return err
+	}
+
+	rel, err := filepath.Rel(dest, dir)
+	if err != nil {
+		return err
+	}
+	if rel == "." {
+		return nil
+	}
+
+	current := dest
+	for _, part := range strings.Split(rel, string(filepath.Separator)) {
+		current = filepath.Join(current, part)
+
+		err := os.Mkdir(current, 0700)
+		if err != nil && !os.IsExist(err) {
+			return err
+		}
+
+		info, err := os.Lstat(current)
+		if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("%s is a symlink", current)
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("%s is not a directory", current)
+		}
+	}
+
+	return nil
+}
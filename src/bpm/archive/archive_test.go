@@ -0,0 +1,177 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package archive_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"bpm/archive"
+)
+
+var _ = Describe("Archive", func() {
+	var tmpDir, dataDir, logDir string
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "archive")
+		Expect(err).NotTo(HaveOccurred())
+
+		dataDir = filepath.Join(tmpDir, "data")
+		Expect(os.MkdirAll(filepath.Join(dataDir, "nested"), 0750)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(dataDir, "nested", "db"), []byte("rows"), 0640)).To(Succeed())
+		Expect(os.Symlink("nested/db", filepath.Join(dataDir, "current"))).To(Succeed())
+
+		logDir = filepath.Join(tmpDir, "log")
+		Expect(os.MkdirAll(logDir, 0755)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(logDir, "server.stdout.log"), []byte("hello"), 0644)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(tmpDir)).To(Succeed())
+	})
+
+	It("restores what was written", func() {
+		buf := &bytes.Buffer{}
+		Expect(archive.Write(buf, []archive.Source{
+			{Name: "data", Path: dataDir},
+			{Name: "logs", Path: logDir},
+			{Name: "store", Path: filepath.Join(tmpDir, "does-not-exist")},
+		})).To(Succeed())
+
+		restoreDir := filepath.Join(tmpDir, "restore")
+		Expect(archive.Extract(buf, map[string]string{"data": restoreDir})).To(Succeed())
+
+		Expect(ioutil.ReadFile(filepath.Join(restoreDir, "nested", "db"))).To(BeEquivalentTo("rows"))
+		info, err := os.Stat(filepath.Join(restoreDir, "nested", "db"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Mode().Perm()).To(Equal(os.FileMode(0640)))
+
+		Expect(os.Readlink(filepath.Join(restoreDir, "current"))).To(Equal("nested/db"))
+
+		Expect(filepath.Join(restoreDir, "server.stdout.log")).NotTo(BeAnExistingFile())
+	})
+
+	It("stores contents given in place of a path", func() {
+		buf := &bytes.Buffer{}
+		Expect(archive.Write(buf, []archive.Source{
+			{Name: "config.json", Path: "/does/not/matter", Contents: []byte(`{"redacted": true}`)},
+		})).To(Succeed())
+
+		gr, err := gzip.NewReader(buf)
+		Expect(err).NotTo(HaveOccurred())
+		tr := tar.NewReader(gr)
+
+		hdr, err := tr.Next()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(hdr.Name).To(Equal("config.json"))
+		Expect(hdr.Mode).To(Equal(int64(0600)))
+		Expect(ioutil.ReadAll(tr)).To(MatchJSON(`{"redacted": true}`))
+	})
+
+	It("ignores entries which escape their destination", func() {
+		buf := &bytes.Buffer{}
+		gw := gzip.NewWriter(buf)
+		tw := tar.NewWriter(gw)
+		Expect(tw.WriteHeader(&tar.Header{Name: "data/../../escape", Mode: 0644, Typeflag: tar.TypeReg})).To(Succeed())
+		Expect(tw.Close()).To(Succeed())
+		Expect(gw.Close()).To(Succeed())
+
+		err := archive.Extract(buf, map[string]string{"data": filepath.Join(tmpDir, "restore")})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(filepath.Join(tmpDir, "escape")).NotTo(BeAnExistingFile())
+	})
+
+	Context("when a symlink leads out of the destination", func() {
+		var (
+			outside    string
+			restoreDir string
+		)
+
+		writeArchive := func(headers ...*tar.Header) *bytes.Buffer {
+			buf := &bytes.Buffer{}
+			gw := gzip.NewWriter(buf)
+			tw := tar.NewWriter(gw)
+			for _, hdr := range headers {
+				Expect(tw.WriteHeader(hdr)).To(Succeed())
+				if hdr.Typeflag == tar.TypeReg {
+					_, err := tw.Write(make([]byte, hdr.Size))
+					Expect(err).NotTo(HaveOccurred())
+				}
+			}
+			Expect(tw.Close()).To(Succeed())
+			Expect(gw.Close()).To(Succeed())
+			return buf
+		}
+
+		BeforeEach(func() {
+			outside = filepath.Join(tmpDir, "outside")
+			Expect(os.MkdirAll(outside, 0755)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(outside, "shadow"), []byte("secret"), 0600)).To(Succeed())
+
+			restoreDir = filepath.Join(tmpDir, "restore")
+			Expect(os.MkdirAll(restoreDir, 0755)).To(Succeed())
+		})
+
+		It("does not write through a symlink from the archive", func() {
+			buf := writeArchive(
+				&tar.Header{Name: "data/x", Typeflag: tar.TypeSymlink, Linkname: outside},
+				&tar.Header{Name: "data/x/shadow", Typeflag: tar.TypeReg, Mode: 0644, Size: 4},
+			)
+
+			err := archive.Extract(buf, map[string]string{"data": restoreDir})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(ioutil.ReadFile(filepath.Join(outside, "shadow"))).To(BeEquivalentTo("secret"))
+			Expect(os.Readlink(filepath.Join(restoreDir, "x"))).To(Equal(outside))
+		})
+
+		It("does not write through a symlink already in the destination", func() {
+			Expect(os.Symlink(outside, filepath.Join(restoreDir, "x"))).To(Succeed())
+
+			buf := writeArchive(
+				&tar.Header{Name: "data/x/shadow", Typeflag: tar.TypeReg, Mode: 0644, Size: 4},
+			)
+
+			err := archive.Extract(buf, map[string]string{"data": restoreDir})
+			Expect(err).To(MatchError(ContainSubstring("is a symlink")))
+
+			Expect(ioutil.ReadFile(filepath.Join(outside, "shadow"))).To(BeEquivalentTo("secret"))
+		})
+
+		It("replaces a symlink at the path of a file rather than following it", func() {
+			Expect(os.Symlink(filepath.Join(outside, "shadow"), filepath.Join(restoreDir, "shadow"))).To(Succeed())
+
+			buf := writeArchive(
+				&tar.Header{Name: "data/shadow", Typeflag: tar.TypeReg, Mode: 0644, Size: 4},
+			)
+
+			Expect(archive.Extract(buf, map[string]string{"data": restoreDir})).To(Succeed())
+
+			Expect(ioutil.ReadFile(filepath.Join(outside, "shadow"))).To(BeEquivalentTo("secret"))
+			info, err := os.Lstat(filepath.Join(restoreDir, "shadow"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.Mode().IsRegular()).To(BeTrue())
+		})
+	})
+})
@@ -18,13 +18,19 @@ package bosh
 import (
 	"io/ioutil"
 	"path/filepath"
+	"strings"
 )
 
 // Env represents a BOSH BPM environment. This is not a concept outside BPM but
 // allows us to isolate BPM invocations from one another so that integration
-// tests can be made concurrent.
+// tests can be made concurrent and several BOSH roots (e.g. nested bosh-lite)
+// can be used on the same host.
 type Env struct {
 	root string
+
+	// state maps directories, relative to the root, which have been
+	// relocated to the directory on the host which now holds them.
+	state map[string]string
 }
 
 // NewEnv creates a new environment with a particular directory as its root. If
@@ -35,10 +41,24 @@ func NewEnv(root string) *Env {
 	}
 
 	return &Env{
-		root: root,
+		root:  root,
+		state: map[string]string{},
 	}
 }
 
+// RelocateState moves a directory of the environment, given relative to its
+// root (e.g. "sys/log"), to target on the host. The external representation
+// of every Path within dir is then beneath target while the internal
+// representation is unchanged. It allows bpm to keep the state it writes
+// outside of a BOSH root which is read-only.
+func (e *Env) RelocateState(dir, target string) {
+	e.state[filepath.Clean(dir)] = target
+}
+
+func (e *Env) path(dir string) Path {
+	return Path{root: e.root, dir: dir, state: e.state}
+}
+
 // JobNames returns a list of all the job names inside a BOSH environment.
 func (e *Env) JobNames() []string {
 	var jobs []string
@@ -58,48 +78,66 @@ func (e *Env) JobNames() []string {
 // Root returns a Path representation of the environment's root. It is
 // typically not useful by itself but can be appended to with Path.Join().
 func (e *Env) Root() Path {
-	return Path{root: e.root}
+	return e.path("")
 }
 
 // DataDir returns a Path representation of the directory where a job should
 // store its ephemeral data.
 func (e *Env) DataDir(job string) Path {
-	return Path{root: e.root, dir: filepath.Join("data", job)}
+	return e.path(filepath.Join("data", job))
 }
 
 // StoreDir returns a Path representation of the directory where a job should
 // store its persistent data.
 func (e *Env) StoreDir(job string) Path {
-	return Path{root: e.root, dir: filepath.Join("store", job)}
+	return e.path(filepath.Join("store", job))
 }
 
 // JobDir returns a Path representation of the directory where a job should
 // can find its templated BOSH configuration.
 func (e *Env) JobDir(job string) Path {
-	return Path{root: e.root, dir: filepath.Join("jobs", job)}
+	return e.path(filepath.Join("jobs", job))
 }
 
 // RunDir returns a Path representation of the directory where a job should
 // store any sockets or PID files.
 func (e *Env) RunDir(job string) Path {
-	return Path{root: e.root, dir: filepath.Join("sys", "run", job)}
+	return e.path(filepath.Join("sys", "run", job))
 }
 
 // LogDir returns a Path representation of the directory where a job should
 // write any additional log files.
 func (e *Env) LogDir(job string) Path {
-	return Path{root: e.root, dir: filepath.Join("sys", "log", job)}
+	return e.path(filepath.Join("sys", "log", job))
 }
 
 // PackageDir returns a Path representation of the global directory where all BOSH
 // packages are stored.
 func (e *Env) PackageDir() Path {
-	return Path{root: e.root, dir: "packages"}
+	return e.path("packages")
 }
 
 // DataPackageDir returns a Path representation of the global directory where
 // all BOSH packages are actually stored (PackageDir is typically a symlink to
 // this).
 func (e *Env) DataPackageDir() Path {
-	return Path{root: e.root, dir: filepath.Join("data", "packages")}
+	return e.path(filepath.Join("data", "packages"))
+}
+
+// Resolve returns the path within the environment which path refers to. The
+// path may be written as it is seen from inside a container (beneath
+// DefaultRoot) or as it is on the host (beneath the root of the environment)
+// so that job configuration does not need to know which root bpm is using. It
+// returns false if the path is not strictly within either.
+func (e *Env) Resolve(path string) (Path, bool) {
+	for _, root := range []string{e.root, DefaultRoot} {
+		rel, err := filepath.Rel(root, path)
+		if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, "../") {
+			continue
+		}
+
+		return e.path(rel), true
+	}
+
+	return Path{}, false
 }
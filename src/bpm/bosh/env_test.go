@@ -124,6 +124,65 @@ var _ = Describe("Bosh Environment", func() {
 		})
 	})
 
+	Describe("Resolve", func() {
+		It("resolves paths written as they are seen in a container", func() {
+			path, ok := bosh.NewEnv(root).Resolve("/var/vcap/data/job_name/cache")
+			Expect(ok).To(BeTrue())
+			Expect(path.Internal()).To(Equal("/var/vcap/data/job_name/cache"))
+			Expect(path.External()).To(Equal(root + "/data/job_name/cache"))
+		})
+
+		It("resolves paths written as they are on the host", func() {
+			path, ok := bosh.NewEnv(root).Resolve(root + "/data/job_name/cache")
+			Expect(ok).To(BeTrue())
+			Expect(path.Internal()).To(Equal("/var/vcap/data/job_name/cache"))
+			Expect(path.External()).To(Equal(root + "/data/job_name/cache"))
+		})
+
+		It("does not resolve paths outside of the root", func() {
+			env := bosh.NewEnv(root)
+
+			for _, path := range []string{"/srv/cache", "/var/vcap", root, "/var/vcap/../etc", "/var/vcapper"} {
+				_, ok := env.Resolve(path)
+				Expect(ok).To(BeFalse(), path)
+			}
+		})
+	})
+
+	Describe("RelocateState", func() {
+		var env *bosh.Env
+
+		BeforeEach(func() {
+			env = bosh.NewEnv(root)
+			env.RelocateState("sys/run", "/run/vcap")
+			env.RelocateState("sys/run/bpm", "/run/bpm")
+		})
+
+		It("moves the external path of everything within the directory", func() {
+			run := env.RunDir("job_name")
+			Expect(run.Internal()).To(Equal("/var/vcap/sys/run/job_name"))
+			Expect(run.External()).To(Equal("/run/vcap/job_name"))
+			Expect(run.Join("job.sock").External()).To(Equal("/run/vcap/job_name/job.sock"))
+			Expect(env.Root().Join("sys", "run").External()).To(Equal("/run/vcap"))
+		})
+
+		It("uses the most specific relocation", func() {
+			Expect(env.RunDir("bpm").Join("job_name").External()).To(Equal("/run/bpm/job_name"))
+		})
+
+		It("leaves other paths alone", func() {
+			Expect(env.LogDir("job_name").External()).To(Equal(root + "/sys/log/job_name"))
+			Expect(env.Root().Join("sys", "runner").External()).To(Equal(root + "/sys/runner"))
+			Expect(env.Root().External()).To(Equal(root))
+		})
+
+		It("applies to resolved paths", func() {
+			path, ok := env.Resolve("/var/vcap/sys/run/job_name/job.sock")
+			Expect(ok).To(BeTrue())
+			Expect(path.External()).To(Equal("/run/vcap/job_name/job.sock"))
+		})
+	})
+
 	Describe("JobNames", func() {
 		BeforeEach(func() {
 			Expect(os.MkdirAll(filepath.Join(root, "jobs", "job-a"), 0700)).To(Succeed())
@@ -135,4 +194,21 @@ var _ = Describe("Bosh Environment", func() {
 			Expect(paths).To(ConsistOf("job-a", "job-b"))
 		})
 	})
+
+	Describe("Instance", func() {
+		It("reads the instance from the BOSH agent's spec", func() {
+			Expect(os.MkdirAll(filepath.Join(root, "bosh"), 0700)).To(Succeed())
+			spec := `{"deployment":"cf","name":"router","index":2,"id":"4d9f8ab5-6c3a-4f4e-9a0e-1c7e1b0f6f1e"}`
+			Expect(ioutil.WriteFile(filepath.Join(root, "bosh", "spec.json"), []byte(spec), 0600)).To(Succeed())
+
+			instance, err := bosh.NewEnv(root).Instance()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(instance).To(Equal(bosh.Instance{ID: "4d9f8ab5-6c3a-4f4e-9a0e-1c7e1b0f6f1e", Index: 2}))
+		})
+
+		It("returns an error when there is no spec", func() {
+			_, err := bosh.NewEnv(root).Instance()
+			Expect(err).To(HaveOccurred())
+		})
+	})
 })
@@ -0,0 +1,45 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package bosh
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+)
+
+// Instance is the part of the BOSH agent's description of the VM which bpm
+// needs to tell co-located instances of the same job apart.
+type Instance struct {
+	ID    string `json:"id"`
+	Index int    `json:"index"`
+}
+
+// Instance reads the description of the instance which the BOSH agent keeps
+// in bosh/spec.json beneath the root of the environment.
+func (e *Env) Instance() (Instance, error) {
+	data, err := ioutil.ReadFile(filepath.Join(e.root, "bosh", "spec.json"))
+	if err != nil {
+		return Instance{}, err
+	}
+
+	var instance Instance
+	if err := json.Unmarshal(data, &instance); err != nil {
+		return Instance{}, err
+	}
+
+	return instance, nil
+}
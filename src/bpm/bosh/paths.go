@@ -15,7 +15,10 @@
 
 package bosh
 
-import "path/filepath"
+import (
+	"path/filepath"
+	"strings"
+)
 
 // DefaultRoot is the standard root directory for all bosh jobs. All ephemeral
 // data, persistent data, logs, and configuration etc. are expected to be in a
@@ -36,6 +39,8 @@ const DefaultRoot = "/var/vcap"
 type Path struct {
 	root string
 	dir  string
+
+	state map[string]string
 }
 
 // Internal returns the internal representation of the Path.
@@ -43,16 +48,33 @@ func (p Path) Internal() string {
 	return filepath.Join(DefaultRoot, p.dir)
 }
 
-// Internal returns the external representation of the Path.
+// External returns the external representation of the Path. This is beneath
+// the directory which its state has been relocated to, if it has been.
 func (p Path) External() string {
-	return filepath.Join(p.root, p.dir)
+	var relocated, target string
+	for dir, t := range p.state {
+		if within(p.dir, dir) && len(dir) > len(relocated) {
+			relocated, target = dir, t
+		}
+	}
+
+	if target == "" {
+		return filepath.Join(p.root, p.dir)
+	}
+
+	rel, _ := filepath.Rel(relocated, p.dir)
+	return filepath.Join(target, rel)
+}
+
+func within(path, dir string) bool {
+	return path == dir || strings.HasPrefix(path, dir+"/")
 }
 
 // Join allows one or more elements to be joined onto a Path (similar to
 // filepath.Join). It returns a new Path with the new elements appended.
 func (p Path) Join(elements ...string) Path {
 	dir := filepath.Join(append([]string{p.dir}, elements...)...)
-	return Path{root: p.root, dir: dir}
+	return Path{root: p.root, dir: dir, state: p.state}
 }
 
 // String implements the Stringer interface but should never be used. This was
@@ -30,6 +30,13 @@ import (
 const cgroupRoot = "/sys/fs/cgroup"
 
 func Setup() error {
+	// The unified hierarchy is mounted by the host and runc enables the
+	// controllers which a container needs on the way down to its cgroup.
+	// Mounting v1 hierarchies beneath it would create cgroups instead.
+	if cgroups.IsCgroup2UnifiedMode() {
+		return nil
+	}
+
 	mnts, err := mountinfo.GetMounts(mountinfo.ParentsFilter(cgroupRoot))
 	if err != nil {
 		return err
@@ -0,0 +1,88 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package cgroups
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"bpm/models"
+)
+
+// ReadLimits reads the limits which the kernel enforces on a container from
+// its cgroups. The paths are the cgroup paths which runc recorded for the
+// container, as for ReadStats. Limits of controllers which are not enabled
+// for the container are left as zero.
+func ReadLimits(paths map[string]string) (*models.CgroupLimits, error) {
+	var limits models.CgroupLimits
+
+	if unified, ok := paths[""]; ok {
+		if _, err := os.Stat(unified); err != nil {
+			return nil, err
+		}
+
+		limits.MemoryBytes = readValue(filepath.Join(unified, "memory.max"))
+		limits.Pids = readValue(filepath.Join(unified, "pids.max"))
+		limits.CPUQuotaMicroseconds, limits.CPUPeriodMicroseconds = readCPUMax(filepath.Join(unified, "cpu.max"))
+
+		return &limits, nil
+	}
+
+	memory, ok := paths["memory"]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+
+	if _, err := os.Stat(memory); err != nil {
+		return nil, err
+	}
+
+	limits.MemoryBytes = readValue(filepath.Join(memory, "memory.limit_in_bytes"))
+
+	if pids, ok := paths["pids"]; ok {
+		limits.Pids = readValue(filepath.Join(pids, "pids.max"))
+	}
+
+	if cpu, ok := paths["cpu"]; ok {
+		// The quota is -1 when there is none, which is read as zero.
+		limits.CPUQuotaMicroseconds = readValue(filepath.Join(cpu, "cpu.cfs_quota_us"))
+		limits.CPUPeriodMicroseconds = readValue(filepath.Join(cpu, "cpu.cfs_period_us"))
+	}
+
+	return &limits, nil
+}
+
+// readCPUMax reads the quota and period from a cgroup v2 cpu.max file, which
+// contains "max PERIOD" when there is no quota.
+func readCPUMax(path string) (uint64, uint64) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, 0
+	}
+
+	fields := strings.Fields(string(data))
+	if len(fields) != 2 {
+		return 0, 0
+	}
+
+	quota, _ := strconv.ParseUint(fields[0], 10, 64)
+	period, _ := strconv.ParseUint(fields[1], 10, 64)
+
+	return quota, period
+}
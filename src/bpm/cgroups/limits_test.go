@@ -0,0 +1,89 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package cgroups
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"bpm/models"
+)
+
+var _ = Describe("ReadLimits", func() {
+	var cgroupDir string
+
+	writeFile := func(name, contents string) {
+		Expect(ioutil.WriteFile(filepath.Join(cgroupDir, name), []byte(contents), 0644)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		var err error
+		cgroupDir, err = ioutil.TempDir("", "cgroup")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(cgroupDir)).To(Succeed())
+	})
+
+	It("reads the limits of a container using cgroup v1", func() {
+		writeFile("memory.limit_in_bytes", "134217728\n")
+		writeFile("pids.max", "max\n")
+		writeFile("cpu.cfs_quota_us", "50000\n")
+		writeFile("cpu.cfs_period_us", "100000\n")
+
+		limits, err := ReadLimits(map[string]string{
+			"cpu":    cgroupDir,
+			"memory": cgroupDir,
+			"pids":   cgroupDir,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(limits).To(Equal(&models.CgroupLimits{
+			MemoryBytes:           134217728,
+			CPUQuotaMicroseconds:  50000,
+			CPUPeriodMicroseconds: 100000,
+		}))
+	})
+
+	It("reads a missing cgroup v1 CPU quota as no limit", func() {
+		writeFile("memory.limit_in_bytes", "9223372036854771712\n")
+		writeFile("cpu.cfs_quota_us", "-1\n")
+		writeFile("cpu.cfs_period_us", "100000\n")
+
+		limits, err := ReadLimits(map[string]string{"cpu": cgroupDir, "memory": cgroupDir})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(limits).To(Equal(&models.CgroupLimits{CPUPeriodMicroseconds: 100000}))
+	})
+
+	It("reads the limits of a container using cgroup v2", func() {
+		writeFile("memory.max", "max\n")
+		writeFile("pids.max", "100\n")
+		writeFile("cpu.max", "max 100000\n")
+
+		limits, err := ReadLimits(map[string]string{"": cgroupDir})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(limits).To(Equal(&models.CgroupLimits{Pids: 100, CPUPeriodMicroseconds: 100000}))
+	})
+
+	It("returns an error when the cgroup no longer exists", func() {
+		_, err := ReadLimits(map[string]string{"": filepath.Join(cgroupDir, "gone")})
+		Expect(os.IsNotExist(err)).To(BeTrue())
+	})
+})
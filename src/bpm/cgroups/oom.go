@@ -0,0 +1,67 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package cgroups
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// OOMKillCount returns the number of processes in a container which have
+// been killed by the kernel's OOM killer. The paths are the cgroup paths
+// which runc recorded for the container, keyed by subsystem (or by the empty
+// string on a host using the unified cgroup hierarchy).
+//
+// A count of zero is returned if the kernel does not report OOM kills or the
+// cgroup no longer exists.
+func OOMKillCount(paths map[string]string) (uint64, error) {
+	var file string
+	if memory, ok := paths["memory"]; ok {
+		file = filepath.Join(memory, "memory.oom_control")
+	} else if unified, ok := paths[""]; ok {
+		file = filepath.Join(unified, "memory.events")
+	} else {
+		return 0, nil
+	}
+
+	f, err := os.Open(file)
+	if os.IsNotExist(err) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	return oomKillCount(f)
+}
+
+func oomKillCount(r io.Reader) (uint64, error) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 || fields[0] != "oom_kill" {
+			continue
+		}
+
+		return strconv.ParseUint(fields[1], 10, 64)
+	}
+
+	return 0, scanner.Err()
+}
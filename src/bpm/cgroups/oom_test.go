@@ -0,0 +1,86 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package cgroups
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("OOM kills", func() {
+	Describe("parsing the OOM kill counter", func() {
+		It("reads the counter from cgroup v1 memory.oom_control", func() {
+			count, err := oomKillCount(strings.NewReader("oom_kill_disable 0\nunder_oom 0\noom_kill 3\n"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(count).To(Equal(uint64(3)))
+		})
+
+		It("reads the counter from cgroup v2 memory.events", func() {
+			count, err := oomKillCount(strings.NewReader("low 0\nhigh 0\nmax 12\noom 2\noom_kill 1\n"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(count).To(Equal(uint64(1)))
+		})
+
+		It("returns zero when the kernel does not report the counter", func() {
+			count, err := oomKillCount(strings.NewReader("oom_kill_disable 0\nunder_oom 0\n"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(count).To(BeZero())
+		})
+	})
+
+	Describe("OOMKillCount", func() {
+		var cgroupDir string
+
+		BeforeEach(func() {
+			var err error
+			cgroupDir, err = ioutil.TempDir("", "cgroup")
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			Expect(os.RemoveAll(cgroupDir)).To(Succeed())
+		})
+
+		It("reads the memory subsystem's cgroup", func() {
+			oomControl := filepath.Join(cgroupDir, "memory.oom_control")
+			Expect(ioutil.WriteFile(oomControl, []byte("oom_kill 2\n"), 0644)).To(Succeed())
+
+			count, err := OOMKillCount(map[string]string{"memory": cgroupDir})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(count).To(Equal(uint64(2)))
+		})
+
+		It("reads the unified cgroup", func() {
+			events := filepath.Join(cgroupDir, "memory.events")
+			Expect(ioutil.WriteFile(events, []byte("oom 1\noom_kill 1\n"), 0644)).To(Succeed())
+
+			count, err := OOMKillCount(map[string]string{"": cgroupDir})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(count).To(Equal(uint64(1)))
+		})
+
+		It("returns zero when the cgroup has been removed", func() {
+			count, err := OOMKillCount(map[string]string{"memory": filepath.Join(cgroupDir, "missing")})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(count).To(BeZero())
+		})
+	})
+})
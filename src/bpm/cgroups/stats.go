@@ -0,0 +1,167 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package cgroups
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"bpm/models"
+)
+
+// unlimited is the smallest value which the kernel reports for a limit which
+// has not been set on a cgroup v1 controller. It depends on the page size so
+// any value this large is treated as no limit.
+const unlimited = 1 << 62
+
+// Limit returns zero, meaning no limit, for a limit value which the kernel
+// (or runc, which passes it on) reports for an unlimited controller.
+func Limit(value uint64) uint64 {
+	if value >= unlimited {
+		return 0
+	}
+
+	return value
+}
+
+// ReadStats reads the resource usage of a container directly from its
+// cgroups. It is used when runc cannot report the usage itself. The paths are
+// the cgroup paths which runc recorded for the container, as for
+// OOMKillCount.
+//
+// Counters of controllers which are not enabled for the container are left
+// as zero. An error is returned if the container's cgroup no longer exists.
+func ReadStats(paths map[string]string) (*models.Stats, error) {
+	var (
+		stats models.Stats
+		err   error
+	)
+
+	if unified, ok := paths[""]; ok {
+		err = readUnifiedStats(unified, &stats)
+	} else {
+		err = readLegacyStats(paths, &stats)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	stats.Memory.OOMKills, err = OOMKillCount(paths)
+	if err != nil {
+		return nil, err
+	}
+
+	return &stats, nil
+}
+
+func readLegacyStats(paths map[string]string, stats *models.Stats) error {
+	memory, ok := paths["memory"]
+	if !ok {
+		return os.ErrNotExist
+	}
+
+	if _, err := os.Stat(memory); err != nil {
+		return err
+	}
+
+	if cpuacct, ok := paths["cpuacct"]; ok {
+		stats.CPU.UsageNanoseconds = readValue(filepath.Join(cpuacct, "cpuacct.usage"))
+	}
+
+	if cpu, ok := paths["cpu"]; ok {
+		throttling := readKeyedValues(filepath.Join(cpu, "cpu.stat"))
+		stats.CPU.Periods = throttling["nr_periods"]
+		stats.CPU.ThrottledPeriods = throttling["nr_throttled"]
+		stats.CPU.ThrottledNanoseconds = throttling["throttled_time"]
+	}
+
+	stats.Memory.UsageBytes = readValue(filepath.Join(memory, "memory.usage_in_bytes"))
+	stats.Memory.MaxUsageBytes = readValue(filepath.Join(memory, "memory.max_usage_in_bytes"))
+	stats.Memory.LimitBytes = readValue(filepath.Join(memory, "memory.limit_in_bytes"))
+
+	if pids, ok := paths["pids"]; ok {
+		stats.Pids.Current = readValue(filepath.Join(pids, "pids.current"))
+		stats.Pids.Limit = readValue(filepath.Join(pids, "pids.max"))
+	}
+
+	return nil
+}
+
+func readUnifiedStats(dir string, stats *models.Stats) error {
+	if _, err := os.Stat(dir); err != nil {
+		return err
+	}
+
+	cpu := readKeyedValues(filepath.Join(dir, "cpu.stat"))
+	stats.CPU.UsageNanoseconds = cpu["usage_usec"] * 1000
+	stats.CPU.Periods = cpu["nr_periods"]
+	stats.CPU.ThrottledPeriods = cpu["nr_throttled"]
+	stats.CPU.ThrottledNanoseconds = cpu["throttled_usec"] * 1000
+
+	stats.Memory.UsageBytes = readValue(filepath.Join(dir, "memory.current"))
+	stats.Memory.MaxUsageBytes = readValue(filepath.Join(dir, "memory.peak"))
+	stats.Memory.LimitBytes = readValue(filepath.Join(dir, "memory.max"))
+
+	stats.Pids.Current = readValue(filepath.Join(dir, "pids.current"))
+	stats.Pids.Limit = readValue(filepath.Join(dir, "pids.max"))
+
+	return nil
+}
+
+// readValue reads a file containing a single number. Missing files, "max",
+// and values which mean there is no limit are all read as zero.
+func readValue(path string) uint64 {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+
+	value, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return 0
+	}
+
+	return Limit(value)
+}
+
+// readKeyedValues reads a file of "key value" lines such as cpu.stat.
+func readKeyedValues(path string) map[string]uint64 {
+	values := map[string]uint64{}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return values
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+
+		if value, err := strconv.ParseUint(fields[1], 10, 64); err == nil {
+			values[fields[0]] = value
+		}
+	}
+
+	return values
+}
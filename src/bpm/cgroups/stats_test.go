@@ -0,0 +1,94 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package cgroups
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"bpm/models"
+)
+
+var _ = Describe("ReadStats", func() {
+	var cgroupDir string
+
+	writeFile := func(name, contents string) {
+		Expect(ioutil.WriteFile(filepath.Join(cgroupDir, name), []byte(contents), 0644)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		var err error
+		cgroupDir, err = ioutil.TempDir("", "cgroup")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(cgroupDir)).To(Succeed())
+	})
+
+	It("reads the stats of a container using cgroup v1", func() {
+		writeFile("cpuacct.usage", "1500000\n")
+		writeFile("cpu.stat", "nr_periods 20\nnr_throttled 4\nthrottled_time 250000\n")
+		writeFile("memory.usage_in_bytes", "1024\n")
+		writeFile("memory.max_usage_in_bytes", "2048\n")
+		writeFile("memory.limit_in_bytes", "9223372036854771712\n")
+		writeFile("memory.oom_control", "under_oom 0\noom_kill 1\n")
+		writeFile("pids.current", "3\n")
+		writeFile("pids.max", "max\n")
+
+		stats, err := ReadStats(map[string]string{
+			"cpu":     cgroupDir,
+			"cpuacct": cgroupDir,
+			"memory":  cgroupDir,
+			"pids":    cgroupDir,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stats).To(Equal(&models.Stats{
+			CPU:    models.CPUStats{UsageNanoseconds: 1500000, Periods: 20, ThrottledPeriods: 4, ThrottledNanoseconds: 250000},
+			Memory: models.MemoryStats{UsageBytes: 1024, MaxUsageBytes: 2048, OOMKills: 1},
+			Pids:   models.PidsStats{Current: 3},
+		}))
+	})
+
+	It("reads the stats of a container using cgroup v2", func() {
+		writeFile("cpu.stat", "usage_usec 1500\nuser_usec 1000\nsystem_usec 500\nnr_periods 20\nnr_throttled 4\nthrottled_usec 250\n")
+		writeFile("memory.current", "1024\n")
+		writeFile("memory.max", "8388608\n")
+		writeFile("memory.events", "low 0\nhigh 0\nmax 0\noom 0\noom_kill 0\n")
+		writeFile("pids.current", "3\n")
+		writeFile("pids.max", "100\n")
+
+		stats, err := ReadStats(map[string]string{"": cgroupDir})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stats).To(Equal(&models.Stats{
+			CPU:    models.CPUStats{UsageNanoseconds: 1500000, Periods: 20, ThrottledPeriods: 4, ThrottledNanoseconds: 250000},
+			Memory: models.MemoryStats{UsageBytes: 1024, LimitBytes: 8388608},
+			Pids:   models.PidsStats{Current: 3, Limit: 100},
+		}))
+	})
+
+	It("returns an error when the container's cgroup does not exist", func() {
+		_, err := ReadStats(map[string]string{"": filepath.Join(cgroupDir, "missing")})
+		Expect(err).To(HaveOccurred())
+
+		_, err = ReadStats(map[string]string{"memory": filepath.Join(cgroupDir, "missing")})
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -24,10 +24,16 @@ import (
 )
 
 func main() {
-	if err := commands.RootCmd.Execute(); err != nil {
+	cmd, err := commands.RootCmd.ExecuteC()
+	commands.FinishTracing(err, os.Stderr)
+
+	if commands.WantsJSONResult(cmd) {
+		if perr := commands.PrintResult(cmd, err, os.Stdout); perr != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", perr.Error())
+		}
+	} else if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
-		os.Exit(exitstatus.FromError(err))
 	}
 
-	os.Exit(0)
+	os.Exit(exitstatus.FromError(err))
 }
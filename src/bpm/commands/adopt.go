@@ -0,0 +1,95 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package commands
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+var adoptPid int
+
+func init() {
+	adoptCommand.Flags().StringVarP(&procName, "process", "p", "", "optional process name")
+	adoptCommand.Flags().IntVar(&adoptPid, "pid", 0, "the pid of the running process to adopt")
+	RootCmd.AddCommand(adoptCommand)
+}
+
+var adoptCommand = &cobra.Command{
+	Long: `registers an already running process as a BOSH Process
+
+  The process is not moved into a container and the limits in the job's
+  configuration are not applied to it. bpm will report its state and stop it
+  when asked to until the job is next started by bpm.
+`,
+	RunE:     adopt,
+	Short:    "registers an already running process as a BOSH Process",
+	Use:      "adopt <job-name> --pid <pid>",
+	PreRunE:  adoptPre,
+	PostRunE: adoptPost,
+}
+
+func adoptPre(cmd *cobra.Command, args []string) error {
+	if err := validateInput(args); err != nil {
+		return err
+	}
+
+	if adoptPid <= 0 {
+		return errors.New("must specify the pid of the process to adopt")
+	}
+
+	cmd.SilenceUsage = true
+
+	if err := setupBpmLogs("adopt"); err != nil {
+		return err
+	}
+
+	return acquireLifecycleLock()
+}
+
+func adoptPost(cmd *cobra.Command, args []string) error {
+	return releaseLifecycleLock()
+}
+
+func adopt(cmd *cobra.Command, _ []string) error {
+	logger.Info("starting")
+	defer logger.Info("complete")
+
+	jobCfg, err := bpmCfg.ParseJobConfig()
+	if err != nil {
+		logger.Error("failed-to-parse-config", err)
+		return fmt.Errorf("failed to parse job configuration: %s", err)
+	}
+
+	if _, err := processByNameFromJobConfig(jobCfg, procName); err != nil {
+		logger.Error("process-not-defined", err)
+		return fmt.Errorf("process %q not present in job configuration (%s)", procName, bpmCfg.JobConfig())
+	}
+
+	runcLifecycle, err := newRuncLifecycle()
+	if err != nil {
+		return err
+	}
+
+	if err := runcLifecycle.AdoptProcess(ctx, logger, bpmCfg, adoptPid); err != nil {
+		logger.Error("failed-to-adopt", err)
+		return fmt.Errorf("failed to adopt process: %s", err)
+	}
+
+	return nil
+}
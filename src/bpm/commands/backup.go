@@ -0,0 +1,245 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+
+	"code.cloudfoundry.org/lager"
+	"github.com/spf13/cobra"
+
+	"bpm/config"
+	"bpm/exitstatus"
+	"bpm/models"
+	"bpm/runc/lifecycle"
+)
+
+var backupLongText = `
+runs a backup command while the processes of a BOSH Job are quiesced
+
+  For each running process of the job (or only --process) bpm runs its
+  pre_backup hook and then freezes it unless its backup_quiesce is none. The
+  command is run once every process has been quiesced, after which they are
+  resumed and their post_backup hooks run whether or not the command
+  succeeded. The processes' locks are held throughout, so starting or
+  stopping them waits until the backup has finished.
+`
+
+func init() {
+	backupCommand.Flags().StringVarP(&procName, "process", "p", "", "only quiesce this process")
+	RootCmd.AddCommand(backupCommand)
+}
+
+var backupCommand = &cobra.Command{
+	Long:    backupLongText,
+	RunE:    backup,
+	Short:   "runs a backup command while the processes of a BOSH Job are quiesced",
+	Use:     "backup <job-name> -- <command> [args...]",
+	PreRunE: backupPre,
+}
+
+func backupPre(cmd *cobra.Command, args []string) error {
+	if err := validateInput(args); err != nil {
+		return err
+	}
+
+	if len(args) < 2 || cmd.ArgsLenAtDash() != 1 {
+		return errors.New("must specify a backup command after --")
+	}
+
+	cmd.SilenceUsage = true
+
+	return setupBpmLogs("backup")
+}
+
+// backupTarget is a running process which is quiesced for a backup, along
+// with how far it has got so that only what was done is undone.
+type backupTarget struct {
+	cfg      *config.BPMConfig
+	procCfg  *config.ProcessConfig
+	prepared bool
+	frozen   bool
+}
+
+func backup(cmd *cobra.Command, args []string) error {
+	logger.Info("starting")
+	defer logger.Info("complete")
+
+	jobCfg, err := bpmCfg.ParseJobConfig()
+	if err != nil {
+		logger.Error("failed-to-parse-config", err)
+		return configError(fmt.Errorf("failed to parse job configuration: %s", err))
+	}
+
+	procCfgs := jobCfg.Processes
+	if cmd.Flags().Changed("process") {
+		procCfg, err := processByNameFromJobConfig(jobCfg, procName)
+		if err != nil {
+			return configError(fmt.Errorf("process %q not present in job configuration (%s)", procName, bpmCfg.JobConfig()))
+		}
+		procCfgs = []*config.ProcessConfig{procCfg}
+	}
+
+	runcLifecycle, err := newRuncLifecycle()
+	if err != nil {
+		return err
+	}
+
+	var targets []*backupTarget
+	for _, procCfg := range procCfgs {
+		cfg := config.NewBPMConfig(boshEnv, bpmCfg.JobName(), procCfg.Name)
+
+		lock, err := lockJob(logger, cfg)
+		if err != nil {
+			return err
+		}
+		defer lock.Unlock()
+
+		// Thawing a quarantined process after the backup would let it
+		// carry on, so it is left frozen instead.
+		if q, err := readQuarantine(cfg); err != nil {
+			return err
+		} else if q != nil {
+			logger.Info("skipping-quarantined-process", lager.Data{"process": procCfg.Name})
+			fmt.Fprintf(cmd.ErrOrStderr(), "%s is quarantined and is backed up as it is\n", procCfg.Name)
+			continue
+		}
+
+		process, err := runcLifecycle.StatProcess(ctx, cfg)
+		if err != nil && !lifecycle.IsNotExist(err) {
+			return fmt.Errorf("failed to get process %s: %s", procCfg.Name, err)
+		} else if lifecycle.IsNotExist(err) || process.Status != models.ProcessStateRunning {
+			logger.Info("skipping-process-which-is-not-running", lager.Data{"process": procCfg.Name})
+			fmt.Fprintf(cmd.ErrOrStderr(), "%s is not running and is backed up as it is\n", procCfg.Name)
+			continue
+		}
+
+		targets = append(targets, &backupTarget{cfg: cfg, procCfg: procCfg})
+	}
+
+	err = quiesceForBackup(runcLifecycle, targets, cmd.OutOrStdout(), cmd.ErrOrStderr())
+	if err == nil {
+		err = runBackupCommand(args[1:], cmd.OutOrStdout(), cmd.ErrOrStderr())
+	}
+
+	if resumeErr := resumeAfterBackup(runcLifecycle, targets, cmd.OutOrStdout(), cmd.ErrOrStderr()); resumeErr != nil {
+		if err == nil {
+			return resumeErr
+		}
+		logger.Error("failed-to-resume", resumeErr)
+	}
+
+	return err
+}
+
+// quiesceForBackup runs the pre_backup hook of every process before freezing
+// any of them so that the hooks can still talk to each other.
+func quiesceForBackup(runcLifecycle *lifecycle.RuncLifecycle, targets []*backupTarget, stdout, stderr io.Writer) error {
+	for _, t := range targets {
+		if t.procCfg.Hooks != nil && t.procCfg.Hooks.PreBackup != "" {
+			err := runcLifecycle.RunBackupHook(ctx, logger, t.cfg, t.procCfg.Hooks.PreBackup, stdout, stderr)
+			if err != nil {
+				logger.Error("pre-backup-hook-failed", err, lager.Data{"process": t.procCfg.Name})
+				return fmt.Errorf("pre_backup hook of %s failed: %s", t.procCfg.Name, err)
+			}
+		}
+		t.prepared = true
+	}
+
+	for _, t := range targets {
+		if t.procCfg.BackupQuiesce() != config.BackupQuiescePause {
+			continue
+		}
+
+		if err := runcLifecycle.FreezeProcess(ctx, logger, t.cfg); err != nil {
+			logger.Error("failed-to-freeze", err, lager.Data{"process": t.procCfg.Name})
+			return fmt.Errorf("failed to freeze %s: %s", t.procCfg.Name, err)
+		}
+		t.frozen = true
+	}
+
+	return ctx.Err()
+}
+
+// resumeAfterBackup undoes whatever quiesceForBackup managed to do, in the
+// reverse order. It carries on after a failure so that one process which
+// cannot be resumed does not leave the others quiesced.
+func resumeAfterBackup(runcLifecycle *lifecycle.RuncLifecycle, targets []*backupTarget, stdout, stderr io.Writer) error {
+	var firstErr error
+	fail := func(err error) {
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	for i := len(targets) - 1; i >= 0; i-- {
+		t := targets[i]
+		if !t.frozen {
+			continue
+		}
+
+		if err := runcLifecycle.ThawProcess(logger, t.cfg); err != nil {
+			logger.Error("failed-to-thaw", err, lager.Data{"process": t.procCfg.Name})
+			fail(fmt.Errorf("failed to resume %s: %s", t.procCfg.Name, err))
+		}
+	}
+
+	// The hooks undo what the pre_backup hooks did, so they are run even if
+	// bpm has been interrupted.
+	for i := len(targets) - 1; i >= 0; i-- {
+		t := targets[i]
+		if !t.prepared || t.procCfg.Hooks == nil || t.procCfg.Hooks.PostBackup == "" {
+			continue
+		}
+
+		err := runcLifecycle.RunBackupHook(context.Background(), logger, t.cfg, t.procCfg.Hooks.PostBackup, stdout, stderr)
+		if err != nil {
+			logger.Error("post-backup-hook-failed", err, lager.Data{"process": t.procCfg.Name})
+			fail(fmt.Errorf("post_backup hook of %s failed: %s", t.procCfg.Name, err))
+		}
+	}
+
+	return firstErr
+}
+
+// runBackupCommand runs the backup command on the host. It is left to finish
+// if bpm is interrupted so that the processes are not resumed under a backup
+// which is still being taken.
+func runBackupCommand(args []string, stdout, stderr io.Writer) error {
+	logger.Info("running-backup-command", lager.Data{"command": args[0]})
+
+	backupCmd := exec.Command(args[0], args[1:]...)
+	backupCmd.Stdin = os.Stdin
+	backupCmd.Stdout = stdout
+	backupCmd.Stderr = stderr
+
+	err := backupCmd.Run()
+	if eerr, ok := err.(*exec.ExitError); ok {
+		return &exitstatus.Error{
+			Status: eerr.ExitCode(),
+			Err:    fmt.Errorf("backup command exited with failure: %s", err),
+		}
+	} else if err != nil {
+		return fmt.Errorf("failed to run backup command: %s", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,158 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"bpm/config"
+	"bpm/models"
+	"bpm/runc/client"
+	"bpm/runc/lifecycle"
+	"bpm/units"
+)
+
+const DefaultChaosDuration = 10 * time.Second
+
+var chaosLongText = `
+injects a controlled failure into a BOSH Process
+
+  Actions:
+    pause     freezes the process for --duration before resuming it
+    throttle  restricts the process to 1% of a CPU for --duration
+    signal    sends --signal (or a random signal if not given) to the process
+
+  This command is disabled unless the operator has enabled it in the bpm
+  job's configuration (chaos.enabled).
+`
+
+var (
+	chaosDuration time.Duration
+	chaosSignal   string
+
+	// The signals which may be chosen when no signal is given.
+	chaosSignals = []client.Signal{client.Hup, client.Int, client.Usr1, client.Usr2, client.Term, client.Kill}
+)
+
+func init() {
+	chaosCommand.Flags().StringVarP(&procName, "process", "p", "", "optional process name")
+	chaosCommand.Flags().VarP(units.DurationFlag(&chaosDuration, DefaultChaosDuration), "duration", "d", "how long the failure should last")
+	chaosCommand.Flags().StringVarP(&chaosSignal, "signal", "s", "", "the signal to send (random if not given)")
+	RootCmd.AddCommand(chaosCommand)
+}
+
+var chaosCommand = &cobra.Command{
+	Long:     chaosLongText,
+	RunE:     chaos,
+	Short:    "injects a controlled failure into a BOSH Process",
+	Use:      "chaos <job-name> <pause|throttle|signal>",
+	PreRunE:  chaosPre,
+	PostRunE: chaosPost,
+}
+
+func chaosPre(cmd *cobra.Command, args []string) error {
+	if err := validateInput(args); err != nil {
+		return err
+	}
+
+	if len(args) < 2 {
+		return errors.New("must specify an action")
+	}
+
+	cmd.SilenceUsage = true
+
+	hostCfg, err := config.ParseHostConfig(config.HostConfigPath(boshEnv))
+	if err != nil {
+		return fmt.Errorf("failed to parse bpm configuration: %s", err)
+	}
+
+	if !hostCfg.ChaosEnabled() {
+		return errors.New("failure injection is disabled on this host")
+	}
+
+	if err := setupBpmLogs("chaos"); err != nil {
+		return err
+	}
+
+	return acquireLifecycleLock()
+}
+
+func chaosPost(cmd *cobra.Command, args []string) error {
+	return releaseLifecycleLock()
+}
+
+func chaos(cmd *cobra.Command, args []string) error {
+	action := args[1]
+
+	logger.Info("starting", map[string]interface{}{"action": action})
+	defer logger.Info("complete")
+
+	runcLifecycle, err := newRuncLifecycle()
+	if err != nil {
+		return err
+	}
+
+	if err := refuseQuarantined(bpmCfg); err != nil {
+		logger.Error("refusing-to-inject-failure", err)
+		return err
+	}
+
+	process, err := runcLifecycle.StatProcess(ctx, bpmCfg)
+	if err != nil && !lifecycle.IsNotExist(err) {
+		return fmt.Errorf("failed to get job: %s", err)
+	} else if lifecycle.IsNotExist(err) || process.Status != models.ProcessStateRunning {
+		return errors.New("process is not running or could not be found")
+	}
+
+	switch action {
+	case "pause":
+		err = runcLifecycle.PauseProcess(ctx, logger, bpmCfg, chaosDuration)
+	case "throttle":
+		err = runcLifecycle.ThrottleProcess(ctx, logger, bpmCfg, chaosDuration)
+	case "signal":
+		var signal client.Signal
+		signal, err = chosenChaosSignal()
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(cmd.OutOrStdout(), "sending SIG%s\n", signal)
+		err = runcLifecycle.SignalProcess(ctx, logger, bpmCfg, signal)
+	default:
+		return fmt.Errorf("invalid action: %s", action)
+	}
+
+	if err != nil {
+		logger.Error("failed-to-inject-failure", err)
+		return fmt.Errorf("failed to inject failure: %s", err)
+	}
+
+	return nil
+}
+
+func chosenChaosSignal() (client.Signal, error) {
+	if chaosSignal != "" {
+		return client.ParseSignal(chaosSignal)
+	}
+
+	rand.Seed(time.Now().UnixNano())
+	return chaosSignals[rand.Intn(len(chaosSignals))], nil
+}
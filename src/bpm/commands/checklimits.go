@@ -0,0 +1,88 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package commands
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"bpm/presenters"
+	"bpm/runc/lifecycle"
+)
+
+var checkLimitsFormat string
+
+func init() {
+	checkLimitsCommand.Flags().StringVarP(&procName, "process", "p", "", "optional process name")
+	checkLimitsCommand.Flags().StringVarP(&checkLimitsFormat, "format", "o", "table", "output format (table or json)")
+	RootCmd.AddCommand(checkLimitsCommand)
+}
+
+var checkLimitsCommand = &cobra.Command{
+	Long:    "Compares the resource and cgroup limits which a running process actually has with the limits it was started with. It exits with an error if any of them differ.",
+	RunE:    checkLimits,
+	Short:   "checks that a process has the limits it was configured with",
+	Use:     "check-limits <job-name>",
+	PreRunE: checkLimitsPre,
+}
+
+func checkLimitsPre(cmd *cobra.Command, args []string) error {
+	return validateInput(args)
+}
+
+func checkLimits(cmd *cobra.Command, _ []string) error {
+	printChecks := presenters.PrintLimitChecks
+	switch checkLimitsFormat {
+	case "table":
+	case "json":
+		printChecks = presenters.PrintLimitChecksJSON
+	default:
+		return fmt.Errorf("invalid format: %s", checkLimitsFormat)
+	}
+
+	cmd.SilenceUsage = true
+
+	runcLifecycle, err := newRuncLifecycle()
+	if err != nil {
+		return err
+	}
+
+	checks, err := runcLifecycle.CheckLimits(ctx, bpmCfg)
+	if lifecycle.IsNotExist(err) {
+		return errors.New("process is not running or could not be found")
+	} else if err != nil {
+		return fmt.Errorf("failed to check limits: %s", err)
+	}
+
+	if err := printChecks(checks, cmd.OutOrStdout()); err != nil {
+		return err
+	}
+
+	var differ int
+	for _, check := range checks {
+		if !check.Matches {
+			differ++
+		}
+	}
+
+	if differ > 0 {
+		return fmt.Errorf("%d limit(s) differ from the configuration", differ)
+	}
+
+	return nil
+}
@@ -0,0 +1,120 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package commands
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/spf13/cobra"
+
+	"bpm/config"
+)
+
+var completeRunning bool
+
+func init() {
+	completeCommand.Flags().BoolVar(&completeRunning, "running", false, "only list processes which are running")
+	RootCmd.AddCommand(completeCommand)
+}
+
+// completeCommand lists the names which shell completion offers. It runs on
+// every press of tab so it only reads configuration and pid files: it takes no
+// locks, does not call runc, and never reports an error.
+var completeCommand = &cobra.Command{
+	Hidden: true,
+	Run:    complete,
+	Use:    "__complete <jobs|processes> [job-name]",
+	Args:   cobra.RangeArgs(1, 2),
+
+	PersistentPreRunE: completePre,
+}
+
+func completePre(cmd *cobra.Command, _ []string) error {
+	// A broken host configuration only means that the state directories
+	// are not where bpm expects them, which at worst offers too few names.
+	_ = relocateState(ioutil.Discard)
+	return nil
+}
+
+func complete(cmd *cobra.Command, args []string) {
+	var names []string
+	switch {
+	case args[0] == "jobs" && len(args) == 1:
+		names = completeJobs()
+	case args[0] == "processes" && len(args) == 2:
+		names = completeProcesses(args[1])
+	}
+
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintln(cmd.OutOrStdout(), name)
+	}
+}
+
+func completeJobs() []string {
+	var jobs []string
+	for _, job := range boshEnv.JobNames() {
+		if len(completeProcesses(job)) > 0 {
+			jobs = append(jobs, job)
+		}
+	}
+
+	return jobs
+}
+
+func completeProcesses(job string) []string {
+	jobCfg, err := config.NewBPMConfig(boshEnv, job, "").ParseJobConfig()
+	if err != nil {
+		return nil
+	}
+
+	var procs []string
+	for _, proc := range jobCfg.Processes {
+		if completeRunning && !pidFileAlive(config.NewBPMConfig(boshEnv, job, proc.Name)) {
+			continue
+		}
+		procs = append(procs, proc.Name)
+	}
+
+	return procs
+}
+
+// pidFileAlive reports whether the process recorded in the pid file of cfg,
+// or the one which was adopted, still exists.
+func pidFileAlive(cfg *config.BPMConfig) bool {
+	for _, path := range []string{cfg.PidFile().External(), cfg.AdoptedFile().External()} {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			continue
+		}
+
+		pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+		if err != nil || pid <= 0 {
+			continue
+		}
+
+		if err := syscall.Kill(pid, 0); err == nil || err == syscall.EPERM {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,133 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	RootCmd.AddCommand(completionCommand)
+}
+
+var completionCommand = &cobra.Command{
+	Long: `prints a bash completion script for bpm
+
+  The script completes commands and flags, and the job and process names
+  configured on the host. Load it with:
+
+    source <(bpm completion bash)
+
+  zsh can use the same script after running 'autoload bashcompinit && bashcompinit'.
+`,
+	RunE:      completion,
+	Short:     "prints a shell completion script",
+	Use:       "completion bash",
+	Args:      cobra.ExactArgs(1),
+	ValidArgs: []string{"bash"},
+
+	// Generating the script needs neither root nor bpm's state.
+	PersistentPreRunE: func(*cobra.Command, []string) error { return nil },
+}
+
+// runningProcessCommands only make sense for processes which are running, so
+// completion only offers those.
+var runningProcessCommands = map[string]bool{
+	"backup":       true,
+	"check-limits": true,
+	"chaos":        true,
+	"events":       true,
+	"exec":         true,
+	"pid":          true,
+	"shell":        true,
+	"stats":        true,
+	"stop":         true,
+	"trace":        true,
+}
+
+func completion(cmd *cobra.Command, args []string) error {
+	if args[0] != "bash" {
+		return errors.New("only bash completion is supported")
+	}
+
+	root := cmd.Root()
+
+	var jobCommands, runningCommands []string
+	for _, c := range root.Commands() {
+		if !strings.Contains(c.Use, "job-name>") {
+			continue
+		}
+
+		name := root.Name() + "_" + c.Name()
+		if runningProcessCommands[c.Name()] {
+			runningCommands = append(runningCommands, name)
+		} else {
+			jobCommands = append(jobCommands, name)
+		}
+
+		if c.Flags().Lookup("process") != nil {
+			if err := c.MarkFlagCustom("process", "__bpm_complete_process"); err != nil {
+				return err
+			}
+		}
+	}
+	sort.Strings(jobCommands)
+	sort.Strings(runningCommands)
+
+	root.BashCompletionFunction = fmt.Sprintf(bashCompletionFunctions,
+		strings.Join(runningCommands, "|"),
+		strings.Join(jobCommands, "|"),
+	)
+
+	return root.GenBashCompletion(cmd.OutOrStdout())
+}
+
+// bashCompletionFunctions are called by cobra's completion script for the
+// arguments and flags which it cannot complete itself. The names come from
+// the hidden __complete command.
+const bashCompletionFunctions = `
+__bpm_running_flag()
+{
+    case ${last_command} in
+        %[1]s)
+            echo --running
+            ;;
+    esac
+}
+
+__bpm_custom_func()
+{
+    case ${last_command} in
+        %[1]s|%[2]s)
+            if [[ ${#nouns[@]} -eq 0 ]]; then
+                COMPREPLY=( $(compgen -W "$(bpm __complete jobs $(__bpm_running_flag) 2>/dev/null)" -- "${cur}") )
+            fi
+            ;;
+    esac
+}
+
+__bpm_complete_process()
+{
+    if [[ ${#nouns[@]} -gt 0 ]]; then
+        COMPREPLY=( $(compgen -W "$(bpm __complete processes $(__bpm_running_flag) "${nouns[0]}" 2>/dev/null)" -- "${cur}") )
+    fi
+}
+`
@@ -0,0 +1,95 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package commands
+
+import (
+	"fmt"
+	"os"
+
+	"code.cloudfoundry.org/lager"
+	"github.com/spf13/cobra"
+
+	"bpm/config"
+	"bpm/coredump"
+)
+
+func init() {
+	RootCmd.AddCommand(dumpCoreCommand)
+	RootCmd.AddCommand(coreHandlerCommand)
+}
+
+// dumpCoreCommand is run by the kernel with a core dump on its stdin once
+// bpm's core dump handler has been installed as the host's core pattern.
+var dumpCoreCommand = &cobra.Command{
+	DisableFlagParsing: true,
+	Hidden:             true,
+	RunE:               dumpCore,
+	Short:              "captures a core dump piped to it by the kernel",
+	Use:                "dump-core <core pattern specifiers>...",
+}
+
+func dumpCore(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+
+	capture, err := coredump.NewDumper(boshEnv, "/proc").Dump(args, os.Stdin)
+	if err != nil {
+		return err
+	}
+
+	if capture == nil {
+		return nil
+	}
+
+	// The core has been captured by now so failing to log it is not
+	// worth reporting to a kernel which ignores us.
+	l, _, err := newJobLogger(capture.Config, "dump-core")
+	if err == nil {
+		l.Info("captured-core-dump", lager.Data{
+			"path":      capture.Path,
+			"truncated": capture.Truncated,
+		})
+	}
+
+	return nil
+}
+
+// coreHandlerCommand is run by the pre-start script of the bpm job to install
+// or remove the core dump handler depending on the bpm.capture_cores
+// property.
+var coreHandlerCommand = &cobra.Command{
+	Args:   cobra.ExactArgs(1),
+	Hidden: true,
+	RunE:   coreHandler,
+	Short:  "installs or removes bpm's core dump handler",
+	Use:    "core-handler install|uninstall",
+}
+
+func coreHandler(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+
+	switch args[0] {
+	case "install":
+		return coredump.Install(
+			coredump.PatternFile,
+			config.HostCorePatternFile(boshEnv),
+			coredump.Handler(config.BPMPath(boshEnv)),
+		)
+	case "uninstall":
+		return coredump.Uninstall(coredump.PatternFile, config.HostCorePatternFile(boshEnv))
+	default:
+		return fmt.Errorf("unknown action %q: must be install or uninstall", args[0])
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package commands
+
+import (
+	"errors"
+	"fmt"
+
+	"code.cloudfoundry.org/lager"
+	"github.com/spf13/cobra"
+
+	"bpm/models"
+	"bpm/runc/lifecycle"
+)
+
+var deleteForce bool
+
+func init() {
+	deleteCommand.Flags().StringVarP(&procName, "process", "p", "", "optional process name")
+	deleteCommand.Flags().BoolVar(&deleteForce, "force", false, "kill the process first if it is still running")
+	addOutputFlag(deleteCommand)
+	RootCmd.AddCommand(deleteCommand)
+}
+
+var deleteCommand = &cobra.Command{
+	RunE:     deleteProcess,
+	Short:    "removes the container of a stopped BOSH Process",
+	Use:      "delete <job-name>",
+	PreRunE:  deletePre,
+	PostRunE: deletePost,
+}
+
+func deletePre(cmd *cobra.Command, args []string) error {
+	if err := validateInput(args); err != nil {
+		return err
+	}
+
+	cmd.SilenceUsage = true
+
+	if err := setupBpmLogs("delete"); err != nil {
+		return err
+	}
+
+	return acquireLifecycleLock()
+}
+
+func deletePost(cmd *cobra.Command, args []string) error {
+	return releaseLifecycleLock()
+}
+
+func deleteProcess(cmd *cobra.Command, _ []string) error {
+	logger.Info("starting")
+	defer logger.Info("complete")
+
+	runcLifecycle, err := newRuncLifecycle()
+	if err != nil {
+		return err
+	}
+
+	q, err := readQuarantine(bpmCfg)
+	if err != nil {
+		return err
+	}
+
+	process, err := runcLifecycle.StatProcess(ctx, bpmCfg)
+	if lifecycle.IsNotExist(err) {
+		logger.Info("job-already-deleted")
+		return clearQuarantine(bpmCfg)
+	} else if err != nil && deleteForce {
+		logger.Error("failed-to-get-job", err)
+		if err := forceCleanupBrokenRuncState(logger, runcLifecycle); err != nil {
+			recordMetrics(logger, bpmCfg, countCleanupFailure)
+			recordStatus(models.ProcessStateFailed, 0, err)
+			return err
+		}
+
+		if err := clearQuarantine(bpmCfg); err != nil {
+			return err
+		}
+
+		recordStatus(models.ProcessStateStopped, 0, nil)
+		return nil
+	} else if err != nil {
+		logger.Error("failed-to-get-job", err)
+		return fmt.Errorf("failed to get job-process status: %s", err)
+	}
+
+	// Deleting a quarantined process is one of the ways to resolve its
+	// quarantine, so it does not need to be forced.
+	if q != nil {
+		logger.Info("deleting-quarantined-process", lager.Data{"since": q.Since, "reason": q.Reason})
+	} else if !process.HasExited() {
+		if !deleteForce {
+			return errors.New("process is still running: stop it or use --force to kill it")
+		}
+		logger.Info("killing-running-process", lager.Data{"status": process.Status})
+	}
+
+	if err := removeProcess(logger, runcLifecycle, bpmCfg); err != nil {
+		logger.Error("failed-to-cleanup", err)
+		recordMetrics(logger, bpmCfg, countCleanupFailure)
+		recordStatus(models.ProcessStateFailed, 0, err)
+		return fmt.Errorf("failed to cleanup job-process: %s", err)
+	}
+
+	if err := clearQuarantine(bpmCfg); err != nil {
+		return err
+	}
+
+	recordStatus(models.ProcessStateStopped, 0, nil)
+	return nil
+}
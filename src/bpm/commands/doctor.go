@@ -0,0 +1,97 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package commands
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"bpm/doctor"
+	"bpm/presenters"
+	"bpm/sysfeat"
+)
+
+var (
+	doctorFormat string
+	doctorNested bool
+)
+
+func init() {
+	doctorCommand.Flags().StringVarP(&doctorFormat, "format", "o", "table", "output format (table or json)")
+	doctorCommand.Flags().BoolVar(&doctorNested, "nested", false, "also report the kernel features which a nested host, such as bosh-lite, lacks")
+	RootCmd.AddCommand(doctorCommand)
+}
+
+var doctorCommand = &cobra.Command{
+	Long:  "Checks that the host is set up for bpm to run processes, such as that every directory which bpm keeps its state in can be written to. It exits with an error if any of the checks fail. With --nested it also reports which cgroup controllers and kernel features are unavailable and which limits are skipped without them, which does not fail the checks.",
+	RunE:  doctorHost,
+	Short: "checks that bpm can run processes on this host",
+	Use:   "doctor",
+	Args:  cobra.NoArgs,
+
+	// bpm's usual setup writes to the state directories which are being
+	// checked and so would fail before the problem could be reported.
+	PersistentPreRunE: doctorPre,
+}
+
+func doctorPre(cmd *cobra.Command, _ []string) error {
+	if err := requireRoot(cmd); err != nil {
+		return err
+	}
+
+	return relocateState(cmd.ErrOrStderr())
+}
+
+func doctorHost(cmd *cobra.Command, _ []string) error {
+	printChecks := presenters.PrintHostChecks
+	switch doctorFormat {
+	case "table":
+	case "json":
+		printChecks = presenters.PrintHostChecksJSON
+	default:
+		return fmt.Errorf("invalid format: %s", doctorFormat)
+	}
+
+	cmd.SilenceUsage = true
+
+	checks := doctor.CheckStateDirs(boshEnv)
+
+	var failed int
+	for _, check := range checks {
+		if !check.OK {
+			failed++
+		}
+	}
+
+	if doctorNested {
+		features, err := sysfeat.Fetch()
+		if err != nil {
+			return err
+		}
+		checks = append(checks, doctor.CheckFeatures(*features)...)
+	}
+
+	if err := printChecks(checks, cmd.OutOrStdout()); err != nil {
+		return err
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d check(s) failed", failed)
+	}
+
+	return nil
+}
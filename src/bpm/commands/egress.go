@@ -0,0 +1,120 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package commands
+
+import (
+	"path/filepath"
+
+	"code.cloudfoundry.org/lager"
+
+	"bpm/config"
+	"bpm/egress"
+	"bpm/sysfeat"
+)
+
+// limitEgress holds a process which has just started to its egress rate. The
+// container has already tagged its packets with the class ID which it was
+// given, so this only adds the class for them on the host's interface. A
+// failure leaves the process unshaped rather than stopping it, so it is logged
+// rather than returned.
+func limitEgress(logger lager.Logger, cfg *config.BPMConfig, procCfg *config.ProcessConfig) {
+	rate, err := procCfg.Network.EgressRateBytes()
+	if err != nil || rate == 0 || !netClassSupported() {
+		return
+	}
+
+	classID, ok, err := egressClasses().Lookup(cfg.ContainerID())
+	if err != nil {
+		logger.Error("failed-to-limit-egress", err)
+		return
+	} else if !ok {
+		return
+	}
+
+	err = withShaper(func(shaper *egress.Shaper, iface string) error {
+		if err := shaper.Limit(iface, classID, rate); err != nil {
+			return err
+		}
+
+		logger.Info("limited-egress", lager.Data{"interface": iface, "class": egress.Handle(classID), "bytes_per_second": rate})
+		return nil
+	})
+	if err != nil {
+		logger.Error("failed-to-limit-egress", err)
+	}
+}
+
+// unlimitEgress removes the class of a process whose container has stopped
+// from the host's interface. The container keeps its class ID so that the
+// same class is added again if it is revived.
+func unlimitEgress(logger lager.Logger, cfg *config.BPMConfig) {
+	if err := removeEgressClass(cfg); err != nil {
+		logger.Error("failed-to-unlimit-egress", err)
+	}
+}
+
+// releaseEgress removes the class of a process whose container has been
+// removed and gives up its class ID. The ID is given up even if the class
+// could not be removed: the next container to be given it replaces the class
+// with its own rate.
+func releaseEgress(logger lager.Logger, cfg *config.BPMConfig) {
+	unlimitEgress(logger, cfg)
+
+	if err := egressClasses().Release(cfg.ContainerID()); err != nil {
+		logger.Error("failed-to-release-egress-class", err)
+	}
+}
+
+// removeEgressClass removes the class of a process from the host's interface.
+// The class is found from the ID which the container holds rather than from
+// the job's configuration, which may no longer limit the process.
+func removeEgressClass(cfg *config.BPMConfig) error {
+	classID, ok, err := egressClasses().Lookup(cfg.ContainerID())
+	if err != nil || !ok {
+		return err
+	}
+
+	return withShaper(func(shaper *egress.Shaper, iface string) error {
+		return shaper.Unlimit(iface, classID)
+	})
+}
+
+// withShaper calls f with a shaper for the interface of the host's default
+// route. Processes of other jobs change the same qdisc, so it holds a lock
+// while f runs.
+func withShaper(f func(*egress.Shaper, string) error) error {
+	iface, err := egress.DefaultInterface(egress.RouteFile)
+	if err != nil {
+		return err
+	}
+
+	lock, err := locks.LockFile(filepath.Join(config.LocksPath(boshEnv), "egress.lock"))
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	return f(egress.NewShaper(egress.DefaultTCPath), iface)
+}
+
+func egressClasses() *egress.Classes {
+	return egress.NewClasses(config.EgressRoot(boshEnv))
+}
+
+func netClassSupported() bool {
+	features, err := sysfeat.Fetch()
+	return err == nil && features.NetClassSupported
+}
@@ -0,0 +1,90 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/spf13/cobra"
+
+	"bpm/models"
+	"bpm/runc/lifecycle"
+)
+
+var showSecrets bool
+
+func init() {
+	envCommand.Flags().StringVarP(&procName, "process", "p", "", "optional process name")
+	envCommand.Flags().BoolVar(&showSecrets, "show-secrets", false, "show the values of sensitive variables")
+	RootCmd.AddCommand(envCommand)
+}
+
+var envCommand = &cobra.Command{
+	RunE:    envForJob,
+	Short:   "displays the environment of a running BOSH Process",
+	Use:     "env <job-name>",
+	PreRunE: envPre,
+}
+
+func envPre(cmd *cobra.Command, args []string) error {
+	return validateInput(args)
+}
+
+func envForJob(cmd *cobra.Command, _ []string) error {
+	cmd.SilenceUsage = true
+
+	jobCfg, err := bpmCfg.ParseJobConfig()
+	if err != nil {
+		return fmt.Errorf("failed to parse job configuration: %s", err)
+	}
+
+	procCfg, err := processByNameFromJobConfig(jobCfg, procName)
+	if err != nil {
+		return fmt.Errorf("process %q not present in job configuration (%s)", procName, bpmCfg.JobConfig())
+	}
+
+	warnDeprecations(cmd, procCfg.Deprecations())
+
+	runcLifecycle, err := newRuncLifecycle()
+	if err != nil {
+		return err
+	}
+
+	process, err := runcLifecycle.StatProcess(ctx, bpmCfg)
+	if err != nil && !lifecycle.IsNotExist(err) {
+		return fmt.Errorf("failed to get job: %s", err)
+	} else if lifecycle.IsNotExist(err) || process.Status != models.ProcessStateRunning {
+		return errors.New("process is not running or could not be found")
+	}
+
+	env, err := runcLifecycle.ProcessEnvironment(bpmCfg)
+	if err != nil {
+		return err
+	}
+
+	sort.Strings(env)
+	if !showSecrets {
+		env = procCfg.RedactEnv(env)
+	}
+
+	for _, variable := range env {
+		fmt.Fprintln(cmd.OutOrStdout(), variable)
+	}
+
+	return nil
+}
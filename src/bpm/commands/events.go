@@ -0,0 +1,117 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package commands
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"bpm/memorypressure"
+	"bpm/models"
+	"bpm/runc/lifecycle"
+	"bpm/units"
+)
+
+var eventsInterval time.Duration
+
+func init() {
+	eventsCommand.Flags().StringVarP(&procName, "process", "p", "", "optional process name")
+	eventsCommand.Flags().Var(units.DurationFlag(&eventsInterval, 5*time.Second), "interval", "how often to report stats")
+	RootCmd.AddCommand(eventsCommand)
+}
+
+var eventsCommand = &cobra.Command{
+	Long: `streams the events of a given job
+
+  Each line of output is a JSON object. OOM events are written as soon as the
+  kernel kills a process in the container and stats events every interval.
+  A memory_pressure event follows the stats event in which the memory usage
+  of a process with memory_pressure configured rises past its threshold.
+  The stream ends when the process stops or bpm is interrupted.
+`,
+	RunE:    eventsForJob,
+	Short:   "streams OOM and stats events for a given job",
+	Use:     "events <job-name>",
+	PreRunE: eventsPre,
+}
+
+func eventsPre(cmd *cobra.Command, args []string) error {
+	if err := validateInput(args); err != nil {
+		return err
+	}
+
+	if eventsInterval <= 0 {
+		return errors.New("interval must be positive")
+	}
+
+	return nil
+}
+
+func eventsForJob(cmd *cobra.Command, _ []string) error {
+	cmd.SilenceUsage = true
+
+	runcLifecycle, err := newRuncLifecycle()
+	if err != nil {
+		return err
+	}
+
+	detector := memoryPressureDetector()
+
+	encoder := json.NewEncoder(cmd.OutOrStdout())
+	err = runcLifecycle.ProcessEvents(ctx, bpmCfg, eventsInterval, func(event models.Event) {
+		encoder.Encode(event)
+
+		if detector == nil || event.Stats == nil {
+			return
+		}
+
+		if pressure, err := detector.Observe(event.Stats.Memory); err == nil && pressure != nil {
+			encoder.Encode(models.Event{
+				Type:           models.EventTypeMemoryPressure,
+				Timestamp:      event.Timestamp,
+				MemoryPressure: pressure,
+			})
+		}
+	})
+	if lifecycle.IsNotExist(err) {
+		return errors.New("process is not running or could not be found")
+	} else if err != nil {
+		return fmt.Errorf("failed to get events: %s", err)
+	}
+
+	return nil
+}
+
+// memoryPressureDetector returns a detector for the memory pressure
+// threshold of the process, or nil if it does not have one or its
+// configuration cannot be read.
+func memoryPressureDetector() *memorypressure.Detector {
+	jobCfg, err := bpmCfg.ParseJobConfig()
+	if err != nil {
+		return nil
+	}
+
+	procCfg, err := processByNameFromJobConfig(jobCfg, procName)
+	if err != nil || procCfg.MemoryPressure == nil {
+		return nil
+	}
+
+	return memorypressure.NewDetector(procCfg.MemoryPressure)
+}
@@ -0,0 +1,123 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"bpm/exitstatus"
+	"bpm/runc/lifecycle"
+)
+
+var (
+	execCwd  string
+	execEnv  []string
+	execTTY  bool
+	execUser string
+)
+
+func init() {
+	execCommand.Flags().StringVarP(&procName, "process", "p", "", "optional process name")
+	execCommand.Flags().BoolVar(&cleanEnv, "clean-env", false, "do not inherit the environment of the process")
+	execCommand.Flags().StringVarP(&execCwd, "cwd", "w", "", "working directory inside the container (defaults to the process's)")
+	execCommand.Flags().StringArrayVarP(&execEnv, "env", "e", nil, "set an environment variable (NAME=VALUE, may be repeated)")
+	execCommand.Flags().BoolVarP(&execTTY, "tty", "t", false, "allocate a pseudo-terminal")
+	execCommand.Flags().StringVarP(&execUser, "user", "u", "", "run as this user name or UID:GID (defaults to the process's)")
+	RootCmd.AddCommand(execCommand)
+}
+
+var execCommand = &cobra.Command{
+	RunE:    execInContainer,
+	Short:   "executes a command inside the process container",
+	Use:     "exec <job-name> -- <command> [args...]",
+	PreRunE: execPre,
+}
+
+func execPre(cmd *cobra.Command, args []string) error {
+	if err := validateInput(args); err != nil {
+		return err
+	}
+
+	if len(args) < 2 {
+		return errors.New("must specify a command")
+	}
+
+	for _, kv := range execEnv {
+		if !strings.Contains(kv, "=") || strings.HasPrefix(kv, "=") {
+			return fmt.Errorf("invalid environment variable %q: must be NAME=VALUE", kv)
+		}
+	}
+
+	if execCwd != "" && !filepath.IsAbs(execCwd) {
+		return fmt.Errorf("invalid working directory %q: must be absolute", execCwd)
+	}
+
+	return nil
+}
+
+func execInContainer(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+
+	runcLifecycle, err := newRuncLifecycle()
+	if err != nil {
+		return err
+	}
+
+	// The container of a quarantined process is frozen, so anything run
+	// in it would hang.
+	if err := refuseQuarantined(bpmCfg); err != nil {
+		return err
+	}
+
+	process, err := runcLifecycle.StatProcess(ctx, bpmCfg)
+	if err != nil && !lifecycle.IsNotExist(err) {
+		return fmt.Errorf("failed to get job: %s", err)
+	} else if lifecycle.IsNotExist(err) || process.HasExited() {
+		return errors.New("process is not running or could not be found")
+	}
+
+	opts := lifecycle.ExecOptions{
+		CleanEnv: cleanEnv,
+		TTY:      execTTY,
+		Cwd:      execCwd,
+		Env:      execEnv,
+	}
+
+	if execUser != "" {
+		user, err := userFinder.Lookup(execUser)
+		if err != nil {
+			return fmt.Errorf("failed to find user %q: %s", execUser, err)
+		}
+		opts.User = &user
+	}
+
+	err = runcLifecycle.ExecProcess(ctx, bpmCfg, args[1:], opts, os.Stdin, cmd.OutOrStdout(), cmd.OutOrStderr())
+	if eerr, ok := err.(*exec.ExitError); ok {
+		return &exitstatus.Error{
+			Status: eerr.ExitCode(),
+			Err:    fmt.Errorf("command exited with failure: %s", err),
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,164 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package commands
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/spf13/cobra"
+
+	"bpm/archive"
+	"bpm/config"
+)
+
+var exportPath string
+
+func init() {
+	exportCommand.Flags().StringVarP(&procName, "process", "p", "", "optional process name")
+	exportCommand.Flags().StringVarP(&exportPath, "output", "o", "", "the path of the tarball to write")
+	RootCmd.AddCommand(exportCommand)
+}
+
+var exportCommand = &cobra.Command{
+	Long: `exports the data, configuration, and logs of a BOSH Process
+
+  The tarball contains the job's bpm.yml, the effective container
+  configuration (if the process has been started), the job's data and store
+  directories, and its logs. The values of sensitive environment variables
+  are redacted from the configuration. The data and store directories can be
+  restored on another VM with bpm import.
+`,
+	RunE:     export,
+	Short:    "exports the data, configuration, and logs of a BOSH Process",
+	Use:      "export <job-name> -o <tarball>",
+	PreRunE:  exportPre,
+	PostRunE: exportPost,
+}
+
+func exportPre(cmd *cobra.Command, args []string) error {
+	if err := validateInput(args); err != nil {
+		return err
+	}
+
+	if exportPath == "" {
+		return errors.New("must specify an output file")
+	}
+
+	cmd.SilenceUsage = true
+
+	if err := setupBpmLogs("export"); err != nil {
+		return err
+	}
+
+	return acquireLifecycleLock()
+}
+
+func exportPost(cmd *cobra.Command, args []string) error {
+	return releaseLifecycleLock()
+}
+
+func export(cmd *cobra.Command, _ []string) error {
+	logger.Info("starting")
+	defer logger.Info("complete")
+
+	jobCfg, err := bpmCfg.ParseJobConfig()
+	if err != nil {
+		logger.Error("failed-to-parse-config", err)
+		return fmt.Errorf("failed to parse job configuration: %s", err)
+	}
+
+	procCfg, err := processByNameFromJobConfig(jobCfg, procName)
+	if err != nil {
+		logger.Error("process-not-defined", err)
+		return fmt.Errorf("process %q not present in job configuration (%s)", procName, bpmCfg.JobConfig())
+	}
+
+	warnDeprecations(cmd, procCfg.Deprecations())
+
+	jobConfig, err := redactedJobConfig()
+	if err != nil {
+		logger.Error("failed-to-redact-config", err)
+		return fmt.Errorf("failed to redact job configuration: %s", err)
+	}
+
+	bundleConfig, err := redactedBundleConfig(procCfg)
+	if err != nil {
+		logger.Error("failed-to-redact-config", err)
+		return fmt.Errorf("failed to redact container configuration: %s", err)
+	}
+
+	f, err := os.OpenFile(exportPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create export: %s", err)
+	}
+	defer f.Close()
+
+	sources := []archive.Source{{Name: "bpm.yml", Contents: jobConfig}}
+	if bundleConfig != nil {
+		sources = append(sources, archive.Source{Name: "config.json", Contents: bundleConfig})
+	}
+	sources = append(sources,
+		archive.Source{Name: "data", Path: bpmCfg.DataDir().External()},
+		archive.Source{Name: "store", Path: bpmCfg.StoreDir().External()},
+		archive.Source{Name: "logs", Path: bpmCfg.LogDir().External()},
+	)
+
+	if err := archive.Write(f, sources); err != nil {
+		logger.Error("failed-to-export", err)
+		return fmt.Errorf("failed to export job-process: %s", err)
+	}
+
+	return f.Close()
+}
+
+func redactedJobConfig() ([]byte, error) {
+	data, err := ioutil.ReadFile(bpmCfg.JobConfig())
+	if err != nil {
+		return nil, err
+	}
+
+	return config.RedactJobConfig(data)
+}
+
+// redactedBundleConfig returns the OCI configuration of the process's
+// container with sensitive values removed from its environment. If the
+// process has never been started then there is no configuration and nil is
+// returned.
+func redactedBundleConfig(procCfg *config.ProcessConfig) ([]byte, error) {
+	data, err := ioutil.ReadFile(filepath.Join(bpmCfg.BundlePath(), "config.json"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var spec specs.Spec
+	if err := json.Unmarshal(data, &spec); err != nil {
+		return nil, err
+	}
+
+	if spec.Process != nil {
+		spec.Process.Env = procCfg.RedactEnv(spec.Process.Env)
+	}
+
+	return json.MarshalIndent(spec, "", "\t")
+}
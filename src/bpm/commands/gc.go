@@ -0,0 +1,144 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package commands
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"bpm/config"
+	"bpm/helpers"
+	"bpm/orphans"
+	"bpm/runc/lifecycle"
+)
+
+var gcDryRun bool
+
+func init() {
+	gcCommand.Flags().BoolVar(&gcDryRun, "dry-run", false, "only list what would be removed")
+	RootCmd.AddCommand(gcCommand)
+}
+
+var gcCommand = &cobra.Command{
+	RunE:  collectGarbage,
+	Short: "removes the bundles, pid files, and logs of processes which are no longer configured",
+	Long: "Removes the state left behind by processes which have been renamed or removed\n" +
+		"from their job, and by jobs which have been removed from the VM. Processes\n" +
+		"which still have a container are skipped: stop and delete them first.",
+	Use: "gc",
+}
+
+func collectGarbage(cmd *cobra.Command, _ []string) error {
+	cmd.SilenceUsage = true
+
+	runcLifecycle, err := newRuncLifecycle()
+	if err != nil {
+		return err
+	}
+
+	found, err := orphans.Find(boshEnv)
+	if err != nil {
+		return fmt.Errorf("failed to find orphaned processes: %s", err)
+	}
+
+	verb := "removed"
+	if gcDryRun {
+		verb = "would remove"
+	}
+
+	failed := false
+	skippedJobs := map[string]bool{}
+	for _, o := range found {
+		name := o.Job
+		if o.Process != "" {
+			name = fmt.Sprintf("%s/%s", o.Job, o.Process)
+		}
+
+		if o.Process == "" && skippedJobs[o.Job] {
+			fmt.Fprintf(cmd.ErrOrStderr(), "skipping %s: some of its processes were not removed\n", name)
+			continue
+		}
+
+		if o.Process != "" {
+			procCfg := config.NewBPMConfig(boshEnv, o.Job, o.Process)
+			_, err := runcLifecycle.StatProcess(ctx, procCfg)
+			if err == nil {
+				fmt.Fprintf(cmd.ErrOrStderr(), "skipping %s: its container still exists (run `bpm delete %s -p %s` first)\n", name, o.Job, o.Process)
+				skippedJobs[o.Job] = true
+				continue
+			} else if !lifecycle.IsNotExist(err) {
+				fmt.Fprintf(cmd.ErrOrStderr(), "skipping %s: failed to check for its container: %s\n", name, err)
+				skippedJobs[o.Job] = true
+				failed = true
+				continue
+			}
+		}
+
+		if !gcDryRun {
+			if err := removeOrphan(o); err != nil {
+				fmt.Fprintf(cmd.ErrOrStderr(), "failed to remove %s: %s\n", name, err)
+				skippedJobs[o.Job] = true
+				failed = true
+				continue
+			}
+		}
+
+		fmt.Fprintf(cmd.OutOrStdout(), "%s %s (%s)\n", verb, name, o.Reason)
+		for _, path := range o.Paths {
+			fmt.Fprintf(cmd.OutOrStdout(), "  %s\n", path)
+		}
+	}
+
+	if failed {
+		return fmt.Errorf("failed to clean up some orphaned processes")
+	}
+
+	return nil
+}
+
+// removeOrphan holds the lock of an orphaned process while its state is
+// removed so that it cannot race with an operator deleting its container.
+func removeOrphan(o orphans.Orphan) error {
+	if o.Process == "" {
+		return orphans.Remove(o)
+	}
+
+	lock, err := locks.LockJob(o.Job, o.Process)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	// The container of the process is already gone so its helpers have
+	// nothing left to do, but they would never be stopped once their
+	// registry had been removed.
+	cfg := config.NewBPMConfig(boshEnv, o.Job, o.Process)
+	if err := helpers.Stop(cfg.HelpersDir().External(), 0); err != nil {
+		return err
+	}
+
+	// Nothing else gives up the egress class of a process whose container
+	// is already gone.
+	if err := removeEgressClass(cfg); err != nil {
+		return err
+	}
+	if err := egressClasses().Release(cfg.ContainerID()); err != nil {
+		return err
+	}
+
+	return orphans.Remove(o)
+}
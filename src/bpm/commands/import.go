@@ -0,0 +1,113 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"bpm/archive"
+	"bpm/runc/lifecycle"
+)
+
+var importPath string
+
+func init() {
+	importCommand.Flags().StringVarP(&procName, "process", "p", "", "optional process name")
+	importCommand.Flags().StringVarP(&importPath, "input", "i", "", "the path of a tarball written by bpm export")
+	RootCmd.AddCommand(importCommand)
+}
+
+var importCommand = &cobra.Command{
+	Long: `restores the data of a BOSH Process exported by bpm export
+
+  The job's data directory and (if this VM has a persistent disk) its store
+  directory are restored from the tarball. The process must be stopped.
+`,
+	RunE:     importJob,
+	Short:    "restores the data of a BOSH Process exported by bpm export",
+	Use:      "import <job-name> -i <tarball>",
+	PreRunE:  importPre,
+	PostRunE: importPost,
+}
+
+func importPre(cmd *cobra.Command, args []string) error {
+	if err := validateInput(args); err != nil {
+		return err
+	}
+
+	if importPath == "" {
+		return errors.New("must specify an input file")
+	}
+
+	cmd.SilenceUsage = true
+
+	if err := setupBpmLogs("import"); err != nil {
+		return err
+	}
+
+	return acquireLifecycleLock()
+}
+
+func importPost(cmd *cobra.Command, args []string) error {
+	return releaseLifecycleLock()
+}
+
+func importJob(cmd *cobra.Command, _ []string) error {
+	logger.Info("starting")
+	defer logger.Info("complete")
+
+	runcLifecycle, err := newRuncLifecycle()
+	if err != nil {
+		return err
+	}
+
+	process, err := runcLifecycle.StatProcess(ctx, bpmCfg)
+	if err != nil && !lifecycle.IsNotExist(err) {
+		return fmt.Errorf("failed to get job: %s", err)
+	} else if err == nil && !process.HasExited() {
+		return errors.New("process must be stopped before importing")
+	}
+
+	f, err := os.Open(importPath)
+	if err != nil {
+		return fmt.Errorf("failed to open import: %s", err)
+	}
+	defer f.Close()
+
+	destinations := map[string]string{
+		"data": bpmCfg.DataDir().External(),
+	}
+
+	// Without a persistent disk the store directory would be written to the
+	// root filesystem and lost when the VM is recreated.
+	if _, err := os.Stat(filepath.Dir(bpmCfg.StoreDir().External())); err == nil {
+		destinations["store"] = bpmCfg.StoreDir().External()
+	} else {
+		fmt.Fprintln(cmd.ErrOrStderr(), "no persistent disk present: skipping store directory")
+	}
+
+	if err := archive.Extract(f, destinations); err != nil {
+		logger.Error("failed-to-import", err)
+		return fmt.Errorf("failed to import job-process: %s", err)
+	}
+
+	return nil
+}
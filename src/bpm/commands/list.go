@@ -17,6 +17,7 @@ package commands
 
 import (
 	"fmt"
+	"io"
 	"os"
 
 	"github.com/spf13/cobra"
@@ -25,9 +26,13 @@ import (
 	"bpm/jobid"
 	"bpm/models"
 	"bpm/presenters"
+	"bpm/runc/lifecycle"
 )
 
+var listFormat string
+
 func init() {
+	listCommandCommand.Flags().StringVarP(&listFormat, "format", "o", "table", "output format (table, wide, or json)")
 	RootCmd.AddCommand(listCommandCommand)
 }
 
@@ -38,9 +43,21 @@ var listCommandCommand = &cobra.Command{
 }
 
 func listContainers(cmd *cobra.Command, _ []string) error {
+	printJobs, err := jobPrinter(listFormat)
+	if err != nil {
+		return err
+	}
+
 	cmd.SilenceUsage = true
+	startCommandSpan(cmd)
+
+	runcLifecycle, err := newRuncLifecycle()
+	if err != nil {
+		return err
+	}
 
 	processes := []*models.Process{}
+	configs := map[string]*config.BPMConfig{}
 	for _, job := range boshEnv.JobNames() {
 		bpmCfg := config.NewBPMConfig(boshEnv, job, "")
 		jobCfg, err := bpmCfg.ParseJobConfig()
@@ -55,31 +72,49 @@ func listContainers(cmd *cobra.Command, _ []string) error {
 
 		for _, process := range jobCfg.Processes {
 			procCfg := config.NewBPMConfig(boshEnv, job, process.Name)
+			configs[procCfg.ContainerID()] = procCfg
+
+			adopted, err := runcLifecycle.StatAdoptedProcess(procCfg)
+			if err == nil {
+				adopted.Labels = process.Labels
+				adopted.Overridden = process.Overridden
+				adopted.ConfigPath = procCfg.JobConfig()
+				processes = append(processes, adopted)
+				continue
+			}
+
 			processes = append(processes, &models.Process{
 				Name:   procCfg.ContainerID(),
 				Status: models.ProcessStateStopped,
+				Labels: process.Labels,
+
+				Overridden: process.Overridden,
+				BundlePath: procCfg.BundlePath(),
+				ConfigPath: procCfg.JobConfig(),
 			})
 		}
 	}
 
-	runcLifecycle, err := newRuncLifecycle()
-	if err != nil {
-		return err
-	}
-	runningProcesses, err := runcLifecycle.ListProcesses()
+	runningProcesses, err := runcLifecycle.ListProcesses(ctx)
 	if err != nil {
 		fmt.Fprintf(cmd.OutOrStderr(), "failed to list jobs: %s\n", err.Error())
 		return err
 	}
 
 	for _, process := range runningProcesses {
+		if procCfg, ok := configs[process.Name]; ok {
+			lifecycle.ApplyExitStatus(procCfg, process)
+			lifecycle.ApplyTimestamps(procCfg, process)
+			applyQuarantine(procCfg, process)
+		}
+
 		processes, err = updateProcess(processes, process)
 		if err != nil {
 			fmt.Fprintf(cmd.OutOrStderr(), "extra process running: %s", err.Error())
 		}
 	}
 
-	err = presenters.PrintJobs(processes, cmd.OutOrStdout())
+	err = printJobs(processes, cmd.OutOrStdout())
 	if err != nil {
 		fmt.Fprintf(cmd.OutOrStderr(), "failed to display jobs: %s\n", err.Error())
 		return err
@@ -88,9 +123,28 @@ func listContainers(cmd *cobra.Command, _ []string) error {
 	return nil
 }
 
+func jobPrinter(format string) (func([]*models.Process, io.Writer) error, error) {
+	switch format {
+	case "table":
+		return presenters.PrintJobs, nil
+	case "wide":
+		return presenters.PrintJobsWide, nil
+	case "json":
+		return presenters.PrintJobsJSON, nil
+	default:
+		return nil, fmt.Errorf("invalid format: %s", format)
+	}
+}
+
 func updateProcess(processes []*models.Process, process *models.Process) ([]*models.Process, error) {
 	for i := range processes {
 		if processes[i].Name == process.Name {
+			// Whether the configuration is overridden and where things
+			// are is only known from the job's configuration and not
+			// from the container.
+			process.Overridden = processes[i].Overridden
+			process.BundlePath = processes[i].BundlePath
+			process.ConfigPath = processes[i].ConfigPath
 			processes[i] = process
 			return processes, nil
 		}
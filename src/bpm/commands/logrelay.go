@@ -0,0 +1,122 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package commands
+
+import (
+	"io"
+	"os"
+
+	"code.cloudfoundry.org/lager"
+	"github.com/spf13/cobra"
+
+	"bpm/loglimit"
+	"bpm/logsink"
+	"bpm/usertools"
+)
+
+var (
+	relayStream        string
+	relayMaxLineLength int
+)
+
+func init() {
+	logRelayCommand.Flags().StringVarP(&procName, "process", "p", "", "optional process name")
+	logRelayCommand.Flags().StringVar(&relayStream, "stream", string(logsink.Stdout), "the stream to write to (stdout or stderr)")
+	logRelayCommand.Flags().IntVar(&relayMaxLineLength, "max-line-length", 0, "the length in bytes after which lines are truncated")
+	RootCmd.AddCommand(logRelayCommand)
+}
+
+// logRelayCommand is started by bpm itself when log lines need to be limited
+// or the process's log sink is not a plain file. It copies the output of a
+// process from stdin into its log sink.
+var logRelayCommand = &cobra.Command{
+	Hidden:  true,
+	RunE:    logRelay,
+	Short:   "copies the output of a process into its log sink",
+	Use:     "log-relay <job-name>",
+	PreRunE: logRelayPre,
+}
+
+func logRelayPre(cmd *cobra.Command, args []string) error {
+	if err := validateInput(args); err != nil {
+		return err
+	}
+
+	cmd.SilenceUsage = true
+
+	return setupBpmLogs("log-relay")
+}
+
+func logRelay(cmd *cobra.Command, _ []string) error {
+	logger = logger.WithData(lager.Data{"stream": relayStream})
+
+	jobCfg, err := bpmCfg.ParseJobConfig()
+	if err != nil {
+		logger.Error("failed-to-parse-config", err)
+		return err
+	}
+
+	procCfg, err := processByNameFromJobConfig(jobCfg, procName)
+	if err != nil {
+		logger.Error("process-not-defined", err)
+		return err
+	}
+
+	usr, err := userFinder.Lookup(usertools.VcapUser)
+	if err != nil {
+		return err
+	}
+
+	sink, err := logsink.Open(bpmCfg, procCfg.LogSink, logsink.Stream(relayStream), usr)
+	if err != nil {
+		logger.Error("failed-to-open-log-sink", err)
+		return err
+	}
+	defer sink.Close()
+
+	var w io.Writer = sink
+	var t *loglimit.Truncator
+	if relayMaxLineLength > 0 {
+		t = loglimit.NewTruncator(sink, relayMaxLineLength)
+		defer t.Close()
+		w = t
+	}
+
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := os.Stdin.Read(buf)
+		if n > 0 {
+			var before int64
+			if t != nil {
+				before = t.Truncations()
+			}
+			if _, err := w.Write(buf[:n]); err != nil {
+				logger.Error("failed-to-write-log-sink", err)
+				return err
+			}
+			if t != nil && t.Truncations() > before {
+				logger.Info("truncated-log-lines", lager.Data{"total": t.Truncations()})
+			}
+		}
+
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			logger.Error("failed-to-read-output", err)
+			return err
+		}
+	}
+}
@@ -16,29 +16,50 @@
 package commands
 
 import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/spf13/cobra"
+
+	"bpm/logwindow"
+	"bpm/units"
 )
 
 var (
 	errLogs,
 	allLogs,
 	follow,
+	internalLogs,
+	printCursor,
 	quiet bool
 
 	numLines int
+
+	since,
+	after string
 )
 
 func init() {
 	logsCommand.Flags().BoolVarP(&allLogs, "all", "a", false, "show both stdout and stderr")
 	logsCommand.Flags().BoolVarP(&errLogs, "err", "e", false, "show stderr")
 	logsCommand.Flags().BoolVarP(&follow, "follow", "f", false, "show and follow specified logs")
+	logsCommand.Flags().BoolVarP(&internalLogs, "internal", "i", false, "show bpm's own log for the job")
 	logsCommand.Flags().IntVarP(&numLines, "lines", "n", 25, "number of lines to show")
+	logsCommand.Flags().IntVar(&numLines, "tail", 25, "same as --lines")
+	logsCommand.Flags().StringVar(&since, "since", "", "only show lines written since a duration ago (e.g. 10m) or an RFC 3339 time")
+	logsCommand.Flags().StringVar(&after, "after", "", "only show what was written after a cursor printed by --cursor")
+	logsCommand.Flags().BoolVar(&printCursor, "cursor", false, "print a cursor to stderr which --after can carry on from")
 	logsCommand.Flags().StringVarP(&procName, "process", "p", "", "optional process name")
 	logsCommand.Flags().BoolVarP(&quiet, "quiet", "q", false, "suppress filename headers")
 
@@ -57,6 +78,10 @@ func logsPre(cmd *cobra.Command, args []string) error {
 }
 
 func logsForJob(cmd *cobra.Command, _ []string) error {
+	if internalLogs {
+		return internalLogsForJob(cmd)
+	}
+
 	cmd.SilenceUsage = true
 
 	var filesToTail []string
@@ -74,6 +99,10 @@ func logsForJob(cmd *cobra.Command, _ []string) error {
 		return errors.New("logs not found")
 	}
 
+	if since != "" || after != "" || printCursor {
+		return showLogWindow(cmd, filesToTail, nil)
+	}
+
 	if follow {
 		tailArgs = append(tailArgs, "-f")
 	}
@@ -90,32 +119,458 @@ func logsForJob(cmd *cobra.Command, _ []string) error {
 	tailCmd.Stdout = cmd.OutOrStdout()
 	tailCmd.Stderr = cmd.OutOrStderr()
 
-	err := tailCmd.Start()
+	return runTail(cmd, tailCmd)
+}
+
+// internalLogsForJob shows the bpm.log of the job. The log is shared by every
+// process of the job so, when a process is given, only the lines which were
+// logged while operating on that process are shown.
+func internalLogsForJob(cmd *cobra.Command) error {
+	if errLogs || allLogs {
+		return errors.New("--internal cannot be combined with --err or --all")
+	}
+
+	cmd.SilenceUsage = true
+
+	var process string
+	if cmd.Flags().Changed("process") {
+		process = bpmCfg.ProcName()
+	}
+
+	filter := &processLogFilter{process: process, w: cmd.OutOrStdout()}
+	return showLogWindow(cmd, []string{bpmCfg.BPMLog()}, filter)
+}
+
+// showLogWindow shows the part of each log file selected by the --since,
+// --after, and --lines flags without reading the parts of the files before
+// it. If filter is set then the files are written through it and --lines
+// counts the lines which it lets through.
+func showLogWindow(cmd *cobra.Command, files []string, filter *processLogFilter) error {
+	if printCursor && follow {
+		return errors.New("--cursor cannot be combined with --follow")
+	}
+	if since != "" && after != "" {
+		return errors.New("--since cannot be combined with --after")
+	}
+
+	window, err := newLogWindow(cmd)
 	if err != nil {
 		return err
 	}
 
-	errCh := make(chan error)
-	go func() {
-		errCh <- tailCmd.Wait()
-	}()
+	cmd.SilenceUsage = true
+
+	stdout := cmd.OutOrStdout()
+	headers := &logHeaders{w: stdout}
+	showHeaders := len(files) > 1 && !quiet
+
+	// Find every window before showing any of them so that a file which
+	// cannot be shown does not leave the output half written.
+	logs := make([]*logSection, len(files))
+	for i, path := range files {
+		l, err := window.find(path)
+		if os.IsNotExist(err) {
+			return errors.New("logs not found")
+		} else if err != nil {
+			return err
+		}
+		defer l.f.Close()
+		logs[i] = l
+	}
+
+	next := logCursor{}
+	var tailCmds []*exec.Cmd
+
+	for i, l := range logs {
+		path := files[i]
+		if showHeaders {
+			if i > 0 {
+				fmt.Fprintln(stdout)
+			}
+			fmt.Fprintf(stdout, "==> %s <==\n", path)
+			headers.last = path
+		}
+
+		pos, err := l.show(stdout, filter, window.lines)
+		if err != nil {
+			return err
+		}
+		next[path] = pos
+
+		if follow {
+			// Pick up from where the lines above stopped so that nothing
+			// is shown twice or lost between reading the file and
+			// following it.
+			tailCmd := exec.Command("tail", "-f", "-c", fmt.Sprintf("+%d", pos.Offset+1), path)
+			tailCmd.Stderr = cmd.OutOrStderr()
+			switch {
+			case filter != nil:
+				tailCmd.Stdout = filter
+			case showHeaders:
+				tailCmd.Stdout = headers.writer(path)
+			default:
+				tailCmd.Stdout = stdout
+			}
+			tailCmds = append(tailCmds, tailCmd)
+		}
+	}
+
+	if printCursor {
+		fmt.Fprintln(cmd.OutOrStderr(), next)
+	}
+
+	if !follow {
+		return nil
+	}
+
+	return runTail(cmd, tailCmds...)
+}
+
+// logWindow is the part of each log file which is shown.
+type logWindow struct {
+	since  time.Time
+	cursor logCursor
+	lines  int // negative when unlimited
+}
+
+func newLogWindow(cmd *cobra.Command) (*logWindow, error) {
+	window := &logWindow{lines: numLines}
+
+	if since != "" {
+		t, err := parseSince(since, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		window.since = t
+	}
+
+	if after != "" {
+		cursor, err := parseLogCursor(after)
+		if err != nil {
+			return nil, err
+		}
+		window.cursor = cursor
+	}
+
+	// --since and --after show everything in their window unless the
+	// number of lines is also given.
+	linesGiven := cmd.Flags().Changed("lines") || cmd.Flags().Changed("tail")
+	if (since != "" || after != "") && !linesGiven {
+		window.lines = -1
+	}
+
+	return window, nil
+}
+
+// parseSince accepts either how long ago (e.g. 10m) or an RFC 3339 time.
+func parseSince(value string, now time.Time) (time.Time, error) {
+	if d, err := units.ParseDuration(value); err == nil {
+		return now.Add(-d), nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	return time.Time{}, fmt.Errorf("invalid --since %q: must be a duration such as 10m or an RFC 3339 time", value)
+}
+
+// logSection is the part of an open log file which is in a window, before
+// the number of lines is taken into account.
+type logSection struct {
+	f     *os.File
+	info  os.FileInfo
+	start int64
+}
+
+func (w *logWindow) find(path string) (*logSection, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	start, err := w.start(f, info)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return &logSection{f: f, info: info, start: start}, nil
+}
+
+// show writes at most the last lines of the section (all of it if lines is
+// negative) and returns the position up to which it has been shown.
+func (l *logSection) show(out io.Writer, filter *processLogFilter, lines int) (logPosition, error) {
+	size := l.info.Size()
+	pos := logPosition{Inode: inode(l.info), Offset: size}
+	section := io.NewSectionReader(l.f, l.start, size-l.start)
+
+	if filter != nil {
+		n, err := filter.writeLast(section, lines)
+		if err != nil {
+			return logPosition{}, err
+		}
+		pos.Offset = l.start + n
+		return pos, nil
+	}
+
+	if lines >= 0 {
+		last, err := logwindow.LastLines(section, size-l.start, lines)
+		if err != nil {
+			return logPosition{}, err
+		}
+		section = io.NewSectionReader(l.f, l.start+last, size-l.start-last)
+	}
+
+	_, err := io.Copy(out, section)
+	return pos, err
+}
+
+// start returns the offset of the first byte of the file in the window.
+func (w *logWindow) start(f *os.File, info os.FileInfo) (int64, error) {
+	if w.cursor != nil {
+		pos, ok := w.cursor[f.Name()]
+		if ok && pos.Inode == inode(info) && pos.Offset <= info.Size() {
+			return pos.Offset, nil
+		}
+
+		// The file is new, or has been rotated or truncated, since the
+		// cursor was printed so all of it is unseen.
+		return 0, nil
+	}
+
+	if w.since.IsZero() {
+		return 0, nil
+	}
+
+	if info.ModTime().Before(w.since) {
+		return info.Size(), nil
+	}
+
+	start, err := logwindow.Since(f, info.Size(), w.since)
+	if err == logwindow.ErrNoTimestamps {
+		return 0, fmt.Errorf("cannot use --since with %s: %s", f.Name(), err)
+	}
+
+	return start, err
+}
+
+func inode(info os.FileInfo) uint64 {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		return uint64(stat.Ino)
+	}
+	return 0
+}
+
+// logCursor records how far each log file has been shown so that a later
+// command can carry on from there. Files are identified by their inode as
+// well as their path so that a rotated file is shown from its beginning.
+type logCursor map[string]logPosition
+
+type logPosition struct {
+	Inode  uint64 `json:"inode"`
+	Offset int64  `json:"offset"`
+}
+
+func (c logCursor) String() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func parseLogCursor(value string) (logCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor %q", value)
+	}
+
+	cursor := logCursor{}
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, fmt.Errorf("invalid cursor %q", value)
+	}
+
+	return cursor, nil
+}
+
+// logHeaders writes tail style headers whenever the output switches between
+// log files which are being followed together.
+type logHeaders struct {
+	mu   sync.Mutex
+	w    io.Writer
+	last string
+}
+
+func (h *logHeaders) writer(path string) io.Writer {
+	return &headedWriter{headers: h, path: path}
+}
+
+type headedWriter struct {
+	headers *logHeaders
+	path    string
+	partial []byte
+}
+
+// Write only passes on complete lines so that lines from different files are
+// never mixed together.
+func (w *headedWriter) Write(p []byte) (int, error) {
+	w.partial = append(w.partial, p...)
+
+	i := bytes.LastIndexByte(w.partial, '\n')
+	if i < 0 {
+		return len(p), nil
+	}
+
+	w.headers.mu.Lock()
+	defer w.headers.mu.Unlock()
+
+	if w.headers.last != w.path {
+		fmt.Fprintf(w.headers.w, "\n==> %s <==\n", w.path)
+		w.headers.last = w.path
+	}
+
+	if _, err := w.headers.w.Write(w.partial[:i+1]); err != nil {
+		return 0, err
+	}
+	w.partial = append(w.partial[:0], w.partial[i+1:]...)
+
+	return len(p), nil
+}
+
+func runTail(cmd *cobra.Command, tailCmds ...*exec.Cmd) error {
+	errCh := make(chan error, len(tailCmds))
+	for i, tailCmd := range tailCmds {
+		if err := tailCmd.Start(); err != nil {
+			for _, started := range tailCmds[:i] {
+				started.Process.Kill()
+			}
+			return err
+		}
+
+		go func(tailCmd *exec.Cmd) {
+			errCh <- tailCmd.Wait()
+		}(tailCmd)
+	}
 
 	signals := make(chan os.Signal, 1)
 	signal.Notify(signals)
 
-	for {
+	var tailErr error
+	for running := len(tailCmds); running > 0; {
 		select {
-		case sig := <-signals: // Forward signal received by parent to child
-			tailCmd.Process.Signal(sig)
-		case err := <-errCh: // Signal parent when child dies
-			if err != nil && err.Error() != "signal: interrupt" {
-				return err
+		case sig := <-signals: // Forward signal received by parent to children
+			for _, tailCmd := range tailCmds {
+				tailCmd.Process.Signal(sig)
+			}
+		case err := <-errCh: // Signal parent when children die
+			running--
+			if err != nil && err.Error() != "signal: interrupt" && tailErr == nil {
+				tailErr = err
+			}
+		}
+	}
+
+	if tailErr != nil {
+		return tailErr
+	}
+
+	fmt.Fprintln(cmd.OutOrStdout(), "")
+	return nil
+}
+
+// processLogFilter writes the lines of a bpm.log which belong to a process. An
+// empty process matches every line.
+type processLogFilter struct {
+	process string
+	w       io.Writer
+	partial []byte
+}
+
+func (f *processLogFilter) matches(line []byte) bool {
+	if f.process == "" {
+		return true
+	}
+
+	var entry struct {
+		Data struct {
+			Process string `json:"process"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(line, &entry); err != nil {
+		return false
+	}
+
+	return entry.Data.Process == f.process
+}
+
+// writeLast writes the last n matching complete lines of r, or all of them if
+// n is negative, and returns the number of bytes up to the end of the last
+// complete line.
+func (f *processLogFilter) writeLast(r io.Reader, n int) (int64, error) {
+	var (
+		last   [][]byte
+		offset int64
+	)
+
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return 0, err
+		}
+		offset += int64(len(line))
+
+		if n == 0 || !f.matches(bytes.TrimSpace(line)) {
+			continue
+		}
+
+		if n < 0 {
+			if _, err := f.w.Write(line); err != nil {
+				return 0, err
 			}
+			continue
+		}
 
-			fmt.Fprintln(cmd.OutOrStdout(), "")
-			return nil
+		last = append(last, line)
+		if len(last) > n {
+			last = last[1:]
 		}
 	}
+
+	for _, line := range last {
+		if _, err := f.w.Write(line); err != nil {
+			return 0, err
+		}
+	}
+
+	return offset, nil
+}
+
+func (f *processLogFilter) Write(p []byte) (int, error) {
+	f.partial = append(f.partial, p...)
+
+	for {
+		i := bytes.IndexByte(f.partial, '\n')
+		if i < 0 {
+			break
+		}
+
+		line := f.partial[:i+1]
+		if f.matches(bytes.TrimSpace(line)) {
+			if _, err := f.w.Write(line); err != nil {
+				return 0, err
+			}
+		}
+		f.partial = f.partial[i+1:]
+	}
+
+	return len(p), nil
 }
 
 func shouldTailStdout() bool {
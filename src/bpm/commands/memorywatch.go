@@ -0,0 +1,119 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package commands
+
+import (
+	"time"
+
+	"code.cloudfoundry.org/lager"
+	"github.com/spf13/cobra"
+
+	"bpm/memorypressure"
+	"bpm/runc/lifecycle"
+)
+
+// memoryWatchInterval is how often the memory-watch helper checks the memory
+// usage of the process.
+const memoryWatchInterval = 5 * time.Second
+
+func init() {
+	memoryWatchCommand.Flags().StringVarP(&procName, "process", "p", "", "optional process name")
+	RootCmd.AddCommand(memoryWatchCommand)
+}
+
+// memoryWatchCommand is started by bpm itself after starting a process which
+// has memory_pressure configured. It warns each time the memory usage of the
+// process rises past its threshold, until the process stops.
+var memoryWatchCommand = &cobra.Command{
+	Hidden:  true,
+	RunE:    memoryWatch,
+	Short:   "warns when a process is running short of memory",
+	Use:     "memory-watch <job-name>",
+	PreRunE: memoryWatchPre,
+}
+
+func memoryWatchPre(cmd *cobra.Command, args []string) error {
+	if err := validateInput(args); err != nil {
+		return err
+	}
+
+	cmd.SilenceUsage = true
+
+	return setupBpmLogs("memory-watch")
+}
+
+func memoryWatch(cmd *cobra.Command, _ []string) error {
+	logger.Info("starting")
+	defer logger.Info("complete")
+
+	jobCfg, err := bpmCfg.ParseJobConfig()
+	if err != nil {
+		logger.Error("failed-to-parse-config", err)
+		return err
+	}
+
+	procCfg, err := processByNameFromJobConfig(jobCfg, procName)
+	if err != nil {
+		logger.Error("process-not-defined", err)
+		return err
+	}
+
+	if procCfg.MemoryPressure == nil {
+		return nil
+	}
+
+	runcLifecycle, err := newRuncLifecycle()
+	if err != nil {
+		return err
+	}
+
+	detector := memorypressure.NewDetector(procCfg.MemoryPressure)
+	for {
+		stats, err := runcLifecycle.ProcessStats(ctx, bpmCfg)
+		if lifecycle.IsNotExist(err) {
+			return nil
+		} else if err != nil {
+			logger.Error("failed-to-get-stats", err)
+			return err
+		}
+
+		warning, err := detector.Observe(stats.Memory)
+		if err != nil {
+			logger.Error("failed-to-check-memory-pressure", err)
+			return err
+		}
+
+		if warning != nil {
+			logger.Info("memory-pressure", lager.Data{
+				"usage_bytes":     warning.UsageBytes,
+				"threshold_bytes": warning.ThresholdBytes,
+				"limit_bytes":     warning.LimitBytes,
+			})
+
+			if hook := procCfg.MemoryPressure.Hook; hook != "" {
+				if err := memorypressure.RunHook(ctx, hook, bpmCfg, *warning); err != nil {
+					logger.Error("memory-pressure-hook-failed", err)
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(memoryWatchInterval):
+		}
+	}
+}
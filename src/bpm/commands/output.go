@@ -0,0 +1,173 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package commands
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"bpm/admission"
+	"bpm/diskspace"
+	"bpm/hostlock"
+	"bpm/runc/lifecycle"
+	"bpm/statusfile"
+)
+
+// Error classes reported in the JSON result of a command so that tools
+// wrapping bpm can decide what to do about a failure without parsing its
+// message.
+const (
+	ErrorClassUsage       = "usage"
+	ErrorClassConfig      = "config"
+	ErrorClassLockTimeout = "lock-timeout"
+	ErrorClassDiskSpace   = "disk-space"
+	ErrorClassRejected    = "rejected"
+	ErrorClassInterrupted = "interrupted"
+	ErrorClassFailed      = "failed"
+)
+
+var (
+	outputFormat string
+
+	// commandStarted is when bpm started running the command, which the
+	// duration in its result is measured from.
+	commandStarted = time.Now()
+)
+
+// addOutputFlag lets a command report its result as JSON.
+func addOutputFlag(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&outputFormat, "output", "text", "how to report the result (text or json)")
+}
+
+func validateOutputFormat() error {
+	switch outputFormat {
+	case "text", "json":
+		return nil
+	default:
+		return fmt.Errorf("invalid output format: %s", outputFormat)
+	}
+}
+
+// classifiedError is an error which is reported with a particular class in
+// the JSON result of a command.
+type classifiedError struct {
+	class string
+	err   error
+}
+
+func (e *classifiedError) Error() string { return e.err.Error() }
+func (e *classifiedError) Unwrap() error { return e.err }
+
+func configError(err error) error {
+	return &classifiedError{class: ErrorClassConfig, err: err}
+}
+
+// errorClass works out the class of an error returned by a command. Errors
+// returned before the command got far enough to silence its usage are
+// problems with how it was called.
+func errorClass(cmd *cobra.Command, err error) string {
+	var classified *classifiedError
+	var lockTimeout *hostlock.TimeoutError
+	var diskSpace *diskspace.InsufficientError
+	var rejected *admission.RejectedError
+
+	switch {
+	case errors.As(err, &classified):
+		return classified.class
+	case errors.As(err, &lockTimeout):
+		return ErrorClassLockTimeout
+	case errors.As(err, &diskSpace):
+		return ErrorClassDiskSpace
+	case errors.As(err, &rejected):
+		return ErrorClassRejected
+	case ctx.Err() != nil:
+		return ErrorClassInterrupted
+	case cmd != nil && !cmd.SilenceUsage:
+		return ErrorClassUsage
+	default:
+		return ErrorClassFailed
+	}
+}
+
+type jsonResult struct {
+	Command         string  `json:"command"`
+	Job             string  `json:"job,omitempty"`
+	Process         string  `json:"process,omitempty"`
+	ContainerID     string  `json:"container_id,omitempty"`
+	Status          string  `json:"status,omitempty"`
+	Pid             int     `json:"pid,omitempty"`
+	DurationSeconds float64 `json:"duration_seconds"`
+
+	Error *jsonError `json:"error,omitempty"`
+}
+
+type jsonError struct {
+	Class   string `json:"class"`
+	Message string `json:"message"`
+
+	// Phase is the phase of starting the process which failed, for errors
+	// from starting one.
+	Phase string `json:"phase,omitempty"`
+}
+
+// WantsJSONResult reports whether the command which was run was asked to
+// report its result as JSON.
+func WantsJSONResult(cmd *cobra.Command) bool {
+	if cmd == nil || cmd.Flags().Lookup("output") == nil {
+		return false
+	}
+
+	return outputFormat == "json"
+}
+
+// PrintResult writes a single JSON object describing how the command went:
+// the state it left the process in, how long it took, and the class of the
+// error it failed with, if any.
+func PrintResult(cmd *cobra.Command, err error, stdout io.Writer) error {
+	result := jsonResult{
+		Command:         cmd.Name(),
+		DurationSeconds: time.Since(commandStarted).Seconds(),
+	}
+
+	if bpmCfg != nil {
+		result.Job = bpmCfg.JobName()
+		result.Process = bpmCfg.ProcName()
+		result.ContainerID = bpmCfg.ContainerID()
+
+		// A status recorded before the command started says nothing about
+		// what the command did.
+		status, err := statusfile.Read(bpmCfg.StatusFile())
+		if err == nil && !status.CheckedAt.Before(commandStarted.Truncate(time.Second)) {
+			result.Status = status.State
+			result.Pid = status.Pid
+		}
+	}
+
+	if err != nil {
+		result.Error = &jsonError{
+			Class:   errorClass(cmd, err),
+			Message: err.Error(),
+			Phase:   lifecycle.StartPhase(err),
+		}
+	}
+
+	return json.NewEncoder(stdout).Encode(result)
+}
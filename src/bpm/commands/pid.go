@@ -21,7 +21,6 @@ import (
 
 	"github.com/spf13/cobra"
 
-	"bpm/models"
 	"bpm/runc/lifecycle"
 )
 
@@ -48,10 +47,13 @@ func pidForJob(cmd *cobra.Command, _ []string) error {
 	if err != nil {
 		return err
 	}
-	process, err := runcLifecycle.StatProcess(bpmCfg)
+	process, err := runcLifecycle.StatProcess(ctx, bpmCfg)
+	if lifecycle.IsNotExist(err) {
+		process, err = runcLifecycle.StatAdoptedProcess(bpmCfg)
+	}
 	if err != nil && !lifecycle.IsNotExist(err) {
 		return fmt.Errorf("failed to get job: %s", err)
-	} else if lifecycle.IsNotExist(err) || process.Status == models.ProcessStateFailed {
+	} else if lifecycle.IsNotExist(err) || process.HasExited() {
 		return errors.New("process is not running or could not be found")
 	}
 
@@ -0,0 +1,217 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package commands
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+	"github.com/spf13/cobra"
+
+	"bpm/config"
+	"bpm/models"
+	"bpm/runc/lifecycle"
+)
+
+var quarantineReason string
+
+func init() {
+	quarantineCommand.Flags().StringVarP(&procName, "process", "p", "", "optional process name")
+	quarantineCommand.Flags().StringVar(&quarantineReason, "reason", "", "why the process is being quarantined")
+	unquarantineCommand.Flags().StringVarP(&procName, "process", "p", "", "optional process name")
+	RootCmd.AddCommand(quarantineCommand)
+	RootCmd.AddCommand(unquarantineCommand)
+}
+
+var quarantineCommand = &cobra.Command{
+	Long:     "Freezes every process in the container of a misbehaving BOSH Process and keeps the container as it is for investigation. bpm refuses to start or stop the process until it is resolved with 'bpm unquarantine' or 'bpm delete'. Processes share the network of the host, so their connections stay open but nothing is sent while they are frozen.",
+	RunE:     quarantine,
+	Short:    "freezes a BOSH Process and preserves its state for investigation",
+	Use:      "quarantine <job-name>",
+	PreRunE:  quarantinePre,
+	PostRunE: quarantinePost,
+}
+
+var unquarantineCommand = &cobra.Command{
+	RunE:     unquarantine,
+	Short:    "resumes a quarantined BOSH Process",
+	Use:      "unquarantine <job-name>",
+	PreRunE:  quarantinePre,
+	PostRunE: quarantinePost,
+}
+
+func quarantinePre(cmd *cobra.Command, args []string) error {
+	if err := validateInput(args); err != nil {
+		return err
+	}
+
+	cmd.SilenceUsage = true
+
+	if err := setupBpmLogs(cmd.Name()); err != nil {
+		return err
+	}
+
+	return acquireLifecycleLock()
+}
+
+func quarantinePost(cmd *cobra.Command, args []string) error {
+	return releaseLifecycleLock()
+}
+
+func quarantine(cmd *cobra.Command, _ []string) error {
+	logger.Info("starting", lager.Data{"reason": quarantineReason})
+	defer logger.Info("complete")
+
+	if q, err := readQuarantine(bpmCfg); err != nil {
+		return err
+	} else if q != nil {
+		return fmt.Errorf("process has been quarantined since %s", q.Since.UTC().Format(time.RFC3339))
+	}
+
+	runcLifecycle, err := newRuncLifecycle()
+	if err != nil {
+		return err
+	}
+
+	process, err := runcLifecycle.StatProcess(ctx, bpmCfg)
+	if err != nil && !lifecycle.IsNotExist(err) {
+		return fmt.Errorf("failed to get job: %s", err)
+	} else if lifecycle.IsNotExist(err) || process.Status != models.ProcessStateRunning {
+		return errors.New("process is not running or could not be found")
+	}
+
+	// The record is written first so that a process which is frozen is
+	// never mistaken for one which can be started or stopped as usual.
+	q := &models.Quarantine{Since: time.Now(), Reason: quarantineReason}
+	if err := writeQuarantine(bpmCfg, q); err != nil {
+		return stateError(err)
+	}
+
+	if err := runcLifecycle.FreezeProcess(ctx, logger, bpmCfg); err != nil {
+		logger.Error("failed-to-freeze", err)
+		if cerr := clearQuarantine(bpmCfg); cerr != nil {
+			logger.Error("failed-to-clear-quarantine", cerr)
+		}
+		return fmt.Errorf("failed to quarantine process: %s", err)
+	}
+
+	recordStatus(models.ProcessStateQuarantined, process.Pid, nil)
+	fmt.Fprintf(cmd.OutOrStdout(), "quarantined %s: its container is frozen and kept until 'bpm unquarantine' or 'bpm delete'\n", bpmCfg.ContainerID())
+	return nil
+}
+
+func unquarantine(cmd *cobra.Command, _ []string) error {
+	logger.Info("starting")
+	defer logger.Info("complete")
+
+	q, err := readQuarantine(bpmCfg)
+	if err != nil {
+		return err
+	} else if q == nil {
+		return errors.New("process is not quarantined")
+	}
+
+	runcLifecycle, err := newRuncLifecycle()
+	if err != nil {
+		return err
+	}
+
+	process, err := runcLifecycle.StatProcess(ctx, bpmCfg)
+	if lifecycle.IsNotExist(err) {
+		// Nothing is left to thaw, which resolves the quarantine too.
+		logger.Info("job-already-deleted")
+		return clearQuarantine(bpmCfg)
+	} else if err != nil {
+		return fmt.Errorf("failed to get job: %s", err)
+	}
+
+	if process.Status == lifecycle.ContainerStatePaused {
+		if err := runcLifecycle.ThawProcess(logger, bpmCfg); err != nil {
+			logger.Error("failed-to-thaw", err)
+			return fmt.Errorf("failed to unquarantine process: %s", err)
+		}
+	}
+
+	if err := clearQuarantine(bpmCfg); err != nil {
+		return err
+	}
+
+	recordStatus(models.ProcessStateRunning, process.Pid, nil)
+	return nil
+}
+
+// refuseQuarantined returns an error for a process which has been
+// quarantined, which must not be started, stopped, signalled, updated, or
+// entered until it is resolved.
+func refuseQuarantined(cfg *config.BPMConfig) error {
+	q, err := readQuarantine(cfg)
+	if err != nil || q == nil {
+		return err
+	}
+
+	return fmt.Errorf("process has been quarantined since %s: resolve it with 'bpm unquarantine' or 'bpm delete'", q.Since.UTC().Format(time.RFC3339))
+}
+
+// applyQuarantine shows a quarantined process as such rather than by the
+// state of its frozen container.
+func applyQuarantine(cfg *config.BPMConfig, process *models.Process) {
+	if q, err := readQuarantine(cfg); err == nil && q != nil {
+		process.Status = models.ProcessStateQuarantined
+	}
+}
+
+func readQuarantine(cfg *config.BPMConfig) (*models.Quarantine, error) {
+	data, err := ioutil.ReadFile(cfg.QuarantineFile())
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var q models.Quarantine
+	if err := json.Unmarshal(data, &q); err != nil {
+		return nil, fmt.Errorf("invalid quarantine record %s: %s", cfg.QuarantineFile(), err)
+	}
+
+	return &q, nil
+}
+
+func writeQuarantine(cfg *config.BPMConfig, q *models.Quarantine) error {
+	if err := os.MkdirAll(filepath.Dir(cfg.QuarantineFile()), 0700); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(q)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(cfg.QuarantineFile(), data, 0600)
+}
+
+func clearQuarantine(cfg *config.BPMConfig) error {
+	if err := os.Remove(cfg.QuarantineFile()); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,67 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package commands
+
+import (
+	"errors"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"bpm/exitstatus"
+	"bpm/reaper"
+)
+
+var (
+	reapPidFile  string
+	reapExitFile string
+)
+
+func init() {
+	reapCommand.Flags().StringVar(&reapPidFile, "pid-file", "", "the file the command writes the pid of the background process to")
+	reapCommand.Flags().StringVar(&reapExitFile, "exit-file", "", "the file to record the exit status of the background process in")
+	RootCmd.AddCommand(reapCommand)
+}
+
+// reapCommand is started by bpm itself around `runc run --detach` so that
+// the exit status of the container's process can be recorded. It reports the
+// exit status of runc on file descriptor 3.
+var reapCommand = &cobra.Command{
+	Hidden: true,
+	RunE:   reap,
+	Short:  "runs a command and records the exit status of the process it starts",
+	Use:    "reap --pid-file <path> --exit-file <path> -- <command>...",
+}
+
+func reap(cmd *cobra.Command, args []string) error {
+	if len(args) == 0 || reapPidFile == "" || reapExitFile == "" {
+		return errors.New("must specify a command, pid file, and exit file")
+	}
+
+	cmd.SilenceUsage = true
+
+	ready := os.NewFile(3, "ready")
+	status, err := reaper.Run(reapPidFile, reapExitFile, ready, os.Stdout, os.Stderr, args)
+	if err != nil {
+		return err
+	}
+
+	if status != 0 {
+		return &exitstatus.Error{Status: status, Err: errors.New("command failed")}
+	}
+
+	return nil
+}
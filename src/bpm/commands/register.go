@@ -0,0 +1,189 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package commands
+
+import (
+	"time"
+
+	"code.cloudfoundry.org/lager"
+	"github.com/spf13/cobra"
+
+	"bpm/config"
+	"bpm/helpers"
+	"bpm/models"
+	"bpm/registration"
+	"bpm/runc/lifecycle"
+)
+
+// registerPollInterval is how often the register helper checks whether the
+// process is ready.
+const registerPollInterval = time.Second
+
+func init() {
+	registerCommand.Flags().StringVarP(&procName, "process", "p", "", "optional process name")
+	RootCmd.AddCommand(registerCommand)
+}
+
+// registerCommand is started by bpm itself after starting a process which has
+// a register integration. It waits until the process is running and listening
+// on all of its ports and then registers it.
+var registerCommand = &cobra.Command{
+	Hidden:  true,
+	RunE:    register,
+	Short:   "registers a process once it is ready",
+	Use:     "register <job-name>",
+	PreRunE: registerPre,
+}
+
+func registerPre(cmd *cobra.Command, args []string) error {
+	if err := validateInput(args); err != nil {
+		return err
+	}
+
+	cmd.SilenceUsage = true
+
+	return setupBpmLogs("register")
+}
+
+func register(cmd *cobra.Command, _ []string) error {
+	logger.Info("starting")
+	defer logger.Info("complete")
+
+	jobCfg, err := bpmCfg.ParseJobConfig()
+	if err != nil {
+		logger.Error("failed-to-parse-config", err)
+		return err
+	}
+
+	procCfg, err := processByNameFromJobConfig(jobCfg, procName)
+	if err != nil {
+		logger.Error("process-not-defined", err)
+		return err
+	}
+
+	if procCfg.Register == nil {
+		return nil
+	}
+
+	runcLifecycle, err := newRuncLifecycle()
+	if err != nil {
+		return err
+	}
+
+	process, err := waitUntilReady(runcLifecycle, procCfg)
+	if err != nil {
+		logger.Error("failed-waiting-for-readiness", err)
+		return err
+	}
+	if process == nil {
+		logger.Info("process-stopped-before-ready")
+		return nil
+	}
+
+	if err := registration.Run(ctx, procCfg.Register, registration.Register, registrationInfo(bpmCfg, procCfg, process.Pid)); err != nil {
+		logger.Error("failed-to-register", err)
+		return err
+	}
+
+	logger.Info("registered")
+	return nil
+}
+
+// waitUntilReady waits until the process is running and listening on all of
+// its ports. It returns nil if the process stops first.
+func waitUntilReady(runcLifecycle *lifecycle.RuncLifecycle, procCfg *config.ProcessConfig) (*models.Process, error) {
+	for {
+		process, err := runcLifecycle.StatProcess(ctx, bpmCfg)
+		if lifecycle.IsNotExist(err) {
+			return nil, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		if process.Status != models.ProcessStateRunning {
+			return nil, nil
+		}
+
+		ready := true
+		if len(procCfg.Ports) > 0 {
+			checks, err := runcLifecycle.CheckPorts(ctx, bpmCfg, procCfg.Ports)
+			if lifecycle.IsNotExist(err) {
+				return nil, nil
+			} else if err != nil {
+				return nil, err
+			}
+
+			for _, check := range checks {
+				ready = ready && check.Listening
+			}
+		}
+
+		if ready {
+			return process, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(registerPollInterval):
+		}
+	}
+}
+
+// deregister deregisters a running process before it is stopped, after
+// cancelling a registration which is still waiting for the process to be
+// ready. Failures are logged rather than stopping the process from being
+// stopped.
+func deregister(logger lager.Logger, cfg *config.BPMConfig, process *models.Process) {
+	jobCfg, err := cfg.ParseJobConfig()
+	if err != nil {
+		return
+	}
+
+	procCfg, err := processByNameFromJobConfig(jobCfg, cfg.ProcName())
+	if err != nil {
+		return
+	}
+
+	integration := procCfg.Deregistration()
+	if integration == nil {
+		return
+	}
+
+	if err := helpers.StopKind(cfg.HelpersDir().External(), registration.HelperKind, 0); err != nil {
+		logger.Error("failed-to-stop-registration", err)
+	}
+
+	logger.Info("deregistering")
+	if err := registration.Run(ctx, integration, registration.Deregister, registrationInfo(cfg, procCfg, process.Pid)); err != nil {
+		logger.Error("failed-to-deregister", err)
+	}
+}
+
+func registrationInfo(cfg *config.BPMConfig, procCfg *config.ProcessConfig, pid int) registration.Info {
+	info := registration.Info{
+		Job:     cfg.JobName(),
+		Process: cfg.ProcName(),
+		Pid:     pid,
+		Ports:   procCfg.Ports,
+	}
+
+	if instance, err := cfg.Instance(); err == nil {
+		info.Instance = &instance
+	}
+
+	return info
+}
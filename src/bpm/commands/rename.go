@@ -0,0 +1,102 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package commands
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"bpm/config"
+	"bpm/rename"
+	"bpm/runc/lifecycle"
+)
+
+var renameDryRun bool
+
+func init() {
+	renameCommand.Flags().BoolVar(&renameDryRun, "dry-run", false, "only list what would be moved and removed")
+	RootCmd.AddCommand(renameCommand)
+}
+
+var renameCommand = &cobra.Command{
+	RunE:  renameJob,
+	Short: "moves the data, store, logs, and state of a job to a new name",
+	Long: "Moves the data, store, and log directories, overrides, status, and metrics of\n" +
+		"a job which has been renamed so that its processes carry on where they left off\n" +
+		"under the new name. None of its processes may have a container under either\n" +
+		"name: stop them first. Nothing belonging to the new name is overwritten.",
+	Use:  "rename <old-job-name> <new-job-name>",
+	Args: cobra.ExactArgs(2),
+}
+
+func renameJob(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+	oldJob, newJob := args[0], args[1]
+
+	runcLifecycle, err := newRuncLifecycle()
+	if err != nil {
+		return err
+	}
+
+	plan, err := rename.NewPlan(boshEnv, oldJob, newJob)
+	if err != nil {
+		return fmt.Errorf("cannot rename %s to %s: %s", oldJob, newJob, err)
+	}
+
+	for _, proc := range plan.Processes {
+		for _, job := range []string{oldJob, newJob} {
+			lock, err := locks.LockJob(job, proc)
+			if err != nil {
+				return err
+			}
+			defer lock.Unlock()
+
+			if err := checkStopped(runcLifecycle, job, proc); err != nil {
+				return err
+			}
+		}
+	}
+
+	moveVerb, removeVerb := "moved", "removed"
+	if renameDryRun {
+		moveVerb, removeVerb = "would move", "would remove"
+	} else if err := plan.Apply(); err != nil {
+		return fmt.Errorf("failed to rename %s to %s: %s", oldJob, newJob, err)
+	}
+
+	for _, m := range plan.Moves {
+		fmt.Fprintf(cmd.OutOrStdout(), "%s %s -> %s\n", moveVerb, m.From, m.To)
+	}
+	for _, path := range plan.Removals {
+		fmt.Fprintf(cmd.OutOrStdout(), "%s %s\n", removeVerb, path)
+	}
+
+	return nil
+}
+
+// checkStopped returns an error unless the process has no container. The
+// process's lock must be held so that it cannot be started in the meantime.
+func checkStopped(runcLifecycle *lifecycle.RuncLifecycle, job, proc string) error {
+	_, err := runcLifecycle.StatProcess(ctx, config.NewBPMConfig(boshEnv, job, proc))
+	if err == nil {
+		return fmt.Errorf("%s/%s still has a container (run `bpm stop %s -p %s` first)", job, proc, job, proc)
+	} else if !lifecycle.IsNotExist(err) {
+		return fmt.Errorf("failed to check for the container of %s/%s: %s", job, proc, err)
+	}
+
+	return nil
+}
@@ -16,25 +16,40 @@
 package commands
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
 	"os/user"
 	"path/filepath"
+	"syscall"
+	"time"
 
 	"code.cloudfoundry.org/clock"
 	"code.cloudfoundry.org/lager"
 	"github.com/spf13/cobra"
 
+	"bpm/admission"
 	"bpm/bosh"
 	"bpm/cgroups"
 	"bpm/config"
+	"bpm/credhub"
+	"bpm/execcheck"
 	"bpm/hostlock"
+	"bpm/loglimit"
+	"bpm/metrics"
+	"bpm/redact"
 	"bpm/runc/adapter"
 	"bpm/runc/client"
 	"bpm/runc/lifecycle"
 	"bpm/sharedvolume"
+	"bpm/specmutator"
+	"bpm/statusfile"
 	"bpm/sysfeat"
+	"bpm/tracing"
+	"bpm/units"
 	"bpm/usertools"
 )
 
@@ -43,16 +58,26 @@ var (
 	logger      lager.Logger
 	procName    string
 	showVersion bool
+	lockTimeout time.Duration
+
+	// logRedactor hides the values of the process's sensitive environment
+	// variables from logger once the job configuration has been read.
+	logRedactor *redact.Sink
 
 	userFinder = usertools.NewUserFinder()
 	boshEnv    = bosh.NewEnv(os.Getenv("BPM_BOSH_ROOT"))
 
 	locks         *hostlock.Handle
 	lifecycleLock hostlock.LockedLock
+
+	// ctx is cancelled when bpm is interrupted so that the operation in
+	// progress can be aborted rather than left half finished.
+	ctx = context.Background()
 )
 
 func init() {
 	RootCmd.PersistentFlags().BoolVar(&showVersion, "version", false, "print BPM version")
+	RootCmd.PersistentFlags().Var(units.DurationFlag(&lockTimeout, 0), "lock-timeout", "how long to wait for a process's lock before giving up (0 waits forever)")
 }
 
 var RootCmd = &cobra.Command{
@@ -70,22 +95,39 @@ func rootPre(cmd *cobra.Command, _ []string) error {
 		os.Exit(0)
 	}
 
-	usr, err := user.Current()
-	if err != nil {
+	if err := requireRoot(cmd); err != nil {
 		return err
 	}
 
-	if usr.Uid != "0" && usr.Gid != "0" {
-		cmd.SilenceUsage = true
-		return errors.New("bpm must be run as root. Please run 'sudo -i' to become the root user.")
+	if err := validateOutputFormat(); err != nil {
+		return err
+	}
+
+	if lockTimeout < 0 {
+		return errors.New("--lock-timeout must not be negative")
+	}
+
+	if err := relocateState(cmd.ErrOrStderr()); err != nil {
+		return err
 	}
 
+	// Lookups are kept between runs so that a start does not depend on the
+	// user database, which may be remote, every time.
+	userFinder = usertools.NewPersistentUserFinder(clock.NewClock(), usertools.DefaultCacheTTL, config.UserCachePath(boshEnv))
+
 	lockDir := config.LocksPath(boshEnv)
 	if err := os.MkdirAll(lockDir, 0700); err != nil {
-		return err
+		cmd.SilenceUsage = true
+		return stateError(err)
 	}
 
 	locks = hostlock.NewHandle(lockDir)
+	locks.Operation = cmd.CommandPath()
+	locks.Timeout = lockTimeout
+	locks.Waiting = func(name string, owner *hostlock.Owner) {
+		fmt.Fprintf(cmd.ErrOrStderr(), "waiting for the lock on %s held by %s\n", name, owner)
+	}
+	ctx = interruptibleContext()
 
 	if !isRunningSystemd() {
 		return cgroups.Setup()
@@ -94,6 +136,70 @@ func rootPre(cmd *cobra.Command, _ []string) error {
 	return nil
 }
 
+func requireRoot(cmd *cobra.Command) error {
+	usr, err := user.Current()
+	if err != nil {
+		return err
+	}
+
+	if usr.Uid != "0" && usr.Gid != "0" {
+		cmd.SilenceUsage = true
+		return errors.New("bpm must be run as root. Please run 'sudo -i' to become the root user.")
+	}
+
+	return nil
+}
+
+// relocateState moves the directories which bpm writes to out of the BOSH
+// root if the operator has configured somewhere else for them. A
+// configuration which cannot be parsed only stops bpm if it relocates the
+// state, since bpm would otherwise use directories which other commands do
+// not. Without relocation the default directories are used and the error is
+// only reported to out.
+func relocateState(out io.Writer) error {
+	hostCfg, err := config.ParseHostConfig(config.HostConfigPath(boshEnv))
+	if err != nil {
+		if hostCfg.State != nil {
+			return fmt.Errorf("failed to parse bpm configuration: %s", err)
+		}
+		fmt.Fprintf(out, "ignoring bpm configuration which cannot be parsed: %s\n", err)
+	}
+
+	if hostCfg.State == nil {
+		return nil
+	}
+
+	return hostCfg.State.Relocate(boshEnv)
+}
+
+// stateError explains a failure to write to one of bpm's state directories
+// which was caused by it being on a read-only filesystem.
+func stateError(err error) error {
+	if errors.Is(err, syscall.EROFS) {
+		return fmt.Errorf("%w: move bpm's state to a writable filesystem with the bpm.state properties and check it with 'bpm doctor'", err)
+	}
+
+	return err
+}
+
+// interruptibleContext returns a context which is cancelled when bpm receives
+// SIGINT, SIGTERM, or SIGHUP (for example when the SSH session of an operator
+// drops). Later signals are ignored so that they cannot interrupt the cleanup
+// of the cancelled operation.
+func interruptibleContext() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+
+	go func() {
+		<-signals
+		cancel()
+	}()
+
+	return ctx
+}
+
 func root(cmd *cobra.Command, args []string) error {
 	return errors.New("Exit code 1")
 }
@@ -115,34 +221,42 @@ func validateInput(args []string) error {
 }
 
 func setupBpmLogs(sessionName string) error {
-	err := os.MkdirAll(bpmCfg.LogDir().External(), 0750)
+	var err error
+	logger, logRedactor, err = newJobLogger(bpmCfg, sessionName)
+	return stateError(err)
+}
+
+// newJobLogger returns a logger which writes to the bpm.log of the job. Values
+// added to the returned sink are redacted from everything it logs.
+func newJobLogger(cfg *config.BPMConfig, sessionName string) (lager.Logger, *redact.Sink, error) {
+	err := os.MkdirAll(cfg.LogDir().External(), 0750)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 
-	logFile, err := os.OpenFile(bpmCfg.BPMLog(), os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	logFile, err := os.OpenFile(cfg.BPMLog(), os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 
 	usr, err := userFinder.Lookup(usertools.VcapUser)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 
-	err = os.Chown(bpmCfg.BPMLog(), int(usr.UID), int(usr.GID))
+	err = os.Chown(cfg.BPMLog(), int(usr.UID), int(usr.GID))
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 
-	logger = lager.NewLogger("bpm")
-	logger.RegisterSink(lager.NewPrettySink(logFile, lager.INFO))
-	logger = logger.Session(sessionName, lager.Data{
-		"job":     bpmCfg.JobName(),
-		"process": bpmCfg.ProcName(),
-	})
+	sink := redact.NewSink(lager.NewPrettySink(logFile, lager.INFO))
 
-	return nil
+	l := lager.NewLogger("bpm")
+	l.RegisterSink(sink)
+	return l.Session(sessionName, lager.Data{
+		"job":     cfg.JobName(),
+		"process": cfg.ProcName(),
+	}), sink, nil
 }
 
 func acquireLifecycleLock() error {
@@ -151,13 +265,25 @@ func acquireLifecycleLock() error {
 	defer l.Info("complete")
 
 	var err error
-	lifecycleLock, err = locks.LockJob(bpmCfg.JobName(), bpmCfg.ProcName())
+	lifecycleLock, err = lockJob(l, bpmCfg)
+	return err
+}
+
+// lockJob takes the lock of a process and records how long it had to wait.
+func lockJob(logger lager.Logger, cfg *config.BPMConfig) (hostlock.LockedLock, error) {
+	waitStart := time.Now()
+	_, span := tracing.Start(ctx, "acquire-lock")
+	lock, err := locks.LockJob(cfg.JobName(), cfg.ProcName())
+	span.End(err)
 	if err != nil {
-		l.Error("failed-to-acquire-lock", err)
-		return err
+		logger.Error("failed-to-acquire-lock", err)
+		return nil, err
 	}
 
-	return nil
+	waited := time.Since(waitStart)
+	recordMetrics(logger, cfg, func(m *metrics.Metrics) { m.LockWait.Observe(waited) })
+
+	return lock, nil
 }
 
 func releaseLifecycleLock() error {
@@ -179,14 +305,61 @@ func newRuncLifecycle() (*lifecycle.RuncLifecycle, error) {
 		config.RuncRoot(boshEnv),
 		isRunningSystemd(),
 	)
+	if bpmPath, err := os.Executable(); err == nil {
+		runcClient.UseReaper(bpmPath)
+	}
+
+	// rootPre has already reported a configuration which cannot be
+	// parsed. It is only needed here if it moves the runc state of jobs or
+	// configures the secret store.
+	hostCfg, err := config.ParseHostConfig(config.HostConfigPath(boshEnv))
+	if err != nil && (hostCfg.PerJobRuncRoots || hostCfg.CredHub != nil) {
+		return nil, fmt.Errorf("failed to parse bpm configuration: %s", err)
+	}
+	runcClient.UseJobRoots(config.RuncJobRoots(boshEnv), hostCfg.PerJobRuncRoots)
+
 	features, err := sysfeat.Fetch()
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch system features: %q", err)
 	}
 
-	runcAdapter := adapter.NewRuncAdapter(*features, filepath.Glob, sharedvolume.MakeShared, locks)
+	var secrets adapter.SecretStore
+	if hostCfg.CredHubEnabled() {
+		secrets, err = credhub.NewClient(*hostCfg.CredHub)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	runcAdapter := adapter.NewRuncAdapter(*features, filepath.Glob, sharedvolume.MakeShared, locks, secrets, egressClasses())
 	clock := clock.NewClock()
 
+	var specMutator lifecycle.SpecMutator
+	if len(hostCfg.SpecMutators) > 0 {
+		specMutator, err = specmutator.NewChain(hostCfg.SpecMutators)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var logLimiter lifecycle.LogLimiter
+	if hostCfg.MaxLogLineLength > 0 {
+		logLimiter = loglimit.NewLimiter(hostCfg.MaxLogLineLength)
+	}
+
+	var execChecker lifecycle.ExecutableChecker
+	if hostCfg.VerifyExecutables {
+		execChecker = execcheck.NewChecker()
+	}
+
+	var admissionController lifecycle.AdmissionController
+	if len(hostCfg.Admission) > 0 {
+		admissionController, err = admission.NewController(hostCfg.Admission)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return lifecycle.NewRuncLifecycle(
 		runcClient,
 		runcAdapter,
@@ -194,9 +367,38 @@ func newRuncLifecycle() (*lifecycle.RuncLifecycle, error) {
 		lifecycle.NewCommandRunner(),
 		clock,
 		os.RemoveAll,
+		specMutator,
+		logLimiter,
+		execChecker,
+		admissionController,
 	), nil
 }
 
+// recordStatus updates the status file of the process with what bpm has just
+// found. Failing to do so is logged but does not fail the command since the
+// file is only informational.
+func recordStatus(state string, pid int, checkErr error) {
+	recordStatusFor(logger, bpmCfg, state, pid, checkErr)
+}
+
+func recordStatusFor(logger lager.Logger, cfg *config.BPMConfig, state string, pid int, checkErr error) {
+	if err := statusfile.Update(cfg.StatusFile(), time.Now(), state, pid, checkErr); err != nil {
+		logger.Error("failed-to-update-status-file", err)
+	}
+}
+
+// recordMetrics updates the metrics of bpm's operations on a process. Failing
+// to do so does not fail the operation.
+func recordMetrics(logger lager.Logger, cfg *config.BPMConfig, update func(*metrics.Metrics)) {
+	if err := metrics.Update(cfg.MetricsFile(), cfg.JobName(), cfg.ProcName(), update); err != nil {
+		logger.Error("failed-to-update-metrics", err)
+	}
+}
+
+func countCleanupFailure(m *metrics.Metrics) {
+	m.CleanupFailures++
+}
+
 func processByNameFromJobConfig(jobCfg *config.JobConfig, procName string) (*config.ProcessConfig, error) {
 	for _, processConfig := range jobCfg.Processes {
 		if processConfig.Name == procName {
@@ -208,11 +410,7 @@ func processByNameFromJobConfig(jobCfg *config.JobConfig, procName string) (*con
 }
 
 func isRunningSystemd() bool {
-	systemdSystemDir, err := os.Lstat("/run/systemd/system")
-	if err != nil {
-		return false
-	}
-	return systemdSystemDir.IsDir()
+	return sysfeat.SystemdRunning()
 }
 
 // Occasionally RunC can get in an inconsistent state after a restart where
@@ -220,18 +418,32 @@ func isRunningSystemd() bool {
 // this state without some intervention. This is that intervention.
 func forceCleanupBrokenRuncState(logger lager.Logger, runcLifecycle *lifecycle.RuncLifecycle) error {
 	// We compute this here rather than adding a new function to the
-	// configuration object to try and contain this hack to one place.
-	statePath := filepath.Join(config.RuncRoot(boshEnv), bpmCfg.ContainerID(), "state.json")
-
-	if err := os.RemoveAll(statePath); err != nil {
-		logger.Error("failed-to-remove-state-file", err)
-		return fmt.Errorf("failed to clean up stale state file: %s", err)
+	// configuration object to try and contain this hack to one place. The
+	// container may be in either the shared root or its job's root.
+	for _, root := range []string{config.RuncRoot(boshEnv), config.RuncJobRoot(boshEnv, bpmCfg.JobName())} {
+		statePath := filepath.Join(root, bpmCfg.ContainerID(), "state.json")
+
+		if err := os.RemoveAll(statePath); err != nil {
+			logger.Error("failed-to-remove-state-file", err)
+			return fmt.Errorf("failed to clean up stale state file: %s", err)
+		}
 	}
 
-	if err := runcLifecycle.RemoveProcess(logger, bpmCfg); err != nil {
+	if err := removeProcess(logger, runcLifecycle, bpmCfg); err != nil {
 		logger.Error("failed-to-cleanup", err)
 		return fmt.Errorf("failed to clean up stale job-process: %s", err)
 	}
 
 	return nil
 }
+
+// removeProcess removes the container of a process along with the egress
+// class which it held.
+func removeProcess(logger lager.Logger, runcLifecycle *lifecycle.RuncLifecycle, cfg *config.BPMConfig) error {
+	if err := runcLifecycle.RemoveProcess(ctx, logger, cfg); err != nil {
+		return err
+	}
+
+	releaseEgress(logger, cfg)
+	return nil
+}
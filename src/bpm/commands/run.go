@@ -18,6 +18,7 @@ package commands
 import (
 	"fmt"
 
+	"code.cloudfoundry.org/lager"
 	"github.com/spf13/cobra"
 
 	"bpm/exitstatus"
@@ -82,6 +83,12 @@ func run(cmd *cobra.Command, _ []string) error {
 		return fmt.Errorf("process %q not present in job configuration (%s)", procName, bpmCfg.JobConfig())
 	}
 
+	warnDeprecations(cmd, procCfg.Deprecations())
+
+	if procCfg.Overridden {
+		logger.Info("using-local-override", lager.Data{"path": bpmCfg.OverrideConfig()})
+	}
+
 	if err = procCfg.AddVolumes(volumes, boshEnv, bpmCfg.DefaultVolumes()); err != nil {
 		logger.Error("invalid-volume-definition", err)
 		return err
@@ -92,11 +99,13 @@ func run(cmd *cobra.Command, _ []string) error {
 		return err
 	}
 
+	logRedactor.Add(procCfg.SensitiveValues()...)
+
 	runcLifecycle, err := newRuncLifecycle()
 	if err != nil {
 		return err
 	}
-	process, err := runcLifecycle.StatProcess(bpmCfg)
+	process, err := runcLifecycle.StatProcess(ctx, bpmCfg)
 	if err != nil && !lifecycle.IsNotExist(err) {
 		logger.Error("failed-getting-job", err)
 
@@ -114,21 +123,27 @@ func run(cmd *cobra.Command, _ []string) error {
 	switch state {
 	case models.ProcessStateRunning:
 		logger.Info("process-already-running")
+		recordStatus(state, process.Pid, nil)
 		return nil
-	case models.ProcessStateFailed:
+	case models.ProcessStateFailed, models.ProcessStateExited, models.ProcessStatePreserved:
 		logger.Info("removing-stopped-process")
-		if err := runcLifecycle.RemoveProcess(logger, bpmCfg); err != nil {
+		if err := removeProcess(logger, runcLifecycle, bpmCfg); err != nil {
 			logger.Error("failed-to-cleanup", err)
 			return fmt.Errorf("failed to clean up stale job-process: %s", err)
 		}
 		fallthrough
 	default:
-		if status, err := runcLifecycle.RunProcess(logger, bpmCfg, procCfg); err != nil {
+		if status, err := runcLifecycle.RunProcess(ctx, logger, bpmCfg, procCfg); err != nil {
+			if phase := lifecycle.StartPhase(err); phase != "" {
+				logger.Error("failed-to-start", err, lager.Data{"phase": phase})
+			}
+			recordStatus(models.ProcessStateFailed, 0, err)
 			return &exitstatus.Error{
 				Status: status,
-				Err:    fmt.Errorf("failed to run job-process: %s", err),
+				Err:    startFailure("run", err),
 			}
 		}
+		recordStatus(models.ProcessStateStopped, 0, nil)
 	}
 
 	return nil
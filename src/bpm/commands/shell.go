@@ -22,18 +22,20 @@ import (
 
 	"github.com/spf13/cobra"
 
-	"bpm/models"
 	"bpm/runc/lifecycle"
 )
 
+var cleanEnv bool
+
 func init() {
 	shellCommand.Flags().StringVarP(&procName, "process", "p", "", "optional process name")
+	shellCommand.Flags().BoolVar(&cleanEnv, "clean-env", false, "do not inherit the environment of the process")
 	RootCmd.AddCommand(shellCommand)
 }
 
 var shellCommand = &cobra.Command{
 	RunE:    shell,
-	Short:   "start a shell inside the process container",
+	Short:   "start a shell (bash, sh, or busybox sh) inside the process container",
 	Use:     "shell <job-name>",
 	PreRunE: shellPre,
 }
@@ -50,12 +52,19 @@ func shell(cmd *cobra.Command, _ []string) error {
 		return err
 	}
 
-	process, err := runcLifecycle.StatProcess(bpmCfg)
+	// The container of a quarantined process is frozen, so anything run
+	// in it would hang.
+	if err := refuseQuarantined(bpmCfg); err != nil {
+		return err
+	}
+
+	process, err := runcLifecycle.StatProcess(ctx, bpmCfg)
 	if err != nil && !lifecycle.IsNotExist(err) {
 		return fmt.Errorf("failed to get job: %s", err)
-	} else if lifecycle.IsNotExist(err) || process.Status == models.ProcessStateFailed {
+	} else if lifecycle.IsNotExist(err) || process.HasExited() {
 		return errors.New("process is not running or could not be found")
 	}
 
-	return runcLifecycle.OpenShell(bpmCfg, os.Stdin, cmd.OutOrStdout(), cmd.OutOrStderr())
+	opts := lifecycle.ExecOptions{CleanEnv: cleanEnv}
+	return runcLifecycle.OpenShell(ctx, bpmCfg, opts, os.Stdin, cmd.OutOrStdout(), cmd.OutOrStderr())
 }
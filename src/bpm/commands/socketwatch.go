@@ -0,0 +1,126 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package commands
+
+import (
+	"time"
+
+	"code.cloudfoundry.org/lager"
+	"github.com/spf13/cobra"
+
+	"bpm/runc/lifecycle"
+	"bpm/sockets"
+	"bpm/usertools"
+)
+
+// socketWatchInterval is how often the socket-watch helper looks for the
+// sockets of the process.
+const socketWatchInterval = time.Second
+
+func init() {
+	socketWatchCommand.Flags().StringVarP(&procName, "process", "p", "", "optional process name")
+	RootCmd.AddCommand(socketWatchCommand)
+}
+
+// socketWatchCommand is started by bpm itself after starting a process which
+// has sockets configured. It gives each socket its configured ownership and
+// permissions whenever the process creates it, until the process stops.
+var socketWatchCommand = &cobra.Command{
+	Hidden:  true,
+	RunE:    socketWatch,
+	Short:   "applies the ownership and permissions of a process's sockets",
+	Use:     "socket-watch <job-name>",
+	PreRunE: socketWatchPre,
+}
+
+func socketWatchPre(cmd *cobra.Command, args []string) error {
+	if err := validateInput(args); err != nil {
+		return err
+	}
+
+	cmd.SilenceUsage = true
+
+	return setupBpmLogs("socket-watch")
+}
+
+func socketWatch(cmd *cobra.Command, _ []string) error {
+	logger.Info("starting")
+	defer logger.Info("complete")
+
+	jobCfg, err := bpmCfg.ParseJobConfig()
+	if err != nil {
+		logger.Error("failed-to-parse-config", err)
+		return err
+	}
+
+	procCfg, err := processByNameFromJobConfig(jobCfg, procName)
+	if err != nil {
+		logger.Error("process-not-defined", err)
+		return err
+	}
+
+	if len(procCfg.Sockets) == 0 {
+		return nil
+	}
+
+	user, err := userFinder.Lookup(usertools.VcapUser)
+	if err != nil {
+		logger.Error("failed-to-find-user", err)
+		return err
+	}
+
+	socks, err := sockets.Resolve(bpmCfg, procCfg.Sockets, user)
+	if err != nil {
+		logger.Error("failed-to-resolve-sockets", err)
+		return err
+	}
+
+	runcLifecycle, err := newRuncLifecycle()
+	if err != nil {
+		return err
+	}
+
+	watcher := sockets.NewWatcher(socks)
+	for {
+		process, err := runcLifecycle.StatProcess(ctx, bpmCfg)
+		if lifecycle.IsNotExist(err) {
+			return nil
+		} else if err != nil {
+			logger.Error("failed-to-get-job", err)
+			return err
+		}
+
+		if process.HasExited() {
+			return nil
+		}
+
+		// A socket which cannot be changed is reported but does not stop
+		// the others from being watched.
+		changed, err := watcher.Check()
+		for _, path := range changed {
+			logger.Info("applied-socket-permissions", lager.Data{"path": path})
+		}
+		if err != nil {
+			logger.Error("failed-to-apply-socket-permissions", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(socketWatchInterval):
+		}
+	}
+}
@@ -16,16 +16,41 @@
 package commands
 
 import (
+	"context"
 	"fmt"
+	"os"
+	"path/filepath"
+	"time"
 
+	"code.cloudfoundry.org/lager"
 	"github.com/spf13/cobra"
 
+	"bpm/config"
+	"bpm/coredump"
+	"bpm/diskspace"
+	"bpm/hostlock"
+	"bpm/memorypressure"
+	"bpm/metrics"
 	"bpm/models"
+	"bpm/registration"
 	"bpm/runc/lifecycle"
+	"bpm/sockets"
+)
+
+// DefaultPrerequisiteTimeout is how long a process waits for the processes
+// listed in its after setting to start.
+const DefaultPrerequisiteTimeout = 20 * time.Second
+
+var (
+	startWaitForLock bool
+	startReuseBundle bool
 )
 
 func init() {
 	startCommand.Flags().StringVarP(&procName, "process", "p", "", "optional process name")
+	startCommand.Flags().BoolVar(&startWaitForLock, "wait-for-lock", false, "hold the lock of each volume with lock set until the process has started")
+	startCommand.Flags().BoolVar(&startReuseBundle, "reuse-bundle", false, "start a stopped process from its existing bundle if its configuration has not changed")
+	addOutputFlag(startCommand)
 	RootCmd.AddCommand(startCommand)
 }
 
@@ -43,6 +68,7 @@ func startPre(cmd *cobra.Command, args []string) error {
 	}
 
 	cmd.SilenceUsage = true
+	startCommandSpan(cmd)
 
 	if err := setupBpmLogs("start"); err != nil {
 		return err
@@ -62,25 +88,61 @@ func start(cmd *cobra.Command, _ []string) error {
 	jobCfg, err := bpmCfg.ParseJobConfig()
 	if err != nil {
 		logger.Error("failed-to-parse-config", err)
-		return fmt.Errorf("failed to parse job configuration: %s", err)
+		return configError(fmt.Errorf("failed to parse job configuration: %s", err))
+	}
+
+	if instances := jobCfg.Instances(procName); len(instances) > 0 {
+		return startInstances(cmd, instances)
 	}
 
 	procCfg, err := processByNameFromJobConfig(jobCfg, procName)
 	if err != nil {
 		logger.Error("process-not-defined", err)
-		return fmt.Errorf("process %q not present in job configuration (%s)", procName, bpmCfg.JobConfig())
+		return configError(fmt.Errorf("process %q not present in job configuration (%s)", procName, bpmCfg.JobConfig()))
+	}
+
+	warnDeprecations(cmd, procCfg.Deprecations())
+
+	if procCfg.CoreDumps != nil && !coredump.Installed(coredump.PatternFile) {
+		logger.Info("core-dump-handler-not-installed")
+	}
+
+	if procCfg.Overridden {
+		logger.Info("using-local-override", lager.Data{"path": bpmCfg.OverrideConfig()})
 	}
 
+	logRedactor.Add(procCfg.SensitiveValues()...)
+
 	runcLifecycle, err := newRuncLifecycle()
 	if err != nil {
 		return err
 	}
-	process, err := runcLifecycle.StatProcess(bpmCfg)
+
+	if adopted, err := runcLifecycle.StatAdoptedProcess(bpmCfg); err == nil {
+		if adopted.Status == models.ProcessStateAdopted {
+			logger.Info("adopted-process-already-running")
+			recordStatus(adopted.Status, adopted.Pid, nil)
+			return nil
+		}
+
+		if err := runcLifecycle.ForgetAdoptedProcess(logger, bpmCfg); err != nil {
+			logger.Error("failed-to-forget-adopted-process", err)
+			return fmt.Errorf("failed to clean up adopted process: %s", err)
+		}
+	}
+
+	if err := refuseQuarantined(bpmCfg); err != nil {
+		logger.Error("refusing-to-start", err)
+		return err
+	}
+
+	process, err := runcLifecycle.StatProcess(ctx, bpmCfg)
 	if err != nil && !lifecycle.IsNotExist(err) {
 		logger.Error("failed-getting-job", err)
 
 		if cerr := forceCleanupBrokenRuncState(logger, runcLifecycle); cerr != nil {
 			logger.Error("failed-cleaning-up-broken-job", cerr)
+			recordMetrics(logger, bpmCfg, countCleanupFailure)
 			return cerr
 		}
 	}
@@ -93,20 +155,235 @@ func start(cmd *cobra.Command, _ []string) error {
 	switch state {
 	case models.ProcessStateRunning:
 		logger.Info("process-already-running")
+		recordStatus(state, process.Pid, nil)
 		return nil
-	case models.ProcessStateFailed:
-		logger.Info("removing-stopped-process")
-		if err := runcLifecycle.RemoveProcess(logger, bpmCfg); err != nil {
+	case models.ProcessStateFailed, models.ProcessStateExited, models.ProcessStatePreserved:
+		// The termination log is emptied when the process is started
+		// again so its message is kept in the bpm log.
+		data := lager.Data{"status": state}
+		if process.ExitStatus != nil {
+			data["exit_status"] = *process.ExitStatus
+		}
+		if process.TerminationMessage != "" {
+			data["termination_message"] = process.TerminationMessage
+		}
+
+		if startReuseBundle && runcLifecycle.CanReuseBundle(bpmCfg, procCfg) {
+			logger.Info("reviving-stopped-process", data)
+			return launchProcess(runcLifecycle, procCfg, runcLifecycle.ReviveProcess)
+		}
+
+		logger.Info("removing-stopped-process", data)
+		if err := removeProcess(logger, runcLifecycle, bpmCfg); err != nil {
 			logger.Error("failed-to-cleanup", err)
+			recordMetrics(logger, bpmCfg, countCleanupFailure)
 			return fmt.Errorf("failed to clean up stale job-process: %s", err)
 		}
 		fallthrough
 	default:
-		if err := runcLifecycle.StartProcess(logger, bpmCfg, procCfg); err != nil {
-			logger.Error("failed-to-start", err)
+		if err := waitForPrerequisites(runcLifecycle, procCfg); err != nil {
+			logger.Error("failed-waiting-for-prerequisites", err)
+			recordStatus(models.ProcessStateFailed, 0, err)
 			return fmt.Errorf("failed to start job-process: %s", err)
 		}
+
+		return launchProcess(runcLifecycle, procCfg, runcLifecycle.StartProcess)
+	}
+}
+
+// startInstances starts each instance of a process with instances, exactly
+// as if `bpm start` had been run for it on its own. Instances which are
+// already running are left alone and a failure to start one does not stop
+// the rest from being started.
+func startInstances(cmd *cobra.Command, instances []*config.ProcessConfig) error {
+	failed := 0
+	for _, instance := range instances {
+		args := []string{"start", bpmCfg.JobName(), "-p", instance.Name}
+		if startWaitForLock {
+			args = append(args, "--wait-for-lock")
+		}
+		if startReuseBundle {
+			args = append(args, "--reuse-bundle")
+		}
+
+		if err := runBPM(args...); err != nil {
+			logger.Error("failed-to-start-instance", err, lager.Data{"instance": instance.Name})
+			fmt.Fprintf(cmd.ErrOrStderr(), "failed to start %s: %s\n", instance.Name, err)
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("failed to start %d of %d instance(s) of %s", failed, len(instances), procName)
 	}
 
 	return nil
 }
+
+// launchFunc starts the container of a process.
+type launchFunc func(context.Context, lager.Logger, *config.BPMConfig, *config.ProcessConfig) error
+
+// launchProcess checks the free disk space and takes the volume locks of the
+// process before starting it with launch, and records the outcome.
+func launchProcess(runcLifecycle *lifecycle.RuncLifecycle, procCfg *config.ProcessConfig, launch launchFunc) error {
+	if err := checkDiskSpace(procCfg); err != nil {
+		logger.Error("insufficient-disk-space", err)
+		recordStatus(models.ProcessStateFailed, 0, err)
+		return fmt.Errorf("failed to start job-process: %w", err)
+	}
+
+	volumeLocks, err := lockVolumes(procCfg)
+	if err != nil {
+		logger.Error("failed-to-lock-volumes", err)
+		recordStatus(models.ProcessStateFailed, 0, err)
+		return fmt.Errorf("failed to start job-process: %s", err)
+	}
+	defer unlockVolumes(volumeLocks)
+
+	startStart := time.Now()
+	if err := launch(ctx, logger, bpmCfg, procCfg); err != nil {
+		logger.Error("failed-to-start", err, lager.Data{"phase": lifecycle.StartPhase(err)})
+		recordStatus(models.ProcessStateFailed, 0, err)
+		recordMetrics(logger, bpmCfg, func(m *metrics.Metrics) { m.StartFailures++ })
+		return startFailure("start", err)
+	}
+	took := time.Since(startStart)
+	recordMetrics(logger, bpmCfg, func(m *metrics.Metrics) { m.Start.Observe(took) })
+	recordStartedStatus(runcLifecycle)
+
+	if procCfg.Network != nil {
+		limitEgress(logger, bpmCfg, procCfg)
+	}
+
+	if procCfg.Register != nil {
+		if err := registration.Start(bpmCfg); err != nil {
+			logger.Error("failed-to-start-registration", err)
+		}
+	}
+
+	if procCfg.MemoryPressure != nil {
+		if err := memorypressure.Start(bpmCfg); err != nil {
+			logger.Error("failed-to-start-memory-watch", err)
+		}
+	}
+
+	if len(procCfg.Sockets) > 0 {
+		if err := sockets.Start(bpmCfg); err != nil {
+			logger.Error("failed-to-start-socket-watch", err)
+		}
+	}
+
+	return nil
+}
+
+// startFailure describes a process which could not be started, naming the
+// phase of the start which failed when it is known so that a problem with the
+// job's configuration can be told apart from one with the host or runc. When
+// runc's own log of the failure was kept it points the operator at it.
+func startFailure(verb string, err error) error {
+	if log := lifecycle.StartFailureLog(err); log != "" {
+		err = fmt.Errorf("%w (see %s)", err, log)
+	}
+
+	if phase := lifecycle.StartPhase(err); phase != "" {
+		return fmt.Errorf("failed to %s job-process during %s: %w", verb, phase, err)
+	}
+
+	return fmt.Errorf("failed to %s job-process: %w", verb, err)
+}
+
+// waitForPrerequisites blocks until the processes which the process must
+// start after are running.
+func waitForPrerequisites(runcLifecycle *lifecycle.RuncLifecycle, procCfg *config.ProcessConfig) error {
+	prerequisites, err := procCfg.Prerequisites(boshEnv)
+	if err != nil {
+		return err
+	}
+
+	if len(prerequisites) == 0 {
+		return nil
+	}
+
+	return runcLifecycle.WaitForProcesses(ctx, logger, prerequisites, DefaultPrerequisiteTimeout)
+}
+
+// checkDiskSpace checks that the filesystems which the process's bundle, logs,
+// and data are written to have the free space which the operator asked for.
+func checkDiskSpace(procCfg *config.ProcessConfig) error {
+	hostCfg, err := config.ParseHostConfig(config.HostConfigPath(boshEnv))
+	if err != nil {
+		return fmt.Errorf("failed to read host configuration: %s", err)
+	}
+
+	if hostCfg.MinFreeSpace == nil {
+		return nil
+	}
+
+	data, log, store, err := hostCfg.MinFreeSpace.Bytes()
+	if err != nil {
+		return err
+	}
+
+	requirements := []diskspace.Requirement{
+		{Path: filepath.Dir(bpmCfg.DataDir().External()), MinFree: data},
+		{Path: filepath.Dir(bpmCfg.LogDir().External()), MinFree: log},
+	}
+	if procCfg.PersistentDisk {
+		requirements = append(requirements, diskspace.Requirement{Path: filepath.Dir(bpmCfg.StoreDir().External()), MinFree: store})
+	}
+
+	return diskspace.Check(requirements)
+}
+
+// lockVolumes takes the lock of each of the process's volumes which has one
+// when bpm has been asked to wait for them. They are held until the process
+// has started, including its pre_start hook, so that only one process at a
+// time initializes the volumes it shares with others.
+func lockVolumes(procCfg *config.ProcessConfig) ([]hostlock.LockedLock, error) {
+	if !startWaitForLock {
+		return nil, nil
+	}
+
+	var held []hostlock.LockedLock
+	for _, path := range procCfg.LockVolumes(bpmCfg) {
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			unlockVolumes(held)
+			return nil, err
+		}
+
+		logger.Info("locking-volume", lager.Data{"path": path})
+		lock, err := locks.LockFile(path)
+		if err != nil {
+			unlockVolumes(held)
+			return nil, err
+		}
+		held = append(held, lock)
+	}
+
+	return held, nil
+}
+
+func unlockVolumes(held []hostlock.LockedLock) {
+	for _, lock := range held {
+		if err := lock.Unlock(); err != nil {
+			logger.Error("failed-to-unlock-volume", err)
+		}
+	}
+}
+
+// recordStartedStatus checks that a process which has just been started is
+// running and records the result in its status file.
+func recordStartedStatus(runcLifecycle *lifecycle.RuncLifecycle) {
+	process, err := runcLifecycle.StatProcess(ctx, bpmCfg)
+	if err != nil {
+		recordStatus(models.ProcessStateFailed, 0, err)
+		return
+	}
+
+	if process.Status != models.ProcessStateRunning {
+		recordStatus(process.Status, process.Pid, fmt.Errorf("process is %s after starting", process.Status))
+		return
+	}
+
+	recordStatus(process.Status, process.Pid, nil)
+}
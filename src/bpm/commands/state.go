@@ -0,0 +1,118 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package commands
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"bpm/metrics"
+	"bpm/models"
+	"bpm/runc/lifecycle"
+)
+
+var (
+	stateFormat   string
+	stateInternal bool
+)
+
+func init() {
+	stateCommand.Flags().StringVarP(&procName, "process", "p", "", "optional process name")
+	stateCommand.Flags().StringVarP(&stateFormat, "format", "o", "table", "output format (table, wide, or json)")
+	stateCommand.Flags().BoolVar(&stateInternal, "internal", false, "include metrics of bpm's own operations on the process")
+	RootCmd.AddCommand(stateCommand)
+}
+
+var stateCommand = &cobra.Command{
+	RunE:    stateForJob,
+	Short:   "displays the state of a given job",
+	Use:     "state <job-name>",
+	PreRunE: statePre,
+}
+
+func statePre(cmd *cobra.Command, args []string) error {
+	return validateInput(args)
+}
+
+func stateForJob(cmd *cobra.Command, _ []string) error {
+	printJobs, err := jobPrinter(stateFormat)
+	if err != nil {
+		return err
+	}
+
+	cmd.SilenceUsage = true
+
+	runcLifecycle, err := newRuncLifecycle()
+	if err != nil {
+		return err
+	}
+
+	process, err := runcLifecycle.StatProcess(ctx, bpmCfg)
+	if err == nil {
+		process.BundlePath = bpmCfg.BundlePath()
+	} else if lifecycle.IsNotExist(err) {
+		process, err = runcLifecycle.StatAdoptedProcess(bpmCfg)
+	}
+	if lifecycle.IsNotExist(err) {
+		process = &models.Process{
+			Name:       bpmCfg.ContainerID(),
+			Status:     models.ProcessStateStopped,
+			BundlePath: bpmCfg.BundlePath(),
+		}
+	} else if err != nil {
+		return fmt.Errorf("failed to get job: %s", err)
+	}
+	process.ConfigPath = bpmCfg.JobConfig()
+
+	if process.Status == models.ProcessStateRunning {
+		process.Ports, err = checkPorts(runcLifecycle)
+		if err != nil {
+			return fmt.Errorf("failed to check ports: %s", err)
+		}
+	}
+
+	if stateInternal {
+		process.Internal, err = metrics.Read(bpmCfg.MetricsFile())
+		if err != nil {
+			return fmt.Errorf("failed to read metrics: %s", err)
+		}
+	}
+
+	return printJobs([]*models.Process{process}, cmd.OutOrStdout())
+}
+
+// checkPorts checks the ports which the process is configured to listen on.
+// A process whose configuration cannot be read has no ports to check so that
+// its state can still be shown.
+func checkPorts(runcLifecycle *lifecycle.RuncLifecycle) ([]models.PortCheck, error) {
+	jobCfg, err := bpmCfg.ParseJobConfig()
+	if err != nil {
+		return nil, nil
+	}
+
+	procCfg, err := processByNameFromJobConfig(jobCfg, procName)
+	if err != nil || len(procCfg.Ports) == 0 {
+		return nil, nil
+	}
+
+	checks, err := runcLifecycle.CheckPorts(ctx, bpmCfg, procCfg.Ports)
+	if lifecycle.IsNotExist(err) {
+		return nil, nil
+	}
+
+	return checks, err
+}
@@ -0,0 +1,72 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package commands
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"bpm/presenters"
+	"bpm/runc/lifecycle"
+)
+
+var statsFormat string
+
+func init() {
+	statsCommand.Flags().StringVarP(&procName, "process", "p", "", "optional process name")
+	statsCommand.Flags().StringVarP(&statsFormat, "format", "o", "table", "output format (table or json)")
+	RootCmd.AddCommand(statsCommand)
+}
+
+var statsCommand = &cobra.Command{
+	RunE:    statsForJob,
+	Short:   "displays the resource usage of a given job",
+	Use:     "stats <job-name>",
+	PreRunE: statsPre,
+}
+
+func statsPre(cmd *cobra.Command, args []string) error {
+	return validateInput(args)
+}
+
+func statsForJob(cmd *cobra.Command, _ []string) error {
+	printStats := presenters.PrintStats
+	switch statsFormat {
+	case "table":
+	case "json":
+		printStats = presenters.PrintStatsJSON
+	default:
+		return fmt.Errorf("invalid format: %s", statsFormat)
+	}
+
+	cmd.SilenceUsage = true
+
+	runcLifecycle, err := newRuncLifecycle()
+	if err != nil {
+		return err
+	}
+
+	stats, err := runcLifecycle.ProcessStats(ctx, bpmCfg)
+	if lifecycle.IsNotExist(err) {
+		return errors.New("process is not running or could not be found")
+	} else if err != nil {
+		return fmt.Errorf("failed to get stats: %s", err)
+	}
+
+	return printStats(procName, stats, cmd.OutOrStdout())
+}
@@ -16,18 +16,39 @@
 package commands
 
 import (
+	"errors"
 	"fmt"
+	"os"
+	"sync"
 	"time"
 
+	"code.cloudfoundry.org/lager"
 	"github.com/spf13/cobra"
 
+	"bpm/config"
+	"bpm/metrics"
+	"bpm/models"
+	"bpm/runc/client"
 	"bpm/runc/lifecycle"
+	"bpm/units"
 )
 
 const DefaultStopTimeout = 15 * time.Second
 
+var (
+	stopAll      bool
+	stopParallel int
+	stopNoDelete bool
+	stopTimeout  time.Duration
+)
+
 func init() {
 	stopCommand.Flags().StringVarP(&procName, "process", "p", "", "optional process name")
+	stopCommand.Flags().BoolVar(&stopAll, "all", false, "stop every process on the host")
+	stopCommand.Flags().IntVar(&stopParallel, "parallel", 1, "the number of processes to stop at once when stopping all of them")
+	stopCommand.Flags().BoolVar(&stopNoDelete, "no-delete", false, "keep the container, bundle, and cgroup of the stopped process for inspection")
+	stopCommand.Flags().Var(units.DurationFlag(&stopTimeout, DefaultStopTimeout), "timeout", "how long to wait for the process to exit before killing it")
+	addOutputFlag(stopCommand)
 	RootCmd.AddCommand(stopCommand)
 }
 
@@ -40,11 +61,25 @@ var stopCommand = &cobra.Command{
 }
 
 func stopPre(cmd *cobra.Command, args []string) error {
+	if stopAll {
+		if len(args) > 0 || procName != "" {
+			return errors.New("cannot specify a job or process when stopping all of them")
+		}
+		if stopParallel < 1 {
+			return errors.New("--parallel must be at least 1")
+		}
+
+		cmd.SilenceUsage = true
+		startCommandSpan(cmd)
+		return nil
+	}
+
 	if err := validateInput(args); err != nil {
 		return err
 	}
 
 	cmd.SilenceUsage = true
+	startCommandSpan(cmd)
 
 	if err := setupBpmLogs("stop"); err != nil {
 		return err
@@ -54,10 +89,18 @@ func stopPre(cmd *cobra.Command, args []string) error {
 }
 
 func stopPost(cmd *cobra.Command, args []string) error {
+	if stopAll {
+		return nil
+	}
+
 	return releaseLifecycleLock()
 }
 
 func stop(cmd *cobra.Command, _ []string) error {
+	if stopAll {
+		return stopAllProcesses(cmd)
+	}
+
 	logger.Info("starting")
 	defer logger.Info("complete")
 
@@ -66,22 +109,262 @@ func stop(cmd *cobra.Command, _ []string) error {
 		return err
 	}
 
-	if _, err := runcLifecycle.StatProcess(bpmCfg); lifecycle.IsNotExist(err) {
+	if instances := configuredInstances(); len(instances) > 0 {
+		return stopInstances(cmd, runcLifecycle, instances)
+	}
+
+	return stopProcess(logger, runcLifecycle, bpmCfg)
+}
+
+// configuredInstances returns the instances of the process being stopped if
+// it is a process with instances. A job whose configuration cannot be read is
+// treated as not having any, so that its processes can still be stopped one
+// at a time.
+func configuredInstances() []*config.ProcessConfig {
+	jobCfg, err := bpmCfg.ParseJobConfig()
+	if err != nil {
+		return nil
+	}
+
+	return jobCfg.Instances(procName)
+}
+
+// stopInstances stops each instance of a process with instances in turn,
+// taking the lock of each one as `bpm stop` would.
+func stopInstances(cmd *cobra.Command, runcLifecycle *lifecycle.RuncLifecycle, instances []*config.ProcessConfig) error {
+	failed := 0
+	for _, instance := range instances {
+		cfg := config.NewBPMConfig(boshEnv, bpmCfg.JobName(), instance.Name)
+		if err := stopLockedProcess(runcLifecycle, cfg); err != nil {
+			fmt.Fprintf(cmd.ErrOrStderr(), "failed to stop %s: %s\n", qualifiedName(cfg), err)
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("failed to stop %d of %d instance(s) of %s", failed, len(instances), procName)
+	}
+
+	return nil
+}
+
+// stopAllProcesses stops every process which is configured on the host,
+// stopParallel at a time. Each process is stopped exactly as if `bpm stop`
+// had been run for it, including taking its lock and logging to its job's
+// bpm.log. Processes are stopped before the processes they were started
+// after.
+func stopAllProcesses(cmd *cobra.Command) error {
+	runcLifecycle, err := newRuncLifecycle()
+	if err != nil {
+		return err
+	}
+
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		failed int
+	)
+
+	cfgs, prerequisites := configuredProcesses(cmd)
+	waves := config.StartOrder(prerequisites)
+
+	slots := make(chan struct{}, stopParallel)
+	for i := len(waves) - 1; i >= 0; i-- {
+		for _, name := range waves[i] {
+			slots <- struct{}{}
+			wg.Add(1)
+
+			go func(cfg *config.BPMConfig) {
+				defer wg.Done()
+				defer func() { <-slots }()
+
+				if err := stopLockedProcess(runcLifecycle, cfg); err != nil {
+					mu.Lock()
+					defer mu.Unlock()
+
+					failed++
+					fmt.Fprintf(cmd.ErrOrStderr(), "failed to stop %s: %s\n", qualifiedName(cfg), err)
+				}
+			}(cfgs[name])
+		}
+		wg.Wait()
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("failed to stop %d process(es)", failed)
+	}
+
+	return nil
+}
+
+// configuredProcesses returns the configuration of every process on the
+// host, keyed by JOB/PROCESS, along with the processes each one starts
+// after. Jobs with configuration which cannot be read are reported and
+// skipped.
+func configuredProcesses(cmd *cobra.Command) (map[string]*config.BPMConfig, map[string][]string) {
+	cfgs := map[string]*config.BPMConfig{}
+	prerequisites := map[string][]string{}
+
+	for _, job := range boshEnv.JobNames() {
+		jobCfg, err := config.NewBPMConfig(boshEnv, job, "").ParseJobConfig()
+		if os.IsNotExist(err) {
+			continue
+		}
+
+		if err != nil {
+			fmt.Fprintf(cmd.ErrOrStderr(), "invalid config for %s: %s\n", job, err)
+			continue
+		}
+
+		for _, process := range jobCfg.Processes {
+			cfg := config.NewBPMConfig(boshEnv, job, process.Name)
+			name := qualifiedName(cfg)
+			cfgs[name] = cfg
+			prerequisites[name] = nil
+
+			after, err := process.Prerequisites(boshEnv)
+			if err != nil {
+				fmt.Fprintf(cmd.ErrOrStderr(), "invalid after for %s: %s\n", name, err)
+				continue
+			}
+
+			for _, prerequisite := range after {
+				prerequisites[name] = append(prerequisites[name], qualifiedName(prerequisite))
+			}
+		}
+	}
+
+	return cfgs, prerequisites
+}
+
+func qualifiedName(cfg *config.BPMConfig) string {
+	return cfg.JobName() + "/" + cfg.ProcName()
+}
+
+func stopLockedProcess(runcLifecycle *lifecycle.RuncLifecycle, cfg *config.BPMConfig) error {
+	logger, _, err := newJobLogger(cfg, "stop")
+	if err != nil {
+		return err
+	}
+
+	logger.Info("starting")
+	defer logger.Info("complete")
+
+	lock, err := lockJob(logger, cfg)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	return stopProcess(logger, runcLifecycle, cfg)
+}
+
+func stopProcess(logger lager.Logger, runcLifecycle *lifecycle.RuncLifecycle, cfg *config.BPMConfig) error {
+	stopStart := time.Now()
+	defer func() {
+		took := time.Since(stopStart)
+		recordMetrics(logger, cfg, func(m *metrics.Metrics) { m.Stop.Observe(took) })
+	}()
+
+	if _, err := runcLifecycle.StatAdoptedProcess(cfg); err == nil {
+		err := runcLifecycle.StopAdoptedProcess(ctx, logger, cfg, stopTimeout)
+		if err != nil && ctx.Err() != nil {
+			recordStatusFor(logger, cfg, models.ProcessStateStopped, 0, nil)
+			return interruptedStop(logger)
+		} else if err != nil {
+			logger.Error("failed-to-stop-adopted-process", err)
+			recordStatusFor(logger, cfg, models.ProcessStateFailed, 0, err)
+			return fmt.Errorf("failed to stop adopted process: %s", err)
+		}
+		recordStatusFor(logger, cfg, models.ProcessStateStopped, 0, nil)
+		return nil
+	}
+
+	// A quarantined process is kept frozen for investigation. Stopping it
+	// would throw its state away.
+	if err := refuseQuarantined(cfg); err != nil {
+		logger.Error("refusing-to-stop", err)
+		return err
+	}
+
+	process, err := runcLifecycle.StatProcess(ctx, cfg)
+	if lifecycle.IsNotExist(err) {
 		logger.Info("job-already-stopped")
+		recordStatusFor(logger, cfg, models.ProcessStateStopped, 0, nil)
 		return nil
 	} else if err != nil {
 		logger.Error("failed-to-get-job", err)
 		return fmt.Errorf("failed to get job-process status: %s", err)
 	}
 
-	if err := runcLifecycle.StopProcess(logger, bpmCfg, DefaultStopTimeout); err != nil {
-		logger.Error("failed-to-stop", err)
+	if stopNoDelete && process.Status == models.ProcessStatePreserved {
+		logger.Info("job-already-preserved")
+		return nil
+	}
+
+	if process.Status == models.ProcessStateRunning {
+		deregister(logger, cfg, process)
 	}
 
-	if err := runcLifecycle.RemoveProcess(logger, bpmCfg); err != nil {
+	stopErr := runcLifecycle.StopProcess(ctx, logger, cfg, stopTimeout)
+	if stopErr != nil {
+		logger.Error("failed-to-stop", stopErr)
+		if lifecycle.IsStopTimeout(stopErr) {
+			recordMetrics(logger, cfg, func(m *metrics.Metrics) { m.StopTimeouts++ })
+		}
+	}
+
+	if stopNoDelete {
+		return preserveProcess(logger, runcLifecycle, cfg, stopErr)
+	}
+
+	// The container is removed even if bpm was interrupted while waiting
+	// for the process to stop so that nothing is left half stopped.
+	if err := removeProcess(logger, runcLifecycle, cfg); err != nil {
 		logger.Error("failed-to-cleanup", err)
+		recordMetrics(logger, cfg, countCleanupFailure)
+		recordStatusFor(logger, cfg, models.ProcessStateFailed, 0, err)
 		return fmt.Errorf("failed to cleanup job-process: %s", err)
 	}
 
+	recordStatusFor(logger, cfg, models.ProcessStateStopped, 0, nil)
+	if ctx.Err() != nil {
+		return interruptedStop(logger)
+	}
+
 	return nil
 }
+
+// preserveProcess keeps the container of a process which has been stopped,
+// along with its bundle and cgroup, so that they can be inspected. A process
+// which did not stop in time is killed rather than being left running. The
+// container is removed by `bpm delete` or the next `bpm start`.
+func preserveProcess(logger lager.Logger, runcLifecycle *lifecycle.RuncLifecycle, cfg *config.BPMConfig, stopErr error) error {
+	if lifecycle.IsStopTimeout(stopErr) {
+		if err := runcLifecycle.SignalProcess(ctx, logger, cfg, client.Kill); err != nil {
+			logger.Error("failed-to-sigkill", err)
+		}
+	}
+
+	if err := runcLifecycle.PreserveProcess(logger, cfg); err != nil {
+		logger.Error("failed-to-preserve", err)
+		recordStatusFor(logger, cfg, models.ProcessStateFailed, 0, err)
+		return fmt.Errorf("failed to preserve job-process: %s", err)
+	}
+
+	unlimitEgress(logger, cfg)
+
+	recordStatusFor(logger, cfg, models.ProcessStatePreserved, 0, nil)
+	if ctx.Err() != nil {
+		return interruptedStop(logger)
+	}
+
+	return nil
+}
+
+// interruptedStop reports a stop which was interrupted. The process has been
+// killed rather than being given the chance to exit by itself.
+func interruptedStop(logger lager.Logger) error {
+	logger.Info("stop-interrupted")
+	return errors.New("interrupted while stopping: the process was killed")
+}
@@ -0,0 +1,74 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package commands
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"bpm/config"
+	"bpm/tracing"
+)
+
+var (
+	tracer      *tracing.Tracer
+	commandSpan *tracing.Span
+)
+
+// startCommandSpan starts a span covering the whole of cmd when the operator has
+// configured a collector. The span replaces ctx so that the operations which
+// the command performs are recorded as its children.
+func startCommandSpan(cmd *cobra.Command) {
+	hostCfg, err := config.ParseHostConfig(config.HostConfigPath(boshEnv))
+	if err != nil || !hostCfg.TracingEnabled() {
+		return
+	}
+
+	hostname, _ := os.Hostname()
+	tracer = tracing.NewTracer(hostCfg.Tracing.OTLPEndpoint, hostCfg.Tracing.Headers, map[string]string{
+		"service.name":    "bpm",
+		"service.version": Version,
+		"host.name":       hostname,
+	})
+
+	ctx, commandSpan = tracing.Start(tracing.WithTracer(ctx, tracer), cmd.CommandPath())
+	if bpmCfg != nil {
+		commandSpan.SetAttribute("bpm.job", bpmCfg.JobName())
+		commandSpan.SetAttribute("bpm.process", bpmCfg.ProcName())
+	}
+}
+
+// FinishTracing ends the span of the command with its result and exports the
+// trace. Failing to export the trace is reported on stderr but does not change
+// the outcome of the command.
+func FinishTracing(err error, stderr io.Writer) {
+	if tracer == nil {
+		return
+	}
+
+	commandSpan.End(err)
+
+	flushCtx, cancel := context.WithTimeout(context.Background(), tracing.ExportTimeout)
+	defer cancel()
+
+	if ferr := tracer.Flush(flushCtx); ferr != nil {
+		fmt.Fprintf(stderr, "failed to export traces: %s\n", ferr)
+	}
+}
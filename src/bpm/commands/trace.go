@@ -24,7 +24,6 @@ import (
 
 	"github.com/spf13/cobra"
 
-	"bpm/models"
 	"bpm/runc/lifecycle"
 )
 
@@ -64,10 +63,16 @@ func trace(cmd *cobra.Command, _ []string) error {
 		return err
 	}
 
-	process, err := runcLifecycle.StatProcess(bpmCfg)
+	// The container of a quarantined process is frozen, so anything run
+	// in it would hang.
+	if err := refuseQuarantined(bpmCfg); err != nil {
+		return err
+	}
+
+	process, err := runcLifecycle.StatProcess(ctx, bpmCfg)
 	if err != nil && !lifecycle.IsNotExist(err) {
 		return fmt.Errorf("failed to get job: %s", err)
-	} else if lifecycle.IsNotExist(err) || process.Status == models.ProcessStateFailed {
+	} else if lifecycle.IsNotExist(err) || process.HasExited() {
 		return errors.New("process is not running or could not be found")
 	}
 
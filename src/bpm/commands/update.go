@@ -0,0 +1,138 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"code.cloudfoundry.org/lager"
+	"github.com/spf13/cobra"
+
+	"bpm/config"
+	"bpm/runc/lifecycle"
+)
+
+func init() {
+	updateCommand.Flags().StringVarP(&procName, "process", "p", "", "optional process name")
+	RootCmd.AddCommand(updateCommand)
+}
+
+var updateCommand = &cobra.Command{
+	Long:     "Reads the configuration of a running BOSH Process again and applies any change to its memory, swap, memory_reservation, cpus, cpu_shares, or processes limits to its container without restarting it. Other changes to the configuration still need the process to be restarted, which is reported.",
+	RunE:     update,
+	Short:    "applies changed resource limits to a running BOSH Process",
+	Use:      "update <job-name>",
+	PreRunE:  updatePre,
+	PostRunE: updatePost,
+}
+
+func updatePre(cmd *cobra.Command, args []string) error {
+	if err := validateInput(args); err != nil {
+		return err
+	}
+
+	cmd.SilenceUsage = true
+
+	if err := setupBpmLogs("update"); err != nil {
+		return err
+	}
+
+	return acquireLifecycleLock()
+}
+
+func updatePost(cmd *cobra.Command, args []string) error {
+	return releaseLifecycleLock()
+}
+
+func update(cmd *cobra.Command, _ []string) error {
+	logger.Info("starting")
+	defer logger.Info("complete")
+
+	jobCfg, err := bpmCfg.ParseJobConfig()
+	if err != nil {
+		logger.Error("failed-to-parse-config", err)
+		return configError(fmt.Errorf("failed to parse job configuration: %s", err))
+	}
+
+	if instances := jobCfg.Instances(procName); len(instances) > 0 {
+		return updateInstances(cmd, instances)
+	}
+
+	procCfg, err := processByNameFromJobConfig(jobCfg, procName)
+	if err != nil {
+		logger.Error("process-not-defined", err)
+		return configError(fmt.Errorf("process %q not present in job configuration (%s)", procName, bpmCfg.JobConfig()))
+	}
+
+	logRedactor.Add(procCfg.SensitiveValues()...)
+
+	runcLifecycle, err := newRuncLifecycle()
+	if err != nil {
+		return err
+	}
+
+	if err := refuseQuarantined(bpmCfg); err != nil {
+		logger.Error("refusing-to-update", err)
+		return err
+	}
+
+	process, err := runcLifecycle.StatProcess(ctx, bpmCfg)
+	if err != nil && !lifecycle.IsNotExist(err) {
+		return fmt.Errorf("failed to get job: %s", err)
+	} else if lifecycle.IsNotExist(err) || process.HasExited() {
+		return errors.New("process is not running or could not be found")
+	}
+
+	result, err := runcLifecycle.UpdateProcess(ctx, logger, bpmCfg, procCfg)
+	if err != nil {
+		logger.Error("failed-to-update", err)
+		return fmt.Errorf("failed to update job-process: %s", err)
+	}
+
+	if len(result.Changed) == 0 {
+		fmt.Fprintln(cmd.OutOrStdout(), "no limits changed")
+	} else {
+		fmt.Fprintf(cmd.OutOrStdout(), "updated %s\n", strings.Join(result.Changed, ", "))
+	}
+
+	if result.RestartNeeded {
+		logger.Info("restart-needed", lager.Data{"updated": result.Changed})
+		fmt.Fprintln(cmd.OutOrStdout(), "other changes to the configuration take effect when the process is restarted")
+	}
+
+	return nil
+}
+
+// updateInstances updates each instance of a process with instances, exactly
+// as if `bpm update` had been run for it on its own.
+func updateInstances(cmd *cobra.Command, instances []*config.ProcessConfig) error {
+	failed := 0
+	for _, instance := range instances {
+		if err := runBPM("update", bpmCfg.JobName(), "-p", instance.Name); err != nil {
+			logger.Error("failed-to-update-instance", err, lager.Data{"instance": instance.Name})
+			fmt.Fprintf(cmd.ErrOrStderr(), "failed to update %s: %s\n", instance.Name, err)
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("failed to update %d of %d instance(s) of %s", failed, len(instances), procName)
+	}
+
+	return nil
+}
@@ -0,0 +1,98 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"code.cloudfoundry.org/lager"
+	"github.com/spf13/cobra"
+
+	"bpm/config"
+)
+
+var strictValidation bool
+
+func init() {
+	validateCommand.Flags().BoolVar(&strictValidation, "strict", false, "treat deprecated fields as errors")
+	RootCmd.AddCommand(validateCommand)
+}
+
+var validateCommand = &cobra.Command{
+	Long:    "Checks that the configuration of a job, including any local override, is valid. Deprecated fields are warned about unless --strict is given, in which case they are errors.",
+	RunE:    validateJob,
+	Short:   "validates the configuration of a job",
+	Use:     "validate <job-name>",
+	PreRunE: validatePre,
+}
+
+func validatePre(cmd *cobra.Command, args []string) error {
+	return validateInput(args)
+}
+
+func validateJob(cmd *cobra.Command, _ []string) error {
+	cmd.SilenceUsage = true
+
+	jobCfg, err := bpmCfg.ParseJobConfig()
+	if err != nil {
+		return fmt.Errorf("invalid job configuration: %s", err)
+	}
+
+	deprecations := jobCfg.Deprecations()
+	if !strictValidation {
+		warnDeprecations(cmd, deprecations)
+		return nil
+	}
+
+	if len(deprecations) > 0 {
+		var msgs []string
+		for _, d := range deprecations {
+			msgs = append(msgs, d.String())
+		}
+		return errors.New("job configuration uses deprecated fields:\n  " + strings.Join(msgs, "\n  "))
+	}
+
+	return nil
+}
+
+// warnedDeprecations holds the deprecations which this invocation of bpm has
+// already warned about.
+var warnedDeprecations = map[string]bool{}
+
+// warnDeprecations tells the operator about deprecated fields which are set
+// in the configuration of a job, on stderr and, if it has been set up, in
+// the job's bpm.log. Each is only warned about once per invocation however
+// many times the configuration is parsed.
+func warnDeprecations(cmd *cobra.Command, deprecations []config.Deprecation) {
+	for _, d := range deprecations {
+		key := bpmCfg.JobName() + "/" + d.String()
+		if warnedDeprecations[key] {
+			continue
+		}
+		warnedDeprecations[key] = true
+
+		fmt.Fprintf(cmd.ErrOrStderr(), "Warning: %s\n", d)
+
+		if logger != nil {
+			logger.Info("deprecated-config", lager.Data{
+				"field":   d.Field,
+				"message": d.Message,
+			})
+		}
+	}
+}
@@ -0,0 +1,177 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package commands
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"bpm/config"
+	"bpm/configwatch"
+	"bpm/models"
+	"bpm/runc/lifecycle"
+	"bpm/units"
+)
+
+var (
+	watchApply    bool
+	watchInterval time.Duration
+)
+
+// watchSettle is how long to wait for more changes after the first so that
+// templates which are rendered together are applied together.
+const watchSettle = 500 * time.Millisecond
+
+func init() {
+	watchCommand.Flags().BoolVar(&watchApply, "apply", false, "restart or stop running processes when their configuration changes")
+	watchCommand.Flags().Var(units.DurationFlag(&watchInterval, 30*time.Second), "interval", "how often to rescan the configuration if no change is noticed")
+	RootCmd.AddCommand(watchCommand)
+}
+
+var watchCommand = &cobra.Command{
+	Long: `watches the bpm configuration of every job for changes
+
+  Each line of output is a JSON object describing a process whose
+  configuration was added, removed, or modified, or a job whose configuration
+  could not be read. Local overrides are watched too.
+
+  With --apply, running processes whose configuration is modified are
+  restarted and running processes which are removed are stopped, just as if
+  'bpm stop' and 'bpm start' had been run for them. Added processes are only
+  reported: starting them is left to monit. A job whose configuration cannot
+  be read is left alone until it is fixed.
+
+  The watch ends when bpm is interrupted.
+`,
+	RunE:    watchConfig,
+	Short:   "watches job configuration for changes",
+	Use:     "watch",
+	PreRunE: watchPre,
+}
+
+func watchPre(cmd *cobra.Command, _ []string) error {
+	if watchInterval <= 0 {
+		return errors.New("interval must be positive")
+	}
+
+	return nil
+}
+
+// watchEvent is written for each change. Action and ActionError describe
+// what --apply did about it.
+type watchEvent struct {
+	configwatch.Change
+	Action      string `json:"action,omitempty"`
+	ActionError string `json:"action_error,omitempty"`
+}
+
+func watchConfig(cmd *cobra.Command, _ []string) error {
+	cmd.SilenceUsage = true
+
+	notifier, err := configwatch.NewNotifier()
+	if err != nil {
+		return fmt.Errorf("failed to watch configuration: %s", err)
+	}
+	defer notifier.Close()
+
+	var runcLifecycle *lifecycle.RuncLifecycle
+	if watchApply {
+		runcLifecycle, err = newRuncLifecycle()
+		if err != nil {
+			return err
+		}
+	}
+
+	encoder := json.NewEncoder(cmd.OutOrStdout())
+
+	notifier.Watch(boshEnv)
+	snapshot := configwatch.Take(boshEnv, configwatch.Snapshot{})
+
+	for ctx.Err() == nil {
+		if _, err := notifier.Wait(ctx, watchInterval, watchSettle); err != nil {
+			return fmt.Errorf("failed to watch configuration: %s", err)
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		notifier.Watch(boshEnv)
+		next := configwatch.Take(boshEnv, snapshot)
+
+		for _, change := range configwatch.Diff(snapshot, next) {
+			event := watchEvent{Change: change}
+			if watchApply {
+				event.Action, err = applyChange(runcLifecycle, change)
+				if err != nil {
+					event.ActionError = err.Error()
+				}
+			}
+
+			encoder.Encode(event)
+		}
+
+		snapshot = next
+	}
+
+	return nil
+}
+
+// applyChange restarts or stops a running process whose configuration has
+// changed and returns what it did. The process is started again by running
+// bpm so that it is started exactly as by 'bpm start'.
+func applyChange(runcLifecycle *lifecycle.RuncLifecycle, change configwatch.Change) (string, error) {
+	if change.Change != configwatch.Modified && change.Change != configwatch.Removed {
+		return "", nil
+	}
+
+	cfg := config.NewBPMConfig(boshEnv, change.Job, change.Process)
+	process, err := runcLifecycle.StatProcess(ctx, cfg)
+	if err != nil || process.Status != models.ProcessStateRunning {
+		return "", nil
+	}
+
+	if change.Change == configwatch.Removed {
+		return "stop", stopLockedProcess(runcLifecycle, cfg)
+	}
+
+	if err := stopLockedProcess(runcLifecycle, cfg); err != nil {
+		return "restart", err
+	}
+
+	return "restart", runBPM("start", change.Job, "-p", change.Process)
+}
+
+// runBPM runs this bpm executable with args, returning its error output if
+// it fails.
+func runBPM(args ...string) error {
+	bpmPath, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	output, err := exec.Command(bpmPath, args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s: %s", err, output)
+	}
+
+	return nil
+}
@@ -0,0 +1,131 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package config
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"bpm/bosh"
+)
+
+// Prerequisites returns the configuration of the processes listed in the
+// process's after setting. These are the processes which must be running
+// before it is started. An entry may name a whole job (JOB) or a single
+// process of a job (JOB/PROCESS), which stands for all of its instances if it
+// has them. Jobs which are not present on the host are ignored so that the
+// same configuration works whether or not they are co-located.
+func (c *ProcessConfig) Prerequisites(env *bosh.Env) ([]*BPMConfig, error) {
+	var prerequisites []*BPMConfig
+
+	for _, after := range c.After {
+		job, process, err := parseAfter(after)
+		if err != nil {
+			return nil, err
+		}
+
+		jobCfg, err := NewBPMConfig(env, job, "").ParseJobConfig()
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to parse configuration of %s: %s", job, err)
+		}
+
+		if process != "" {
+			selected := jobCfg.Select(process)
+			if len(selected) == 0 {
+				return nil, fmt.Errorf("invalid after: job %s has no process %s", job, process)
+			}
+
+			for _, proc := range selected {
+				prerequisites = append(prerequisites, NewBPMConfig(env, job, proc.Name))
+			}
+			continue
+		}
+
+		for _, proc := range jobCfg.Processes {
+			prerequisites = append(prerequisites, NewBPMConfig(env, job, proc.Name))
+		}
+	}
+
+	return prerequisites, nil
+}
+
+// StartOrder groups processes into waves so that every process is in a later
+// wave than its prerequisites. The keys of prerequisites name each process and
+// the values name the processes it must start after. Prerequisites which are
+// not themselves keys are ignored. Processes which depend on each other in a
+// cycle are placed together in the final wave.
+func StartOrder(prerequisites map[string][]string) [][]string {
+	remaining := map[string]bool{}
+	for name := range prerequisites {
+		remaining[name] = true
+	}
+
+	var waves [][]string
+	for len(remaining) > 0 {
+		var wave []string
+		for name := range remaining {
+			if !anyRemaining(remaining, prerequisites[name]) {
+				wave = append(wave, name)
+			}
+		}
+
+		if len(wave) == 0 {
+			for name := range remaining {
+				wave = append(wave, name)
+			}
+		}
+
+		sort.Strings(wave)
+		for _, name := range wave {
+			delete(remaining, name)
+		}
+		waves = append(waves, wave)
+	}
+
+	return waves
+}
+
+func anyRemaining(remaining map[string]bool, names []string) bool {
+	for _, name := range names {
+		if remaining[name] {
+			return true
+		}
+	}
+
+	return false
+}
+
+func parseAfter(after string) (string, string, error) {
+	parts := strings.Split(after, "/")
+	for _, part := range parts {
+		if part == "" {
+			return "", "", fmt.Errorf("invalid after: %q must be JOB or JOB/PROCESS", after)
+		}
+	}
+
+	switch len(parts) {
+	case 1:
+		return parts[0], "", nil
+	case 2:
+		return parts[0], parts[1], nil
+	default:
+		return "", "", fmt.Errorf("invalid after: %q must be JOB or JOB/PROCESS", after)
+	}
+}
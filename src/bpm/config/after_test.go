@@ -0,0 +1,169 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package config_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"bpm/bosh"
+	"bpm/config"
+)
+
+var _ = Describe("After", func() {
+	Describe("Validate", func() {
+		var jobCfg *config.JobConfig
+
+		BeforeEach(func() {
+			jobCfg = &config.JobConfig{
+				Processes: []*config.ProcessConfig{
+					{Name: "example", Executable: "executable"},
+				},
+			}
+		})
+
+		It("accepts jobs and processes of jobs", func() {
+			jobCfg.Processes[0].After = []string{"database", "cache/server"}
+			Expect(jobCfg.Validate(bosh.NewEnv(""), []string{})).To(Succeed())
+		})
+
+		It("rejects malformed entries", func() {
+			for _, after := range []string{"", "/server", "cache/", "cache/server/extra"} {
+				jobCfg.Processes[0].After = []string{after}
+				Expect(jobCfg.Validate(bosh.NewEnv(""), []string{})).To(HaveOccurred(), after)
+			}
+		})
+	})
+
+	Describe("Prerequisites", func() {
+		var (
+			root string
+			env  *bosh.Env
+		)
+
+		writeJob := func(job, contents string) {
+			path := config.NewBPMConfig(env, job, "").JobConfig()
+			Expect(os.MkdirAll(filepath.Dir(path), 0700)).To(Succeed())
+			Expect(ioutil.WriteFile(path, []byte(contents), 0600)).To(Succeed())
+		}
+
+		BeforeEach(func() {
+			var err error
+			root, err = ioutil.TempDir("", "after")
+			Expect(err).NotTo(HaveOccurred())
+			env = bosh.NewEnv(root)
+
+			writeJob("database", `
+processes:
+- name: server
+  executable: /bin/sleep
+- name: backup
+  executable: /bin/sleep
+`)
+		})
+
+		AfterEach(func() {
+			Expect(os.RemoveAll(root)).To(Succeed())
+		})
+
+		It("returns every instance of a process with instances", func() {
+			writeJob("queue", `
+processes:
+- name: worker
+  executable: /bin/sleep
+  instances: 2
+`)
+			procCfg := &config.ProcessConfig{After: []string{"queue/worker"}}
+
+			prerequisites, err := procCfg.Prerequisites(env)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(prerequisites).To(Equal([]*config.BPMConfig{
+				config.NewBPMConfig(env, "queue", "worker.0"),
+				config.NewBPMConfig(env, "queue", "worker.1"),
+			}))
+		})
+
+		It("expands a job into all of its processes", func() {
+			procCfg := &config.ProcessConfig{After: []string{"database"}}
+
+			prerequisites, err := procCfg.Prerequisites(env)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(prerequisites).To(Equal([]*config.BPMConfig{
+				config.NewBPMConfig(env, "database", "server"),
+				config.NewBPMConfig(env, "database", "backup"),
+			}))
+		})
+
+		It("returns a single process of a job", func() {
+			procCfg := &config.ProcessConfig{After: []string{"database/backup"}}
+
+			prerequisites, err := procCfg.Prerequisites(env)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(prerequisites).To(Equal([]*config.BPMConfig{
+				config.NewBPMConfig(env, "database", "backup"),
+			}))
+		})
+
+		It("ignores jobs which are not on the host", func() {
+			procCfg := &config.ProcessConfig{After: []string{"missing", "missing/server"}}
+
+			prerequisites, err := procCfg.Prerequisites(env)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(prerequisites).To(BeEmpty())
+		})
+
+		It("returns an error for a process which is not in the job", func() {
+			procCfg := &config.ProcessConfig{After: []string{"database/missing"}}
+
+			_, err := procCfg.Prerequisites(env)
+			Expect(err).To(MatchError("invalid after: job database has no process missing"))
+		})
+	})
+
+	Describe("StartOrder", func() {
+		It("places processes after their prerequisites", func() {
+			waves := config.StartOrder(map[string][]string{
+				"web/server":      {"database/server", "cache/server"},
+				"database/server": nil,
+				"cache/server":    {"database/server", "elsewhere/server"},
+				"worker/server":   nil,
+			})
+
+			Expect(waves).To(Equal([][]string{
+				{"database/server", "worker/server"},
+				{"cache/server"},
+				{"web/server"},
+			}))
+		})
+
+		It("places processes in a cycle in the final wave", func() {
+			waves := config.StartOrder(map[string][]string{
+				"a/server": {"b/server"},
+				"b/server": {"a/server"},
+				"c/server": nil,
+			})
+
+			Expect(waves).To(Equal([][]string{
+				{"c/server"},
+				{"a/server", "b/server"},
+			}))
+		})
+	})
+})
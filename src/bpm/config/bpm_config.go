@@ -16,8 +16,10 @@
 package config
 
 import (
+	"crypto/sha256"
 	"fmt"
 	"path/filepath"
+	"strings"
 
 	"bpm/bosh"
 	"bpm/jobid"
@@ -35,10 +37,64 @@ func RuncRoot(env *bosh.Env) string {
 	return env.Root().Join("sys", "run", "bpm-runc").External()
 }
 
+// RuncJobRoots is the directory which holds the runc root of each job when
+// jobs do not share RuncRoot.
+func RuncJobRoots(env *bosh.Env) string {
+	return env.Root().Join("sys", "run", "bpm-runc-jobs").External()
+}
+
+// RuncJobRoot is the runc root of a job's containers when jobs do not share
+// RuncRoot.
+func RuncJobRoot(env *bosh.Env, job string) string {
+	return filepath.Join(RuncJobRoots(env), jobid.Encode(job))
+}
+
 func LocksPath(env *bosh.Env) string {
 	return env.Root().Join("data", "bpm", "locks").External()
 }
 
+// StatusRoot is the directory containing the status file of every process.
+func StatusRoot(env *bosh.Env) string {
+	return env.Root().Join("data", "bpm", "status").External()
+}
+
+// QuarantineRoot is the directory containing a file for each process which
+// has been quarantined.
+func QuarantineRoot(env *bosh.Env) string {
+	return env.Root().Join("data", "bpm", "quarantine").External()
+}
+
+// UserCachePath is the file which keeps the users bpm has looked up between
+// runs.
+func UserCachePath(env *bosh.Env) string {
+	return env.Root().Join("data", "bpm", "users.json").External()
+}
+
+// EgressRoot is the directory recording which container holds each egress
+// class ID.
+func EgressRoot(env *bosh.Env) string {
+	return env.Root().Join("data", "bpm", "egress").External()
+}
+
+// MetricsRoot is the directory containing the metrics of bpm's operations on
+// every process.
+func MetricsRoot(env *bosh.Env) string {
+	return env.Root().Join("data", "bpm", "metrics").External()
+}
+
+// BPMPath is the stable path of the bpm executable, which does not change
+// when a new version of the bpm package is installed.
+func BPMPath(env *bosh.Env) string {
+	return env.Root().Join("packages", "bpm", "bin", "bpm").External()
+}
+
+// HostCorePatternFile keeps the kernel's core pattern from before bpm's core
+// dump handler was installed so that cores which bpm does not capture can
+// still be written where the host expects them.
+func HostCorePatternFile(env *bosh.Env) string {
+	return env.Root().Join("data", "bpm", "host_core_pattern").External()
+}
+
 type BPMConfig struct {
 	jobName  string
 	procName string
@@ -90,6 +146,12 @@ func (c *BPMConfig) Stderr() bosh.Path {
 	return c.LogDir().Join(fmt.Sprintf("%s.stderr.log", c.procName))
 }
 
+// StartFailureLog holds what runc logged the last time it failed to run the
+// process's container.
+func (c *BPMConfig) StartFailureLog() bosh.Path {
+	return c.LogDir().Join(fmt.Sprintf("%s.start-failure.log", c.procName))
+}
+
 func (c *BPMConfig) PidDir() bosh.Path {
 	return c.boshEnv.RunDir("bpm").Join(c.JobName())
 }
@@ -98,6 +160,59 @@ func (c *BPMConfig) PidFile() bosh.Path {
 	return c.PidDir().Join(fmt.Sprintf("%s.pid", c.procName))
 }
 
+// AdoptedFile records the pid of a process which was started outside of bpm
+// and has been adopted with `bpm adopt`.
+func (c *BPMConfig) AdoptedFile() bosh.Path {
+	return c.PidDir().Join(fmt.Sprintf("%s.adopted", c.procName))
+}
+
+// HelpersDir is the registry of the processes which bpm has started on the
+// host to support the process, such as log relays.
+func (c *BPMConfig) HelpersDir() bosh.Path {
+	return c.PidDir().Join(fmt.Sprintf("%s.helpers", c.procName))
+}
+
+// TerminationLog is the file on the host which is mounted at the
+// termination_log path of the process.
+func (c *BPMConfig) TerminationLog() bosh.Path {
+	return c.PidDir().Join(fmt.Sprintf("%s.termination-log", c.procName))
+}
+
+// AccountsDir holds the passwd and group files which are generated for the
+// process when it asks for minimal accounts.
+func (c *BPMConfig) AccountsDir() bosh.Path {
+	return c.PidDir().Join(fmt.Sprintf("%s.accounts", c.procName))
+}
+
+// MachineIDFile is the file on the host which is mounted at /etc/machine-id
+// inside the process's container.
+func (c *BPMConfig) MachineIDFile() bosh.Path {
+	return c.PidDir().Join(fmt.Sprintf("%s.machine-id", c.procName))
+}
+
+// CoreDir is where the core dumps of the process are captured when it has
+// enabled core_dumps.
+func (c *BPMConfig) CoreDir() bosh.Path {
+	return c.LogDir().Join("cores")
+}
+
+// StatusFile records the state of the process the last time bpm checked on it
+// so that it can be read without running bpm.
+func (c *BPMConfig) StatusFile() string {
+	return filepath.Join(StatusRoot(c.boshEnv), fmt.Sprintf("%s.%s", c.jobName, c.procName))
+}
+
+// QuarantineFile records that the process has been quarantined. It exists
+// for as long as the process is.
+func (c *BPMConfig) QuarantineFile() string {
+	return filepath.Join(QuarantineRoot(c.boshEnv), fmt.Sprintf("%s.%s.json", c.jobName, c.procName))
+}
+
+// MetricsFile records the metrics of bpm's operations on the process.
+func (c *BPMConfig) MetricsFile() string {
+	return filepath.Join(MetricsRoot(c.boshEnv), fmt.Sprintf("%s.%s.json", c.jobName, c.procName))
+}
+
 func (c *BPMConfig) LockFile() bosh.Path {
 	return c.PidDir().Join(fmt.Sprintf("%s.lock", c.procName))
 }
@@ -118,10 +233,85 @@ func (c *BPMConfig) JobConfig() string {
 	return c.JobDir().Join(filepath.Join("config", "bpm.yml")).External()
 }
 
+// OverrideConfig is the location of the operator's local overrides for the
+// job's configuration.
+func (c *BPMConfig) OverrideConfig() string {
+	return filepath.Join(OverridesRoot(c.boshEnv), c.jobName, "bpm.override.yml")
+}
+
 func (c *BPMConfig) TiniPath() bosh.Path {
 	return c.PackageDir().Join("bpm", "bin", "tini")
 }
 
+// HostPath returns where a volume or socket path from the job configuration
+// is found on the host. Paths outside the BOSH root are returned unchanged.
+func (c *BPMConfig) HostPath(path string) string {
+	if p, ok := c.boshEnv.Resolve(path); ok {
+		return p.External()
+	}
+
+	return path
+}
+
+// Instance describes the BOSH instance which the process runs on.
+func (c *BPMConfig) Instance() (bosh.Instance, error) {
+	return c.boshEnv.Instance()
+}
+
+// maxHostnameLength is the longest hostname which is a valid DNS label.
+const maxHostnameLength = 63
+
+// Hostname is the hostname of the process's container. It is made from the
+// job, process and instance index (e.g. web-server-0) so that neither the
+// processes on a VM nor the instances of a job share one. The index is left
+// out when bpm is not running on a BOSH instance.
+func (c *BPMConfig) Hostname() string {
+	suffix := ""
+	if instance, err := c.Instance(); err == nil {
+		suffix = fmt.Sprintf("-%d", instance.Index)
+	}
+
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r - 'A' + 'a'
+		default:
+			return '-'
+		}
+	}, fmt.Sprintf("%s-%s", c.jobName, c.procName))
+
+	if len(name)+len(suffix) > maxHostnameLength {
+		name = name[:maxHostnameLength-len(suffix)]
+	}
+
+	return strings.Trim(name, "-") + suffix
+}
+
+// CgroupPathAnnotation records the cgroup of a process's container so that
+// other tools on the host can find it.
+const CgroupPathAnnotation = "bpm.cgroup_path"
+
+// CgroupsPath is the cgroup which the process's container is placed in. Each
+// BOSH root has its own runc state so containers from two roots on the same
+// host can share a container ID. Their cgroups are kept apart by a prefix
+// derived from the root. Processes in the default root are left where runc
+// places them by default (an empty path).
+func (c *BPMConfig) CgroupsPath() string {
+	root := c.boshEnv.Root().External()
+	if root == bosh.DefaultRoot {
+		return ""
+	}
+
+	if abs, err := filepath.Abs(root); err == nil {
+		root = abs
+	}
+
+	sum := sha256.Sum256([]byte(root))
+	return fmt.Sprintf("/bpm-%x/%s", sum[:4], c.ContainerID())
+}
+
 func (c *BPMConfig) DefaultVolumes() []string {
 	return []string{c.DataDir().External(), c.StoreDir().External()}
 }
@@ -132,11 +322,26 @@ func (c *BPMConfig) ParseJobConfig() (*JobConfig, error) {
 		return nil, err
 	}
 
+	override, err := ParseOverrideConfig(c.OverrideConfig())
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse override %s: %s", c.OverrideConfig(), err)
+	}
+
+	if override != nil {
+		if err := cfg.ApplyOverride(override); err != nil {
+			return nil, err
+		}
+	}
+
 	err = cfg.Validate(c.boshEnv, c.DefaultVolumes())
 	if err != nil {
 		return nil, err
 	}
 
+	if err := cfg.expandInstances(); err != nil {
+		return nil, err
+	}
+
 	return cfg, nil
 }
 
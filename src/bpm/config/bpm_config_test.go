@@ -16,6 +16,11 @@
 package config_test
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 
@@ -58,4 +63,198 @@ var _ = Describe("Config", func() {
 			})
 		})
 	})
+
+	Describe("Hostname", func() {
+		var root string
+
+		BeforeEach(func() {
+			var err error
+			root, err = ioutil.TempDir("", "bpm-config-hostname")
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			Expect(os.RemoveAll(root)).To(Succeed())
+		})
+
+		It("names the container after its job and process", func() {
+			cfg := config.NewBPMConfig(bosh.NewEnv(root), "Web_Router", "server")
+			Expect(cfg.Hostname()).To(Equal("web-router-server"))
+		})
+
+		Context("when bpm is running on a BOSH instance", func() {
+			BeforeEach(func() {
+				Expect(os.MkdirAll(filepath.Join(root, "bosh"), 0700)).To(Succeed())
+				Expect(ioutil.WriteFile(filepath.Join(root, "bosh", "spec.json"), []byte(`{"index":3}`), 0600)).To(Succeed())
+			})
+
+			It("adds the index of the instance", func() {
+				cfg := config.NewBPMConfig(bosh.NewEnv(root), "web", "server")
+				Expect(cfg.Hostname()).To(Equal("web-server-3"))
+			})
+
+			It("keeps the index when the name is too long for a hostname", func() {
+				cfg := config.NewBPMConfig(bosh.NewEnv(root), strings.Repeat("j", 70), "server")
+				Expect(cfg.Hostname()).To(Equal(strings.Repeat("j", 61) + "-3"))
+			})
+		})
+	})
+
+	Describe("multiple BOSH roots", func() {
+		var (
+			rootA, rootB string
+			cfgA, cfgB   *config.BPMConfig
+		)
+
+		BeforeEach(func() {
+			var err error
+			rootA, err = ioutil.TempDir("", "bpm-config-a")
+			Expect(err).NotTo(HaveOccurred())
+			rootB, err = ioutil.TempDir("", "bpm-config-b")
+			Expect(err).NotTo(HaveOccurred())
+
+			cfgA = config.NewBPMConfig(bosh.NewEnv(rootA), "job", "server")
+			cfgB = config.NewBPMConfig(bosh.NewEnv(rootB), "job", "server")
+		})
+
+		AfterEach(func() {
+			Expect(os.RemoveAll(rootA)).To(Succeed())
+			Expect(os.RemoveAll(rootB)).To(Succeed())
+		})
+
+		It("keeps all of the state of the same process apart", func() {
+			Expect(cfgA.ContainerID()).To(Equal(cfgB.ContainerID()))
+			Expect(cfgA.PidFile().Internal()).To(Equal(cfgB.PidFile().Internal()))
+
+			for _, path := range []string{
+				config.RuncRoot(bosh.NewEnv(rootA)),
+				config.RuncJobRoot(bosh.NewEnv(rootA), "job"),
+				config.LocksPath(bosh.NewEnv(rootA)),
+				cfgA.BundlePath(),
+				cfgA.PidFile().External(),
+				cfgA.LockFile().External(),
+				cfgA.StatusFile(),
+				cfgA.BPMLog(),
+				cfgA.JobConfig(),
+				cfgA.OverrideConfig(),
+				cfgA.TiniPath().External(),
+			} {
+				Expect(path).To(HavePrefix(rootA + "/"))
+			}
+
+			Expect(cfgA.BundlePath()).To(Equal(filepath.Join(rootA, "data", "bpm", "bundles", "job", "server")))
+			Expect(cfgB.BundlePath()).To(Equal(filepath.Join(rootB, "data", "bpm", "bundles", "job", "server")))
+		})
+
+		It("places the containers in different cgroups", func() {
+			Expect(cfgA.CgroupsPath()).To(HaveSuffix("/" + cfgA.ContainerID()))
+			Expect(cfgB.CgroupsPath()).To(HaveSuffix("/" + cfgB.ContainerID()))
+			Expect(cfgA.CgroupsPath()).NotTo(Equal(cfgB.CgroupsPath()))
+		})
+
+		It("leaves the cgroup of processes in the default root to runc", func() {
+			cfg := config.NewBPMConfig(bosh.NewEnv(""), "job", "server")
+			Expect(cfg.CgroupsPath()).To(BeEmpty())
+		})
+
+		It("finds paths from the job configuration within the root", func() {
+			Expect(cfgA.HostPath("/var/vcap/data/job/cache")).To(Equal(filepath.Join(rootA, "data", "job", "cache")))
+			Expect(cfgB.HostPath("/var/vcap/data/job/cache")).To(Equal(filepath.Join(rootB, "data", "job", "cache")))
+			Expect(cfgA.HostPath(filepath.Join(rootA, "data", "job", "cache"))).To(Equal(filepath.Join(rootA, "data", "job", "cache")))
+			Expect(cfgA.HostPath("/srv/cache")).To(Equal("/srv/cache"))
+		})
+	})
+
+	Describe("instances", func() {
+		var (
+			root   string
+			bpmCfg *config.BPMConfig
+		)
+
+		writeJob := func(contents string) {
+			Expect(os.MkdirAll(filepath.Dir(bpmCfg.JobConfig()), 0700)).To(Succeed())
+			Expect(ioutil.WriteFile(bpmCfg.JobConfig(), []byte(contents), 0600)).To(Succeed())
+		}
+
+		BeforeEach(func() {
+			var err error
+			root, err = ioutil.TempDir("", "bpm-config")
+			Expect(err).NotTo(HaveOccurred())
+
+			bpmCfg = config.NewBPMConfig(bosh.NewEnv(root), "job", "")
+		})
+
+		AfterEach(func() {
+			Expect(os.RemoveAll(root)).To(Succeed())
+		})
+
+		It("replaces a process with instances by one process for each", func() {
+			writeJob(`
+processes:
+- name: server
+  executable: /bin/sleep
+- name: worker
+  executable: /bin/sleep
+  instances: 2
+  env:
+    QUEUE: jobs
+`)
+
+			jobCfg, err := bpmCfg.ParseJobConfig()
+			Expect(err).NotTo(HaveOccurred())
+
+			var names []string
+			for _, proc := range jobCfg.Processes {
+				names = append(names, proc.Name)
+			}
+			Expect(names).To(Equal([]string{"server", "worker.0", "worker.1"}))
+
+			instances := jobCfg.Instances("worker")
+			Expect(instances).To(HaveLen(2))
+			Expect(instances[1].InstanceOf).To(Equal("worker"))
+			Expect(instances[1].Env).To(Equal(map[string]string{"QUEUE": "jobs", "BPM_INSTANCE_INDEX": "1"}))
+			Expect(instances[0].Env["BPM_INSTANCE_INDEX"]).To(Equal("0"))
+
+			Expect(jobCfg.Select("worker")).To(Equal(instances))
+			Expect(jobCfg.Select("worker.1")).To(Equal(instances[1:]))
+			Expect(jobCfg.Select("server")).To(HaveLen(1))
+			Expect(jobCfg.Instances("server")).To(BeEmpty())
+
+			Expect(config.NewBPMConfig(bosh.NewEnv(root), "job", "worker.1").ContainerID()).To(Equal(jobid.Encode("job.worker.1")))
+		})
+
+		It("fills in the instance placeholders of each instance", func() {
+			writeJob(`
+processes:
+- name: worker
+  executable: /bin/sleep
+  instances: 2
+  args: ["--port={{instance + 8080}}", "--data=/var/vcap/data/job/worker-{{ instance }}", "{{other}}"]
+  env:
+    METRICS_PORT: "{{instance+9100}}"
+`)
+
+			jobCfg, err := bpmCfg.ParseJobConfig()
+			Expect(err).NotTo(HaveOccurred())
+
+			instances := jobCfg.Instances("worker")
+			Expect(instances[0].Args).To(Equal([]string{"--port=8080", "--data=/var/vcap/data/job/worker-0", "{{other}}"}))
+			Expect(instances[1].Args).To(Equal([]string{"--port=8081", "--data=/var/vcap/data/job/worker-1", "{{other}}"}))
+			Expect(instances[1].Env["METRICS_PORT"]).To(Equal("9101"))
+		})
+
+		It("rejects an instance which has the same name as another process", func() {
+			writeJob(`
+processes:
+- name: worker.0
+  executable: /bin/sleep
+- name: worker
+  executable: /bin/sleep
+  instances: 1
+`)
+
+			_, err := bpmCfg.ParseJobConfig()
+			Expect(err).To(MatchError("invalid instances: more than one process is called worker.0"))
+		})
+	})
 })
@@ -0,0 +1,101 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Deprecation is a field which is set in the configuration of a process but
+// which will be removed in a future version of bpm.
+//
+// A field is deprecated by adding a deprecated tag, containing what to use
+// instead, next to its yaml tag:
+//
+//	OldName string `yaml:"old_name" deprecated:"use new_name instead"`
+type Deprecation struct {
+	Process string
+	Field   string
+	Message string
+}
+
+func (d Deprecation) String() string {
+	message := d.Message
+	if message == "" {
+		message = "it will be removed in a future version of bpm"
+	}
+
+	return fmt.Sprintf("process %s: %s is deprecated: %s", d.Process, d.Field, message)
+}
+
+// Deprecations returns the deprecated fields which are set in the
+// configuration of any of the job's processes.
+func (c *JobConfig) Deprecations() []Deprecation {
+	var found []Deprecation
+	for _, p := range c.Processes {
+		found = append(found, p.Deprecations()...)
+	}
+	return found
+}
+
+// Deprecations returns the deprecated fields which are set in the
+// configuration of the process.
+func (c *ProcessConfig) Deprecations() []Deprecation {
+	return FindDeprecations(c.Name, c)
+}
+
+// FindDeprecations returns the fields of v, and of any structures within it,
+// which have a deprecated tag and are not set to their zero value. Fields are
+// named by their path of yaml keys (e.g. limits.memory).
+func FindDeprecations(process string, v interface{}) []Deprecation {
+	var found []Deprecation
+	findDeprecations(process, "", reflect.ValueOf(v), &found)
+	return found
+}
+
+func findDeprecations(process, path string, v reflect.Value, found *[]Deprecation) {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !v.IsNil() {
+			findDeprecations(process, path, v.Elem(), found)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			findDeprecations(process, fmt.Sprintf("%s[%d]", path, i), v.Index(i), found)
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name := strings.Split(field.Tag.Get("yaml"), ",")[0]
+			if field.PkgPath != "" || name == "" || name == "-" {
+				continue
+			}
+			if path != "" {
+				name = path + "." + name
+			}
+
+			value := v.Field(i)
+			if message, ok := field.Tag.Lookup("deprecated"); ok && !value.IsZero() {
+				*found = append(*found, Deprecation{Process: process, Field: name, Message: message})
+			}
+
+			findDeprecations(process, name, value, found)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package config_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"bpm/config"
+)
+
+var _ = Describe("Deprecations", func() {
+	type nested struct {
+		Old string `yaml:"old" deprecated:"use new instead"`
+		New string `yaml:"new"`
+	}
+
+	type example struct {
+		Legacy   bool     `yaml:"legacy,omitempty" deprecated:""`
+		Current  bool     `yaml:"current"`
+		Nested   *nested  `yaml:"nested"`
+		Items    []nested `yaml:"items"`
+		Internal string   `yaml:"-" deprecated:"never reported"`
+	}
+
+	It("finds deprecated fields which are set", func() {
+		deprecations := config.FindDeprecations("server", &example{
+			Legacy:   true,
+			Current:  true,
+			Nested:   &nested{Old: "value"},
+			Items:    []nested{{New: "value"}, {Old: "value"}},
+			Internal: "value",
+		})
+
+		Expect(deprecations).To(Equal([]config.Deprecation{
+			{Process: "server", Field: "legacy", Message: ""},
+			{Process: "server", Field: "nested.old", Message: "use new instead"},
+			{Process: "server", Field: "items[1].old", Message: "use new instead"},
+		}))
+	})
+
+	It("ignores deprecated fields which are not set", func() {
+		Expect(config.FindDeprecations("server", &example{Nested: &nested{New: "value"}})).To(BeEmpty())
+	})
+
+	It("describes the deprecation", func() {
+		d := config.Deprecation{Process: "server", Field: "nested.old", Message: "use new instead"}
+		Expect(d.String()).To(Equal("process server: nested.old is deprecated: use new instead"))
+
+		d.Message = ""
+		Expect(d.String()).To(Equal("process server: nested.old is deprecated: it will be removed in a future version of bpm"))
+	})
+
+	It("finds nothing in the current configuration format", func() {
+		cfg, err := config.ParseJobConfig("testdata/example.yml")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cfg.Deprecations()).To(BeEmpty())
+	})
+})
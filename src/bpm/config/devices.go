@@ -0,0 +1,68 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultDevicePermissions are the permissions which a device is given when
+// its configuration does not set any.
+const DefaultDevicePermissions = "rw"
+
+// Device is a device node of the host, such as /dev/fuse or /dev/net/tun,
+// which the process may use. Permissions is any combination of r (read), w
+// (write), and m (mknod).
+type Device struct {
+	Path        string `yaml:"path"`
+	Permissions string `yaml:"permissions"`
+}
+
+// Access returns the permissions of the device in the form the device cgroup
+// expects.
+func (d Device) Access() string {
+	if d.Permissions == "" {
+		return DefaultDevicePermissions
+	}
+
+	return d.Permissions
+}
+
+func (c *ProcessConfig) validateDevices() error {
+	seen := map[string]bool{}
+
+	for _, device := range c.Devices {
+		if filepath.Clean(device.Path) != device.Path || !strings.HasPrefix(device.Path, "/dev/") {
+			return fmt.Errorf("invalid devices: path must be canonical and inside /dev but got %q", device.Path)
+		}
+
+		if seen[device.Path] {
+			return fmt.Errorf("invalid devices: %s is given more than once", device.Path)
+		}
+		seen[device.Path] = true
+
+		access := device.Access()
+		for _, p := range access {
+			if !strings.ContainsRune("rwm", p) || strings.Count(access, string(p)) > 1 {
+				return fmt.Errorf("invalid devices: permissions of %s must be a combination of r, w, and m but got %q", device.Path, device.Permissions)
+			}
+		}
+	}
+
+	return nil
+}
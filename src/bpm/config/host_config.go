@@ -0,0 +1,203 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	yaml "gopkg.in/yaml.v2"
+
+	"bpm/bosh"
+	"bpm/units"
+)
+
+// HostConfigPath returns the location of the configuration which applies to
+// bpm itself rather than to any particular job. It is rendered by the bpm BOSH
+// job.
+func HostConfigPath(env *bosh.Env) string {
+	return env.JobDir("bpm").Join("config", "host.yml").External()
+}
+
+// HostConfig contains the operator controlled settings which apply to every
+// job on the host.
+type HostConfig struct {
+	Chaos   *ChaosConfig   `yaml:"chaos"`
+	CredHub *CredHubConfig `yaml:"credhub"`
+
+	// SpecMutators are the paths of executables which may adjust the OCI
+	// spec of every process before its container is created.
+	SpecMutators []string `yaml:"spec_mutators"`
+
+	// Admission are the paths of executables which must each allow the
+	// final OCI spec of a process before its container is created.
+	Admission []string `yaml:"admission"`
+
+	// MaxLogLineLength is the number of bytes after which lines written by
+	// a process are truncated. Zero means lines are never truncated.
+	MaxLogLineLength int `yaml:"max_log_line_length"`
+
+	// VerifyExecutables enables checking that the interpreter and shared
+	// libraries of each executable are mounted into its container before
+	// the container is created.
+	VerifyExecutables bool `yaml:"verify_executables"`
+
+	// MinFreeSpace is how much space must be free on the filesystems which
+	// a process writes to for it to be started.
+	MinFreeSpace *MinFreeSpaceConfig `yaml:"min_free_space"`
+
+	// Tracing exports spans for bpm's lifecycle operations to an
+	// OpenTelemetry collector.
+	Tracing *TracingConfig `yaml:"tracing"`
+
+	// PerJobRuncRoots keeps the runc state of each job's containers in a
+	// root of its own rather than one shared by every job.
+	PerJobRuncRoots bool `yaml:"per_job_runc_roots"`
+
+	// State moves the directories which bpm writes to out of the BOSH
+	// root.
+	State *StateConfig `yaml:"state"`
+}
+
+// StateConfig contains the writable directories on the host which take the
+// place of those beneath the BOSH root that bpm writes to, for images where
+// the BOSH root is read-only. A directory which is not set is not moved.
+type StateConfig struct {
+	// DataDir replaces data/bpm, which holds the bundles, locks, status,
+	// metrics, and overrides of every process.
+	DataDir string `yaml:"data_dir"`
+
+	// RunDir replaces sys/run, which holds the pid files and runc state of
+	// every process as well as the socket directories of jobs.
+	RunDir string `yaml:"run_dir"`
+
+	// LogDir replaces sys/log, which holds the logs of every job including
+	// bpm's own.
+	LogDir string `yaml:"log_dir"`
+}
+
+// Relocate moves the directories of env which have been configured.
+func (c *StateConfig) Relocate(env *bosh.Env) error {
+	dirs := []struct {
+		property, dir, target string
+	}{
+		{"data_dir", "data/bpm", c.DataDir},
+		{"run_dir", "sys/run", c.RunDir},
+		{"log_dir", "sys/log", c.LogDir},
+	}
+
+	for _, d := range dirs {
+		if d.target == "" {
+			continue
+		}
+
+		if !filepath.IsAbs(d.target) {
+			return fmt.Errorf("invalid state %s %q: must be an absolute path", d.property, d.target)
+		}
+
+		env.RelocateState(d.dir, filepath.Clean(d.target))
+	}
+
+	return nil
+}
+
+// TracingConfig contains the OTLP/HTTP endpoint of the collector which bpm
+// exports traces to (such as http://localhost:4318) and any headers, such as
+// credentials, which it requires.
+type TracingConfig struct {
+	OTLPEndpoint string            `yaml:"otlp_endpoint"`
+	Headers      map[string]string `yaml:"headers"`
+}
+
+// MinFreeSpaceConfig contains the space which must be free on the data, log,
+// and store filesystems as byte sizes such as 50M. An empty size is not
+// checked.
+type MinFreeSpaceConfig struct {
+	Data  string `yaml:"data"`
+	Log   string `yaml:"log"`
+	Store string `yaml:"store"`
+}
+
+// Bytes returns the sizes in bytes, with zero for those which are not set.
+func (c *MinFreeSpaceConfig) Bytes() (data, log, store uint64, err error) {
+	sizes := []*uint64{&data, &log, &store}
+	for i, size := range []string{c.Data, c.Log, c.Store} {
+		if size == "" {
+			continue
+		}
+
+		*sizes[i], err = units.ParseSize(size)
+		if err != nil {
+			return 0, 0, 0, fmt.Errorf("invalid min_free_space: %s", err)
+		}
+	}
+
+	return data, log, store, nil
+}
+
+// ChaosConfig controls the failure injection commands. They are disabled
+// unless an operator explicitly enables them.
+type ChaosConfig struct {
+	Enabled bool `yaml:"enabled"`
+}
+
+// CredHubConfig contains the location of CredHub and the UAA client which bpm
+// uses to fetch secrets referenced from a process's environment.
+type CredHubConfig struct {
+	URL          string `yaml:"url"`
+	UAAURL       string `yaml:"uaa_url"`
+	Client       string `yaml:"client"`
+	ClientSecret string `yaml:"client_secret"`
+	CACert       string `yaml:"ca_cert"`
+}
+
+// ParseHostConfig reads the host configuration from a file. A missing file is
+// not an error and results in the default (empty) configuration. The
+// configuration is returned even with an error, holding whichever sections
+// could be parsed, so that callers can tell whether what they need is set.
+func ParseHostConfig(configPath string) (*HostConfig, error) {
+	cfg := HostConfig{}
+
+	data, err := ioutil.ReadFile(configPath)
+	if os.IsNotExist(err) {
+		return &cfg, nil
+	} else if err != nil {
+		return &cfg, err
+	}
+
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return &cfg, err
+	}
+
+	return &cfg, nil
+}
+
+// ChaosEnabled returns whether the failure injection commands may be used.
+func (c *HostConfig) ChaosEnabled() bool {
+	return c.Chaos != nil && c.Chaos.Enabled
+}
+
+// TracingEnabled returns whether traces are exported.
+func (c *HostConfig) TracingEnabled() bool {
+	return c.Tracing != nil && c.Tracing.OTLPEndpoint != ""
+}
+
+// CredHubEnabled returns whether secrets can be fetched from CredHub.
+func (c *HostConfig) CredHubEnabled() bool {
+	return c.CredHub != nil && c.CredHub.URL != ""
+}
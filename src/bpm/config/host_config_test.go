@@ -0,0 +1,121 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package config_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"bpm/bosh"
+	"bpm/config"
+)
+
+var _ = Describe("HostConfig", func() {
+	Describe("HostConfigPath", func() {
+		It("is inside the bpm job's configuration directory", func() {
+			env := bosh.NewEnv("/some/root")
+			Expect(config.HostConfigPath(env)).To(Equal("/some/root/jobs/bpm/config/host.yml"))
+		})
+	})
+
+	Describe("ParseHostConfig", func() {
+		It("parses a yaml file into a host config", func() {
+			cfg, err := config.ParseHostConfig("testdata/host.yml")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cfg.ChaosEnabled()).To(BeTrue())
+			Expect(cfg.CredHubEnabled()).To(BeTrue())
+			Expect(cfg.CredHub).To(Equal(&config.CredHubConfig{
+				URL:          "https://credhub.service.cf.internal:8844",
+				UAAURL:       "https://uaa.service.cf.internal:8443",
+				Client:       "bpm",
+				ClientSecret: "secret",
+				CACert:       "CA",
+			}))
+			Expect(cfg.MaxLogLineLength).To(Equal(65536))
+			Expect(cfg.VerifyExecutables).To(BeTrue())
+			Expect(cfg.Admission).To(ConsistOf("/var/vcap/packages/policy/bin/admit"))
+			Expect(cfg.TracingEnabled()).To(BeTrue())
+			Expect(cfg.Tracing).To(Equal(&config.TracingConfig{
+				OTLPEndpoint: "http://localhost:4318",
+				Headers:      map[string]string{"Authorization": "Bearer token"},
+			}))
+			Expect(cfg.State).To(Equal(&config.StateConfig{
+				DataDir: "/writable/bpm",
+				LogDir:  "/writable/log",
+			}))
+
+			data, log, store, err := cfg.MinFreeSpace.Bytes()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(data).To(Equal(uint64(50 * 1024 * 1024)))
+			Expect(log).To(Equal(uint64(10 * 1024 * 1024)))
+			Expect(store).To(BeZero())
+		})
+
+		Context("when the file does not exist", func() {
+			It("returns the default configuration", func() {
+				cfg, err := config.ParseHostConfig("does-not-exist")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(cfg.ChaosEnabled()).To(BeFalse())
+				Expect(cfg.CredHubEnabled()).To(BeFalse())
+				Expect(cfg.MaxLogLineLength).To(BeZero())
+				Expect(cfg.VerifyExecutables).To(BeFalse())
+				Expect(cfg.MinFreeSpace).To(BeNil())
+				Expect(cfg.TracingEnabled()).To(BeFalse())
+			})
+		})
+
+		Context("when a minimum free space is not a size", func() {
+			It("returns an error from Bytes", func() {
+				cfg := &config.MinFreeSpaceConfig{Data: "lots"}
+				_, _, _, err := cfg.Bytes()
+				Expect(err).To(MatchError(ContainSubstring(`invalid min_free_space: "lots" is not a size`)))
+			})
+		})
+
+		Context("when the state is relocated", func() {
+			It("moves the configured directories of the environment", func() {
+				env := bosh.NewEnv("/var/vcap")
+				cfg := &config.StateConfig{DataDir: "/writable/bpm/", RunDir: "/run/vcap"}
+				Expect(cfg.Relocate(env)).To(Succeed())
+
+				Expect(config.LocksPath(env)).To(Equal("/writable/bpm/locks"))
+				Expect(config.RuncRoot(env)).To(Equal("/run/vcap/bpm-runc"))
+				Expect(env.LogDir("job").External()).To(Equal("/var/vcap/sys/log/job"))
+				Expect(env.DataDir("job").External()).To(Equal("/var/vcap/data/job"))
+			})
+
+			It("returns an error when a directory is not absolute", func() {
+				cfg := &config.StateConfig{LogDir: "log"}
+				err := cfg.Relocate(bosh.NewEnv(""))
+				Expect(err).To(MatchError(`invalid state log_dir "log": must be an absolute path`))
+			})
+		})
+
+		Context("when the yaml is invalid", func() {
+			It("returns an error", func() {
+				_, err := config.ParseHostConfig("testdata/host-invalid.yml")
+				Expect(err).To(HaveOccurred())
+			})
+
+			It("returns the sections which could be parsed", func() {
+				cfg, err := config.ParseHostConfig("testdata/host-partial.yml")
+				Expect(err).To(HaveOccurred())
+				Expect(cfg.State).To(Equal(&config.StateConfig{DataDir: "/data/bpm"}))
+				Expect(cfg.ChaosEnabled()).To(BeFalse())
+			})
+		})
+	})
+})
@@ -0,0 +1,147 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// InstanceIndexEnv is set in the environment of each instance of a process
+// with instances to the index of that instance.
+const InstanceIndexEnv = "BPM_INSTANCE_INDEX"
+
+// InstanceName is the name of one instance of a process with instances. Each
+// instance is managed as a process of its own with this name, so its container
+// is JOB.PROCESS.INDEX and its logs are PROCESS.INDEX.stdout.log and
+// PROCESS.INDEX.stderr.log.
+func InstanceName(process string, index int) string {
+	return fmt.Sprintf("%s.%d", process, index)
+}
+
+// instancePlaceholder is replaced in the args and env of each instance of a
+// process by the index of the instance. {{instance + N}} adds N to it, which
+// gives each instance a port of its own, for example.
+var instancePlaceholder = regexp.MustCompile(`\{\{\s*instance\s*(?:\+\s*([0-9]+)\s*)?\}\}`)
+
+// expandPlaceholders replaces the instance placeholders in s with values for
+// the instance with index.
+func expandPlaceholders(s string, index int) string {
+	return instancePlaceholder.ReplaceAllStringFunc(s, func(placeholder string) string {
+		offset := 0
+		if n := instancePlaceholder.FindStringSubmatch(placeholder)[1]; n != "" {
+			offset, _ = strconv.Atoi(n)
+		}
+
+		return strconv.Itoa(index + offset)
+	})
+}
+
+func (c *ProcessConfig) validateInstances() error {
+	if c.Instances < 0 {
+		return fmt.Errorf("invalid instances: %d must not be negative", c.Instances)
+	}
+
+	if _, ok := c.Env[InstanceIndexEnv]; ok && c.Instances > 0 {
+		return fmt.Errorf("invalid env: %s is set by bpm for processes with instances", InstanceIndexEnv)
+	}
+
+	values := append([]string{}, c.Args...)
+	for _, value := range c.Env {
+		values = append(values, value)
+	}
+
+	for _, value := range values {
+		for _, match := range instancePlaceholder.FindAllStringSubmatch(value, -1) {
+			if c.Instances == 0 {
+				return fmt.Errorf("invalid instances: %s is used but the process has no instances", match[0])
+			}
+
+			if _, err := strconv.Atoi(match[1]); match[1] != "" && err != nil {
+				return fmt.Errorf("invalid instances: the offset of %s is too large", match[0])
+			}
+		}
+	}
+
+	return nil
+}
+
+// Instances returns the instances of the process called name, in order of
+// their index. It is empty if there is no such process or it does not have
+// instances.
+func (c *JobConfig) Instances(name string) []*ProcessConfig {
+	var instances []*ProcessConfig
+	for _, proc := range c.Processes {
+		if proc.InstanceOf == name {
+			instances = append(instances, proc)
+		}
+	}
+
+	return instances
+}
+
+// Select returns the process called name or, if it has instances, each of
+// them.
+func (c *JobConfig) Select(name string) []*ProcessConfig {
+	if proc := c.process(name); proc != nil {
+		return []*ProcessConfig{proc}
+	}
+
+	return c.Instances(name)
+}
+
+// expandInstances replaces each process with instances by that many copies of
+// it, named with InstanceName and told their index in InstanceIndexEnv and
+// through the placeholders in their args and env.
+func (c *JobConfig) expandInstances() error {
+	var processes []*ProcessConfig
+	for _, proc := range c.Processes {
+		if proc.Instances == 0 {
+			processes = append(processes, proc)
+			continue
+		}
+
+		for i := 0; i < proc.Instances; i++ {
+			instance := *proc
+			instance.Name = InstanceName(proc.Name, i)
+			instance.InstanceOf = proc.Name
+
+			instance.Args = make([]string, len(proc.Args))
+			for j, arg := range proc.Args {
+				instance.Args[j] = expandPlaceholders(arg, i)
+			}
+
+			instance.Env = map[string]string{InstanceIndexEnv: strconv.Itoa(i)}
+			for name, value := range proc.Env {
+				instance.Env[name] = expandPlaceholders(value, i)
+			}
+
+			processes = append(processes, &instance)
+		}
+	}
+
+	seen := map[string]bool{}
+	for _, proc := range processes {
+		if seen[proc.Name] {
+			return fmt.Errorf("invalid instances: more than one process is called %s", proc.Name)
+		}
+		seen[proc.Name] = true
+	}
+
+	c.Processes = processes
+	return nil
+}
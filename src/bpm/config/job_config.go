@@ -16,15 +16,23 @@
 package config
 
 import (
+	"crypto/sha256"
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"math"
+	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	yaml "gopkg.in/yaml.v2"
 
 	"bpm/bosh"
+	"bpm/units"
 )
 
 type JobConfig struct {
@@ -32,28 +40,671 @@ type JobConfig struct {
 }
 
 type ProcessConfig struct {
-	Name              string            `yaml:"name"`
-	Executable        string            `yaml:"executable"`
-	Args              []string          `yaml:"args"`
-	Env               map[string]string `yaml:"env"`
-	AdditionalVolumes []Volume          `yaml:"additional_volumes"`
-	Capabilities      []string          `yaml:"capabilities"`
-	EphemeralDisk     bool              `yaml:"ephemeral_disk"`
-	Hooks             *Hooks            `yaml:"hooks,omitempty"`
-	Limits            *Limits           `yaml:"limits"`
-	PersistentDisk    bool              `yaml:"persistent_disk"`
-	WorkDir           string            `yaml:"workdir"`
-	Unsafe            *Unsafe           `yaml:"unsafe"`
+	Name                   string            `yaml:"name"`
+	Executable             string            `yaml:"executable"`
+	Args                   []string          `yaml:"args"`
+	Env                    map[string]string `yaml:"env"`
+	EnvFromFiles           map[string]string `yaml:"env_from_files"`
+	InheritEnv             []string          `yaml:"inherit_env"`
+	RequiredEnv            []string          `yaml:"required_env"`
+	SensitiveEnv           []string          `yaml:"sensitive_env"`
+	Accounts               string            `yaml:"accounts"`
+	AdditionalVolumes      []Volume          `yaml:"additional_volumes"`
+	After                  []string          `yaml:"after"`
+	Capabilities           []string          `yaml:"capabilities"`
+	CoreDumps              *CoreDumps        `yaml:"core_dumps"`
+	Devices                []Device          `yaml:"devices"`
+	EphemeralDisk          bool              `yaml:"ephemeral_disk"`
+	Hooks                  *Hooks            `yaml:"hooks,omitempty"`
+	Instances              int               `yaml:"instances,omitempty"`
+	JobDir                 *JobDir           `yaml:"job_dir"`
+	Labels                 map[string]string `yaml:"labels"`
+	Limits                 *Limits           `yaml:"limits"`
+	LogSink                *LogSink          `yaml:"log_sink"`
+	MemoryPressure         *MemoryPressure   `yaml:"memory_pressure"`
+	Network                *Network          `yaml:"network"`
+	Nice                   *int              `yaml:"nice"`
+	NUMANode               *int              `yaml:"numa_node"`
+	OCIHooks               *OCIHooks         `yaml:"oci_hooks"`
+	OOMScoreAdj            *int              `yaml:"oom_score_adj"`
+	Path                   []string          `yaml:"path"`
+	PersistentDisk         bool              `yaml:"persistent_disk"`
+	PersistentDiskReadOnly bool              `yaml:"persistent_disk_read_only"`
+	Ports                  []Port            `yaml:"ports"`
+	Realtime               *Realtime         `yaml:"realtime"`
+	Register               *Integration      `yaml:"register"`
+	Deregister             *Integration      `yaml:"deregister"`
+	Rlimits                map[string]string `yaml:"rlimits"`
+	Sockets                []Socket          `yaml:"sockets"`
+	TerminationLog         string            `yaml:"termination_log"`
+	Timezone               string            `yaml:"timezone"`
+	WorkDir                string            `yaml:"workdir"`
+	Unsafe                 *Unsafe           `yaml:"unsafe"`
+
+	// Overridden is set when a local override has changed the process's
+	// configuration.
+	Overridden bool `yaml:"-"`
+
+	// InstanceOf is the name of the process which this process is an
+	// instance of, when that process has instances.
+	InstanceOf string `yaml:"-"`
 }
 
 type Limits struct {
+	CPUs      *string `yaml:"cpus"`
+	CPUPeriod *uint64 `yaml:"cpu_period"`
+	CPUShares *uint64 `yaml:"cpu_shares"`
+	CPUSet    *string `yaml:"cpuset"`
 	Memory    *string `yaml:"memory"`
 	OpenFiles *uint64 `yaml:"open_files"`
 	Processes *int64  `yaml:"processes"`
+
+	// MemoryReservation is a soft limit which the kernel reclaims the
+	// process's memory down to when the host is short of memory, before
+	// any process reaches its hard limit. It is written like Memory.
+	MemoryReservation *string `yaml:"memory_reservation"`
+
+	// Swap limits memory and swap together, so a process may use Swap minus
+	// Memory of swap. It must be at least Memory.
+	Swap *string `yaml:"swap"`
+
+	// KernelMemory limits the memory which the kernel uses on behalf of the
+	// process, such as dentries, inodes, and socket buffers, so that leaks
+	// of kernel objects cannot exhaust the host. It is a size such as 256M.
+	KernelMemory *string `yaml:"kernel_memory"`
+
+	// Swappiness is how readily the kernel swaps out the process's memory
+	// rather than dropping its page cache, from 0 to 100.
+	Swappiness *uint64 `yaml:"swappiness"`
+
+	// IOWeight is the process's share of the bandwidth of the disks it uses
+	// when other processes are competing for them, from 10 to 1000.
+	IOWeight *uint16 `yaml:"io_weight"`
+
+	Blkio []BlkioLimit `yaml:"blkio"`
+
+	// Hugepages limits how much of the host's huge pages of each size the
+	// process may use. Both page sizes and limits are sizes such as 2M.
+	Hugepages map[string]string `yaml:"hugepages"`
+}
+
+// HugepageLimit is how many bytes of huge pages of one size a process may use.
+type HugepageLimit struct {
+	PageSize uint64
+	Limit    uint64
+}
+
+// HugepageLimits returns the huge page limits of the process in order of page
+// size.
+func (l *Limits) HugepageLimits() ([]HugepageLimit, error) {
+	var limits []HugepageLimit
+	for pageSize, limit := range l.Hugepages {
+		size, err := units.ParseSize(pageSize)
+		if err != nil || size == 0 {
+			return nil, fmt.Errorf("invalid hugepages page size %q: must be a size such as 2M or 1G", pageSize)
+		}
+
+		bytes, err := units.ParseSize(limit)
+		if err != nil {
+			return nil, fmt.Errorf("invalid hugepages limit for %s pages: %s", pageSize, err)
+		}
+		if bytes%size != 0 {
+			return nil, fmt.Errorf("invalid hugepages limit for %s pages: %s is not a whole number of pages", pageSize, limit)
+		}
+
+		limits = append(limits, HugepageLimit{PageSize: size, Limit: bytes})
+	}
+
+	sort.Slice(limits, func(i, j int) bool { return limits[i].PageSize < limits[j].PageSize })
+	for i := 1; i < len(limits); i++ {
+		if limits[i].PageSize == limits[i-1].PageSize {
+			return nil, fmt.Errorf("invalid hugepages: page size %d is given more than once", limits[i].PageSize)
+		}
+	}
+
+	return limits, nil
+}
+
+// BlkioLimit throttles the reads and writes of a process to a block device.
+// Device is the path of the device or of any file on the filesystem which is
+// on it, such as /var/vcap/data. Rates in bytes are sizes such as 50M, which
+// are per second. Unset rates are not limited.
+type BlkioLimit struct {
+	Device    string `yaml:"device"`
+	ReadBPS   string `yaml:"read_bps"`
+	WriteBPS  string `yaml:"write_bps"`
+	ReadIOPS  uint64 `yaml:"read_iops"`
+	WriteIOPS uint64 `yaml:"write_iops"`
+}
+
+// Rates returns the bytes per second which may be read and written, with
+// zero for a rate which is not limited.
+func (b *BlkioLimit) Rates() (readBPS, writeBPS uint64, err error) {
+	if b.ReadBPS != "" {
+		if readBPS, err = units.ParseSize(b.ReadBPS); err != nil {
+			return 0, 0, fmt.Errorf("invalid blkio read_bps of %s: %s", b.Device, err)
+		}
+	}
+
+	if b.WriteBPS != "" {
+		if writeBPS, err = units.ParseSize(b.WriteBPS); err != nil {
+			return 0, 0, fmt.Errorf("invalid blkio write_bps of %s: %s", b.Device, err)
+		}
+	}
+
+	return readBPS, writeBPS, nil
+}
+
+func (b *BlkioLimit) validate() error {
+	if !filepath.IsAbs(b.Device) {
+		return fmt.Errorf("invalid blkio device %q: must be an absolute path", b.Device)
+	}
+
+	readBPS, writeBPS, err := b.Rates()
+	if err != nil {
+		return err
+	}
+
+	if readBPS == 0 && writeBPS == 0 && b.ReadIOPS == 0 && b.WriteIOPS == 0 {
+		return fmt.Errorf("invalid blkio limit of %s: must set at least one of read_bps, write_bps, read_iops, or write_iops", b.Device)
+	}
+
+	return nil
+}
+
+// The bounds which the kernel puts on a CFS period, in microseconds, and on
+// the relative weight of a cgroup v1 cpu.shares.
+const (
+	minCPUPeriod = 1000
+	maxCPUPeriod = 1000000
+	minCPUShares = 2
+	maxCPUShares = 262144
+)
+
+// The bounds of a cgroup v1 blkio.weight. runc scales the weight onto the
+// wider range of io.weight under cgroup v2.
+const (
+	minIOWeight = 10
+	maxIOWeight = 1000
+)
+
+// CPUSetList returns the CPUs which the process is pinned to, in ascending
+// order.
+func (l *Limits) CPUSetList() ([]int, error) {
+	cpus, err := ParseCPUList(*l.CPUSet)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cpuset %q: %s", *l.CPUSet, err)
+	}
+
+	return cpus, nil
+}
+
+// ParseCPUList parses a list of CPUs in the format which the kernel uses for
+// cpusets, such as 0-3,7. The CPUs are returned in ascending order without
+// duplicates.
+func ParseCPUList(list string) ([]int, error) {
+	if strings.TrimSpace(list) == "" {
+		return nil, errors.New("must list at least one CPU")
+	}
+
+	seen := map[int]bool{}
+	var cpus []int
+	for _, part := range strings.Split(list, ",") {
+		part = strings.TrimSpace(part)
+
+		first, last := part, part
+		if i := strings.IndexByte(part, '-'); i >= 0 {
+			first, last = part[:i], part[i+1:]
+		}
+
+		from, err := strconv.ParseUint(first, 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a CPU or a range of CPUs such as 0-3", part)
+		}
+		to, err := strconv.ParseUint(last, 10, 16)
+		if err != nil || to < from {
+			return nil, fmt.Errorf("%q is not a CPU or a range of CPUs such as 0-3", part)
+		}
+
+		for cpu := int(from); cpu <= int(to); cpu++ {
+			if !seen[cpu] {
+				seen[cpu] = true
+				cpus = append(cpus, cpu)
+			}
+		}
+	}
+
+	sort.Ints(cpus)
+	return cpus, nil
+}
+
+// MemoryBytes returns the memory limit in bytes. A limit written as a
+// percentage such as 40% is a share of the host's total memory.
+func (l *Limits) MemoryBytes(hostTotal uint64) (uint64, error) {
+	return memoryBytes("memory limit", *l.Memory, hostTotal)
+}
+
+// MemoryReservationBytes returns the memory reservation in bytes.
+func (l *Limits) MemoryReservationBytes(hostTotal uint64) (uint64, error) {
+	return memoryBytes("memory reservation", *l.MemoryReservation, hostTotal)
+}
+
+func memoryBytes(name, memory string, hostTotal uint64) (uint64, error) {
+	memory = strings.TrimSpace(memory)
+	if !strings.HasSuffix(memory, "%") {
+		size, err := units.ParseSize(memory)
+		if err != nil {
+			return 0, fmt.Errorf("invalid %s: %s", name, err)
+		}
+		return size, nil
+	}
+
+	percent, err := strconv.ParseFloat(strings.TrimSuffix(memory, "%"), 64)
+	if err != nil || percent <= 0 || percent > 100 {
+		return 0, fmt.Errorf("invalid %s %q: a percentage must be greater than 0%% and at most 100%%", name, memory)
+	}
+
+	if hostTotal == 0 {
+		return 0, fmt.Errorf("invalid %s %q: the host's total memory is unknown", name, memory)
+	}
+
+	return uint64(float64(hostTotal) * percent / 100), nil
+}
+
+// SwapBytes returns the limit on memory and swap together in bytes.
+func (l *Limits) SwapBytes() (uint64, error) {
+	size, err := units.ParseSize(*l.Swap)
+	if err != nil {
+		return 0, fmt.Errorf("invalid swap limit: %s", err)
+	}
+
+	return size, nil
+}
+
+// KernelMemoryBytes returns the kernel memory limit in bytes.
+func (l *Limits) KernelMemoryBytes() (uint64, error) {
+	size, err := units.ParseSize(*l.KernelMemory)
+	if err != nil {
+		return 0, fmt.Errorf("invalid kernel memory limit: %s", err)
+	}
+	if size == 0 {
+		return 0, errors.New("invalid kernel memory limit: must be more than zero")
+	}
+
+	return size, nil
+}
+
+// allButPrefix introduces a CPU limit of every CPU of the host but the given
+// number, such as all-but:1.
+const allButPrefix = "all-but:"
+
+// CPUCount returns the number of CPUs which the process may use. A limit can
+// be a number of CPUs such as 1.5, a percentage of the host's CPUs such as
+// 50%, or all-but:N to leave N of the host's CPUs for everything else.
+func (l *Limits) CPUCount(hostCPUs int) (float64, error) {
+	cpus := strings.TrimSpace(*l.CPUs)
+
+	var count float64
+	switch {
+	case strings.HasSuffix(cpus, "%"):
+		percent, err := strconv.ParseFloat(strings.TrimSuffix(cpus, "%"), 64)
+		if err != nil || percent <= 0 || percent > 100 {
+			return 0, fmt.Errorf("invalid cpus limit %q: a percentage must be greater than 0%% and at most 100%%", cpus)
+		}
+		count = float64(hostCPUs) * percent / 100
+	case strings.HasPrefix(cpus, allButPrefix):
+		spare, err := strconv.Atoi(strings.TrimPrefix(cpus, allButPrefix))
+		if err != nil || spare < 0 {
+			return 0, fmt.Errorf("invalid cpus limit %q: %s must be followed by a number of CPUs", cpus, allButPrefix)
+		}
+		count = float64(hostCPUs - spare)
+	default:
+		var err error
+		count, err = strconv.ParseFloat(cpus, 64)
+		if err != nil || count <= 0 {
+			return 0, fmt.Errorf("invalid cpus limit %q: must be a positive number, a percentage, or %sN", cpus, allButPrefix)
+		}
+	}
+
+	if count <= 0 {
+		return 0, fmt.Errorf("invalid cpus limit %q: leaves no CPUs on a host with %d", cpus, hostCPUs)
+	}
+
+	return count, nil
+}
+
+func (l *Limits) validate() error {
+	// Any host size will do as only the format of the limits is being
+	// checked. It is big enough that no all-but limit leaves nothing.
+	if l.Memory != nil {
+		if _, err := l.MemoryBytes(1); err != nil {
+			return fmt.Errorf("invalid limits: %s", err)
+		}
+	}
+
+	if l.Swap != nil {
+		if l.Memory == nil {
+			return errors.New("invalid limits: swap requires memory")
+		}
+
+		swap, err := l.SwapBytes()
+		if err != nil {
+			return fmt.Errorf("invalid limits: %s", err)
+		}
+
+		// A percentage of the host's memory can only be compared once the
+		// host is known, when the process is started.
+		if !strings.HasSuffix(strings.TrimSpace(*l.Memory), "%") {
+			memory, _ := l.MemoryBytes(1)
+			if swap < memory {
+				return fmt.Errorf("invalid limits: swap (%s) must be at least memory (%s) as it limits memory and swap together", *l.Swap, *l.Memory)
+			}
+		}
+	}
+
+	if l.MemoryReservation != nil {
+		if _, err := l.MemoryReservationBytes(1); err != nil {
+			return fmt.Errorf("invalid limits: %s", err)
+		}
+
+		// A size and a percentage can only be compared once the host is
+		// known, but two of the same kind can be compared on any host.
+		if l.Memory != nil && strings.HasSuffix(strings.TrimSpace(*l.Memory), "%") == strings.HasSuffix(strings.TrimSpace(*l.MemoryReservation), "%") {
+			const anyHost = 1 << 40
+			reservation, _ := l.MemoryReservationBytes(anyHost)
+			memory, _ := l.MemoryBytes(anyHost)
+			if reservation > memory {
+				return fmt.Errorf("invalid limits: memory_reservation (%s) must not be more than memory (%s)", *l.MemoryReservation, *l.Memory)
+			}
+		}
+	}
+
+	if l.KernelMemory != nil {
+		if _, err := l.KernelMemoryBytes(); err != nil {
+			return fmt.Errorf("invalid limits: %s", err)
+		}
+	}
+
+	if l.Swappiness != nil && *l.Swappiness > 100 {
+		return fmt.Errorf("invalid limits: swappiness %d must be between 0 and 100", *l.Swappiness)
+	}
+
+	if l.IOWeight != nil && (*l.IOWeight < minIOWeight || *l.IOWeight > maxIOWeight) {
+		return fmt.Errorf("invalid limits: io_weight must be between %d and %d but got %d", minIOWeight, maxIOWeight, *l.IOWeight)
+	}
+
+	if l.CPUs != nil {
+		if _, err := l.CPUCount(math.MaxInt32); err != nil {
+			return fmt.Errorf("invalid limits: %s", err)
+		}
+	}
+
+	if l.CPUPeriod != nil {
+		if l.CPUs == nil {
+			return errors.New("invalid limits: cpu_period requires cpus")
+		}
+		if *l.CPUPeriod < minCPUPeriod || *l.CPUPeriod > maxCPUPeriod {
+			return fmt.Errorf("invalid limits: cpu_period must be between %d and %d microseconds but got %d", minCPUPeriod, maxCPUPeriod, *l.CPUPeriod)
+		}
+	}
+
+	if l.CPUShares != nil && (*l.CPUShares < minCPUShares || *l.CPUShares > maxCPUShares) {
+		return fmt.Errorf("invalid limits: cpu_shares must be between %d and %d but got %d", minCPUShares, maxCPUShares, *l.CPUShares)
+	}
+
+	if l.CPUSet != nil {
+		if _, err := l.CPUSetList(); err != nil {
+			return fmt.Errorf("invalid limits: %s", err)
+		}
+	}
+
+	for _, blkio := range l.Blkio {
+		if err := blkio.validate(); err != nil {
+			return fmt.Errorf("invalid limits: %s", err)
+		}
+	}
+
+	if _, err := l.HugepageLimits(); err != nil {
+		return fmt.Errorf("invalid limits: %s", err)
+	}
+
+	return nil
+}
+
+// LogSink selects where the stdout and stderr of a process are written. The
+// available types and their options are defined by the logsink package.
+type LogSink struct {
+	Type    string            `yaml:"type"`
+	Options map[string]string `yaml:"options"`
+}
+
+// JobDir restricts how much of the job directory (/var/vcap/jobs/JOB) is
+// mounted into the container. All of it is mounted by default, which lets a
+// process read the templates rendered for every other process of the job.
+// Paths are relative to the job directory and are mounted read-only.
+type JobDir struct {
+	Disabled bool     `yaml:"disabled"`
+	Paths    []string `yaml:"paths"`
+}
+
+// CoreDumps enables capturing the core dumps of a process in its job's log
+// directory. MaxSize is a size such as 512M and defaults to
+// DefaultCoreDumpMaxSize. Only the newest MaxCount cores are kept.
+type CoreDumps struct {
+	MaxSize  string `yaml:"max_size"`
+	MaxCount int    `yaml:"max_count"`
+}
+
+const (
+	DefaultCoreDumpMaxSize  = "1G"
+	DefaultCoreDumpMaxCount = 3
+)
+
+// Limits returns the maximum size of each core in bytes and how many are
+// kept, with defaults filled in.
+func (d *CoreDumps) Limits() (uint64, int, error) {
+	maxSize := d.MaxSize
+	if maxSize == "" {
+		maxSize = DefaultCoreDumpMaxSize
+	}
+
+	size, err := units.ParseSize(maxSize)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid core_dumps: max_size %s", err)
+	}
+
+	count := d.MaxCount
+	if count == 0 {
+		count = DefaultCoreDumpMaxCount
+	}
+
+	return size, count, nil
+}
+
+func (d *CoreDumps) validate() error {
+	if d.MaxCount < 0 {
+		return fmt.Errorf("invalid core_dumps: max_count %d must not be negative", d.MaxCount)
+	}
+
+	_, _, err := d.Limits()
+	return err
 }
 
 type Hooks struct {
 	PreStart string `yaml:"pre_start"`
+
+	// PreStartInContainer runs the pre_start hook in a short-lived
+	// container built from the same spec as the process rather than on the
+	// host.
+	PreStartInContainer bool `yaml:"pre_start_in_container"`
+
+	// PreBackup and PostBackup are run on the host by `bpm backup` before
+	// and after the backup is taken. PostBackup is only run if PreBackup
+	// succeeded.
+	PreBackup  string `yaml:"pre_backup"`
+	PostBackup string `yaml:"post_backup"`
+
+	// BackupQuiesce says how the process is kept still while the backup
+	// is taken. It is one of the BackupQuiesce constants and defaults to
+	// BackupQuiescePause.
+	BackupQuiesce string `yaml:"backup_quiesce"`
+}
+
+const (
+	// BackupQuiescePause freezes every process in the container while
+	// the backup is taken.
+	BackupQuiescePause = "pause"
+
+	// BackupQuiesceNone leaves the process running, for processes whose
+	// pre_backup hook quiesces them (by flushing and locking their data,
+	// for example).
+	BackupQuiesceNone = "none"
+)
+
+// BackupQuiesce returns how the process is kept still while it is backed up.
+func (c *ProcessConfig) BackupQuiesce() string {
+	if c.Hooks == nil || c.Hooks.BackupQuiesce == "" {
+		return BackupQuiescePause
+	}
+
+	return c.Hooks.BackupQuiesce
+}
+
+// OwnIdentity is true when the process has a hostname and machine ID of its
+// own rather than seeing the host's.
+func (c *ProcessConfig) OwnIdentity() bool {
+	return c.Unsafe == nil || !c.Unsafe.HostUTSNamespace
+}
+
+func (c *ProcessConfig) validatePath() error {
+	if len(c.Path) == 0 {
+		return nil
+	}
+
+	if _, ok := c.Env["PATH"]; ok {
+		return errors.New("invalid path: cannot be combined with env PATH, which replaces the whole PATH")
+	}
+
+	for _, dir := range c.Path {
+		if !filepath.IsAbs(dir) || filepath.Clean(dir) != dir || strings.Contains(dir, ":") {
+			return fmt.Errorf("invalid path: %q must be an absolute and canonical directory", dir)
+		}
+	}
+
+	return nil
+}
+
+const (
+	// AccountsHost binds the host's /etc/passwd and /etc/group read-only
+	// into the container so that any user or group on the host can be
+	// resolved.
+	AccountsHost = "host"
+
+	// AccountsMinimal replaces /etc/passwd and /etc/group with files
+	// generated by bpm which only describe root and the user the process
+	// runs as.
+	AccountsMinimal = "minimal"
+)
+
+// Realtime schedules a process with a realtime policy (RealtimeFIFO or
+// RealtimeRR) at a priority from 1 to 99. Runtime is how much CPU time the
+// process may use in each Period, a duration which defaults to
+// DefaultRealtimePeriod, so that it cannot lock up the host.
+type Realtime struct {
+	Policy   string `yaml:"policy"`
+	Priority int    `yaml:"priority"`
+	Runtime  string `yaml:"runtime"`
+	Period   string `yaml:"period"`
+}
+
+const (
+	RealtimeFIFO = "fifo"
+	RealtimeRR   = "rr"
+
+	DefaultRealtimePeriod = "1s"
+)
+
+// Budget returns the runtime and period of the process in microseconds, with
+// the default period filled in.
+func (r *Realtime) Budget() (int64, uint64, error) {
+	runtime, err := units.ParseDuration(r.Runtime)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid realtime: runtime %s", err)
+	}
+
+	period := r.Period
+	if period == "" {
+		period = DefaultRealtimePeriod
+	}
+
+	periodDuration, err := units.ParseDuration(period)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid realtime: period %s", err)
+	}
+
+	return runtime.Microseconds(), uint64(periodDuration.Microseconds()), nil
+}
+
+func (r *Realtime) validate() error {
+	if r.Policy != RealtimeFIFO && r.Policy != RealtimeRR {
+		return fmt.Errorf("invalid realtime: policy must be %q or %q but got %q", RealtimeFIFO, RealtimeRR, r.Policy)
+	}
+
+	if r.Priority < 1 || r.Priority > 99 {
+		return fmt.Errorf("invalid realtime: priority %d must be between 1 and 99", r.Priority)
+	}
+
+	if r.Runtime == "" {
+		return errors.New("invalid realtime: runtime must be set")
+	}
+
+	runtime, period, err := r.Budget()
+	if err != nil {
+		return err
+	}
+
+	if runtime <= 0 || uint64(runtime) > period {
+		return fmt.Errorf("invalid realtime: runtime %s must be more than zero and no more than the period", r.Runtime)
+	}
+
+	return nil
+}
+
+// OCIHooks are handed to the container runtime unchanged so that integrations
+// which rely on the standard OCI hook mechanism (e.g. CNI plugins or device
+// managers) can be used. Unlike the pre_start hook they are run by runc itself
+// at the corresponding point in the container's lifecycle.
+type OCIHooks struct {
+	Prestart  []OCIHook `yaml:"prestart"`
+	Poststart []OCIHook `yaml:"poststart"`
+	Poststop  []OCIHook `yaml:"poststop"`
+}
+
+type OCIHook struct {
+	Path    string            `yaml:"path"`
+	Args    []string          `yaml:"args"`
+	Env     map[string]string `yaml:"env"`
+	Timeout string            `yaml:"timeout"`
+}
+
+// TimeoutSeconds returns how long the hook may run in whole seconds, rounded
+// up, as runc only accepts a number of seconds. It is nil if the hook has no
+// timeout.
+func (h *OCIHook) TimeoutSeconds() (*int, error) {
+	if h.Timeout == "" {
+		return nil, nil
+	}
+
+	timeout, err := units.ParseDuration(h.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	if timeout == 0 {
+		return nil, errors.New("timeout must be positive")
+	}
+
+	seconds := int((timeout + time.Second - 1) / time.Second)
+	return &seconds, nil
 }
 
 type Volume struct {
@@ -62,12 +713,123 @@ type Volume struct {
 	AllowExecutions bool   `yaml:"allow_executions"`
 	MountOnly       bool   `yaml:"mount_only"`
 	Shared          bool   `yaml:"shared"`
+	Lock            bool   `yaml:"lock"`
+}
+
+// VolumeLockFile is the name of the lock file which bpm creates at the top of
+// a volume with lock set. Processes sharing the volume can take an advisory
+// lock (flock(2)) on it to coordinate with each other and with `bpm start
+// --wait-for-lock`.
+const VolumeLockFile = ".bpm.lock"
+
+// LockVolumes returns the host paths of the lock files of the process's
+// volumes which have lock set, in the order they should be locked in.
+func (c *ProcessConfig) LockVolumes(bpmCfg *BPMConfig) []string {
+	var paths []string
+	for _, vol := range c.AdditionalVolumes {
+		if vol.Lock {
+			paths = append(paths, filepath.Join(bpmCfg.HostPath(vol.Path), VolumeLockFile))
+		}
+	}
+
+	// Every process takes the locks in the same order so that two which
+	// share more than one volume cannot deadlock.
+	sort.Strings(paths)
+	return paths
+}
+
+// ConfigChecksumAnnotation records the checksum of the configuration which
+// the bundle of a process was built from.
+const ConfigChecksumAnnotation = "bpm.config_checksum"
+
+// Checksum identifies the configuration of the process. A bundle built from a
+// configuration with the same checksum can be reused to start the process
+// again. It is empty if the configuration cannot be serialized.
+func (c *ProcessConfig) Checksum() string {
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return ""
+	}
+
+	return fmt.Sprintf("%x", sha256.Sum256(data))
+}
+
+// Socket describes a unix socket which the process serves on. The directory
+// containing the socket is created by bpm and mounted into the container.
+// Once the process has created the socket bpm gives it the configured
+// ownership and permissions so that other jobs can connect to it without the
+// directory being world-writable.
+type Socket struct {
+	Path  string `yaml:"path"`
+	Owner string `yaml:"owner"`
+	Group string `yaml:"group"`
+	Mode  string `yaml:"mode"`
+}
+
+// Port is a port which a process is expected to listen on. It is only used to
+// check that the process has bound it: containers share the host's network.
+type Port struct {
+	Port     int    `yaml:"port"`
+	Protocol string `yaml:"protocol"`
+}
+
+// String returns the port written as PORT/PROTOCOL, such as 8080/tcp. The
+// protocol defaults to tcp.
+func (p Port) String() string {
+	protocol := p.Protocol
+	if protocol == "" {
+		protocol = "tcp"
+	}
+
+	return fmt.Sprintf("%d/%s", p.Port, protocol)
+}
+
+func (p Port) validate() error {
+	if p.Port < 1 || p.Port > 65535 {
+		return fmt.Errorf("invalid ports: %d is not a port number", p.Port)
+	}
+
+	switch p.Protocol {
+	case "", "tcp", "udp":
+		return nil
+	default:
+		return fmt.Errorf("invalid ports: protocol of %d must be tcp or udp but got %q", p.Port, p.Protocol)
+	}
+}
+
+// DefaultSocketMode is the mode given to a socket when the configuration does
+// not specify one.
+const DefaultSocketMode os.FileMode = 0660
+
+// SocketDirMode is the mode of the directory containing a socket, which
+// belongs to the user of the process and the group of the socket. Members of
+// the group may reach the socket but not create or remove files beside it.
+const SocketDirMode os.FileMode = 0750
+
+// Dir returns the directory which contains the socket.
+func (s Socket) Dir() string {
+	return filepath.Dir(s.Path)
+}
+
+// FileMode parses the configured octal mode of the socket.
+func (s Socket) FileMode() (os.FileMode, error) {
+	if s.Mode == "" {
+		return DefaultSocketMode, nil
+	}
+
+	mode, err := strconv.ParseUint(s.Mode, 8, 32)
+	if err != nil || mode > 0777 {
+		return 0, fmt.Errorf("invalid socket mode: %q must be an octal permission such as 0660", s.Mode)
+	}
+
+	return os.FileMode(mode), nil
 }
 
 type Unsafe struct {
 	Privileged          bool     `yaml:"privileged"`
 	UnrestrictedVolumes []Volume `yaml:"unrestricted_volumes"`
 	HostPidNamespace    bool     `yaml:"host_pid_namespace"`
+	HostUTSNamespace    bool     `yaml:"host_uts_namespace"`
 }
 
 func ParseJobConfig(configPath string) (*JobConfig, error) {
@@ -105,20 +867,25 @@ func (c *ProcessConfig) Validate(boshEnv *bosh.Env, defaultVolumes []string) err
 		return errors.New("invalid config: executable")
 	}
 
+	if c.PersistentDiskReadOnly && !c.PersistentDisk {
+		return errors.New("invalid persistent_disk_read_only: persistent_disk must also be set")
+	}
+
 	for _, vol := range c.AdditionalVolumes {
 		volCleaned := filepath.Clean(vol.Path)
 		if volCleaned != vol.Path {
 			return fmt.Errorf("volume path must be canonical, expected %s but got %s", volCleaned, vol.Path)
 		}
 
-		if contains(defaultVolumes, volCleaned) {
+		hostPath, ok := boshEnv.Resolve(volCleaned)
+		if ok && contains(defaultVolumes, hostPath.External()) {
 			return fmt.Errorf(
 				"invalid volume path: %s cannot conflict with default job data or store directories",
 				vol.Path,
 			)
 		}
 
-		if !pathIsIn(volCleaned, boshEnv.Root().External()) {
+		if !ok {
 			return fmt.Errorf(
 				"invalid volume path: %s must be within %s",
 				vol.Path,
@@ -127,6 +894,298 @@ func (c *ProcessConfig) Validate(boshEnv *bosh.Env, defaultVolumes []string) err
 		}
 	}
 
+	for _, sock := range c.Sockets {
+		if err := validateSocket(sock, boshEnv, defaultVolumes); err != nil {
+			return err
+		}
+	}
+
+	for _, port := range c.Ports {
+		if err := port.validate(); err != nil {
+			return err
+		}
+	}
+
+	for name, path := range c.EnvFromFiles {
+		if _, ok := c.Env[name]; ok {
+			return fmt.Errorf("invalid env_from_files: %s is also set in env", name)
+		}
+
+		if !filepath.IsAbs(path) || filepath.Clean(path) != path {
+			return fmt.Errorf("invalid env_from_files: path for %s must be absolute and canonical but got %q", name, path)
+		}
+	}
+
+	for _, name := range c.InheritEnv {
+		if name == "" || strings.ContainsAny(name, "= ") {
+			return fmt.Errorf("invalid inherit_env: %q is not a variable name", name)
+		}
+
+		if _, ok := c.Env[name]; ok {
+			return fmt.Errorf("invalid inherit_env: %s is also set in env", name)
+		}
+
+		if _, ok := c.EnvFromFiles[name]; ok {
+			return fmt.Errorf("invalid inherit_env: %s is also set in env_from_files", name)
+		}
+	}
+
+	if err := c.validateRequiredEnv(); err != nil {
+		return err
+	}
+
+	if err := c.validatePath(); err != nil {
+		return err
+	}
+
+	switch c.Accounts {
+	case "", AccountsHost, AccountsMinimal:
+	default:
+		return fmt.Errorf("invalid accounts: must be %q or %q but got %q", AccountsHost, AccountsMinimal, c.Accounts)
+	}
+
+	if c.TerminationLog != "" && (!filepath.IsAbs(c.TerminationLog) || filepath.Clean(c.TerminationLog) != c.TerminationLog) {
+		return fmt.Errorf("invalid termination_log: path must be absolute and canonical but got %q", c.TerminationLog)
+	}
+
+	if c.JobDir != nil {
+		if err := c.JobDir.validate(); err != nil {
+			return err
+		}
+	}
+
+	if c.Limits != nil {
+		if err := c.Limits.validate(); err != nil {
+			return err
+		}
+	}
+
+	if c.CoreDumps != nil {
+		if err := c.CoreDumps.validate(); err != nil {
+			return err
+		}
+	}
+
+	if err := c.validateRlimits(); err != nil {
+		return err
+	}
+
+	if c.LogSink != nil && c.LogSink.Type == "" {
+		return errors.New("invalid log_sink: type must be set")
+	}
+
+	if c.Nice != nil && (*c.Nice < -20 || *c.Nice > 19) {
+		return fmt.Errorf("invalid nice: %d must be between -20 and 19", *c.Nice)
+	}
+
+	if c.Realtime != nil {
+		if err := c.Realtime.validate(); err != nil {
+			return err
+		}
+
+		if c.Nice != nil {
+			return errors.New("invalid realtime: cannot be combined with nice, which only applies to processes which are not realtime")
+		}
+	}
+
+	if c.OOMScoreAdj != nil && (*c.OOMScoreAdj < -1000 || *c.OOMScoreAdj > 1000) {
+		return fmt.Errorf("invalid oom_score_adj: %d must be between -1000 and 1000", *c.OOMScoreAdj)
+	}
+
+	if c.NUMANode != nil && *c.NUMANode < 0 {
+		return fmt.Errorf("invalid numa_node: %d must not be negative", *c.NUMANode)
+	}
+
+	if c.Timezone != "" && (filepath.IsAbs(c.Timezone) || filepath.Clean(c.Timezone) != c.Timezone || strings.HasPrefix(c.Timezone, "..")) {
+		return fmt.Errorf("invalid timezone: %q must be a zone name such as Europe/London", c.Timezone)
+	}
+
+	for key := range c.Labels {
+		if err := validateLabel(key); err != nil {
+			return err
+		}
+	}
+
+	if c.Hooks != nil && c.Hooks.PreStartInContainer && c.Hooks.PreStart == "" {
+		return errors.New("invalid hooks: pre_start_in_container requires pre_start")
+	}
+
+	switch c.BackupQuiesce() {
+	case BackupQuiescePause, BackupQuiesceNone:
+	default:
+		return fmt.Errorf("invalid hooks: backup_quiesce must be %q or %q but got %q", BackupQuiescePause, BackupQuiesceNone, c.Hooks.BackupQuiesce)
+	}
+
+	if c.OCIHooks != nil {
+		if err := c.OCIHooks.validate(); err != nil {
+			return err
+		}
+	}
+
+	for _, after := range c.After {
+		if _, _, err := parseAfter(after); err != nil {
+			return err
+		}
+	}
+
+	if err := c.validateDevices(); err != nil {
+		return err
+	}
+
+	if err := c.validateMemoryPressure(); err != nil {
+		return err
+	}
+
+	if err := c.validateInstances(); err != nil {
+		return err
+	}
+
+	if c.Network != nil {
+		if err := c.Network.validate(); err != nil {
+			return err
+		}
+	}
+
+	if c.Register != nil {
+		if err := c.Register.validate("register"); err != nil {
+			return err
+		}
+	}
+
+	if c.Deregister != nil {
+		if err := c.Deregister.validate("deregister"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (d *JobDir) validate() error {
+	if d.Disabled && len(d.Paths) > 0 {
+		return errors.New("invalid job_dir: paths cannot be given when the job directory is disabled")
+	}
+
+	for _, path := range d.Paths {
+		if path == "" || path == "." || filepath.IsAbs(path) || filepath.Clean(path) != path || path == ".." || strings.HasPrefix(path, "../") {
+			return fmt.Errorf("invalid job_dir: path %q must be canonical and relative to the job directory", path)
+		}
+	}
+
+	return nil
+}
+
+func (h *OCIHooks) validate() error {
+	stages := []struct {
+		name  string
+		hooks []OCIHook
+	}{
+		{"prestart", h.Prestart},
+		{"poststart", h.Poststart},
+		{"poststop", h.Poststop},
+	}
+
+	for _, stage := range stages {
+		for _, hook := range stage.hooks {
+			if !filepath.IsAbs(hook.Path) || filepath.Clean(hook.Path) != hook.Path {
+				return fmt.Errorf("invalid oci_hooks: %s hook path must be absolute and canonical but got %q", stage.name, hook.Path)
+			}
+
+			if _, err := hook.TimeoutSeconds(); err != nil {
+				return fmt.Errorf("invalid oci_hooks: %s hook %s: %s", stage.name, hook.Path, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// validateRequiredEnv checks that every variable which the process declares
+// it requires has been given a value. Variables are often populated from
+// rendered job properties and secrets so an empty value is treated as missing.
+// Variables read from files or inherited from the host are only available
+// once the process starts and so are assumed to be present.
+func (c *ProcessConfig) validateRequiredEnv() error {
+	var missing []string
+	for _, name := range c.RequiredEnv {
+		if _, ok := c.EnvFromFiles[name]; ok {
+			continue
+		}
+
+		if contains(c.InheritEnv, name) {
+			continue
+		}
+
+		if strings.TrimSpace(c.Env[name]) == "" {
+			missing = append(missing, name)
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("missing required environment variables: %s", strings.Join(missing, ", "))
+	}
+
+	return nil
+}
+
+// SecretReferencePattern matches a reference to a secret in a secret store
+// (CredHub) such as ((/deployment/job/password)) in an environment variable.
+var SecretReferencePattern = regexp.MustCompile(`\(\(([-\w./]+)\)\)`)
+
+// HasSecretReferences returns whether any value in the environment refers to
+// a secret which must be fetched when the process starts.
+func HasSecretReferences(env map[string]string) bool {
+	for _, v := range env {
+		if SecretReferencePattern.MatchString(v) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// reservedLabelPrefix is the annotation namespace which the OCI runtime
+// specification reserves for its own use.
+const reservedLabelPrefix = "org.opencontainers."
+
+func validateLabel(key string) error {
+	if strings.TrimSpace(key) == "" {
+		return errors.New("invalid label: keys must not be empty")
+	}
+
+	if strings.HasPrefix(key, reservedLabelPrefix) {
+		return fmt.Errorf("invalid label: %s uses the reserved %s namespace", key, reservedLabelPrefix)
+	}
+
+	return nil
+}
+
+func validateSocket(sock Socket, boshEnv *bosh.Env, defaultVolumes []string) error {
+	sockCleaned := filepath.Clean(sock.Path)
+	if sockCleaned != sock.Path {
+		return fmt.Errorf("socket path must be canonical, expected %s but got %s", sockCleaned, sock.Path)
+	}
+
+	hostDir, ok := boshEnv.Resolve(sock.Dir())
+	if ok && contains(defaultVolumes, hostDir.External()) {
+		return fmt.Errorf(
+			"invalid socket path: %s cannot be placed directly in the default job data or store directories",
+			sock.Path,
+		)
+	}
+
+	if !ok {
+		return fmt.Errorf(
+			"invalid socket path: %s must be in a directory within %s",
+			sock.Path,
+			boshEnv.Root().External(),
+		)
+	}
+
+	if _, err := sock.FileMode(); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -158,6 +1217,8 @@ func (c *ProcessConfig) AddVolumes(
 					v.AllowExecutions = true
 				case "shared":
 					v.Shared = true
+				case "lock":
+					v.Lock = true
 				default:
 					return fmt.Errorf("invalid volume option: %s", option)
 				}
@@ -202,31 +1263,3 @@ func contains(elements []string, s string) bool {
 
 	return false
 }
-
-func pathIsIn(path string, prefixes ...string) bool {
-	volParts := strings.Split(path, "/")
-
-	for _, prefix := range prefixes {
-		validParts := strings.Split(prefix, "/")
-
-		if len(volParts) <= len(validParts) {
-			continue
-		}
-
-		match := true
-		for i, validPart := range validParts {
-			if volParts[i] != validPart {
-				match = false
-				break
-			}
-		}
-
-		if !match {
-			continue
-		}
-
-		return true
-	}
-
-	return false
-}
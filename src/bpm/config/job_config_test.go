@@ -16,6 +16,8 @@
 package config_test
 
 import (
+	"path/filepath"
+
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 
@@ -59,7 +61,25 @@ var _ = Describe("Config", func() {
 				config.Volume{Path: "/var/vcap/data/jna-tmp", Writable: true, AllowExecutions: true},
 				config.Volume{Path: "/var/vcap/data/shared", Shared: true},
 			))
+			Expect(cfg.Processes[0].Sockets).To(ConsistOf(
+				config.Socket{Path: "/var/vcap/sys/run/program/program.sock", Owner: "vcap", Group: "syslog", Mode: "0750"},
+			))
+			Expect(cfg.Processes[0].EnvFromFiles).To(Equal(map[string]string{"SECRET": "/var/vcap/jobs/program/config/secret"}))
+			Expect(cfg.Processes[0].RequiredEnv).To(ConsistOf("FOO"))
+			Expect(cfg.Processes[0].Labels).To(Equal(map[string]string{
+				"org.cloudfoundry.deployment": "cf",
+				"org.cloudfoundry.release":    "program",
+			}))
 			Expect(cfg.Processes[0].Hooks.PreStart).To(Equal("/var/vcap/jobs/program/bin/pre"))
+			Expect(cfg.Processes[0].OCIHooks).To(Equal(&config.OCIHooks{
+				Prestart: []config.OCIHook{{
+					Path:    "/var/vcap/packages/cni/bin/setup",
+					Args:    []string{"--network", "overlay"},
+					Env:     map[string]string{"CNI_PATH": "/var/vcap/packages/cni/bin"},
+					Timeout: "5",
+				}},
+				Poststop: []config.OCIHook{{Path: "/var/vcap/packages/cni/bin/teardown"}},
+			}))
 			Expect(cfg.Processes[0].Capabilities).To(ConsistOf("NET_BIND_SERVICE", "SYS_TIME"))
 			Expect(cfg.Processes[0].WorkDir).To(Equal("/I/AM/A/WORKDIR"))
 			Expect(cfg.Processes[0].PersistentDisk).To(BeTrue())
@@ -156,6 +176,77 @@ var _ = Describe("Config", func() {
 			})
 		})
 
+		Context("when the config has ports", func() {
+			It("returns a validation error when a port is invalid", func() {
+				jobCfg.Processes[0].Ports = []config.Port{{Port: 8080}, {Port: 53, Protocol: "udp"}}
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(Succeed())
+
+				jobCfg.Processes[0].Ports = []config.Port{{Port: 0}}
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(MatchError("invalid ports: 0 is not a port number"))
+
+				jobCfg.Processes[0].Ports = []config.Port{{Port: 70000}}
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(HaveOccurred())
+
+				jobCfg.Processes[0].Ports = []config.Port{{Port: 8080, Protocol: "sctp"}}
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(MatchError(`invalid ports: protocol of 8080 must be tcp or udp but got "sctp"`))
+			})
+
+			It("writes them with their protocol", func() {
+				Expect(config.Port{Port: 8080}.String()).To(Equal("8080/tcp"))
+				Expect(config.Port{Port: 53, Protocol: "udp"}.String()).To(Equal("53/udp"))
+			})
+		})
+
+		Context("when pre_start_in_container is set without a pre_start hook", func() {
+			It("returns a validation error", func() {
+				jobCfg.Processes[0].Hooks = &config.Hooks{PreStartInContainer: true}
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(MatchError(ContainSubstring("pre_start_in_container requires pre_start")))
+
+				jobCfg.Processes[0].Hooks.PreStart = "/var/vcap/jobs/example/bin/pre"
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(Succeed())
+			})
+		})
+
+		Context("when the config sets how the process is quiesced for backups", func() {
+			It("defaults to pausing the process", func() {
+				Expect(jobCfg.Processes[0].BackupQuiesce()).To(Equal(config.BackupQuiescePause))
+
+				jobCfg.Processes[0].Hooks = &config.Hooks{BackupQuiesce: "none"}
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(Succeed())
+				Expect(jobCfg.Processes[0].BackupQuiesce()).To(Equal(config.BackupQuiesceNone))
+			})
+
+			It("returns a validation error on an unknown way of quiescing", func() {
+				jobCfg.Processes[0].Hooks = &config.Hooks{BackupQuiesce: "stop"}
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(MatchError(`invalid hooks: backup_quiesce must be "pause" or "none" but got "stop"`))
+			})
+		})
+
+		Context("when bpm is using a BOSH root other than /var/vcap", func() {
+			var otherEnv *bosh.Env
+
+			BeforeEach(func() {
+				otherEnv = bosh.NewEnv("/var/vcap/data/nested")
+			})
+
+			It("accepts volumes written as they are seen in the container or on the host", func() {
+				jobCfg.Processes[0].AdditionalVolumes = []config.Volume{
+					{Path: "/var/vcap/data/valid"},
+					{Path: "/var/vcap/data/nested/data/valid"},
+				}
+				Expect(jobCfg.Validate(otherEnv, []string{})).To(Succeed())
+			})
+
+			It("checks for conflicts with the default volumes of the root", func() {
+				jobCfg.Processes[0].AdditionalVolumes = []config.Volume{
+					{Path: "/var/vcap/data/job-name"},
+				}
+				Expect(jobCfg.Validate(otherEnv, []string{
+					"/var/vcap/data/nested/data/job-name",
+				})).To(HaveOccurred())
+			})
+		})
+
 		Context("when the config has additional_volumes that conflict with default volumes", func() {
 			It("returns a validation error", func() {
 				jobCfg.Processes[0].AdditionalVolumes = []config.Volume{
@@ -167,6 +258,834 @@ var _ = Describe("Config", func() {
 			})
 		})
 
+		Context("when the config has sockets", func() {
+			It("does not error on a valid socket", func() {
+				jobCfg.Processes[0].Sockets = []config.Socket{
+					{Path: "/var/vcap/sys/run/example/api.sock", Group: "vcap", Mode: "0750"},
+					{Path: "/var/vcap/data/example/sockets/admin.sock"},
+				}
+				Expect(jobCfg.Validate(boshEnv, []string{"/var/vcap/data/example"})).To(Succeed())
+			})
+
+			It("returns a validation error when the path is not canonical", func() {
+				jobCfg.Processes[0].Sockets = []config.Socket{
+					{Path: "/var/vcap/sys/run/example/../api.sock"},
+				}
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(HaveOccurred())
+			})
+
+			It("returns a validation error when the directory is not nested in the bosh root", func() {
+				jobCfg.Processes[0].Sockets = []config.Socket{
+					{Path: "/var/vcap/api.sock"},
+				}
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(HaveOccurred())
+
+				jobCfg.Processes[0].Sockets = []config.Socket{
+					{Path: "/run/api.sock"},
+				}
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(HaveOccurred())
+			})
+
+			It("returns a validation error when the directory is a default volume", func() {
+				jobCfg.Processes[0].Sockets = []config.Socket{
+					{Path: "/var/vcap/data/example/api.sock"},
+				}
+				Expect(jobCfg.Validate(boshEnv, []string{"/var/vcap/data/example"})).To(HaveOccurred())
+			})
+
+			It("returns a validation error when the mode is invalid", func() {
+				jobCfg.Processes[0].Sockets = []config.Socket{
+					{Path: "/var/vcap/sys/run/example/api.sock", Mode: "rwxr-x---"},
+				}
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(HaveOccurred())
+
+				jobCfg.Processes[0].Sockets = []config.Socket{
+					{Path: "/var/vcap/sys/run/example/api.sock", Mode: "01777"},
+				}
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(HaveOccurred())
+			})
+		})
+
+		Context("when the config has a termination log", func() {
+			It("does not error on an absolute path", func() {
+				jobCfg.Processes[0].TerminationLog = "/var/vcap/data/example/termination-log"
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(Succeed())
+			})
+
+			It("returns a validation error when the path is relative or not canonical", func() {
+				jobCfg.Processes[0].TerminationLog = "termination-log"
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(MatchError(ContainSubstring("invalid termination_log")))
+
+				jobCfg.Processes[0].TerminationLog = "/var/vcap/data/../termination-log"
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(MatchError(ContainSubstring("invalid termination_log")))
+			})
+		})
+
+		Context("when the config restricts the job directory", func() {
+			It("does not error on valid paths", func() {
+				jobCfg.Processes[0].JobDir = &config.JobDir{Paths: []string{"bin", "config/server.yml"}}
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(Succeed())
+			})
+
+			It("does not error when the job directory is disabled", func() {
+				jobCfg.Processes[0].JobDir = &config.JobDir{Disabled: true}
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(Succeed())
+			})
+
+			It("returns a validation error when a path leaves the job directory", func() {
+				for _, path := range []string{"/var/vcap/jobs/example/bin", "../other/config", "..", ".", "config/../bin", ""} {
+					jobCfg.Processes[0].JobDir = &config.JobDir{Paths: []string{path}}
+					Expect(jobCfg.Validate(boshEnv, []string{})).To(MatchError(ContainSubstring("invalid job_dir")), path)
+				}
+			})
+
+			It("returns a validation error when paths are given for a disabled job directory", func() {
+				jobCfg.Processes[0].JobDir = &config.JobDir{Disabled: true, Paths: []string{"bin"}}
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(MatchError(ContainSubstring("invalid job_dir")))
+			})
+		})
+
+		Context("when the config captures core dumps", func() {
+			It("fills in the default limits", func() {
+				jobCfg.Processes[0].CoreDumps = &config.CoreDumps{}
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(Succeed())
+
+				size, count, err := jobCfg.Processes[0].CoreDumps.Limits()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(size).To(Equal(uint64(1024 * 1024 * 1024)))
+				Expect(count).To(Equal(3))
+			})
+
+			It("returns a validation error when the limits are invalid", func() {
+				jobCfg.Processes[0].CoreDumps = &config.CoreDumps{MaxSize: "lots"}
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(MatchError(ContainSubstring("invalid core_dumps")))
+
+				jobCfg.Processes[0].CoreDumps = &config.CoreDumps{MaxCount: -1}
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(MatchError(ContainSubstring("invalid core_dumps")))
+			})
+		})
+
+		Context("when the config has required environment variables", func() {
+			BeforeEach(func() {
+				jobCfg.Processes[0].RequiredEnv = []string{"DATABASE_URL", "API_TOKEN"}
+			})
+
+			It("does not error when they are all set", func() {
+				jobCfg.Processes[0].Env = map[string]string{
+					"DATABASE_URL": "postgres://db.example.com",
+					"API_TOKEN":    "secret",
+				}
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(Succeed())
+			})
+
+			It("returns a validation error listing the missing and empty variables", func() {
+				jobCfg.Processes[0].Env = map[string]string{
+					"DATABASE_URL": "  ",
+				}
+				err := jobCfg.Validate(boshEnv, []string{})
+				Expect(err).To(MatchError("missing required environment variables: DATABASE_URL, API_TOKEN"))
+			})
+		})
+
+		Context("when the config has a log sink", func() {
+			It("does not error when the type is set", func() {
+				jobCfg.Processes[0].LogSink = &config.LogSink{Type: "syslog"}
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(Succeed())
+			})
+
+			It("returns a validation error when the type is missing", func() {
+				jobCfg.Processes[0].LogSink = &config.LogSink{Options: map[string]string{"tag": "example"}}
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(MatchError("invalid log_sink: type must be set"))
+			})
+		})
+
+		Context("when the config reads environment variables from files", func() {
+			It("does not error on valid paths", func() {
+				jobCfg.Processes[0].EnvFromFiles = map[string]string{"PASSWORD": "/var/vcap/jobs/example/config/password"}
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(Succeed())
+			})
+
+			It("satisfies required environment variables", func() {
+				jobCfg.Processes[0].EnvFromFiles = map[string]string{"PASSWORD": "/var/vcap/jobs/example/config/password"}
+				jobCfg.Processes[0].RequiredEnv = []string{"PASSWORD"}
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(Succeed())
+			})
+
+			It("returns a validation error when the path is not absolute", func() {
+				jobCfg.Processes[0].EnvFromFiles = map[string]string{"PASSWORD": "config/password"}
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(HaveOccurred())
+			})
+
+			It("returns a validation error when the variable is also set in env", func() {
+				jobCfg.Processes[0].Env = map[string]string{"PASSWORD": "hunter2"}
+				jobCfg.Processes[0].EnvFromFiles = map[string]string{"PASSWORD": "/var/vcap/jobs/example/config/password"}
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(HaveOccurred())
+			})
+		})
+
+		Context("when the config has a memory limit", func() {
+			It("does not error on a size or a percentage", func() {
+				for _, memory := range []string{"256M", "1G", "40%", "12.5%"} {
+					memory := memory
+					jobCfg.Processes[0].Limits = &config.Limits{Memory: &memory}
+					Expect(jobCfg.Validate(boshEnv, []string{})).To(Succeed())
+				}
+			})
+
+			It("returns a validation error on percentages out of range", func() {
+				for _, memory := range []string{"0%", "150%", "%", "lots%"} {
+					memory := memory
+					jobCfg.Processes[0].Limits = &config.Limits{Memory: &memory}
+					Expect(jobCfg.Validate(boshEnv, []string{})).To(MatchError(ContainSubstring("invalid limits")))
+				}
+			})
+
+			It("resolves a percentage against the host's total memory", func() {
+				memory := "40%"
+				limits := &config.Limits{Memory: &memory}
+				Expect(limits.MemoryBytes(1000)).To(Equal(uint64(400)))
+			})
+		})
+
+		Context("when the config has a CPU limit", func() {
+			It("does not error on a number, a percentage, or all but some CPUs", func() {
+				for _, cpus := range []string{"2", "0.5", "50%", "all-but:1", "all-but:0"} {
+					cpus := cpus
+					jobCfg.Processes[0].Limits = &config.Limits{CPUs: &cpus}
+					Expect(jobCfg.Validate(boshEnv, []string{})).To(Succeed())
+				}
+			})
+
+			It("returns a validation error on anything else", func() {
+				for _, cpus := range []string{"0", "-1", "0%", "101%", "all-but:", "all-but:-1", "lots"} {
+					cpus := cpus
+					jobCfg.Processes[0].Limits = &config.Limits{CPUs: &cpus}
+					Expect(jobCfg.Validate(boshEnv, []string{})).To(MatchError(ContainSubstring("invalid limits")), cpus)
+				}
+			})
+		})
+
+		Context("when the config has a swap limit", func() {
+			It("does not error when it is at least the memory limit", func() {
+				memory, swap := "1G", "1536M"
+				jobCfg.Processes[0].Limits = &config.Limits{Memory: &memory, Swap: &swap}
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(Succeed())
+			})
+
+			It("returns a validation error when it is less than the memory limit", func() {
+				memory, swap := "1G", "512M"
+				jobCfg.Processes[0].Limits = &config.Limits{Memory: &memory, Swap: &swap}
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(MatchError(ContainSubstring("swap (512M) must be at least memory (1G)")))
+			})
+
+			It("returns a validation error without a memory limit", func() {
+				swap := "1G"
+				jobCfg.Processes[0].Limits = &config.Limits{Swap: &swap}
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(MatchError("invalid limits: swap requires memory"))
+			})
+
+			It("returns a validation error when it is not a size", func() {
+				memory, swap := "1G", "lots"
+				jobCfg.Processes[0].Limits = &config.Limits{Memory: &memory, Swap: &swap}
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(MatchError(ContainSubstring("invalid swap limit")))
+			})
+		})
+
+		Context("when the config has a memory reservation", func() {
+			It("does not error with or without a memory limit", func() {
+				reservation := "512M"
+				jobCfg.Processes[0].Limits = &config.Limits{MemoryReservation: &reservation}
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(Succeed())
+
+				memory := "50%"
+				reservation = "25%"
+				jobCfg.Processes[0].Limits = &config.Limits{Memory: &memory, MemoryReservation: &reservation}
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(Succeed())
+			})
+
+			It("returns a validation error when it is more than the memory limit", func() {
+				memory, reservation := "1G", "2G"
+				jobCfg.Processes[0].Limits = &config.Limits{Memory: &memory, MemoryReservation: &reservation}
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(MatchError("invalid limits: memory_reservation (2G) must not be more than memory (1G)"))
+
+				memory, reservation = "25%", "30%"
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(MatchError(ContainSubstring("must not be more than memory")))
+			})
+
+			It("returns a validation error when it is not a size or a percentage", func() {
+				reservation := "some"
+				jobCfg.Processes[0].Limits = &config.Limits{MemoryReservation: &reservation}
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(MatchError(ContainSubstring("invalid memory reservation")))
+			})
+		})
+
+		Context("when the config has a kernel memory limit", func() {
+			It("does not error on a size", func() {
+				kernelMemory := "256M"
+				jobCfg.Processes[0].Limits = &config.Limits{KernelMemory: &kernelMemory}
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(Succeed())
+				Expect(jobCfg.Processes[0].Limits.KernelMemoryBytes()).To(Equal(uint64(256 * 1024 * 1024)))
+			})
+
+			It("returns a validation error when it is not a positive size", func() {
+				for _, kernelMemory := range []string{"0", "10%", "some"} {
+					kernelMemory := kernelMemory
+					jobCfg.Processes[0].Limits = &config.Limits{KernelMemory: &kernelMemory}
+					Expect(jobCfg.Validate(boshEnv, []string{})).To(MatchError(ContainSubstring("invalid limits: invalid kernel memory limit")), kernelMemory)
+				}
+			})
+		})
+
+		Context("when the config sets swappiness", func() {
+			It("does not error on values the kernel accepts", func() {
+				for _, swappiness := range []uint64{0, 60, 100} {
+					swappiness := swappiness
+					jobCfg.Processes[0].Limits = &config.Limits{Swappiness: &swappiness}
+					Expect(jobCfg.Validate(boshEnv, []string{})).To(Succeed())
+				}
+			})
+
+			It("returns a validation error above 100", func() {
+				swappiness := uint64(101)
+				jobCfg.Processes[0].Limits = &config.Limits{Swappiness: &swappiness}
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(MatchError("invalid limits: swappiness 101 must be between 0 and 100"))
+			})
+		})
+
+		Context("when the config sets an io_weight", func() {
+			It("does not error on weights the kernel accepts", func() {
+				for _, weight := range []uint16{10, 500, 1000} {
+					weight := weight
+					jobCfg.Processes[0].Limits = &config.Limits{IOWeight: &weight}
+					Expect(jobCfg.Validate(boshEnv, []string{})).To(Succeed())
+				}
+			})
+
+			It("returns a validation error outside of 10 to 1000", func() {
+				for _, weight := range []uint16{0, 9, 1001} {
+					weight := weight
+					jobCfg.Processes[0].Limits = &config.Limits{IOWeight: &weight}
+					Expect(jobCfg.Validate(boshEnv, []string{})).To(MatchError(ContainSubstring("io_weight must be between 10 and 1000")))
+				}
+			})
+		})
+
+		Context("when the config has huge page limits", func() {
+			It("does not error on whole numbers of pages of each size", func() {
+				jobCfg.Processes[0].Limits = &config.Limits{Hugepages: map[string]string{"2M": "1G", "1GB": "4G"}}
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(Succeed())
+				Expect(jobCfg.Processes[0].Limits.HugepageLimits()).To(Equal([]config.HugepageLimit{
+					{PageSize: 2 * 1024 * 1024, Limit: 1024 * 1024 * 1024},
+					{PageSize: 1024 * 1024 * 1024, Limit: 4 * 1024 * 1024 * 1024},
+				}))
+			})
+
+			It("returns a validation error on a limit which is not a whole number of pages", func() {
+				jobCfg.Processes[0].Limits = &config.Limits{Hugepages: map[string]string{"1G": "1536M"}}
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(MatchError("invalid limits: invalid hugepages limit for 1G pages: 1536M is not a whole number of pages"))
+			})
+
+			It("returns a validation error on a page size which is given twice", func() {
+				jobCfg.Processes[0].Limits = &config.Limits{Hugepages: map[string]string{"2M": "2M", "2MB": "4M"}}
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(MatchError(ContainSubstring("is given more than once")))
+			})
+
+			It("returns a validation error on a page size which is not a size", func() {
+				jobCfg.Processes[0].Limits = &config.Limits{Hugepages: map[string]string{"huge": "2M"}}
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(MatchError(ContainSubstring(`invalid hugepages page size "huge"`)))
+			})
+		})
+
+		Context("when the config has block I/O limits", func() {
+			It("does not error on rates for a device", func() {
+				jobCfg.Processes[0].Limits = &config.Limits{Blkio: []config.BlkioLimit{
+					{Device: "/var/vcap/data", ReadBPS: "50M", WriteBPS: "20Mi", ReadIOPS: 1000, WriteIOPS: 500},
+				}}
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(Succeed())
+			})
+
+			It("returns a validation error when the device is not an absolute path", func() {
+				jobCfg.Processes[0].Limits = &config.Limits{Blkio: []config.BlkioLimit{{Device: "sda", ReadIOPS: 10}}}
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(MatchError(`invalid limits: invalid blkio device "sda": must be an absolute path`))
+			})
+
+			It("returns a validation error when no rate is limited", func() {
+				jobCfg.Processes[0].Limits = &config.Limits{Blkio: []config.BlkioLimit{{Device: "/dev/sda"}}}
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(MatchError(ContainSubstring("must set at least one of")))
+			})
+
+			It("returns a validation error when a rate is not a size", func() {
+				jobCfg.Processes[0].Limits = &config.Limits{Blkio: []config.BlkioLimit{{Device: "/dev/sda", WriteBPS: "fast"}}}
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(MatchError(ContainSubstring("invalid blkio write_bps of /dev/sda")))
+			})
+		})
+
+		Context("when the config sets a CPU period or CPU shares", func() {
+			It("does not error on values the kernel accepts", func() {
+				cpus := "1"
+				period := uint64(20000)
+				shares := uint64(512)
+				jobCfg.Processes[0].Limits = &config.Limits{CPUs: &cpus, CPUPeriod: &period, CPUShares: &shares}
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(Succeed())
+			})
+
+			It("returns a validation error on a period without a CPU limit", func() {
+				period := uint64(20000)
+				jobCfg.Processes[0].Limits = &config.Limits{CPUPeriod: &period}
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(MatchError("invalid limits: cpu_period requires cpus"))
+			})
+
+			It("returns a validation error on values out of range", func() {
+				cpus := "1"
+				period := uint64(500)
+				jobCfg.Processes[0].Limits = &config.Limits{CPUs: &cpus, CPUPeriod: &period}
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(MatchError(ContainSubstring("cpu_period must be between 1000 and 1000000")))
+
+				shares := uint64(1)
+				jobCfg.Processes[0].Limits = &config.Limits{CPUShares: &shares}
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(MatchError(ContainSubstring("cpu_shares must be between 2 and 262144")))
+			})
+		})
+
+		Context("when the config pins the process to a cpuset", func() {
+			It("does not error on lists of CPUs and ranges", func() {
+				cpuset := "0-3,7"
+				jobCfg.Processes[0].Limits = &config.Limits{CPUSet: &cpuset}
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(Succeed())
+			})
+
+			It("returns a validation error on a list which is not in the kernel's format", func() {
+				for _, cpuset := range []string{"", "3-1", "0-", "one", "0;1"} {
+					cpuset := cpuset
+					jobCfg.Processes[0].Limits = &config.Limits{CPUSet: &cpuset}
+					Expect(jobCfg.Validate(boshEnv, []string{})).To(MatchError(HavePrefix("invalid limits: invalid cpuset")), cpuset)
+				}
+			})
+		})
+
+		Context("when the config adds directories to the path", func() {
+			It("does not error on absolute directories", func() {
+				jobCfg.Processes[0].Path = []string{"/var/vcap/packages/ruby/lib/gems/bin"}
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(Succeed())
+			})
+
+			It("returns a validation error on a relative directory", func() {
+				jobCfg.Processes[0].Path = []string{"bin"}
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(MatchError(`invalid path: "bin" must be an absolute and canonical directory`))
+			})
+
+			It("returns a validation error when env sets the PATH as well", func() {
+				jobCfg.Processes[0].Path = []string{"/opt/bin"}
+				jobCfg.Processes[0].Env = map[string]string{"PATH": "/usr/bin"}
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(MatchError(ContainSubstring("cannot be combined with env PATH")))
+			})
+		})
+
+		Context("when the config asks for realtime scheduling", func() {
+			BeforeEach(func() {
+				jobCfg.Processes[0].Realtime = &config.Realtime{Policy: config.RealtimeFIFO, Priority: 50, Runtime: "200ms"}
+			})
+
+			It("does not error on a policy, priority and budget", func() {
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(Succeed())
+			})
+
+			It("returns a validation error on an unknown policy", func() {
+				jobCfg.Processes[0].Realtime.Policy = "deadline"
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(MatchError(`invalid realtime: policy must be "fifo" or "rr" but got "deadline"`))
+			})
+
+			It("returns a validation error on a priority out of range", func() {
+				jobCfg.Processes[0].Realtime.Priority = 0
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(MatchError("invalid realtime: priority 0 must be between 1 and 99"))
+			})
+
+			It("returns a validation error without a runtime", func() {
+				jobCfg.Processes[0].Realtime.Runtime = ""
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(MatchError("invalid realtime: runtime must be set"))
+			})
+
+			It("returns a validation error on a runtime longer than the period", func() {
+				jobCfg.Processes[0].Realtime.Period = "100ms"
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(MatchError(ContainSubstring("runtime 200ms must be more than zero and no more than the period")))
+			})
+
+			It("returns a validation error alongside nice", func() {
+				nice := 5
+				jobCfg.Processes[0].Nice = &nice
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(MatchError(ContainSubstring("invalid realtime: cannot be combined with nice")))
+			})
+		})
+
+		Context("when the config asks for devices", func() {
+			It("does not error on devices with and without permissions", func() {
+				jobCfg.Processes[0].Devices = []config.Device{{Path: "/dev/fuse"}, {Path: "/dev/net/tun", Permissions: "rwm"}}
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(Succeed())
+				Expect(jobCfg.Processes[0].Devices[0].Access()).To(Equal("rw"))
+			})
+
+			It("returns a validation error on a path outside /dev", func() {
+				jobCfg.Processes[0].Devices = []config.Device{{Path: "/var/vcap/data/fuse"}}
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(MatchError(`invalid devices: path must be canonical and inside /dev but got "/var/vcap/data/fuse"`))
+			})
+
+			It("returns a validation error on a path which is not canonical", func() {
+				jobCfg.Processes[0].Devices = []config.Device{{Path: "/dev/../etc/passwd"}}
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(MatchError(ContainSubstring("must be canonical and inside /dev")))
+			})
+
+			It("returns a validation error on unknown or repeated permissions", func() {
+				for _, permissions := range []string{"x", "rr", "rwx"} {
+					jobCfg.Processes[0].Devices = []config.Device{{Path: "/dev/kvm", Permissions: permissions}}
+					Expect(jobCfg.Validate(boshEnv, []string{})).To(MatchError(ContainSubstring("permissions of /dev/kvm must be a combination of r, w, and m")), permissions)
+				}
+			})
+
+			It("returns a validation error on a device given twice", func() {
+				jobCfg.Processes[0].Devices = []config.Device{{Path: "/dev/kvm"}, {Path: "/dev/kvm", Permissions: "r"}}
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(MatchError("invalid devices: /dev/kvm is given more than once"))
+			})
+		})
+
+		Context("when the config limits the egress rate", func() {
+			It("does not error on a rate", func() {
+				jobCfg.Processes[0].Network = &config.Network{EgressRate: "20M"}
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(Succeed())
+				Expect(jobCfg.Processes[0].Network.EgressRateBytes()).To(Equal(uint64(20 * 1024 * 1024)))
+			})
+
+			It("returns a validation error when the rate is missing or zero", func() {
+				jobCfg.Processes[0].Network = &config.Network{}
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(MatchError("invalid network: egress_rate must be set"))
+
+				jobCfg.Processes[0].Network = &config.Network{EgressRate: "0M"}
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(MatchError("invalid network: egress_rate must be more than zero"))
+			})
+
+			It("returns a validation error on a rate which is not a size", func() {
+				jobCfg.Processes[0].Network = &config.Network{EgressRate: "fast"}
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(MatchError(ContainSubstring(`invalid network egress_rate "fast"`)))
+			})
+		})
+
+		Context("when the config warns of memory pressure", func() {
+			BeforeEach(func() {
+				memory := "1G"
+				jobCfg.Processes[0].Limits = &config.Limits{Memory: &memory}
+				jobCfg.Processes[0].MemoryPressure = &config.MemoryPressure{Threshold: "90%", Hook: "/var/vcap/jobs/example/bin/memory-pressure"}
+			})
+
+			It("does not error on a share of the memory limit", func() {
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(Succeed())
+			})
+
+			It("does not error on a size without a memory limit", func() {
+				jobCfg.Processes[0].Limits = nil
+				jobCfg.Processes[0].MemoryPressure.Threshold = "768M"
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(Succeed())
+			})
+
+			It("returns a validation error on a percentage without a memory limit", func() {
+				jobCfg.Processes[0].Limits = nil
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(MatchError("invalid memory_pressure: a percentage threshold requires limits.memory"))
+			})
+
+			It("returns a validation error without a threshold", func() {
+				jobCfg.Processes[0].MemoryPressure.Threshold = ""
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(MatchError("invalid memory_pressure: threshold must be set"))
+			})
+
+			It("returns a validation error on a threshold which is not a size or percentage", func() {
+				jobCfg.Processes[0].MemoryPressure.Threshold = "150%"
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(MatchError(ContainSubstring("invalid memory_pressure: invalid memory pressure threshold")))
+			})
+
+			It("returns a validation error on a relative hook", func() {
+				jobCfg.Processes[0].MemoryPressure.Hook = "bin/memory-pressure"
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(MatchError(`invalid memory_pressure: hook must be absolute and canonical but got "bin/memory-pressure"`))
+			})
+		})
+
+		Context("when the config registers the process", func() {
+			BeforeEach(func() {
+				jobCfg.Processes[0].Register = &config.Integration{
+					Type:     config.IntegrationFile,
+					Path:     "/var/vcap/data/registrations/server.json",
+					Contents: `{"name":"server"}`,
+				}
+			})
+
+			It("does not error on a registration file", func() {
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(Succeed())
+			})
+
+			It("removes the registration file to deregister by default", func() {
+				Expect(jobCfg.Processes[0].Deregistration()).To(Equal(&config.Integration{
+					Type: config.IntegrationFile,
+					Path: "/var/vcap/data/registrations/server.json",
+				}))
+			})
+
+			It("returns a validation error on an unknown type", func() {
+				jobCfg.Processes[0].Register.Type = "consul"
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(MatchError(`invalid register: type must be "file" or "script" but got "consul"`))
+			})
+
+			It("returns a validation error on a relative path", func() {
+				jobCfg.Processes[0].Register.Path = "registrations/server.json"
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(MatchError(`invalid register: path must be absolute and canonical but got "registrations/server.json"`))
+			})
+
+			It("returns a validation error on contents for a script", func() {
+				jobCfg.Processes[0].Register.Type = config.IntegrationScript
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(MatchError("invalid register: contents can only be written by a register file"))
+			})
+
+			It("returns a validation error on a timeout for a file", func() {
+				jobCfg.Processes[0].Register.Timeout = "10s"
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(MatchError("invalid register: timeout is only used by scripts"))
+			})
+
+			It("validates a deregister script", func() {
+				jobCfg.Processes[0].Deregister = &config.Integration{Type: config.IntegrationScript, Path: "/var/vcap/jobs/example/bin/deregister", Timeout: "0s"}
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(MatchError("invalid deregister: timeout: timeout must be positive"))
+
+				jobCfg.Processes[0].Deregister.Timeout = "5s"
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(Succeed())
+				Expect(jobCfg.Processes[0].Deregistration()).To(Equal(jobCfg.Processes[0].Deregister))
+			})
+		})
+
+		Context("when the config sets oom_score_adj", func() {
+			It("does not error on adjustments which the kernel accepts", func() {
+				for _, adj := range []int{-1000, 0, 1000} {
+					adj := adj
+					jobCfg.Processes[0].OOMScoreAdj = &adj
+					Expect(jobCfg.Validate(boshEnv, []string{})).To(Succeed())
+				}
+			})
+
+			It("returns a validation error on anything outside them", func() {
+				adj := -1001
+				jobCfg.Processes[0].OOMScoreAdj = &adj
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(MatchError("invalid oom_score_adj: -1001 must be between -1000 and 1000"))
+			})
+		})
+
+		Context("when the config sets nice", func() {
+			It("does not error on nicenesses which the kernel accepts", func() {
+				for _, nice := range []int{-20, 0, 19} {
+					nice := nice
+					jobCfg.Processes[0].Nice = &nice
+					Expect(jobCfg.Validate(boshEnv, []string{})).To(Succeed())
+				}
+			})
+
+			It("returns a validation error on anything outside them", func() {
+				nice := 20
+				jobCfg.Processes[0].Nice = &nice
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(MatchError("invalid nice: 20 must be between -20 and 19"))
+			})
+		})
+
+		Context("when the config sets accounts", func() {
+			It("does not error on host or minimal", func() {
+				for _, accounts := range []string{config.AccountsHost, config.AccountsMinimal} {
+					jobCfg.Processes[0].Accounts = accounts
+					Expect(jobCfg.Validate(boshEnv, []string{})).To(Succeed())
+				}
+			})
+
+			It("returns a validation error on anything else", func() {
+				jobCfg.Processes[0].Accounts = "ldap"
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(MatchError(`invalid accounts: must be "host" or "minimal" but got "ldap"`))
+			})
+		})
+
+		Context("when the config sets rlimits", func() {
+			It("does not error on sizes, unlimited, or 0", func() {
+				for _, core := range []string{"512M", "unlimited", "0"} {
+					jobCfg.Processes[0].Rlimits = map[string]string{"core": core}
+					Expect(jobCfg.Validate(boshEnv, []string{})).To(Succeed())
+				}
+			})
+
+			It("returns a validation error on an unknown rlimit", func() {
+				jobCfg.Processes[0].Rlimits = map[string]string{"cores": "1G"}
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(MatchError(`invalid rlimits: unknown limit "cores"`))
+			})
+
+			It("returns a validation error on a value which is not a size", func() {
+				jobCfg.Processes[0].Rlimits = map[string]string{"core": "lots"}
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(MatchError(`invalid rlimits: core "lots" must be unlimited or a size such as 512M`))
+			})
+
+			It("returns a validation error on a core limit alongside core_dumps", func() {
+				jobCfg.Processes[0].Rlimits = map[string]string{"core": "1G"}
+				jobCfg.Processes[0].CoreDumps = &config.CoreDumps{}
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(MatchError(ContainSubstring("core cannot be combined with core_dumps")))
+			})
+
+			It("does not error on numbers for limits which count", func() {
+				jobCfg.Processes[0].Rlimits = map[string]string{"nofile": "65536", "nproc": "unlimited", "memlock": "64M"}
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(Succeed())
+			})
+
+			It("returns a validation error on a size for a limit which counts", func() {
+				jobCfg.Processes[0].Rlimits = map[string]string{"nofile": "64K"}
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(MatchError(`invalid rlimits: nofile "64K" must be unlimited or a number`))
+			})
+
+			It("returns a validation error on an unlimited nofile", func() {
+				jobCfg.Processes[0].Rlimits = map[string]string{"nofile": "unlimited"}
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(MatchError("invalid rlimits: nofile cannot be unlimited"))
+			})
+
+			It("returns a validation error on nofile alongside limits.open_files", func() {
+				openFiles := uint64(1024)
+				jobCfg.Processes[0].Rlimits = map[string]string{"nofile": "4096"}
+				jobCfg.Processes[0].Limits = &config.Limits{OpenFiles: &openFiles}
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(MatchError("invalid rlimits: nofile cannot be combined with limits.open_files"))
+			})
+		})
+
+		Context("when the config inherits environment variables from the host", func() {
+			It("does not error on variable names", func() {
+				jobCfg.Processes[0].InheritEnv = []string{"DT_TENANT", "APPDYNAMICS_AGENT_ACCOUNT_NAME"}
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(Succeed())
+			})
+
+			It("satisfies required environment variables", func() {
+				jobCfg.Processes[0].InheritEnv = []string{"DT_TENANT"}
+				jobCfg.Processes[0].RequiredEnv = []string{"DT_TENANT"}
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(Succeed())
+			})
+
+			It("returns a validation error when a name is not a variable name", func() {
+				jobCfg.Processes[0].InheritEnv = []string{"DT_TENANT=example"}
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(MatchError(ContainSubstring("invalid inherit_env")))
+			})
+
+			It("returns a validation error when the variable is also set in env", func() {
+				jobCfg.Processes[0].Env = map[string]string{"DT_TENANT": "example"}
+				jobCfg.Processes[0].InheritEnv = []string{"DT_TENANT"}
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(MatchError("invalid inherit_env: DT_TENANT is also set in env"))
+			})
+		})
+
+		Context("when the config mounts the persistent disk read-only", func() {
+			It("does not error when the persistent disk is mounted", func() {
+				jobCfg.Processes[0].PersistentDisk = true
+				jobCfg.Processes[0].PersistentDiskReadOnly = true
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(Succeed())
+			})
+
+			It("returns a validation error when the persistent disk is not mounted", func() {
+				jobCfg.Processes[0].PersistentDiskReadOnly = true
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(MatchError(ContainSubstring("invalid persistent_disk_read_only")))
+			})
+		})
+
+		Context("when the config has a timezone", func() {
+			It("does not error on a zone name", func() {
+				jobCfg.Processes[0].Timezone = "America/New_York"
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(Succeed())
+			})
+
+			It("returns a validation error on a path", func() {
+				jobCfg.Processes[0].Timezone = "/etc/localtime"
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(HaveOccurred())
+
+				jobCfg.Processes[0].Timezone = "../../../etc/shadow"
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(HaveOccurred())
+			})
+		})
+
+		Context("when the config has a NUMA node", func() {
+			It("returns a validation error when it is negative", func() {
+				node := -1
+				jobCfg.Processes[0].NUMANode = &node
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(HaveOccurred())
+			})
+		})
+
+		Context("when the config has instances", func() {
+			It("returns a validation error when it is negative", func() {
+				jobCfg.Processes[0].Instances = -1
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(MatchError("invalid instances: -1 must not be negative"))
+			})
+
+			It("returns a validation error when a process without instances uses a placeholder", func() {
+				jobCfg.Processes[0].Args = []string{"--port={{instance + 8080}}"}
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(MatchError("invalid instances: {{instance + 8080}} is used but the process has no instances"))
+
+				jobCfg.Processes[0].Instances = 2
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(Succeed())
+			})
+
+			It("returns a validation error when the env sets the instance index", func() {
+				jobCfg.Processes[0].Instances = 2
+				jobCfg.Processes[0].Env = map[string]string{"BPM_INSTANCE_INDEX": "7"}
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(HaveOccurred())
+			})
+		})
+
+		Context("when the config has labels", func() {
+			It("does not error on valid labels", func() {
+				jobCfg.Processes[0].Labels = map[string]string{"org.cloudfoundry.release": "example"}
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(Succeed())
+			})
+
+			It("returns a validation error when a key is empty", func() {
+				jobCfg.Processes[0].Labels = map[string]string{"": "example"}
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(HaveOccurred())
+			})
+
+			It("returns a validation error when a key is in the OCI namespace", func() {
+				jobCfg.Processes[0].Labels = map[string]string{"org.opencontainers.image.title": "example"}
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(HaveOccurred())
+			})
+		})
+
+		Context("when the config has OCI hooks", func() {
+			It("does not error on valid hooks", func() {
+				jobCfg.Processes[0].OCIHooks = &config.OCIHooks{
+					Poststart: []config.OCIHook{{Path: "/var/vcap/packages/device-manager/bin/attach"}},
+				}
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(Succeed())
+			})
+
+			It("returns a validation error when a hook path is relative", func() {
+				jobCfg.Processes[0].OCIHooks = &config.OCIHooks{
+					Prestart: []config.OCIHook{{Path: "bin/setup"}},
+				}
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(HaveOccurred())
+			})
+
+			It("accepts a hook timeout as a duration or a number of seconds", func() {
+				for _, timeout := range []string{"90s", "2m", "30"} {
+					jobCfg.Processes[0].OCIHooks = &config.OCIHooks{
+						Poststop: []config.OCIHook{{Path: "/bin/true", Timeout: timeout}},
+					}
+					Expect(jobCfg.Validate(boshEnv, []string{})).To(Succeed(), timeout)
+				}
+			})
+
+			It("returns a validation error when a hook timeout is not positive", func() {
+				jobCfg.Processes[0].OCIHooks = &config.OCIHooks{
+					Poststop: []config.OCIHook{{Path: "/bin/true", Timeout: "0"}},
+				}
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(MatchError("invalid oci_hooks: poststop hook /bin/true: timeout must be positive"))
+			})
+
+			It("returns a validation error when a hook timeout is not a duration", func() {
+				jobCfg.Processes[0].OCIHooks = &config.OCIHooks{
+					Poststop: []config.OCIHook{{Path: "/bin/true", Timeout: "soon"}},
+				}
+				Expect(jobCfg.Validate(boshEnv, []string{})).To(MatchError(ContainSubstring(`"soon" is not a duration`)))
+			})
+		})
+
 		Context("when the process does not have a name", func() {
 			It("returns an error", func() {
 				jobCfg.Processes[0].Name = ""
@@ -185,6 +1104,17 @@ var _ = Describe("Config", func() {
 		})
 	})
 
+	Describe("ParseCPUList", func() {
+		It("returns the CPUs in ascending order without duplicates", func() {
+			Expect(config.ParseCPUList("7, 2-4,3")).To(Equal([]int{2, 3, 4, 7}))
+		})
+
+		It("returns an error on a backwards range", func() {
+			_, err := config.ParseCPUList("3-1")
+			Expect(err).To(MatchError(`"3-1" is not a CPU or a range of CPUs such as 0-3`))
+		})
+	})
+
 	Describe("AddVolumes", func() {
 		var cfg *config.ProcessConfig
 
@@ -204,13 +1134,14 @@ var _ = Describe("Config", func() {
 					"/var/vcap/store/volume4:allow_executions",
 					"/var/vcap/data/volume5:writable,mount_only,allow_executions",
 					"/var/vcap/data/volume6:shared",
+					"/var/vcap/data/volume7:writable,lock",
 				},
 				boshEnv,
 				[]string{},
 			)
 			Expect(err).NotTo(HaveOccurred())
 
-			Expect(cfg.AdditionalVolumes).To(HaveLen(6))
+			Expect(cfg.AdditionalVolumes).To(HaveLen(7))
 			Expect(cfg.AdditionalVolumes).To(ContainElement(config.Volume{
 				Path: "/var/vcap/data/volume1",
 			}))
@@ -236,6 +1167,30 @@ var _ = Describe("Config", func() {
 				Path:   "/var/vcap/data/volume6",
 				Shared: true,
 			}))
+			Expect(cfg.AdditionalVolumes).To(ContainElement(config.Volume{
+				Path:     "/var/vcap/data/volume7",
+				Writable: true,
+				Lock:     true,
+			}))
+		})
+
+		It("lists the lock files of volumes with lock set in a consistent order", func() {
+			err := cfg.AddVolumes(
+				[]string{
+					"/var/vcap/data/zebra:lock",
+					"/var/vcap/data/unlocked",
+					"/var/vcap/data/aardvark:lock",
+				},
+				boshEnv,
+				[]string{},
+			)
+			Expect(err).NotTo(HaveOccurred())
+
+			bpmCfg := config.NewBPMConfig(boshEnv, "job", "process")
+			Expect(cfg.LockVolumes(bpmCfg)).To(Equal([]string{
+				filepath.Join(bpmCfg.HostPath("/var/vcap/data/aardvark"), config.VolumeLockFile),
+				filepath.Join(bpmCfg.HostPath("/var/vcap/data/zebra"), config.VolumeLockFile),
+			}))
 		})
 
 		Context("when the volume definition contains an invalid option", func() {
@@ -334,4 +1289,28 @@ var _ = Describe("Config", func() {
 			})
 		})
 	})
+
+	Describe("HasSecretReferences", func() {
+		It("finds references to secrets anywhere in a value", func() {
+			Expect(config.HasSecretReferences(map[string]string{"A": "plain", "B": "user:((/cf/db/password))@db"})).To(BeTrue())
+		})
+
+		It("ignores values without references", func() {
+			Expect(config.HasSecretReferences(map[string]string{"A": "plain", "B": "(not a reference)"})).To(BeFalse())
+		})
+	})
+
+	Describe("Checksum", func() {
+		It("is the same for equal configurations", func() {
+			a := &config.ProcessConfig{Name: "server", Executable: "/bin/server", Env: map[string]string{"A": "1", "B": "2"}}
+			b := &config.ProcessConfig{Name: "server", Executable: "/bin/server", Env: map[string]string{"B": "2", "A": "1"}}
+			Expect(a.Checksum()).To(Equal(b.Checksum()))
+		})
+
+		It("changes when the configuration does", func() {
+			a := &config.ProcessConfig{Name: "server", Executable: "/bin/server"}
+			b := &config.ProcessConfig{Name: "server", Executable: "/bin/server", Args: []string{"--verbose"}}
+			Expect(a.Checksum()).NotTo(Equal(b.Checksum()))
+		})
+	})
 })
@@ -0,0 +1,74 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// MemoryPressure warns that the process is running short of memory before
+// the kernel's OOM killer has to kill it.
+type MemoryPressure struct {
+	// Threshold is the memory usage which the warning is given at: a
+	// percentage of limits.memory such as 90%, or a size such as 3G.
+	Threshold string `yaml:"threshold"`
+
+	// Hook is the path to an executable which is run on the host each time
+	// the usage of the process rises past Threshold.
+	Hook string `yaml:"hook"`
+}
+
+// ThresholdBytes returns the threshold in bytes. A percentage is a share of
+// limit, the memory limit which the process's container actually has.
+func (m *MemoryPressure) ThresholdBytes(limit uint64) (uint64, error) {
+	if strings.HasSuffix(strings.TrimSpace(m.Threshold), "%") && limit == 0 {
+		return 0, fmt.Errorf("invalid memory pressure threshold %q: the process has no memory limit", m.Threshold)
+	}
+
+	return memoryBytes("memory pressure threshold", m.Threshold, limit)
+}
+
+func (c *ProcessConfig) validateMemoryPressure() error {
+	m := c.MemoryPressure
+	if m == nil {
+		return nil
+	}
+
+	if m.Threshold == "" {
+		return errors.New("invalid memory_pressure: threshold must be set")
+	}
+
+	if strings.HasSuffix(strings.TrimSpace(m.Threshold), "%") && (c.Limits == nil || c.Limits.Memory == nil) {
+		return errors.New("invalid memory_pressure: a percentage threshold requires limits.memory")
+	}
+
+	threshold, err := m.ThresholdBytes(1 << 40)
+	if err != nil {
+		return fmt.Errorf("invalid memory_pressure: %s", err)
+	}
+	if threshold == 0 {
+		return errors.New("invalid memory_pressure: threshold must be more than zero")
+	}
+
+	if m.Hook != "" && (!filepath.IsAbs(m.Hook) || filepath.Clean(m.Hook) != m.Hook) {
+		return fmt.Errorf("invalid memory_pressure: hook must be absolute and canonical but got %q", m.Hook)
+	}
+
+	return nil
+}
@@ -0,0 +1,62 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package config
+
+import (
+	"errors"
+	"fmt"
+
+	"bpm/units"
+)
+
+// Network limits the network traffic of a process. Processes share the
+// host's network stack, so the limits are enforced on the host's interfaces.
+type Network struct {
+	// EgressRate is how many bytes per second the process may send, as a
+	// size such as 20M.
+	EgressRate string `yaml:"egress_rate"`
+}
+
+// EgressRateBytes returns the egress rate in bytes per second, or zero if it
+// is not limited.
+func (n *Network) EgressRateBytes() (uint64, error) {
+	if n == nil || n.EgressRate == "" {
+		return 0, nil
+	}
+
+	rate, err := units.ParseSize(n.EgressRate)
+	if err != nil {
+		return 0, fmt.Errorf("invalid network egress_rate %q: %s", n.EgressRate, err)
+	}
+
+	return rate, nil
+}
+
+func (n *Network) validate() error {
+	if n.EgressRate == "" {
+		return errors.New("invalid network: egress_rate must be set")
+	}
+
+	rate, err := n.EgressRateBytes()
+	if err != nil {
+		return err
+	}
+	if rate == 0 {
+		return errors.New("invalid network: egress_rate must be more than zero")
+	}
+
+	return nil
+}
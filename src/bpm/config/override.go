@@ -0,0 +1,146 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	yaml "gopkg.in/yaml.v2"
+
+	"bpm/bosh"
+)
+
+// OverridesRoot is the directory containing the local overrides for every
+// job. It is outside of the job directories so that overrides are not lost
+// when BOSH renders the job's templates again.
+func OverridesRoot(env *bosh.Env) string {
+	return env.Root().Join("data", "bpm", "overrides").External()
+}
+
+// OverrideConfig contains changes which an operator has made to a job's
+// configuration on a single host. Only the settings which are useful to tweak
+// in an emergency can be overridden.
+type OverrideConfig struct {
+	Processes []*ProcessOverride `yaml:"processes"`
+}
+
+type ProcessOverride struct {
+	Name   string            `yaml:"name"`
+	Env    map[string]string `yaml:"env"`
+	Limits *Limits           `yaml:"limits"`
+}
+
+// ParseOverrideConfig reads an override file. A missing file is not an error
+// and results in a nil configuration. Unknown keys are rejected so that an
+// operator does not believe a setting has been overridden when it has not.
+func ParseOverrideConfig(configPath string) (*OverrideConfig, error) {
+	data, err := ioutil.ReadFile(configPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	cfg := OverrideConfig{}
+	if err := yaml.UnmarshalStrict(data, &cfg); err != nil {
+		return nil, err
+	}
+
+	return &cfg, nil
+}
+
+// ApplyOverride merges the override into the job configuration. Environment
+// variables are added to (or replace) those of the process and each limit
+// which is set replaces the limit of the process.
+func (c *JobConfig) ApplyOverride(override *OverrideConfig) error {
+	for _, po := range override.Processes {
+		proc := c.process(po.Name)
+		if proc == nil {
+			return fmt.Errorf("invalid override: process %q is not in the job configuration", po.Name)
+		}
+
+		if len(po.Env) > 0 && proc.Env == nil {
+			proc.Env = map[string]string{}
+		}
+		for k, v := range po.Env {
+			proc.Env[k] = v
+		}
+
+		if po.Limits != nil {
+			if proc.Limits == nil {
+				proc.Limits = &Limits{}
+			}
+			if po.Limits.CPUs != nil {
+				proc.Limits.CPUs = po.Limits.CPUs
+			}
+			if po.Limits.CPUPeriod != nil {
+				proc.Limits.CPUPeriod = po.Limits.CPUPeriod
+			}
+			if po.Limits.CPUShares != nil {
+				proc.Limits.CPUShares = po.Limits.CPUShares
+			}
+			if po.Limits.CPUSet != nil {
+				proc.Limits.CPUSet = po.Limits.CPUSet
+			}
+			if po.Limits.Memory != nil {
+				proc.Limits.Memory = po.Limits.Memory
+			}
+			if po.Limits.MemoryReservation != nil {
+				proc.Limits.MemoryReservation = po.Limits.MemoryReservation
+			}
+			if po.Limits.OpenFiles != nil {
+				proc.Limits.OpenFiles = po.Limits.OpenFiles
+			}
+			if po.Limits.Processes != nil {
+				proc.Limits.Processes = po.Limits.Processes
+			}
+			if po.Limits.Swap != nil {
+				proc.Limits.Swap = po.Limits.Swap
+			}
+			if po.Limits.KernelMemory != nil {
+				proc.Limits.KernelMemory = po.Limits.KernelMemory
+			}
+			if po.Limits.Swappiness != nil {
+				proc.Limits.Swappiness = po.Limits.Swappiness
+			}
+			if po.Limits.IOWeight != nil {
+				proc.Limits.IOWeight = po.Limits.IOWeight
+			}
+			if po.Limits.Blkio != nil {
+				proc.Limits.Blkio = po.Limits.Blkio
+			}
+			if po.Limits.Hugepages != nil {
+				proc.Limits.Hugepages = po.Limits.Hugepages
+			}
+		}
+
+		proc.Overridden = true
+	}
+
+	return nil
+}
+
+func (c *JobConfig) process(name string) *ProcessConfig {
+	for _, proc := range c.Processes {
+		if proc.Name == name {
+			return proc
+		}
+	}
+
+	return nil
+}
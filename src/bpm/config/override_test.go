@@ -0,0 +1,147 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package config_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"bpm/bosh"
+	"bpm/config"
+)
+
+var _ = Describe("OverrideConfig", func() {
+	Describe("ParseOverrideConfig", func() {
+		It("parses a yaml file into an override", func() {
+			override, err := config.ParseOverrideConfig("testdata/override.yml")
+			Expect(err).NotTo(HaveOccurred())
+
+			memory := "200G"
+			shares := uint64(2048)
+			Expect(override.Processes).To(Equal([]*config.ProcessOverride{{
+				Name:   "first-process",
+				Env:    map[string]string{"FOO": "OVERRIDDEN", "DEBUG": "true"},
+				Limits: &config.Limits{Memory: &memory, CPUShares: &shares},
+			}}))
+		})
+
+		It("returns nil when the file does not exist", func() {
+			override, err := config.ParseOverrideConfig("does-not-exist")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(override).To(BeNil())
+		})
+
+		It("rejects settings which cannot be overridden", func() {
+			_, err := config.ParseOverrideConfig("testdata/override-unknown-key.yml")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("ApplyOverride", func() {
+		var jobCfg *config.JobConfig
+
+		BeforeEach(func() {
+			var err error
+			jobCfg, err = config.ParseJobConfig("testdata/example.yml")
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("merges the environment and limits into the process", func() {
+			override, err := config.ParseOverrideConfig("testdata/override.yml")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(jobCfg.ApplyOverride(override)).To(Succeed())
+
+			proc := jobCfg.Processes[0]
+			Expect(proc.Overridden).To(BeTrue())
+			Expect(proc.Env).To(Equal(map[string]string{
+				"FOO":   "OVERRIDDEN",
+				"BAZ":   "BUZZ",
+				"DEBUG": "true",
+			}))
+			Expect(*proc.Limits.Memory).To(Equal("200G"))
+			Expect(*proc.Limits.OpenFiles).To(Equal(uint64(100)))
+			Expect(*proc.Limits.CPUShares).To(Equal(uint64(2048)))
+
+			Expect(jobCfg.Processes[1].Overridden).To(BeFalse())
+		})
+
+		It("returns an error for a process which is not in the job", func() {
+			override := &config.OverrideConfig{
+				Processes: []*config.ProcessOverride{{Name: "missing"}},
+			}
+			Expect(jobCfg.ApplyOverride(override)).To(MatchError(ContainSubstring(`"missing"`)))
+		})
+	})
+
+	Describe("BPMConfig.ParseJobConfig", func() {
+		var (
+			root   string
+			bpmCfg *config.BPMConfig
+		)
+
+		BeforeEach(func() {
+			var err error
+			root, err = ioutil.TempDir("", "override")
+			Expect(err).NotTo(HaveOccurred())
+
+			bpmCfg = config.NewBPMConfig(bosh.NewEnv(root), "example", "example")
+
+			Expect(os.MkdirAll(filepath.Dir(bpmCfg.JobConfig()), 0700)).To(Succeed())
+			Expect(ioutil.WriteFile(bpmCfg.JobConfig(), []byte(`
+processes:
+- name: example
+  executable: /bin/sleep
+  env:
+    LOG_LEVEL: info
+`), 0600)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			Expect(os.RemoveAll(root)).To(Succeed())
+		})
+
+		It("keeps the override outside of the job directory", func() {
+			Expect(bpmCfg.OverrideConfig()).To(Equal(filepath.Join(root, "data", "bpm", "overrides", "example", "bpm.override.yml")))
+		})
+
+		It("applies the override if there is one", func() {
+			Expect(os.MkdirAll(filepath.Dir(bpmCfg.OverrideConfig()), 0700)).To(Succeed())
+			Expect(ioutil.WriteFile(bpmCfg.OverrideConfig(), []byte(`
+processes:
+- name: example
+  env:
+    LOG_LEVEL: debug
+`), 0600)).To(Succeed())
+
+			jobCfg, err := bpmCfg.ParseJobConfig()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(jobCfg.Processes[0].Env).To(HaveKeyWithValue("LOG_LEVEL", "debug"))
+			Expect(jobCfg.Processes[0].Overridden).To(BeTrue())
+		})
+
+		It("uses the rendered configuration when there is no override", func() {
+			jobCfg, err := bpmCfg.ParseJobConfig()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(jobCfg.Processes[0].Env).To(HaveKeyWithValue("LOG_LEVEL", "info"))
+			Expect(jobCfg.Processes[0].Overridden).To(BeFalse())
+		})
+	})
+})
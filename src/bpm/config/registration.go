@@ -0,0 +1,106 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"bpm/units"
+)
+
+const (
+	// IntegrationFile writes contents to path when the process is
+	// registered and removes path when it is deregistered.
+	IntegrationFile = "file"
+
+	// IntegrationScript runs the executable at path on the host.
+	IntegrationScript = "script"
+)
+
+// DefaultIntegrationTimeout is how long an integration script may run when
+// it does not set a timeout.
+const DefaultIntegrationTimeout = 30 * time.Second
+
+// Integration is an action which bpm takes on the host on behalf of a
+// process, such as registering it with a service discovery system once it is
+// ready and deregistering it before it is stopped. It replaces sidecar
+// processes which are run only to do this.
+type Integration struct {
+	Type     string `yaml:"type"`
+	Path     string `yaml:"path"`
+	Contents string `yaml:"contents"`
+	Timeout  string `yaml:"timeout"`
+}
+
+// TimeoutDuration returns how long a script may run before it is killed.
+func (i *Integration) TimeoutDuration() (time.Duration, error) {
+	if i.Timeout == "" {
+		return DefaultIntegrationTimeout, nil
+	}
+
+	timeout, err := units.ParseDuration(i.Timeout)
+	if err != nil {
+		return 0, err
+	}
+	if timeout == 0 {
+		return 0, errors.New("timeout must be positive")
+	}
+
+	return timeout, nil
+}
+
+// Deregistration returns what is done to deregister the process before it is
+// stopped. A registration file is removed unless deregister says otherwise.
+func (c *ProcessConfig) Deregistration() *Integration {
+	if c.Deregister != nil {
+		return c.Deregister
+	}
+
+	if c.Register != nil && c.Register.Type == IntegrationFile {
+		return &Integration{Type: IntegrationFile, Path: c.Register.Path}
+	}
+
+	return nil
+}
+
+func (i *Integration) validate(name string) error {
+	switch i.Type {
+	case IntegrationFile, IntegrationScript:
+	default:
+		return fmt.Errorf("invalid %s: type must be %q or %q but got %q", name, IntegrationFile, IntegrationScript, i.Type)
+	}
+
+	if !filepath.IsAbs(i.Path) || filepath.Clean(i.Path) != i.Path {
+		return fmt.Errorf("invalid %s: path must be absolute and canonical but got %q", name, i.Path)
+	}
+
+	if i.Contents != "" && (i.Type != IntegrationFile || name != "register") {
+		return fmt.Errorf("invalid %s: contents can only be written by a register file", name)
+	}
+
+	if i.Timeout != "" && i.Type != IntegrationScript {
+		return fmt.Errorf("invalid %s: timeout is only used by scripts", name)
+	}
+
+	if _, err := i.TimeoutDuration(); err != nil {
+		return fmt.Errorf("invalid %s: timeout: %s", name, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,137 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"bpm/units"
+)
+
+// Unlimited is the value of an rlimit which does not limit its resource.
+const Unlimited = "unlimited"
+
+// rlimitResource is a resource limit which may be set in the rlimits of a
+// process. Sized limits are written like limits.memory and the rest are plain
+// numbers, in the units given by setrlimit(2).
+type rlimitResource struct {
+	Type  string
+	Sized bool
+}
+
+// rlimitResources maps the names which may be used in the rlimits of a
+// process to the resource limits which they set.
+var rlimitResources = map[string]rlimitResource{
+	"as":         {Type: "RLIMIT_AS", Sized: true},
+	"core":       {Type: "RLIMIT_CORE", Sized: true},
+	"cpu":        {Type: "RLIMIT_CPU"},
+	"data":       {Type: "RLIMIT_DATA", Sized: true},
+	"fsize":      {Type: "RLIMIT_FSIZE", Sized: true},
+	"locks":      {Type: "RLIMIT_LOCKS"},
+	"memlock":    {Type: "RLIMIT_MEMLOCK", Sized: true},
+	"msgqueue":   {Type: "RLIMIT_MSGQUEUE", Sized: true},
+	"nice":       {Type: "RLIMIT_NICE"},
+	"nofile":     {Type: "RLIMIT_NOFILE"},
+	"nproc":      {Type: "RLIMIT_NPROC"},
+	"rss":        {Type: "RLIMIT_RSS", Sized: true},
+	"rtprio":     {Type: "RLIMIT_RTPRIO"},
+	"rttime":     {Type: "RLIMIT_RTTIME"},
+	"sigpending": {Type: "RLIMIT_SIGPENDING"},
+	"stack":      {Type: "RLIMIT_STACK", Sized: true},
+}
+
+// Rlimit is a resource limit which is set on a process, with the same soft and
+// hard value so that the process cannot raise it.
+type Rlimit struct {
+	Type  string
+	Value uint64
+}
+
+// ParsedRlimits returns the resource limits of the process in order of their
+// types. A value of Unlimited is math.MaxUint64, which the kernel calls
+// RLIM_INFINITY.
+func (c *ProcessConfig) ParsedRlimits() ([]Rlimit, error) {
+	var rlimits []Rlimit
+	for name, value := range c.Rlimits {
+		resource, ok := rlimitResources[name]
+		if !ok {
+			return nil, fmt.Errorf("invalid rlimits: unknown limit %q", name)
+		}
+
+		limit, err := parseRlimit(value, resource.Sized)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rlimits: %s %s", name, err)
+		}
+
+		rlimits = append(rlimits, Rlimit{Type: resource.Type, Value: limit})
+	}
+
+	sort.Slice(rlimits, func(i, j int) bool { return rlimits[i].Type < rlimits[j].Type })
+	return rlimits, nil
+}
+
+func parseRlimit(value string, sized bool) (uint64, error) {
+	switch strings.TrimSpace(value) {
+	case Unlimited:
+		return math.MaxUint64, nil
+	case "0":
+		return 0, nil
+	}
+
+	if !sized {
+		n, err := strconv.ParseUint(strings.TrimSpace(value), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("%q must be %s or a number", value, Unlimited)
+		}
+		return n, nil
+	}
+
+	size, err := units.ParseSize(value)
+	if err != nil {
+		return 0, fmt.Errorf("%q must be %s or a size such as 512M", value, Unlimited)
+	}
+
+	return size, nil
+}
+
+func (c *ProcessConfig) validateRlimits() error {
+	if _, err := c.ParsedRlimits(); err != nil {
+		return err
+	}
+
+	if _, ok := c.Rlimits["core"]; ok && c.CoreDumps != nil {
+		return errors.New("invalid rlimits: core cannot be combined with core_dumps, which sets the core size to its max_size")
+	}
+
+	if nofile, ok := c.Rlimits["nofile"]; ok {
+		if c.Limits != nil && c.Limits.OpenFiles != nil {
+			return errors.New("invalid rlimits: nofile cannot be combined with limits.open_files")
+		}
+
+		// The kernel refuses to raise the open file limit past
+		// fs.nr_open, so an unlimited value would only fail in runc.
+		if strings.TrimSpace(nofile) == Unlimited {
+			return fmt.Errorf("invalid rlimits: nofile cannot be %s", Unlimited)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,145 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+
+	"bpm/redact"
+)
+
+// SensitiveNamePattern matches the names of environment variables which are
+// treated as sensitive even if they are not listed in sensitive_env.
+var SensitiveNamePattern = regexp.MustCompile(`(?i)(PASSWORD|PASSWD|SECRET|TOKEN|CREDENTIAL|PRIVATE_KEY|API_KEY|ACCESS_KEY)`)
+
+// IsSensitive returns whether the value of the environment variable must be
+// hidden from bpm's diagnostic output. Variables are sensitive if they are
+// listed in sensitive_env, have a name which looks like it holds a secret, or
+// have a value which is read from a file or secret store.
+func (c *ProcessConfig) IsSensitive(name string) bool {
+	if contains(c.SensitiveEnv, name) || SensitiveNamePattern.MatchString(name) {
+		return true
+	}
+
+	if _, ok := c.EnvFromFiles[name]; ok {
+		return true
+	}
+
+	return SecretReferencePattern.MatchString(c.Env[name])
+}
+
+// RedactEnv returns a copy of an environment in KEY=VALUE form with the
+// values of sensitive variables replaced.
+func (c *ProcessConfig) RedactEnv(env []string) []string {
+	redacted := make([]string, 0, len(env))
+	for _, variable := range env {
+		parts := strings.SplitN(variable, "=", 2)
+		if len(parts) == 2 && c.IsSensitive(parts[0]) {
+			variable = parts[0] + "=" + redact.Placeholder
+		}
+
+		redacted = append(redacted, variable)
+	}
+
+	return redacted
+}
+
+// SensitiveValues returns the values of the process's sensitive variables
+// which can be known without starting it: those written in the job
+// configuration, those read from files, and those inherited from bpm's own
+// environment. Values fetched from a secret store are not included.
+func (c *ProcessConfig) SensitiveValues() []string {
+	var values []string
+
+	for name, value := range c.Env {
+		if c.IsSensitive(name) && !SecretReferencePattern.MatchString(value) {
+			values = append(values, value)
+		}
+	}
+
+	for _, path := range c.EnvFromFiles {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			continue
+		}
+
+		value := strings.TrimSuffix(string(data), "\n")
+		values = append(values, strings.TrimSuffix(value, "\r"))
+	}
+
+	for _, name := range c.InheritEnv {
+		if value, ok := os.LookupEnv(name); ok && value != "" && c.IsSensitive(name) {
+			values = append(values, value)
+		}
+	}
+
+	return values
+}
+
+// RedactJobConfig returns the job configuration file with the values of
+// sensitive environment variables replaced. Everything else is kept as it
+// was written, apart from comments and formatting.
+func RedactJobConfig(data []byte) ([]byte, error) {
+	var jobCfg JobConfig
+	if err := yaml.Unmarshal(data, &jobCfg); err != nil {
+		return nil, err
+	}
+
+	var doc yaml.MapSlice
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	processes, ok := lookup(doc, "processes").([]interface{})
+	if !ok {
+		return data, nil
+	}
+
+	for i, p := range processes {
+		proc, ok := p.(yaml.MapSlice)
+		if !ok || i >= len(jobCfg.Processes) {
+			continue
+		}
+
+		env, ok := lookup(proc, "env").(yaml.MapSlice)
+		if !ok {
+			continue
+		}
+
+		for j := range env {
+			if name, ok := env[j].Key.(string); ok && jobCfg.Processes[i].IsSensitive(name) {
+				env[j].Value = redact.Placeholder
+			}
+		}
+	}
+
+	return yaml.Marshal(doc)
+}
+
+func lookup(m yaml.MapSlice, key string) interface{} {
+	for _, item := range m {
+		if item.Key == key {
+			return item.Value
+		}
+	}
+
+	return nil
+}
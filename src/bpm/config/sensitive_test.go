@@ -0,0 +1,134 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package config_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	yaml "gopkg.in/yaml.v2"
+
+	"bpm/config"
+)
+
+var _ = Describe("Sensitive environment variables", func() {
+	var (
+		tmpDir  string
+		procCfg *config.ProcessConfig
+	)
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "sensitive")
+		Expect(err).NotTo(HaveOccurred())
+
+		keyPath := filepath.Join(tmpDir, "key")
+		Expect(ioutil.WriteFile(keyPath, []byte("file-secret\n"), 0600)).To(Succeed())
+
+		procCfg = &config.ProcessConfig{
+			Env: map[string]string{
+				"LOG_LEVEL":   "debug",
+				"DB_PASSWORD": "hunter22",
+				"LICENSE":     "ABCD-1234",
+				"CREDHUB":     "((/deployment/job/value))",
+			},
+			EnvFromFiles: map[string]string{"SIGNING_KEY": keyPath},
+			SensitiveEnv: []string{"LICENSE"},
+		}
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(tmpDir)).To(Succeed())
+	})
+
+	Describe("IsSensitive", func() {
+		It("treats listed, secret-looking, file, and secret store variables as sensitive", func() {
+			Expect(procCfg.IsSensitive("LICENSE")).To(BeTrue())
+			Expect(procCfg.IsSensitive("DB_PASSWORD")).To(BeTrue())
+			Expect(procCfg.IsSensitive("github_token")).To(BeTrue())
+			Expect(procCfg.IsSensitive("SIGNING_KEY")).To(BeTrue())
+			Expect(procCfg.IsSensitive("CREDHUB")).To(BeTrue())
+
+			Expect(procCfg.IsSensitive("LOG_LEVEL")).To(BeFalse())
+			Expect(procCfg.IsSensitive("PATH")).To(BeFalse())
+		})
+	})
+
+	Describe("RedactEnv", func() {
+		It("replaces the values of sensitive variables", func() {
+			Expect(procCfg.RedactEnv([]string{
+				"LOG_LEVEL=debug",
+				"DB_PASSWORD=hunter22",
+				"LICENSE=ABCD-1234",
+				"MALFORMED",
+			})).To(Equal([]string{
+				"LOG_LEVEL=debug",
+				"DB_PASSWORD=[REDACTED]",
+				"LICENSE=[REDACTED]",
+				"MALFORMED",
+			}))
+		})
+	})
+
+	Describe("SensitiveValues", func() {
+		It("returns literal and file values but not secret references", func() {
+			Expect(procCfg.SensitiveValues()).To(ConsistOf("hunter22", "ABCD-1234", "file-secret"))
+		})
+
+		It("returns the values of sensitive variables inherited from bpm's environment", func() {
+			Expect(os.Setenv("BPM_TEST_AGENT_TOKEN", "agent-secret")).To(Succeed())
+			defer os.Unsetenv("BPM_TEST_AGENT_TOKEN")
+			Expect(os.Setenv("BPM_TEST_AGENT_TENANT", "example")).To(Succeed())
+			defer os.Unsetenv("BPM_TEST_AGENT_TENANT")
+
+			procCfg.InheritEnv = []string{"BPM_TEST_AGENT_TOKEN", "BPM_TEST_AGENT_TENANT"}
+			Expect(procCfg.SensitiveValues()).To(ConsistOf("hunter22", "ABCD-1234", "file-secret", "agent-secret"))
+		})
+	})
+
+	Describe("RedactJobConfig", func() {
+		It("replaces sensitive values in the job configuration", func() {
+			redacted, err := config.RedactJobConfig([]byte(`
+processes:
+- name: server
+  executable: /bin/server
+  env:
+    LOG_LEVEL: debug
+    DB_PASSWORD: hunter22
+    LICENSE: ABCD-1234
+  sensitive_env: [LICENSE]
+- name: worker
+  executable: /bin/worker
+`))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(redacted)).NotTo(ContainSubstring("hunter22"))
+			Expect(string(redacted)).NotTo(ContainSubstring("ABCD-1234"))
+
+			var jobCfg config.JobConfig
+			Expect(yaml.Unmarshal(redacted, &jobCfg)).To(Succeed())
+			Expect(jobCfg.Processes).To(HaveLen(2))
+			Expect(jobCfg.Processes[0].Executable).To(Equal("/bin/server"))
+			Expect(jobCfg.Processes[0].Env).To(Equal(map[string]string{
+				"LOG_LEVEL":   "debug",
+				"DB_PASSWORD": "[REDACTED]",
+				"LICENSE":     "[REDACTED]",
+			}))
+		})
+	})
+})
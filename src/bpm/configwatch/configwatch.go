@@ -0,0 +1,130 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+// Package configwatch notices when the bpm configuration of the jobs on the
+// host changes. BOSH renders job templates during a deploy but platforms and
+// developers can also re-render them, or add local overrides, without one.
+package configwatch
+
+import (
+	"os"
+	"sort"
+
+	"bpm/bosh"
+	"bpm/config"
+)
+
+const (
+	Added    = "added"
+	Removed  = "removed"
+	Modified = "modified"
+	Invalid  = "invalid"
+)
+
+// Change describes how the configuration of a process differs between two
+// snapshots. Invalid changes name only the job whose configuration could not
+// be read.
+type Change struct {
+	Job     string `json:"job"`
+	Process string `json:"process,omitempty"`
+	Change  string `json:"change"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Snapshot is the configuration of every process on the host at one moment.
+type Snapshot struct {
+	// Checksums holds the checksum of the configuration of each process,
+	// keyed by job and then process.
+	Checksums map[string]map[string]string
+
+	// Errors holds why the configuration of a job could not be read.
+	Errors map[string]string
+}
+
+// Take reads the configuration of every job on the host, including local
+// overrides. The processes of a job whose configuration cannot be read are
+// copied from previous, which may be empty, so that a half-written or broken
+// configuration is not mistaken for the job's processes being removed.
+func Take(env *bosh.Env, previous Snapshot) Snapshot {
+	snapshot := Snapshot{
+		Checksums: map[string]map[string]string{},
+		Errors:    map[string]string{},
+	}
+
+	for _, job := range env.JobNames() {
+		jobCfg, err := config.NewBPMConfig(env, job, "").ParseJobConfig()
+		if os.IsNotExist(err) {
+			continue
+		}
+
+		if err != nil {
+			snapshot.Errors[job] = err.Error()
+			if procs, ok := previous.Checksums[job]; ok {
+				snapshot.Checksums[job] = procs
+			}
+			continue
+		}
+
+		procs := map[string]string{}
+		for _, proc := range jobCfg.Processes {
+			procs[proc.Name] = proc.Checksum()
+		}
+		snapshot.Checksums[job] = procs
+	}
+
+	return snapshot
+}
+
+// Diff lists the changes from old to new, ordered by job and process. A job
+// is reported as invalid only when the reason its configuration cannot be
+// read has changed.
+func Diff(old, new Snapshot) []Change {
+	var changes []Change
+
+	for job, procs := range new.Checksums {
+		for proc, sum := range procs {
+			oldSum, ok := old.Checksums[job][proc]
+			switch {
+			case !ok:
+				changes = append(changes, Change{Job: job, Process: proc, Change: Added})
+			case oldSum != sum:
+				changes = append(changes, Change{Job: job, Process: proc, Change: Modified})
+			}
+		}
+	}
+
+	for job, procs := range old.Checksums {
+		for proc := range procs {
+			if _, ok := new.Checksums[job][proc]; !ok {
+				changes = append(changes, Change{Job: job, Process: proc, Change: Removed})
+			}
+		}
+	}
+
+	for job, reason := range new.Errors {
+		if old.Errors[job] != reason {
+			changes = append(changes, Change{Job: job, Change: Invalid, Error: reason})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].Job != changes[j].Job {
+			return changes[i].Job < changes[j].Job
+		}
+		return changes[i].Process < changes[j].Process
+	})
+
+	return changes
+}
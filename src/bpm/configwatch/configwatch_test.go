@@ -0,0 +1,161 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package configwatch_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"bpm/bosh"
+	"bpm/config"
+	"bpm/configwatch"
+)
+
+var _ = Describe("Configwatch", func() {
+	var (
+		root string
+		env  *bosh.Env
+	)
+
+	writeConfig := func(job, contents string) {
+		cfg := config.NewBPMConfig(env, job, "")
+		Expect(os.MkdirAll(filepath.Dir(cfg.JobConfig()), 0755)).To(Succeed())
+		Expect(ioutil.WriteFile(cfg.JobConfig(), []byte(contents), 0644)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		var err error
+		root, err = ioutil.TempDir("", "configwatch")
+		Expect(err).NotTo(HaveOccurred())
+		env = bosh.NewEnv(root)
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(root)).To(Succeed())
+	})
+
+	Describe("Diff", func() {
+		var initial configwatch.Snapshot
+
+		BeforeEach(func() {
+			writeConfig("web", "processes:\n- name: server\n  executable: /bin/sleep\n- name: worker\n  executable: /bin/sleep\n")
+			writeConfig("db", "processes:\n- name: db\n  executable: /bin/sleep\n")
+			initial = configwatch.Take(env, configwatch.Snapshot{})
+		})
+
+		It("reports every process as added to an empty snapshot", func() {
+			Expect(configwatch.Diff(configwatch.Snapshot{}, initial)).To(Equal([]configwatch.Change{
+				{Job: "db", Process: "db", Change: configwatch.Added},
+				{Job: "web", Process: "server", Change: configwatch.Added},
+				{Job: "web", Process: "worker", Change: configwatch.Added},
+			}))
+		})
+
+		It("reports nothing when the configuration has not changed", func() {
+			Expect(configwatch.Diff(initial, configwatch.Take(env, initial))).To(BeEmpty())
+		})
+
+		It("reports processes which are modified, added, and removed", func() {
+			writeConfig("web", "processes:\n- name: server\n  executable: /bin/sleep\n  args: [10]\n- name: cron\n  executable: /bin/sleep\n")
+			Expect(os.RemoveAll(filepath.Join(root, "jobs", "db"))).To(Succeed())
+
+			Expect(configwatch.Diff(initial, configwatch.Take(env, initial))).To(Equal([]configwatch.Change{
+				{Job: "db", Process: "db", Change: configwatch.Removed},
+				{Job: "web", Process: "cron", Change: configwatch.Added},
+				{Job: "web", Process: "server", Change: configwatch.Modified},
+				{Job: "web", Process: "worker", Change: configwatch.Removed},
+			}))
+		})
+
+		It("reports local overrides as modifications", func() {
+			override := config.NewBPMConfig(env, "web", "").OverrideConfig()
+			Expect(os.MkdirAll(filepath.Dir(override), 0755)).To(Succeed())
+			Expect(ioutil.WriteFile(override, []byte("processes:\n- name: server\n  limits:\n    processes: 10\n"), 0644)).To(Succeed())
+
+			Expect(configwatch.Diff(initial, configwatch.Take(env, initial))).To(Equal([]configwatch.Change{
+				{Job: "web", Process: "server", Change: configwatch.Modified},
+			}))
+		})
+
+		It("keeps the processes of a job whose configuration becomes invalid", func() {
+			writeConfig("web", "processes: [")
+
+			broken := configwatch.Take(env, initial)
+			changes := configwatch.Diff(initial, broken)
+			Expect(changes).To(HaveLen(1))
+			Expect(changes[0].Job).To(Equal("web"))
+			Expect(changes[0].Change).To(Equal(configwatch.Invalid))
+			Expect(changes[0].Error).NotTo(BeEmpty())
+
+			By("not reporting the same problem again")
+			Expect(configwatch.Diff(broken, configwatch.Take(env, broken))).To(BeEmpty())
+		})
+	})
+
+	Describe("Notifier", func() {
+		var notifier *configwatch.Notifier
+
+		BeforeEach(func() {
+			writeConfig("web", "processes:\n- name: server\n  executable: /bin/sleep\n")
+
+			var err error
+			notifier, err = configwatch.NewNotifier()
+			Expect(err).NotTo(HaveOccurred())
+			notifier.Watch(env)
+		})
+
+		AfterEach(func() {
+			Expect(notifier.Close()).To(Succeed())
+		})
+
+		It("times out when nothing changes", func() {
+			changed, err := notifier.Wait(context.Background(), 100*time.Millisecond, 10*time.Millisecond)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(changed).To(BeFalse())
+		})
+
+		It("notices when a job's configuration is rewritten", func() {
+			writeConfig("web", "processes:\n- name: server\n  executable: /bin/true\n")
+
+			changed, err := notifier.Wait(context.Background(), time.Second, 10*time.Millisecond)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(changed).To(BeTrue())
+		})
+
+		It("notices when a job is added", func() {
+			writeConfig("db", "processes:\n- name: db\n  executable: /bin/sleep\n")
+
+			changed, err := notifier.Wait(context.Background(), time.Second, 10*time.Millisecond)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(changed).To(BeTrue())
+		})
+
+		It("returns when the context is cancelled", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			changed, err := notifier.Wait(ctx, time.Minute, 10*time.Millisecond)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(changed).To(BeFalse())
+		})
+	})
+})
@@ -0,0 +1,142 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package configwatch
+
+import (
+	"context"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/sys/unix"
+
+	"bpm/bosh"
+	"bpm/config"
+)
+
+const watchMask = unix.IN_CREATE | unix.IN_DELETE | unix.IN_MODIFY |
+	unix.IN_CLOSE_WRITE | unix.IN_MOVED_FROM | unix.IN_MOVED_TO |
+	unix.IN_ATTRIB | unix.IN_DELETE_SELF
+
+// Notifier waits for the files in a set of directories to change.
+type Notifier struct {
+	fd int
+}
+
+// NewNotifier returns a Notifier which is not yet watching any directories.
+func NewNotifier() (*Notifier, error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Notifier{fd: fd}, nil
+}
+
+// Watch adds the directories which hold the configuration of the jobs on the
+// host, and their local overrides, to those being watched. It should be
+// called again after a change as new jobs may have been added. Directories
+// which do not exist yet are skipped; the watch on a directory which is
+// removed is dropped by the kernel.
+func (n *Notifier) Watch(env *bosh.Env) {
+	dirs := []string{
+		env.Root().Join("jobs").External(),
+		config.OverridesRoot(env),
+	}
+
+	for _, job := range env.JobNames() {
+		cfg := config.NewBPMConfig(env, job, "")
+		dirs = append(dirs, filepath.Dir(cfg.JobConfig()), filepath.Dir(cfg.OverrideConfig()))
+	}
+
+	for _, dir := range dirs {
+		// Adding a directory which is already watched only updates its
+		// mask.
+		unix.InotifyAddWatch(n.fd, dir, watchMask)
+	}
+}
+
+// Wait blocks until something changes in one of the watched directories,
+// timeout passes, or ctx is done, and reports whether anything changed. Changes made in the
+// settle period after the first are waited for too so that several files
+// written together are seen as one change.
+func (n *Notifier) Wait(ctx context.Context, timeout, settle time.Duration) (bool, error) {
+	changed, err := n.poll(ctx, timeout)
+	if err != nil || !changed {
+		return false, err
+	}
+
+	for changed {
+		if err := n.drain(); err != nil {
+			return false, err
+		}
+
+		if changed, err = n.poll(ctx, settle); err != nil {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// pollSlice bounds how long a single poll blocks so that a cancelled ctx is
+// noticed promptly.
+const pollSlice = 250 * time.Millisecond
+
+func (n *Notifier) poll(ctx context.Context, timeout time.Duration) (bool, error) {
+	fds := []unix.PollFd{{Fd: int32(n.fd), Events: unix.POLLIN}}
+	deadline := time.Now().Add(timeout)
+
+	for ctx.Err() == nil {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return false, nil
+		}
+		if remaining > pollSlice {
+			remaining = pollSlice
+		}
+
+		ready, err := unix.Poll(fds, int(remaining/time.Millisecond))
+		if err == unix.EINTR {
+			continue
+		} else if err != nil {
+			return false, err
+		}
+
+		if ready > 0 {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (n *Notifier) drain() error {
+	buf := make([]byte, 64*(unix.SizeofInotifyEvent+unix.NAME_MAX+1))
+
+	for {
+		_, err := unix.Read(n.fd, buf)
+		if err == unix.EAGAIN {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+// Close stops watching every directory.
+func (n *Notifier) Close() error {
+	return unix.Close(n.fd)
+}
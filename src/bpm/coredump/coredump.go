@@ -0,0 +1,170 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+// Package coredump captures the core dumps of processes which crash inside
+// bpm's containers. The kernel's core pattern is global so, when capturing is
+// enabled on a host, it is pointed at `bpm dump-core`. This works out which
+// process (if any) the crashed program belongs to and either writes the core
+// into the job's log directory or passes it on to the pattern which the host
+// had before.
+package coredump
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// PatternFile is where the kernel reads its core pattern from.
+const PatternFile = "/proc/sys/kernel/core_pattern"
+
+const (
+	// MaxSizeAnnotation and MaxCountAnnotation record the core dump limits
+	// of a process in the spec of its container when it has enabled
+	// core_dumps.
+	MaxSizeAnnotation  = "bpm.core_dumps.max_size"
+	MaxCountAnnotation = "bpm.core_dumps.max_count"
+)
+
+// specifiers are the core pattern specifiers which the kernel passes to the
+// handler as arguments, in order. %e comes last as the executable's name may
+// contain spaces.
+const specifiers = "PpiIstughc"
+
+const command = "dump-core"
+
+// Handler returns the core pattern which pipes core dumps to the bpm
+// executable at bpmPath.
+func Handler(bpmPath string) string {
+	args := []string{"|" + bpmPath, command}
+	for _, s := range specifiers {
+		args = append(args, "%"+string(s))
+	}
+	return strings.Join(append(args, "%e"), " ")
+}
+
+// Installed returns whether the core pattern in patternFile pipes cores to
+// bpm.
+func Installed(patternFile string) bool {
+	current, err := readPattern(patternFile)
+	return err == nil && isHandler(current)
+}
+
+func isHandler(pattern string) bool {
+	fields := strings.Fields(pattern)
+	return len(fields) > 1 && strings.HasPrefix(fields[0], "|") && fields[1] == command
+}
+
+// Install points the core pattern in patternFile at handler, keeping the
+// existing pattern in backupFile. Installing the handler again (for example
+// for a new version of bpm) keeps the original backup.
+func Install(patternFile, backupFile, handler string) error {
+	current, err := readPattern(patternFile)
+	if err != nil {
+		return err
+	}
+
+	if !isHandler(current) {
+		if err := os.MkdirAll(filepath.Dir(backupFile), 0700); err != nil {
+			return err
+		}
+
+		if err := ioutil.WriteFile(backupFile, []byte(current+"\n"), 0600); err != nil {
+			return err
+		}
+	}
+
+	return ioutil.WriteFile(patternFile, []byte(handler+"\n"), 0644)
+}
+
+// Uninstall restores the core pattern which was in place before Install. It
+// does nothing if bpm's handler is not installed.
+func Uninstall(patternFile, backupFile string) error {
+	current, err := readPattern(patternFile)
+	if err != nil {
+		return err
+	}
+
+	if !isHandler(current) {
+		return nil
+	}
+
+	previous, err := readPattern(backupFile)
+	if os.IsNotExist(err) {
+		previous = "core"
+	} else if err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(patternFile, []byte(previous+"\n"), 0644); err != nil {
+		return err
+	}
+
+	return os.Remove(backupFile)
+}
+
+func readPattern(path string) (string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(data)), nil
+}
+
+// expand replaces the specifiers in a core pattern with their values.
+// Specifiers which bpm is not given by the kernel are removed.
+func expand(pattern string, values map[byte]string) string {
+	var b strings.Builder
+
+	for i := 0; i < len(pattern); i++ {
+		if pattern[i] != '%' || i == len(pattern)-1 {
+			b.WriteByte(pattern[i])
+			continue
+		}
+
+		i++
+		if pattern[i] == '%' {
+			b.WriteByte('%')
+			continue
+		}
+		b.WriteString(values[pattern[i]])
+	}
+
+	return b.String()
+}
+
+// parseSpecifiers maps the arguments given to the handler by the kernel back
+// to the specifiers they were expanded from.
+func parseSpecifiers(args []string) (map[byte]string, error) {
+	if len(args) < len(specifiers)+1 {
+		return nil, errors.New("not enough arguments: bpm must be run by the kernel as a core dump handler")
+	}
+
+	values := map[byte]string{}
+	for i := 0; i < len(specifiers); i++ {
+		values[specifiers[i]] = args[i]
+	}
+	values['e'] = strings.Join(args[len(specifiers):], " ")
+
+	if values['P'] == "" {
+		return nil, fmt.Errorf("invalid pid %q", values['P'])
+	}
+
+	return values, nil
+}
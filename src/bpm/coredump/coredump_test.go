@@ -0,0 +1,263 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package coredump_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+
+	"bpm/bosh"
+	"bpm/config"
+	"bpm/coredump"
+)
+
+var _ = Describe("Handler", func() {
+	var (
+		tempDir     string
+		patternFile string
+		backupFile  string
+		handler     string
+	)
+
+	BeforeEach(func() {
+		var err error
+		tempDir, err = ioutil.TempDir("", "coredump")
+		Expect(err).NotTo(HaveOccurred())
+
+		patternFile = filepath.Join(tempDir, "core_pattern")
+		backupFile = filepath.Join(tempDir, "bpm", "host_core_pattern")
+		handler = coredump.Handler("/var/vcap/packages/bpm/bin/bpm")
+
+		Expect(ioutil.WriteFile(patternFile, []byte("|/usr/share/apport/apport %p %s %c\n"), 0644)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(tempDir)).To(Succeed())
+	})
+
+	It("pipes every specifier that bpm needs to bpm, with the executable name last", func() {
+		Expect(handler).To(Equal("|/var/vcap/packages/bpm/bin/bpm dump-core %P %p %i %I %s %t %u %g %h %c %e"))
+		Expect(len(handler)).To(BeNumerically("<", 128), "the kernel truncates longer patterns")
+	})
+
+	It("installs the handler and keeps the host's pattern", func() {
+		Expect(coredump.Installed(patternFile)).To(BeFalse())
+		Expect(coredump.Install(patternFile, backupFile, handler)).To(Succeed())
+
+		Expect(coredump.Installed(patternFile)).To(BeTrue())
+		Expect(ioutil.ReadFile(backupFile)).To(Equal([]byte("|/usr/share/apport/apport %p %s %c\n")))
+	})
+
+	It("keeps the original pattern when the handler is installed again", func() {
+		Expect(coredump.Install(patternFile, backupFile, handler)).To(Succeed())
+		Expect(coredump.Install(patternFile, backupFile, coredump.Handler("/other/bpm"))).To(Succeed())
+
+		Expect(ioutil.ReadFile(patternFile)).To(Equal([]byte(coredump.Handler("/other/bpm") + "\n")))
+		Expect(ioutil.ReadFile(backupFile)).To(Equal([]byte("|/usr/share/apport/apport %p %s %c\n")))
+	})
+
+	It("restores the host's pattern when uninstalled", func() {
+		Expect(coredump.Install(patternFile, backupFile, handler)).To(Succeed())
+		Expect(coredump.Uninstall(patternFile, backupFile)).To(Succeed())
+
+		Expect(ioutil.ReadFile(patternFile)).To(Equal([]byte("|/usr/share/apport/apport %p %s %c\n")))
+		Expect(backupFile).NotTo(BeAnExistingFile())
+	})
+
+	It("leaves other patterns alone when uninstalling", func() {
+		Expect(coredump.Uninstall(patternFile, backupFile)).To(Succeed())
+		Expect(ioutil.ReadFile(patternFile)).To(Equal([]byte("|/usr/share/apport/apport %p %s %c\n")))
+	})
+})
+
+var _ = Describe("Dumper", func() {
+	var (
+		boshRoot string
+		procRoot string
+		env      *bosh.Env
+		bpmCfg   *config.BPMConfig
+		dumper   *coredump.Dumper
+		args     []string
+		core     string
+	)
+
+	linkNamespace := func(pid, ns string) {
+		dir := filepath.Join(procRoot, pid, "ns")
+		Expect(os.MkdirAll(dir, 0755)).To(Succeed())
+		Expect(os.Symlink(ns, filepath.Join(dir, "pid"))).To(Succeed())
+	}
+
+	writeSpec := func(annotations map[string]string) {
+		Expect(os.MkdirAll(bpmCfg.BundlePath(), 0700)).To(Succeed())
+		data, err := json.Marshal(specs.Spec{Annotations: annotations})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ioutil.WriteFile(filepath.Join(bpmCfg.BundlePath(), "config.json"), data, 0600)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		var err error
+		boshRoot, err = ioutil.TempDir("", "coredump-bosh")
+		Expect(err).NotTo(HaveOccurred())
+		procRoot, err = ioutil.TempDir("", "coredump-proc")
+		Expect(err).NotTo(HaveOccurred())
+
+		env = bosh.NewEnv(boshRoot)
+		bpmCfg = config.NewBPMConfig(env, "server", "worker")
+		dumper = coredump.NewDumper(env, procRoot)
+
+		Expect(os.MkdirAll(bpmCfg.PidDir().External(), 0700)).To(Succeed())
+		Expect(ioutil.WriteFile(bpmCfg.PidFile().External(), []byte("400"), 0600)).To(Succeed())
+
+		linkNamespace("1", "pid:[1]")
+		linkNamespace("400", "pid:[2]")
+		linkNamespace("500", "pid:[2]")
+		linkNamespace("600", "pid:[1]")
+
+		// %P %p %i %I %s %t %u %g %h %c %e
+		args = []string{"500", "7", "7", "500", "11", "1600000000", "1000", "1000", "host", "0", "my", "server"}
+		core = strings.Repeat("c", 100)
+
+		writeSpec(map[string]string{
+			coredump.MaxSizeAnnotation:  "1024",
+			coredump.MaxCountAnnotation: "2",
+		})
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(boshRoot)).To(Succeed())
+		Expect(os.RemoveAll(procRoot)).To(Succeed())
+	})
+
+	It("captures cores from processes which have enabled core dumps", func() {
+		capture, err := dumper.Dump(args, strings.NewReader(core))
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(capture.Config.JobName()).To(Equal("server"))
+		Expect(capture.Config.ProcName()).To(Equal("worker"))
+		Expect(capture.Path).To(Equal(bpmCfg.CoreDir().Join("core.my_server.7.1600000000").External()))
+		Expect(capture.Truncated).To(BeFalse())
+		Expect(ioutil.ReadFile(capture.Path)).To(Equal([]byte(core)))
+	})
+
+	It("truncates cores which are larger than the maximum size", func() {
+		capture, err := dumper.Dump(args, strings.NewReader(strings.Repeat("c", 2000)))
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(capture.Truncated).To(BeTrue())
+		Expect(capture.Path).To(HaveSuffix(".truncated"))
+		Expect(ioutil.ReadFile(capture.Path)).To(HaveLen(1024))
+	})
+
+	It("keeps only the newest cores", func() {
+		for _, t := range []string{"1", "2", "3"} {
+			args[5] = t
+			_, err := dumper.Dump(args, strings.NewReader(core))
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		entries, err := ioutil.ReadDir(bpmCfg.CoreDir().External())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(HaveLen(2))
+	})
+
+	Context("when the host had a file core pattern", func() {
+		var cwd string
+
+		BeforeEach(func() {
+			cwd = filepath.Join(procRoot, "500", "cwd")
+			Expect(os.MkdirAll(cwd, 0755)).To(Succeed())
+
+			hostPattern := config.HostCorePatternFile(env)
+			Expect(os.MkdirAll(filepath.Dir(hostPattern), 0700)).To(Succeed())
+			Expect(ioutil.WriteFile(hostPattern, []byte("core.%e.%p\n"), 0600)).To(Succeed())
+
+			args[9] = "18446744073709551615"
+		})
+
+		It("writes cores from processes which have not enabled core dumps the same way", func() {
+			writeSpec(nil)
+
+			capture, err := dumper.Dump(args, strings.NewReader(core))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(capture).To(BeNil())
+
+			Expect(ioutil.ReadFile(filepath.Join(cwd, "core.my server.7"))).To(Equal([]byte(core)))
+		})
+
+		It("applies the core size limit of the process", func() {
+			writeSpec(nil)
+			args[9] = "10"
+
+			_, err := dumper.Dump(args, strings.NewReader(core))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ioutil.ReadFile(filepath.Join(cwd, "core.my server.7"))).To(HaveLen(10))
+		})
+
+		It("does not write a core when the process has disabled them", func() {
+			writeSpec(nil)
+			args[9] = "0"
+
+			_, err := dumper.Dump(args, strings.NewReader(core))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(filepath.Join(cwd, "core.my server.7")).NotTo(BeAnExistingFile())
+		})
+
+		It("does not look for processes in the host's pid namespace", func() {
+			args[0] = "600"
+			Expect(os.MkdirAll(filepath.Join(procRoot, "600", "cwd"), 0755)).To(Succeed())
+
+			capture, err := dumper.Dump(args, strings.NewReader(core))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(capture).To(BeNil())
+			Expect(filepath.Join(procRoot, "600", "cwd", "core.my server.7")).To(BeAnExistingFile())
+		})
+	})
+
+	Context("when the host had a piped core pattern", func() {
+		It("pipes cores to the host's handler", func() {
+			writeSpec(nil)
+
+			out := filepath.Join(boshRoot, "piped")
+			hostPattern := config.HostCorePatternFile(env)
+			Expect(os.MkdirAll(filepath.Dir(hostPattern), 0700)).To(Succeed())
+			Expect(ioutil.WriteFile(hostPattern, []byte("|/usr/bin/tee "+out+".%p\n"), 0600)).To(Succeed())
+
+			_, err := dumper.Dump(args, strings.NewReader(core))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ioutil.ReadFile(out + ".7")).To(Equal([]byte(core)))
+		})
+	})
+
+	It("drops cores when the host had no core pattern to pass them on to", func() {
+		writeSpec(nil)
+
+		capture, err := dumper.Dump(args, strings.NewReader(core))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(capture).To(BeNil())
+	})
+
+	It("returns an error when it is not run by the kernel", func() {
+		_, err := dumper.Dump([]string{"500"}, strings.NewReader(core))
+		Expect(err).To(MatchError(ContainSubstring("not enough arguments")))
+	})
+})
@@ -0,0 +1,300 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package coredump
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+
+	"bpm/bosh"
+	"bpm/config"
+)
+
+// Capture describes a core which was written into a job's log directory.
+type Capture struct {
+	Config    *config.BPMConfig
+	Path      string
+	Truncated bool
+}
+
+// Dumper handles the cores which the kernel pipes to bpm.
+type Dumper struct {
+	env        *bosh.Env
+	procRoot   string
+	backupFile string
+}
+
+// NewDumper returns a Dumper for the processes run by bpm in env. procRoot
+// is where procfs is mounted.
+func NewDumper(env *bosh.Env, procRoot string) *Dumper {
+	return &Dumper{
+		env:        env,
+		procRoot:   procRoot,
+		backupFile: config.HostCorePatternFile(env),
+	}
+}
+
+// Dump reads a core from r. The arguments are those which the kernel passed
+// to the handler. If the core came from a process which has enabled core
+// dumps then it is captured in the process's log directory and described by
+// the returned Capture. Otherwise it is passed on to the host's previous core
+// pattern and the returned Capture is nil.
+func (d *Dumper) Dump(args []string, r io.Reader) (*Capture, error) {
+	values, err := parseSpecifiers(args)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, spec, err := d.findProcess(values['P'])
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg != nil {
+		if maxSize, maxCount, ok := coreLimits(spec); ok {
+			return d.capture(cfg, values, maxSize, maxCount, r)
+		}
+	}
+
+	return nil, d.forward(values, r)
+}
+
+// findProcess returns the configuration and container spec of the process
+// whose container has the same pid namespace as pid. Processes which share
+// the host's pid namespace cannot be told apart from the rest of the host so
+// are never found.
+func (d *Dumper) findProcess(pid string) (*config.BPMConfig, *specs.Spec, error) {
+	ns, err := os.Readlink(filepath.Join(d.procRoot, pid, "ns", "pid"))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	hostNS, err := os.Readlink(filepath.Join(d.procRoot, "1", "ns", "pid"))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if ns == hostNS {
+		return nil, nil, nil
+	}
+
+	pidFiles, err := filepath.Glob(d.env.RunDir("bpm").Join("*", "*.pid").External())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, pidFile := range pidFiles {
+		data, err := ioutil.ReadFile(pidFile)
+		if err != nil {
+			continue
+		}
+
+		initNS, err := os.Readlink(filepath.Join(d.procRoot, strings.TrimSpace(string(data)), "ns", "pid"))
+		if err != nil || initNS != ns {
+			continue
+		}
+
+		job := filepath.Base(filepath.Dir(pidFile))
+		proc := strings.TrimSuffix(filepath.Base(pidFile), ".pid")
+		cfg := config.NewBPMConfig(d.env, job, proc)
+
+		spec, err := readSpec(cfg.BundlePath())
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return cfg, spec, nil
+	}
+
+	return nil, nil, nil
+}
+
+func readSpec(bundlePath string) (*specs.Spec, error) {
+	data, err := ioutil.ReadFile(filepath.Join(bundlePath, "config.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	var spec specs.Spec
+	if err := json.Unmarshal(data, &spec); err != nil {
+		return nil, err
+	}
+
+	return &spec, nil
+}
+
+func coreLimits(spec *specs.Spec) (int64, int, bool) {
+	size, err := strconv.ParseInt(spec.Annotations[MaxSizeAnnotation], 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+
+	count, err := strconv.Atoi(spec.Annotations[MaxCountAnnotation])
+	if err != nil {
+		return 0, 0, false
+	}
+
+	return size, count, true
+}
+
+var unsafeNameChars = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// capture writes the first maxSize bytes of the core into the process's core
+// directory and removes the oldest cores so that at most maxCount are kept.
+// The core is written to a temporary file first so that a partial core never
+// looks complete.
+func (d *Dumper) capture(cfg *config.BPMConfig, values map[byte]string, maxSize int64, maxCount int, r io.Reader) (*Capture, error) {
+	dir := cfg.CoreDir().External()
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	name := fmt.Sprintf(
+		"core.%s.%s.%s",
+		unsafeNameChars.ReplaceAllString(values['e'], "_"),
+		values['p'],
+		values['t'],
+	)
+
+	tmp, err := ioutil.TempFile(dir, ".partial-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+
+	written, err := io.Copy(tmp, io.LimitReader(r, maxSize))
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// The kernel gives up writing the rest of the core once we stop
+	// reading it.
+	truncated := false
+	if written == maxSize {
+		n, _ := r.Read(make([]byte, 1))
+		truncated = n > 0
+	}
+	if truncated {
+		name += ".truncated"
+	}
+
+	path := filepath.Join(dir, name)
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return nil, err
+	}
+
+	if err := prune(dir, maxCount); err != nil {
+		return nil, err
+	}
+
+	return &Capture{Config: cfg, Path: path, Truncated: truncated}, nil
+}
+
+// prune removes the oldest cores in dir until there are at most maxCount.
+func prune(dir string, maxCount int) error {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	var cores []os.FileInfo
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), "core.") && e.Mode().IsRegular() {
+			cores = append(cores, e)
+		}
+	}
+
+	sort.Slice(cores, func(i, j int) bool {
+		return cores[i].ModTime().After(cores[j].ModTime())
+	})
+
+	for i := maxCount; i < len(cores); i++ {
+		if err := os.Remove(filepath.Join(dir, cores[i].Name())); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// forward handles the core the way the host's previous core pattern would
+// have: piping it to a command or writing it to a file, relative to the
+// working directory of the crashed process. The kernel ignores the core size
+// limit of the process when it pipes a core to bpm so it is applied here.
+func (d *Dumper) forward(values map[byte]string, r io.Reader) error {
+	pattern, err := readPattern(d.backupFile)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if strings.HasPrefix(pattern, "|") {
+		fields := strings.Fields(strings.TrimPrefix(pattern, "|"))
+		if len(fields) == 0 {
+			return nil
+		}
+
+		for i := range fields {
+			fields[i] = expand(fields[i], values)
+		}
+
+		cmd := exec.Command(fields[0], fields[1:]...)
+		cmd.Stdin = r
+		return cmd.Run()
+	}
+
+	limit, err := strconv.ParseUint(values['c'], 10, 64)
+	if err != nil || limit == 0 || pattern == "" {
+		return nil
+	}
+
+	path := expand(pattern, values)
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(d.procRoot, values['P'], "cwd", path)
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+
+	if limit < math.MaxInt64 {
+		r = io.LimitReader(r, int64(limit))
+	}
+
+	_, err = io.Copy(f, r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+
+	return err
+}
@@ -0,0 +1,146 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+// Package credhub fetches secrets from CredHub so that they can be given to a
+// process without being rendered to disk.
+package credhub
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"bpm/config"
+)
+
+const requestTimeout = 30 * time.Second
+
+type Client struct {
+	cfg        config.CredHubConfig
+	httpClient *http.Client
+
+	token string
+}
+
+func NewClient(cfg config.CredHubConfig) (*Client, error) {
+	tlsConfig := &tls.Config{}
+
+	if cfg.CACert != "" {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM([]byte(cfg.CACert)) {
+			return nil, errors.New("invalid CredHub CA certificate")
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	return &Client{
+		cfg: cfg,
+		httpClient: &http.Client{
+			Timeout:   requestTimeout,
+			Transport: &http.Transport{TLSClientConfig: tlsConfig},
+		},
+	}, nil
+}
+
+// Get returns the current value of the named credential. Values which are
+// not strings (such as certificates or JSON credentials) are returned as
+// JSON.
+func (c *Client) Get(name string) (string, error) {
+	if c.token == "" {
+		token, err := c.fetchToken()
+		if err != nil {
+			return "", fmt.Errorf("failed to authenticate with UAA: %s", err)
+		}
+		c.token = token
+	}
+
+	query := url.Values{"name": {name}, "current": {"true"}}
+	req, err := http.NewRequest(http.MethodGet, c.cfg.URL+"/api/v1/data?"+query.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to fetch credential %s: %s", name, resp.Status)
+	}
+
+	var body struct {
+		Data []struct {
+			Value json.RawMessage `json:"value"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", err
+	}
+
+	if len(body.Data) == 0 {
+		return "", fmt.Errorf("credential %s not found", name)
+	}
+
+	value := body.Data[0].Value
+	var str string
+	if err := json.Unmarshal(value, &str); err == nil {
+		return str, nil
+	}
+
+	return string(value), nil
+}
+
+func (c *Client) fetchToken() (string, error) {
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"response_type": {"token"},
+	}
+
+	req, err := http.NewRequest(http.MethodPost, c.cfg.UAAURL+"/oauth/token", strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(c.cfg.Client), url.QueryEscape(c.cfg.ClientSecret))
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected response: %s", resp.Status)
+	}
+
+	var body struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", err
+	}
+
+	return body.AccessToken, nil
+}
@@ -0,0 +1,126 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package credhub_test
+
+import (
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"bpm/config"
+	"bpm/credhub"
+)
+
+var _ = Describe("Client", func() {
+	var (
+		server      *httptest.Server
+		client      *credhub.Client
+		tokenCalls  int
+		credentials map[string]string
+	)
+
+	BeforeEach(func() {
+		tokenCalls = 0
+		credentials = map[string]string{
+			"/db/password": `"hunter2"`,
+			"/db/cert":     `{"certificate": "CERT", "private_key": "KEY"}`,
+		}
+
+		mux := http.NewServeMux()
+		mux.HandleFunc("/oauth/token", func(w http.ResponseWriter, r *http.Request) {
+			defer GinkgoRecover()
+			tokenCalls++
+
+			user, pass, ok := r.BasicAuth()
+			Expect(ok).To(BeTrue())
+			Expect(user).To(Equal("bpm"))
+			Expect(pass).To(Equal("secret"))
+			Expect(r.FormValue("grant_type")).To(Equal("client_credentials"))
+
+			fmt.Fprint(w, `{"access_token": "some-token", "token_type": "bearer"}`)
+		})
+		mux.HandleFunc("/api/v1/data", func(w http.ResponseWriter, r *http.Request) {
+			defer GinkgoRecover()
+			Expect(r.Header.Get("Authorization")).To(Equal("Bearer some-token"))
+			Expect(r.URL.Query().Get("current")).To(Equal("true"))
+
+			value, ok := credentials[r.URL.Query().Get("name")]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+
+			fmt.Fprintf(w, `{"data": [{"type": "value", "value": %s}]}`, value)
+		})
+
+		server = httptest.NewTLSServer(mux)
+
+		caCert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+
+		var err error
+		client, err = credhub.NewClient(config.CredHubConfig{
+			URL:          server.URL,
+			UAAURL:       server.URL,
+			Client:       "bpm",
+			ClientSecret: "secret",
+			CACert:       string(caCert),
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("fetches string credentials", func() {
+		value, err := client.Get("/db/password")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(value).To(Equal("hunter2"))
+	})
+
+	It("fetches structured credentials as json", func() {
+		value, err := client.Get("/db/cert")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(value).To(MatchJSON(`{"certificate": "CERT", "private_key": "KEY"}`))
+	})
+
+	It("only authenticates once", func() {
+		_, err := client.Get("/db/password")
+		Expect(err).NotTo(HaveOccurred())
+		_, err = client.Get("/db/cert")
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(tokenCalls).To(Equal(1))
+	})
+
+	Context("when the credential does not exist", func() {
+		It("returns an error", func() {
+			_, err := client.Get("/missing")
+			Expect(err).To(MatchError(ContainSubstring("/missing")))
+		})
+	})
+
+	Context("when the CA certificate is invalid", func() {
+		It("returns an error", func() {
+			_, err := credhub.NewClient(config.CredHubConfig{URL: server.URL, CACert: "not a certificate"})
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
@@ -0,0 +1,85 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+// Package diskspace checks that the filesystems which a process writes to
+// have enough free space before it is started. A process started on a full
+// disk fails part of the way through in ways which are hard to diagnose.
+package diskspace
+
+import (
+	"fmt"
+	"os"
+
+	"code.cloudfoundry.org/bytefmt"
+	"golang.org/x/sys/unix"
+)
+
+// Requirement is an amount of space which must be free on the filesystem
+// containing Path.
+type Requirement struct {
+	Path    string
+	MinFree uint64
+}
+
+// InsufficientError is returned when a filesystem does not have the space
+// which was required.
+type InsufficientError struct {
+	Path  string
+	Needs uint64
+	Has   uint64
+}
+
+func (e *InsufficientError) Error() string {
+	return fmt.Sprintf(
+		"insufficient disk space on %s (needs %s, has %s)",
+		e.Path,
+		bytefmt.ByteSize(e.Needs),
+		bytefmt.ByteSize(e.Has),
+	)
+}
+
+// Check returns an InsufficientError for the first requirement which is not
+// met. Requirements of zero and paths which do not exist are skipped.
+func Check(requirements []Requirement) error {
+	for _, r := range requirements {
+		if r.MinFree == 0 {
+			continue
+		}
+
+		free, err := Free(r.Path)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return fmt.Errorf("failed to check free space on %s: %s", r.Path, err)
+		}
+
+		if free < r.MinFree {
+			return &InsufficientError{Path: r.Path, Needs: r.MinFree, Has: free}
+		}
+	}
+
+	return nil
+}
+
+// Free returns the number of bytes which unprivileged users can still write
+// to the filesystem containing path.
+func Free(path string) (uint64, error) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(path, &st); err != nil {
+		return 0, &os.PathError{Op: "statfs", Path: path, Err: err}
+	}
+
+	return st.Bavail * uint64(st.Bsize), nil
+}
@@ -0,0 +1,78 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package diskspace_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"bpm/diskspace"
+)
+
+var _ = Describe("Check", func() {
+	var (
+		dir  string
+		free uint64
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "diskspace")
+		Expect(err).NotTo(HaveOccurred())
+
+		free, err = diskspace.Free(dir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(free).To(BeNumerically(">", 0))
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dir)).To(Succeed())
+	})
+
+	It("succeeds when there is enough free space", func() {
+		Expect(diskspace.Check([]diskspace.Requirement{{Path: dir, MinFree: 1}})).To(Succeed())
+	})
+
+	It("reports which filesystem does not have enough free space", func() {
+		err := diskspace.Check([]diskspace.Requirement{
+			{Path: dir, MinFree: 1},
+			{Path: dir, MinFree: free * 1024},
+		})
+
+		Expect(err).To(BeAssignableToTypeOf(&diskspace.InsufficientError{}))
+		Expect(err.(*diskspace.InsufficientError).Path).To(Equal(dir))
+		Expect(err.(*diskspace.InsufficientError).Needs).To(Equal(free * 1024))
+		Expect(err).To(MatchError(ContainSubstring("insufficient disk space on " + dir + " (needs ")))
+	})
+
+	It("skips requirements of zero and paths which do not exist", func() {
+		Expect(diskspace.Check([]diskspace.Requirement{
+			{Path: dir, MinFree: 0},
+			{Path: filepath.Join(dir, "missing"), MinFree: 1},
+		})).To(Succeed())
+	})
+})
+
+var _ = Describe("InsufficientError", func() {
+	It("says how much space was needed and how much there is", func() {
+		err := &diskspace.InsufficientError{Path: "/var/vcap/data", Needs: 50 * 1024 * 1024, Has: 3 * 1024 * 1024}
+		Expect(err).To(MatchError("insufficient disk space on /var/vcap/data (needs 50M, has 3M)"))
+	})
+})
@@ -0,0 +1,145 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+// Package doctor checks that the host is set up so that bpm can run
+// processes on it.
+package doctor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/sys/unix"
+
+	"bpm/bosh"
+	"bpm/config"
+	"bpm/models"
+	"bpm/sysfeat"
+)
+
+// StateDirs returns the directories which bpm writes its own state to, by the
+// name that their check is reported with.
+func StateDirs(env *bosh.Env) []models.HostCheck {
+	return []models.HostCheck{
+		{Check: "bundles", Path: config.BundlesRoot(env)},
+		{Check: "locks", Path: config.LocksPath(env)},
+		{Check: "status", Path: config.StatusRoot(env)},
+		{Check: "metrics", Path: config.MetricsRoot(env)},
+		{Check: "overrides", Path: config.OverridesRoot(env)},
+		{Check: "quarantine", Path: config.QuarantineRoot(env)},
+		{Check: "egress classes", Path: config.EgressRoot(env)},
+		{Check: "pid files", Path: env.RunDir("bpm").External()},
+		{Check: "runc state", Path: config.RuncRoot(env)},
+		{Check: "runc job state", Path: config.RuncJobRoots(env)},
+		{Check: "logs", Path: env.Root().Join("sys", "log").External()},
+	}
+}
+
+// CheckStateDirs checks that bpm is able to write to each of its state
+// directories. A directory which does not exist yet is checked by whether it
+// could be created. Nothing is written while checking.
+func CheckStateDirs(env *bosh.Env) []models.HostCheck {
+	checks := StateDirs(env)
+	for i := range checks {
+		if err := checkWritable(checks[i].Path); err != nil {
+			checks[i].Problem = err.Error()
+			continue
+		}
+
+		checks[i].OK = true
+	}
+
+	return checks
+}
+
+// skippedWithout describes what bpm does without each cgroup controller.
+var skippedWithout = map[string]string{
+	"cpu":     "limits.cpus, limits.cpu_shares and realtime budgets are skipped",
+	"cpuset":  "limits.cpuset and numa_node are skipped",
+	"memory":  "memory limits are skipped and no OOM events are reported",
+	"pids":    "limits.processes is skipped",
+	"blkio":   "limits.blkio and limits.io_weight are skipped",
+	"hugetlb": "limits.hugepages is skipped",
+	"devices": "devices can be used without being listed",
+}
+
+// CheckFeatures reports which of the kernel features that bpm relies on are
+// unavailable on the host and what it does without them. Nested hosts, such
+// as bosh-lite and warden stemcells, lack some of them. A process still
+// starts without a feature so these checks are informational.
+func CheckFeatures(features sysfeat.Features) []models.HostCheck {
+	var checks []models.HostCheck
+	for _, controller := range sysfeat.Controllers {
+		check := models.HostCheck{Check: controller + " controller", OK: true}
+		if features.ControllerMissing(controller) {
+			check.OK = false
+			check.Problem = "missing: " + skippedWithout[controller]
+		}
+		checks = append(checks, check)
+	}
+
+	optional := []struct {
+		check     string
+		supported bool
+		skipped   string
+	}{
+		{"swap accounting", features.SwapLimitSupported, "limits.swap is refused"},
+		{"kernel memory limit", features.KernelMemoryLimitSupported, "limits.kernel_memory is skipped"},
+		{"swappiness", features.SwappinessSupported, "limits.swappiness is skipped"},
+		{"io weight", features.IOWeightSupported, "limits.io_weight is skipped"},
+		{"net_cls", features.NetClassSupported, "network.egress_rate is skipped"},
+		{"realtime groups", features.RealtimeGroupsSupported, "realtime processes get no budget of their own"},
+	}
+	for _, o := range optional {
+		check := models.HostCheck{Check: o.check, OK: o.supported}
+		if !o.supported {
+			check.Problem = "unsupported: " + o.skipped
+		}
+		checks = append(checks, check)
+	}
+
+	return checks
+}
+
+func checkWritable(path string) error {
+	dir := path
+	for {
+		fi, err := os.Stat(dir)
+		if err == nil {
+			if !fi.IsDir() {
+				return fmt.Errorf("%s is not a directory", dir)
+			}
+			break
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return fmt.Errorf("%s does not exist", dir)
+		}
+		dir = parent
+	}
+
+	if err := unix.Access(dir, unix.W_OK); err != nil {
+		if err == unix.EROFS {
+			return fmt.Errorf("%s is on a read-only filesystem", dir)
+		}
+		return fmt.Errorf("%s is not writable: %s", dir, err)
+	}
+
+	return nil
+}
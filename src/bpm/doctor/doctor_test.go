@@ -0,0 +1,121 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package doctor_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"bpm/bosh"
+	"bpm/doctor"
+	"bpm/models"
+	"bpm/sysfeat"
+)
+
+var _ = Describe("CheckStateDirs", func() {
+	var (
+		root string
+		env  *bosh.Env
+	)
+
+	BeforeEach(func() {
+		var err error
+		root, err = ioutil.TempDir("", "doctor")
+		Expect(err).NotTo(HaveOccurred())
+
+		env = bosh.NewEnv(root)
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(root)).To(Succeed())
+	})
+
+	It("checks that every state directory could be written to", func() {
+		checks := doctor.CheckStateDirs(env)
+		Expect(checks).To(ContainElement(models.HostCheck{
+			Check: "locks",
+			Path:  filepath.Join(root, "data", "bpm", "locks"),
+			OK:    true,
+		}))
+
+		for _, check := range checks {
+			Expect(check.OK).To(BeTrue(), check.Check)
+		}
+	})
+
+	It("does not create the directories", func() {
+		doctor.CheckStateDirs(env)
+
+		_, err := os.Stat(filepath.Join(root, "data"))
+		Expect(os.IsNotExist(err)).To(BeTrue())
+	})
+
+	Context("when a directory is in the way", func() {
+		BeforeEach(func() {
+			Expect(os.MkdirAll(filepath.Join(root, "sys"), 0755)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(root, "sys", "log"), nil, 0644)).To(Succeed())
+		})
+
+		It("reports a problem", func() {
+			Expect(doctor.CheckStateDirs(env)).To(ContainElement(models.HostCheck{
+				Check:   "logs",
+				Path:    filepath.Join(root, "sys", "log"),
+				Problem: filepath.Join(root, "sys", "log") + " is not a directory",
+			}))
+		})
+	})
+
+	Context("when the state has been relocated", func() {
+		It("checks the relocated directories", func() {
+			env.RelocateState("sys/run", filepath.Join(root, "run"))
+
+			Expect(doctor.CheckStateDirs(env)).To(ContainElement(models.HostCheck{
+				Check: "runc state",
+				Path:  filepath.Join(root, "run", "bpm-runc"),
+				OK:    true,
+			}))
+		})
+	})
+})
+
+var _ = Describe("CheckFeatures", func() {
+	It("reports what is skipped without a missing controller", func() {
+		checks := doctor.CheckFeatures(sysfeat.Features{
+			MissingControllers: []string{"memory"},
+		})
+		Expect(checks).To(ContainElement(models.HostCheck{
+			Check:   "memory controller",
+			Problem: "missing: memory limits are skipped and no OOM events are reported",
+		}))
+		Expect(checks).To(ContainElement(models.HostCheck{
+			Check: "pids controller",
+			OK:    true,
+		}))
+	})
+
+	It("reports unsupported features", func() {
+		checks := doctor.CheckFeatures(sysfeat.Features{IOWeightSupported: true})
+		Expect(checks).To(ContainElement(models.HostCheck{Check: "io weight", OK: true}))
+		Expect(checks).To(ContainElement(models.HostCheck{
+			Check:   "net_cls",
+			Problem: "unsupported: network.egress_rate is skipped",
+		}))
+	})
+})
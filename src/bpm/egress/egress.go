@@ -0,0 +1,339 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+// Package egress holds processes to the rate at which they may send network
+// traffic. Processes share the host's network stack, so the packets of each
+// limited process are tagged with a net_cls class ID and an HTB class with
+// that ID on the host's interface holds them to the rate. Traffic from
+// anything else is not classified and is sent unshaped.
+package egress
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// DefaultTCPath is where the stemcell keeps tc.
+const DefaultTCPath = "/sbin/tc"
+
+// RouteFile is the kernel's IPv4 routing table.
+const RouteFile = "/proc/net/route"
+
+// major is the major number of the class of each process, which is also the
+// handle of the qdisc which bpm installs on an interface.
+const (
+	major       = 0xb9
+	qdiscHandle = "b9:"
+)
+
+// maxMinor is the largest minor number of a class. HTB does not allow minor
+// number 0xffff.
+const maxMinor = 0xfffe
+
+// preferredMinor is the minor number which a container is given if no other
+// container holds it, so that containers usually keep the same class.
+func preferredMinor(containerID string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(containerID))
+
+	return h.Sum32()%maxMinor + 1
+}
+
+// Classes records which container holds each class ID so that no two
+// containers are given the same one, and so that the class of a container can
+// be found again after its configuration has changed. Each class ID which is
+// held has a file in the directory, named by its minor number in hex, which
+// holds the ID of its container.
+type Classes struct {
+	dir string
+}
+
+func NewClasses(dir string) *Classes {
+	return &Classes{dir: dir}
+}
+
+// Allocate returns the class ID of a container, giving it one if it does not
+// hold one yet.
+func (c *Classes) Allocate(containerID string) (uint32, error) {
+	if classID, ok, err := c.Lookup(containerID); err != nil || ok {
+		return classID, err
+	}
+
+	if err := os.MkdirAll(c.dir, 0700); err != nil {
+		return 0, err
+	}
+
+	// The record is written in full before it is linked into place so that
+	// a class is never held by a partly written record.
+	claim, err := ioutil.TempFile(c.dir, ".claim-")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(claim.Name())
+
+	if _, err := claim.WriteString(containerID); err != nil {
+		claim.Close()
+		return 0, err
+	}
+	if err := claim.Close(); err != nil {
+		return 0, err
+	}
+
+	start := preferredMinor(containerID)
+	for i := uint32(0); i < maxMinor; i++ {
+		minor := (start-1+i)%maxMinor + 1
+
+		err := os.Link(claim.Name(), c.path(minor))
+		if err == nil {
+			return major<<16 | minor, nil
+		} else if !os.IsExist(err) {
+			return 0, err
+		}
+	}
+
+	return 0, errors.New("every egress class is held by another container")
+}
+
+// Lookup returns the class ID which a container holds. It returns false if
+// the container does not hold one.
+func (c *Classes) Lookup(containerID string) (uint32, bool, error) {
+	entries, err := ioutil.ReadDir(c.dir)
+	if os.IsNotExist(err) {
+		return 0, false, nil
+	} else if err != nil {
+		return 0, false, err
+	}
+
+	for _, entry := range entries {
+		minor, err := strconv.ParseUint(entry.Name(), 16, 16)
+		if err != nil || minor == 0 || minor > maxMinor {
+			continue
+		}
+
+		owner, err := ioutil.ReadFile(filepath.Join(c.dir, entry.Name()))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return 0, false, err
+		}
+
+		if string(owner) == containerID {
+			return major<<16 | uint32(minor), true, nil
+		}
+	}
+
+	return 0, false, nil
+}
+
+// Release gives up the class ID which a container holds, if any, so that
+// another container may be given it.
+func (c *Classes) Release(containerID string) error {
+	classID, ok, err := c.Lookup(containerID)
+	if err != nil || !ok {
+		return err
+	}
+
+	err = os.Remove(c.path(classID & 0xffff))
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	return err
+}
+
+func (c *Classes) path(minor uint32) string {
+	return filepath.Join(c.dir, fmt.Sprintf("%x", minor))
+}
+
+// Handle formats a class ID the way tc writes it, such as b9:1f.
+func Handle(classID uint32) string {
+	return fmt.Sprintf("%x:%x", classID>>16, classID&0xffff)
+}
+
+// DefaultInterface returns the interface of the default route in routeFile,
+// which is where the traffic of a process leaves the host. Only the IPv4
+// routing table is read, so a host whose only default route is an IPv6 one
+// has no interface to shape.
+func DefaultInterface(routeFile string) (string, error) {
+	f, err := os.Open(routeFile)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 8 {
+			continue
+		}
+
+		if fields[1] == "00000000" && fields[7] == "00000000" {
+			return fields[0], nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+
+	return "", errors.New("the host has no default route")
+}
+
+// Shaper manages the classes of processes on an interface with tc.
+type Shaper struct {
+	tcPath string
+}
+
+func NewShaper(tcPath string) *Shaper {
+	return &Shaper{tcPath: tcPath}
+}
+
+// Limit holds the traffic with classID which leaves through iface to
+// bytesPerSecond, installing bpm's qdisc and classifier on the interface if
+// they are not there yet. Limiting a class again changes its rate.
+func (s *Shaper) Limit(iface string, classID uint32, bytesPerSecond uint64) error {
+	if err := s.install(iface); err != nil {
+		return err
+	}
+
+	rate := fmt.Sprintf("%dbps", bytesPerSecond)
+	_, err := s.tc("class", "replace", "dev", iface, "parent", qdiscHandle, "classid", Handle(classID), "htb", "rate", rate, "ceil", rate)
+	return err
+}
+
+// Unlimit removes the class with classID from iface if it is there. Once the
+// last class has gone bpm's qdisc is removed too, which gives the interface
+// back the root qdisc which the kernel attaches by default.
+func (s *Shaper) Unlimit(iface string, classID uint32) error {
+	kind, handle, err := s.rootQdisc(iface)
+	if err != nil {
+		return err
+	}
+
+	if kind != "htb" || handle != qdiscHandle {
+		return nil
+	}
+
+	classes, err := s.classes(iface)
+	if err != nil {
+		return err
+	}
+
+	remaining := 0
+	for _, class := range classes {
+		if class == Handle(classID) {
+			if _, err := s.tc("class", "del", "dev", iface, "classid", class); err != nil {
+				return err
+			}
+			continue
+		}
+		remaining++
+	}
+
+	if remaining > 0 {
+		return nil
+	}
+
+	_, err = s.tc("qdisc", "del", "dev", iface, "root", "handle", qdiscHandle)
+	return err
+}
+
+// install replaces the root qdisc of iface with an HTB qdisc which sends
+// unclassified traffic straight out, and adds a filter which classifies
+// packets by the net_cls class ID of the cgroup which sent them. Only the
+// default root qdisc which the kernel attached, which has handle 0:, is
+// replaced. One which someone else installed is left alone and an error is
+// returned instead, since bpm would have no way to put it back.
+func (s *Shaper) install(iface string) error {
+	kind, handle, err := s.rootQdisc(iface)
+	if err != nil {
+		return err
+	}
+
+	if kind != "htb" || handle != qdiscHandle {
+		if handle != "0:" {
+			return fmt.Errorf("refusing to replace the %s qdisc with handle %s on %s: it was not installed by bpm", kind, handle, iface)
+		}
+
+		if _, err := s.tc("qdisc", "replace", "dev", iface, "root", "handle", qdiscHandle, "htb"); err != nil {
+			return err
+		}
+	}
+
+	filters, err := s.tc("filter", "show", "dev", iface, "parent", qdiscHandle)
+	if err != nil {
+		return err
+	}
+
+	if !strings.Contains(filters, "cgroup") {
+		if _, err := s.tc("filter", "add", "dev", iface, "parent", qdiscHandle, "protocol", "all", "prio", "10", "handle", "1:", "cgroup"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// rootQdisc returns the kind and handle of the root qdisc of iface.
+func (s *Shaper) rootQdisc(iface string) (string, string, error) {
+	qdiscs, err := s.tc("qdisc", "show", "dev", iface)
+	if err != nil {
+		return "", "", err
+	}
+
+	for _, line := range strings.Split(qdiscs, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 4 && fields[0] == "qdisc" && fields[3] == "root" {
+			return fields[1], fields[2], nil
+		}
+	}
+
+	return "", "", fmt.Errorf("%s has no root qdisc", iface)
+}
+
+// classes returns the handles of the classes under bpm's qdisc on iface.
+func (s *Shaper) classes(iface string) ([]string, error) {
+	output, err := s.tc("class", "show", "dev", iface, "parent", qdiscHandle)
+	if err != nil {
+		return nil, err
+	}
+
+	var classes []string
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 3 && fields[0] == "class" {
+			classes = append(classes, fields[2])
+		}
+	}
+
+	return classes, nil
+}
+
+func (s *Shaper) tc(args ...string) (string, error) {
+	output, err := exec.Command(s.tcPath, args...).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("tc %s: %s: %s", strings.Join(args, " "), err, strings.TrimSpace(string(output)))
+	}
+
+	return string(output), nil
+}
@@ -0,0 +1,216 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package egress_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"bpm/egress"
+)
+
+var _ = Describe("Egress", func() {
+	var tempDir string
+
+	BeforeEach(func() {
+		var err error
+		tempDir, err = ioutil.TempDir("", "egress")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(tempDir)).To(Succeed())
+	})
+
+	Describe("Classes", func() {
+		var classes *egress.Classes
+
+		BeforeEach(func() {
+			classes = egress.NewClasses(filepath.Join(tempDir, "classes"))
+		})
+
+		lookup := func(containerID string) uint32 {
+			id, ok, err := classes.Lookup(containerID)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ok).To(BeTrue())
+			return id
+		}
+
+		It("gives a container the same class until it is released", func() {
+			id, err := classes.Allocate("job.server")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(id >> 16).To(Equal(uint32(0xb9)))
+			Expect(id & 0xffff).NotTo(BeZero())
+			Expect(egress.Handle(id)).To(HavePrefix("b9:"))
+
+			Expect(classes.Allocate("job.server")).To(Equal(id))
+			Expect(lookup("job.server")).To(Equal(id))
+
+			Expect(classes.Release("job.server")).To(Succeed())
+			_, ok, err := classes.Lookup("job.server")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ok).To(BeFalse())
+		})
+
+		It("does not give a class which another container holds", func() {
+			id, err := classes.Allocate("job.server")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(classes.Release("job.server")).To(Succeed())
+
+			// Another container holds the class which this one would
+			// have been given first.
+			held := filepath.Join(tempDir, "classes", fmt.Sprintf("%x", id&0xffff))
+			Expect(ioutil.WriteFile(held, []byte("job.worker"), 0600)).To(Succeed())
+
+			other, err := classes.Allocate("job.server")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(other).NotTo(Equal(id))
+			Expect(lookup("job.worker")).To(Equal(id))
+			Expect(lookup("job.server")).To(Equal(other))
+		})
+
+		It("has nothing to release for a container without a class", func() {
+			Expect(classes.Release("job.server")).To(Succeed())
+		})
+	})
+
+	Describe("DefaultInterface", func() {
+		It("returns the interface of the default route", func() {
+			routes := filepath.Join(tempDir, "route")
+			Expect(ioutil.WriteFile(routes, []byte(`Iface	Destination	Gateway 	Flags	RefCnt	Use	Metric	Mask		MTU	Window	IRTT
+eth1	0000FEA9	00000000	0001	0	0	0	0000FFFF	0	0	0
+eth0	00000000	0100000A	0003	0	0	0	00000000	0	0	0
+`), 0644)).To(Succeed())
+
+			Expect(egress.DefaultInterface(routes)).To(Equal("eth0"))
+		})
+
+		It("returns an error when there is no default route", func() {
+			routes := filepath.Join(tempDir, "route")
+			Expect(ioutil.WriteFile(routes, []byte("Iface	Destination	Gateway 	Flags	RefCnt	Use	Metric	Mask		MTU	Window	IRTT\n"), 0644)).To(Succeed())
+
+			_, err := egress.DefaultInterface(routes)
+			Expect(err).To(MatchError("the host has no default route"))
+		})
+	})
+
+	Describe("Shaper", func() {
+		var (
+			tcPath  string
+			logPath string
+			shaper  *egress.Shaper
+		)
+
+		writeTC := func(qdiscs, filters, classes string) {
+			script := `#!/bin/sh
+echo "$@" >> ` + logPath + `
+case "$1 $2" in
+"qdisc show") echo '` + qdiscs + `' ;;
+"filter show") echo '` + filters + `' ;;
+"class show") echo '` + classes + `' ;;
+esac
+`
+			Expect(ioutil.WriteFile(tcPath, []byte(script), 0700)).To(Succeed())
+		}
+
+		calls := func() []string {
+			data, err := ioutil.ReadFile(logPath)
+			Expect(err).NotTo(HaveOccurred())
+			return strings.Split(strings.TrimSpace(string(data)), "\n")
+		}
+
+		BeforeEach(func() {
+			tcPath = filepath.Join(tempDir, "tc")
+			logPath = filepath.Join(tempDir, "calls")
+			shaper = egress.NewShaper(tcPath)
+		})
+
+		It("installs the qdisc and classifier before adding the class of the process", func() {
+			writeTC("qdisc fq_codel 0: root refcnt 2", "", "")
+
+			Expect(shaper.Limit("eth0", 0xb90002, 20*1024*1024)).To(Succeed())
+			Expect(calls()).To(Equal([]string{
+				"qdisc show dev eth0",
+				"qdisc replace dev eth0 root handle b9: htb",
+				"filter show dev eth0 parent b9:",
+				"filter add dev eth0 parent b9: protocol all prio 10 handle 1: cgroup",
+				"class replace dev eth0 parent b9: classid b9:2 htb rate 20971520bps ceil 20971520bps",
+			}))
+		})
+
+		It("leaves them alone when they are already installed", func() {
+			writeTC("qdisc htb b9: root refcnt 2 r2q 10 default 0", "filter parent b9: protocol all pref 10 cgroup chain 0 handle 0x1", "")
+
+			Expect(shaper.Limit("eth0", 0xb90002, 1024)).To(Succeed())
+			Expect(calls()).To(Equal([]string{
+				"qdisc show dev eth0",
+				"filter show dev eth0 parent b9:",
+				"class replace dev eth0 parent b9: classid b9:2 htb rate 1024bps ceil 1024bps",
+			}))
+		})
+
+		It("refuses to replace a root qdisc which someone else installed", func() {
+			writeTC("qdisc mq 1: root\nqdisc fq 0: parent 1:1 limit 10000p", "", "")
+
+			err := shaper.Limit("eth0", 0xb90002, 1024)
+			Expect(err).To(MatchError("refusing to replace the mq qdisc with handle 1: on eth0: it was not installed by bpm"))
+			Expect(calls()).To(Equal([]string{"qdisc show dev eth0"}))
+		})
+
+		It("removes the class of the process", func() {
+			writeTC("qdisc htb b9: root refcnt 2 r2q 10 default 0", "", "class htb b9:2 root prio 0 rate 8Kbit ceil 8Kbit\nclass htb b9:3 root prio 0 rate 8Kbit ceil 8Kbit")
+
+			Expect(shaper.Unlimit("eth0", 0xb90002)).To(Succeed())
+			Expect(calls()).To(Equal([]string{
+				"qdisc show dev eth0",
+				"class show dev eth0 parent b9:",
+				"class del dev eth0 classid b9:2",
+			}))
+		})
+
+		It("removes its qdisc once the last class has gone", func() {
+			writeTC("qdisc htb b9: root refcnt 2 r2q 10 default 0", "", "class htb b9:2 root prio 0 rate 8Kbit ceil 8Kbit")
+
+			Expect(shaper.Unlimit("eth0", 0xb90002)).To(Succeed())
+			Expect(calls()).To(Equal([]string{
+				"qdisc show dev eth0",
+				"class show dev eth0 parent b9:",
+				"class del dev eth0 classid b9:2",
+				"qdisc del dev eth0 root handle b9:",
+			}))
+		})
+
+		It("does nothing when the class is not there", func() {
+			writeTC("qdisc fq_codel 0: root refcnt 2", "", "")
+
+			Expect(shaper.Unlimit("eth0", 0xb90002)).To(Succeed())
+			Expect(calls()).To(Equal([]string{"qdisc show dev eth0"}))
+		})
+
+		It("returns the output of tc when it fails", func() {
+			Expect(ioutil.WriteFile(tcPath, []byte("#!/bin/sh\necho 'Cannot find device \"eth9\"' >&2\nexit 1\n"), 0700)).To(Succeed())
+
+			err := shaper.Limit("eth9", 0xb90002, 1024)
+			Expect(err).To(MatchError(ContainSubstring(`Cannot find device "eth9"`)))
+		})
+	})
+})
@@ -0,0 +1,203 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package execcheck
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// containerFS finds the files which are visible at paths inside a container
+// by following its bind mounts back to the host. Paths which are not below
+// any bind mount are not visible: the root filesystem of a bpm container is
+// empty.
+type containerFS struct {
+	mounts []specs.Mount
+}
+
+func newContainerFS(mounts []specs.Mount) *containerFS {
+	var binds []specs.Mount
+	for _, m := range mounts {
+		if isBind(m) {
+			binds = append(binds, m)
+		}
+	}
+
+	return &containerFS{mounts: binds}
+}
+
+func isBind(m specs.Mount) bool {
+	if m.Type == "bind" {
+		return true
+	}
+
+	for _, opt := range m.Options {
+		if opt == "bind" || opt == "rbind" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// hostPath returns where a path inside the container is on the host without
+// following any symbolic links. The innermost mount containing the path wins
+// and later mounts hide earlier ones at the same destination.
+func (fs *containerFS) hostPath(path string) (string, bool, bool) {
+	best := -1
+	for i, m := range fs.mounts {
+		dest := filepath.Clean(m.Destination)
+		if dest != "/" && path != dest && !strings.HasPrefix(path, dest+"/") {
+			continue
+		}
+
+		if best < 0 || len(dest) >= len(filepath.Clean(fs.mounts[best].Destination)) {
+			best = i
+		}
+	}
+
+	if best < 0 {
+		return "", false, false
+	}
+
+	m := fs.mounts[best]
+	rel := strings.TrimPrefix(path, filepath.Clean(m.Destination))
+
+	return filepath.Join(m.Source, rel), rel == "", true
+}
+
+func (fs *containerFS) leadsToMount(dir string) bool {
+	for _, m := range fs.mounts {
+		if strings.HasPrefix(filepath.Clean(m.Destination), dir+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// resolve follows symbolic links inside the container, as the kernel would,
+// and returns the resolved path inside the container along with where it is
+// on the host.
+func (fs *containerFS) resolve(path string) (string, string, bool) {
+	pending := splitPath(path)
+	current := "/"
+
+	for hops := 0; len(pending) > 0; {
+		component := pending[0]
+		pending = pending[1:]
+
+		switch component {
+		case ".":
+			continue
+		case "..":
+			current = filepath.Dir(current)
+			continue
+		}
+
+		next := filepath.Join(current, component)
+		host, mountPoint, ok := fs.hostPath(next)
+		if !ok {
+			// runc creates the directories leading to each mount in
+			// the otherwise empty root filesystem.
+			if len(pending) > 0 && fs.leadsToMount(next) {
+				current = next
+				continue
+			}
+
+			return "", "", false
+		}
+
+		// The source of a mount is resolved on the host when it is
+		// mounted so any link there is not seen inside the container.
+		if mountPoint {
+			current = next
+			continue
+		}
+
+		info, err := os.Lstat(host)
+		if err != nil {
+			return "", "", false
+		}
+
+		if info.Mode()&os.ModeSymlink != 0 {
+			hops++
+			if hops > maxSymlinks {
+				return "", "", false
+			}
+
+			target, err := os.Readlink(host)
+			if err != nil {
+				return "", "", false
+			}
+
+			if filepath.IsAbs(target) {
+				current = "/"
+			}
+			pending = append(splitPath(target), pending...)
+			continue
+		}
+
+		current = next
+	}
+
+	host, _, ok := fs.hostPath(current)
+	if !ok {
+		return "", "", false
+	}
+
+	if _, err := os.Stat(host); err != nil {
+		return "", "", false
+	}
+
+	return current, host, true
+}
+
+// glob expands a pattern whose last element may contain wildcards.
+func (fs *containerFS) glob(pattern string) []string {
+	dir, base := filepath.Split(pattern)
+
+	resolvedDir, hostDir, ok := fs.resolve(dir)
+	if !ok {
+		return nil
+	}
+
+	matches, err := filepath.Glob(filepath.Join(hostDir, base))
+	if err != nil {
+		return nil
+	}
+
+	var paths []string
+	for _, match := range matches {
+		paths = append(paths, filepath.Join(resolvedDir, filepath.Base(match)))
+	}
+
+	return paths
+}
+
+func splitPath(path string) []string {
+	var components []string
+	for _, component := range strings.Split(path, "/") {
+		if component != "" {
+			components = append(components, component)
+		}
+	}
+
+	return components
+}
@@ -0,0 +1,408 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+// Package execcheck verifies, before a container is created, that the
+// executable of a process will be able to run inside it. A dynamically linked
+// executable whose interpreter or shared libraries live in a directory which
+// is not mounted into the container otherwise fails with a bare exec error
+// that does not say what is missing.
+package execcheck
+
+import (
+	"bufio"
+	"bytes"
+	"debug/elf"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+
+	"bpm/config"
+)
+
+// maxSymlinks is the number of symbolic links which are followed while
+// resolving a single path before giving up, as the kernel does.
+const maxSymlinks = 40
+
+const defaultPath = "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+
+// Checker checks the executables of processes against the mounts of their
+// containers.
+type Checker struct{}
+
+func NewChecker() *Checker {
+	return &Checker{}
+}
+
+// CheckExecutable returns an error describing each file which the executable
+// of the process needs in order to start but which is not visible inside the
+// container described by spec. Executables which are not ELF binaries or
+// scripts are not checked.
+func (c *Checker) CheckExecutable(bpmCfg *config.BPMConfig, procCfg *config.ProcessConfig, spec specs.Spec) error {
+	ch := &check{
+		bpmCfg: bpmCfg,
+		fs:     newContainerFS(spec.Mounts),
+		seen:   map[string]bool{},
+	}
+
+	var env []string
+	cwd := "/"
+	if spec.Process != nil {
+		env = spec.Process.Env
+		if spec.Process.Cwd != "" {
+			cwd = spec.Process.Cwd
+		}
+	}
+	ch.libraryPath = splitList(lookupEnv(env, "LD_LIBRARY_PATH"))
+
+	path := lookupEnv(env, "PATH")
+	if path == "" {
+		path = defaultPath
+	}
+
+	ch.checkExecutable(procCfg.Executable, cwd, splitList(path))
+
+	if len(ch.problems) > 0 {
+		return fmt.Errorf("%s cannot run inside its container: %s", procCfg.Executable, strings.Join(ch.problems, "; "))
+	}
+
+	return nil
+}
+
+type check struct {
+	bpmCfg      *config.BPMConfig
+	fs          *containerFS
+	libraryPath []string
+	searchDirs  []string
+	seen        map[string]bool
+	problems    []string
+}
+
+func (c *check) problem(format string, args ...interface{}) {
+	c.problems = append(c.problems, fmt.Sprintf(format, args...))
+}
+
+func (c *check) checkExecutable(name, cwd string, path []string) {
+	var candidates []string
+	switch {
+	case filepath.IsAbs(name):
+		candidates = []string{name}
+	case strings.Contains(name, "/"):
+		candidates = []string{filepath.Join(cwd, name)}
+	default:
+		for _, dir := range path {
+			candidates = append(candidates, filepath.Join(dir, name))
+		}
+	}
+
+	for _, candidate := range candidates {
+		resolved, host, ok := c.fs.resolve(candidate)
+		if !ok {
+			continue
+		}
+
+		c.checkFile(resolved, host)
+		return
+	}
+
+	c.problem(c.missing("executable "+name, candidates))
+}
+
+func (c *check) checkFile(containerPath, hostPath string) {
+	f, err := os.Open(hostPath)
+	if err != nil {
+		c.problem("cannot read %s: %s", containerPath, err)
+		return
+	}
+	defer f.Close()
+
+	magic := make([]byte, 4)
+	if _, err := io.ReadFull(f, magic); err != nil {
+		return
+	}
+
+	switch {
+	case bytes.HasPrefix(magic, []byte("#!")):
+		c.checkScript(containerPath, f)
+	case bytes.Equal(magic, []byte(elf.ELFMAG)):
+		c.checkELF(containerPath, f)
+	}
+}
+
+// checkScript checks that the interpreter named on the first line of a
+// script is visible.
+func (c *check) checkScript(containerPath string, f *os.File) {
+	if _, err := f.Seek(2, io.SeekStart); err != nil {
+		return
+	}
+
+	line, err := bufio.NewReader(f).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return
+	}
+
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return
+	}
+
+	interpreter := fields[0]
+	if _, _, ok := c.fs.resolve(interpreter); !ok {
+		c.problem("%s (interpreter of %s)", c.missing(interpreter, []string{interpreter}), containerPath)
+	}
+}
+
+type object struct {
+	path string
+	file *elf.File
+}
+
+// checkELF follows the dynamic dependencies of the executable in the same
+// way as the dynamic loader does, reporting each library which cannot be
+// found.
+func (c *check) checkELF(containerPath string, f *os.File) {
+	exe, err := elf.NewFile(f)
+	if err != nil {
+		c.problem("cannot parse %s: %s", containerPath, err)
+		return
+	}
+
+	if interpreter := programInterpreter(exe); interpreter != "" {
+		if _, _, ok := c.fs.resolve(interpreter); !ok {
+			c.problem("%s (interpreter of %s)", c.missing(interpreter, []string{interpreter}), containerPath)
+			return
+		}
+	} else {
+		// Statically linked executables need nothing else.
+		return
+	}
+
+	c.searchDirs = c.systemSearchDirs(exe)
+
+	queue := []object{{path: containerPath, file: exe}}
+	c.seen[containerPath] = true
+
+	for len(queue) > 0 {
+		obj := queue[0]
+		queue = queue[1:]
+
+		needed, err := obj.file.ImportedLibraries()
+		if err != nil {
+			c.problem("cannot read dependencies of %s: %s", obj.path, err)
+			continue
+		}
+
+		for _, lib := range needed {
+			libPath, libFile, candidates := c.findLibrary(lib, obj, exe)
+			if libFile == nil {
+				c.problem("%s (needed by %s)", c.missing(lib, candidates), obj.path)
+				continue
+			}
+
+			if c.seen[libPath] {
+				libFile.Close()
+				continue
+			}
+			c.seen[libPath] = true
+			queue = append(queue, object{path: libPath, file: libFile})
+		}
+
+		if obj.file != exe {
+			obj.file.Close()
+		}
+	}
+}
+
+// findLibrary searches for a library needed by obj which is compatible with
+// the executable. It returns the candidate paths which were searched if none
+// is found.
+func (c *check) findLibrary(name string, obj object, exe *elf.File) (string, *elf.File, []string) {
+	var dirs []string
+	if strings.Contains(name, "/") {
+		dirs = []string{""}
+	} else {
+		runpath := dynPaths(obj, elf.DT_RUNPATH)
+		if len(runpath) == 0 {
+			dirs = append(dirs, dynPaths(obj, elf.DT_RPATH)...)
+		}
+		dirs = append(dirs, c.libraryPath...)
+		dirs = append(dirs, runpath...)
+		dirs = append(dirs, c.searchDirs...)
+	}
+
+	var candidates []string
+	for _, dir := range dirs {
+		candidate := filepath.Join(dir, name)
+		candidates = append(candidates, candidate)
+
+		resolved, host, ok := c.fs.resolve(candidate)
+		if !ok {
+			continue
+		}
+
+		lib, err := elf.Open(host)
+		if err != nil {
+			continue
+		}
+
+		if lib.Class != exe.Class || lib.Machine != exe.Machine {
+			lib.Close()
+			continue
+		}
+
+		return resolved, lib, nil
+	}
+
+	return "", nil, candidates
+}
+
+// missing describes a file which could not be found inside the container,
+// naming the first of its candidate locations which does exist on the host.
+func (c *check) missing(name string, candidates []string) string {
+	for _, candidate := range candidates {
+		if _, _, ok := c.fs.resolve(candidate); ok {
+			continue
+		}
+
+		host := c.bpmCfg.HostPath(candidate)
+		if _, err := os.Stat(host); err == nil {
+			return fmt.Sprintf("%s not visible inside container (host path %s not mounted)", name, host)
+		}
+	}
+
+	return fmt.Sprintf("%s not found", name)
+}
+
+// systemSearchDirs returns the directories which the dynamic loader searches
+// after those named by the objects themselves: the directories configured in
+// /etc/ld.so.conf followed by the trusted default directories.
+func (c *check) systemSearchDirs(exe *elf.File) []string {
+	dirs := c.ldSoConf("/etc/ld.so.conf", 0)
+
+	if exe.Class == elf.ELFCLASS64 {
+		dirs = append(dirs, "/lib64", "/usr/lib64")
+	}
+
+	return append(dirs, "/lib", "/usr/lib")
+}
+
+func (c *check) ldSoConf(path string, depth int) []string {
+	if depth > 8 {
+		return nil
+	}
+
+	_, host, ok := c.fs.resolve(path)
+	if !ok {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(host)
+	if err != nil {
+		return nil
+	}
+
+	var dirs []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		if fields[0] != "include" {
+			dirs = append(dirs, fields[0])
+			continue
+		}
+
+		for _, pattern := range fields[1:] {
+			if !filepath.IsAbs(pattern) {
+				pattern = filepath.Join(filepath.Dir(path), pattern)
+			}
+
+			for _, included := range c.fs.glob(pattern) {
+				dirs = append(dirs, c.ldSoConf(included, depth+1)...)
+			}
+		}
+	}
+
+	return dirs
+}
+
+func programInterpreter(f *elf.File) string {
+	for _, prog := range f.Progs {
+		if prog.Type != elf.PT_INTERP {
+			continue
+		}
+
+		data := make([]byte, prog.Filesz)
+		if _, err := prog.ReadAt(data, 0); err != nil {
+			return ""
+		}
+
+		return string(bytes.TrimRight(data, "\x00"))
+	}
+
+	return ""
+}
+
+// dynPaths returns the directories in the RPATH or RUNPATH of an object with
+// $ORIGIN expanded to the directory containing it.
+func dynPaths(obj object, tag elf.DynTag) []string {
+	values, err := obj.file.DynString(tag)
+	if err != nil {
+		return nil
+	}
+
+	origin := filepath.Dir(obj.path)
+
+	var dirs []string
+	for _, value := range values {
+		for _, dir := range splitList(value) {
+			dir = strings.Replace(dir, "${ORIGIN}", origin, -1)
+			dir = strings.Replace(dir, "$ORIGIN", origin, -1)
+			dirs = append(dirs, dir)
+		}
+	}
+
+	return dirs
+}
+
+func lookupEnv(env []string, key string) string {
+	for _, kv := range env {
+		if strings.HasPrefix(kv, key+"=") {
+			return strings.TrimPrefix(kv, key+"=")
+		}
+	}
+
+	return ""
+}
+
+func splitList(list string) []string {
+	var dirs []string
+	for _, dir := range strings.Split(list, ":") {
+		if dir != "" {
+			dirs = append(dirs, dir)
+		}
+	}
+
+	return dirs
+}
@@ -0,0 +1,203 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package execcheck_test
+
+import (
+	"bytes"
+	"debug/elf"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+
+	"bpm/bosh"
+	"bpm/config"
+	"bpm/execcheck"
+)
+
+func bind(source, destination string) specs.Mount {
+	return specs.Mount{Source: source, Destination: destination, Type: "bind"}
+}
+
+func systemMounts() []specs.Mount {
+	return []specs.Mount{
+		bind("/bin", "/bin"),
+		bind("/etc", "/etc"),
+		bind("/lib", "/lib"),
+		bind("/lib64", "/lib64"),
+		bind("/sbin", "/sbin"),
+		bind("/usr", "/usr"),
+	}
+}
+
+// dynamicExecutable returns a dynamically linked executable from the host
+// along with its interpreter.
+func dynamicExecutable() (string, string) {
+	const exe = "/bin/true"
+
+	f, err := elf.Open(exe)
+	if err != nil {
+		Skip(fmt.Sprintf("no ELF executable available: %s", err))
+	}
+	defer f.Close()
+
+	for _, prog := range f.Progs {
+		if prog.Type == elf.PT_INTERP {
+			data := make([]byte, prog.Filesz)
+			_, err := prog.ReadAt(data, 0)
+			Expect(err).NotTo(HaveOccurred())
+			return exe, string(bytes.TrimRight(data, "\x00"))
+		}
+	}
+
+	Skip(exe + " is statically linked")
+	return "", ""
+}
+
+func copyFile(from, to string) {
+	data, err := ioutil.ReadFile(from)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(os.MkdirAll(filepath.Dir(to), 0755)).To(Succeed())
+	Expect(ioutil.WriteFile(to, data, 0755)).To(Succeed())
+}
+
+var _ = Describe("Checker", func() {
+	var (
+		checker *execcheck.Checker
+		bpmCfg  *config.BPMConfig
+		procCfg *config.ProcessConfig
+		spec    specs.Spec
+		tempDir string
+	)
+
+	BeforeEach(func() {
+		var err error
+		tempDir, err = ioutil.TempDir("", "execcheck")
+		Expect(err).NotTo(HaveOccurred())
+
+		checker = execcheck.NewChecker()
+		bpmCfg = config.NewBPMConfig(bosh.NewEnv(tempDir), "example", "server")
+		procCfg = &config.ProcessConfig{Name: "server"}
+		spec = specs.Spec{
+			Process: &specs.Process{
+				Cwd: "/",
+				Env: []string{"PATH=/usr/bin:/bin"},
+			},
+			Mounts: systemMounts(),
+		}
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(tempDir)).To(Succeed())
+	})
+
+	It("allows an executable whose libraries are all mounted", func() {
+		exe, _ := dynamicExecutable()
+		procCfg.Executable = exe
+
+		Expect(checker.CheckExecutable(bpmCfg, procCfg, spec)).To(Succeed())
+	})
+
+	It("looks up executables without a path in the PATH of the process", func() {
+		dynamicExecutable()
+		procCfg.Executable = "true"
+
+		Expect(checker.CheckExecutable(bpmCfg, procCfg, spec)).To(Succeed())
+	})
+
+	It("reports an executable which is not mounted", func() {
+		exe := filepath.Join(tempDir, "bin", "server")
+		copyFile("/bin/true", exe)
+		procCfg.Executable = exe
+
+		err := checker.CheckExecutable(bpmCfg, procCfg, spec)
+		Expect(err).To(MatchError(ContainSubstring(
+			fmt.Sprintf("executable %s not visible inside container (host path %s not mounted)", exe, exe),
+		)))
+	})
+
+	It("reports an executable which does not exist", func() {
+		procCfg.Executable = "/var/vcap/packages/missing/bin/server"
+
+		err := checker.CheckExecutable(bpmCfg, procCfg, spec)
+		Expect(err).To(MatchError(
+			"/var/vcap/packages/missing/bin/server cannot run inside its container: executable /var/vcap/packages/missing/bin/server not found",
+		))
+	})
+
+	It("reports an interpreter which is not mounted", func() {
+		exe, interpreter := dynamicExecutable()
+		procCfg.Executable = exe
+		spec.Mounts = []specs.Mount{bind("/bin", "/bin")}
+
+		err := checker.CheckExecutable(bpmCfg, procCfg, spec)
+		Expect(err).To(MatchError(ContainSubstring(
+			fmt.Sprintf("%s not visible inside container (host path %s not mounted) (interpreter of", interpreter, interpreter),
+		)))
+	})
+
+	It("reports a library which is not mounted", func() {
+		exe, interpreter := dynamicExecutable()
+		procCfg.Executable = exe
+
+		// Only the interpreter itself is visible, not the libraries which
+		// are usually alongside it.
+		onlyInterpreter := filepath.Join(tempDir, "lib")
+		copyFile(interpreter, filepath.Join(onlyInterpreter, filepath.Base(interpreter)))
+		spec.Mounts = []specs.Mount{
+			bind("/bin", "/bin"),
+			bind("/etc", "/etc"),
+			bind(onlyInterpreter, filepath.Dir(interpreter)),
+		}
+
+		err := checker.CheckExecutable(bpmCfg, procCfg, spec)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(MatchRegexp(`libc\.so\.6 not visible inside container \(host path /\S+/libc\.so\.6 not mounted\) \(needed by /bin/true\)`))
+	})
+
+	It("reports the missing interpreter of a script", func() {
+		script := filepath.Join(tempDir, "packages", "server", "bin", "run")
+		Expect(os.MkdirAll(filepath.Dir(script), 0755)).To(Succeed())
+		Expect(ioutil.WriteFile(script, []byte("#!/nonexistent/sh -e\necho hello\n"), 0755)).To(Succeed())
+
+		procCfg.Executable = "/var/vcap/packages/server/bin/run"
+		spec.Mounts = append(spec.Mounts, bind(filepath.Join(tempDir, "packages"), "/var/vcap/packages"))
+
+		err := checker.CheckExecutable(bpmCfg, procCfg, spec)
+		Expect(err).To(MatchError(
+			"/var/vcap/packages/server/bin/run cannot run inside its container: /nonexistent/sh not found (interpreter of /var/vcap/packages/server/bin/run)",
+		))
+	})
+
+	It("follows symbolic links inside the container rather than on the host", func() {
+		exe, _ := dynamicExecutable()
+
+		packages := filepath.Join(tempDir, "packages")
+		Expect(os.MkdirAll(filepath.Join(packages, "server"), 0755)).To(Succeed())
+		Expect(os.MkdirAll(filepath.Join(packages, "real"), 0755)).To(Succeed())
+		copyFile(exe, filepath.Join(packages, "real", "server"))
+		Expect(os.Symlink("/var/vcap/packages/real/server", filepath.Join(packages, "server", "server"))).To(Succeed())
+
+		procCfg.Executable = "/var/vcap/packages/server/server"
+		spec.Mounts = append(spec.Mounts, bind(packages, "/var/vcap/packages"))
+
+		Expect(checker.CheckExecutable(bpmCfg, procCfg, spec)).To(Succeed())
+	})
+})
@@ -16,7 +16,12 @@
 package flock
 
 import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
 	"os"
+	"strconv"
+	"strings"
 	"sync"
 
 	"golang.org/x/sys/unix"
@@ -25,7 +30,8 @@ import (
 // Flock represents a handle on a file which can then be locked and unlocked to
 // provide cross-process synchronization and locking.
 type Flock struct {
-	f *os.File
+	path string
+	f    *os.File
 
 	locked   bool
 	lockedMu sync.Mutex
@@ -34,15 +40,20 @@ type Flock struct {
 // New creates a new handle on a file. If the file does not exist then it is
 // created. The parent directory must already exist before this is called.
 func New(path string) (*Flock, error) {
-	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0600)
+	f, err := open(path)
 	if err != nil {
 		return nil, err
 	}
 	return &Flock{
-		f: f,
+		path: path,
+		f:    f,
 	}, nil
 }
 
+func open(path string) (*os.File, error) {
+	return os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0600)
+}
+
 // Lock exclusively locks the file. Subsequent calls will block until the
 // original lock is released. It is safe to call this concurrently in both the
 // current process and other processes.
@@ -50,13 +61,73 @@ func (f *Flock) Lock() error {
 	f.lockedMu.Lock()
 	defer f.lockedMu.Unlock()
 
-	err := unix.Flock(int(f.f.Fd()), unix.LOCK_EX)
-	if err != nil {
-		return err
+	_, err := f.lock(unix.LOCK_EX)
+	return err
+}
+
+// TryLock exclusively locks the file if nothing else holds the lock. It
+// reports whether the lock was acquired rather than waiting for it.
+func (f *Flock) TryLock() (bool, error) {
+	f.lockedMu.Lock()
+	defer f.lockedMu.Unlock()
+
+	return f.lock(unix.LOCK_EX | unix.LOCK_NB)
+}
+
+// lock takes the lock on the file which is currently at the handle's path. A
+// lock file which has been removed, such as by bpm gc, leaves the file that
+// the handle has open orphaned, in which case the handle switches to a new
+// file and tries again.
+func (f *Flock) lock(how int) (bool, error) {
+	for {
+		err := unix.Flock(int(f.f.Fd()), how)
+		busy := err == unix.EWOULDBLOCK
+		if err != nil && !busy {
+			return false, err
+		}
+
+		current, err := f.isCurrent()
+		if err != nil {
+			if !busy {
+				unix.Flock(int(f.f.Fd()), unix.LOCK_UN)
+			}
+			return false, err
+		}
+
+		if current {
+			f.locked = !busy
+			return !busy, nil
+		}
+
+		newFile, err := open(f.path)
+		if err != nil {
+			if !busy {
+				unix.Flock(int(f.f.Fd()), unix.LOCK_UN)
+			}
+			return false, err
+		}
+
+		// Closing the orphaned file releases any lock taken on it.
+
+		f.f.Close()
+		f.f = newFile
 	}
+}
 
-	f.locked = true
-	return nil
+func (f *Flock) isCurrent() (bool, error) {
+	var held, current unix.Stat_t
+
+	if err := unix.Fstat(int(f.f.Fd()), &held); err != nil {
+		return false, err
+	}
+
+	if err := unix.Stat(f.path, &current); err == unix.ENOENT {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	return held.Dev == current.Dev && held.Ino == current.Ino, nil
 }
 
 // Unlock unlocks the file so that another waiting task can acquire the lock.
@@ -79,3 +150,57 @@ func (f *Flock) Unlock() error {
 	f.locked = false
 	return nil
 }
+
+// SetContents replaces the contents of a locked file. Whoever holds a lock can
+// use them to describe themselves to anyone waiting for it.
+func (f *Flock) SetContents(data []byte) error {
+	if err := f.f.Truncate(0); err != nil {
+		return err
+	}
+
+	_, err := f.f.WriteAt(data, 0)
+	return err
+}
+
+// Contents returns the contents of the file at path, which are those set by
+// whoever holds or last held its lock.
+func Contents(path string) ([]byte, error) {
+	return ioutil.ReadFile(path)
+}
+
+// procLocks is where the kernel lists the locks which are held on the host.
+const procLocks = "/proc/locks"
+
+// Holder returns the pid of the process which took the lock on the file at
+// path, or zero if it is not locked. The process may have exited since if the
+// file was inherited by another process which still has it open.
+func Holder(path string) (int, error) {
+	var st unix.Stat_t
+	if err := unix.Stat(path, &st); err == unix.ENOENT {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	file := fmt.Sprintf("%02x:%02x:%d", unix.Major(uint64(st.Dev)), unix.Minor(uint64(st.Dev)), st.Ino)
+
+	locks, err := os.Open(procLocks)
+	if err != nil {
+		return 0, err
+	}
+	defer locks.Close()
+
+	// Each line looks like "1: FLOCK  ADVISORY  WRITE 1234 fe:00:5678 0 EOF".
+	// Processes waiting for a lock are listed with "->" after the number.
+	scanner := bufio.NewScanner(locks)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 6 || fields[1] != "FLOCK" || fields[5] != file {
+			continue
+		}
+
+		return strconv.Atoi(fields[4])
+	}
+
+	return 0, scanner.Err()
+}
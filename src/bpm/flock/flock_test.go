@@ -114,6 +114,34 @@ var _ = Describe("Flock", func() {
 
 				Eventually(c).Should(BeClosed())
 			})
+
+			It("can be tried without waiting for the lock", func() {
+				Expect(lock.Lock()).To(Succeed())
+
+				acquired, err := lock2.TryLock()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(acquired).To(BeFalse())
+
+				Expect(lock.Unlock()).To(Succeed())
+
+				acquired, err = lock2.TryLock()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(acquired).To(BeTrue())
+				Expect(lock2.Unlock()).To(Succeed())
+			})
+
+			It("takes the lock on a new file when the lock file has been removed", func() {
+				Expect(lock.Lock()).To(Succeed())
+				Expect(os.Remove(lockPath)).To(Succeed())
+
+				acquired, err := lock2.TryLock()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(acquired).To(BeTrue())
+				Expect(lockPath).To(BeAnExistingFile())
+
+				Expect(lock2.Unlock()).To(Succeed())
+				Expect(lock.Unlock()).To(Succeed())
+			})
 		})
 	})
 })
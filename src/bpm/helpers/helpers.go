@@ -0,0 +1,273 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+// Package helpers keeps a registry of the processes which bpm starts on the
+// host to support a process, such as the relays which copy its output into
+// its log sink. Helpers are started in their own session so that they outlive
+// the bpm command which started them, which also means that nothing would
+// stop them if the process's container went away while they were still
+// attached to it. Recording them lets the stop and gc commands tear them down
+// along with the process.
+//
+// Each helper is recorded in a file in the registry directory of its process
+// together with the time it started, so that a pid which the kernel has given
+// to another process since is never signalled.
+package helpers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// TermGrace is how long a helper has to exit after being sent SIGTERM before
+// it is killed.
+const TermGrace = time.Second
+
+const pollInterval = 50 * time.Millisecond
+
+// procRoot is where the kernel describes running processes.
+var procRoot = "/proc"
+
+// Helper is a process which bpm started on the host for a process.
+type Helper struct {
+	Pid  int    `json:"pid"`
+	Kind string `json:"kind"`
+
+	// StartTime is when the helper started in clock ticks since boot, as
+	// reported in /proc/PID/stat.
+	StartTime uint64 `json:"start_time"`
+}
+
+// Register records that the process pid is a helper of the kind given. It
+// must be called while the helper is still running.
+func Register(dir, kind string, pid int) error {
+	startTime, _, err := stat(pid)
+	if err != nil {
+		return fmt.Errorf("failed to register %s helper %d: %s", kind, pid, err)
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(Helper{Pid: pid, Kind: kind, StartTime: startTime})
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(entry(dir, pid), data, 0600)
+}
+
+// Start runs bpm again with args as a helper of the kind given, in its own
+// session so that it outlives the bpm command which started it, and records
+// it in the registry.
+func Start(dir, kind string, args ...string) error {
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command(executable, args...)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start %s helper: %s", kind, err)
+	}
+
+	if err := Register(dir, kind, cmd.Process.Pid); err != nil {
+		// A helper which could not be recorded would never be stopped.
+		cmd.Process.Kill()
+		cmd.Wait()
+		return err
+	}
+
+	return cmd.Process.Release()
+}
+
+// List returns the helpers in the registry which are still running.
+func List(dir string) ([]Helper, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var running []Helper
+	for _, info := range infos {
+		if filepath.Ext(info.Name()) != ".json" {
+			continue
+		}
+
+		data, err := ioutil.ReadFile(filepath.Join(dir, info.Name()))
+		if err != nil {
+			continue
+		}
+
+		var h Helper
+		if err := json.Unmarshal(data, &h); err != nil {
+			continue
+		}
+
+		if h.Running() {
+			running = append(running, h)
+		}
+	}
+
+	return running, nil
+}
+
+// Running reports whether the helper is still running. A process which has
+// been given the helper's pid since it exited does not count.
+func (h Helper) Running() bool {
+	startTime, state, err := stat(h.Pid)
+	return err == nil && startTime == h.StartTime && state != "Z"
+}
+
+// Stop waits up to grace for the helpers in the registry to exit by
+// themselves, which relays do once the process they copy the output of has
+// gone, so that they can finish their work. Any which are left are sent
+// SIGTERM and then, after TermGrace, SIGKILL. The whole session of each
+// helper is signalled so that the commands it runs are stopped as well. The
+// registry is removed once they have all exited.
+func Stop(dir string, grace time.Duration) error {
+	running, err := List(dir)
+	if err != nil {
+		return err
+	}
+
+	if err := stop(running, grace); err != nil {
+		return err
+	}
+
+	return os.RemoveAll(dir)
+}
+
+// StopKind stops the helpers of one kind in the registry in the same way as
+// Stop, leaving the others running.
+func StopKind(dir, kind string, grace time.Duration) error {
+	running, err := List(dir)
+	if err != nil {
+		return err
+	}
+
+	var matching []Helper
+	for _, h := range running {
+		if h.Kind == kind {
+			matching = append(matching, h)
+		}
+	}
+
+	if err := stop(matching, grace); err != nil {
+		return err
+	}
+
+	for _, h := range matching {
+		if err := os.Remove(entry(dir, h.Pid)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func stop(running []Helper, grace time.Duration) error {
+	running = waitForExit(running, grace)
+	if len(running) > 0 {
+		signal(running, syscall.SIGTERM)
+		running = waitForExit(running, TermGrace)
+	}
+	if len(running) > 0 {
+		signal(running, syscall.SIGKILL)
+		running = waitForExit(running, TermGrace)
+	}
+
+	if len(running) > 0 {
+		return fmt.Errorf("%s helper %d did not exit after being killed", running[0].Kind, running[0].Pid)
+	}
+
+	return nil
+}
+
+func waitForExit(helpers []Helper, timeout time.Duration) []Helper {
+	deadline := time.Now().Add(timeout)
+	for {
+		var running []Helper
+		for _, h := range helpers {
+			if h.Running() {
+				running = append(running, h)
+			}
+		}
+
+		if len(running) == 0 || !time.Now().Before(deadline) {
+			return running
+		}
+
+		helpers = running
+		time.Sleep(pollInterval)
+	}
+}
+
+func signal(helpers []Helper, sig syscall.Signal) {
+	for _, h := range helpers {
+		pid := h.Pid
+		if pgid, err := syscall.Getpgid(h.Pid); err == nil && pgid == h.Pid {
+			pid = -pid
+		}
+
+		syscall.Kill(pid, sig)
+	}
+}
+
+func entry(dir string, pid int) string {
+	return filepath.Join(dir, fmt.Sprintf("%d.json", pid))
+}
+
+// stat returns the start time and state of a process from /proc/PID/stat.
+func stat(pid int) (uint64, string, error) {
+	data, err := ioutil.ReadFile(filepath.Join(procRoot, strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return 0, "", err
+	}
+
+	// The command name is in parentheses and may contain spaces, so the
+	// fields are counted from the last closing parenthesis.
+	s := string(data)
+	end := strings.LastIndex(s, ")")
+	if end == -1 {
+		return 0, "", fmt.Errorf("unexpected contents of /proc/%d/stat", pid)
+	}
+
+	// The state is the third field of the file and the start time the 22nd.
+	fields := strings.Fields(s[end+1:])
+	if len(fields) < 20 {
+		return 0, "", fmt.Errorf("unexpected contents of /proc/%d/stat", pid)
+	}
+
+	startTime, err := strconv.ParseUint(fields[19], 10, 64)
+	if err != nil {
+		return 0, "", err
+	}
+
+	return startTime, fields[0], nil
+}
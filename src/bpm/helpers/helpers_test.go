@@ -0,0 +1,154 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package helpers_test
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"bpm/helpers"
+)
+
+// exited reports whether the process has gone or is a zombie waiting to be
+// reaped by whichever process inherited it.
+func exited(pid int) bool {
+	data, err := ioutil.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return true
+	}
+	fields := strings.Fields(string(data[strings.LastIndexByte(string(data), ')')+1:]))
+	return fields[0] == "Z"
+}
+
+var _ = Describe("Helpers", func() {
+	var (
+		dir     string
+		started []*exec.Cmd
+	)
+
+	// start runs a shell script as a helper in its own session, as bpm starts
+	// them. The helpers are reaped in the background so that those which
+	// have exited do not linger as zombies.
+	start := func(script string) int {
+		cmd := exec.Command("/bin/sh", "-c", script)
+		cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+		Expect(cmd.Start()).To(Succeed())
+		go cmd.Wait()
+
+		started = append(started, cmd)
+		return cmd.Process.Pid
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "helpers")
+		Expect(err).NotTo(HaveOccurred())
+		dir = filepath.Join(dir, "server.helpers")
+		started = nil
+	})
+
+	AfterEach(func() {
+		for _, cmd := range started {
+			syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		}
+		Expect(os.RemoveAll(filepath.Dir(dir))).To(Succeed())
+	})
+
+	It("lists the registered helpers which are running", func() {
+		pid := start("sleep 30")
+		Expect(helpers.Register(dir, "log-relay", pid)).To(Succeed())
+
+		running, err := helpers.List(dir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(running).To(HaveLen(1))
+		Expect(running[0].Pid).To(Equal(pid))
+		Expect(running[0].Kind).To(Equal("log-relay"))
+
+		Expect(syscall.Kill(pid, syscall.SIGKILL)).To(Succeed())
+		Eventually(func() ([]helpers.Helper, error) { return helpers.List(dir) }).Should(BeEmpty())
+	})
+
+	It("does not consider a process which has reused the pid of a helper", func() {
+		pid := start("sleep 30")
+		Expect(helpers.Register(dir, "log-relay", pid)).To(Succeed())
+
+		entry := filepath.Join(dir, strconv.Itoa(pid)+".json")
+		data, err := ioutil.ReadFile(entry)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ioutil.WriteFile(entry, []byte(strings.Replace(string(data), `"start_time":`, `"start_time":1`, 1)), 0600)).To(Succeed())
+
+		Expect(helpers.List(dir)).To(BeEmpty())
+		Expect(helpers.Stop(dir, 0)).To(Succeed())
+		Expect(syscall.Kill(pid, 0)).To(Succeed())
+	})
+
+	It("waits for helpers which exit by themselves", func() {
+		Expect(helpers.Register(dir, "log-relay", start("sleep 0.2"))).To(Succeed())
+
+		Expect(helpers.Stop(dir, 5*time.Second)).To(Succeed())
+		Expect(dir).NotTo(BeADirectory())
+	})
+
+	It("stops the whole session of helpers which keep running", func() {
+		pidFile := filepath.Join(filepath.Dir(dir), "child.pid")
+		pid := start("sleep 30 & echo $! > " + pidFile + "; wait")
+		Expect(helpers.Register(dir, "log-relay", pid)).To(Succeed())
+		Eventually(pidFile).Should(BeAnExistingFile())
+
+		Expect(helpers.Stop(dir, 0)).To(Succeed())
+		Expect(dir).NotTo(BeADirectory())
+
+		data, err := ioutil.ReadFile(pidFile)
+		Expect(err).NotTo(HaveOccurred())
+		child, err := strconv.Atoi(strings.TrimSpace(string(data)))
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(func() bool { return exited(child) }).Should(BeTrue())
+	})
+
+	It("kills helpers which ignore SIGTERM", func() {
+		Expect(helpers.Register(dir, "pipe", start(`trap "" TERM; while true; do sleep 0.1; done`))).To(Succeed())
+
+		Expect(helpers.Stop(dir, 0)).To(Succeed())
+		Expect(helpers.List(dir)).To(BeEmpty())
+	})
+
+	It("stops only the helpers of the kind given", func() {
+		relay := start("sleep 30")
+		Expect(helpers.Register(dir, "log-relay", relay)).To(Succeed())
+		Expect(helpers.Register(dir, "register", start("sleep 30"))).To(Succeed())
+
+		Expect(helpers.StopKind(dir, "register", 0)).To(Succeed())
+
+		running, err := helpers.List(dir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(running).To(HaveLen(1))
+		Expect(running[0].Pid).To(Equal(relay))
+		Expect(filepath.Join(dir, strconv.Itoa(relay)+".json")).To(BeAnExistingFile())
+	})
+
+	It("does nothing when no helpers have been registered", func() {
+		Expect(helpers.Stop(dir, time.Second)).To(Succeed())
+	})
+})
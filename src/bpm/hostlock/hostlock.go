@@ -21,13 +21,26 @@ package hostlock
 
 import (
 	"crypto/sha256"
+	"encoding/json"
 	"fmt"
+	"os"
 	"path/filepath"
+	"time"
 
 	"bpm/flock"
 	"bpm/jobid"
 )
 
+const (
+	// PollInterval is how often a lock which is held by something else is
+	// tried again when waiting for it with a timeout.
+	PollInterval = 100 * time.Millisecond
+
+	// ReportInterval is how often Waiting is called while waiting for a
+	// lock.
+	ReportInterval = 10 * time.Second
+)
+
 // LockedLock represents a lock which has been acquired.
 type LockedLock interface {
 	// Unlock can be used to unlock and release the lock to let another
@@ -35,10 +48,57 @@ type LockedLock interface {
 	Unlock() error
 }
 
+// Owner describes whatever holds a lock. It is recorded in the lock file
+// when the lock is acquired.
+type Owner struct {
+	Pid       int       `json:"pid"`
+	Operation string    `json:"operation"`
+	Since     time.Time `json:"since"`
+}
+
+func (o *Owner) String() string {
+	if o == nil {
+		return "an unknown process"
+	}
+
+	description := fmt.Sprintf("pid %d", o.Pid)
+	if o.Operation != "" {
+		description += fmt.Sprintf(" (%s)", o.Operation)
+	}
+	if !o.Since.IsZero() {
+		description += fmt.Sprintf(" for %s", time.Since(o.Since).Round(time.Second))
+	}
+
+	return description
+}
+
+// TimeoutError is returned when a lock could not be acquired in time.
+type TimeoutError struct {
+	Name  string
+	Owner *Owner
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("timed out waiting for the lock on %s held by %s", e.Name, e.Owner)
+}
+
 // Handle represents a namespace of locks which is identified by a particular
 // filesystem path.
 type Handle struct {
 	path string
+
+	// Operation is recorded as what the holder of each lock taken through
+	// the handle is doing.
+	Operation string
+
+	// Timeout is how long to wait for a lock before giving up. Locks are
+	// waited for indefinitely if it is zero.
+	Timeout time.Duration
+
+	// Waiting, if set, is called with the name and owner of a lock when it
+	// turns out to be held by something else and then every ReportInterval
+	// until it is acquired. The owner is nil if it is not known.
+	Waiting func(name string, owner *Owner)
 }
 
 // NewHandle creates a new Handle from a filesystem path. The path must already
@@ -55,16 +115,7 @@ func NewHandle(path string) *Handle {
 func (h *Handle) LockJob(job, process string) (LockedLock, error) {
 	name := jobid.Encode(fmt.Sprintf("%s.%s", job, process))
 	path := filepath.Join(h.path, fmt.Sprintf("job-%s.lock", name))
-	fl, err := flock.New(path)
-	if err != nil {
-		return nil, err
-	}
-
-	if err := fl.Lock(); err != nil {
-		return nil, err
-	}
-
-	return fl, nil
+	return h.lock(path, fmt.Sprintf("%s/%s", job, process))
 }
 
 // LockVolume places an exclusive advisory lock on a particular BPM volume. The
@@ -76,14 +127,169 @@ func (h *Handle) LockVolume(path string) (LockedLock, error) {
 
 	name := fmt.Sprintf("vol-%x.lock", hash.Sum(nil))
 	fullPath := filepath.Join(h.path, name)
-	fl, err := flock.New(fullPath)
+	return h.lock(fullPath, path)
+}
+
+// LockFile places an exclusive advisory lock on a file outside of the handle's
+// namespace, such as the lock file of a shared volume, which other programs
+// may also lock. The file is created if it does not exist.
+func (h *Handle) LockFile(path string) (LockedLock, error) {
+	return h.lock(path, path)
+}
+
+// lock acquires the lock at path, reporting its owner while it waits. Without
+// a timeout it blocks in the kernel, which hands the lock to waiters in turn.
+// With one the lock is polled for until the timeout expires.
+func (h *Handle) lock(path, name string) (LockedLock, error) {
+	fl, err := flock.New(path)
+	if err != nil {
+		return nil, err
+	}
+
+	acquired, err := fl.TryLock()
+	if err != nil {
+		return nil, err
+	}
+
+	if acquired {
+		return h.record(fl)
+	}
+
+	if h.Timeout == 0 {
+		stop := h.reportWaiting(path, name)
+		err := fl.Lock()
+		stop()
+		if err != nil {
+			return nil, err
+		}
+
+		return h.record(fl)
+	}
+
+	deadline := time.Now().Add(h.Timeout)
+	var nextReport time.Time
+	for {
+		owner, err := currentOwner(path)
+		if err != nil {
+			return nil, err
+		}
+
+		now := time.Now()
+		if now.After(deadline) {
+			return nil, &TimeoutError{Name: name, Owner: owner}
+		}
+
+		if h.Waiting != nil && !now.Before(nextReport) {
+			h.Waiting(name, owner)
+			nextReport = now.Add(ReportInterval)
+		}
+
+		time.Sleep(PollInterval)
+
+		acquired, err := fl.TryLock()
+		if err != nil {
+			return nil, err
+		}
+
+		if acquired {
+			return h.record(fl)
+		}
+	}
+}
+
+// reportWaiting calls Waiting with the owner of the lock at path straight
+// away and then every ReportInterval until the function it returns is
+// called.
+func (h *Handle) reportWaiting(path, name string) func() {
+	if h.Waiting == nil {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+
+		ticker := time.NewTicker(ReportInterval)
+		defer ticker.Stop()
+
+		for {
+			if owner, err := currentOwner(path); err == nil {
+				h.Waiting(name, owner)
+			}
+
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-finished
+	}
+}
+
+func (h *Handle) record(fl *flock.Flock) (LockedLock, error) {
+	owner, err := json.Marshal(Owner{
+		Pid:       os.Getpid(),
+		Operation: h.Operation,
+		Since:     time.Now(),
+	})
+	if err == nil {
+		err = fl.SetContents(owner)
+	}
+
 	if err != nil {
+		fl.Unlock()
 		return nil, err
 	}
 
-	if err := fl.Lock(); err != nil {
+	return &ownedLock{fl}, nil
+}
+
+// ownedLock forgets its owner when it is unlocked so that nobody waiting for
+// it is told about a holder which has already moved on.
+type ownedLock struct {
+	*flock.Flock
+}
+
+func (l *ownedLock) Unlock() error {
+	if err := l.SetContents(nil); err != nil {
+		l.Flock.Unlock()
+		return err
+	}
+
+	return l.Flock.Unlock()
+}
+
+// currentOwner returns the owner of the lock at path according to the
+// kernel. What the owner is doing is only known if the owner recorded it.
+func currentOwner(path string) (*Owner, error) {
+	pid, err := flock.Holder(path)
+	if err != nil || pid == 0 {
 		return nil, err
 	}
 
-	return fl, nil
+	if recorded := readOwner(path); recorded != nil && recorded.Pid == pid {
+		return recorded, nil
+	}
+
+	return &Owner{Pid: pid}, nil
+}
+
+func readOwner(path string) *Owner {
+	data, err := flock.Contents(path)
+	if err != nil || len(data) == 0 {
+		return nil
+	}
+
+	var owner Owner
+	if err := json.Unmarshal(data, &owner); err != nil {
+		return nil
+	}
+
+	return &owner
 }
@@ -18,6 +18,8 @@ package hostlock_test
 import (
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"time"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -94,6 +96,92 @@ var _ = Describe("Hostlock", func() {
 		})
 	}
 
+	It("allows the same lock to be held in two namespaces at once", func() {
+		otherdir, err := ioutil.TempDir("", "hostlock_test")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(otherdir)
+
+		held, err := hostlock.NewHandle(tmpdir).LockJob("job", "process")
+		Expect(err).NotTo(HaveOccurred())
+		defer held.Unlock()
+
+		c := make(chan struct{})
+
+		go func() {
+			otherHeld, err := hostlock.NewHandle(otherdir).LockJob("job", "process")
+			Expect(err).NotTo(HaveOccurred())
+
+			close(c)
+
+			err = otherHeld.Unlock()
+			Expect(err).NotTo(HaveOccurred())
+		}()
+
+		Eventually(c).Should(BeClosed())
+	})
+
+	Describe("waiting for a lock", func() {
+		var (
+			locks *hostlock.Handle
+			held  hostlock.LockedLock
+		)
+
+		BeforeEach(func() {
+			holder := hostlock.NewHandle(tmpdir)
+			holder.Operation = "bpm start"
+
+			var err error
+			held, err = holder.LockJob("job", "process")
+			Expect(err).NotTo(HaveOccurred())
+
+			locks = hostlock.NewHandle(tmpdir)
+		})
+
+		AfterEach(func() {
+			held.Unlock()
+		})
+
+		It("reports who holds the lock", func() {
+			owners := make(chan *hostlock.Owner, 1)
+			locks.Waiting = func(name string, owner *hostlock.Owner) {
+				Expect(name).To(Equal("job/process"))
+				select {
+				case owners <- owner:
+				default:
+				}
+			}
+
+			acquired := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+
+				lock, err := locks.LockJob("job", "process")
+				Expect(err).NotTo(HaveOccurred())
+				close(acquired)
+				Expect(lock.Unlock()).To(Succeed())
+			}()
+
+			var owner *hostlock.Owner
+			Eventually(owners).Should(Receive(&owner))
+			Expect(owner.Pid).To(Equal(os.Getpid()))
+			Expect(owner.Operation).To(Equal("bpm start"))
+			Expect(owner.String()).To(HavePrefix("pid"))
+			Consistently(acquired).ShouldNot(BeClosed())
+
+			Expect(held.Unlock()).To(Succeed())
+			Eventually(acquired).Should(BeClosed())
+			held, _ = locks.LockJob("job", "process")
+		})
+
+		It("gives up after the timeout", func() {
+			locks.Timeout = 300 * time.Millisecond
+
+			_, err := locks.LockJob("job", "process")
+			Expect(err).To(BeAssignableToTypeOf(&hostlock.TimeoutError{}))
+			Expect(err.Error()).To(ContainSubstring("job/process held by pid"))
+		})
+	})
+
 	Describe("locking jobs", func() {
 		ItLocksCorrectly(func(locks *hostlock.Handle) (hostlock.LockedLock, error) {
 			return locks.LockJob("job", "process")
@@ -102,6 +190,14 @@ var _ = Describe("Hostlock", func() {
 		})
 	})
 
+	Describe("locking files", func() {
+		ItLocksCorrectly(func(locks *hostlock.Handle) (hostlock.LockedLock, error) {
+			return locks.LockFile(filepath.Join(tmpdir, "volume1.lock"))
+		}, func(locks *hostlock.Handle) (hostlock.LockedLock, error) {
+			return locks.LockFile(filepath.Join(tmpdir, "volume2.lock"))
+		})
+	})
+
 	Describe("locking volumes", func() {
 		ItLocksCorrectly(func(locks *hostlock.Handle) (hostlock.LockedLock, error) {
 			return locks.LockVolume("/var/vcap/data/volume1")
@@ -0,0 +1,136 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package integration_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/onsi/gomega/gexec"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	uuid "github.com/satori/go.uuid"
+
+	"bpm/config"
+	"bpm/jobid"
+)
+
+var _ = Describe("backup", func() {
+	var (
+		cfg config.JobConfig
+
+		boshRoot    string
+		containerID string
+		job         string
+		runcRoot    string
+		record      string
+	)
+
+	// writeHook writes a hook script which appends its name to the record.
+	writeHook := func(name string) string {
+		path := filepath.Join(boshRoot, "jobs", job, "bin", name)
+		Expect(os.MkdirAll(filepath.Dir(path), 0755)).To(Succeed())
+		Expect(ioutil.WriteFile(path, []byte(fmt.Sprintf("#!/bin/bash\necho %s >> %s\n", name, record)), 0755)).To(Succeed())
+		return path
+	}
+
+	BeforeEach(func() {
+		var err error
+
+		job = uuid.NewV4().String()
+		containerID = jobid.Encode(job)
+		boshRoot, err = ioutil.TempDir(bpmTmpDir, "backup-test")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(os.Chmod(boshRoot, 0755)).To(Succeed())
+		runcRoot = setupBoshDirectories(boshRoot, job)
+		record = filepath.Join(boshRoot, "record")
+
+		logFile := filepath.Join(boshRoot, "sys", "log", job, "foo.log")
+		cfg = newJobConfig(job, defaultBash(logFile))
+		cfg.Processes[0].Hooks = &config.Hooks{
+			PreBackup:  writeHook("pre-backup"),
+			PostBackup: writeHook("post-backup"),
+		}
+		writeConfig(boshRoot, job, cfg)
+	})
+
+	AfterEach(func() {
+		err := runcCommand(runcRoot, "delete", "--force", containerID).Run()
+		if err != nil {
+			fmt.Fprintf(GinkgoWriter, "WARNING: Failed to cleanup container: %s\n", err.Error())
+		}
+		Expect(os.RemoveAll(boshRoot)).To(Succeed())
+	})
+
+	backupCommand := func(args ...string) *exec.Cmd {
+		command := exec.Command(bpmPath, append([]string{"backup"}, args...)...)
+		command.Env = append(command.Env, fmt.Sprintf("BPM_BOSH_ROOT=%s", boshRoot), "PATH="+os.Getenv("PATH"))
+		return command
+	}
+
+	It("runs the command between the hooks while the process is paused", func() {
+		startJob(boshRoot, bpmPath, job)
+
+		state := fmt.Sprintf("runc --root %s state %s | grep -o '\"status\": \"[a-z]*\"' >> %s", runcRoot, containerID, record)
+		session, err := gexec.Start(backupCommand(job, "--", "/bin/bash", "-c", state), GinkgoWriter, GinkgoWriter)
+		Expect(err).ShouldNot(HaveOccurred())
+		<-session.Exited
+
+		Expect(session).To(gexec.Exit(0))
+		Expect(ioutil.ReadFile(record)).To(Equal([]byte("pre-backup\n\"status\": \"paused\"\npost-backup\n")))
+		Expect(runcState(runcRoot, containerID).Status).To(Equal(specs.StateRunning))
+	})
+
+	It("resumes the process and exits with the exit status of a failed command", func() {
+		startJob(boshRoot, bpmPath, job)
+
+		session, err := gexec.Start(backupCommand(job, "--", "/bin/bash", "-c", "exit 3"), GinkgoWriter, GinkgoWriter)
+		Expect(err).ShouldNot(HaveOccurred())
+		<-session.Exited
+
+		Expect(session).To(gexec.Exit(3))
+		Expect(ioutil.ReadFile(record)).To(Equal([]byte("pre-backup\npost-backup\n")))
+		Expect(runcState(runcRoot, containerID).Status).To(Equal(specs.StateRunning))
+	})
+
+	Context("when the process is not running", func() {
+		It("runs the command without the hooks", func() {
+			session, err := gexec.Start(backupCommand(job, "--", "/bin/true"), GinkgoWriter, GinkgoWriter)
+			Expect(err).ShouldNot(HaveOccurred())
+			<-session.Exited
+
+			Expect(session).To(gexec.Exit(0))
+			Expect(session.Err).Should(gbytes.Say("is not running and is backed up as it is"))
+			Expect(record).NotTo(BeAnExistingFile())
+		})
+	})
+
+	Context("when no command is specified", func() {
+		It("exits with a non-zero exit code", func() {
+			session, err := gexec.Start(backupCommand(job), GinkgoWriter, GinkgoWriter)
+			Expect(err).ShouldNot(HaveOccurred())
+			<-session.Exited
+
+			Expect(session).To(gexec.Exit(1))
+			Expect(session.Err).Should(gbytes.Say("must specify a backup command after --"))
+		})
+	})
+})
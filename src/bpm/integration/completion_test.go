@@ -0,0 +1,94 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package integration_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gexec"
+)
+
+var _ = Describe("completion", func() {
+	var boshRoot string
+
+	bpm := func(args ...string) *gexec.Session {
+		command := exec.Command(bpmPath, args...)
+		command.Env = append(command.Env, fmt.Sprintf("BPM_BOSH_ROOT=%s", boshRoot))
+		session, err := gexec.Start(command, GinkgoWriter, GinkgoWriter)
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(session).Should(gexec.Exit())
+		return session
+	}
+
+	BeforeEach(func() {
+		var err error
+		boshRoot, err = ioutil.TempDir(bpmTmpDir, "completion-test")
+		Expect(err).NotTo(HaveOccurred())
+
+		jobConfig := filepath.Join(boshRoot, "jobs", "web", "config", "bpm.yml")
+		Expect(os.MkdirAll(filepath.Dir(jobConfig), 0755)).To(Succeed())
+		Expect(ioutil.WriteFile(jobConfig, []byte("processes:\n- name: server\n  executable: /bin/sleep\n- name: worker\n  executable: /bin/sleep\n"), 0644)).To(Succeed())
+		Expect(os.MkdirAll(filepath.Join(boshRoot, "jobs", "unmanaged"), 0755)).To(Succeed())
+
+		pidDir := filepath.Join(boshRoot, "sys", "run", "bpm", "web")
+		Expect(os.MkdirAll(pidDir, 0755)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(pidDir, "worker.pid"), []byte(strconv.Itoa(os.Getpid())), 0644)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(boshRoot)).To(Succeed())
+	})
+
+	It("lists the jobs which bpm manages and their processes", func() {
+		session := bpm("__complete", "jobs")
+		Expect(session).To(gexec.Exit(0))
+		Expect(string(session.Out.Contents())).To(Equal("web\n"))
+
+		session = bpm("__complete", "processes", "web")
+		Expect(session).To(gexec.Exit(0))
+		Expect(string(session.Out.Contents())).To(Equal("server\nworker\n"))
+	})
+
+	It("lists only running processes when asked", func() {
+		session := bpm("__complete", "processes", "--running", "web")
+		Expect(session).To(gexec.Exit(0))
+		Expect(string(session.Out.Contents())).To(Equal("worker\n"))
+	})
+
+	It("does not take any locks", func() {
+		Expect(bpm("__complete", "jobs")).To(gexec.Exit(0))
+		Expect(filepath.Join(boshRoot, "data", "bpm", "locks")).NotTo(BeADirectory())
+	})
+
+	It("prints nothing for a job which does not exist", func() {
+		session := bpm("__complete", "processes", "missing")
+		Expect(session).To(gexec.Exit(0))
+		Expect(session.Out.Contents()).To(BeEmpty())
+	})
+
+	It("generates a bash completion script which uses it", func() {
+		session := bpm("completion", "bash")
+		Expect(session).To(gexec.Exit(0))
+		Expect(string(session.Out.Contents())).To(ContainSubstring("bpm __complete jobs"))
+	})
+})
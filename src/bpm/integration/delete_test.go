@@ -0,0 +1,119 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package integration_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/onsi/gomega/gexec"
+	uuid "github.com/satori/go.uuid"
+
+	"bpm/jobid"
+)
+
+var _ = Describe("delete", func() {
+	var (
+		boshRoot    string
+		bpmLog      string
+		bundlePath  string
+		containerID string
+		job         string
+		runcRoot    string
+	)
+
+	bpm := func(args ...string) *gexec.Session {
+		command := exec.Command(bpmPath, args...)
+		command.Env = append(command.Env, fmt.Sprintf("BPM_BOSH_ROOT=%s", boshRoot))
+		session, err := gexec.Start(command, GinkgoWriter, GinkgoWriter)
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(session).Should(gexec.Exit())
+		return session
+	}
+
+	BeforeEach(func() {
+		var err error
+
+		job = uuid.NewV4().String()
+		containerID = jobid.Encode(job)
+		boshRoot, err = ioutil.TempDir(bpmTmpDir, "delete-test")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(os.Chmod(boshRoot, 0755)).To(Succeed())
+		runcRoot = setupBoshDirectories(boshRoot, job)
+
+		bpmLog = filepath.Join(boshRoot, "sys", "log", job, "bpm.log")
+		bundlePath = filepath.Join(boshRoot, "data", "bpm", "bundles", job, job)
+
+		logFile := filepath.Join(boshRoot, "sys", "log", job, "foo.log")
+		writeConfig(boshRoot, job, newJobConfig(job, defaultBash(logFile)))
+
+		Expect(bpm("start", job)).To(gexec.Exit(0))
+	})
+
+	AfterEach(func() {
+		err := runcCommand(runcRoot, "delete", "--force", containerID).Run()
+		if err != nil {
+			fmt.Fprintf(GinkgoWriter, "WARNING: Failed to cleanup container: %s\n", err.Error())
+		}
+		Expect(os.RemoveAll(boshRoot)).To(Succeed())
+	})
+
+	It("refuses to delete a running process", func() {
+		session := bpm("delete", job)
+		Expect(session).To(gexec.Exit(1))
+		Expect(session.Err).To(gbytes.Say("process is still running"))
+
+		Expect(runcCommand(runcRoot, "state", containerID).Run()).To(Succeed())
+	})
+
+	It("kills and deletes a running process when forced", func() {
+		Expect(bpm("delete", job, "--force")).To(gexec.Exit(0))
+
+		Expect(runcCommand(runcRoot, "state", containerID).Run()).To(HaveOccurred())
+		Expect(bundlePath).NotTo(BeAnExistingFile())
+		Expect(fileContents(bpmLog)()).To(ContainSubstring("killing-running-process"))
+	})
+
+	Context("when the container was preserved", func() {
+		BeforeEach(func() {
+			Expect(bpm("stop", job, "--no-delete")).To(gexec.Exit(0))
+		})
+
+		It("deletes the container and its bundle", func() {
+			Expect(bpm("delete", job)).To(gexec.Exit(0))
+
+			Expect(runcCommand(runcRoot, "state", containerID).Run()).To(HaveOccurred())
+			Expect(bundlePath).NotTo(BeAnExistingFile())
+		})
+	})
+
+	Context("when the container has already been deleted", func() {
+		BeforeEach(func() {
+			Expect(bpm("stop", job)).To(gexec.Exit(0))
+		})
+
+		It("is successful", func() {
+			Expect(bpm("delete", job)).To(gexec.Exit(0))
+			Expect(fileContents(bpmLog)()).To(ContainSubstring("job-already-deleted"))
+		})
+	})
+})
@@ -0,0 +1,89 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package integration_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/onsi/gomega/gexec"
+)
+
+var _ = Describe("doctor", func() {
+	var boshRoot string
+
+	bpm := func(args ...string) *gexec.Session {
+		command := exec.Command(bpmPath, args...)
+		command.Env = append(command.Env, fmt.Sprintf("BPM_BOSH_ROOT=%s", boshRoot))
+		session, err := gexec.Start(command, GinkgoWriter, GinkgoWriter)
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(session).Should(gexec.Exit())
+		return session
+	}
+
+	BeforeEach(func() {
+		var err error
+		boshRoot, err = ioutil.TempDir(bpmTmpDir, "doctor-test")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(boshRoot)).To(Succeed())
+	})
+
+	It("checks the state directories without creating them", func() {
+		session := bpm("doctor")
+		Expect(session).To(gexec.Exit(0))
+		Expect(session.Out).To(gbytes.Say(`locks\s+%s\s+ok`, filepath.Join(boshRoot, "data", "bpm", "locks")))
+
+		Expect(filepath.Join(boshRoot, "data")).NotTo(BeADirectory())
+	})
+
+	It("reports the kernel features of a nested host without failing", func() {
+		session := bpm("doctor", "--nested")
+		Expect(session).To(gexec.Exit(0))
+		Expect(session.Out).To(gbytes.Say(`locks\s+%s\s+ok`, filepath.Join(boshRoot, "data", "bpm", "locks")))
+		Expect(session.Out).To(gbytes.Say(`memory controller`))
+	})
+
+	Context("when the state has been moved", func() {
+		var stateDir string
+
+		BeforeEach(func() {
+			stateDir = filepath.Join(boshRoot, "writable")
+
+			hostConfig := filepath.Join(boshRoot, "jobs", "bpm", "config", "host.yml")
+			Expect(os.MkdirAll(filepath.Dir(hostConfig), 0755)).To(Succeed())
+			Expect(ioutil.WriteFile(hostConfig, []byte(fmt.Sprintf("state:\n  data_dir: %s\n", stateDir)), 0644)).To(Succeed())
+		})
+
+		It("checks and uses the new location", func() {
+			session := bpm("doctor")
+			Expect(session).To(gexec.Exit(0))
+			Expect(session.Out).To(gbytes.Say(`locks\s+%s\s+ok`, filepath.Join(stateDir, "locks")))
+
+			Expect(bpm("list")).To(gexec.Exit(0))
+			Expect(filepath.Join(stateDir, "locks")).To(BeADirectory())
+			Expect(filepath.Join(boshRoot, "data", "bpm")).NotTo(BeADirectory())
+		})
+	})
+})
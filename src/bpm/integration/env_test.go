@@ -0,0 +1,123 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package integration_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/onsi/gomega/gexec"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	uuid "github.com/satori/go.uuid"
+
+	"bpm/config"
+	"bpm/jobid"
+)
+
+var _ = Describe("env", func() {
+	var (
+		command *exec.Cmd
+
+		cfg config.JobConfig
+
+		boshRoot    string
+		containerID string
+		job         string
+		runcRoot    string
+	)
+
+	BeforeEach(func() {
+		var err error
+
+		job = uuid.NewV4().String()
+		containerID = jobid.Encode(job)
+		boshRoot, err = ioutil.TempDir(bpmTmpDir, "env-test")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(os.Chmod(boshRoot, 0755)).To(Succeed())
+		runcRoot = setupBoshDirectories(boshRoot, job)
+
+		secretPath := filepath.Join(boshRoot, "data", job, "secret")
+		Expect(ioutil.WriteFile(secretPath, []byte("hunter2\n"), 0600)).To(Succeed())
+
+		logFile := filepath.Join(boshRoot, "sys", "log", job, "foo.log")
+		cfg = newJobConfig(job, defaultBash(logFile))
+		cfg.Processes[0].Env = map[string]string{"FOO": "bar"}
+		cfg.Processes[0].EnvFromFiles = map[string]string{"PASSWORD": secretPath}
+		writeConfig(boshRoot, job, cfg)
+	})
+
+	JustBeforeEach(func() {
+		command = exec.Command(bpmPath, "env", job)
+		command.Env = append(command.Env, fmt.Sprintf("BPM_BOSH_ROOT=%s", boshRoot))
+	})
+
+	AfterEach(func() {
+		err := runcCommand(runcRoot, "delete", "--force", containerID).Run()
+		if err != nil {
+			fmt.Fprintf(GinkgoWriter, "WARNING: Failed to cleanup container: %s\n", err.Error())
+		}
+		Expect(os.RemoveAll(boshRoot)).To(Succeed())
+	})
+
+	It("displays the environment with secrets redacted", func() {
+		startJob(boshRoot, bpmPath, job)
+		Eventually(func() specs.ContainerState { return runcState(runcRoot, containerID).Status }).Should(Equal(specs.StateRunning))
+
+		session, err := gexec.Start(command, GinkgoWriter, GinkgoWriter)
+		Expect(err).ShouldNot(HaveOccurred())
+		<-session.Exited
+		Expect(session).To(gexec.Exit(0))
+
+		Expect(session.Out).Should(gbytes.Say("FOO=bar"))
+		Expect(session.Out).Should(gbytes.Say(`PASSWORD=\[REDACTED\]`))
+		Expect(session.Out.Contents()).NotTo(ContainSubstring("hunter2"))
+	})
+
+	Context("when secrets are requested", func() {
+		JustBeforeEach(func() {
+			command.Args = append(command.Args, "--show-secrets")
+		})
+
+		It("displays the values read from files", func() {
+			startJob(boshRoot, bpmPath, job)
+			Eventually(func() specs.ContainerState { return runcState(runcRoot, containerID).Status }).Should(Equal(specs.StateRunning))
+
+			session, err := gexec.Start(command, GinkgoWriter, GinkgoWriter)
+			Expect(err).ShouldNot(HaveOccurred())
+			<-session.Exited
+			Expect(session).To(gexec.Exit(0))
+
+			Expect(session.Out).Should(gbytes.Say("PASSWORD=hunter2"))
+		})
+	})
+
+	Context("when the container does not exist", func() {
+		It("returns an error", func() {
+			session, err := gexec.Start(command, GinkgoWriter, GinkgoWriter)
+			Expect(err).ShouldNot(HaveOccurred())
+
+			<-session.Exited
+			Expect(session).To(gexec.Exit(1))
+			Expect(session.Err).Should(gbytes.Say("Error: process is not running or could not be found"))
+		})
+	})
+})
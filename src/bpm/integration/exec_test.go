@@ -0,0 +1,130 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package integration_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/onsi/gomega/gexec"
+	uuid "github.com/satori/go.uuid"
+
+	"bpm/config"
+	"bpm/jobid"
+)
+
+var _ = Describe("exec", func() {
+	var (
+		cfg config.JobConfig
+
+		boshRoot    string
+		containerID string
+		job         string
+		runcRoot    string
+	)
+
+	BeforeEach(func() {
+		var err error
+
+		job = uuid.NewV4().String()
+		containerID = jobid.Encode(job)
+		boshRoot, err = ioutil.TempDir(bpmTmpDir, "exec-test")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(os.Chmod(boshRoot, 0755)).To(Succeed())
+		runcRoot = setupBoshDirectories(boshRoot, job)
+
+		logFile := filepath.Join(boshRoot, "sys", "log", job, "foo.log")
+		cfg = newJobConfig(job, defaultBash(logFile))
+		cfg.Processes[0].Env = map[string]string{"EXEC_TEST_VAR": "inherited-value"}
+		writeConfig(boshRoot, job, cfg)
+	})
+
+	AfterEach(func() {
+		err := runcCommand(runcRoot, "delete", "--force", containerID).Run()
+		if err != nil {
+			fmt.Fprintf(GinkgoWriter, "WARNING: Failed to cleanup container: %s\n", err.Error())
+		}
+		Expect(os.RemoveAll(boshRoot)).To(Succeed())
+	})
+
+	execCommand := func(args ...string) *exec.Cmd {
+		command := exec.Command(bpmPath, append([]string{"exec"}, args...)...)
+		command.Env = append(command.Env, fmt.Sprintf("BPM_BOSH_ROOT=%s", boshRoot))
+		return command
+	}
+
+	It("runs the command inside the container with the environment of the process", func() {
+		startJob(boshRoot, bpmPath, job)
+
+		session, err := gexec.Start(execCommand(job, "--", "/bin/bash", "-c", "echo value=$EXEC_TEST_VAR"), GinkgoWriter, GinkgoWriter)
+		Expect(err).ShouldNot(HaveOccurred())
+		<-session.Exited
+
+		Expect(session).To(gexec.Exit(0))
+		Expect(session.Out).Should(gbytes.Say("value=inherited-value"))
+	})
+
+	It("exits with the exit status of the command", func() {
+		startJob(boshRoot, bpmPath, job)
+
+		session, err := gexec.Start(execCommand(job, "--", "/bin/bash", "-c", "exit 7"), GinkgoWriter, GinkgoWriter)
+		Expect(err).ShouldNot(HaveOccurred())
+		<-session.Exited
+
+		Expect(session).To(gexec.Exit(7))
+	})
+
+	Context("when a clean environment is requested", func() {
+		It("does not inherit the environment of the process", func() {
+			startJob(boshRoot, bpmPath, job)
+
+			session, err := gexec.Start(execCommand("--clean-env", job, "--", "/bin/bash", "-c", "echo value=$EXEC_TEST_VAR"), GinkgoWriter, GinkgoWriter)
+			Expect(err).ShouldNot(HaveOccurred())
+			<-session.Exited
+
+			Expect(session).To(gexec.Exit(0))
+			Expect(session.Out).Should(gbytes.Say("value=\n"))
+		})
+	})
+
+	Context("when the container does not exist", func() {
+		It("returns an error", func() {
+			session, err := gexec.Start(execCommand(job, "--", "/bin/true"), GinkgoWriter, GinkgoWriter)
+			Expect(err).ShouldNot(HaveOccurred())
+			<-session.Exited
+
+			Expect(session).To(gexec.Exit(1))
+			Expect(session.Err).Should(gbytes.Say("process is not running or could not be found"))
+		})
+	})
+
+	Context("when no command is specified", func() {
+		It("exits with a non-zero exit code and prints the usage", func() {
+			session, err := gexec.Start(execCommand(job), GinkgoWriter, GinkgoWriter)
+			Expect(err).ShouldNot(HaveOccurred())
+			<-session.Exited
+
+			Expect(session).To(gexec.Exit(1))
+			Expect(session.Err).Should(gbytes.Say("must specify a command"))
+		})
+	})
+})
@@ -0,0 +1,113 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package integration_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/onsi/gomega/gexec"
+	uuid "github.com/satori/go.uuid"
+
+	"bpm/jobid"
+)
+
+var _ = Describe("gc", func() {
+	var (
+		boshRoot    string
+		containerID string
+		job         string
+		runcRoot    string
+		oldBundle   string
+		oldPidFile  string
+	)
+
+	bpm := func(args ...string) *gexec.Session {
+		command := exec.Command(bpmPath, args...)
+		command.Env = append(command.Env, fmt.Sprintf("BPM_BOSH_ROOT=%s", boshRoot))
+		session, err := gexec.Start(command, GinkgoWriter, GinkgoWriter)
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(session).Should(gexec.Exit())
+		return session
+	}
+
+	BeforeEach(func() {
+		var err error
+
+		job = uuid.NewV4().String()
+		containerID = jobid.Encode(job)
+		boshRoot, err = ioutil.TempDir(bpmTmpDir, "gc-test")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(os.Chmod(boshRoot, 0755)).To(Succeed())
+		runcRoot = setupBoshDirectories(boshRoot, job)
+
+		logFile := filepath.Join(boshRoot, "sys", "log", job, "foo.log")
+		writeConfig(boshRoot, job, newJobConfig(job, defaultBash(logFile)))
+
+		oldBundle = filepath.Join(boshRoot, "data", "bpm", "bundles", job, "old-worker")
+		Expect(os.MkdirAll(filepath.Join(oldBundle, "rootfs"), 0755)).To(Succeed())
+
+		oldPidFile = filepath.Join(boshRoot, "sys", "run", "bpm", job, "old-worker.pid")
+		Expect(os.MkdirAll(filepath.Dir(oldPidFile), 0755)).To(Succeed())
+		Expect(ioutil.WriteFile(oldPidFile, []byte("1234"), 0644)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		err := runcCommand(runcRoot, "delete", "--force", containerID).Run()
+		if err != nil {
+			fmt.Fprintf(GinkgoWriter, "WARNING: Failed to cleanup container: %s\n", err.Error())
+		}
+		Expect(os.RemoveAll(boshRoot)).To(Succeed())
+	})
+
+	It("removes the state of processes which are no longer configured", func() {
+		session := bpm("gc")
+		Expect(session).To(gexec.Exit(0))
+		Expect(session.Out).To(gbytes.Say(fmt.Sprintf("removed %s/old-worker \\(process removed\\)", job)))
+
+		Expect(oldBundle).NotTo(BeADirectory())
+		Expect(oldPidFile).NotTo(BeAnExistingFile())
+	})
+
+	It("only lists what would be removed in a dry run", func() {
+		session := bpm("gc", "--dry-run")
+		Expect(session).To(gexec.Exit(0))
+		Expect(session.Out).To(gbytes.Say(fmt.Sprintf("would remove %s/old-worker", job)))
+		Expect(session.Out).To(gbytes.Say(oldBundle))
+
+		Expect(oldBundle).To(BeADirectory())
+		Expect(oldPidFile).To(BeAnExistingFile())
+	})
+
+	It("skips processes whose container still exists", func() {
+		Expect(bpm("start", job)).To(gexec.Exit(0))
+
+		cfg := newJobConfig("renamed", "sleep 100")
+		writeConfig(boshRoot, job, cfg)
+
+		session := bpm("gc")
+		Expect(session).To(gexec.Exit(0))
+		Expect(session.Err).To(gbytes.Say(fmt.Sprintf("skipping %s/%s: its container still exists", job, job)))
+
+		Expect(runcCommand(runcRoot, "state", containerID).Run()).To(Succeed())
+	})
+})
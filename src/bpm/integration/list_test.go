@@ -129,4 +129,33 @@ var _ = Describe("list", func() {
 		Expect(session.Out).NotTo(gbytes.Say(unimplementedJob))
 		Expect(session.Err).NotTo(gbytes.Say(unimplementedJob))
 	})
+	Context("when the json format is requested", func() {
+		BeforeEach(func() {
+			cfg.Processes[0].Labels = map[string]string{"org.cloudfoundry.release": "example"}
+			writeConfig(boshRoot, job, cfg)
+
+			command.Args = append(command.Args, "--format", "json")
+		})
+
+		It("lists the jobs and their labels as json", func() {
+			startJob(boshRoot, bpmPath, job)
+			Eventually(func() specs.ContainerState { return runcState(runcRoot, containerID).Status }).Should(Equal(specs.StateRunning))
+
+			session, err := gexec.Start(command, GinkgoWriter, GinkgoWriter)
+			Expect(err).ShouldNot(HaveOccurred())
+
+			state := runcState(runcRoot, containerID)
+			<-session.Exited
+
+			cgroupPath := state.Annotations[config.CgroupPathAnnotation]
+			Expect(cgroupPath).To(HaveSuffix("/" + containerID))
+
+			Expect(session).To(gexec.Exit(0))
+			Expect(session.Out.Contents()).To(MatchJSON(fmt.Sprintf(`[
+				{"name": %q, "pid": 0, "status": "stopped", "labels": {}, "oom_killed": false, "overridden": false},
+				{"name": %q, "pid": %d, "status": "running", "labels": {"org.cloudfoundry.release": "example", %q: %q}, "oom_killed": false, "overridden": false, "cgroup_path": %q},
+				{"name": %q, "pid": 0, "status": "stopped", "labels": {}, "oom_killed": false, "overridden": false}
+			]`, failedJob, job, state.Pid, config.CgroupPathAnnotation, cgroupPath, cgroupPath, stoppedProcess)))
+		})
+	})
 })
@@ -21,6 +21,8 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
+	"time"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -134,6 +136,56 @@ var _ = Describe("logs", func() {
 		})
 	})
 
+	Context("when the --since flag is specified", func() {
+		BeforeEach(func() {
+			command = exec.Command(bpmPath, "logs", job, "--since", "10m")
+		})
+
+		It("prints only the lines written since then", func() {
+			f, err := os.OpenFile(stdout, os.O_APPEND|os.O_WRONLY, 0)
+			Expect(err).NotTo(HaveOccurred())
+			now := time.Now().UTC()
+			fmt.Fprintf(f, "%s old line\n", now.Add(-time.Hour).Format(time.RFC3339))
+			fmt.Fprintf(f, "%s new line\n", now.Format(time.RFC3339))
+			Expect(f.Close()).To(Succeed())
+
+			session, err := gexec.Start(command, GinkgoWriter, GinkgoWriter)
+			Expect(err).ShouldNot(HaveOccurred())
+			<-session.Exited
+
+			Expect(session).To(gexec.Exit(0))
+			Expect(string(session.Out.Contents())).To(Equal(fmt.Sprintf("%s new line\n", now.Format(time.RFC3339))))
+		})
+	})
+
+	Context("when the --cursor flag is specified", func() {
+		BeforeEach(func() {
+			command = exec.Command(bpmPath, "logs", job, "--cursor")
+		})
+
+		It("prints a cursor which --after carries on from", func() {
+			session, err := gexec.Start(command, GinkgoWriter, GinkgoWriter)
+			Expect(err).ShouldNot(HaveOccurred())
+			<-session.Exited
+			Expect(session).To(gexec.Exit(0))
+			cursor := strings.TrimSpace(string(session.Err.Contents()))
+
+			f, err := os.OpenFile(stdout, os.O_APPEND|os.O_WRONLY, 0)
+			Expect(err).NotTo(HaveOccurred())
+			fmt.Fprintln(f, "unseen line")
+			Expect(f.Close()).To(Succeed())
+
+			afterCommand := exec.Command(bpmPath, "logs", job, "--after", cursor)
+			afterCommand.Env = command.Env
+			session, err = gexec.Start(afterCommand, GinkgoWriter, GinkgoWriter)
+			Expect(err).ShouldNot(HaveOccurred())
+			<-session.Exited
+
+			Expect(session).To(gexec.Exit(0))
+			Expect(string(session.Out.Contents())).To(Equal("unseen line\n"))
+		})
+	})
+
 	Context("when the --err flag is specified", func() {
 		BeforeEach(func() {
 			command = exec.Command(bpmPath, "logs", job, "--err")
@@ -300,6 +352,37 @@ var _ = Describe("logs", func() {
 			output := session.Out.Contents()
 			validateNLogLinesArePresent(output, "ALT STDOUT", 25)
 		})
+		Context("when the --internal flag is specified", func() {
+			BeforeEach(func() {
+				command = exec.Command(bpmPath, "logs", job, "--internal", "-p", process)
+			})
+
+			It("shows only the bpm log lines of the corresponding process", func() {
+				session, err := gexec.Start(command, GinkgoWriter, GinkgoWriter)
+				Expect(err).ShouldNot(HaveOccurred())
+				<-session.Exited
+
+				Expect(session).To(gexec.Exit(0))
+				output := string(session.Out.Contents())
+				Expect(output).To(ContainSubstring(fmt.Sprintf(`"process":"%s"`, process)))
+				Expect(output).NotTo(ContainSubstring(fmt.Sprintf(`"process":"%s"`, job)))
+			})
+		})
+	})
+
+	Context("when the --internal flag is specified", func() {
+		BeforeEach(func() {
+			command = exec.Command(bpmPath, "logs", job, "--internal")
+		})
+
+		It("shows the bpm log of the job", func() {
+			session, err := gexec.Start(command, GinkgoWriter, GinkgoWriter)
+			Expect(err).ShouldNot(HaveOccurred())
+			<-session.Exited
+
+			Expect(session).To(gexec.Exit(0))
+			Expect(session.Out).To(gbytes.Say(`"message":"bpm.start.starting"`))
+		})
 	})
 
 	Context("when the job does not exist", func() {
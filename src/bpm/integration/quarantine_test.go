@@ -0,0 +1,115 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package integration_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/onsi/gomega/gexec"
+	uuid "github.com/satori/go.uuid"
+
+	"bpm/jobid"
+)
+
+var _ = Describe("quarantine", func() {
+	var (
+		boshRoot       string
+		containerID    string
+		job            string
+		runcRoot       string
+		quarantineFile string
+	)
+
+	bpm := func(args ...string) *gexec.Session {
+		command := exec.Command(bpmPath, args...)
+		command.Env = append(command.Env, fmt.Sprintf("BPM_BOSH_ROOT=%s", boshRoot))
+		session, err := gexec.Start(command, GinkgoWriter, GinkgoWriter)
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(session).Should(gexec.Exit())
+		return session
+	}
+
+	BeforeEach(func() {
+		var err error
+
+		job = uuid.NewV4().String()
+		containerID = jobid.Encode(job)
+		boshRoot, err = ioutil.TempDir(bpmTmpDir, "quarantine-test")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(os.Chmod(boshRoot, 0755)).To(Succeed())
+		runcRoot = setupBoshDirectories(boshRoot, job)
+
+		quarantineFile = filepath.Join(boshRoot, "data", "bpm", "quarantine", fmt.Sprintf("%s.%s.json", job, job))
+
+		logFile := filepath.Join(boshRoot, "sys", "log", job, "foo.log")
+		writeConfig(boshRoot, job, newJobConfig(job, defaultBash(logFile)))
+
+		Expect(bpm("start", job)).To(gexec.Exit(0))
+		Expect(bpm("quarantine", job, "--reason", "investigating")).To(gexec.Exit(0))
+	})
+
+	AfterEach(func() {
+		err := runcCommand(runcRoot, "delete", "--force", containerID).Run()
+		if err != nil {
+			fmt.Fprintf(GinkgoWriter, "WARNING: Failed to cleanup container: %s\n", err.Error())
+		}
+		Expect(os.RemoveAll(boshRoot)).To(Succeed())
+	})
+
+	It("freezes the container and shows the process as quarantined", func() {
+		Expect(runcState(runcRoot, containerID).Status).To(Equal("paused"))
+		Expect(fileContents(quarantineFile)()).To(ContainSubstring("investigating"))
+
+		session := bpm("list")
+		Expect(session).To(gexec.Exit(0))
+		Expect(session.Out).To(gbytes.Say(`%s\s+\d+\s+quarantined`, job))
+	})
+
+	It("refuses to start or stop the process", func() {
+		session := bpm("stop", job)
+		Expect(session).To(gexec.Exit(1))
+		Expect(session.Err).To(gbytes.Say("quarantined"))
+
+		session = bpm("start", job)
+		Expect(session).To(gexec.Exit(1))
+		Expect(session.Err).To(gbytes.Say("quarantined"))
+
+		Expect(runcState(runcRoot, containerID).Status).To(Equal("paused"))
+	})
+
+	It("resumes the process when it is unquarantined", func() {
+		Expect(bpm("unquarantine", job)).To(gexec.Exit(0))
+
+		Expect(runcState(runcRoot, containerID).Status).To(Equal("running"))
+		Expect(quarantineFile).NotTo(BeAnExistingFile())
+		Expect(bpm("stop", job)).To(gexec.Exit(0))
+	})
+
+	It("deletes the quarantined container without it being forced", func() {
+		Expect(bpm("delete", job)).To(gexec.Exit(0))
+
+		Expect(runcCommand(runcRoot, "state", containerID).Run()).To(HaveOccurred())
+		Expect(quarantineFile).NotTo(BeAnExistingFile())
+		Expect(bpm("start", job)).To(gexec.Exit(0))
+	})
+})
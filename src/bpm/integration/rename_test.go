@@ -0,0 +1,98 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package integration_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/onsi/gomega/gexec"
+	uuid "github.com/satori/go.uuid"
+
+	"bpm/jobid"
+)
+
+var _ = Describe("rename", func() {
+	var (
+		boshRoot    string
+		containerID string
+		job         string
+		newJob      string
+		runcRoot    string
+	)
+
+	bpm := func(args ...string) *gexec.Session {
+		command := exec.Command(bpmPath, args...)
+		command.Env = append(command.Env, fmt.Sprintf("BPM_BOSH_ROOT=%s", boshRoot))
+		session, err := gexec.Start(command, GinkgoWriter, GinkgoWriter)
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(session).Should(gexec.Exit())
+		return session
+	}
+
+	BeforeEach(func() {
+		var err error
+
+		job = uuid.NewV4().String()
+		newJob = uuid.NewV4().String()
+		containerID = jobid.Encode(job)
+		boshRoot, err = ioutil.TempDir(bpmTmpDir, "rename-test")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(os.Chmod(boshRoot, 0755)).To(Succeed())
+		runcRoot = setupBoshDirectories(boshRoot, job)
+
+		writeConfig(boshRoot, job, newJobConfig(job, "sleep 100"))
+		Expect(ioutil.WriteFile(filepath.Join(boshRoot, "data", job, "cache"), []byte("cached"), 0644)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		err := runcCommand(runcRoot, "delete", "--force", containerID).Run()
+		if err != nil {
+			fmt.Fprintf(GinkgoWriter, "WARNING: Failed to cleanup container: %s\n", err.Error())
+		}
+		Expect(os.RemoveAll(boshRoot)).To(Succeed())
+	})
+
+	It("moves the data and logs of a stopped job to its new name", func() {
+		Expect(bpm("start", job)).To(gexec.Exit(0))
+		Expect(bpm("stop", job)).To(gexec.Exit(0))
+
+		session := bpm("rename", job, newJob)
+		Expect(session).To(gexec.Exit(0))
+		Expect(session.Out).To(gbytes.Say(fmt.Sprintf("moved %s -> %s", filepath.Join(boshRoot, "data", job), filepath.Join(boshRoot, "data", newJob))))
+
+		Expect(ioutil.ReadFile(filepath.Join(boshRoot, "data", newJob, "cache"))).To(Equal([]byte("cached")))
+		Expect(filepath.Join(boshRoot, "sys", "log", newJob, "bpm.log")).To(BeAnExistingFile())
+		Expect(filepath.Join(boshRoot, "data", job)).NotTo(BeADirectory())
+		Expect(filepath.Join(boshRoot, "data", "bpm", "bundles", job)).NotTo(BeADirectory())
+	})
+
+	It("refuses to rename a job which is still running", func() {
+		Expect(bpm("start", job)).To(gexec.Exit(0))
+
+		session := bpm("rename", job, newJob)
+		Expect(session).To(gexec.Exit(1))
+		Expect(session.Err).To(gbytes.Say(fmt.Sprintf("%s/%s still has a container", job, job)))
+
+		Expect(filepath.Join(boshRoot, "data", job, "cache")).To(BeAnExistingFile())
+	})
+})
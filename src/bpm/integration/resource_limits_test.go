@@ -27,6 +27,7 @@ import (
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
 	"github.com/onsi/gomega/gexec"
 	specs "github.com/opencontainers/runtime-spec/specs-go"
 	uuid "github.com/satori/go.uuid"
@@ -118,7 +119,8 @@ var _ = Describe("resource limits", func() {
 			Expect(session).To(gexec.Exit(0))
 			Eventually(func() specs.ContainerState { return runcState(runcRoot, containerID).Status }).Should(Equal(specs.StateRunning))
 
-			eventsCmd := runcCommand(runcRoot, "events", containerID)
+			eventsCmd := exec.Command(bpmPath, "events", job, "--interval", "1s")
+			eventsCmd.Env = append(eventsCmd.Env, fmt.Sprintf("BPM_BOSH_ROOT=%s", boshRoot))
 			stdout, err := eventsCmd.StdoutPipe()
 			Expect(err).NotTo(HaveOccurred())
 
@@ -127,9 +129,28 @@ var _ = Describe("resource limits", func() {
 
 			Expect(runcCommand(runcRoot, "kill", containerID).Run()).To(Succeed())
 			Eventually(oomEventsChan).Should(Receive())
-			Expect(eventsCmd.Process.Kill()).To(Succeed())
+			Expect(eventsCmd.Process.Signal(os.Interrupt)).To(Succeed())
 			Eventually(oomEventsChan).Should(BeClosed())
 		})
+
+		It("reports that the process was OOM killed", func() {
+			session, err := gexec.Start(command, GinkgoWriter, GinkgoWriter)
+			Expect(err).NotTo(HaveOccurred())
+			<-session.Exited
+			Expect(session).To(gexec.Exit(0))
+			Eventually(func() specs.ContainerState { return runcState(runcRoot, containerID).Status }).Should(Equal(specs.StateRunning))
+
+			Expect(runcCommand(runcRoot, "kill", containerID).Run()).To(Succeed())
+
+			Eventually(func() *gexec.Session {
+				stateCmd := exec.Command(bpmPath, "state", job)
+				stateCmd.Env = append(stateCmd.Env, fmt.Sprintf("BPM_BOSH_ROOT=%s", boshRoot))
+				session, err := gexec.Start(stateCmd, GinkgoWriter, GinkgoWriter)
+				Expect(err).NotTo(HaveOccurred())
+				<-session.Exited
+				return session
+			}).Should(gbytes.Say(fmt.Sprintf("%s\\s+\\S+\\s+\\S+\\s+yes", job)))
+		})
 	})
 
 	Context("open files", func() {
@@ -171,9 +192,65 @@ var _ = Describe("resource limits", func() {
 			Eventually(fileContents(stderr)).Should(ContainSubstring("fork: retry: Resource temporarily unavailable"))
 		})
 	})
+
+	Context("checking the limits", func() {
+		BeforeEach(func() {
+			cfg = newJobConfig(job, defaultBash(boshEnv.LogDir(job).Join("foo.log").Internal()))
+			processes := int64(50)
+			openFiles := uint64(100)
+			cfg.Processes[0].Limits = &config.Limits{Processes: &processes, OpenFiles: &openFiles}
+		})
+
+		It("reports that the process has the limits it was configured with", func() {
+			session, err := gexec.Start(command, GinkgoWriter, GinkgoWriter)
+			Expect(err).NotTo(HaveOccurred())
+			<-session.Exited
+			Expect(session).To(gexec.Exit(0))
+
+			check := exec.Command(bpmPath, "check-limits", job)
+			check.Env = append(check.Env, fmt.Sprintf("BPM_BOSH_ROOT=%s", boshRoot))
+
+			session, err = gexec.Start(check, GinkgoWriter, GinkgoWriter)
+			Expect(err).NotTo(HaveOccurred())
+			<-session.Exited
+
+			Expect(session).To(gexec.Exit(0))
+			Expect(session.Out).To(gbytes.Say("RLIMIT_NOFILE\\s+100/100\\s+100/100\\s+ok"))
+			Expect(session.Out).To(gbytes.Say("pids\\s+50\\s+50\\s+ok"))
+		})
+
+		It("applies changed limits without restarting the process", func() {
+			session, err := gexec.Start(command, GinkgoWriter, GinkgoWriter)
+			Expect(err).NotTo(HaveOccurred())
+			<-session.Exited
+			Expect(session).To(gexec.Exit(0))
+			pid := runcState(runcRoot, containerID).Pid
+
+			processes := int64(80)
+			cfg.Processes[0].Limits.Processes = &processes
+			writeConfig(boshRoot, job, cfg)
+
+			update := exec.Command(bpmPath, "update", job)
+			update.Env = append(update.Env, fmt.Sprintf("BPM_BOSH_ROOT=%s", boshRoot))
+			session, err = gexec.Start(update, GinkgoWriter, GinkgoWriter)
+			Expect(err).NotTo(HaveOccurred())
+			<-session.Exited
+			Expect(session).To(gexec.Exit(0))
+			Expect(session.Out).To(gbytes.Say("updated processes"))
+
+			Expect(runcState(runcRoot, containerID).Pid).To(Equal(pid))
+
+			check := exec.Command(bpmPath, "check-limits", job)
+			check.Env = append(check.Env, fmt.Sprintf("BPM_BOSH_ROOT=%s", boshRoot))
+			session, err = gexec.Start(check, GinkgoWriter, GinkgoWriter)
+			Expect(err).NotTo(HaveOccurred())
+			<-session.Exited
+			Expect(session).To(gexec.Exit(0))
+			Expect(session.Out).To(gbytes.Say("pids\\s+80\\s+80\\s+ok"))
+		})
+	})
 })
 
 type event struct {
-	Type      string                 `json:"type"`
-	Arbitrary map[string]interface{} `json:",inline"`
+	Type string `json:"type"`
 }
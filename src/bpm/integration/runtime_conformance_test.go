@@ -0,0 +1,37 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package integration_test
+
+import (
+	"os/exec"
+	"path/filepath"
+
+	. "github.com/onsi/gomega"
+
+	"bpm/runc/client"
+	"bpm/runc/conformance"
+	"bpm/runc/lifecycle"
+)
+
+var _ = conformance.DescribeRuntime(conformance.Backend{
+	Name: "runc",
+	New: func() lifecycle.RuncClient {
+		runcPath, err := exec.LookPath("runc")
+		Expect(err).NotTo(HaveOccurred())
+
+		return client.NewRuncClient(runcPath, filepath.Join(bpmTmpDir, "conformance-runc"), false)
+	},
+})
@@ -60,6 +60,7 @@ var _ = Describe("start", func() {
 
 		logFile := filepath.Join(boshRoot, "sys", "log", job, "foo.log")
 		cfg = newJobConfig(job, defaultBash(logFile))
+		cfg.Processes[0].Env = map[string]string{"SHELL_TEST_VAR": "inherited-value"}
 		writeConfig(boshRoot, job, cfg)
 
 		ptyF, ttyF, err = pty.Open()
@@ -103,6 +104,42 @@ var _ = Describe("start", func() {
 		Eventually(session.Out).Should(gbytes.Say("xterm-256color"))
 	})
 
+	It("inherits the environment of the process", func() {
+		startJob(boshRoot, bpmPath, job)
+
+		session, err := gexec.Start(command, GinkgoWriter, GinkgoWriter)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(ttyF.Close()).NotTo(HaveOccurred())
+
+		_, err = ptyF.Write([]byte("/bin/echo value=$SHELL_TEST_VAR\nexit\n"))
+		Expect(err).ShouldNot(HaveOccurred())
+		<-session.Exited
+		Expect(session).To(gexec.Exit(0))
+
+		Eventually(session.Out).Should(gbytes.Say("value=inherited-value"))
+	})
+
+	Context("when a clean environment is requested", func() {
+		JustBeforeEach(func() {
+			command.Args = append(command.Args, "--clean-env")
+		})
+
+		It("does not inherit the environment of the process", func() {
+			startJob(boshRoot, bpmPath, job)
+
+			session, err := gexec.Start(command, GinkgoWriter, GinkgoWriter)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(ttyF.Close()).NotTo(HaveOccurred())
+
+			_, err = ptyF.Write([]byte("/bin/echo value=$SHELL_TEST_VAR term=$TERM\nexit\n"))
+			Expect(err).ShouldNot(HaveOccurred())
+			<-session.Exited
+			Expect(session).To(gexec.Exit(0))
+
+			Eventually(session.Out).Should(gbytes.Say("value= term=xterm-256color"))
+		})
+	})
+
 	It("does not print the usage on invalid commands", func() {
 		startJob(boshRoot, bpmPath, job)
 
@@ -0,0 +1,123 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package integration_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gexec"
+	uuid "github.com/satori/go.uuid"
+
+	"bpm/config"
+	"bpm/jobid"
+)
+
+var _ = Describe("sockets", func() {
+	var (
+		boshRoot    string
+		containerID string
+		job         string
+		runcRoot    string
+		socketPath  string
+	)
+
+	bpm := func(args ...string) *gexec.Session {
+		command := exec.Command(bpmPath, args...)
+		command.Env = append(command.Env, fmt.Sprintf("BPM_BOSH_ROOT=%s", boshRoot))
+		session, err := gexec.Start(command, GinkgoWriter, GinkgoWriter)
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(session).Should(gexec.Exit())
+		return session
+	}
+
+	// connect connects to the socket as a user who is neither the owner of
+	// the socket nor the user of the process. 3001 is the bpm-sockets group
+	// in the docker container.
+	connect := func(gid uint32) *gexec.Session {
+		command := exec.Command("nc", "-zU", socketPath)
+		command.SysProcAttr = &syscall.SysProcAttr{
+			Credential: &syscall.Credential{Uid: 2001, Gid: gid},
+		}
+		session, err := gexec.Start(command, GinkgoWriter, GinkgoWriter)
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(session).Should(gexec.Exit())
+		return session
+	}
+
+	socketStat := func() *syscall.Stat_t {
+		info, err := os.Stat(socketPath)
+		if err != nil {
+			return nil
+		}
+		return info.Sys().(*syscall.Stat_t)
+	}
+
+	BeforeEach(func() {
+		var err error
+
+		job = uuid.NewV4().String()
+		containerID = jobid.Encode(job)
+		boshRoot, err = ioutil.TempDir(bpmTmpDir, "sockets-test")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(os.Chmod(boshRoot, 0755)).To(Succeed())
+		runcRoot = setupBoshDirectories(boshRoot, job)
+
+		socketPath = filepath.Join(boshRoot, "data", job, "sockets", "api.sock")
+
+		cfg := newJobConfig(job, fmt.Sprintf("exec nc -lkU %s", socketPath))
+		cfg.Processes[0].Sockets = []config.Socket{
+			{Path: socketPath, Group: "bpm-sockets", Mode: "0660"},
+		}
+		writeConfig(boshRoot, job, cfg)
+
+		Expect(bpm("start", job)).To(gexec.Exit(0))
+		Eventually(socketStat).Should(And(
+			Not(BeNil()),
+			WithTransform(func(st *syscall.Stat_t) uint32 { return st.Gid }, Equal(uint32(3001))),
+			WithTransform(func(st *syscall.Stat_t) uint32 { return st.Mode & 0777 }, Equal(uint32(0660))),
+		))
+	})
+
+	AfterEach(func() {
+		err := runcCommand(runcRoot, "delete", "--force", containerID).Run()
+		if err != nil {
+			fmt.Fprintf(GinkgoWriter, "WARNING: Failed to cleanup container: %s\n", err.Error())
+		}
+		Expect(os.RemoveAll(boshRoot)).To(Succeed())
+	})
+
+	It("gives the socket the configured ownership and mode", func() {
+		st := socketStat()
+		Expect(st.Uid).To(Equal(uint32(2000)))
+		Expect(st.Gid).To(Equal(uint32(3001)))
+		Expect(st.Mode & 0777).To(Equal(uint32(0660)))
+	})
+
+	It("lets another user in the socket's group connect", func() {
+		Expect(connect(3001)).To(gexec.Exit(0))
+	})
+
+	It("does not let another user outside the group connect", func() {
+		Expect(connect(2001)).NotTo(gexec.Exit(0))
+	})
+})
@@ -16,6 +16,7 @@
 package integration_test
 
 import (
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -203,6 +204,39 @@ var _ = Describe("start", func() {
 		})
 	})
 
+	Context("when the process has instances", func() {
+		BeforeEach(func() {
+			cfg.Processes[0].Instances = 2
+			cfg.Processes[0].Args = []string{"-c", `echo "instance $BPM_INSTANCE_INDEX"; sleep 100`}
+		})
+
+		AfterEach(func() {
+			for i := 0; i < 2; i++ {
+				id := jobid.Encode(fmt.Sprintf("%s.%s", job, config.InstanceName(job, i)))
+				if err := runcCommand(runcRoot, "delete", "--force", id).Run(); err != nil {
+					fmt.Fprintf(GinkgoWriter, "WARNING: Failed to cleanup container: %s\n", err.Error())
+				}
+			}
+		})
+
+		It("starts a container for each instance which is told its index", func() {
+			session, err := gexec.Start(command, GinkgoWriter, GinkgoWriter)
+			Expect(err).NotTo(HaveOccurred())
+			<-session.Exited
+
+			Expect(session).To(gexec.Exit(0))
+
+			for i := 0; i < 2; i++ {
+				instance := config.InstanceName(job, i)
+				state := runcState(runcRoot, jobid.Encode(fmt.Sprintf("%s.%s", job, instance)))
+				Expect(state.Status).To(Equal(specs.StateRunning))
+
+				instanceStdout := filepath.Join(boshRoot, "sys", "log", job, fmt.Sprintf("%s.stdout.log", instance))
+				Eventually(fileContents(instanceStdout)).Should(Equal(fmt.Sprintf("instance %d\n", i)))
+			}
+		})
+	})
+
 	Context("when a pre_start hook is specified", func() {
 		BeforeEach(func() {
 			preStart := filepath.Join(boshRoot, "pre-start")
@@ -368,6 +402,40 @@ var _ = Describe("start", func() {
 			Expect(state.Status).To(Equal(specs.StateRunning))
 		})
 
+		It("`bpm start --reuse-bundle` starts it again from the existing bundle", func() {
+			command = exec.Command(bpmPath, "start", job, "--reuse-bundle")
+			command.Env = append(command.Env, fmt.Sprintf("BPM_BOSH_ROOT=%s", boshRoot))
+
+			session, err := gexec.Start(command, GinkgoWriter, GinkgoWriter)
+			Expect(err).ShouldNot(HaveOccurred())
+			<-session.Exited
+			Expect(session).To(gexec.Exit(0))
+
+			state := runcState(runcRoot, containerID)
+			Expect(state.Status).To(Equal(specs.StateRunning))
+			Expect(fileContents(bpmLog)()).To(ContainSubstring("reviving-stopped-process"))
+		})
+
+		Context("and the configuration has changed", func() {
+			JustBeforeEach(func() {
+				writeConfig(boshRoot, job, newJobConfig(job, "sleep 100"))
+			})
+
+			It("`bpm start --reuse-bundle` rebuilds the bundle", func() {
+				command = exec.Command(bpmPath, "start", job, "--reuse-bundle")
+				command.Env = append(command.Env, fmt.Sprintf("BPM_BOSH_ROOT=%s", boshRoot))
+
+				session, err := gexec.Start(command, GinkgoWriter, GinkgoWriter)
+				Expect(err).ShouldNot(HaveOccurred())
+				<-session.Exited
+				Expect(session).To(gexec.Exit(0))
+
+				state := runcState(runcRoot, containerID)
+				Expect(state.Status).To(Equal(specs.StateRunning))
+				Expect(fileContents(bpmLog)()).To(ContainSubstring("removing-stopped-process"))
+			})
+		})
+
 		Context("and the pid file does not exist", func() {
 			JustBeforeEach(func() {
 				err := os.RemoveAll(filepath.Join(boshRoot, "sys", "run", "bpm", job, fmt.Sprintf("%s.pid", job)))
@@ -390,6 +458,22 @@ var _ = Describe("start", func() {
 		})
 	})
 
+	Context("when a required environment variable is missing", func() {
+		BeforeEach(func() {
+			cfg.Processes[0].RequiredEnv = []string{"DATABASE_URL"}
+		})
+
+		It("exits with a non-zero exit code without starting the process", func() {
+			session, err := gexec.Start(command, GinkgoWriter, GinkgoWriter)
+			Expect(err).ShouldNot(HaveOccurred())
+			<-session.Exited
+
+			Expect(session).To(gexec.Exit(1))
+			Expect(session.Err).Should(gbytes.Say("missing required environment variables: DATABASE_URL"))
+			Expect(runcState(runcRoot, containerID).Status).To(BeEmpty())
+		})
+	})
+
 	Context("when the process is not defined in the bpm config", func() {
 		JustBeforeEach(func() {
 			command = exec.Command(bpmPath, "start", job, "-p", "I DO NOT EXIST")
@@ -406,6 +490,81 @@ var _ = Describe("start", func() {
 		})
 	})
 
+	Context("when the result is asked for as json", func() {
+		JustBeforeEach(func() {
+			command.Args = append(command.Args, "--output", "json")
+		})
+
+		It("prints the state the process was left in", func() {
+			session, err := gexec.Start(command, GinkgoWriter, GinkgoWriter)
+			Expect(err).ShouldNot(HaveOccurred())
+			<-session.Exited
+
+			Expect(session).To(gexec.Exit(0))
+
+			var result map[string]interface{}
+			Expect(json.Unmarshal(session.Out.Contents(), &result)).To(Succeed())
+			Expect(result).To(HaveKeyWithValue("command", "start"))
+			Expect(result).To(HaveKeyWithValue("job", job))
+			Expect(result).To(HaveKeyWithValue("container_id", containerID))
+			Expect(result).To(HaveKeyWithValue("status", "running"))
+			Expect(result).To(HaveKeyWithValue("pid", BeNumerically("==", runcState(runcRoot, containerID).Pid)))
+			Expect(result).To(HaveKey("duration_seconds"))
+			Expect(result).NotTo(HaveKey("error"))
+		})
+
+		Context("and the process is not defined in the bpm config", func() {
+			JustBeforeEach(func() {
+				command.Args = append(command.Args, "-p", "I DO NOT EXIST")
+			})
+
+			It("reports the class of the error", func() {
+				session, err := gexec.Start(command, GinkgoWriter, GinkgoWriter)
+				Expect(err).ShouldNot(HaveOccurred())
+				<-session.Exited
+
+				Expect(session).To(gexec.Exit(1))
+				Expect(session.Err.Contents()).To(BeEmpty())
+
+				var result struct {
+					Error struct {
+						Class   string `json:"class"`
+						Message string `json:"message"`
+					} `json:"error"`
+				}
+				Expect(json.Unmarshal(session.Out.Contents(), &result)).To(Succeed())
+				Expect(result.Error.Class).To(Equal("config"))
+				Expect(result.Error.Message).To(ContainSubstring(`process "I DO NOT EXIST" not present in job configuration`))
+			})
+		})
+
+		Context("and the container spec cannot be built", func() {
+			BeforeEach(func() {
+				node := 99
+				cfg.Processes[0].NUMANode = &node
+			})
+
+			It("reports the phase of the start which failed", func() {
+				session, err := gexec.Start(command, GinkgoWriter, GinkgoWriter)
+				Expect(err).ShouldNot(HaveOccurred())
+				<-session.Exited
+
+				Expect(session).To(gexec.Exit(1))
+
+				var result struct {
+					Error struct {
+						Message string `json:"message"`
+						Phase   string `json:"phase"`
+					} `json:"error"`
+				}
+				Expect(json.Unmarshal(session.Out.Contents(), &result)).To(Succeed())
+				Expect(result.Error.Phase).To(Equal("spec-build"))
+				Expect(result.Error.Message).To(ContainSubstring("failed to start job-process during spec-build: invalid numa_node"))
+				Expect(ioutil.ReadFile(bpmLog)).To(ContainSubstring(`"phase":"spec-build"`))
+			})
+		})
+	})
+
 	Context("when specifying volumes with a globbed path", func() {
 		BeforeEach(func() {
 			Expect(os.MkdirAll(filepath.Join(boshRoot, "jobs", "job-1", "config"), 0700)).To(Succeed())
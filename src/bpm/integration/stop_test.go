@@ -137,6 +137,39 @@ var _ = Describe("stop", func() {
 		Eventually(fileContents(bpmLog)).Should(ContainSubstring("bpm.stop.complete"))
 	})
 
+	Context("when the container is not to be deleted", func() {
+		JustBeforeEach(func() {
+			command = exec.Command(bpmPath, "stop", job, "--no-delete")
+			command.Env = append(command.Env, fmt.Sprintf("BPM_BOSH_ROOT=%s", boshRoot))
+		})
+
+		It("stops the process but keeps its container and bundle until it is deleted", func() {
+			session, err := gexec.Start(command, GinkgoWriter, GinkgoWriter)
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(session).Should(gexec.Exit(0))
+
+			Eventually(fileContents(stdout)).Should(ContainSubstring("Received a Signal"))
+			Expect(runcCommand(runcRoot, "state", containerID).Run()).To(Succeed())
+			Expect(filepath.Join(boshRoot, "data", "bpm", "bundles", job, job)).To(BeADirectory())
+
+			listCommand := exec.Command(bpmPath, "list")
+			listCommand.Env = append(listCommand.Env, fmt.Sprintf("BPM_BOSH_ROOT=%s", boshRoot))
+			session, err = gexec.Start(listCommand, GinkgoWriter, GinkgoWriter)
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(session).Should(gexec.Exit(0))
+			Expect(session.Out).To(gbytes.Say(`stopped \(preserved\)`))
+
+			deleteCommand := exec.Command(bpmPath, "delete", job)
+			deleteCommand.Env = append(deleteCommand.Env, fmt.Sprintf("BPM_BOSH_ROOT=%s", boshRoot))
+			session, err = gexec.Start(deleteCommand, GinkgoWriter, GinkgoWriter)
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(session).Should(gexec.Exit(0))
+
+			Expect(runcCommand(runcRoot, "state", containerID).Run()).To(HaveOccurred())
+			Expect(filepath.Join(boshRoot, "data", "bpm", "bundles", job, job)).NotTo(BeAnExistingFile())
+		})
+	})
+
 	Context("when the job name is not specified", func() {
 		It("exits with a non-zero exit code and prints the usage", func() {
 			command = exec.Command(bpmPath, "stop")
@@ -151,6 +184,34 @@ var _ = Describe("stop", func() {
 		})
 	})
 
+	Context("when all processes are stopped", func() {
+		It("stops every process on the host", func() {
+			command = exec.Command(bpmPath, "stop", "--all", "--parallel", "4")
+			command.Env = append(command.Env, fmt.Sprintf("BPM_BOSH_ROOT=%s", boshRoot))
+
+			session, err := gexec.Start(command, GinkgoWriter, GinkgoWriter)
+			Expect(err).NotTo(HaveOccurred())
+			<-session.Exited
+			Expect(session).To(gexec.Exit(0))
+
+			Eventually(fileContents(stdout)).Should(ContainSubstring("Received a Signal"))
+			Expect(runcCommand(runcRoot, "state", containerID).Run()).To(HaveOccurred())
+			Expect(fileContents(bpmLog)()).To(ContainSubstring("bpm.stop.complete"))
+		})
+
+		It("does not accept a job name as well", func() {
+			command = exec.Command(bpmPath, "stop", "--all", job)
+			command.Env = append(command.Env, fmt.Sprintf("BPM_BOSH_ROOT=%s", boshRoot))
+
+			session, err := gexec.Start(command, GinkgoWriter, GinkgoWriter)
+			Expect(err).NotTo(HaveOccurred())
+			<-session.Exited
+
+			Expect(session).To(gexec.Exit(1))
+			Expect(session.Err).Should(gbytes.Say("cannot specify a job or process"))
+		})
+	})
+
 	Context("when the job is already stopped", func() {
 		JustBeforeEach(func() {
 			session, err := gexec.Start(command, GinkgoWriter, GinkgoWriter)
@@ -0,0 +1,78 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package integration_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/onsi/gomega/gexec"
+	uuid "github.com/satori/go.uuid"
+)
+
+var _ = Describe("validate", func() {
+	var (
+		command *exec.Cmd
+
+		boshRoot string
+		job      string
+	)
+
+	BeforeEach(func() {
+		var err error
+
+		job = uuid.NewV4().String()
+		boshRoot, err = ioutil.TempDir(bpmTmpDir, "validate-test")
+		Expect(err).NotTo(HaveOccurred())
+		setupBoshDirectories(boshRoot, job)
+	})
+
+	JustBeforeEach(func() {
+		command = exec.Command(bpmPath, "validate", job, "--strict")
+		command.Env = append(command.Env, fmt.Sprintf("BPM_BOSH_ROOT=%s", boshRoot))
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(boshRoot)).To(Succeed())
+	})
+
+	It("succeeds when the configuration is valid", func() {
+		writeConfig(boshRoot, job, newJobConfig(job, "exit 0"))
+
+		session, err := gexec.Start(command, GinkgoWriter, GinkgoWriter)
+		Expect(err).ShouldNot(HaveOccurred())
+		<-session.Exited
+
+		Expect(session).To(gexec.Exit(0))
+		Expect(session.Err.Contents()).To(BeEmpty())
+	})
+
+	It("fails when the configuration is invalid", func() {
+		writeInvalidConfig(boshRoot, job)
+
+		session, err := gexec.Start(command, GinkgoWriter, GinkgoWriter)
+		Expect(err).ShouldNot(HaveOccurred())
+		<-session.Exited
+
+		Expect(session).To(gexec.Exit(1))
+		Expect(session.Err).To(gbytes.Say("invalid job configuration"))
+	})
+})
@@ -0,0 +1,218 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+// Package limitcheck compares the limits which a running process actually
+// has with the limits which bpm asked the container runtime for. The kernel
+// can silently clamp or ignore a limit, and cgroup v1 and v2 do not support
+// the same ones, so the two do not always agree.
+package limitcheck
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+
+	"bpm/models"
+)
+
+const unlimited = "unlimited"
+
+// procLimitNames maps the names which /proc/PID/limits uses to the names of
+// the resource limits in the runtime spec.
+var procLimitNames = map[string]string{
+	"Max cpu time":          "RLIMIT_CPU",
+	"Max file size":         "RLIMIT_FSIZE",
+	"Max data size":         "RLIMIT_DATA",
+	"Max stack size":        "RLIMIT_STACK",
+	"Max core file size":    "RLIMIT_CORE",
+	"Max resident set":      "RLIMIT_RSS",
+	"Max processes":         "RLIMIT_NPROC",
+	"Max open files":        "RLIMIT_NOFILE",
+	"Max locked memory":     "RLIMIT_MEMLOCK",
+	"Max address space":     "RLIMIT_AS",
+	"Max file locks":        "RLIMIT_LOCKS",
+	"Max pending signals":   "RLIMIT_SIGPENDING",
+	"Max msgqueue size":     "RLIMIT_MSGQUEUE",
+	"Max nice priority":     "RLIMIT_NICE",
+	"Max realtime priority": "RLIMIT_RTPRIO",
+	"Max realtime timeout":  "RLIMIT_RTTIME",
+}
+
+// Rlimit is the soft and hard value of a resource limit of a process.
+type Rlimit struct {
+	Soft uint64
+	Hard uint64
+}
+
+// ReadProcLimits reads the resource limits of a process from
+// /proc/PID/limits, keyed by the names used in the runtime spec.
+func ReadProcLimits(pid int) (map[string]Rlimit, error) {
+	f, err := os.Open(fmt.Sprintf("/proc/%d/limits", pid))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return parseProcLimits(f)
+}
+
+func parseProcLimits(r io.Reader) (map[string]Rlimit, error) {
+	limits := map[string]Rlimit{}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		for name, rlimit := range procLimitNames {
+			if !strings.HasPrefix(line, name+" ") {
+				continue
+			}
+
+			fields := strings.Fields(strings.TrimPrefix(line, name))
+			if len(fields) < 2 {
+				return nil, fmt.Errorf("invalid limit: %q", line)
+			}
+
+			soft, err := parseProcLimit(fields[0])
+			if err != nil {
+				return nil, err
+			}
+
+			hard, err := parseProcLimit(fields[1])
+			if err != nil {
+				return nil, err
+			}
+
+			limits[rlimit] = Rlimit{Soft: soft, Hard: hard}
+		}
+	}
+
+	return limits, scanner.Err()
+}
+
+func parseProcLimit(value string) (uint64, error) {
+	if value == unlimited {
+		return math.MaxUint64, nil
+	}
+
+	return strconv.ParseUint(value, 10, 64)
+}
+
+// Compare checks each limit which spec sets against the resource limits and
+// cgroup limits which the process has. Limits which spec does not set are not
+// checked.
+//
+// The kernel rounds memory limits down to a whole number of pages so a
+// memory limit which has been rounded still matches.
+func Compare(spec *specs.Spec, rlimits map[string]Rlimit, cgroup *models.CgroupLimits) []models.LimitCheck {
+	var checks []models.LimitCheck
+
+	if spec.Process != nil {
+		for _, expected := range spec.Process.Rlimits {
+			check := models.LimitCheck{
+				Limit:    expected.Type,
+				Expected: formatRlimit(Rlimit{Soft: expected.Soft, Hard: expected.Hard}),
+				Actual:   "unknown",
+			}
+
+			if actual, ok := rlimits[expected.Type]; ok {
+				check.Actual = formatRlimit(actual)
+				check.Matches = actual.Soft == expected.Soft && actual.Hard == expected.Hard
+			}
+
+			checks = append(checks, check)
+		}
+	}
+
+	if spec.Linux == nil || spec.Linux.Resources == nil {
+		return checks
+	}
+	resources := spec.Linux.Resources
+
+	if resources.Memory != nil && resources.Memory.Limit != nil && *resources.Memory.Limit > 0 {
+		expected := uint64(*resources.Memory.Limit)
+		pageSize := uint64(os.Getpagesize())
+
+		checks = append(checks, models.LimitCheck{
+			Limit:    "memory",
+			Expected: strconv.FormatUint(expected, 10),
+			Actual:   formatCgroupLimit(cgroup.MemoryBytes),
+			Matches:  cgroup.MemoryBytes == expected || cgroup.MemoryBytes == expected/pageSize*pageSize,
+		})
+	}
+
+	if resources.Pids != nil && resources.Pids.Limit > 0 {
+		expected := uint64(resources.Pids.Limit)
+
+		checks = append(checks, models.LimitCheck{
+			Limit:    "pids",
+			Expected: strconv.FormatUint(expected, 10),
+			Actual:   formatCgroupLimit(cgroup.Pids),
+			Matches:  cgroup.Pids == expected,
+		})
+	}
+
+	if resources.CPU != nil && resources.CPU.Quota != nil && *resources.CPU.Quota > 0 {
+		quota := uint64(*resources.CPU.Quota)
+		period := uint64(100000)
+		if resources.CPU.Period != nil {
+			period = *resources.CPU.Period
+		}
+
+		actual := unlimited
+		if cgroup.CPUQuotaMicroseconds > 0 {
+			actual = formatCPU(cgroup.CPUQuotaMicroseconds, cgroup.CPUPeriodMicroseconds)
+		}
+
+		checks = append(checks, models.LimitCheck{
+			Limit:    "cpu",
+			Expected: formatCPU(quota, period),
+			Actual:   actual,
+			Matches:  cgroup.CPUQuotaMicroseconds == quota && cgroup.CPUPeriodMicroseconds == period,
+		})
+	}
+
+	return checks
+}
+
+func formatRlimit(l Rlimit) string {
+	return formatRlimitValue(l.Soft) + "/" + formatRlimitValue(l.Hard)
+}
+
+func formatRlimitValue(value uint64) string {
+	if value == math.MaxUint64 {
+		return unlimited
+	}
+
+	return strconv.FormatUint(value, 10)
+}
+
+func formatCgroupLimit(value uint64) string {
+	if value == 0 {
+		return unlimited
+	}
+
+	return strconv.FormatUint(value, 10)
+}
+
+func formatCPU(quota, period uint64) string {
+	return fmt.Sprintf("%dus/%dus", quota, period)
+}
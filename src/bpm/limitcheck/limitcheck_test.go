@@ -0,0 +1,111 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package limitcheck_test
+
+import (
+	"math"
+	"os"
+	"syscall"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+
+	"bpm/limitcheck"
+	"bpm/models"
+)
+
+var _ = Describe("ReadProcLimits", func() {
+	It("reads the resource limits of a process", func() {
+		var nofile syscall.Rlimit
+		Expect(syscall.Getrlimit(syscall.RLIMIT_NOFILE, &nofile)).To(Succeed())
+
+		limits, err := limitcheck.ReadProcLimits(os.Getpid())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(limits).To(HaveKeyWithValue("RLIMIT_NOFILE", limitcheck.Rlimit{Soft: nofile.Cur, Hard: nofile.Max}))
+		Expect(limits).To(HaveKey("RLIMIT_CORE"))
+		Expect(limits).To(HaveKey("RLIMIT_RTTIME"))
+	})
+})
+
+var _ = Describe("Compare", func() {
+	var (
+		spec    *specs.Spec
+		rlimits map[string]limitcheck.Rlimit
+		cgroup  *models.CgroupLimits
+	)
+
+	BeforeEach(func() {
+		memory := int64(128*1024*1024 + 100)
+		quota := int64(50000)
+		period := uint64(100000)
+
+		spec = &specs.Spec{
+			Process: &specs.Process{
+				Rlimits: []specs.POSIXRlimit{
+					{Type: "RLIMIT_NOFILE", Soft: 1024, Hard: 1024},
+					{Type: "RLIMIT_CORE", Soft: math.MaxUint64, Hard: math.MaxUint64},
+				},
+			},
+			Linux: &specs.Linux{
+				Resources: &specs.LinuxResources{
+					Memory: &specs.LinuxMemory{Limit: &memory},
+					Pids:   &specs.LinuxPids{Limit: 100},
+					CPU:    &specs.LinuxCPU{Quota: &quota, Period: &period},
+				},
+			},
+		}
+
+		rlimits = map[string]limitcheck.Rlimit{
+			"RLIMIT_NOFILE": {Soft: 1024, Hard: 1024},
+			"RLIMIT_CORE":   {Soft: math.MaxUint64, Hard: math.MaxUint64},
+		}
+
+		cgroup = &models.CgroupLimits{
+			MemoryBytes:           128 * 1024 * 1024,
+			Pids:                  100,
+			CPUQuotaMicroseconds:  50000,
+			CPUPeriodMicroseconds: 100000,
+		}
+	})
+
+	It("matches limits which the process has", func() {
+		Expect(limitcheck.Compare(spec, rlimits, cgroup)).To(Equal([]models.LimitCheck{
+			{Limit: "RLIMIT_NOFILE", Expected: "1024/1024", Actual: "1024/1024", Matches: true},
+			{Limit: "RLIMIT_CORE", Expected: "unlimited/unlimited", Actual: "unlimited/unlimited", Matches: true},
+			{Limit: "memory", Expected: "134217828", Actual: "134217728", Matches: true},
+			{Limit: "pids", Expected: "100", Actual: "100", Matches: true},
+			{Limit: "cpu", Expected: "50000us/100000us", Actual: "50000us/100000us", Matches: true},
+		}))
+	})
+
+	It("reports limits which differ from what was asked for", func() {
+		rlimits["RLIMIT_NOFILE"] = limitcheck.Rlimit{Soft: 1024, Hard: 4096}
+		delete(rlimits, "RLIMIT_CORE")
+		cgroup.Pids = 0
+		cgroup.CPUQuotaMicroseconds = 0
+
+		checks := limitcheck.Compare(spec, rlimits, cgroup)
+		Expect(checks).To(ContainElement(models.LimitCheck{Limit: "RLIMIT_NOFILE", Expected: "1024/1024", Actual: "1024/4096"}))
+		Expect(checks).To(ContainElement(models.LimitCheck{Limit: "RLIMIT_CORE", Expected: "unlimited/unlimited", Actual: "unknown"}))
+		Expect(checks).To(ContainElement(models.LimitCheck{Limit: "pids", Expected: "100", Actual: "unlimited"}))
+		Expect(checks).To(ContainElement(models.LimitCheck{Limit: "cpu", Expected: "50000us/100000us", Actual: "unlimited"}))
+	})
+
+	It("does not check limits which were not asked for", func() {
+		Expect(limitcheck.Compare(&specs.Spec{}, rlimits, cgroup)).To(BeEmpty())
+	})
+})
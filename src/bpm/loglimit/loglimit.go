@@ -0,0 +1,145 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+// Package loglimit protects downstream log shippers from processes which
+// write enormous lines by truncating every line to a maximum length before
+// it reaches the log files.
+package loglimit
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+
+	"bpm/config"
+	"bpm/logsink"
+)
+
+// TruncationMarker is appended to each line which was cut short. It contains
+// the number of bytes which were dropped.
+const TruncationMarker = "... [%d bytes truncated by bpm]"
+
+// Truncator is a writer which passes lines through to an underlying writer
+// unless they are longer than the maximum length, in which case the rest of
+// the line is replaced by TruncationMarker. It is not safe for concurrent
+// use.
+type Truncator struct {
+	w   io.Writer
+	max int
+
+	length      int
+	dropped     int
+	truncations int64
+	buf         []byte
+}
+
+// NewTruncator returns a Truncator which limits the lines written to w to max
+// bytes, not counting the newline.
+func NewTruncator(w io.Writer, max int) *Truncator {
+	return &Truncator{w: w, max: max}
+}
+
+// Write always consumes all of p unless the underlying writer fails. Bytes
+// which are truncated are counted as written.
+func (t *Truncator) Write(p []byte) (int, error) {
+	t.buf = t.buf[:0]
+
+	for rest := p; len(rest) > 0; {
+		i := bytes.IndexByte(rest, '\n')
+		if i < 0 {
+			t.appendLine(rest)
+			break
+		}
+
+		t.appendLine(rest[:i])
+		t.endLine()
+		rest = rest[i+1:]
+	}
+
+	if len(t.buf) > 0 {
+		if _, err := t.w.Write(t.buf); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(p), nil
+}
+
+// Close finishes a partial line which was truncated so that the marker is
+// not lost if the stream ends without a newline. It does not close the
+// underlying writer.
+func (t *Truncator) Close() error {
+	if t.dropped == 0 {
+		return nil
+	}
+
+	t.buf = t.buf[:0]
+	t.endLine()
+	_, err := t.w.Write(t.buf)
+	return err
+}
+
+// Truncations returns the number of lines which have been truncated so far.
+func (t *Truncator) Truncations() int64 {
+	return t.truncations
+}
+
+func (t *Truncator) appendLine(b []byte) {
+	room := t.max - t.length
+	if room < 0 {
+		room = 0
+	}
+	if room > len(b) {
+		room = len(b)
+	}
+
+	t.buf = append(t.buf, b[:room]...)
+	t.length += room
+	t.dropped += len(b) - room
+}
+
+func (t *Truncator) endLine() {
+	if t.dropped > 0 {
+		t.buf = append(t.buf, fmt.Sprintf(TruncationMarker, t.dropped)...)
+		t.truncations++
+	}
+	t.buf = append(t.buf, '\n')
+
+	t.length = 0
+	t.dropped = 0
+}
+
+// Limiter enforces the maximum line length on the output of a process.
+type Limiter struct {
+	maxLineLength int
+}
+
+// NewLimiter returns a Limiter which truncates lines longer than
+// maxLineLength bytes.
+func NewLimiter(maxLineLength int) *Limiter {
+	return &Limiter{maxLineLength: maxLineLength}
+}
+
+// Writer wraps a writer which bpm itself copies the output of a process into.
+func (l *Limiter) Writer(w io.Writer) *Truncator {
+	return NewTruncator(w, l.maxLineLength)
+}
+
+// Relay starts a helper which copies the output of a process into its log
+// sink for the stream, truncating long lines on the way. See logsink.Relay.
+func (l *Limiter) Relay(bpmCfg *config.BPMConfig, stream logsink.Stream) (*os.File, error) {
+	return logsink.Relay(bpmCfg, stream, l.maxLineLength)
+}
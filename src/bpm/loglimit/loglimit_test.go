@@ -0,0 +1,118 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package loglimit_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"bpm/loglimit"
+)
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+var _ = Describe("Truncator", func() {
+	var (
+		buf *bytes.Buffer
+		t   *loglimit.Truncator
+	)
+
+	BeforeEach(func() {
+		buf = &bytes.Buffer{}
+		t = loglimit.NewTruncator(buf, 10)
+	})
+
+	It("passes short lines through unchanged", func() {
+		n, err := t.Write([]byte("hello\nworld\n"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n).To(Equal(12))
+
+		Expect(buf.String()).To(Equal("hello\nworld\n"))
+		Expect(t.Truncations()).To(BeZero())
+	})
+
+	It("truncates long lines and marks them", func() {
+		n, err := t.Write([]byte("0123456789abcdef\nshort\n"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n).To(Equal(23))
+
+		Expect(buf.String()).To(Equal("0123456789" + fmt.Sprintf(loglimit.TruncationMarker, 6) + "\nshort\n"))
+		Expect(t.Truncations()).To(Equal(int64(1)))
+	})
+
+	It("does not truncate a line of exactly the maximum length", func() {
+		_, err := t.Write([]byte("0123456789\n"))
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(buf.String()).To(Equal("0123456789\n"))
+		Expect(t.Truncations()).To(BeZero())
+	})
+
+	It("counts the length of lines across writes", func() {
+		for _, chunk := range []string{"0123", "4567", "89ab", "cdef", "\n"} {
+			_, err := t.Write([]byte(chunk))
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		Expect(buf.String()).To(Equal("0123456789" + fmt.Sprintf(loglimit.TruncationMarker, 6) + "\n"))
+		Expect(t.Truncations()).To(Equal(int64(1)))
+	})
+
+	It("copes with very long lines", func() {
+		line := strings.Repeat("x", 1024*1024)
+		_, err := t.Write([]byte(line + "\n" + line + "\n"))
+		Expect(err).NotTo(HaveOccurred())
+
+		truncated := "xxxxxxxxxx" + fmt.Sprintf(loglimit.TruncationMarker, 1024*1024-10) + "\n"
+		Expect(buf.String()).To(Equal(truncated + truncated))
+		Expect(t.Truncations()).To(Equal(int64(2)))
+	})
+
+	Describe("Close", func() {
+		It("marks a truncated line which was never finished", func() {
+			_, err := t.Write([]byte("0123456789abc"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(t.Close()).To(Succeed())
+
+			Expect(buf.String()).To(Equal("0123456789" + fmt.Sprintf(loglimit.TruncationMarker, 3) + "\n"))
+		})
+
+		It("leaves an unfinished short line alone", func() {
+			_, err := t.Write([]byte("01234"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(t.Close()).To(Succeed())
+
+			Expect(buf.String()).To(Equal("01234"))
+		})
+	})
+
+	Context("when the underlying writer fails", func() {
+		It("returns the error", func() {
+			t = loglimit.NewTruncator(failingWriter{}, 10)
+			_, err := t.Write([]byte("hello\n"))
+			Expect(err).To(MatchError("disk full"))
+		})
+	})
+})
@@ -0,0 +1,199 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package logsink
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"code.cloudfoundry.org/bytefmt"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+
+	"bpm/config"
+	"bpm/units"
+)
+
+const (
+	DefaultRotateMaxSize  = 100 * bytefmt.MEGABYTE
+	DefaultRotateMaxFiles = 5
+)
+
+func init() {
+	Register("file", newFileSink)
+	Register("rotating_file", newRotatingFileSink)
+}
+
+// fileSink appends to the process's log files in /var/vcap/sys/log. Log
+// rotation is left to the stemcell.
+type fileSink struct{}
+
+func newFileSink(options map[string]string) (Sink, error) {
+	if err := checkOptions(options); err != nil {
+		return nil, err
+	}
+
+	return fileSink{}, nil
+}
+
+func (fileSink) Open(bpmCfg *config.BPMConfig, stream Stream, user specs.User) (io.WriteCloser, error) {
+	path, err := logPath(bpmCfg, stream)
+	if err != nil {
+		return nil, err
+	}
+
+	return createFileFor(path, int(user.UID), int(user.GID))
+}
+
+// rotatingFileSink writes to the same log files as fileSink but rotates them
+// itself once they reach a maximum size. Up to maxFiles old files are kept
+// with the suffixes .1 (the newest) to .N.
+type rotatingFileSink struct {
+	maxSize  int64
+	maxFiles int
+}
+
+func newRotatingFileSink(options map[string]string) (Sink, error) {
+	if err := checkOptions(options, "max_size", "max_files"); err != nil {
+		return nil, err
+	}
+
+	sink := rotatingFileSink{
+		maxSize:  DefaultRotateMaxSize,
+		maxFiles: DefaultRotateMaxFiles,
+	}
+
+	if s, ok := options["max_size"]; ok {
+		size, err := units.ParseSize(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid max_size: %s", err)
+		}
+		sink.maxSize = int64(size)
+	}
+
+	if s, ok := options["max_files"]; ok {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid max_files: must be a positive integer but got %q", s)
+		}
+		sink.maxFiles = n
+	}
+
+	return sink, nil
+}
+
+func (s rotatingFileSink) Open(bpmCfg *config.BPMConfig, stream Stream, user specs.User) (io.WriteCloser, error) {
+	path, err := logPath(bpmCfg, stream)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &rotatingWriter{
+		path:     path,
+		uid:      int(user.UID),
+		gid:      int(user.GID),
+		maxSize:  s.maxSize,
+		maxFiles: s.maxFiles,
+	}
+
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+type rotatingWriter struct {
+	path     string
+	uid, gid int
+	maxSize  int64
+	maxFiles int
+
+	f    *os.File
+	size int64
+}
+
+func (w *rotatingWriter) Write(p []byte) (int, error) {
+	if w.size > 0 && w.size+int64(len(p)) > w.maxSize {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := w.f.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+func (w *rotatingWriter) Close() error {
+	return w.f.Close()
+}
+
+func (w *rotatingWriter) open() error {
+	f, err := createFileFor(w.path, w.uid, w.gid)
+	if err != nil {
+		return err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	w.f = f
+	w.size = info.Size()
+	return nil
+}
+
+func (w *rotatingWriter) rotate() error {
+	if err := w.f.Close(); err != nil {
+		return err
+	}
+
+	for i := w.maxFiles - 1; i > 0; i-- {
+		err := os.Rename(rotatedPath(w.path, i), rotatedPath(w.path, i+1))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	if err := os.Rename(w.path, rotatedPath(w.path, 1)); err != nil {
+		return err
+	}
+
+	return w.open()
+}
+
+func rotatedPath(path string, n int) string {
+	return fmt.Sprintf("%s.%d", path, n)
+}
+
+func createFileFor(path string, uid, gid int) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.Chown(path, uid, gid)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return f, nil
+}
@@ -0,0 +1,122 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package logsink
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+
+	"bpm/config"
+)
+
+// DefaultJournalSocket is where systemd-journald receives native messages.
+const DefaultJournalSocket = "/run/systemd/journal/socket"
+
+func init() {
+	Register("journald", newJournaldSink)
+}
+
+// journaldSink sends each line of output to the systemd journal with the
+// job, process, and stream attached as BPM_JOB, BPM_PROCESS, and BPM_STREAM
+// fields so that they can be filtered with journalctl.
+type journaldSink struct {
+	socket  string
+	options map[string]string
+}
+
+func newJournaldSink(options map[string]string) (Sink, error) {
+	if err := checkOptions(options, "socket", "tag"); err != nil {
+		return nil, err
+	}
+
+	socket := options["socket"]
+	if socket == "" {
+		socket = DefaultJournalSocket
+	}
+
+	return journaldSink{socket: socket, options: options}, nil
+}
+
+func (s journaldSink) Open(bpmCfg *config.BPMConfig, stream Stream, _ specs.User) (io.WriteCloser, error) {
+	conn, err := net.Dial("unixgram", s.socket)
+	if err != nil {
+		return nil, err
+	}
+
+	priority := "6"
+	if stream == Stderr {
+		priority = "3"
+	}
+
+	return newLineWriter(&journalWriter{
+		conn: conn,
+		fields: [][2]string{
+			{"PRIORITY", priority},
+			{"SYSLOG_IDENTIFIER", tag(bpmCfg, s.options)},
+			{"BPM_JOB", bpmCfg.JobName()},
+			{"BPM_PROCESS", bpmCfg.ProcName()},
+			{"BPM_STREAM", string(stream)},
+		},
+	}), nil
+}
+
+// journalWriter sends every write as one message in journald's native
+// protocol.
+type journalWriter struct {
+	conn   net.Conn
+	fields [][2]string
+}
+
+func (j *journalWriter) Write(p []byte) (int, error) {
+	var msg bytes.Buffer
+	writeJournalField(&msg, "MESSAGE", string(p))
+	for _, f := range j.fields {
+		writeJournalField(&msg, f[0], f[1])
+	}
+
+	if _, err := j.conn.Write(msg.Bytes()); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+func (j *journalWriter) Close() error {
+	return j.conn.Close()
+}
+
+// writeJournalField uses the binary form for values containing newlines and
+// the simpler NAME=VALUE form otherwise.
+func writeJournalField(buf *bytes.Buffer, name, value string) {
+	buf.WriteString(name)
+
+	if !strings.Contains(value, "\n") {
+		buf.WriteByte('=')
+		buf.WriteString(value)
+		buf.WriteByte('\n')
+		return
+	}
+
+	buf.WriteByte('\n')
+	binary.Write(buf, binary.LittleEndian, uint64(len(value)))
+	buf.WriteString(value)
+	buf.WriteByte('\n')
+}
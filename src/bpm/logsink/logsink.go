@@ -0,0 +1,210 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+// Package logsink provides the backends which the stdout and stderr of a
+// process can be written to. A backend is chosen for each process by the
+// log_sink setting in its job configuration and new backends only need to
+// register themselves here.
+package logsink
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+
+	"bpm/config"
+	"bpm/helpers"
+)
+
+// Stream identifies which of a process's output streams is being written.
+type Stream string
+
+const (
+	Stdout Stream = "stdout"
+	Stderr Stream = "stderr"
+)
+
+// DefaultType is used for processes which do not choose a sink.
+const DefaultType = "file"
+
+// Sink is a backend which the output of processes is written to.
+type Sink interface {
+	// Open returns a writer for one stream of a process. Writers which are
+	// *os.File are given to the process directly; everything else is fed
+	// by a relay (see Relay). The user is the one the process runs as.
+	Open(bpmCfg *config.BPMConfig, stream Stream, user specs.User) (io.WriteCloser, error)
+}
+
+// Factory creates a sink from the options given in the job configuration.
+// It should reject options which it does not understand.
+type Factory func(options map[string]string) (Sink, error)
+
+var factories = map[string]Factory{}
+
+// Register makes a backend available under the name. It is intended to be
+// called from the init function of the file which implements the backend.
+func Register(name string, factory Factory) {
+	if _, ok := factories[name]; ok {
+		panic(fmt.Sprintf("log sink %q registered twice", name))
+	}
+
+	factories[name] = factory
+}
+
+// Types returns the names of the registered backends.
+func Types() []string {
+	types := make([]string, 0, len(factories))
+	for name := range factories {
+		types = append(types, name)
+	}
+	sort.Strings(types)
+
+	return types
+}
+
+// New returns the sink which cfg selects. A nil cfg selects DefaultType.
+func New(cfg *config.LogSink) (Sink, error) {
+	name, options := DefaultType, map[string]string(nil)
+	if cfg != nil {
+		name, options = cfg.Type, cfg.Options
+	}
+
+	factory, ok := factories[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown log sink %q (must be one of %s)", name, strings.Join(Types(), ", "))
+	}
+
+	sink, err := factory(options)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s log sink: %s", name, err)
+	}
+
+	return sink, nil
+}
+
+// Open opens the stream of a process with the sink which cfg selects.
+func Open(bpmCfg *config.BPMConfig, cfg *config.LogSink, stream Stream, user specs.User) (io.WriteCloser, error) {
+	sink, err := New(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return sink.Open(bpmCfg, stream, user)
+}
+
+// Direct returns the file behind w if it can be given to a process directly.
+func Direct(w io.Writer) (*os.File, bool) {
+	f, ok := w.(*os.File)
+	return f, ok
+}
+
+// Relay starts a helper which copies everything written to the returned file
+// into the process's sink for the stream, truncating lines longer than
+// maxLineLength bytes on the way if it is positive. The process's container
+// is handed the file directly when it is started in the background, so the
+// copying needs to continue after bpm has exited. The helper is a separate
+// bpm process which exits once every copy of the file has been closed.
+func Relay(bpmCfg *config.BPMConfig, stream Stream, maxLineLength int) (*os.File, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	cmd := exec.Command(
+		executable,
+		"log-relay", bpmCfg.JobName(),
+		"--process", bpmCfg.ProcName(),
+		"--stream", string(stream),
+		"--max-line-length", strconv.Itoa(maxLineLength),
+	)
+	cmd.Stdin = r
+	// The helper must not be killed along with bpm if it is interrupted
+	// after the process has started.
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+
+	if err := cmd.Start(); err != nil {
+		w.Close()
+		return nil, fmt.Errorf("failed to start log relay: %s", err)
+	}
+
+	if err := helpers.Register(bpmCfg.HelpersDir().External(), "log-relay", cmd.Process.Pid); err != nil {
+		// A relay which could not be recorded would never be stopped.
+		w.Close()
+		cmd.Process.Kill()
+		cmd.Wait()
+		return nil, err
+	}
+
+	if err := cmd.Process.Release(); err != nil {
+		w.Close()
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// checkOptions returns an error if any of the options is not one of the
+// allowed names.
+func checkOptions(options map[string]string, allowed ...string) error {
+	for name := range options {
+		known := false
+		for _, a := range allowed {
+			if name == a {
+				known = true
+				break
+			}
+		}
+
+		if !known {
+			return fmt.Errorf("unknown option %q", name)
+		}
+	}
+
+	return nil
+}
+
+// tag returns the name which a process's lines are labelled with in shared
+// logging systems unless the configuration chooses another.
+func tag(bpmCfg *config.BPMConfig, options map[string]string) string {
+	if t := options["tag"]; t != "" {
+		return t
+	}
+
+	return bpmCfg.JobName() + "/" + bpmCfg.ProcName()
+}
+
+func logPath(bpmCfg *config.BPMConfig, stream Stream) (string, error) {
+	switch stream {
+	case Stdout:
+		return bpmCfg.Stdout().External(), nil
+	case Stderr:
+		return bpmCfg.Stderr().External(), nil
+	default:
+		return "", fmt.Errorf("invalid stream: %q", stream)
+	}
+}
@@ -0,0 +1,256 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package logsink_test
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+
+	"bpm/bosh"
+	"bpm/config"
+	"bpm/logsink"
+)
+
+var _ = Describe("Logsink", func() {
+	var (
+		root   string
+		bpmCfg *config.BPMConfig
+		user   specs.User
+	)
+
+	BeforeEach(func() {
+		var err error
+		root, err = ioutil.TempDir("", "logsink")
+		Expect(err).NotTo(HaveOccurred())
+
+		bpmCfg = config.NewBPMConfig(bosh.NewEnv(root), "example", "server")
+		Expect(os.MkdirAll(bpmCfg.LogDir().External(), 0700)).To(Succeed())
+
+		user = specs.User{UID: uint32(os.Getuid()), GID: uint32(os.Getgid())}
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(root)).To(Succeed())
+	})
+
+	open := func(sinkCfg *config.LogSink, stream logsink.Stream) *closingWriter {
+		w, err := logsink.Open(bpmCfg, sinkCfg, stream, user)
+		Expect(err).NotTo(HaveOccurred())
+		return &closingWriter{w}
+	}
+
+	Describe("New", func() {
+		It("uses the file sink when none is configured", func() {
+			w, err := logsink.Open(bpmCfg, nil, logsink.Stdout, user)
+			Expect(err).NotTo(HaveOccurred())
+			defer w.Close()
+
+			f, ok := logsink.Direct(w)
+			Expect(ok).To(BeTrue())
+			Expect(f.Name()).To(Equal(bpmCfg.Stdout().External()))
+		})
+
+		It("rejects sinks which are not registered", func() {
+			_, err := logsink.New(&config.LogSink{Type: "carrier-pigeon"})
+			Expect(err).To(MatchError(ContainSubstring(`unknown log sink "carrier-pigeon"`)))
+			Expect(err).To(MatchError(ContainSubstring(strings.Join(logsink.Types(), ", "))))
+		})
+
+		It("rejects options which the sink does not understand", func() {
+			_, err := logsink.New(&config.LogSink{
+				Type:    "file",
+				Options: map[string]string{"max_size": "1M"},
+			})
+			Expect(err).To(MatchError(`invalid file log sink: unknown option "max_size"`))
+		})
+	})
+
+	Describe("file", func() {
+		It("appends to the log file of the stream", func() {
+			Expect(ioutil.WriteFile(bpmCfg.Stderr().External(), []byte("old\n"), 0600)).To(Succeed())
+
+			w := open(&config.LogSink{Type: "file"}, logsink.Stderr)
+			w.write("new\n")
+			w.close()
+
+			contents, err := ioutil.ReadFile(bpmCfg.Stderr().External())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(contents)).To(Equal("old\nnew\n"))
+
+			info, err := os.Stat(bpmCfg.Stderr().External())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.Mode() & os.ModePerm).To(Equal(os.FileMode(0600)))
+		})
+	})
+
+	Describe("rotating_file", func() {
+		It("rotates the log file once it reaches the maximum size", func() {
+			w := open(&config.LogSink{
+				Type:    "rotating_file",
+				Options: map[string]string{"max_size": "10B", "max_files": "2"},
+			}, logsink.Stdout)
+
+			_, ok := logsink.Direct(w.WriteCloser)
+			Expect(ok).To(BeFalse())
+
+			for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+				w.write(line)
+			}
+			w.close()
+
+			path := bpmCfg.Stdout().External()
+			Expect(ioutil.ReadFile(path)).To(Equal([]byte("fourth\n")))
+			Expect(ioutil.ReadFile(path + ".1")).To(Equal([]byte("third\n")))
+			Expect(ioutil.ReadFile(path + ".2")).To(Equal([]byte("second\n")))
+			Expect(path + ".3").NotTo(BeAnExistingFile())
+		})
+
+		It("rejects invalid limits", func() {
+			_, err := logsink.New(&config.LogSink{
+				Type:    "rotating_file",
+				Options: map[string]string{"max_files": "0"},
+			})
+			Expect(err).To(MatchError(ContainSubstring("invalid max_files")))
+
+			_, err = logsink.New(&config.LogSink{
+				Type:    "rotating_file",
+				Options: map[string]string{"max_size": "lots"},
+			})
+			Expect(err).To(MatchError(ContainSubstring("invalid max_size")))
+		})
+	})
+
+	Describe("syslog", func() {
+		It("sends each line to the syslog server with the severity of the stream", func() {
+			conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+			Expect(err).NotTo(HaveOccurred())
+			defer conn.Close()
+
+			w := open(&config.LogSink{
+				Type: "syslog",
+				Options: map[string]string{
+					"address":  "udp://" + conn.LocalAddr().String(),
+					"facility": "local3",
+				},
+			}, logsink.Stderr)
+			w.write("hello\nwor")
+			w.write("ld\n")
+			w.close()
+
+			// local3 (19) * 8 + err (3) = 155
+			Expect(readPacket(conn)).To(SatisfyAll(
+				HavePrefix("<155>"),
+				ContainSubstring("example/server"),
+				HaveSuffix("hello\n"),
+			))
+			Expect(readPacket(conn)).To(HaveSuffix("world\n"))
+		})
+
+		It("rejects addresses which are not udp or tcp URLs", func() {
+			_, err := logsink.New(&config.LogSink{
+				Type:    "syslog",
+				Options: map[string]string{"address": "localhost:514"},
+			})
+			Expect(err).To(MatchError(ContainSubstring("invalid address")))
+		})
+
+		It("rejects unknown facilities", func() {
+			_, err := logsink.New(&config.LogSink{
+				Type:    "syslog",
+				Options: map[string]string{"facility": "local9"},
+			})
+			Expect(err).To(MatchError(ContainSubstring("invalid facility")))
+		})
+	})
+
+	Describe("journald", func() {
+		It("sends each line to the journal with the job and process attached", func() {
+			socket := filepath.Join(root, "journal.sock")
+			conn, err := net.ListenPacket("unixgram", socket)
+			Expect(err).NotTo(HaveOccurred())
+			defer conn.Close()
+
+			w := open(&config.LogSink{
+				Type:    "journald",
+				Options: map[string]string{"socket": socket},
+			}, logsink.Stdout)
+			w.write("hello\n")
+			w.write("partial")
+			w.close()
+
+			Expect(readPacket(conn)).To(Equal(strings.Join([]string{
+				"MESSAGE=hello",
+				"PRIORITY=6",
+				"SYSLOG_IDENTIFIER=example/server",
+				"BPM_JOB=example",
+				"BPM_PROCESS=server",
+				"BPM_STREAM=stdout",
+				"",
+			}, "\n")))
+			Expect(readPacket(conn)).To(HavePrefix("MESSAGE=partial\n"))
+		})
+	})
+
+	Describe("pipe", func() {
+		It("writes the output to the stdin of the command", func() {
+			out := filepath.Join(root, "piped")
+
+			w := open(&config.LogSink{
+				Type:    "pipe",
+				Options: map[string]string{"command": `(echo "$BPM_JOB $BPM_PROCESS $BPM_STREAM"; cat) > ` + out},
+			}, logsink.Stderr)
+			w.write("hello\n")
+			w.close()
+
+			Expect(ioutil.ReadFile(out)).To(Equal([]byte("example server stderr\nhello\n")))
+		})
+
+		It("requires a command", func() {
+			_, err := logsink.New(&config.LogSink{Type: "pipe"})
+			Expect(err).To(MatchError("invalid pipe log sink: command must be set"))
+		})
+	})
+})
+
+type closingWriter struct {
+	io.WriteCloser
+}
+
+func (c *closingWriter) write(s string) {
+	_, err := c.Write([]byte(s))
+	ExpectWithOffset(1, err).NotTo(HaveOccurred())
+}
+
+func (c *closingWriter) close() {
+	ExpectWithOffset(1, c.Close()).To(Succeed())
+}
+
+func readPacket(conn net.PacketConn) string {
+	buf := make([]byte, 64*1024)
+	ExpectWithOffset(1, conn.SetReadDeadline(time.Now().Add(5*time.Second))).To(Succeed())
+	n, _, err := conn.ReadFrom(buf)
+	ExpectWithOffset(1, err).NotTo(HaveOccurred())
+	return string(buf[:n])
+}
@@ -0,0 +1,89 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package logsink
+
+import (
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+
+	"bpm/config"
+)
+
+func init() {
+	Register("pipe", newPipeSink)
+}
+
+// pipeSink starts a command for each stream and writes the output of the
+// process to its stdin. This allows log shippers which bpm has no backend
+// for to be used. The command is run by /bin/sh with BPM_JOB, BPM_PROCESS,
+// and BPM_STREAM set in its environment.
+type pipeSink struct {
+	command string
+}
+
+func newPipeSink(options map[string]string) (Sink, error) {
+	if err := checkOptions(options, "command"); err != nil {
+		return nil, err
+	}
+
+	if options["command"] == "" {
+		return nil, errors.New("command must be set")
+	}
+
+	return pipeSink{command: options["command"]}, nil
+}
+
+func (s pipeSink) Open(bpmCfg *config.BPMConfig, stream Stream, _ specs.User) (io.WriteCloser, error) {
+	cmd := exec.Command("/bin/sh", "-c", s.command)
+	cmd.Env = append(
+		os.Environ(),
+		"BPM_JOB="+bpmCfg.JobName(),
+		"BPM_PROCESS="+bpmCfg.ProcName(),
+		"BPM_STREAM="+string(stream),
+	)
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	return &pipeWriter{WriteCloser: stdin, cmd: cmd}, nil
+}
+
+// pipeWriter waits for the command to finish once its input is closed so
+// that nothing it has buffered is lost.
+type pipeWriter struct {
+	io.WriteCloser
+	cmd *exec.Cmd
+}
+
+func (p *pipeWriter) Close() error {
+	closeErr := p.WriteCloser.Close()
+
+	if err := p.cmd.Wait(); err != nil {
+		return err
+	}
+
+	return closeErr
+}
@@ -0,0 +1,148 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package logsink
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/syslog"
+	"net/url"
+	"strings"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+
+	"bpm/config"
+)
+
+func init() {
+	Register("syslog", newSyslogSink)
+}
+
+var syslogFacilities = map[string]syslog.Priority{
+	"kern":     syslog.LOG_KERN,
+	"user":     syslog.LOG_USER,
+	"mail":     syslog.LOG_MAIL,
+	"daemon":   syslog.LOG_DAEMON,
+	"auth":     syslog.LOG_AUTH,
+	"syslog":   syslog.LOG_SYSLOG,
+	"lpr":      syslog.LOG_LPR,
+	"news":     syslog.LOG_NEWS,
+	"uucp":     syslog.LOG_UUCP,
+	"cron":     syslog.LOG_CRON,
+	"authpriv": syslog.LOG_AUTHPRIV,
+	"ftp":      syslog.LOG_FTP,
+	"local0":   syslog.LOG_LOCAL0,
+	"local1":   syslog.LOG_LOCAL1,
+	"local2":   syslog.LOG_LOCAL2,
+	"local3":   syslog.LOG_LOCAL3,
+	"local4":   syslog.LOG_LOCAL4,
+	"local5":   syslog.LOG_LOCAL5,
+	"local6":   syslog.LOG_LOCAL6,
+	"local7":   syslog.LOG_LOCAL7,
+}
+
+// syslogSink sends each line of output as a syslog message, either to the
+// local syslog daemon or to the address given as udp://HOST:PORT or
+// tcp://HOST:PORT. Lines from stdout are logged as informational and lines
+// from stderr as errors.
+type syslogSink struct {
+	network, address string
+	facility         syslog.Priority
+	options          map[string]string
+}
+
+func newSyslogSink(options map[string]string) (Sink, error) {
+	if err := checkOptions(options, "address", "facility", "tag"); err != nil {
+		return nil, err
+	}
+
+	sink := syslogSink{facility: syslog.LOG_USER, options: options}
+
+	if a := options["address"]; a != "" {
+		u, err := url.Parse(a)
+		if err != nil || (u.Scheme != "udp" && u.Scheme != "tcp") || u.Host == "" {
+			return nil, fmt.Errorf("invalid address: must be udp://HOST:PORT or tcp://HOST:PORT but got %q", a)
+		}
+		sink.network, sink.address = u.Scheme, u.Host
+	}
+
+	if f := options["facility"]; f != "" {
+		facility, ok := syslogFacilities[strings.ToLower(f)]
+		if !ok {
+			return nil, fmt.Errorf("invalid facility: %q", f)
+		}
+		sink.facility = facility
+	}
+
+	return sink, nil
+}
+
+func (s syslogSink) Open(bpmCfg *config.BPMConfig, stream Stream, _ specs.User) (io.WriteCloser, error) {
+	severity := syslog.LOG_INFO
+	if stream == Stderr {
+		severity = syslog.LOG_ERR
+	}
+
+	w, err := syslog.Dial(s.network, s.address, s.facility|severity, tag(bpmCfg, s.options))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to syslog: %s", err)
+	}
+
+	return newLineWriter(w), nil
+}
+
+// lineWriter buffers partial lines so that every line written to it is
+// passed on in a single call, which is what message based backends need.
+// A trailing partial line is passed on when the writer is closed.
+type lineWriter struct {
+	w   io.WriteCloser
+	buf []byte
+}
+
+func newLineWriter(w io.WriteCloser) *lineWriter {
+	return &lineWriter{w: w}
+}
+
+func (l *lineWriter) Write(p []byte) (int, error) {
+	l.buf = append(l.buf, p...)
+
+	for {
+		i := bytes.IndexByte(l.buf, '\n')
+		if i < 0 {
+			break
+		}
+
+		if _, err := l.w.Write(l.buf[:i]); err != nil {
+			return 0, err
+		}
+		l.buf = l.buf[i+1:]
+	}
+
+	return len(p), nil
+}
+
+func (l *lineWriter) Close() error {
+	if len(l.buf) > 0 {
+		if _, err := l.w.Write(l.buf); err != nil {
+			l.w.Close()
+			return err
+		}
+		l.buf = nil
+	}
+
+	return l.w.Close()
+}
@@ -0,0 +1,242 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+// Package logwindow finds where a window of lines starts in a log file by
+// reading it backwards from the end, so that showing the last few lines or
+// the last few minutes of an enormous log does not mean reading all of it.
+package logwindow
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const chunkSize = 64 * 1024
+
+// ErrNoTimestamps is returned by Since when none of the lines of a log start
+// with a timestamp which it recognises.
+var ErrNoTimestamps = errors.New("no lines start with a timestamp")
+
+// LastLines returns the offset of the start of the last n lines of the first
+// size bytes of r. A final line without a newline counts as a line.
+func LastLines(r io.ReaderAt, size int64, n int) (int64, error) {
+	if n <= 0 {
+		return size, nil
+	}
+
+	offset := int64(0)
+	count := 0
+	err := eachLineBackwards(r, size, func(start int64, _ []byte) bool {
+		count++
+		if count == n {
+			offset = start
+			return false
+		}
+		return true
+	})
+
+	return offset, err
+}
+
+// Since returns the offset of the first line of the first size bytes of r
+// which was written at or after t. Lines without a timestamp of their own
+// (such as those of a stack trace) are treated as having been written at the
+// same time as the closest timestamped line before them.
+func Since(r io.ReaderAt, size int64, t time.Time) (int64, error) {
+	if size == 0 {
+		return 0, nil
+	}
+
+	var (
+		offset = size
+		found  bool
+		older  bool
+	)
+
+	err := eachLineBackwards(r, size, func(start int64, line []byte) bool {
+		ts, ok := Timestamp(line)
+		if !ok {
+			return true
+		}
+		found = true
+
+		if ts.Before(t) {
+			older = true
+			return false
+		}
+
+		offset = start
+		return true
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if !found {
+		return 0, ErrNoTimestamps
+	}
+
+	if !older {
+		// Everything was written after t, including any lines before the
+		// first timestamp.
+		return 0, nil
+	}
+
+	return offset, nil
+}
+
+// eachLineBackwards calls fn with each line of the first size bytes of r,
+// and the offset that it starts at, starting with the last line. It stops
+// early if fn returns false.
+func eachLineBackwards(r io.ReaderAt, size int64, fn func(start int64, line []byte) bool) error {
+	pos := size
+
+	// pending holds the bytes from pos up to the end of the lines which
+	// have not been passed to fn yet.
+	var pending []byte
+
+	for {
+		if len(pending) > 0 {
+			i := bytes.LastIndexByte(pending[:len(pending)-1], '\n')
+			if i >= 0 {
+				if !fn(pos+int64(i)+1, pending[i+1:]) {
+					return nil
+				}
+				pending = pending[:i+1]
+				continue
+			}
+		}
+
+		if pos == 0 {
+			if len(pending) > 0 {
+				fn(0, pending)
+			}
+			return nil
+		}
+
+		n := int64(chunkSize)
+		if n > pos {
+			n = pos
+		}
+		pos -= n
+
+		chunk := make([]byte, n, n+int64(len(pending)))
+		if _, err := r.ReadAt(chunk, pos); err != nil && err != io.EOF {
+			return err
+		}
+		pending = append(chunk, pending...)
+	}
+}
+
+var layouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04:05Z07:00",
+}
+
+// Timestamp returns the time at the start of a log line. It recognises
+// RFC 3339 timestamps (optionally in square brackets or with a space rather
+// than a T) and the timestamp field of JSON lines such as those written by
+// lager. Times without a zone are taken to be local.
+func Timestamp(line []byte) (time.Time, bool) {
+	line = bytes.TrimSpace(line)
+	if len(line) > 0 && line[0] == '{' {
+		return jsonTimestamp(line)
+	}
+
+	if len(line) > 64 {
+		line = line[:64]
+	}
+	fields := strings.Fields(strings.TrimPrefix(string(line), "["))
+	if len(fields) == 0 {
+		return time.Time{}, false
+	}
+
+	candidates := []string{fields[0]}
+	if len(fields) > 1 {
+		candidates = append(candidates, fields[0]+" "+fields[1])
+	}
+
+	for _, c := range candidates {
+		c = strings.TrimRight(c, "]")
+		for _, layout := range layouts {
+			if t, err := time.ParseInLocation(layout, c, time.Local); err == nil {
+				return t, true
+			}
+		}
+	}
+
+	return time.Time{}, false
+}
+
+func jsonTimestamp(line []byte) (time.Time, bool) {
+	var entry struct {
+		Timestamp interface{} `json:"timestamp"`
+		Time      interface{} `json:"time"`
+	}
+	if err := json.Unmarshal(line, &entry); err != nil {
+		return time.Time{}, false
+	}
+
+	value := entry.Timestamp
+	if value == nil {
+		value = entry.Time
+	}
+
+	switch v := value.(type) {
+	case float64:
+		return unixTime(strconv.FormatFloat(v, 'f', -1, 64))
+	case string:
+		if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+			return t, true
+		}
+		return unixTime(v)
+	default:
+		return time.Time{}, false
+	}
+}
+
+// unixTime parses seconds since the epoch with an optional fraction, as
+// written by lager, without losing the nanoseconds to a float.
+func unixTime(s string) (time.Time, bool) {
+	secs, frac := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		secs, frac = s[:i], s[i+1:]
+	}
+
+	sec, err := strconv.ParseInt(secs, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	var nsec int64
+	if frac != "" {
+		if len(frac) > 9 {
+			frac = frac[:9]
+		}
+		frac += strings.Repeat("0", 9-len(frac))
+		if nsec, err = strconv.ParseInt(frac, 10, 64); err != nil {
+			return time.Time{}, false
+		}
+	}
+
+	return time.Unix(sec, nsec), true
+}
@@ -0,0 +1,139 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package logwindow_test
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+
+	"bpm/logwindow"
+)
+
+var _ = Describe("LastLines", func() {
+	lastLines := func(log string, n int) string {
+		r := strings.NewReader(log)
+		offset, err := logwindow.LastLines(r, r.Size(), n)
+		Expect(err).NotTo(HaveOccurred())
+		return log[offset:]
+	}
+
+	It("finds the start of the last lines", func() {
+		Expect(lastLines("one\ntwo\nthree\n", 2)).To(Equal("two\nthree\n"))
+	})
+
+	It("counts a final line without a newline", func() {
+		Expect(lastLines("one\ntwo\nthree", 2)).To(Equal("two\nthree"))
+	})
+
+	It("returns the whole log when it has fewer lines", func() {
+		Expect(lastLines("one\ntwo\n", 5)).To(Equal("one\ntwo\n"))
+		Expect(lastLines("", 5)).To(Equal(""))
+	})
+
+	It("returns nothing when no lines are wanted", func() {
+		Expect(lastLines("one\ntwo\n", 0)).To(Equal(""))
+	})
+
+	It("finds lines across many chunks", func() {
+		line := strings.Repeat("x", 1000) + "\n"
+		log := strings.Repeat(line, 200)
+		Expect(lastLines(log, 150)).To(Equal(strings.Repeat(line, 150)))
+	})
+
+	It("handles lines longer than a chunk", func() {
+		long := strings.Repeat("y", 200*1024) + "\n"
+		Expect(lastLines("short\n"+long, 1)).To(Equal(long))
+	})
+})
+
+var _ = Describe("Since", func() {
+	base := time.Date(2021, 3, 4, 10, 0, 0, 0, time.UTC)
+
+	at := func(minute int) string {
+		return base.Add(time.Duration(minute) * time.Minute).Format(time.RFC3339)
+	}
+
+	since := func(log string, minute int) (string, error) {
+		r := strings.NewReader(log)
+		offset, err := logwindow.Since(r, r.Size(), base.Add(time.Duration(minute)*time.Minute))
+		if err != nil {
+			return "", err
+		}
+		return log[offset:], nil
+	}
+
+	It("finds the first line written at or after the time", func() {
+		log := fmt.Sprintf("%s one\n%s two\n%s three\n", at(0), at(5), at(10))
+
+		Expect(since(log, 5)).To(Equal(fmt.Sprintf("%s two\n%s three\n", at(5), at(10))))
+		Expect(since(log, 11)).To(BeEmpty())
+		Expect(since(log, -1)).To(Equal(log))
+	})
+
+	It("keeps lines without timestamps with the line before them", func() {
+		log := fmt.Sprintf("%s panic\n\tstack\n%s recovered\n\tstack\n", at(0), at(5))
+
+		Expect(since(log, 3)).To(Equal(fmt.Sprintf("%s recovered\n\tstack\n", at(5))))
+	})
+
+	It("includes untimestamped lines at the start when everything is newer", func() {
+		log := fmt.Sprintf("starting\n%s one\n", at(5))
+
+		Expect(since(log, 0)).To(Equal(log))
+	})
+
+	It("returns an error when no line has a timestamp", func() {
+		_, err := since("one\ntwo\n", 0)
+		Expect(err).To(Equal(logwindow.ErrNoTimestamps))
+	})
+
+	It("returns nothing for an empty log", func() {
+		Expect(since("", 0)).To(BeEmpty())
+	})
+})
+
+var _ = Describe("Timestamp", func() {
+	DescribeTable("recognised timestamps",
+		func(line string, expected time.Time) {
+			t, ok := logwindow.Timestamp([]byte(line))
+			Expect(ok).To(BeTrue())
+			Expect(t.Equal(expected)).To(BeTrue(), "got %s", t)
+		},
+		Entry("RFC 3339", "2021-03-04T10:00:00Z message", time.Date(2021, 3, 4, 10, 0, 0, 0, time.UTC)),
+		Entry("RFC 3339 with nanoseconds", "2021-03-04T10:00:00.5+01:00 message", time.Date(2021, 3, 4, 9, 0, 0, 5e8, time.UTC)),
+		Entry("in brackets", "[2021-03-04T10:00:00Z] message", time.Date(2021, 3, 4, 10, 0, 0, 0, time.UTC)),
+		Entry("with a space", "2021-03-04 10:00:00.25 message", time.Date(2021, 3, 4, 10, 0, 0, 25e7, time.Local)),
+		Entry("lager", `{"timestamp":"1614852000.123456789","source":"bpm"}`, time.Unix(1614852000, 123456789)),
+		Entry("lager RFC 3339", `{"timestamp":"2021-03-04T10:00:00Z","source":"bpm"}`, time.Date(2021, 3, 4, 10, 0, 0, 0, time.UTC)),
+		Entry("JSON time", `{"time":1614852000.5}`, time.Unix(1614852000, 5e8)),
+	)
+
+	DescribeTable("lines without timestamps",
+		func(line string) {
+			_, ok := logwindow.Timestamp([]byte(line))
+			Expect(ok).To(BeFalse())
+		},
+		Entry("plain text", "starting server"),
+		Entry("empty", ""),
+		Entry("JSON without a time", `{"message":"hello"}`),
+		Entry("invalid JSON", `{"timestamp":`),
+	)
+})
@@ -0,0 +1,104 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+// Package memorypressure notices when the memory usage of a process rises
+// past the threshold it has configured, so that operators are warned before
+// the kernel's OOM killer kills it.
+package memorypressure
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+
+	"bpm/config"
+	"bpm/helpers"
+	"bpm/models"
+)
+
+// HelperKind is the kind of the helper which watches the memory usage of a
+// process.
+const HelperKind = "memory-watch"
+
+// HookTimeout is how long a memory pressure hook may run before it is
+// killed.
+const HookTimeout = 30 * time.Second
+
+// Detector turns a series of memory stats into warnings. A warning is given
+// when the usage rises past the threshold and not again until it has fallen
+// back below it.
+type Detector struct {
+	pressure *config.MemoryPressure
+	above    bool
+}
+
+func NewDetector(pressure *config.MemoryPressure) *Detector {
+	return &Detector{pressure: pressure}
+}
+
+// Observe returns a warning if the usage in stats has just risen past the
+// threshold, and nil otherwise.
+func (d *Detector) Observe(stats models.MemoryStats) (*models.MemoryPressure, error) {
+	threshold, err := d.pressure.ThresholdBytes(stats.LimitBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	wasAbove := d.above
+	d.above = stats.UsageBytes >= threshold
+	if !d.above || wasAbove {
+		return nil, nil
+	}
+
+	return &models.MemoryPressure{
+		UsageBytes:     stats.UsageBytes,
+		ThresholdBytes: threshold,
+		LimitBytes:     stats.LimitBytes,
+	}, nil
+}
+
+// RunHook runs the memory pressure hook of a process with the warning
+// described in its environment, in addition to bpm's own.
+func RunHook(ctx context.Context, hook string, bpmCfg *config.BPMConfig, warning models.MemoryPressure) error {
+	ctx, cancel := context.WithTimeout(ctx, HookTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, hook)
+	cmd.Env = append(os.Environ(),
+		"BPM_JOB="+bpmCfg.JobName(),
+		"BPM_PROCESS="+bpmCfg.ProcName(),
+		"BPM_MEMORY_USAGE_BYTES="+strconv.FormatUint(warning.UsageBytes, 10),
+		"BPM_MEMORY_THRESHOLD_BYTES="+strconv.FormatUint(warning.ThresholdBytes, 10),
+		"BPM_MEMORY_LIMIT_BYTES="+strconv.FormatUint(warning.LimitBytes, 10),
+	)
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return fmt.Errorf("%s did not finish within %s", hook, HookTimeout)
+		}
+		return fmt.Errorf("%s: %s", hook, err)
+	}
+
+	return nil
+}
+
+// Start starts the helper which watches the memory usage of the process
+// until it stops.
+func Start(bpmCfg *config.BPMConfig) error {
+	return helpers.Start(bpmCfg.HelpersDir().External(), HelperKind, "memory-watch", bpmCfg.JobName(), "--process", bpmCfg.ProcName())
+}
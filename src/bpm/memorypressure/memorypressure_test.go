@@ -0,0 +1,105 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package memorypressure_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"bpm/bosh"
+	"bpm/config"
+	"bpm/memorypressure"
+	"bpm/models"
+)
+
+var _ = Describe("Memorypressure", func() {
+	Describe("Detector", func() {
+		var detector *memorypressure.Detector
+
+		usage := func(bytes uint64) models.MemoryStats {
+			return models.MemoryStats{UsageBytes: bytes, LimitBytes: 1000}
+		}
+
+		BeforeEach(func() {
+			detector = memorypressure.NewDetector(&config.MemoryPressure{Threshold: "90%"})
+		})
+
+		It("warns once when the usage rises past a share of the limit", func() {
+			Expect(detector.Observe(usage(800))).To(BeNil())
+			Expect(detector.Observe(usage(900))).To(Equal(&models.MemoryPressure{
+				UsageBytes:     900,
+				ThresholdBytes: 900,
+				LimitBytes:     1000,
+			}))
+			Expect(detector.Observe(usage(950))).To(BeNil())
+		})
+
+		It("warns again after the usage has fallen back below the threshold", func() {
+			Expect(detector.Observe(usage(950))).NotTo(BeNil())
+			Expect(detector.Observe(usage(850))).To(BeNil())
+			Expect(detector.Observe(usage(920))).NotTo(BeNil())
+		})
+
+		It("accepts a threshold which is a size", func() {
+			detector = memorypressure.NewDetector(&config.MemoryPressure{Threshold: "1K"})
+			Expect(detector.Observe(models.MemoryStats{UsageBytes: 2048})).NotTo(BeNil())
+		})
+
+		It("returns an error for a percentage when the container has no limit", func() {
+			_, err := detector.Observe(models.MemoryStats{UsageBytes: 900})
+			Expect(err).To(MatchError(ContainSubstring("the process has no memory limit")))
+		})
+	})
+
+	Describe("RunHook", func() {
+		var dir string
+
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "memorypressure")
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			Expect(os.RemoveAll(dir)).To(Succeed())
+		})
+
+		It("describes the pressure in the hook's environment", func() {
+			hook := filepath.Join(dir, "hook")
+			out := filepath.Join(dir, "out")
+			script := "#!/bin/sh\necho $BPM_JOB $BPM_PROCESS $BPM_MEMORY_USAGE_BYTES $BPM_MEMORY_THRESHOLD_BYTES $BPM_MEMORY_LIMIT_BYTES > " + out + "\n"
+			Expect(ioutil.WriteFile(hook, []byte(script), 0755)).To(Succeed())
+
+			bpmCfg := config.NewBPMConfig(bosh.NewEnv(dir), "example", "server")
+			pressure := models.MemoryPressure{UsageBytes: 950, ThresholdBytes: 900, LimitBytes: 1000}
+			Expect(memorypressure.RunHook(context.Background(), hook, bpmCfg, pressure)).To(Succeed())
+
+			contents, err := ioutil.ReadFile(out)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(contents)).To(Equal("example server 950 900 1000\n"))
+		})
+
+		It("returns an error when the hook fails", func() {
+			bpmCfg := config.NewBPMConfig(bosh.NewEnv(dir), "example", "server")
+			Expect(memorypressure.RunHook(context.Background(), "/bin/false", bpmCfg, models.MemoryPressure{})).To(MatchError(ContainSubstring("exit status 1")))
+		})
+	})
+})
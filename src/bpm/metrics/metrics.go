@@ -0,0 +1,218 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+// Package metrics keeps counters of bpm's own work on each process: how long
+// starts and stops take, how often stops time out, and so on. They make it
+// possible to spot regressions in bpm itself (or in runc and the stemcell)
+// across upgrades.
+//
+// The counters of each process are kept in a JSON file in a directory shared
+// by all processes. Every update also rewrites ExpositionFile in that
+// directory with the counters of all processes in the Prometheus text format
+// so that the directory can be collected by the node_exporter textfile
+// collector.
+package metrics
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"bpm/flock"
+)
+
+// ExpositionFile is the name of the file containing the metrics of every
+// process in the Prometheus text format.
+const ExpositionFile = "bpm.prom"
+
+const lockFile = ".lock"
+
+// Timing records how long an operation took each time it happened.
+type Timing struct {
+	Count        uint64  `json:"count"`
+	TotalSeconds float64 `json:"total_seconds"`
+	LastSeconds  float64 `json:"last_seconds"`
+}
+
+// Observe records one occurrence of the operation.
+func (t *Timing) Observe(d time.Duration) {
+	t.Count++
+	t.TotalSeconds += d.Seconds()
+	t.LastSeconds = d.Seconds()
+}
+
+// Metrics are the counters of a single process.
+type Metrics struct {
+	Job     string `json:"job"`
+	Process string `json:"process"`
+
+	// Start and Stop are the time taken by successful starts and by all
+	// stops. LockWait is the time spent waiting for the process's lock.
+	Start    Timing `json:"start"`
+	Stop     Timing `json:"stop"`
+	LockWait Timing `json:"lock_wait"`
+
+	StartFailures uint64 `json:"start_failures"`
+
+	// StopTimeouts counts stops where the process did not exit within the
+	// timeout and had to be killed.
+	StopTimeouts uint64 `json:"stop_timeouts"`
+
+	// CleanupFailures counts the times the container or bundle of the process
+	// could not be removed.
+	CleanupFailures uint64 `json:"cleanup_failures"`
+}
+
+// Read returns the metrics in the file at path. A missing file is the same
+// as one with every counter at zero.
+func Read(path string) (*Metrics, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &Metrics{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	m := &Metrics{}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("invalid metrics file %s: %s", path, err)
+	}
+
+	return m, nil
+}
+
+// Update applies update to the metrics of a process, which are kept at path,
+// and then rewrites the ExpositionFile next to it. Updates from concurrent bpm
+// invocations are serialized.
+func Update(path, job, process string, update func(*Metrics)) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	lock, err := flock.New(filepath.Join(dir, lockFile))
+	if err != nil {
+		return err
+	}
+	if err := lock.Lock(); err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	m, err := Read(path)
+	if err != nil {
+		return err
+	}
+
+	m.Job, m.Process = job, process
+	update(m)
+
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	if err := writeFile(path, data); err != nil {
+		return err
+	}
+
+	var exposition strings.Builder
+	if err := Expose(dir, &exposition); err != nil {
+		return err
+	}
+
+	return writeFile(filepath.Join(dir, ExpositionFile), []byte(exposition.String()))
+}
+
+type metric struct {
+	name, help, kind string
+	value            func(*Metrics) float64
+}
+
+var exposed = []metric{
+	{"bpm_starts_total", "Successful starts of the process.", "counter", func(m *Metrics) float64 { return float64(m.Start.Count) }},
+	{"bpm_start_duration_seconds_total", "Time taken by successful starts.", "counter", func(m *Metrics) float64 { return m.Start.TotalSeconds }},
+	{"bpm_last_start_duration_seconds", "Time taken by the last successful start.", "gauge", func(m *Metrics) float64 { return m.Start.LastSeconds }},
+	{"bpm_start_failures_total", "Starts of the process which failed.", "counter", func(m *Metrics) float64 { return float64(m.StartFailures) }},
+	{"bpm_stops_total", "Stops of the process.", "counter", func(m *Metrics) float64 { return float64(m.Stop.Count) }},
+	{"bpm_stop_duration_seconds_total", "Time taken by stops.", "counter", func(m *Metrics) float64 { return m.Stop.TotalSeconds }},
+	{"bpm_last_stop_duration_seconds", "Time taken by the last stop.", "gauge", func(m *Metrics) float64 { return m.Stop.LastSeconds }},
+	{"bpm_stop_timeouts_total", "Stops where the process had to be killed after the timeout.", "counter", func(m *Metrics) float64 { return float64(m.StopTimeouts) }},
+	{"bpm_cleanup_failures_total", "Failures to remove the container or bundle of the process.", "counter", func(m *Metrics) float64 { return float64(m.CleanupFailures) }},
+	{"bpm_lock_waits_total", "Acquisitions of the process's lock.", "counter", func(m *Metrics) float64 { return float64(m.LockWait.Count) }},
+	{"bpm_lock_wait_seconds_total", "Time spent waiting for the process's lock.", "counter", func(m *Metrics) float64 { return m.LockWait.TotalSeconds }},
+	{"bpm_last_lock_wait_seconds", "Time spent waiting for the process's lock the last time it was taken.", "gauge", func(m *Metrics) float64 { return m.LockWait.LastSeconds }},
+}
+
+// Expose writes the metrics of every process in dir to w in the Prometheus
+// text format. Files which cannot be read are skipped.
+func Expose(dir string, w io.Writer) error {
+	names, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(names)
+
+	var all []*Metrics
+	for _, name := range names {
+		m, err := Read(name)
+		if err != nil {
+			continue
+		}
+		all = append(all, m)
+	}
+
+	for _, e := range exposed {
+		fmt.Fprintf(w, "# HELP %s %s\n", e.name, e.help)
+		fmt.Fprintf(w, "# TYPE %s %s\n", e.name, e.kind)
+		for _, m := range all {
+			fmt.Fprintf(w, "%s{job=%q,process=%q} %g\n", e.name, m.Job, m.Process, e.value(m))
+		}
+	}
+
+	return nil
+}
+
+// writeFile replaces the file at path so that readers never see it partially
+// written.
+func writeFile(path string, data []byte) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Chmod(0644); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
@@ -0,0 +1,121 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package metrics_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"bpm/metrics"
+)
+
+var _ = Describe("Metrics", func() {
+	var dir, path string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "metrics")
+		Expect(err).NotTo(HaveOccurred())
+
+		path = filepath.Join(dir, "metrics", "job.server.json")
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dir)).To(Succeed())
+	})
+
+	Describe("Timing", func() {
+		It("counts each occurrence and keeps the last and total duration", func() {
+			var t metrics.Timing
+			t.Observe(2 * time.Second)
+			t.Observe(500 * time.Millisecond)
+
+			Expect(t).To(Equal(metrics.Timing{Count: 2, TotalSeconds: 2.5, LastSeconds: 0.5}))
+		})
+	})
+
+	Describe("Read", func() {
+		It("treats a missing file as having no metrics", func() {
+			m, err := metrics.Read(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(m).To(Equal(&metrics.Metrics{}))
+		})
+
+		It("returns an error if the file is corrupt", func() {
+			Expect(os.MkdirAll(filepath.Dir(path), 0755)).To(Succeed())
+			Expect(ioutil.WriteFile(path, []byte("{"), 0644)).To(Succeed())
+
+			_, err := metrics.Read(path)
+			Expect(err).To(MatchError(ContainSubstring("invalid metrics file")))
+		})
+	})
+
+	Describe("Update", func() {
+		It("keeps the metrics between updates", func() {
+			Expect(metrics.Update(path, "job", "server", func(m *metrics.Metrics) { m.Start.Observe(time.Second) })).To(Succeed())
+			Expect(metrics.Update(path, "job", "server", func(m *metrics.Metrics) { m.StopTimeouts++ })).To(Succeed())
+
+			m, err := metrics.Read(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(m.Job).To(Equal("job"))
+			Expect(m.Process).To(Equal("server"))
+			Expect(m.Start.Count).To(Equal(uint64(1)))
+			Expect(m.StopTimeouts).To(Equal(uint64(1)))
+		})
+
+		It("does not lose concurrent updates", func() {
+			var wg sync.WaitGroup
+			for i := 0; i < 20; i++ {
+				wg.Add(1)
+				go func() {
+					defer GinkgoRecover()
+					defer wg.Done()
+
+					Expect(metrics.Update(path, "job", "server", func(m *metrics.Metrics) { m.CleanupFailures++ })).To(Succeed())
+				}()
+			}
+			wg.Wait()
+
+			m, err := metrics.Read(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(m.CleanupFailures).To(Equal(uint64(20)))
+		})
+
+		It("exposes the metrics of every process in the Prometheus text format", func() {
+			other := filepath.Join(filepath.Dir(path), "other.worker.json")
+			Expect(metrics.Update(path, "job", "server", func(m *metrics.Metrics) { m.Stop.Observe(3 * time.Second) })).To(Succeed())
+			Expect(metrics.Update(other, "other", "worker", func(m *metrics.Metrics) { m.LockWait.Observe(250 * time.Millisecond) })).To(Succeed())
+
+			exposition, err := ioutil.ReadFile(filepath.Join(filepath.Dir(path), metrics.ExpositionFile))
+			Expect(err).NotTo(HaveOccurred())
+
+			lines := strings.Split(string(exposition), "\n")
+			Expect(lines).To(ContainElement("# TYPE bpm_stops_total counter"))
+			Expect(lines).To(ContainElement(`bpm_stops_total{job="job",process="server"} 1`))
+			Expect(lines).To(ContainElement(`bpm_stop_duration_seconds_total{job="job",process="server"} 3`))
+			Expect(lines).To(ContainElement(`bpm_stops_total{job="other",process="worker"} 0`))
+			Expect(lines).To(ContainElement("# TYPE bpm_last_lock_wait_seconds gauge"))
+			Expect(lines).To(ContainElement(`bpm_last_lock_wait_seconds{job="other",process="worker"} 0.25`))
+		})
+	})
+})
@@ -15,16 +15,190 @@
 
 package models
 
+import (
+	"time"
+
+	"bpm/metrics"
+)
+
 const (
 	ProcessStateFailed   = "failed"
 	ProcessStateRunning  = "running"
 	ProcessStateStopped  = "stopped"
 	ProcessStateCreating = "creating"
 	ProcessStateCreated  = "created"
+	ProcessStateAdopted  = "adopted"
+
+	// ProcessStateExited is used instead of ProcessStateFailed when the
+	// process is known to have exited successfully.
+	ProcessStateExited = "exited"
+
+	// ProcessStatePreserved is used instead of ProcessStateFailed when the
+	// process was stopped with `bpm stop --no-delete` and its container has
+	// been kept for inspection.
+	ProcessStatePreserved = "stopped (preserved)"
+
+	// ProcessStateQuarantined is used instead of the state of the container
+	// when the process has been frozen by `bpm quarantine`.
+	ProcessStateQuarantined = "quarantined"
 )
 
+// Quarantine records when and why a process was quarantined.
+type Quarantine struct {
+	Since  time.Time `json:"since"`
+	Reason string    `json:"reason,omitempty"`
+}
+
 type Process struct {
 	Name   string
 	Pid    int
 	Status string
+	Labels map[string]string
+
+	// OOMKilled is true when the kernel's OOM killer has killed a process
+	// in the container.
+	OOMKilled bool
+
+	// Overridden is true when the process's configuration has been changed
+	// by a local override file.
+	Overridden bool
+
+	// ExitStatus is the exit status of a process which is no longer running
+	// if bpm knows it.
+	ExitStatus *int
+
+	// TerminationMessage is what a process which has exited left in its
+	// termination log.
+	TerminationMessage string
+
+	// BundlePath and ConfigPath are where the process's OCI bundle and job
+	// configuration can be found on the host. BundlePath is empty for
+	// adopted processes, which do not have a bundle.
+	BundlePath string
+	ConfigPath string
+
+	// CgroupPath is the cgroup of the process's container relative to the
+	// root of the cgroup hierarchy. It is empty for containers which were
+	// created before bpm recorded it and for adopted processes.
+	CgroupPath string
+
+	// CreatedAt and StartedAt are when the process's container was created
+	// and when the process was started. They are zero if bpm did not record
+	// them.
+	CreatedAt time.Time
+	StartedAt time.Time
+
+	// Internal are the metrics of bpm's own operations on the process. They
+	// are only filled in when asked for.
+	Internal *metrics.Metrics
+
+	// Ports are whether the process is listening on each of the ports
+	// which its configuration says it should. They are only filled in for
+	// running processes.
+	Ports []PortCheck
+}
+
+// PortCheck is whether a process is listening on a port which it was
+// configured with, written as PORT/PROTOCOL.
+type PortCheck struct {
+	Port      string `json:"port"`
+	Listening bool   `json:"listening"`
+}
+
+// HasExited reports whether the process has stopped running without its
+// container having been removed.
+func (p *Process) HasExited() bool {
+	return p.Status == ProcessStateFailed ||
+		p.Status == ProcessStateExited ||
+		p.Status == ProcessStatePreserved
+}
+
+// Stats is a snapshot of the resource usage of the container of a process.
+// Its JSON encoding is part of bpm's interface and does not change along
+// with the output of runc. Limits of zero mean there is no limit.
+type Stats struct {
+	CPU    CPUStats    `json:"cpu"`
+	Memory MemoryStats `json:"memory"`
+	Pids   PidsStats   `json:"pids"`
+}
+
+type CPUStats struct {
+	// UsageNanoseconds is the CPU time which has been used by every process
+	// in the container.
+	UsageNanoseconds uint64 `json:"usage_ns"`
+
+	// Periods is the number of CPU quota periods in which the container had
+	// runnable processes. ThrottledPeriods of them ended with the container
+	// out of quota, and ThrottledNanoseconds is the total time its processes
+	// were kept from running because of it. They stay at zero for containers
+	// without a CPU quota.
+	Periods              uint64 `json:"periods"`
+	ThrottledPeriods     uint64 `json:"throttled_periods"`
+	ThrottledNanoseconds uint64 `json:"throttled_ns"`
+}
+
+type MemoryStats struct {
+	UsageBytes    uint64 `json:"usage_bytes"`
+	MaxUsageBytes uint64 `json:"max_usage_bytes"`
+	LimitBytes    uint64 `json:"limit_bytes"`
+	OOMKills      uint64 `json:"oom_kills"`
+}
+
+type PidsStats struct {
+	Current uint64 `json:"current"`
+	Limit   uint64 `json:"limit"`
+}
+
+// CgroupLimits are the limits which the kernel enforces on the cgroup of a
+// container. Limits of zero mean there is no limit.
+type CgroupLimits struct {
+	MemoryBytes uint64
+	Pids        uint64
+
+	// CPUQuotaMicroseconds is how much CPU time the container may use in
+	// each period of CPUPeriodMicroseconds.
+	CPUQuotaMicroseconds  uint64
+	CPUPeriodMicroseconds uint64
+}
+
+// LimitCheck is the result of comparing one limit which a process actually
+// has with the limit which bpm asked for.
+type LimitCheck struct {
+	Limit    string `json:"limit"`
+	Expected string `json:"expected"`
+	Actual   string `json:"actual"`
+	Matches  bool   `json:"matches"`
+}
+
+// HostCheck is the result of checking one thing which bpm needs from the
+// host. Problem explains why the check failed.
+type HostCheck struct {
+	Check   string `json:"check"`
+	Path    string `json:"path,omitempty"`
+	OK      bool   `json:"ok"`
+	Problem string `json:"problem,omitempty"`
+}
+
+const (
+	EventTypeStats          = "stats"
+	EventTypeOOM            = "oom"
+	EventTypeMemoryPressure = "memory_pressure"
+)
+
+// Event is something which happened to the container of a process. Stats
+// are only present on events of type EventTypeStats and MemoryPressure on
+// events of type EventTypeMemoryPressure.
+type Event struct {
+	Type           string          `json:"type"`
+	Timestamp      time.Time       `json:"timestamp"`
+	Stats          *Stats          `json:"stats,omitempty"`
+	MemoryPressure *MemoryPressure `json:"memory_pressure,omitempty"`
+}
+
+// MemoryPressure describes memory usage which has risen past the threshold
+// which the process configured to be warned at.
+type MemoryPressure struct {
+	UsageBytes     uint64 `json:"usage_bytes"`
+	ThresholdBytes uint64 `json:"threshold_bytes"`
+	LimitBytes     uint64 `json:"limit_bytes"`
 }
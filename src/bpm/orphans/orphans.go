@@ -0,0 +1,167 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+// Package orphans finds the state which bpm has left on the host for
+// processes which are no longer part of their job's configuration. A process
+// which is renamed or removed from a job, or a job which is removed from the
+// VM, otherwise leaves its bundle, pid files, and logs behind forever.
+package orphans
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"bpm/bosh"
+	"bpm/config"
+)
+
+const (
+	ReasonJobRemoved     = "job removed"
+	ReasonProcessRemoved = "process removed"
+)
+
+// Orphan is the state of a process which is no longer configured. An Orphan
+// with an empty Process holds the state which belonged to the job as a whole
+// and should only be removed once all of the job's processes have been.
+type Orphan struct {
+	Job     string
+	Process string
+	Reason  string
+	Paths   []string
+}
+
+// Find compares the bundles which bpm has created with the configuration of
+// each job. Jobs whose configuration cannot be parsed are skipped as it is
+// not possible to tell which of their processes are still wanted.
+func Find(env *bosh.Env) ([]Orphan, error) {
+	jobs, err := subdirectories(config.BundlesRoot(env))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var orphans []Orphan
+	for _, job := range jobs {
+		procs, err := subdirectories(filepath.Join(config.BundlesRoot(env), job))
+		if err != nil {
+			return nil, err
+		}
+
+		jobCfg, err := config.NewBPMConfig(env, job, "").ParseJobConfig()
+		if os.IsNotExist(err) {
+			for _, proc := range procs {
+				orphans = append(orphans, processOrphan(env, job, proc, ReasonJobRemoved))
+			}
+			orphans = append(orphans, jobOrphan(env, job))
+			continue
+		} else if err != nil {
+			continue
+		}
+
+		configured := map[string]bool{}
+		for _, proc := range jobCfg.Processes {
+			configured[proc.Name] = true
+		}
+
+		for _, proc := range procs {
+			if !configured[proc] {
+				orphans = append(orphans, processOrphan(env, job, proc, ReasonProcessRemoved))
+			}
+		}
+	}
+
+	return orphans, nil
+}
+
+// Remove deletes the state of an orphan. It carries on past failures and
+// returns the first.
+func Remove(o Orphan) error {
+	var firstErr error
+	for _, path := range o.Paths {
+		if err := os.RemoveAll(path); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
+
+func processOrphan(env *bosh.Env, job, proc, reason string) Orphan {
+	cfg := config.NewBPMConfig(env, job, proc)
+
+	return Orphan{
+		Job:     job,
+		Process: proc,
+		Reason:  reason,
+		Paths: existing(
+			cfg.BundlePath(),
+			cfg.PidFile().External(),
+			cfg.AdoptedFile().External(),
+			cfg.HelpersDir().External(),
+			cfg.TerminationLog().External(),
+			cfg.AccountsDir().External(),
+			cfg.MachineIDFile().External(),
+			cfg.LockFile().External(),
+			cfg.StatusFile(),
+			cfg.MetricsFile(),
+			cfg.Stdout().External(),
+			cfg.Stderr().External(),
+		),
+	}
+}
+
+func jobOrphan(env *bosh.Env, job string) Orphan {
+	cfg := config.NewBPMConfig(env, job, "")
+
+	return Orphan{
+		Job:    job,
+		Reason: ReasonJobRemoved,
+		Paths: existing(
+			filepath.Join(config.BundlesRoot(env), job),
+			config.RuncJobRoot(env, job),
+			cfg.PidDir().External(),
+			cfg.LogDir().External(),
+		),
+	}
+}
+
+func existing(paths ...string) []string {
+	var found []string
+	for _, path := range paths {
+		if _, err := os.Lstat(path); err == nil {
+			found = append(found, path)
+		}
+	}
+
+	return found
+}
+
+func subdirectories(dir string) ([]string, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, info := range infos {
+		if info.IsDir() {
+			names = append(names, info.Name())
+		}
+	}
+
+	return names, nil
+}
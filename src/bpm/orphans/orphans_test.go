@@ -0,0 +1,146 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package orphans_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"bpm/bosh"
+	"bpm/config"
+	"bpm/orphans"
+)
+
+var _ = Describe("Orphans", func() {
+	var (
+		root string
+		env  *bosh.Env
+	)
+
+	writeConfig := func(job string, procs ...string) {
+		contents := "processes:\n"
+		for _, proc := range procs {
+			contents += "- name: " + proc + "\n  executable: /bin/sleep\n"
+		}
+
+		cfg := config.NewBPMConfig(env, job, "")
+		Expect(os.MkdirAll(filepath.Dir(cfg.JobConfig()), 0755)).To(Succeed())
+		Expect(ioutil.WriteFile(cfg.JobConfig(), []byte(contents), 0644)).To(Succeed())
+	}
+
+	createState := func(job, proc string) *config.BPMConfig {
+		cfg := config.NewBPMConfig(env, job, proc)
+		Expect(os.MkdirAll(cfg.RootFSPath(), 0755)).To(Succeed())
+		Expect(os.MkdirAll(cfg.PidDir().External(), 0755)).To(Succeed())
+		Expect(os.MkdirAll(cfg.LogDir().External(), 0755)).To(Succeed())
+		Expect(ioutil.WriteFile(cfg.PidFile().External(), []byte("1234"), 0644)).To(Succeed())
+		Expect(ioutil.WriteFile(cfg.Stdout().External(), nil, 0644)).To(Succeed())
+		return cfg
+	}
+
+	BeforeEach(func() {
+		var err error
+		root, err = ioutil.TempDir("", "orphans")
+		Expect(err).NotTo(HaveOccurred())
+		env = bosh.NewEnv(root)
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(root)).To(Succeed())
+	})
+
+	It("finds nothing when no bundles have been created", func() {
+		Expect(orphans.Find(env)).To(BeEmpty())
+	})
+
+	It("ignores processes which are still configured", func() {
+		writeConfig("example", "server", "worker")
+		createState("example", "server")
+		createState("example", "worker")
+
+		Expect(orphans.Find(env)).To(BeEmpty())
+	})
+
+	It("finds processes which have been removed from their job", func() {
+		writeConfig("example", "server")
+		createState("example", "server")
+		old := createState("example", "old-worker")
+		Expect(os.MkdirAll(old.HelpersDir().External(), 0700)).To(Succeed())
+
+		found, err := orphans.Find(env)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(found).To(Equal([]orphans.Orphan{{
+			Job:     "example",
+			Process: "old-worker",
+			Reason:  orphans.ReasonProcessRemoved,
+			Paths: []string{
+				old.BundlePath(),
+				old.PidFile().External(),
+				old.HelpersDir().External(),
+				old.Stdout().External(),
+			},
+		}}))
+	})
+
+	It("finds all of the state of jobs which have been removed", func() {
+		cfg := createState("removed", "server")
+
+		found, err := orphans.Find(env)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(found).To(HaveLen(2))
+		Expect(found[0].Process).To(Equal("server"))
+		Expect(found[0].Reason).To(Equal(orphans.ReasonJobRemoved))
+		Expect(found[1]).To(Equal(orphans.Orphan{
+			Job:    "removed",
+			Reason: orphans.ReasonJobRemoved,
+			Paths: []string{
+				filepath.Join(config.BundlesRoot(env), "removed"),
+				cfg.PidDir().External(),
+				cfg.LogDir().External(),
+			},
+		}))
+	})
+
+	It("skips jobs whose configuration is invalid", func() {
+		cfg := config.NewBPMConfig(env, "broken", "")
+		Expect(os.MkdirAll(filepath.Dir(cfg.JobConfig()), 0755)).To(Succeed())
+		Expect(ioutil.WriteFile(cfg.JobConfig(), []byte("processes: ["), 0644)).To(Succeed())
+		createState("broken", "server")
+
+		Expect(orphans.Find(env)).To(BeEmpty())
+	})
+
+	Describe("Remove", func() {
+		It("removes the paths of the orphan", func() {
+			writeConfig("example", "server")
+			old := createState("example", "old-worker")
+
+			found, err := orphans.Find(env)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(found).To(HaveLen(1))
+
+			Expect(orphans.Remove(found[0])).To(Succeed())
+			Expect(old.BundlePath()).NotTo(BeADirectory())
+			Expect(old.PidFile().External()).NotTo(BeAnExistingFile())
+			Expect(old.Stdout().External()).NotTo(BeAnExistingFile())
+			Expect(old.PidDir().External()).To(BeADirectory())
+		})
+	})
+})
@@ -0,0 +1,174 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+// Package portcheck finds the ports which the processes of a container are
+// listening on. Containers share the network namespace of the host, so the
+// sockets in /proc/PID/net are matched with the sockets which the container's
+// processes have open to tell them apart from those of other processes.
+package portcheck
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	tcpListen       = "0A"
+	udpUnconnected  = "07"
+	socketLinkStart = "socket:["
+)
+
+// Listening returns the ports which the process with the given pid, or any
+// of its descendants, is listening on, written as PORT/PROTOCOL (for example
+// 8080/tcp). Only TCP sockets which are listening and UDP sockets which are
+// bound but not connected are included.
+func Listening(pid int) (map[string]bool, error) {
+	return listening("/proc", pid)
+}
+
+func listening(procRoot string, pid int) (map[string]bool, error) {
+	pids, err := descendants(procRoot, pid)
+	if err != nil {
+		return nil, err
+	}
+
+	inodes := map[string]bool{}
+	for _, p := range pids {
+		fds := filepath.Join(procRoot, strconv.Itoa(p), "fd")
+		names, err := readDirNames(fds)
+		if err != nil {
+			// The process may have exited since it was found.
+			continue
+		}
+
+		for _, name := range names {
+			link, err := os.Readlink(filepath.Join(fds, name))
+			if err != nil || !strings.HasPrefix(link, socketLinkStart) {
+				continue
+			}
+			inodes[strings.TrimSuffix(strings.TrimPrefix(link, socketLinkStart), "]")] = true
+		}
+	}
+
+	ports := map[string]bool{}
+	for _, table := range []struct {
+		file, protocol, state string
+	}{
+		{"tcp", "tcp", tcpListen},
+		{"tcp6", "tcp", tcpListen},
+		{"udp", "udp", udpUnconnected},
+		{"udp6", "udp", udpUnconnected},
+	} {
+		path := filepath.Join(procRoot, strconv.Itoa(pid), "net", table.file)
+		if err := readSockets(path, table.state, func(port int, inode string) {
+			if inodes[inode] {
+				ports[fmt.Sprintf("%d/%s", port, table.protocol)] = true
+			}
+		}); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+
+	return ports, nil
+}
+
+// readSockets calls found with the local port and inode of each socket in
+// one of the tables in /proc/PID/net which is in the given state.
+func readSockets(path, state string, found func(port int, inode string)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Scan() // header
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 || fields[3] != state {
+			continue
+		}
+
+		colon := strings.LastIndex(fields[1], ":")
+		if colon < 0 {
+			continue
+		}
+
+		port, err := strconv.ParseUint(fields[1][colon+1:], 16, 16)
+		if err != nil {
+			continue
+		}
+
+		found(int(port), fields[9])
+	}
+
+	return scanner.Err()
+}
+
+// descendants returns pid and every process which descends from it.
+func descendants(procRoot string, pid int) ([]int, error) {
+	names, err := readDirNames(procRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	children := map[int][]int{}
+	for _, name := range names {
+		child, err := strconv.Atoi(name)
+		if err != nil {
+			continue
+		}
+
+		stat, err := ioutil.ReadFile(filepath.Join(procRoot, name, "stat"))
+		if err != nil {
+			continue
+		}
+
+		// The command name in parentheses may itself contain spaces
+		// and parentheses so the fields are found after the last one.
+		fields := strings.Fields(string(stat[strings.LastIndex(string(stat), ")")+1:]))
+		if len(fields) < 2 {
+			continue
+		}
+
+		parent, err := strconv.Atoi(fields[1])
+		if err != nil {
+			continue
+		}
+		children[parent] = append(children[parent], child)
+	}
+
+	pids := []int{pid}
+	for i := 0; i < len(pids); i++ {
+		pids = append(pids, children[pids[i]]...)
+	}
+
+	return pids, nil
+}
+
+func readDirNames(dir string) ([]string, error) {
+	f, err := os.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return f.Readdirnames(-1)
+}
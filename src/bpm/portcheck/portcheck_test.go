@@ -0,0 +1,102 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package portcheck
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("listening", func() {
+	var procRoot string
+
+	process := func(pid, ppid int, sockets ...string) {
+		dir := filepath.Join(procRoot, fmt.Sprint(pid))
+		Expect(os.MkdirAll(filepath.Join(dir, "fd"), 0755)).To(Succeed())
+		stat := fmt.Sprintf("%d (my (odd) name) S %d 1 1 0 -1", pid, ppid)
+		Expect(ioutil.WriteFile(filepath.Join(dir, "stat"), []byte(stat), 0644)).To(Succeed())
+
+		for i, inode := range sockets {
+			link := filepath.Join(dir, "fd", fmt.Sprint(i+3))
+			Expect(os.Symlink(fmt.Sprintf("socket:[%s]", inode), link)).To(Succeed())
+		}
+		Expect(os.Symlink("/dev/null", filepath.Join(dir, "fd", "0"))).To(Succeed())
+	}
+
+	table := func(pid int, name string, rows ...string) {
+		contents := "  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode\n"
+		for _, row := range rows {
+			contents += row + "\n"
+		}
+
+		path := filepath.Join(procRoot, fmt.Sprint(pid), "net", name)
+		Expect(os.MkdirAll(filepath.Dir(path), 0755)).To(Succeed())
+		Expect(ioutil.WriteFile(path, []byte(contents), 0644)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		var err error
+		procRoot, err = ioutil.TempDir("", "portcheck")
+		Expect(err).NotTo(HaveOccurred())
+
+		process(100, 1)
+		process(101, 100, "1001")
+		process(102, 101, "1002", "1003")
+		process(200, 1, "2001")
+
+		table(100, "tcp",
+			"   0: 00000000:1F90 00000000:0000 0A 00000000:00000000 00:00000000 00000000  1000        0 1001 1 0000000000000000 100 0 0 10 0",
+			"   1: 0100007F:1F91 0100007F:9C40 01 00000000:00000000 00:00000000 00000000  1000        0 1003 1 0000000000000000 100 0 0 10 0",
+			"   2: 00000000:0050 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 2001 1 0000000000000000 100 0 0 10 0",
+		)
+		table(100, "tcp6",
+			"   0: 00000000000000000000000000000000:20FB 00000000000000000000000000000000:0000 0A 00000000:00000000 00:00000000 00000000  1000        0 1002 1 0000000000000000 100 0 0 10 0",
+		)
+		table(100, "udp",
+			"   0: 00000000:0035 00000000:0000 07 00000000:00000000 00:00000000 00000000  1000        0 1003 2 0000000000000000 0",
+		)
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(procRoot)).To(Succeed())
+	})
+
+	It("finds the ports which the process and its descendants listen on", func() {
+		ports, err := listening(procRoot, 100)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ports).To(Equal(map[string]bool{
+			"8080/tcp": true,
+			"8443/tcp": true,
+			"53/udp":   true,
+		}))
+	})
+
+	It("does not include the ports of its parents", func() {
+		Expect(os.Symlink(filepath.Join(procRoot, "100", "net"), filepath.Join(procRoot, "102", "net"))).To(Succeed())
+
+		ports, err := listening(procRoot, 102)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ports).To(Equal(map[string]bool{
+			"8443/tcp": true,
+			"53/udp":   true,
+		}))
+	})
+})
@@ -16,20 +16,40 @@
 package presenters
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"strconv"
 	"strings"
 	"text/tabwriter"
+	"time"
+
+	"code.cloudfoundry.org/bytefmt"
 
 	"bpm/jobid"
+	"bpm/metrics"
 	"bpm/models"
 )
 
 func PrintJobs(processes []*models.Process, stdout io.Writer) error {
+	return printTable(processes, stdout, false)
+}
+
+// PrintJobsWide is like PrintJobs but also shows the container ID of each
+// process and where its bundle and configuration are.
+func PrintJobsWide(processes []*models.Process, stdout io.Writer) error {
+	return printTable(processes, stdout, true)
+}
+
+func printTable(processes []*models.Process, stdout io.Writer, wide bool) error {
 	tw := tabwriter.NewWriter(stdout, 0, 0, 1, ' ', 0)
 
-	printRow(tw, "Name", "Pid", "Status")
+	header := []string{"Name", "Pid", "Status", "OOM", "Override", "Started", "Uptime"}
+	if wide {
+		header = append(header, "Container ID", "Bundle", "Config", "Cgroup")
+	}
+	printRow(tw, header...)
+
 	for _, process := range processes {
 		name, err := jobid.Decode(process.Name)
 		if err != nil {
@@ -41,12 +61,319 @@ func PrintJobs(processes []*models.Process, stdout io.Writer) error {
 			pid = strconv.Itoa(process.Pid)
 		}
 
-		printRow(tw, name, pid, process.Status)
+		oom := "no"
+		if process.OOMKilled {
+			oom = "yes"
+		}
+
+		override := "no"
+		if process.Overridden {
+			override = "yes"
+		}
+
+		status := process.Status
+		if process.ExitStatus != nil {
+			status = fmt.Sprintf("%s(%d)", status, *process.ExitStatus)
+		}
+
+		started := orDash(formatTime(process.StartedAt))
+
+		uptime := "-"
+		if d, ok := processUptime(process); ok {
+			uptime = d.String()
+		}
+
+		row := []string{name, pid, status, oom, override, started, uptime}
+		if wide {
+			row = append(row, process.Name, orDash(process.BundlePath), orDash(process.ConfigPath), orDash(process.CgroupPath))
+		}
+		printRow(tw, row...)
+	}
+
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	for _, process := range processes {
+		if process.TerminationMessage != "" {
+			if err := printTerminationMessage(process, stdout); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, process := range processes {
+		if len(process.Ports) > 0 {
+			if err := printPorts(process, stdout); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, process := range processes {
+		if process.Internal != nil {
+			if err := printInternal(process.Internal, stdout); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// printTerminationMessage shows what an exited process left in its
+// termination log below the table of processes.
+func printTerminationMessage(process *models.Process, stdout io.Writer) error {
+	name, err := jobid.Decode(process.Name)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(stdout, "\nTermination message of %s:\n", name)
+	for _, line := range strings.Split(process.TerminationMessage, "\n") {
+		fmt.Fprintf(stdout, "  %s\n", line)
+	}
+
+	return nil
+}
+
+// printPorts shows whether a process is listening on each of its configured
+// ports below the table of processes.
+func printPorts(process *models.Process, stdout io.Writer) error {
+	name, err := jobid.Decode(process.Name)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(stdout, "\nPorts of %s:\n", name)
+	for _, port := range process.Ports {
+		status := "not listening"
+		if port.Listening {
+			status = "listening"
+		}
+		fmt.Fprintf(stdout, "  %s %s\n", port.Port, status)
+	}
+
+	return nil
+}
+
+// printInternal shows the metrics of bpm's own operations on a process below
+// the table of processes.
+func printInternal(m *metrics.Metrics, stdout io.Writer) error {
+	tw := tabwriter.NewWriter(stdout, 0, 0, 1, ' ', 0)
+
+	fmt.Fprintln(tw)
+	printRow(tw, "Operation", "Count", "Last", "Total")
+	for _, t := range []struct {
+		name   string
+		timing metrics.Timing
+	}{
+		{"start", m.Start},
+		{"stop", m.Stop},
+		{"lock-wait", m.LockWait},
+	} {
+		printRow(tw, t.name, strconv.FormatUint(t.timing.Count, 10), formatSeconds(t.timing.LastSeconds), formatSeconds(t.timing.TotalSeconds))
+	}
+	printRow(tw, "start-failure", strconv.FormatUint(m.StartFailures, 10), "-", "-")
+	printRow(tw, "stop-timeout", strconv.FormatUint(m.StopTimeouts, 10), "-", "-")
+	printRow(tw, "cleanup-failure", strconv.FormatUint(m.CleanupFailures, 10), "-", "-")
+
+	return tw.Flush()
+}
+
+func formatSeconds(seconds float64) string {
+	return time.Duration(seconds * float64(time.Second)).Round(time.Millisecond).String()
+}
+
+// processUptime returns how long a process has been running for. Processes
+// which are not running or whose start time is not known have no uptime.
+func processUptime(process *models.Process) (time.Duration, bool) {
+	if process.Status != models.ProcessStateRunning || process.StartedAt.IsZero() {
+		return 0, false
+	}
+
+	return time.Since(process.StartedAt).Truncate(time.Second), true
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+
+	return s
+}
+
+type jsonProcess struct {
+	Name   string            `json:"name"`
+	Pid    int               `json:"pid"`
+	Status string            `json:"status"`
+	Labels map[string]string `json:"labels"`
+
+	ExitStatus         *int   `json:"exit_status,omitempty"`
+	TerminationMessage string `json:"termination_message,omitempty"`
+	OOMKilled          bool   `json:"oom_killed"`
+	Overridden         bool   `json:"overridden"`
+	CgroupPath         string `json:"cgroup_path,omitempty"`
+
+	CreatedAt     string `json:"created_at,omitempty"`
+	StartedAt     string `json:"started_at,omitempty"`
+	UptimeSeconds *int64 `json:"uptime_seconds,omitempty"`
+
+	Ports    []models.PortCheck `json:"ports,omitempty"`
+	Internal *metrics.Metrics   `json:"internal,omitempty"`
+}
+
+// PrintJobsJSON writes the processes as a JSON array so that they can be
+// consumed by other tools.
+func PrintJobsJSON(processes []*models.Process, stdout io.Writer) error {
+	output := make([]jsonProcess, 0, len(processes))
+	for _, process := range processes {
+		name, err := jobid.Decode(process.Name)
+		if err != nil {
+			return err
+		}
+
+		labels := process.Labels
+		if labels == nil {
+			labels = map[string]string{}
+		}
+
+		var uptimeSeconds *int64
+		if d, ok := processUptime(process); ok {
+			seconds := int64(d.Seconds())
+			uptimeSeconds = &seconds
+		}
+
+		output = append(output, jsonProcess{
+			Name:   name,
+			Pid:    process.Pid,
+			Status: process.Status,
+			Labels: labels,
+
+			ExitStatus:         process.ExitStatus,
+			TerminationMessage: process.TerminationMessage,
+			OOMKilled:          process.OOMKilled,
+			Overridden:         process.Overridden,
+			CgroupPath:         process.CgroupPath,
+
+			CreatedAt:     formatTime(process.CreatedAt),
+			StartedAt:     formatTime(process.StartedAt),
+			UptimeSeconds: uptimeSeconds,
+
+			Ports:    process.Ports,
+			Internal: process.Internal,
+		})
 	}
 
+	encoder := json.NewEncoder(stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(output)
+}
+
+// PrintStats writes the resource usage of a process as a table.
+func PrintStats(name string, stats *models.Stats, stdout io.Writer) error {
+	tw := tabwriter.NewWriter(stdout, 0, 0, 1, ' ', 0)
+
+	printRow(tw, "Name", "CPU Time", "Throttled", "Throttled Time", "Memory", "Max Memory", "Memory Limit", "OOM Kills", "Pids", "Pids Limit")
+	printRow(tw,
+		name,
+		time.Duration(stats.CPU.UsageNanoseconds).Round(time.Millisecond).String(),
+		fmt.Sprintf("%d/%d", stats.CPU.ThrottledPeriods, stats.CPU.Periods),
+		time.Duration(stats.CPU.ThrottledNanoseconds).Round(time.Millisecond).String(),
+		bytefmt.ByteSize(stats.Memory.UsageBytes),
+		bytefmt.ByteSize(stats.Memory.MaxUsageBytes),
+		formatLimit(stats.Memory.LimitBytes, bytefmt.ByteSize),
+		strconv.FormatUint(stats.Memory.OOMKills, 10),
+		strconv.FormatUint(stats.Pids.Current, 10),
+		formatLimit(stats.Pids.Limit, func(n uint64) string { return strconv.FormatUint(n, 10) }),
+	)
+
 	return tw.Flush()
 }
 
+// PrintStatsJSON writes the resource usage of a process as JSON.
+func PrintStatsJSON(name string, stats *models.Stats, stdout io.Writer) error {
+	encoder := json.NewEncoder(stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(struct {
+		Name string `json:"name"`
+		*models.Stats
+	}{name, stats})
+}
+
+// PrintLimitChecks shows the limits which a process was checked against and
+// whether it has them.
+func PrintLimitChecks(checks []models.LimitCheck, stdout io.Writer) error {
+	tw := tabwriter.NewWriter(stdout, 0, 0, 1, ' ', 0)
+
+	printRow(tw, "Limit", "Expected", "Actual", "Status")
+	for _, check := range checks {
+		status := "differs"
+		if check.Matches {
+			status = "ok"
+		}
+		printRow(tw, check.Limit, check.Expected, check.Actual, status)
+	}
+
+	return tw.Flush()
+}
+
+// PrintLimitChecksJSON writes the result of checking the limits of a process
+// as a JSON array.
+func PrintLimitChecksJSON(checks []models.LimitCheck, stdout io.Writer) error {
+	if checks == nil {
+		checks = []models.LimitCheck{}
+	}
+
+	encoder := json.NewEncoder(stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(checks)
+}
+
+// PrintHostChecks writes the result of checking the host as a table.
+func PrintHostChecks(checks []models.HostCheck, stdout io.Writer) error {
+	tw := tabwriter.NewWriter(stdout, 0, 0, 1, ' ', 0)
+
+	printRow(tw, "Check", "Path", "Status")
+	for _, check := range checks {
+		status := check.Problem
+		if check.OK {
+			status = "ok"
+		}
+		printRow(tw, check.Check, check.Path, status)
+	}
+
+	return tw.Flush()
+}
+
+// PrintHostChecksJSON writes the result of checking the host as a JSON
+// array.
+func PrintHostChecksJSON(checks []models.HostCheck, stdout io.Writer) error {
+	if checks == nil {
+		checks = []models.HostCheck{}
+	}
+
+	encoder := json.NewEncoder(stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(checks)
+}
+
+func formatLimit(limit uint64, format func(uint64) string) string {
+	if limit == 0 {
+		return "-"
+	}
+
+	return format(limit)
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+
+	return t.UTC().Format(time.RFC3339)
+}
+
 func printRow(w io.Writer, args ...string) {
 	row := strings.Join(args, "\t")
 	fmt.Fprintf(w, "%s\n", row)
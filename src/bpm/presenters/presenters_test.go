@@ -17,16 +17,22 @@ package presenters_test
 
 import (
 	"fmt"
+	"time"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	"github.com/onsi/gomega/gbytes"
 
 	"bpm/jobid"
+	"bpm/metrics"
 	"bpm/models"
 	"bpm/presenters"
 )
 
+func intPtr(i int) *int {
+	return &i
+}
+
 var _ = Describe("Presenters", func() {
 	Describe("PresentJobs", func() {
 		var (
@@ -37,8 +43,10 @@ var _ = Describe("Presenters", func() {
 		BeforeEach(func() {
 			processes = []*models.Process{
 				{Name: jobid.Encode("job-process-2"), Pid: 23456, Status: "created"},
-				{Name: jobid.Encode("job-process-1"), Pid: 34567, Status: "running"},
-				{Name: jobid.Encode("job-process-3"), Pid: 0, Status: "failed"},
+				{Name: jobid.Encode("job-process-1"), Pid: 34567, Status: "running", Overridden: true},
+				{Name: jobid.Encode("job-process-3"), Pid: 0, Status: "failed", OOMKilled: true},
+				{Name: jobid.Encode("job-process-4"), Pid: 0, Status: "exited", ExitStatus: intPtr(0)},
+				{Name: jobid.Encode("job-process-5"), Pid: 0, Status: "failed", ExitStatus: intPtr(2)},
 			}
 
 			output = gbytes.NewBuffer()
@@ -46,10 +54,273 @@ var _ = Describe("Presenters", func() {
 
 		It("prints the jobs in a table", func() {
 			Expect(presenters.PrintJobs(processes, output)).To(Succeed())
-			Expect(output).Should(gbytes.Say("Name\\s+Pid\\s+Status"))
-			Expect(output).Should(gbytes.Say(fmt.Sprintf("%s\\s+%d\\s+%s", "job-process-2", 23456, "created")))
-			Expect(output).Should(gbytes.Say(fmt.Sprintf("%s\\s+%d\\s+%s", "job-process-1", 34567, "running")))
-			Expect(output).Should(gbytes.Say(fmt.Sprintf("%s\\s+%s\\s+%s", "job-process-3", "-", "failed")))
+			Expect(output).Should(gbytes.Say("Name\\s+Pid\\s+Status\\s+OOM\\s+Override"))
+			Expect(output).Should(gbytes.Say(fmt.Sprintf("%s\\s+%d\\s+%s\\s+%s\\s+%s", "job-process-2", 23456, "created", "no", "no")))
+			Expect(output).Should(gbytes.Say(fmt.Sprintf("%s\\s+%d\\s+%s\\s+%s\\s+%s", "job-process-1", 34567, "running", "no", "yes")))
+			Expect(output).Should(gbytes.Say(fmt.Sprintf("%s\\s+%s\\s+%s\\s+%s\\s+%s", "job-process-3", "-", "failed", "yes", "no")))
+			Expect(output).Should(gbytes.Say(fmt.Sprintf("%s\\s+%s\\s+%s\\s+%s\\s+%s", "job-process-4", "-", "exited\\(0\\)", "no", "no")))
+			Expect(output).Should(gbytes.Say(fmt.Sprintf("%s\\s+%s\\s+%s\\s+%s\\s+%s", "job-process-5", "-", "failed\\(2\\)", "no", "no")))
+		})
+
+		It("prints when running processes were started and their uptime", func() {
+			startedAt := time.Now().Add(-90 * time.Minute)
+			processes = []*models.Process{
+				{Name: jobid.Encode("job-process-1"), Pid: 34567, Status: "running", StartedAt: startedAt},
+				{Name: jobid.Encode("job-process-2"), Pid: 0, Status: "failed", StartedAt: startedAt},
+			}
+
+			Expect(presenters.PrintJobs(processes, output)).To(Succeed())
+			Expect(output).Should(gbytes.Say("Name\\s+Pid\\s+Status\\s+OOM\\s+Override\\s+Started\\s+Uptime"))
+			Expect(output).Should(gbytes.Say(fmt.Sprintf("job-process-1\\s+34567\\s+running\\s+no\\s+no\\s+%s\\s+1h30m\\d+s\\n", startedAt.UTC().Format(time.RFC3339))))
+			Expect(output).Should(gbytes.Say(fmt.Sprintf("job-process-2\\s+-\\s+failed\\s+no\\s+no\\s+%s\\s+-\\n", startedAt.UTC().Format(time.RFC3339))))
+		})
+
+		It("prints the termination message of an exited process", func() {
+			processes = []*models.Process{
+				{
+					Name:               jobid.Encode("job-process-1"),
+					Status:             "failed",
+					ExitStatus:         intPtr(1),
+					TerminationMessage: "could not connect to database\nafter 3 attempts",
+				},
+			}
+
+			Expect(presenters.PrintJobs(processes, output)).To(Succeed())
+			Expect(output).Should(gbytes.Say("job-process-1\\s+-\\s+failed\\(1\\)"))
+			Expect(output).Should(gbytes.Say("Termination message of job-process-1:\n"))
+			Expect(output).Should(gbytes.Say("  could not connect to database\n  after 3 attempts\n"))
+		})
+
+		It("prints whether the process is listening on its ports", func() {
+			processes = []*models.Process{
+				{
+					Name:   jobid.Encode("job-process-1"),
+					Status: "running",
+					Ports: []models.PortCheck{
+						{Port: "8080/tcp", Listening: true},
+						{Port: "53/udp"},
+					},
+				},
+			}
+
+			Expect(presenters.PrintJobs(processes, output)).To(Succeed())
+			Expect(output).Should(gbytes.Say("Ports of job-process-1:\n"))
+			Expect(output).Should(gbytes.Say("  8080/tcp listening\n  53/udp not listening\n"))
+		})
+
+		It("prints the metrics of bpm's operations when they are present", func() {
+			processes = []*models.Process{
+				{
+					Name:   jobid.Encode("job-process-1"),
+					Status: "running",
+					Internal: &metrics.Metrics{
+						Start:        metrics.Timing{Count: 2, LastSeconds: 1.5, TotalSeconds: 2.25},
+						StopTimeouts: 1,
+					},
+				},
+			}
+
+			Expect(presenters.PrintJobs(processes, output)).To(Succeed())
+			Expect(output).Should(gbytes.Say("job-process-1"))
+			Expect(output).Should(gbytes.Say("Operation\\s+Count\\s+Last\\s+Total\\n"))
+			Expect(output).Should(gbytes.Say("start\\s+2\\s+1.5s\\s+2.25s\\n"))
+			Expect(output).Should(gbytes.Say("stop\\s+0\\s+0s\\s+0s\\n"))
+			Expect(output).Should(gbytes.Say("stop-timeout\\s+1\\s+-\\s+-\\n"))
+		})
+	})
+
+	Describe("PrintJobsWide", func() {
+		It("also prints the container ID and paths of the jobs", func() {
+			processes := []*models.Process{
+				{
+					Name:       jobid.Encode("job.process-1"),
+					Pid:        34567,
+					Status:     "running",
+					BundlePath: "/var/vcap/data/bpm/bundles/job/process-1",
+					ConfigPath: "/var/vcap/jobs/job/config/bpm.yml",
+					CgroupPath: "/" + jobid.Encode("job.process-1"),
+				},
+				{
+					Name:       jobid.Encode("adopted"),
+					Pid:        45678,
+					Status:     "adopted",
+					ConfigPath: "/var/vcap/jobs/adopted/config/bpm.yml",
+				},
+			}
+
+			output := gbytes.NewBuffer()
+			Expect(presenters.PrintJobsWide(processes, output)).To(Succeed())
+			Expect(output).Should(gbytes.Say("Name\\s+Pid\\s+Status\\s+OOM\\s+Override\\s+Started\\s+Uptime\\s+Container ID\\s+Bundle\\s+Config\\s+Cgroup"))
+			Expect(output).Should(gbytes.Say(fmt.Sprintf(
+				"job.process-1\\s+34567\\s+running\\s+no\\s+no\\s+-\\s+-\\s+%s\\s+%s\\s+%s\\s+/%s",
+				jobid.Encode("job.process-1"),
+				"/var/vcap/data/bpm/bundles/job/process-1",
+				"/var/vcap/jobs/job/config/bpm.yml",
+				jobid.Encode("job.process-1"),
+			)))
+			Expect(output).Should(gbytes.Say(fmt.Sprintf(
+				"adopted\\s+45678\\s+adopted\\s+no\\s+no\\s+-\\s+-\\s+%s\\s+-\\s+%s\\s+-",
+				jobid.Encode("adopted"),
+				"/var/vcap/jobs/adopted/config/bpm.yml",
+			)))
+		})
+	})
+
+	Describe("PrintJobsJSON", func() {
+		It("prints the jobs as JSON", func() {
+			processes := []*models.Process{
+				{
+					Name:   jobid.Encode("job-process-1"),
+					Pid:    34567,
+					Status: "running",
+					Labels: map[string]string{"org.cloudfoundry.release": "example"},
+
+					Overridden: true,
+					CgroupPath: "/system.slice/runc-job-process-1.scope",
+				},
+				{Name: jobid.Encode("job-process-2"), Pid: 0, Status: "failed", OOMKilled: true, ExitStatus: intPtr(137)},
+			}
+
+			output := gbytes.NewBuffer()
+			Expect(presenters.PrintJobsJSON(processes, output)).To(Succeed())
+			Expect(output.Contents()).To(MatchJSON(`[
+				{"name": "job-process-1", "pid": 34567, "status": "running", "labels": {"org.cloudfoundry.release": "example"}, "oom_killed": false, "overridden": true, "cgroup_path": "/system.slice/runc-job-process-1.scope"},
+				{"name": "job-process-2", "pid": 0, "status": "failed", "labels": {}, "exit_status": 137, "oom_killed": true, "overridden": false}
+			]`))
+		})
+
+		It("includes when the process was created and started", func() {
+			createdAt := time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+			startedAt := createdAt.Add(2 * time.Second)
+			processes := []*models.Process{
+				{Name: jobid.Encode("job-process-1"), Status: "failed", CreatedAt: createdAt, StartedAt: startedAt},
+			}
+
+			output := gbytes.NewBuffer()
+			Expect(presenters.PrintJobsJSON(processes, output)).To(Succeed())
+			Expect(output.Contents()).To(MatchJSON(`[
+				{"name": "job-process-1", "pid": 0, "status": "failed", "labels": {}, "oom_killed": false, "overridden": false, "created_at": "2021-03-04T05:06:07Z", "started_at": "2021-03-04T05:06:09Z"}
+			]`))
+		})
+
+		It("includes whether the process is listening on its ports", func() {
+			processes := []*models.Process{
+				{Name: jobid.Encode("job-process-1"), Status: "running", Ports: []models.PortCheck{{Port: "8080/tcp"}}},
+			}
+
+			output := gbytes.NewBuffer()
+			Expect(presenters.PrintJobsJSON(processes, output)).To(Succeed())
+			Expect(output.Contents()).To(MatchJSON(`[
+				{"name": "job-process-1", "pid": 0, "status": "running", "labels": {}, "oom_killed": false, "overridden": false, "ports": [{"port": "8080/tcp", "listening": false}]}
+			]`))
+		})
+
+		It("includes the termination message of an exited process", func() {
+			processes := []*models.Process{
+				{Name: jobid.Encode("job-process-1"), Status: "failed", ExitStatus: intPtr(1), TerminationMessage: "out of disk"},
+			}
+
+			output := gbytes.NewBuffer()
+			Expect(presenters.PrintJobsJSON(processes, output)).To(Succeed())
+			Expect(output.Contents()).To(MatchJSON(`[
+				{"name": "job-process-1", "pid": 0, "status": "failed", "labels": {}, "exit_status": 1, "termination_message": "out of disk", "oom_killed": false, "overridden": false}
+			]`))
+		})
+
+		It("includes the metrics of bpm's operations when they are present", func() {
+			processes := []*models.Process{
+				{Name: jobid.Encode("job-process-1"), Status: "stopped", Internal: &metrics.Metrics{CleanupFailures: 3}},
+			}
+
+			output := gbytes.NewBuffer()
+			Expect(presenters.PrintJobsJSON(processes, output)).To(Succeed())
+			Expect(output.Contents()).To(MatchJSON(`[
+				{"name": "job-process-1", "pid": 0, "status": "stopped", "labels": {}, "oom_killed": false, "overridden": false, "internal": {
+					"job": "", "process": "",
+					"start": {"count": 0, "total_seconds": 0, "last_seconds": 0},
+					"stop": {"count": 0, "total_seconds": 0, "last_seconds": 0},
+					"lock_wait": {"count": 0, "total_seconds": 0, "last_seconds": 0},
+					"start_failures": 0, "stop_timeouts": 0, "cleanup_failures": 3
+				}}
+			]`))
+		})
+	})
+
+	Describe("PrintLimitChecks", func() {
+		checks := []models.LimitCheck{
+			{Limit: "RLIMIT_NOFILE", Expected: "1024/1024", Actual: "1024/1024", Matches: true},
+			{Limit: "pids", Expected: "100", Actual: "unlimited"},
+		}
+
+		It("prints whether each limit matches", func() {
+			output := gbytes.NewBuffer()
+			Expect(presenters.PrintLimitChecks(checks, output)).To(Succeed())
+			Expect(output).To(gbytes.Say("Limit\\s+Expected\\s+Actual\\s+Status\n"))
+			Expect(output).To(gbytes.Say("RLIMIT_NOFILE\\s+1024/1024\\s+1024/1024\\s+ok\n"))
+			Expect(output).To(gbytes.Say("pids\\s+100\\s+unlimited\\s+differs\n"))
+		})
+
+		It("prints the checks as JSON", func() {
+			output := gbytes.NewBuffer()
+			Expect(presenters.PrintLimitChecksJSON(checks, output)).To(Succeed())
+			Expect(output.Contents()).To(MatchJSON(`[
+				{"limit": "RLIMIT_NOFILE", "expected": "1024/1024", "actual": "1024/1024", "matches": true},
+				{"limit": "pids", "expected": "100", "actual": "unlimited", "matches": false}
+			]`))
+		})
+	})
+
+	Describe("PrintHostChecks", func() {
+		checks := []models.HostCheck{
+			{Check: "locks", Path: "/var/vcap/data/bpm/locks", OK: true},
+			{Check: "logs", Path: "/var/vcap/sys/log", Problem: "/var/vcap is on a read-only filesystem"},
+		}
+
+		It("prints the status of each check", func() {
+			output := gbytes.NewBuffer()
+			Expect(presenters.PrintHostChecks(checks, output)).To(Succeed())
+			Expect(output).To(gbytes.Say("Check\\s+Path\\s+Status\n"))
+			Expect(output).To(gbytes.Say("locks\\s+/var/vcap/data/bpm/locks\\s+ok\n"))
+			Expect(output).To(gbytes.Say("logs\\s+/var/vcap/sys/log\\s+/var/vcap is on a read-only filesystem\n"))
+		})
+
+		It("prints the checks as JSON", func() {
+			output := gbytes.NewBuffer()
+			Expect(presenters.PrintHostChecksJSON(checks, output)).To(Succeed())
+			Expect(output.Contents()).To(MatchJSON(`[
+				{"check": "locks", "path": "/var/vcap/data/bpm/locks", "ok": true},
+				{"check": "logs", "path": "/var/vcap/sys/log", "ok": false, "problem": "/var/vcap is on a read-only filesystem"}
+			]`))
+		})
+	})
+
+	Describe("PrintStats", func() {
+		var stats *models.Stats
+
+		BeforeEach(func() {
+			stats = &models.Stats{
+				CPU:    models.CPUStats{UsageNanoseconds: 1500000000, Periods: 20, ThrottledPeriods: 4, ThrottledNanoseconds: 250000000},
+				Memory: models.MemoryStats{UsageBytes: 1024 * 1024, MaxUsageBytes: 2 * 1024 * 1024, OOMKills: 1},
+				Pids:   models.PidsStats{Current: 3, Limit: 100},
+			}
+		})
+
+		It("prints the stats as a table", func() {
+			output := gbytes.NewBuffer()
+			Expect(presenters.PrintStats("server", stats, output)).To(Succeed())
+			Expect(output).To(gbytes.Say("Name\\s+CPU Time\\s+Throttled\\s+Throttled Time\\s+Memory\\s+Max Memory\\s+Memory Limit\\s+OOM Kills\\s+Pids\\s+Pids Limit\n"))
+			Expect(output).To(gbytes.Say("server\\s+1.5s\\s+4/20\\s+250ms\\s+1M\\s+2M\\s+-\\s+1\\s+3\\s+100\n"))
+		})
+
+		It("prints the stats as JSON", func() {
+			output := gbytes.NewBuffer()
+			Expect(presenters.PrintStatsJSON("server", stats, output)).To(Succeed())
+			Expect(output.Contents()).To(MatchJSON(`{
+				"name": "server",
+				"cpu": {"usage_ns": 1500000000, "periods": 20, "throttled_periods": 4, "throttled_ns": 250000000},
+				"memory": {"usage_bytes": 1048576, "max_usage_bytes": 2097152, "limit_bytes": 0, "oom_kills": 1},
+				"pids": {"current": 3, "limit": 100}
+			}`))
 		})
 	})
 })
@@ -0,0 +1,142 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+// Package reaper records the exit status of processes which are started in
+// the background. A container started with `runc run --detach` is orphaned
+// as soon as runc exits and its exit status is normally collected by the
+// host's init. The reaper runs runc as a child subreaper instead so that the
+// container's init process is re-parented to it and it can write the exit
+// status to a file once the process exits.
+package reaper
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// ExitFile returns the location of the file which records the exit status of
+// the process whose pid is written to pidFile.
+func ExitFile(pidFile string) string {
+	return strings.TrimSuffix(pidFile, filepath.Ext(pidFile)) + ".exit"
+}
+
+// ReadExitStatus returns the exit status recorded in path.
+func ReadExitStatus(path string) (int, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.Atoi(strings.TrimSpace(string(data)))
+}
+
+// WriteExitStatus records an exit status in path.
+func WriteExitStatus(path string, status int) error {
+	return ioutil.WriteFile(path, []byte(fmt.Sprintf("%d\n", status)), 0644)
+}
+
+// ExitStatus converts a wait status to the exit status a shell would report:
+// processes which were killed by a signal have an exit status of 128 plus
+// the signal number.
+func ExitStatus(ws syscall.WaitStatus) int {
+	if ws.Signaled() {
+		return 128 + int(ws.Signal())
+	}
+
+	return ws.ExitStatus()
+}
+
+// Run runs command, which is expected to start a process in the background
+// and write its pid to pidFile, as a child subreaper. The exit status of the
+// command is written to ready as soon as it is known and ready is closed.
+// If the command succeeded Run then waits for the background process to exit
+// and records its exit status in exitFile. It returns the exit status of the
+// command.
+func Run(pidFile, exitFile string, ready io.WriteCloser, stdout, stderr io.Writer, command []string) (int, error) {
+	if err := os.Remove(exitFile); err != nil && !os.IsNotExist(err) {
+		ready.Close()
+		return 1, err
+	}
+
+	if err := unix.Prctl(unix.PR_SET_CHILD_SUBREAPER, 1, 0, 0, 0); err != nil {
+		ready.Close()
+		return 1, fmt.Errorf("failed to become a subreaper: %s", err)
+	}
+
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	status := 0
+	if err := cmd.Run(); err != nil {
+		ws, ok := cmd.ProcessState.Sys().(syscall.WaitStatus)
+		if !ok {
+			ready.Close()
+			return 1, err
+		}
+		status = ExitStatus(ws)
+	}
+
+	fmt.Fprintf(ready, "%d\n", status)
+	ready.Close()
+
+	if status != 0 {
+		return status, nil
+	}
+
+	data, err := ioutil.ReadFile(pidFile)
+	if err != nil {
+		return 0, err
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0, fmt.Errorf("invalid pid file: %s", err)
+	}
+
+	return 0, waitFor(pid, exitFile)
+}
+
+// waitFor reaps children until there are none left, recording the exit
+// status of pid when it exits. Other orphans in the container are reaped by
+// its own init, but anything which escapes it is also collected here.
+func waitFor(pid int, exitFile string) error {
+	for {
+		var ws unix.WaitStatus
+		wpid, err := unix.Wait4(-1, &ws, 0, nil)
+		if err == unix.EINTR {
+			continue
+		} else if err == unix.ECHILD {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if wpid == pid {
+			if err := WriteExitStatus(exitFile, ExitStatus(syscall.WaitStatus(ws))); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package reaper_test
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"bpm/reaper"
+)
+
+type closingBuffer struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (b *closingBuffer) Close() error {
+	b.closed = true
+	return nil
+}
+
+var _ = Describe("Reaper", func() {
+	Describe("ExitFile", func() {
+		It("is next to the pid file", func() {
+			Expect(reaper.ExitFile("/var/vcap/sys/run/bpm/job/proc.pid")).To(Equal("/var/vcap/sys/run/bpm/job/proc.exit"))
+		})
+	})
+
+	Describe("Run", func() {
+		var (
+			dir      string
+			pidFile  string
+			exitFile string
+			ready    *closingBuffer
+		)
+
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "reaper")
+			Expect(err).NotTo(HaveOccurred())
+
+			pidFile = filepath.Join(dir, "proc.pid")
+			exitFile = reaper.ExitFile(pidFile)
+			ready = &closingBuffer{}
+		})
+
+		AfterEach(func() {
+			Expect(os.RemoveAll(dir)).To(Succeed())
+		})
+
+		It("records the exit status of the orphaned background process", func() {
+			Expect(reaper.WriteExitStatus(exitFile, 99)).To(Succeed())
+
+			script := fmt.Sprintf(`sh -c 'sleep 0.2; exit 7' & echo $! > %s`, pidFile)
+			status, err := reaper.Run(pidFile, exitFile, ready, GinkgoWriter, GinkgoWriter, []string{"/bin/sh", "-c", script})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(status).To(Equal(0))
+
+			Expect(ready.String()).To(Equal("0\n"))
+			Expect(ready.closed).To(BeTrue())
+
+			Expect(reaper.ReadExitStatus(exitFile)).To(Equal(7))
+		})
+
+		It("records processes killed by a signal like a shell would", func() {
+			script := fmt.Sprintf(`sh -c 'sleep 0.1; kill -9 $$' & echo $! > %s`, pidFile)
+			_, err := reaper.Run(pidFile, exitFile, ready, GinkgoWriter, GinkgoWriter, []string{"/bin/sh", "-c", script})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(reaper.ReadExitStatus(exitFile)).To(Equal(137))
+		})
+
+		Context("when the command fails", func() {
+			It("reports its exit status and does not wait", func() {
+				status, err := reaper.Run(pidFile, exitFile, ready, GinkgoWriter, GinkgoWriter, []string{"/bin/sh", "-c", "exit 3"})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(status).To(Equal(3))
+
+				Expect(ready.String()).To(Equal("3\n"))
+				Expect(exitFile).NotTo(BeAnExistingFile())
+			})
+		})
+	})
+})
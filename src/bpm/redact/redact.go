@@ -0,0 +1,126 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+// Package redact hides the values of sensitive environment variables from
+// bpm's own diagnostic output.
+package redact
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+
+	"code.cloudfoundry.org/lager"
+)
+
+// Placeholder is shown in place of a sensitive value.
+const Placeholder = "[REDACTED]"
+
+// MinLength is the length of the shortest value which is redacted from log
+// lines. Shorter values such as "1" or "true" would otherwise mask unrelated
+// parts of almost every line.
+const MinLength = 4
+
+// Sink is a lager sink which replaces every occurrence of a set of sensitive
+// values in log lines with Placeholder before passing them on. Values can be
+// added after the sink has been registered as they often only become known
+// once the job configuration has been read.
+type Sink struct {
+	sink lager.Sink
+
+	mu     sync.RWMutex
+	values []string
+}
+
+func NewSink(sink lager.Sink) *Sink {
+	return &Sink{sink: sink}
+}
+
+// Add adds values which must not appear in the log. Values shorter than
+// MinLength are ignored.
+func (s *Sink) Add(values ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, value := range values {
+		if len(value) >= MinLength {
+			s.values = append(s.values, value)
+		}
+	}
+
+	// Longer values are replaced first so that a value which contains
+	// another is not left partially visible.
+	sort.Slice(s.values, func(i, j int) bool {
+		return len(s.values[i]) > len(s.values[j])
+	})
+}
+
+func (s *Sink) Log(log lager.LogFormat) {
+	s.mu.RLock()
+	values := s.values
+	s.mu.RUnlock()
+
+	if len(values) > 0 {
+		log.Message = String(log.Message, values)
+		log.Data = redactData(log.Data, values)
+		if log.Error != nil {
+			log.Error = errors.New(String(log.Error.Error(), values))
+		}
+	}
+
+	s.sink.Log(log)
+}
+
+// String replaces every occurrence of the values in s with Placeholder.
+func String(s string, values []string) string {
+	for _, value := range values {
+		s = strings.Replace(s, value, Placeholder, -1)
+	}
+
+	return s
+}
+
+// redactData replaces the values wherever they appear in the data, including
+// in nested structures, by working on its JSON form.
+func redactData(data lager.Data, values []string) lager.Data {
+	if len(data) == 0 {
+		return data
+	}
+
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return data
+	}
+
+	redacted := string(raw)
+	for _, value := range values {
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			continue
+		}
+
+		escaped := strings.TrimSuffix(strings.TrimPrefix(string(encoded), `"`), `"`)
+		redacted = strings.Replace(redacted, escaped, Placeholder, -1)
+	}
+
+	var result lager.Data
+	if err := json.Unmarshal([]byte(redacted), &result); err != nil {
+		return lager.Data{"redaction_error": err.Error()}
+	}
+
+	return result
+}
@@ -0,0 +1,89 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package redact_test
+
+import (
+	"errors"
+
+	"code.cloudfoundry.org/lager"
+	"code.cloudfoundry.org/lager/lagertest"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"bpm/redact"
+)
+
+var _ = Describe("Sink", func() {
+	var (
+		testSink *lagertest.TestSink
+		sink     *redact.Sink
+		logger   lager.Logger
+	)
+
+	BeforeEach(func() {
+		testSink = lagertest.NewTestSink()
+		sink = redact.NewSink(testSink)
+
+		logger = lager.NewLogger("redact")
+		logger.RegisterSink(sink)
+	})
+
+	It("passes log lines through unchanged when there is nothing to redact", func() {
+		logger.Info("starting", lager.Data{"password": "hunter22"})
+
+		Expect(testSink.Logs()).To(HaveLen(1))
+		Expect(testSink.Logs()[0].Data).To(HaveKeyWithValue("password", "hunter22"))
+	})
+
+	It("replaces sensitive values in messages, data, and errors", func() {
+		sink.Add("hunter22", `p"ss\word`)
+
+		logger.Error("failed-hunter22", errors.New("bad password hunter22"), lager.Data{
+			"nested": map[string]interface{}{"value": `my p"ss\word`},
+			"list":   []string{"hunter22"},
+		})
+
+		Expect(testSink.Logs()).To(HaveLen(1))
+		log := testSink.Logs()[0]
+		Expect(log.Message).To(Equal("redact.failed-[REDACTED]"))
+		Expect(log.Data).To(HaveKeyWithValue("error", "bad password [REDACTED]"))
+		Expect(log.Data).To(HaveKeyWithValue("nested", map[string]interface{}{"value": "my [REDACTED]"}))
+		Expect(log.Data).To(HaveKeyWithValue("list", []interface{}{"[REDACTED]"}))
+	})
+
+	It("ignores values which are too short to redact usefully", func() {
+		sink.Add("1", "on")
+
+		logger.Info("starting", lager.Data{"attempt": "1", "enabled": "on"})
+
+		Expect(testSink.Logs()[0].Data).To(Equal(lager.Data{"attempt": "1", "enabled": "on"}))
+	})
+
+	It("replaces longer values before the values they contain", func() {
+		sink.Add("secret", "secret-suffix")
+
+		logger.Info("starting", lager.Data{"value": "secret-suffix"})
+
+		Expect(testSink.Logs()[0].Data).To(HaveKeyWithValue("value", "[REDACTED]"))
+	})
+})
+
+var _ = Describe("String", func() {
+	It("replaces every occurrence of every value", func() {
+		Expect(redact.String("a=hunter22 b=letmein c=hunter22", []string{"hunter22", "letmein"})).
+			To(Equal("a=[REDACTED] b=[REDACTED] c=[REDACTED]"))
+	})
+})
@@ -0,0 +1,181 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+// Package registration registers processes with whatever discovers them,
+// such as a service discovery agent, once they are ready, and deregisters
+// them before they are stopped. Registration is done by writing a file which
+// the agent watches or by running a script with a description of the process
+// in its environment.
+package registration
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"bpm/bosh"
+	"bpm/config"
+	"bpm/helpers"
+)
+
+// HelperKind is the kind of the helper which waits for a process to be ready
+// before registering it.
+const HelperKind = "register"
+
+const (
+	Register   = "register"
+	Deregister = "deregister"
+)
+
+// Info describes the process being registered to a script.
+type Info struct {
+	Job      string
+	Process  string
+	Pid      int
+	Ports    []config.Port
+	Instance *bosh.Instance
+}
+
+// Env returns the environment which describes the process to a script, in
+// addition to bpm's own environment.
+func (i Info) Env(action string) []string {
+	ports := make([]string, len(i.Ports))
+	for n, port := range i.Ports {
+		ports[n] = port.String()
+	}
+
+	env := []string{
+		"BPM_ACTION=" + action,
+		"BPM_JOB=" + i.Job,
+		"BPM_PROCESS=" + i.Process,
+		"BPM_PID=" + strconv.Itoa(i.Pid),
+		"BPM_PORTS=" + strings.Join(ports, " "),
+	}
+
+	if i.Instance != nil {
+		env = append(env,
+			"BPM_INSTANCE_ID="+i.Instance.ID,
+			"BPM_INSTANCE_INDEX="+strconv.Itoa(i.Instance.Index),
+		)
+	}
+
+	return env
+}
+
+// Run carries out action, Register or Deregister, with integration. Files
+// are replaced atomically so that an agent never reads half of one, and a
+// file which is already gone is not an error when deregistering.
+func Run(ctx context.Context, integration *config.Integration, action string, info Info) error {
+	switch integration.Type {
+	case config.IntegrationFile:
+		if action == Deregister {
+			if err := os.Remove(integration.Path); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			return nil
+		}
+
+		return writeFile(integration.Path, integration.Contents)
+	case config.IntegrationScript:
+		return runScript(ctx, integration, action, info)
+	default:
+		return fmt.Errorf("unknown integration type %q", integration.Type)
+	}
+}
+
+func writeFile(path, contents string) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(dir, "."+filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.WriteString(contents); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+func runScript(ctx context.Context, integration *config.Integration, action string, info Info) error {
+	timeout, err := integration.TimeoutDuration()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var output bytes.Buffer
+	cmd := exec.Command(integration.Path, action)
+	cmd.Env = append(os.Environ(), info.Env(action)...)
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	// The script is run in its own process group so that anything it has
+	// started is killed along with it.
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		case <-done:
+		}
+	}()
+
+	err = cmd.Wait()
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("%s did not finish within %s", integration.Path, timeout)
+	} else if err != nil {
+		return fmt.Errorf("%s: %s: %s", integration.Path, err, strings.TrimSpace(output.String()))
+	}
+
+	return nil
+}
+
+// Start starts the helper which waits for the process to be ready and then
+// registers it, so that bpm start does not have to wait for a process which
+// is slow to become ready.
+func Start(bpmCfg *config.BPMConfig) error {
+	return helpers.Start(bpmCfg.HelpersDir().External(), HelperKind, "register", bpmCfg.JobName(), "--process", bpmCfg.ProcName())
+}
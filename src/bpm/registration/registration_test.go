@@ -0,0 +1,132 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package registration_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"bpm/bosh"
+	"bpm/config"
+	"bpm/registration"
+)
+
+var _ = Describe("Registration", func() {
+	var (
+		dir  string
+		info registration.Info
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "registration")
+		Expect(err).NotTo(HaveOccurred())
+
+		info = registration.Info{
+			Job:      "example",
+			Process:  "server",
+			Pid:      1234,
+			Ports:    []config.Port{{Port: 8080}, {Port: 53, Protocol: "udp"}},
+			Instance: &bosh.Instance{ID: "abc-123", Index: 2},
+		}
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dir)).To(Succeed())
+	})
+
+	Describe("files", func() {
+		var integration *config.Integration
+
+		BeforeEach(func() {
+			integration = &config.Integration{
+				Type:     config.IntegrationFile,
+				Path:     filepath.Join(dir, "services", "server.json"),
+				Contents: `{"name":"server"}`,
+			}
+		})
+
+		It("writes the file to register and removes it to deregister", func() {
+			Expect(registration.Run(context.Background(), integration, registration.Register, info)).To(Succeed())
+
+			contents, err := ioutil.ReadFile(integration.Path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(contents)).To(Equal(`{"name":"server"}`))
+
+			stat, err := os.Stat(integration.Path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(stat.Mode().Perm()).To(Equal(os.FileMode(0644)))
+
+			Expect(registration.Run(context.Background(), integration, registration.Deregister, info)).To(Succeed())
+			Expect(integration.Path).NotTo(BeAnExistingFile())
+		})
+
+		It("leaves nothing else in the directory", func() {
+			Expect(registration.Run(context.Background(), integration, registration.Register, info)).To(Succeed())
+
+			entries, err := ioutil.ReadDir(filepath.Dir(integration.Path))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(entries).To(HaveLen(1))
+		})
+
+		It("does not fail to deregister a process which was never registered", func() {
+			Expect(registration.Run(context.Background(), integration, registration.Deregister, info)).To(Succeed())
+		})
+	})
+
+	Describe("scripts", func() {
+		var integration *config.Integration
+
+		writeScript := func(body string) {
+			integration = &config.Integration{
+				Type: config.IntegrationScript,
+				Path: filepath.Join(dir, "register"),
+			}
+			Expect(ioutil.WriteFile(integration.Path, []byte("#!/bin/sh\n"+body), 0755)).To(Succeed())
+		}
+
+		It("describes the process in the script's environment", func() {
+			out := filepath.Join(dir, "out")
+			writeScript(`echo "$1 $BPM_ACTION $BPM_JOB $BPM_PROCESS $BPM_PID [$BPM_PORTS] $BPM_INSTANCE_ID $BPM_INSTANCE_INDEX" > ` + out)
+
+			Expect(registration.Run(context.Background(), integration, registration.Deregister, info)).To(Succeed())
+
+			contents, err := ioutil.ReadFile(out)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(contents)).To(Equal("deregister deregister example server 1234 [8080/tcp 53/udp] abc-123 2\n"))
+		})
+
+		It("returns the output of a script which fails", func() {
+			writeScript("echo agent unavailable >&2; exit 3")
+
+			err := registration.Run(context.Background(), integration, registration.Register, info)
+			Expect(err).To(MatchError(ContainSubstring("exit status 3: agent unavailable")))
+		})
+
+		It("kills a script which runs past its timeout", func() {
+			writeScript("sleep 10")
+			integration.Timeout = "100ms"
+
+			err := registration.Run(context.Background(), integration, registration.Register, info)
+			Expect(err).To(MatchError(ContainSubstring("did not finish within 100ms")))
+		})
+	})
+})
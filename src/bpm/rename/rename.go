@@ -0,0 +1,182 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+// Package rename moves the state which a job has on the host to a new name.
+// BOSH treats a renamed job as a new job, so without this its processes
+// would start with empty data and log directories under the new name while
+// their old state is left behind.
+package rename
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"bpm/bosh"
+	"bpm/config"
+)
+
+// Move is a file or directory which is renamed.
+type Move struct {
+	From string
+	To   string
+}
+
+// Plan contains everything which needs to happen to rename a job. The
+// bundles and pid files of its processes are removed rather than moved as
+// they are recreated under the new name when the processes are next started.
+type Plan struct {
+	OldJob    string
+	NewJob    string
+	Processes []string
+	Moves     []Move
+	Removals  []string
+}
+
+// NewPlan works out how to rename the job oldJob to newJob. It returns an
+// error rather than a plan which would overwrite any of the new job's state.
+func NewPlan(env *bosh.Env, oldJob, newJob string) (*Plan, error) {
+	for _, name := range []string{oldJob, newJob} {
+		if name == "" || name == "." || name == ".." || strings.Contains(name, "/") {
+			return nil, fmt.Errorf("invalid job name: %q", name)
+		}
+	}
+
+	if oldJob == newJob {
+		return nil, fmt.Errorf("job %s already has that name", oldJob)
+	}
+
+	procs, err := subdirectories(filepath.Join(config.BundlesRoot(env), oldJob))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	oldCfg := config.NewBPMConfig(env, oldJob, "")
+	newCfg := config.NewBPMConfig(env, newJob, "")
+
+	plan := &Plan{OldJob: oldJob, NewJob: newJob, Processes: procs}
+	moves := []Move{
+		{oldCfg.DataDir().External(), newCfg.DataDir().External()},
+		{oldCfg.StoreDir().External(), newCfg.StoreDir().External()},
+		{oldCfg.LogDir().External(), newCfg.LogDir().External()},
+		{filepath.Dir(oldCfg.OverrideConfig()), filepath.Dir(newCfg.OverrideConfig())},
+	}
+
+	for _, proc := range procs {
+		oldProc := config.NewBPMConfig(env, oldJob, proc)
+		newProc := config.NewBPMConfig(env, newJob, proc)
+
+		moves = append(moves,
+			Move{oldProc.StatusFile(), newProc.StatusFile()},
+			Move{oldProc.MetricsFile(), newProc.MetricsFile()},
+		)
+	}
+
+	for _, m := range moves {
+		if !exists(m.From) {
+			continue
+		}
+
+		empty, err := isEmpty(m.To)
+		if err != nil {
+			return nil, err
+		}
+
+		if !empty {
+			return nil, fmt.Errorf("%s already exists", m.To)
+		}
+
+		plan.Moves = append(plan.Moves, m)
+	}
+
+	for _, path := range []string{filepath.Join(config.BundlesRoot(env), oldJob), oldCfg.PidDir().External()} {
+		if exists(path) {
+			plan.Removals = append(plan.Removals, path)
+		}
+	}
+
+	return plan, nil
+}
+
+// Apply carries out the plan. Everything is renamed within its own parent
+// directory and so stays on the same filesystem: nothing is copied.
+func (p *Plan) Apply() error {
+	for _, m := range p.Moves {
+		if err := os.RemoveAll(m.To); err != nil {
+			return err
+		}
+
+		if err := os.MkdirAll(filepath.Dir(m.To), 0755); err != nil {
+			return err
+		}
+
+		if err := os.Rename(m.From, m.To); err != nil {
+			return err
+		}
+	}
+
+	for _, path := range p.Removals {
+		if err := os.RemoveAll(path); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// isEmpty returns whether path is missing or is an empty directory, which
+// can be replaced without losing anything.
+func isEmpty(path string) (bool, error) {
+	fi, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	if !fi.IsDir() {
+		return false, nil
+	}
+
+	infos, err := ioutil.ReadDir(path)
+	if err != nil {
+		return false, err
+	}
+
+	return len(infos) == 0, nil
+}
+
+func exists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
+
+func subdirectories(dir string) ([]string, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, info := range infos {
+		if info.IsDir() {
+			names = append(names, info.Name())
+		}
+	}
+
+	return names, nil
+}
@@ -0,0 +1,112 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package rename_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"bpm/bosh"
+	"bpm/config"
+	"bpm/rename"
+)
+
+var _ = Describe("Rename", func() {
+	var (
+		root   string
+		env    *bosh.Env
+		oldCfg *config.BPMConfig
+		newCfg *config.BPMConfig
+	)
+
+	write := func(path, contents string) {
+		Expect(os.MkdirAll(filepath.Dir(path), 0755)).To(Succeed())
+		Expect(ioutil.WriteFile(path, []byte(contents), 0644)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		var err error
+		root, err = ioutil.TempDir("", "rename")
+		Expect(err).NotTo(HaveOccurred())
+
+		env = bosh.NewEnv(root)
+		oldCfg = config.NewBPMConfig(env, "old-job", "worker")
+		newCfg = config.NewBPMConfig(env, "new-job", "worker")
+
+		Expect(os.MkdirAll(oldCfg.RootFSPath(), 0755)).To(Succeed())
+		write(oldCfg.DataDir().Join("cache").External(), "cached")
+		write(oldCfg.Stdout().External(), "logs")
+		write(oldCfg.PidFile().External(), "1234")
+		write(oldCfg.StatusFile(), "state=stopped\n")
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(root)).To(Succeed())
+	})
+
+	It("moves the state of the job to its new name", func() {
+		plan, err := rename.NewPlan(env, "old-job", "new-job")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(plan.Processes).To(ConsistOf("worker"))
+		Expect(plan.Moves).To(ConsistOf(
+			rename.Move{From: oldCfg.DataDir().External(), To: newCfg.DataDir().External()},
+			rename.Move{From: oldCfg.LogDir().External(), To: newCfg.LogDir().External()},
+			rename.Move{From: oldCfg.StatusFile(), To: newCfg.StatusFile()},
+		))
+		Expect(plan.Removals).To(ConsistOf(
+			filepath.Join(config.BundlesRoot(env), "old-job"),
+			oldCfg.PidDir().External(),
+		))
+
+		Expect(plan.Apply()).To(Succeed())
+
+		Expect(ioutil.ReadFile(newCfg.DataDir().Join("cache").External())).To(Equal([]byte("cached")))
+		Expect(ioutil.ReadFile(newCfg.Stdout().External())).To(Equal([]byte("logs")))
+		Expect(ioutil.ReadFile(newCfg.StatusFile())).To(Equal([]byte("state=stopped\n")))
+		Expect(oldCfg.DataDir().External()).NotTo(BeADirectory())
+		Expect(oldCfg.LogDir().External()).NotTo(BeADirectory())
+		Expect(oldCfg.BundlePath()).NotTo(BeADirectory())
+		Expect(oldCfg.PidFile().External()).NotTo(BeAnExistingFile())
+	})
+
+	It("replaces empty directories of the new job", func() {
+		Expect(os.MkdirAll(newCfg.DataDir().External(), 0755)).To(Succeed())
+
+		plan, err := rename.NewPlan(env, "old-job", "new-job")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(plan.Apply()).To(Succeed())
+
+		Expect(ioutil.ReadFile(newCfg.DataDir().Join("cache").External())).To(Equal([]byte("cached")))
+	})
+
+	It("refuses to overwrite the state of the new job", func() {
+		write(newCfg.DataDir().Join("other").External(), "precious")
+
+		_, err := rename.NewPlan(env, "old-job", "new-job")
+		Expect(err).To(MatchError(newCfg.DataDir().External() + " already exists"))
+	})
+
+	It("rejects invalid names", func() {
+		for _, name := range []string{"", "..", "a/b", "old-job"} {
+			_, err := rename.NewPlan(env, "old-job", name)
+			Expect(err).To(HaveOccurred(), name)
+		}
+	})
+})
@@ -16,18 +16,28 @@
 package adapter
 
 import (
+	"crypto/sha256"
 	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 
-	"code.cloudfoundry.org/bytefmt"
 	"code.cloudfoundry.org/lager"
 	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"golang.org/x/sys/unix"
 
 	"bpm/config"
+	"bpm/coredump"
 	"bpm/hostlock"
+	"bpm/logsink"
+	"bpm/runc/client"
 	"bpm/runc/specbuilder"
+	"bpm/sockets"
 	"bpm/sysfeat"
 )
 
@@ -36,6 +46,32 @@ const (
 	defaultLang   = "en_US.UTF-8"
 )
 
+// CPUPeriod is the scheduling period in microseconds which a process with a
+// CPU limit is given its share of CPU time in, unless its limits set another.
+const CPUPeriod = 100000
+
+// zoneinfoDir is where the host's timezone database is installed. It is
+// visible inside every container through the /usr mount.
+var zoneinfoDir = "/usr/share/zoneinfo"
+
+// hostMachineIDFile identifies the host when there is no BOSH instance to
+// derive the machine IDs of containers from.
+var hostMachineIDFile = "/etc/machine-id"
+
+// numaNodeDir is where the kernel describes the host's NUMA topology.
+var numaNodeDir = "/sys/devices/system/node"
+
+// cpuDir is where the kernel lists the CPUs of the host which are online.
+var cpuDir = "/sys/devices/system/cpu"
+
+// hugepagesDir has an entry for each size of huge page which the host
+// supports.
+var hugepagesDir = "/sys/kernel/mm/hugepages"
+
+// sysBlockDir has an entry for each block device on the host, named by its
+// device number, which says whether it is a partition of another.
+var sysBlockDir = "/sys/dev/block"
+
 // GlobFunc is a function which when given a file path pattern returns a list
 // of paths or an error if the search failed.
 type GlobFunc func(string) ([]string, error)
@@ -46,19 +82,40 @@ type VolumeLocker interface {
 	LockVolume(string) (hostlock.LockedLock, error)
 }
 
+// ClassStore holds the net_cls class IDs of containers which limit their
+// egress rate. Allocate gives a container an ID which no other container
+// holds, or returns the one which it already holds. Lookup returns the ID
+// which a container holds, if any.
+type ClassStore interface {
+	Allocate(containerID string) (uint32, error)
+	Lookup(containerID string) (uint32, bool, error)
+}
+
+// SecretStore fetches the values of secrets which are referenced from a
+// process's environment.
+type SecretStore interface {
+	Get(name string) (string, error)
+}
+
 type RuncAdapter struct {
 	features   sysfeat.Features
 	glob       GlobFunc
 	shareMount MountShare
 	locker     VolumeLocker
+	secrets    SecretStore
+	classes    ClassStore
 }
 
-func NewRuncAdapter(features sysfeat.Features, glob GlobFunc, mountSharer MountShare, locker VolumeLocker) *RuncAdapter {
+// NewRuncAdapter creates a RuncAdapter. The SecretStore may be nil if no
+// secret store has been configured on this host.
+func NewRuncAdapter(features sysfeat.Features, glob GlobFunc, mountSharer MountShare, locker VolumeLocker, secrets SecretStore, classes ClassStore) *RuncAdapter {
 	return &RuncAdapter{
 		features:   features,
 		glob:       glob,
 		shareMount: mountSharer,
 		locker:     locker,
+		secrets:    secrets,
+		classes:    classes,
 	}
 }
 
@@ -66,7 +123,7 @@ func (a *RuncAdapter) CreateJobPrerequisites(
 	bpmCfg *config.BPMConfig,
 	procCfg *config.ProcessConfig,
 	user specs.User,
-) (*os.File, *os.File, error) {
+) (io.WriteCloser, io.WriteCloser, error) {
 	err := os.MkdirAll(bpmCfg.PidDir().External(), 0700)
 	if err != nil {
 		return nil, nil, err
@@ -74,8 +131,10 @@ func (a *RuncAdapter) CreateJobPrerequisites(
 
 	var dirsToCreate, pathsToChown []string
 	for _, vol := range procCfg.AdditionalVolumes {
+		hostPath := bpmCfg.HostPath(vol.Path)
+
 		if vol.Shared {
-			if err := a.makeShared(vol); err != nil {
+			if err := a.makeShared(hostPath); err != nil {
 				return nil, nil, err
 			}
 		}
@@ -84,18 +143,18 @@ func (a *RuncAdapter) CreateJobPrerequisites(
 			continue
 		}
 
-		fi, err := os.Stat(vol.Path)
+		fi, err := os.Stat(hostPath)
 		if os.IsNotExist(err) {
-			dirsToCreate = append(dirsToCreate, vol.Path)
+			dirsToCreate = append(dirsToCreate, hostPath)
 		} else if err != nil {
 			return nil, nil, err
 		} else if fi.IsDir() && fi.Mode() != 0700 {
-			if err := os.Chmod(vol.Path, 0700); err != nil {
+			if err := os.Chmod(hostPath, 0700); err != nil {
 				return nil, nil, err
 			}
 		}
 
-		pathsToChown = append(pathsToChown, vol.Path)
+		pathsToChown = append(pathsToChown, hostPath)
 	}
 
 	dirsToCreate = append(
@@ -133,17 +192,51 @@ func (a *RuncAdapter) CreateJobPrerequisites(
 		return nil, nil, err
 	}
 
-	return createLogFiles(bpmCfg, user)
+	err = createLockFiles(procCfg.LockVolumes(bpmCfg), user)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = createSocketDirs(bpmCfg, procCfg.Sockets, user)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if procCfg.TerminationLog != "" {
+		if err := createTerminationLog(bpmCfg, user); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if procCfg.Accounts == config.AccountsMinimal {
+		if err := createMinimalAccounts(bpmCfg, user); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if procCfg.OwnIdentity() {
+		if err := createMachineID(bpmCfg); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if procCfg.Network != nil && procCfg.Network.EgressRate != "" && a.features.NetClassSupported {
+		if _, err := a.classes.Allocate(bpmCfg.ContainerID()); err != nil {
+			return nil, nil, fmt.Errorf("failed to allocate an egress class: %s", err)
+		}
+	}
+
+	return openLogs(bpmCfg, procCfg, user)
 }
 
-func (a *RuncAdapter) makeShared(volume config.Volume) error {
-	held, err := a.locker.LockVolume(volume.Path)
+func (a *RuncAdapter) makeShared(path string) error {
+	held, err := a.locker.LockVolume(path)
 	if err != nil {
 		return err
 	}
 	defer held.Unlock()
 
-	if err := a.shareMount(volume.Path); err != nil {
+	if err := a.shareMount(path); err != nil {
 		return err
 	}
 
@@ -170,6 +263,24 @@ func createDirFor(path string, uid, gid int) error {
 	return os.Chown(path, uid, gid)
 }
 
+// createLockFiles creates the lock files of volumes which the process can
+// lock from inside its container.
+func createLockFiles(paths []string, user specs.User) error {
+	for _, path := range paths {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_RDONLY, 0600)
+		if err != nil {
+			return err
+		}
+		f.Close()
+
+		if err := os.Chown(path, int(user.UID), int(user.GID)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func chownPaths(paths []string, user specs.User) error {
 	for _, path := range paths {
 		err := os.Chown(path, int(user.UID), int(user.GID))
@@ -181,32 +292,137 @@ func chownPaths(paths []string, user specs.User) error {
 	return nil
 }
 
-func createLogFiles(bpmCfg *config.BPMConfig, user specs.User) (*os.File, *os.File, error) {
-	files := make([]*os.File, 2)
-	paths := []string{bpmCfg.Stdout().External(), bpmCfg.Stderr().External()}
-	for i, path := range paths {
-		f, err := createFileFor(path, int(user.UID), int(user.GID))
+// createTerminationLog empties the termination log left by the previous run
+// of the process so that an old message is not mistaken for a new one.
+func createTerminationLog(bpmCfg *config.BPMConfig, user specs.User) error {
+	path := bpmCfg.TerminationLog().External()
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Chown(path, int(user.UID), int(user.GID))
+}
+
+// createMinimalAccounts writes the passwd and group files of a process which
+// only knows about root and itself. A user which was given numerically has
+// no name on the host, so it is named after the process.
+func createMinimalAccounts(bpmCfg *config.BPMConfig, user specs.User) error {
+	dir := bpmCfg.AccountsDir().External()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	name := user.Username
+	if name == "" {
+		name = bpmCfg.ProcName()
+	}
+
+	passwd := "root:x:0:0:root:/root:/usr/sbin/nologin\n"
+	group := "root:x:0:\n"
+	if user.UID != 0 {
+		passwd += fmt.Sprintf("%s:x:%d:%d::%s:/usr/sbin/nologin\n", name, user.UID, user.GID, bpmCfg.DataDir().Internal())
+	}
+	if user.GID != 0 {
+		group += fmt.Sprintf("%s:x:%d:\n", name, user.GID)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "passwd"), []byte(passwd), 0644); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filepath.Join(dir, "group"), []byte(group), 0644)
+}
+
+// createMachineID writes the machine ID of the process's container. It is
+// derived from the BOSH instance and the container so that it stays the same
+// when the process is restarted but differs between the processes on a VM and
+// between the instances of a job. The host's machine ID stands in for the
+// instance when bpm is not running on a BOSH instance.
+func createMachineID(bpmCfg *config.BPMConfig) error {
+	sum := sha256.Sum256([]byte(instanceSeed(bpmCfg) + "/" + bpmCfg.ContainerID()))
+	id := fmt.Sprintf("%x\n", sum[:16])
+
+	return ioutil.WriteFile(bpmCfg.MachineIDFile().External(), []byte(id), 0644)
+}
+
+func instanceSeed(bpmCfg *config.BPMConfig) string {
+	if instance, err := bpmCfg.Instance(); err == nil && instance.ID != "" {
+		return instance.ID
+	}
+
+	if data, err := ioutil.ReadFile(hostMachineIDFile); err == nil {
+		return strings.TrimSpace(string(data))
+	}
+
+	return ""
+}
+
+// accountMounts mounts the user and group databases chosen by the process
+// over those in the host's /etc.
+func accountMounts(bpmCfg *config.BPMConfig, accounts string) []specs.Mount {
+	switch accounts {
+	case config.AccountsHost:
+		return []specs.Mount{
+			IdentityMount("/etc/passwd"),
+			IdentityMount("/etc/group"),
+		}
+	case config.AccountsMinimal:
+		dir := bpmCfg.AccountsDir()
+		return []specs.Mount{
+			Mount(dir.Join("passwd").External(), "/etc/passwd"),
+			Mount(dir.Join("group").External(), "/etc/group"),
+		}
+	default:
+		return nil
+	}
+}
+
+// createSocketDirs creates the directories which will contain the unix
+// sockets of the process. Each belongs to the user of the process, so that it
+// can create its socket, and to the group of the socket. The directories have
+// the setgid bit set so that the sockets created inside them inherit that
+// group before the socket-watch helper applies the rest of their ownership.
+func createSocketDirs(bpmCfg *config.BPMConfig, socks []config.Socket, user specs.User) error {
+	for _, sock := range socks {
+		_, gid, err := sockets.Ownership(sock, user)
 		if err != nil {
-			return nil, nil, err
+			return err
+		}
+
+		dir := bpmCfg.HostPath(sock.Dir())
+		if err := createDirFor(dir, int(user.UID), gid); err != nil {
+			return err
+		}
+
+		if err := os.Chmod(dir, config.SocketDirMode|os.ModeSetgid); err != nil {
+			return err
 		}
-		files[i] = f
 	}
 
-	return files[0], files[1], nil
+	return nil
 }
 
-func createFileFor(path string, uid, gid int) (*os.File, error) {
-	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+// openLogs opens the stdout and stderr of the process with the sink chosen
+// by its configuration.
+func openLogs(bpmCfg *config.BPMConfig, procCfg *config.ProcessConfig, user specs.User) (io.WriteCloser, io.WriteCloser, error) {
+	stdout, err := logsink.Open(bpmCfg, procCfg.LogSink, logsink.Stdout, user)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	err = os.Chown(path, uid, gid)
+	stderr, err := logsink.Open(bpmCfg, procCfg.LogSink, logsink.Stderr, user)
 	if err != nil {
-		return nil, err
+		stdout.Close()
+		return nil, nil, err
 	}
 
-	return f, nil
+	return stdout, stderr, nil
 }
 
 func (a *RuncAdapter) BuildSpec(
@@ -225,16 +441,50 @@ func (a *RuncAdapter) BuildSpec(
 		return specs.Spec{}, err
 	}
 
+	env, err := a.resolveSecrets(procCfg.Env)
+	if err != nil {
+		return specs.Spec{}, err
+	}
+
+	env, err = environmentWithFiles(env, procCfg.EnvFromFiles)
+	if err != nil {
+		return specs.Spec{}, err
+	}
+	env = environmentWithInherited(env, procCfg.InheritEnv)
+
+	if procCfg.Timezone != "" {
+		env, err = environmentWithTimezone(env, procCfg.Timezone)
+		if err != nil {
+			return specs.Spec{}, err
+		}
+	}
+
 	ms := newMountDedup(logger)
 	ms.addMounts(systemIdentityMounts(mountResolvConf))
-	ms.addMounts(boshMounts(bpmCfg, procCfg.EphemeralDisk, procCfg.PersistentDisk))
-	ms.addMounts(userProvidedIdentityMounts(bpmCfg, procCfg.AdditionalVolumes))
+	ms.addMounts(accountMounts(bpmCfg, procCfg.Accounts))
+	if procCfg.OwnIdentity() {
+		ms.addMounts([]specs.Mount{Mount(bpmCfg.MachineIDFile().External(), "/etc/machine-id")})
+	}
+	ms.addMounts(boshMounts(bpmCfg, procCfg.EphemeralDisk, procCfg.PersistentDisk, procCfg.PersistentDiskReadOnly))
+
+	jobMounts, err := jobDirMounts(bpmCfg, procCfg.JobDir)
+	if err != nil {
+		return specs.Spec{}, err
+	}
+	ms.addMounts(jobMounts)
+	ms.addMounts(additionalVolumeMounts(bpmCfg, procCfg.AdditionalVolumes))
+	ms.addMounts(socketMounts(bpmCfg, procCfg.Sockets))
+	if procCfg.TerminationLog != "" {
+		ms.addMounts([]specs.Mount{
+			Mount(bpmCfg.TerminationLog().External(), procCfg.TerminationLog, AllowWrites()),
+		})
+	}
 	if procCfg.Unsafe != nil && len(procCfg.Unsafe.UnrestrictedVolumes) > 0 {
 		expanded, err := a.globExpandVolumes(procCfg.Unsafe.UnrestrictedVolumes)
 		if err != nil {
 			return specs.Spec{}, err
 		}
-		ms.addMounts(userProvidedIdentityMounts(bpmCfg, expanded))
+		ms.addMounts(userProvidedIdentityMounts(expanded))
 	}
 
 	wrappedExe, wrappedArgs := wrapWithInit(bpmCfg, procCfg)
@@ -245,7 +495,7 @@ func (a *RuncAdapter) BuildSpec(
 		specbuilder.WithProcess(
 			wrappedExe,
 			wrappedArgs,
-			processEnvironment(procCfg.Env, bpmCfg),
+			processEnvironment(env, bpmCfg, procCfg.Path),
 			cwd,
 		),
 		specbuilder.WithCapabilities(processCapabilities(procCfg.Capabilities)),
@@ -255,14 +505,94 @@ func (a *RuncAdapter) BuildSpec(
 		specbuilder.WithNamespace("uts"),
 	)
 
+	// A process which keeps the host's hostname still has a UTS namespace
+	// of its own, which starts with a copy of the host's hostname, so that
+	// a privileged process cannot change the hostname of the VM.
+	if procCfg.OwnIdentity() {
+		specbuilder.Apply(spec, specbuilder.WithHostname(bpmCfg.Hostname()))
+	}
+
 	if procCfg.Limits != nil {
 		if procCfg.Limits.Memory != nil {
-			memLimit, err := bytefmt.ToBytes(*procCfg.Limits.Memory)
+			memLimit, err := procCfg.Limits.MemoryBytes(a.features.MemoryTotal)
 			if err != nil {
 				return specs.Spec{}, err
 			}
+			if strings.HasSuffix(*procCfg.Limits.Memory, "%") {
+				logger.Info("resolved-memory-limit", lager.Data{"limit": *procCfg.Limits.Memory, "bytes": memLimit})
+			}
 
 			specbuilder.Apply(spec, specbuilder.WithMemoryLimit(int64(memLimit), a.features))
+
+			if procCfg.Limits.Swap != nil {
+				swapLimit, err := procCfg.Limits.SwapBytes()
+				if err != nil {
+					return specs.Spec{}, err
+				}
+				// Without a memory controller the whole of the memory limit
+				// is skipped below rather than swap alone being refused.
+				if !a.features.SwapLimitSupported && !a.features.ControllerMissing("memory") {
+					return specs.Spec{}, fmt.Errorf("invalid swap limit %q: the kernel does not account for swap (enable it with the swapaccount=1 boot parameter)", *procCfg.Limits.Swap)
+				}
+				if swapLimit < memLimit {
+					return specs.Spec{}, fmt.Errorf("invalid swap limit %q: must be at least the memory limit of %d bytes", *procCfg.Limits.Swap, memLimit)
+				}
+
+				specbuilder.Apply(spec, specbuilder.WithSwapLimit(int64(swapLimit)))
+			}
+		}
+
+		// The reservation is applied after the memory limit, which replaces
+		// the memory resources of the spec.
+		if procCfg.Limits.MemoryReservation != nil {
+			reservation, err := a.memoryReservation(logger, procCfg.Limits)
+			if err != nil {
+				return specs.Spec{}, err
+			}
+
+			specbuilder.Apply(spec, specbuilder.WithMemoryReservation(int64(reservation)))
+		}
+
+		if procCfg.Limits.KernelMemory != nil {
+			if err := a.kernelMemoryLimit(logger, spec, procCfg.Limits); err != nil {
+				return specs.Spec{}, err
+			}
+		}
+
+		if procCfg.Limits.Swappiness != nil {
+			if a.features.SwappinessSupported {
+				specbuilder.Apply(spec, specbuilder.WithSwappiness(*procCfg.Limits.Swappiness))
+			} else {
+				logger.Info("swappiness-unsupported", lager.Data{"swappiness": *procCfg.Limits.Swappiness})
+			}
+		}
+
+		if procCfg.Limits.IOWeight != nil {
+			if a.features.IOWeightSupported {
+				specbuilder.Apply(spec, specbuilder.WithBlockIOWeight(*procCfg.Limits.IOWeight))
+			} else {
+				logger.Info("io-weight-unsupported", lager.Data{"io_weight": *procCfg.Limits.IOWeight})
+			}
+		}
+
+		if procCfg.Limits.CPUs != nil {
+			cpus, err := procCfg.Limits.CPUCount(a.features.CPUCount)
+			if err != nil {
+				return specs.Spec{}, err
+			}
+			logger.Info("resolved-cpu-limit", lager.Data{"limit": *procCfg.Limits.CPUs, "cpus": cpus})
+
+			period := uint64(CPUPeriod)
+			if procCfg.Limits.CPUPeriod != nil {
+				period = *procCfg.Limits.CPUPeriod
+			}
+
+			quota := int64(cpus * float64(period))
+			specbuilder.Apply(spec, specbuilder.WithCPULimit(quota, period))
+		}
+
+		if procCfg.Limits.CPUShares != nil {
+			specbuilder.Apply(spec, specbuilder.WithCPUShares(*procCfg.Limits.CPUShares))
 		}
 
 		if procCfg.Limits.Processes != nil {
@@ -272,6 +602,143 @@ func (a *RuncAdapter) BuildSpec(
 		if procCfg.Limits.OpenFiles != nil {
 			specbuilder.Apply(spec, specbuilder.WithOpenFileLimit(*procCfg.Limits.OpenFiles))
 		}
+
+		if len(procCfg.Limits.Hugepages) > 0 {
+			limits, err := hugepageLimits(procCfg.Limits)
+			if err != nil {
+				return specs.Spec{}, err
+			}
+			specbuilder.Apply(spec, specbuilder.WithHugepageLimits(limits))
+		}
+
+		if len(procCfg.Limits.Blkio) > 0 {
+			option, err := blkioThrottle(procCfg.Limits.Blkio)
+			if err != nil {
+				return specs.Spec{}, err
+			}
+			specbuilder.Apply(spec, option)
+		}
+	}
+
+	if len(procCfg.Rlimits) > 0 {
+		rlimits, err := procCfg.ParsedRlimits()
+		if err != nil {
+			return specs.Spec{}, err
+		}
+		for _, rlimit := range rlimits {
+			specbuilder.Apply(spec, specbuilder.WithRlimit(rlimit.Type, rlimit.Value))
+		}
+	}
+
+	cgroupPath, managed := a.cgroupPath(bpmCfg)
+	if !managed {
+		specbuilder.Apply(spec, specbuilder.WithCgroupsPath(cgroupPath))
+	}
+
+	var cpuset, mems string
+	if procCfg.NUMANode != nil {
+		cpus, err := numaNodeCPUs(*procCfg.NUMANode)
+		if err != nil {
+			return specs.Spec{}, err
+		}
+		cpuset, mems = cpus, strconv.Itoa(*procCfg.NUMANode)
+	}
+
+	// A cpuset narrows the CPUs of the NUMA node down further when both are
+	// given, so it must only name CPUs which are on the node.
+	if procCfg.Limits != nil && procCfg.Limits.CPUSet != nil {
+		cpus, err := pinnedCPUs(procCfg.Limits, cpuset)
+		if err != nil {
+			return specs.Spec{}, err
+		}
+		logger.Info("pinned-to-cpus", lager.Data{"cpuset": cpus})
+		cpuset = cpus
+	}
+
+	if cpuset != "" {
+		specbuilder.Apply(spec, specbuilder.WithCPUSet(cpuset, mems))
+	}
+
+	if len(procCfg.Labels) > 0 {
+		specbuilder.Apply(spec, specbuilder.WithAnnotations(procCfg.Labels))
+	}
+
+	// These are applied after the labels so that the values which bpm and
+	// other tools read cannot be changed by them.
+	specbuilder.Apply(spec, specbuilder.WithAnnotations(map[string]string{
+		config.CgroupPathAnnotation:     cgroupPath,
+		config.ConfigChecksumAnnotation: procCfg.Checksum(),
+	}))
+
+	if procCfg.CoreDumps != nil {
+		maxSize, maxCount, err := procCfg.CoreDumps.Limits()
+		if err != nil {
+			return specs.Spec{}, err
+		}
+
+		specbuilder.Apply(
+			spec,
+			specbuilder.WithCoreLimit(maxSize),
+			specbuilder.WithAnnotations(map[string]string{
+				coredump.MaxSizeAnnotation:  strconv.FormatUint(maxSize, 10),
+				coredump.MaxCountAnnotation: strconv.Itoa(maxCount),
+			}),
+		)
+	}
+
+	if procCfg.Realtime != nil {
+		if err := a.realtime(logger, spec, procCfg.Realtime); err != nil {
+			return specs.Spec{}, err
+		}
+	}
+
+	if procCfg.OOMScoreAdj != nil {
+		specbuilder.Apply(spec, specbuilder.WithOOMScoreAdj(*procCfg.OOMScoreAdj))
+	}
+
+	if procCfg.Nice != nil {
+		specbuilder.Apply(spec, specbuilder.WithAnnotations(map[string]string{
+			client.NiceAnnotation: strconv.Itoa(*procCfg.Nice),
+		}))
+	}
+
+	if len(procCfg.Devices) > 0 {
+		option, err := devices(procCfg.Devices)
+		if err != nil {
+			return specs.Spec{}, err
+		}
+		specbuilder.Apply(spec, option)
+	}
+
+	if procCfg.Network != nil && procCfg.Network.EgressRate != "" {
+		// The rate itself is enforced on the host's interface once the
+		// process has started. The container only tags its packets.
+		// The class is allocated by CreateJobPrerequisites, so that
+		// building a spec for `bpm update` claims nothing. A process
+		// which has not been started since it was given a rate has no
+		// class yet. Its spec still differs from that of its container,
+		// so that it is restarted to take the rate on.
+		if a.features.NetClassSupported {
+			classID, ok, err := a.classes.Lookup(bpmCfg.ContainerID())
+			if err != nil {
+				return specs.Spec{}, fmt.Errorf("failed to look up the egress class: %s", err)
+			}
+			if ok {
+				specbuilder.Apply(spec, specbuilder.WithNetClassID(classID))
+			} else {
+				spec.Linux.Resources.Network = &specs.LinuxNetwork{}
+			}
+		} else {
+			logger.Info("egress-rate-unsupported", lager.Data{"egress_rate": procCfg.Network.EgressRate})
+		}
+	}
+
+	if procCfg.OCIHooks != nil {
+		hooks, err := ociHooks(procCfg.OCIHooks)
+		if err != nil {
+			return specs.Spec{}, err
+		}
+		specbuilder.Apply(spec, specbuilder.WithHooks(hooks))
 	}
 
 	if procCfg.Unsafe == nil || !procCfg.Unsafe.HostPidNamespace {
@@ -282,9 +749,412 @@ func (a *RuncAdapter) BuildSpec(
 		specbuilder.Apply(spec, specbuilder.WithPrivileged())
 	}
 
+	a.skipMissingControllers(logger, spec)
+
 	return *spec, nil
 }
 
+// skipMissingControllers removes the resources of the spec which are enforced
+// by a cgroup controller that the host does not have. runc refuses to start a
+// container with limits it cannot set, so the process runs without them.
+func (a *RuncAdapter) skipMissingControllers(logger lager.Logger, spec *specs.Spec) {
+	res := spec.Linux.Resources
+
+	skip := func(controller string, set bool) bool {
+		if !set || !a.features.ControllerMissing(controller) {
+			return false
+		}
+		logger.Info("cgroup-controller-missing", lager.Data{"controller": controller})
+		return true
+	}
+
+	if skip("memory", res.Memory != nil) {
+		res.Memory = nil
+	}
+
+	if res.CPU != nil {
+		cpu := res.CPU
+		if skip("cpu", cpu.Shares != nil || cpu.Quota != nil || cpu.Period != nil || cpu.RealtimeRuntime != nil || cpu.RealtimePeriod != nil) {
+			cpu.Shares, cpu.Quota, cpu.Period = nil, nil, nil
+			cpu.RealtimeRuntime, cpu.RealtimePeriod = nil, nil
+		}
+		if skip("cpuset", cpu.Cpus != "" || cpu.Mems != "") {
+			cpu.Cpus, cpu.Mems = "", ""
+		}
+		if *cpu == (specs.LinuxCPU{}) {
+			res.CPU = nil
+		}
+	}
+
+	if skip("pids", res.Pids != nil) {
+		res.Pids = nil
+	}
+
+	if skip("blkio", res.BlockIO != nil) {
+		res.BlockIO = nil
+	}
+
+	if skip("hugetlb", len(res.HugepageLimits) > 0) {
+		res.HugepageLimits = nil
+	}
+
+	// The device nodes are still created. Without a device controller
+	// nothing stops the process from using them anyway.
+	if skip("devices", len(res.Devices) > 0) {
+		res.Devices = nil
+	}
+}
+
+// realtime records the scheduling policy which runc is started with and, on
+// kernels which budget realtime CPU time per cgroup, gives the container its
+// budget. A cgroup without one cannot hold realtime tasks at all.
+func (a *RuncAdapter) realtime(logger lager.Logger, spec *specs.Spec, rt *config.Realtime) error {
+	runtime, period, err := rt.Budget()
+	if err != nil {
+		return err
+	}
+
+	if a.features.RealtimeGroupsSupported {
+		specbuilder.Apply(spec, specbuilder.WithRealtimeBudget(runtime, period))
+	} else {
+		logger.Info("realtime-budget-unsupported", lager.Data{"runtime": rt.Runtime})
+	}
+
+	specbuilder.Apply(spec, specbuilder.WithAnnotations(map[string]string{
+		client.RealtimeAnnotation: fmt.Sprintf("%s:%d", rt.Policy, rt.Priority),
+	}))
+
+	return nil
+}
+
+// kernelMemoryLimit limits the kernel memory of the container where the
+// memory cgroup can. Elsewhere, as under cgroup v2, kernel memory is charged
+// to the memory limit instead, which is all that can bound it.
+func (a *RuncAdapter) kernelMemoryLimit(logger lager.Logger, spec *specs.Spec, limits *config.Limits) error {
+	limit, err := limits.KernelMemoryBytes()
+	if err != nil {
+		return err
+	}
+
+	if !a.features.KernelMemoryLimitSupported {
+		logger.Info("kernel-memory-limit-unsupported", lager.Data{
+			"kernel_memory":    *limits.KernelMemory,
+			"has_memory_limit": limits.Memory != nil,
+		})
+		return nil
+	}
+
+	specbuilder.Apply(spec, specbuilder.WithKernelMemoryLimit(int64(limit)))
+	return nil
+}
+
+// memoryReservation resolves the memory reservation of a process against the
+// host's memory. It must not be above the process's memory limit, as the
+// kernel would never get to reclaim down to it.
+func (a *RuncAdapter) memoryReservation(logger lager.Logger, limits *config.Limits) (uint64, error) {
+	reservation, err := limits.MemoryReservationBytes(a.features.MemoryTotal)
+	if err != nil {
+		return 0, err
+	}
+	if strings.HasSuffix(*limits.MemoryReservation, "%") {
+		logger.Info("resolved-memory-reservation", lager.Data{"reservation": *limits.MemoryReservation, "bytes": reservation})
+	}
+
+	if limits.Memory != nil {
+		memLimit, err := limits.MemoryBytes(a.features.MemoryTotal)
+		if err != nil {
+			return 0, err
+		}
+		if reservation > memLimit {
+			return 0, fmt.Errorf("invalid memory reservation %q: must not be more than the memory limit of %d bytes", *limits.MemoryReservation, memLimit)
+		}
+	}
+
+	return reservation, nil
+}
+
+// numaNodeCPUs returns the list of CPUs which belong to a NUMA node on the
+// host in the kernel's cpuset list format (e.g. "0-7,16-23").
+func numaNodeCPUs(node int) (string, error) {
+	data, err := ioutil.ReadFile(filepath.Join(numaNodeDir, fmt.Sprintf("node%d", node), "cpulist"))
+	if os.IsNotExist(err) {
+		return "", fmt.Errorf("invalid numa_node: node %d does not exist on this host", node)
+	} else if err != nil {
+		return "", err
+	}
+
+	cpus := strings.TrimSpace(string(data))
+	if cpus == "" {
+		return "", fmt.Errorf("invalid numa_node: node %d has no CPUs", node)
+	}
+
+	return cpus, nil
+}
+
+// pinnedCPUs checks that the CPUs of a cpuset limit are online on the host
+// and, when the process is bound to a NUMA node, that they are on the node
+// whose CPUs are given in nodeCPUs.
+func pinnedCPUs(limits *config.Limits, nodeCPUs string) (string, error) {
+	cpus, err := limits.CPUSetList()
+	if err != nil {
+		return "", err
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(cpuDir, "online"))
+	if err != nil {
+		return "", err
+	}
+
+	online, err := config.ParseCPUList(string(data))
+	if err != nil {
+		return "", fmt.Errorf("unable to read the online CPUs of the host: %s", err)
+	}
+
+	if cpu, ok := allAvailable(cpus, online); !ok {
+		return "", fmt.Errorf("invalid cpuset %q: CPU %d is not online on this host", *limits.CPUSet, cpu)
+	}
+
+	if nodeCPUs != "" {
+		node, err := config.ParseCPUList(nodeCPUs)
+		if err != nil {
+			return "", fmt.Errorf("unable to read the CPUs of the NUMA node: %s", err)
+		}
+
+		if cpu, ok := allAvailable(cpus, node); !ok {
+			return "", fmt.Errorf("invalid cpuset %q: CPU %d is not on the process's numa_node", *limits.CPUSet, cpu)
+		}
+	}
+
+	return strings.TrimSpace(*limits.CPUSet), nil
+}
+
+// allAvailable reports whether every one of the wanted CPUs is available and
+// otherwise returns the first which is not.
+func allAvailable(wanted, available []int) (int, bool) {
+	has := make(map[int]bool, len(available))
+	for _, cpu := range available {
+		has[cpu] = true
+	}
+
+	for _, cpu := range wanted {
+		if !has[cpu] {
+			return cpu, false
+		}
+	}
+
+	return 0, true
+}
+
+// hugepageLimits checks that the host supports each size of huge page which
+// the process limits and names the sizes the way the kernel's hugetlb
+// controller does (2MB, 1GB).
+func hugepageLimits(limits *config.Limits) ([]specs.LinuxHugepageLimit, error) {
+	sizes, err := limits.HugepageLimits()
+	if err != nil {
+		return nil, err
+	}
+
+	var hugepages []specs.LinuxHugepageLimit
+	for _, size := range sizes {
+		name := hugepageSizeName(size.PageSize)
+
+		_, err := os.Stat(filepath.Join(hugepagesDir, fmt.Sprintf("hugepages-%dkB", size.PageSize/1024)))
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("invalid hugepages: this host does not support %s pages", name)
+		} else if err != nil {
+			return nil, err
+		}
+
+		hugepages = append(hugepages, specs.LinuxHugepageLimit{Pagesize: name, Limit: size.Limit})
+	}
+
+	return hugepages, nil
+}
+
+// hugepageSizeName returns the name of a page size in the largest unit which
+// divides it exactly.
+func hugepageSizeName(size uint64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+
+	unit := 0
+	for size%1024 == 0 && unit < len(units)-1 {
+		size /= 1024
+		unit++
+	}
+
+	return fmt.Sprintf("%d%s", size, units[unit])
+}
+
+// blkioThrottle resolves the device of each block I/O limit and builds the
+// throttles for it.
+func blkioThrottle(limits []config.BlkioLimit) (specbuilder.SpecOption, error) {
+	var readBPS, writeBPS, readIOPS, writeIOPS []specs.LinuxThrottleDevice
+
+	throttle := func(devices *[]specs.LinuxThrottleDevice, major, minor int64, rate uint64) {
+		if rate == 0 {
+			return
+		}
+
+		var device specs.LinuxThrottleDevice
+		device.Major, device.Minor, device.Rate = major, minor, rate
+		*devices = append(*devices, device)
+	}
+
+	for _, limit := range limits {
+		major, minor, err := blockDevice(limit.Device)
+		if err != nil {
+			return nil, fmt.Errorf("invalid blkio device %q: %s", limit.Device, err)
+		}
+
+		read, write, err := limit.Rates()
+		if err != nil {
+			return nil, err
+		}
+
+		throttle(&readBPS, major, minor, read)
+		throttle(&writeBPS, major, minor, write)
+		throttle(&readIOPS, major, minor, limit.ReadIOPS)
+		throttle(&writeIOPS, major, minor, limit.WriteIOPS)
+	}
+
+	return specbuilder.WithBlockIOThrottle(readBPS, writeBPS, readIOPS, writeIOPS), nil
+}
+
+// devices looks up each device on the host and builds both the node which
+// is created for it in the container, with the owner and mode it has on the
+// host, and the rule which allows the process to use it.
+func devices(cfgs []config.Device) (specbuilder.SpecOption, error) {
+	var (
+		nodes []specs.LinuxDevice
+		rules []specs.LinuxDeviceCgroup
+	)
+
+	for _, cfg := range cfgs {
+		var stat unix.Stat_t
+		if err := unix.Stat(cfg.Path, &stat); err != nil {
+			return nil, fmt.Errorf("invalid device %s: %s", cfg.Path, err)
+		}
+
+		var kind string
+		switch stat.Mode & unix.S_IFMT {
+		case unix.S_IFCHR:
+			kind = "c"
+		case unix.S_IFBLK:
+			kind = "b"
+		default:
+			return nil, fmt.Errorf("invalid device %s: not a character or block device", cfg.Path)
+		}
+
+		major, minor := int64(unix.Major(stat.Rdev)), int64(unix.Minor(stat.Rdev))
+		mode := os.FileMode(stat.Mode & 07777)
+		uid, gid := stat.Uid, stat.Gid
+
+		nodes = append(nodes, specs.LinuxDevice{
+			Path:     cfg.Path,
+			Type:     kind,
+			Major:    major,
+			Minor:    minor,
+			FileMode: &mode,
+			UID:      &uid,
+			GID:      &gid,
+		})
+		rules = append(rules, specs.LinuxDeviceCgroup{
+			Allow:  true,
+			Type:   kind,
+			Major:  &major,
+			Minor:  &minor,
+			Access: cfg.Access(),
+		})
+	}
+
+	return specbuilder.WithDevices(nodes, rules), nil
+}
+
+// blockDevice returns the device number of the block device at path or, for
+// any other file, of the device which holds its filesystem. The kernel only
+// throttles whole disks so a partition is replaced by the disk it is on.
+func blockDevice(path string) (int64, int64, error) {
+	var stat unix.Stat_t
+	if err := unix.Stat(path, &stat); err != nil {
+		return 0, 0, err
+	}
+
+	dev := stat.Dev
+	if stat.Mode&unix.S_IFMT == unix.S_IFBLK {
+		dev = stat.Rdev
+	}
+	major, minor := int64(unix.Major(dev)), int64(unix.Minor(dev))
+
+	sysfs, err := filepath.EvalSymlinks(filepath.Join(sysBlockDir, fmt.Sprintf("%d:%d", major, minor)))
+	if err != nil {
+		// Filesystems which are not on a block device, such as a tmpfs,
+		// have no entry and cannot be on a partition.
+		return major, minor, nil
+	}
+
+	if _, err := os.Stat(filepath.Join(sysfs, "partition")); err == nil {
+		data, err := ioutil.ReadFile(filepath.Join(filepath.Dir(sysfs), "dev"))
+		if err != nil {
+			return 0, 0, err
+		}
+
+		if _, err := fmt.Sscanf(strings.TrimSpace(string(data)), "%d:%d", &major, &minor); err != nil {
+			return 0, 0, fmt.Errorf("unexpected device number %q of the disk holding it", data)
+		}
+	}
+
+	return major, minor, nil
+}
+
+// ociHooks converts the hooks in the process configuration into the form used
+// by the runtime spec. The hook's path is used as its first argument to match
+// the behaviour of a shell.
+func ociHooks(cfg *config.OCIHooks) (*specs.Hooks, error) {
+	convert := func(hooks []config.OCIHook) ([]specs.Hook, error) {
+		var converted []specs.Hook
+		for _, hook := range hooks {
+			timeout, err := hook.TimeoutSeconds()
+			if err != nil {
+				return nil, fmt.Errorf("invalid oci_hooks: %s: %s", hook.Path, err)
+			}
+
+			var env []string
+			for k, v := range hook.Env {
+				env = append(env, fmt.Sprintf("%s=%s", k, v))
+			}
+			sort.Strings(env)
+
+			converted = append(converted, specs.Hook{
+				Path:    hook.Path,
+				Args:    append([]string{hook.Path}, hook.Args...),
+				Env:     env,
+				Timeout: timeout,
+			})
+		}
+		return converted, nil
+	}
+
+	hooks := &specs.Hooks{}
+	stages := []struct {
+		hooks     []config.OCIHook
+		converted *[]specs.Hook
+	}{
+		{cfg.Prestart, &hooks.Prestart},
+		{cfg.Poststart, &hooks.Poststart},
+		{cfg.Poststop, &hooks.Poststop},
+	}
+
+	for _, stage := range stages {
+		converted, err := convert(stage.hooks)
+		if err != nil {
+			return nil, err
+		}
+		*stage.converted = converted
+	}
+
+	return hooks, nil
+}
+
 func wrapWithInit(bpmCfg *config.BPMConfig, procCfg *config.ProcessConfig) (string, []string) {
 	exe := bpmCfg.TiniPath().Internal()
 	args := append([]string{"-w", "-s", "--", procCfg.Executable}, procCfg.Args...)
@@ -308,8 +1178,7 @@ func systemIdentityMounts(mountResolvConf bool) []specs.Mount {
 	return mounts
 }
 
-func boshMounts(bpmCfg *config.BPMConfig, mountData, mountStore bool) []specs.Mount {
-	jobDir := bpmCfg.JobDir()
+func boshMounts(bpmCfg *config.BPMConfig, mountData, mountStore, storeReadOnly bool) []specs.Mount {
 	logDir := bpmCfg.LogDir()
 	tmpDir := bpmCfg.TempDir()
 	packageDir := bpmCfg.PackageDir()
@@ -321,7 +1190,6 @@ func boshMounts(bpmCfg *config.BPMConfig, mountData, mountStore bool) []specs.Mo
 		Mount(tmpDir.External(), tmpDir.Internal(), WithRecursiveBind(), AllowWrites()),
 		Mount(dataPackageDir.External(), dataPackageDir.Internal(), AllowExec()),
 		Mount(packageDir.External(), packageDir.Internal(), AllowExec()),
-		Mount(jobDir.External(), jobDir.Internal(), AllowExec()),
 		Mount(logDir.External(), logDir.Internal(), WithRecursiveBind(), AllowWrites()),
 	}
 
@@ -332,12 +1200,45 @@ func boshMounts(bpmCfg *config.BPMConfig, mountData, mountStore bool) []specs.Mo
 
 	if mountStore {
 		storeDir := bpmCfg.StoreDir()
-		mounts = append(mounts, Mount(storeDir.External(), storeDir.Internal(), WithRecursiveBind(), AllowWrites()))
+		opts := []MountOption{WithRecursiveBind()}
+		if !storeReadOnly {
+			opts = append(opts, AllowWrites())
+		}
+		mounts = append(mounts, Mount(storeDir.External(), storeDir.Internal(), opts...))
 	}
 
 	return mounts
 }
 
+// jobDirMounts mounts the whole job directory unless the process has limited
+// it to some of the paths within it (or none at all).
+func jobDirMounts(bpmCfg *config.BPMConfig, jobDirCfg *config.JobDir) ([]specs.Mount, error) {
+	jobDir := bpmCfg.JobDir()
+
+	if jobDirCfg == nil {
+		return []specs.Mount{Mount(jobDir.External(), jobDir.Internal(), AllowExec())}, nil
+	}
+
+	if jobDirCfg.Disabled {
+		return nil, nil
+	}
+
+	var mounts []specs.Mount
+	for _, path := range jobDirCfg.Paths {
+		p := jobDir.Join(path)
+
+		// A missing source fails deep inside runc with an error which does
+		// not mention the job directory.
+		if _, err := os.Stat(p.External()); err != nil {
+			return nil, fmt.Errorf("job_dir path %s cannot be mounted: %s", path, err)
+		}
+
+		mounts = append(mounts, Mount(p.External(), p.Internal(), AllowExec()))
+	}
+
+	return mounts, nil
+}
+
 func (a *RuncAdapter) globExpandVolumes(volumes []config.Volume) ([]config.Volume, error) {
 	var expandedVolumes []config.Volume
 
@@ -357,27 +1258,156 @@ func (a *RuncAdapter) globExpandVolumes(volumes []config.Volume) ([]config.Volum
 	return expandedVolumes, nil
 }
 
-func userProvidedIdentityMounts(bpmCfg *config.BPMConfig, volumes []config.Volume) []specs.Mount {
+// additionalVolumeMounts mounts each volume where the job configuration says
+// it is, which may differ from where it is on the host when bpm is not using
+// the default BOSH root.
+func additionalVolumeMounts(bpmCfg *config.BPMConfig, volumes []config.Volume) []specs.Mount {
 	var mnts []specs.Mount
 
 	for _, vol := range volumes {
-		opts := []MountOption{WithRecursiveBind()}
+		mnts = append(mnts, Mount(bpmCfg.HostPath(vol.Path), vol.Path, volumeMountOptions(vol)...))
+	}
+
+	return mnts
+}
+
+// userProvidedIdentityMounts mounts unrestricted volumes, which are always
+// host paths.
+func userProvidedIdentityMounts(volumes []config.Volume) []specs.Mount {
+	var mnts []specs.Mount
+
+	for _, vol := range volumes {
+		mnts = append(mnts, IdentityMount(vol.Path, volumeMountOptions(vol)...))
+	}
+
+	return mnts
+}
+
+func volumeMountOptions(vol config.Volume) []MountOption {
+	opts := []MountOption{WithRecursiveBind()}
+
+	if vol.AllowExecutions {
+		opts = append(opts, AllowExec())
+	}
+
+	if vol.Writable {
+		opts = append(opts, AllowWrites())
+	}
+
+	return opts
+}
+
+func socketMounts(bpmCfg *config.BPMConfig, sockets []config.Socket) []specs.Mount {
+	var mnts []specs.Mount
+
+	for _, sock := range sockets {
+		mnts = append(mnts, Mount(bpmCfg.HostPath(sock.Dir()), sock.Dir(), WithRecursiveBind(), AllowWrites()))
+	}
+
+	return mnts
+}
+
+// resolveSecrets replaces every ((name)) reference in the environment with the
+// value of the named secret from the secret store.
+func (a *RuncAdapter) resolveSecrets(env map[string]string) (map[string]string, error) {
+	if !config.HasSecretReferences(env) {
+		return env, nil
+	}
 
-		if vol.AllowExecutions {
-			opts = append(opts, AllowExec())
+	if a.secrets == nil {
+		return nil, errors.New("environment references secrets but no secret store (CredHub) is configured")
+	}
+
+	resolved := make(map[string]string, len(env))
+	for k, v := range env {
+		var resolveErr error
+		resolved[k] = config.SecretReferencePattern.ReplaceAllStringFunc(v, func(ref string) string {
+			name := config.SecretReferencePattern.FindStringSubmatch(ref)[1]
+			value, err := a.secrets.Get(name)
+			if err != nil && resolveErr == nil {
+				resolveErr = fmt.Errorf("failed to resolve secret %s for environment variable %s: %s", name, k, err)
+			}
+			return value
+		})
+
+		if resolveErr != nil {
+			return nil, resolveErr
 		}
+	}
 
-		if vol.Writable {
-			opts = append(opts, AllowWrites())
+	return resolved, nil
+}
+
+// environmentWithFiles adds the contents of each file in envFromFiles to the
+// environment. A single trailing newline is removed from each value as most
+// tools which write secrets to disk add one.
+func environmentWithFiles(env, envFromFiles map[string]string) (map[string]string, error) {
+	if len(envFromFiles) == 0 {
+		return env, nil
+	}
+
+	merged := make(map[string]string, len(env)+len(envFromFiles))
+	for k, v := range env {
+		merged[k] = v
+	}
+
+	for k, path := range envFromFiles {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read environment variable %s from file: %s", k, err)
 		}
 
-		mnts = append(mnts, IdentityMount(vol.Path, opts...))
+		value := strings.TrimSuffix(string(data), "\n")
+		merged[k] = strings.TrimSuffix(value, "\r")
 	}
 
-	return mnts
+	return merged, nil
+}
+
+// environmentWithInherited copies the named variables from bpm's own
+// environment. Variables which bpm was not given are left unset rather than
+// being set to an empty value.
+func environmentWithInherited(env map[string]string, names []string) map[string]string {
+	if len(names) == 0 {
+		return env
+	}
+
+	merged := make(map[string]string, len(env)+len(names))
+	for k, v := range env {
+		merged[k] = v
+	}
+
+	for _, name := range names {
+		if value, ok := os.LookupEnv(name); ok {
+			merged[name] = value
+		}
+	}
+
+	return merged
 }
 
-func processEnvironment(env map[string]string, cfg *config.BPMConfig) []string {
+// environmentWithTimezone sets TZ to the given zone unless the process has
+// already set it. The zone must exist in the host's timezone database as
+// programs otherwise silently fall back to UTC.
+func environmentWithTimezone(env map[string]string, zone string) (map[string]string, error) {
+	if _, ok := env["TZ"]; ok {
+		return env, nil
+	}
+
+	if _, err := os.Stat(filepath.Join(zoneinfoDir, zone)); err != nil {
+		return nil, fmt.Errorf("invalid timezone %q: %s", zone, err)
+	}
+
+	withTZ := make(map[string]string, len(env)+1)
+	for k, v := range env {
+		withTZ[k] = v
+	}
+	withTZ["TZ"] = zone
+
+	return withTZ, nil
+}
+
+func processEnvironment(env map[string]string, cfg *config.BPMConfig, path []string) []string {
 	var environ []string
 
 	for k, v := range env {
@@ -393,13 +1423,17 @@ func processEnvironment(env map[string]string, cfg *config.BPMConfig) []string {
 	}
 
 	if _, ok := env["PATH"]; !ok {
-		environ = append(environ, fmt.Sprintf("PATH=%s", defaultPath(cfg)))
+		environ = append(environ, fmt.Sprintf("PATH=%s", defaultPath(cfg, path)))
 	}
 
 	if _, ok := env["HOME"]; !ok {
 		environ = append(environ, fmt.Sprintf("HOME=%s", cfg.DataDir().Internal()))
 	}
 
+	// The order is fixed so that building the spec again from the same
+	// configuration gives the same spec.
+	sort.Strings(environ)
+
 	return environ
 }
 
@@ -424,7 +1458,53 @@ func checkDirExists(dir string) (bool, error) {
 	return false, nil
 }
 
-func defaultPath(cfg *config.BPMConfig) string {
-	defaultPathTmpl := "%s:/usr/local/bin:/usr/local/sbin:/usr/bin:/usr/sbin:/bin:/sbin:."
-	return fmt.Sprintf(defaultPathTmpl, cfg.JobDir().Join("bin").Internal())
+// systemPath is searched after the directories of the job and its packages.
+var systemPath = []string{"/usr/local/bin", "/usr/local/sbin", "/usr/bin", "/usr/sbin", "/bin", "/sbin", "."}
+
+// defaultPath is the PATH of a process which has not set one in its
+// environment. The directories it asks for are searched first, then the
+// job's bin directory and the bin directories of the job's packages.
+func defaultPath(cfg *config.BPMConfig, dirs []string) string {
+	path := append([]string{}, dirs...)
+	path = append(path, cfg.JobDir().Join("bin").Internal())
+	path = append(path, packageBinDirs(cfg)...)
+	path = append(path, systemPath...)
+	return strings.Join(path, ":")
+}
+
+// packageBinDirs returns the bin directories of the packages which the job
+// depends on. BOSH links each of them into the packages directory of the job.
+func packageBinDirs(cfg *config.BPMConfig) []string {
+	infos, err := ioutil.ReadDir(cfg.JobDir().Join("packages").External())
+	if err != nil {
+		return nil
+	}
+
+	var dirs []string
+	for _, info := range infos {
+		bin := cfg.PackageDir().Join(info.Name(), "bin")
+		if exists, _ := checkDirExists(bin.External()); exists {
+			dirs = append(dirs, bin.Internal())
+		}
+	}
+
+	return dirs
+}
+
+// cgroupPath is the cgroup which the container will be placed in. runc places
+// containers in the default root relative to its own cgroup unless told
+// otherwise, which depends on who ran bpm, so they are given a cgroup named
+// after the container at the top of the hierarchy instead. When systemd
+// manages the cgroups runc asks it for a scope named after the container,
+// which is just as stable across restarts, and managed is true.
+func (a *RuncAdapter) cgroupPath(bpmCfg *config.BPMConfig) (path string, managed bool) {
+	if path := bpmCfg.CgroupsPath(); path != "" {
+		return path, false
+	}
+
+	if a.features.SystemdCgroups {
+		return fmt.Sprintf("/system.slice/runc-%s.scope", bpmCfg.ContainerID()), true
+	}
+
+	return "/" + bpmCfg.ContainerID(), false
 }
@@ -19,6 +19,7 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"math"
 	"os"
 	"path/filepath"
 	"sort"
@@ -26,16 +27,20 @@ import (
 	"syscall"
 
 	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
 	. "github.com/onsi/gomega"
 
 	"code.cloudfoundry.org/bytefmt"
 	"code.cloudfoundry.org/lager/lagertest"
 	"github.com/onsi/gomega/types"
 	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"golang.org/x/sys/unix"
 
 	"bpm/bosh"
 	"bpm/config"
+	"bpm/coredump"
 	"bpm/hostlock"
+	"bpm/runc/client"
 	"bpm/runc/specbuilder"
 	"bpm/sysfeat"
 )
@@ -56,6 +61,8 @@ var _ = Describe("RuncAdapter", func() {
 
 		mountSharer  *fakeMountSharer
 		volumeLocker *fakeVolumeLocker
+		secretStore  *fakeSecretStore
+		classStore   *fakeClassStore
 	)
 
 	BeforeEach(func() {
@@ -87,6 +94,8 @@ var _ = Describe("RuncAdapter", func() {
 
 		mountSharer = &fakeMountSharer{}
 		volumeLocker = &fakeVolumeLocker{}
+		secretStore = &fakeSecretStore{secrets: map[string]string{}}
+		classStore = &fakeClassStore{classes: map[string]uint32{}}
 	})
 
 	JustBeforeEach(func() {
@@ -95,7 +104,7 @@ var _ = Describe("RuncAdapter", func() {
 		identityGlob := func(pattern string) ([]string, error) {
 			return []string{pattern}, nil
 		}
-		runcAdapter = NewRuncAdapter(features, identityGlob, mountSharer.MakeShared, volumeLocker)
+		runcAdapter = NewRuncAdapter(features, identityGlob, mountSharer.MakeShared, volumeLocker, secretStore, classStore)
 	})
 
 	AfterEach(func() {
@@ -104,7 +113,7 @@ var _ = Describe("RuncAdapter", func() {
 
 	Describe("CreateJobPrerequisites", func() {
 		It("creates the job prerequisites", func() {
-			stdout, stderr, err := runcAdapter.CreateJobPrerequisites(bpmCfg, procCfg, user)
+			stdoutSink, stderrSink, err := runcAdapter.CreateJobPrerequisites(bpmCfg, procCfg, user)
 			Expect(err).NotTo(HaveOccurred())
 
 			// PID Directory
@@ -129,6 +138,8 @@ var _ = Describe("RuncAdapter", func() {
 			Expect(socketDirInfo.Sys().(*syscall.Stat_t).Gid).To(Equal(uint32(300)))
 
 			// Stdout Log File
+			Expect(stdoutSink).To(BeAssignableToTypeOf(&os.File{}))
+			stdout := stdoutSink.(*os.File)
 			Expect(stdout.Name()).To(Equal(bpmCfg.Stdout().External()))
 			stdoutInfo, err := stdout.Stat()
 			Expect(err).NotTo(HaveOccurred())
@@ -137,6 +148,8 @@ var _ = Describe("RuncAdapter", func() {
 			Expect(stdoutInfo.Sys().(*syscall.Stat_t).Gid).To(Equal(uint32(300)))
 
 			// Stderr Log File
+			Expect(stderrSink).To(BeAssignableToTypeOf(&os.File{}))
+			stderr := stderrSink.(*os.File)
 			Expect(stderr.Name()).To(Equal(bpmCfg.Stderr().External()))
 			stderrInfo, err := stderr.Stat()
 			Expect(err).NotTo(HaveOccurred())
@@ -223,6 +236,30 @@ var _ = Describe("RuncAdapter", func() {
 			})
 		})
 
+		Context("when a volume has a lock", func() {
+			var volumePath string
+
+			BeforeEach(func() {
+				volumePath = filepath.Join(systemRoot, "some", "locked", "volume")
+				procCfg.AdditionalVolumes = append(procCfg.AdditionalVolumes, config.Volume{
+					Path:     volumePath,
+					Writable: true,
+					Lock:     true,
+				})
+			})
+
+			It("creates the lock file owned by the process's user", func() {
+				_, _, err := runcAdapter.CreateJobPrerequisites(bpmCfg, procCfg, user)
+				Expect(err).NotTo(HaveOccurred())
+
+				info, err := os.Stat(filepath.Join(volumePath, config.VolumeLockFile))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(info.Mode().IsRegular()).To(BeTrue())
+				Expect(info.Sys().(*syscall.Stat_t).Uid).To(Equal(uint32(200)))
+				Expect(info.Sys().(*syscall.Stat_t).Gid).To(Equal(uint32(300)))
+			})
+		})
+
 		Context("when a volume should be shared", func() {
 			var sharedPath string
 
@@ -284,6 +321,123 @@ var _ = Describe("RuncAdapter", func() {
 			})
 		})
 
+		Context("when the job directory is restricted to some paths", func() {
+			BeforeEach(func() {
+				procCfg.JobDir = &config.JobDir{Paths: []string{"bin", "config/server.yml"}}
+
+				jobDir := filepath.Join(systemRoot, "jobs", jobName)
+				Expect(os.MkdirAll(filepath.Join(jobDir, "bin"), 0755)).To(Succeed())
+				Expect(os.MkdirAll(filepath.Join(jobDir, "config"), 0755)).To(Succeed())
+				Expect(ioutil.WriteFile(filepath.Join(jobDir, "config", "server.yml"), nil, 0644)).To(Succeed())
+			})
+
+			It("mounts only those paths", func() {
+				spec, err := runcAdapter.BuildSpec(logger, bpmCfg, procCfg, user)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(spec.Mounts).To(HaveMount(specs.Mount{
+					Destination: filepath.Join("/var/vcap/jobs", jobName, "bin"),
+					Type:        "bind",
+					Source:      filepath.Join(systemRoot, "jobs", jobName, "bin"),
+					Options:     []string{"nodev", "nosuid", "exec", "bind", "ro"},
+				}))
+				Expect(spec.Mounts).To(HaveMount(specs.Mount{
+					Destination: filepath.Join("/var/vcap/jobs", jobName, "config", "server.yml"),
+					Type:        "bind",
+					Source:      filepath.Join(systemRoot, "jobs", jobName, "config", "server.yml"),
+					Options:     []string{"nodev", "nosuid", "exec", "bind", "ro"},
+				}))
+
+				for _, m := range spec.Mounts {
+					Expect(m.Destination).NotTo(Equal(filepath.Join("/var/vcap/jobs", jobName)))
+				}
+			})
+
+			Context("when a path does not exist", func() {
+				BeforeEach(func() {
+					procCfg.JobDir.Paths = append(procCfg.JobDir.Paths, "config/missing.yml")
+				})
+
+				It("returns an error", func() {
+					_, err := runcAdapter.BuildSpec(logger, bpmCfg, procCfg, user)
+					Expect(err).To(MatchError(ContainSubstring("job_dir path config/missing.yml cannot be mounted")))
+				})
+			})
+		})
+
+		Context("when the process has a termination log", func() {
+			BeforeEach(func() {
+				procCfg.TerminationLog = "/var/vcap/data/example/termination-log"
+			})
+
+			It("mounts the termination log writable at the configured path", func() {
+				spec, err := runcAdapter.BuildSpec(logger, bpmCfg, procCfg, user)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(spec.Mounts).To(HaveMount(specs.Mount{
+					Destination: "/var/vcap/data/example/termination-log",
+					Type:        "bind",
+					Source:      bpmCfg.TerminationLog().External(),
+					Options:     []string{"nodev", "nosuid", "noexec", "bind", "rw"},
+				}))
+			})
+		})
+
+		Context("when the process asks for the host's accounts", func() {
+			BeforeEach(func() {
+				procCfg.Accounts = config.AccountsHost
+			})
+
+			It("binds the host's passwd and group read-only", func() {
+				spec, err := runcAdapter.BuildSpec(logger, bpmCfg, procCfg, user)
+				Expect(err).NotTo(HaveOccurred())
+
+				for _, path := range []string{"/etc/passwd", "/etc/group"} {
+					Expect(spec.Mounts).To(HaveMount(specs.Mount{
+						Destination: path,
+						Type:        "bind",
+						Source:      path,
+						Options:     []string{"nodev", "nosuid", "noexec", "bind", "ro"},
+					}))
+				}
+			})
+		})
+
+		Context("when the process asks for minimal accounts", func() {
+			BeforeEach(func() {
+				procCfg.Accounts = config.AccountsMinimal
+			})
+
+			It("binds the generated passwd and group read-only", func() {
+				spec, err := runcAdapter.BuildSpec(logger, bpmCfg, procCfg, user)
+				Expect(err).NotTo(HaveOccurred())
+
+				for _, name := range []string{"passwd", "group"} {
+					Expect(spec.Mounts).To(HaveMount(specs.Mount{
+						Destination: filepath.Join("/etc", name),
+						Type:        "bind",
+						Source:      bpmCfg.AccountsDir().Join(name).External(),
+						Options:     []string{"nodev", "nosuid", "noexec", "bind", "ro"},
+					}))
+				}
+			})
+		})
+
+		Context("when the job directory is disabled", func() {
+			BeforeEach(func() {
+				procCfg.JobDir = &config.JobDir{Disabled: true}
+			})
+
+			It("does not mount any of the job directory", func() {
+				spec, err := runcAdapter.BuildSpec(logger, bpmCfg, procCfg, user)
+				Expect(err).NotTo(HaveOccurred())
+
+				for _, m := range spec.Mounts {
+					Expect(m.Destination).NotTo(HavePrefix(filepath.Join("/var/vcap/jobs", jobName)))
+				}
+			})
+		})
+
 		Context("when the user requests a persistent disk", func() {
 			BeforeEach(func() {
 				procCfg.PersistentDisk = true
@@ -330,6 +484,290 @@ var _ = Describe("RuncAdapter", func() {
 				Expect(dataDirInfo.Sys().(*syscall.Stat_t).Gid).To(Equal(uint32(300)))
 			})
 		})
+
+		It("places the container in a cgroup belonging to the BOSH root", func() {
+			spec, err := runcAdapter.BuildSpec(logger, bpmCfg, procCfg, user)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(spec.Linux.CgroupsPath).To(Equal(bpmCfg.CgroupsPath()))
+			Expect(spec.Linux.CgroupsPath).NotTo(BeEmpty())
+		})
+
+		It("records the cgroup of the container so that other tools can find it", func() {
+			procCfg.Labels = map[string]string{config.CgroupPathAnnotation: "/elsewhere"}
+
+			spec, err := runcAdapter.BuildSpec(logger, bpmCfg, procCfg, user)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(spec.Annotations).To(HaveKeyWithValue(config.CgroupPathAnnotation, spec.Linux.CgroupsPath))
+		})
+
+		It("records the checksum of the configuration which the spec was built from", func() {
+			spec, err := runcAdapter.BuildSpec(logger, bpmCfg, procCfg, user)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(spec.Annotations).To(HaveKeyWithValue(config.ConfigChecksumAnnotation, procCfg.Checksum()))
+			Expect(procCfg.Checksum()).NotTo(BeEmpty())
+		})
+
+		Context("when a volume is written as it is seen in the container", func() {
+			BeforeEach(func() {
+				procCfg.AdditionalVolumes = []config.Volume{
+					{Path: "/var/vcap/data/example/cache", Writable: true},
+				}
+			})
+
+			It("mounts it from within the BOSH root", func() {
+				spec, err := runcAdapter.BuildSpec(logger, bpmCfg, procCfg, user)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(spec.Mounts).To(HaveMount(specs.Mount{
+					Destination: "/var/vcap/data/example/cache",
+					Type:        "bind",
+					Source:      filepath.Join(systemRoot, "data", "example", "cache"),
+					Options:     []string{"nodev", "nosuid", "noexec", "rbind", "rw"},
+				}))
+			})
+		})
+
+		Context("when the process has sockets", func() {
+			var socketDir string
+
+			BeforeEach(func() {
+				socketDir = filepath.Join(systemRoot, "sys", "run", "other-job")
+				procCfg.Sockets = []config.Socket{
+					{Path: filepath.Join(socketDir, "api.sock"), Owner: "root", Group: "root", Mode: "0660"},
+				}
+			})
+
+			It("creates the socket directory for the process user and the socket's group", func() {
+				_, _, err := runcAdapter.CreateJobPrerequisites(bpmCfg, procCfg, user)
+				Expect(err).NotTo(HaveOccurred())
+
+				socketDirInfo, err := os.Stat(socketDir)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(socketDirInfo.IsDir()).To(BeTrue())
+				Expect(socketDirInfo.Mode() & os.ModePerm).To(Equal(config.SocketDirMode))
+				Expect(socketDirInfo.Mode() & os.ModeSetgid).To(Equal(os.ModeSetgid))
+				Expect(socketDirInfo.Sys().(*syscall.Stat_t).Uid).To(Equal(uint32(200)))
+				Expect(socketDirInfo.Sys().(*syscall.Stat_t).Gid).To(Equal(uint32(0)))
+			})
+
+			Context("and no ownership or mode is configured", func() {
+				BeforeEach(func() {
+					procCfg.Sockets = []config.Socket{
+						{Path: filepath.Join(socketDir, "api.sock")},
+					}
+				})
+
+				It("uses the process user and group", func() {
+					_, _, err := runcAdapter.CreateJobPrerequisites(bpmCfg, procCfg, user)
+					Expect(err).NotTo(HaveOccurred())
+
+					socketDirInfo, err := os.Stat(socketDir)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(socketDirInfo.Mode() & os.ModePerm).To(Equal(config.SocketDirMode))
+					Expect(socketDirInfo.Sys().(*syscall.Stat_t).Uid).To(Equal(uint32(200)))
+					Expect(socketDirInfo.Sys().(*syscall.Stat_t).Gid).To(Equal(uint32(300)))
+				})
+			})
+
+			Context("and the group does not exist", func() {
+				BeforeEach(func() {
+					procCfg.Sockets[0].Group = "this-group-does-not-exist"
+				})
+
+				It("returns an error", func() {
+					_, _, err := runcAdapter.CreateJobPrerequisites(bpmCfg, procCfg, user)
+					Expect(err).To(MatchError(ContainSubstring("invalid socket group")))
+				})
+			})
+		})
+
+		Context("when the process has a termination log", func() {
+			BeforeEach(func() {
+				procCfg.TerminationLog = "/var/vcap/data/example/termination-log"
+			})
+
+			It("creates an empty termination log owned by the process user", func() {
+				Expect(os.MkdirAll(bpmCfg.PidDir().External(), 0700)).To(Succeed())
+				Expect(ioutil.WriteFile(bpmCfg.TerminationLog().External(), []byte("previous run"), 0600)).To(Succeed())
+
+				_, _, err := runcAdapter.CreateJobPrerequisites(bpmCfg, procCfg, user)
+				Expect(err).NotTo(HaveOccurred())
+
+				info, err := os.Stat(bpmCfg.TerminationLog().External())
+				Expect(err).NotTo(HaveOccurred())
+				Expect(info.Size()).To(BeZero())
+				Expect(info.Sys().(*syscall.Stat_t).Uid).To(Equal(uint32(200)))
+				Expect(info.Sys().(*syscall.Stat_t).Gid).To(Equal(uint32(300)))
+			})
+		})
+
+		Context("when the process limits its egress rate", func() {
+			BeforeEach(func() {
+				procCfg.Network = &config.Network{EgressRate: "20M"}
+				features.NetClassSupported = true
+			})
+
+			It("allocates a class for the container", func() {
+				_, _, err := runcAdapter.CreateJobPrerequisites(bpmCfg, procCfg, user)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(classStore.classes).To(HaveKey(bpmCfg.ContainerID()))
+			})
+
+			Context("when no class can be allocated", func() {
+				BeforeEach(func() {
+					classStore.err = errors.New("every egress class is held by another container")
+				})
+
+				It("returns an error", func() {
+					_, _, err := runcAdapter.CreateJobPrerequisites(bpmCfg, procCfg, user)
+					Expect(err).To(MatchError("failed to allocate an egress class: every egress class is held by another container"))
+				})
+			})
+
+			Context("when the host has no net_cls controller", func() {
+				BeforeEach(func() {
+					features.NetClassSupported = false
+				})
+
+				It("does not allocate a class", func() {
+					_, _, err := runcAdapter.CreateJobPrerequisites(bpmCfg, procCfg, user)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(classStore.classes).To(BeEmpty())
+				})
+			})
+		})
+
+		Context("when the process has its own machine ID", func() {
+			readMachineID := func(cfg *config.BPMConfig) string {
+				id, err := ioutil.ReadFile(cfg.MachineIDFile().External())
+				Expect(err).NotTo(HaveOccurred())
+				return string(id)
+			}
+
+			BeforeEach(func() {
+				Expect(os.MkdirAll(filepath.Join(systemRoot, "bosh"), 0700)).To(Succeed())
+				Expect(ioutil.WriteFile(filepath.Join(systemRoot, "bosh", "spec.json"), []byte(`{"id":"instance-a","index":0}`), 0600)).To(Succeed())
+			})
+
+			It("writes one which stays the same when the process is restarted", func() {
+				_, _, err := runcAdapter.CreateJobPrerequisites(bpmCfg, procCfg, user)
+				Expect(err).NotTo(HaveOccurred())
+				first := readMachineID(bpmCfg)
+				Expect(first).To(MatchRegexp(`^[0-9a-f]{32}\n$`))
+
+				_, _, err = runcAdapter.CreateJobPrerequisites(bpmCfg, procCfg, user)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(readMachineID(bpmCfg)).To(Equal(first))
+			})
+
+			It("gives each process and each instance a different one", func() {
+				_, _, err := runcAdapter.CreateJobPrerequisites(bpmCfg, procCfg, user)
+				Expect(err).NotTo(HaveOccurred())
+				first := readMachineID(bpmCfg)
+
+				otherCfg := config.NewBPMConfig(bosh.NewEnv(systemRoot), jobName, "worker")
+				_, _, err = runcAdapter.CreateJobPrerequisites(otherCfg, procCfg, user)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(readMachineID(otherCfg)).NotTo(Equal(first))
+
+				Expect(ioutil.WriteFile(filepath.Join(systemRoot, "bosh", "spec.json"), []byte(`{"id":"instance-b","index":1}`), 0600)).To(Succeed())
+				_, _, err = runcAdapter.CreateJobPrerequisites(bpmCfg, procCfg, user)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(readMachineID(bpmCfg)).NotTo(Equal(first))
+			})
+		})
+
+		Context("when the process asks for minimal accounts", func() {
+			BeforeEach(func() {
+				procCfg.Accounts = config.AccountsMinimal
+			})
+
+			It("writes passwd and group files describing only root and the process user", func() {
+				_, _, err := runcAdapter.CreateJobPrerequisites(bpmCfg, procCfg, user)
+				Expect(err).NotTo(HaveOccurred())
+
+				passwd, err := ioutil.ReadFile(bpmCfg.AccountsDir().Join("passwd").External())
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(passwd)).To(Equal(
+					"root:x:0:0:root:/root:/usr/sbin/nologin\n" +
+						"vcap:x:200:300::/var/vcap/data/example:/usr/sbin/nologin\n",
+				))
+
+				group, err := ioutil.ReadFile(bpmCfg.AccountsDir().Join("group").External())
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(group)).To(Equal("root:x:0:\nvcap:x:300:\n"))
+			})
+
+			Context("when the user was given numerically", func() {
+				BeforeEach(func() {
+					user = specs.User{UID: 200, GID: 300}
+				})
+
+				It("names the user after the process", func() {
+					_, _, err := runcAdapter.CreateJobPrerequisites(bpmCfg, procCfg, user)
+					Expect(err).NotTo(HaveOccurred())
+
+					passwd, err := ioutil.ReadFile(bpmCfg.AccountsDir().Join("passwd").External())
+					Expect(err).NotTo(HaveOccurred())
+					Expect(string(passwd)).To(ContainSubstring(fmt.Sprintf("%s:x:200:300:", procName)))
+				})
+			})
+		})
+
+		Context("when another BOSH root is in use at the same time", func() {
+			var (
+				otherRoot string
+				otherCfg  *config.BPMConfig
+			)
+
+			BeforeEach(func() {
+				var err error
+				otherRoot, err = ioutil.TempDir("", "runc-adapter-other-root")
+				Expect(err).NotTo(HaveOccurred())
+				otherCfg = config.NewBPMConfig(bosh.NewEnv(otherRoot), jobName, procName)
+
+				procCfg.AdditionalVolumes = []config.Volume{
+					{Path: "/var/vcap/data/example/cache"},
+				}
+			})
+
+			AfterEach(func() {
+				Expect(os.RemoveAll(otherRoot)).To(Succeed())
+			})
+
+			It("creates the prerequisites of each within its own root", func() {
+				errs := make(chan error, 2)
+				for _, cfg := range []*config.BPMConfig{bpmCfg, otherCfg} {
+					go func(cfg *config.BPMConfig) {
+						stdout, stderr, err := runcAdapter.CreateJobPrerequisites(cfg, procCfg, user)
+						if err == nil {
+							stdout.Close()
+							stderr.Close()
+						}
+						errs <- err
+					}(cfg)
+				}
+				Expect(<-errs).To(Succeed())
+				Expect(<-errs).To(Succeed())
+
+				for _, root := range []string{systemRoot, otherRoot} {
+					Expect(filepath.Join(root, "data", "example", "cache")).To(BeADirectory())
+					Expect(filepath.Join(root, "sys", "log", "example", "server.stdout.log")).To(BeAnExistingFile())
+					Expect(filepath.Join(root, "sys", "run", "bpm", "example")).To(BeADirectory())
+				}
+			})
+		})
+
+		Context("when the process chooses a log sink which does not exist", func() {
+			BeforeEach(func() {
+				procCfg.LogSink = &config.LogSink{Type: "carrier-pigeon"}
+			})
+
+			It("returns an error", func() {
+				_, _, err := runcAdapter.CreateJobPrerequisites(bpmCfg, procCfg, user)
+				Expect(err).To(MatchError(ContainSubstring(`unknown log sink "carrier-pigeon"`)))
+			})
+		})
 	})
 
 	Describe("BuildSpec", func() {
@@ -388,7 +826,7 @@ var _ = Describe("RuncAdapter", func() {
 			expectedEnv := convertEnv(procCfg.Env)
 			expectedEnv = append(expectedEnv, fmt.Sprintf("TMPDIR=%s", "/var/vcap/data/example/tmp"))
 			expectedEnv = append(expectedEnv, fmt.Sprintf("LANG=%s", defaultLang))
-			expectedEnv = append(expectedEnv, fmt.Sprintf("PATH=%s", defaultPath(bpmCfg)))
+			expectedEnv = append(expectedEnv, fmt.Sprintf("PATH=%s", defaultPath(bpmCfg, nil)))
 			expectedEnv = append(expectedEnv, fmt.Sprintf("HOME=%s", "/var/vcap/data/example"))
 
 			Expect(spec.Process.Terminal).To(Equal(false))
@@ -396,6 +834,7 @@ var _ = Describe("RuncAdapter", func() {
 			Expect(spec.Process.User).To(Equal(user))
 			Expect(spec.Process.Args).To(Equal(expectedProcessArgs))
 			Expect(spec.Process.Env).To(ConsistOf(expectedEnv))
+			Expect(sort.StringsAreSorted(spec.Process.Env)).To(BeTrue())
 			Expect(spec.Process.Cwd).To(Equal(filepath.Join("/var/vcap/jobs", jobName)))
 			Expect(spec.Process.Rlimits).To(BeNil())
 			Expect(spec.Process.NoNewPrivileges).To(Equal(true))
@@ -411,7 +850,7 @@ var _ = Describe("RuncAdapter", func() {
 				Path: bpmCfg.RootFSPath(),
 			}))
 
-			Expect(spec.Mounts).To(HaveLen(24))
+			Expect(spec.Mounts).To(HaveLen(25))
 			Expect(spec.Mounts).To(HaveMount(specs.Mount{
 				Destination: "/proc",
 				Type:        "proc",
@@ -555,9 +994,15 @@ var _ = Describe("RuncAdapter", func() {
 			Expect(spec.Mounts).To(HaveMount(specs.Mount{
 				Destination: filepath.Join("/var/vcap/store", "example"),
 				Type:        "bind",
-				Source:      filepath.Join("/var/vcap/store", "example"),
+				Source:      filepath.Join(systemRoot, "store", "example"),
 				Options:     []string{"nodev", "nosuid", "exec", "rbind", "rw"},
 			}))
+			Expect(spec.Mounts).To(HaveMount(specs.Mount{
+				Destination: "/etc/machine-id",
+				Type:        "bind",
+				Source:      bpmCfg.MachineIDFile().External(),
+				Options:     []string{"nodev", "nosuid", "noexec", "bind", "ro"},
+			}))
 
 			// The mounts provided in the default spec are always first and not
 			// necessarily sorted.  See specbuilder.DefaultSpec for more information
@@ -594,6 +1039,7 @@ var _ = Describe("RuncAdapter", func() {
 				specs.LinuxNamespace{Type: "pid"},
 				specs.LinuxNamespace{Type: "uts"},
 			))
+			Expect(spec.Hostname).To(Equal(bpmCfg.Hostname()))
 
 			// This must be part of the existing It block to preven test pollution
 			By("the presence of /run/resolvconf on the host")
@@ -626,7 +1072,7 @@ var _ = Describe("RuncAdapter", func() {
 				Expect(err).NotTo(HaveOccurred())
 				Expect(spec.Process.Env).NotTo(ContainElement(fmt.Sprintf("TMPDIR=%s", bpmCfg.TempDir())))
 				Expect(spec.Process.Env).NotTo(ContainElement(fmt.Sprintf("LANG=%s", defaultLang)))
-				Expect(spec.Process.Env).NotTo(ContainElement(fmt.Sprintf("PATH=%s", defaultPath(bpmCfg))))
+				Expect(spec.Process.Env).NotTo(ContainElement(fmt.Sprintf("PATH=%s", defaultPath(bpmCfg, nil))))
 				Expect(spec.Process.Env).NotTo(ContainElement(fmt.Sprintf("HOME=%s", bpmCfg.DataDir())))
 				Expect(spec.Process.Env).To(ContainElement("TMPDIR=/I/AM/A/TMPDIR"))
 				Expect(spec.Process.Env).To(ContainElement("LANG=esperanto"))
@@ -635,12 +1081,308 @@ var _ = Describe("RuncAdapter", func() {
 			})
 		})
 
-		Context("when a workdir is provided", func() {
+		Context("when the job depends on packages", func() {
 			BeforeEach(func() {
-				procCfg.WorkDir = "/I/AM/A/WORKDIR"
+				for _, pkg := range []string{"ruby", "nginx", "config-only"} {
+					Expect(os.MkdirAll(filepath.Join(systemRoot, "jobs", jobName, "packages", pkg), 0755)).To(Succeed())
+				}
+				Expect(os.MkdirAll(filepath.Join(systemRoot, "packages", "nginx", "bin"), 0755)).To(Succeed())
+				Expect(os.MkdirAll(filepath.Join(systemRoot, "packages", "ruby", "bin"), 0755)).To(Succeed())
+				Expect(os.MkdirAll(filepath.Join(systemRoot, "packages", "config-only"), 0755)).To(Succeed())
+				Expect(os.MkdirAll(filepath.Join(systemRoot, "packages", "unrelated", "bin"), 0755)).To(Succeed())
 			})
 
-			It("sets the current working directory of the process", func() {
+			It("adds the bin directory of each of them to the PATH", func() {
+				spec, err := runcAdapter.BuildSpec(logger, bpmCfg, procCfg, user)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(spec.Process.Env).To(ContainElement(
+					"PATH=/var/vcap/jobs/example/bin:/var/vcap/packages/nginx/bin:/var/vcap/packages/ruby/bin:" +
+						"/usr/local/bin:/usr/local/sbin:/usr/bin:/usr/sbin:/bin:/sbin:.",
+				))
+			})
+
+			Context("when the process adds directories to its path", func() {
+				BeforeEach(func() {
+					procCfg.Path = []string{"/var/vcap/packages/ruby/lib/gems/bin"}
+				})
+
+				It("searches them first", func() {
+					spec, err := runcAdapter.BuildSpec(logger, bpmCfg, procCfg, user)
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(spec.Process.Env).To(ContainElement(HavePrefix(
+						"PATH=/var/vcap/packages/ruby/lib/gems/bin:/var/vcap/jobs/example/bin:/var/vcap/packages/nginx/bin:",
+					)))
+				})
+			})
+		})
+
+		Context("when environment variables are read from files", func() {
+			var secretPath string
+
+			BeforeEach(func() {
+				secretPath = filepath.Join(systemRoot, "secret")
+				Expect(ioutil.WriteFile(secretPath, []byte("hunter2\n"), 0600)).To(Succeed())
+
+				procCfg.EnvFromFiles = map[string]string{"PASSWORD": secretPath}
+			})
+
+			It("adds the contents of the file without the trailing newline", func() {
+				spec, err := runcAdapter.BuildSpec(logger, bpmCfg, procCfg, user)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(spec.Process.Env).To(ContainElement("PASSWORD=hunter2"))
+				Expect(spec.Process.Env).To(ContainElement("RAVE=true"))
+			})
+
+			It("does not modify the process configuration", func() {
+				_, err := runcAdapter.BuildSpec(logger, bpmCfg, procCfg, user)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(procCfg.Env).NotTo(HaveKey("PASSWORD"))
+			})
+
+			Context("when the file cannot be read", func() {
+				BeforeEach(func() {
+					Expect(os.Remove(secretPath)).To(Succeed())
+				})
+
+				It("returns an error", func() {
+					_, err := runcAdapter.BuildSpec(logger, bpmCfg, procCfg, user)
+					Expect(err).To(MatchError(ContainSubstring("PASSWORD")))
+				})
+			})
+		})
+
+		Context("when environment variables are inherited from the host", func() {
+			BeforeEach(func() {
+				Expect(os.Setenv("BPM_TEST_AGENT_TENANT", "example")).To(Succeed())
+				Expect(os.Unsetenv("BPM_TEST_AGENT_UNSET")).To(Succeed())
+
+				procCfg.InheritEnv = []string{"BPM_TEST_AGENT_TENANT", "BPM_TEST_AGENT_UNSET"}
+			})
+
+			AfterEach(func() {
+				Expect(os.Unsetenv("BPM_TEST_AGENT_TENANT")).To(Succeed())
+			})
+
+			It("copies the variables which bpm was given", func() {
+				spec, err := runcAdapter.BuildSpec(logger, bpmCfg, procCfg, user)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(spec.Process.Env).To(ContainElement("BPM_TEST_AGENT_TENANT=example"))
+				Expect(spec.Process.Env).To(ContainElement("RAVE=true"))
+				Expect(spec.Process.Env).NotTo(ContainElement(HavePrefix("BPM_TEST_AGENT_UNSET=")))
+			})
+
+			It("does not copy anything else from bpm's environment", func() {
+				Expect(os.Setenv("BPM_TEST_AGENT_OTHER", "other")).To(Succeed())
+				defer os.Unsetenv("BPM_TEST_AGENT_OTHER")
+
+				spec, err := runcAdapter.BuildSpec(logger, bpmCfg, procCfg, user)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(spec.Process.Env).NotTo(ContainElement(HavePrefix("BPM_TEST_AGENT_OTHER=")))
+			})
+		})
+
+		Context("when environment variables reference secrets", func() {
+			BeforeEach(func() {
+				secretStore.secrets["/cf/example/db_password"] = "hunter2"
+				procCfg.Env["DB_PASSWORD"] = "((/cf/example/db_password))"
+				procCfg.Env["DB_URL"] = "postgres://admin:((/cf/example/db_password))@db"
+			})
+
+			It("replaces the references with the values from the secret store", func() {
+				spec, err := runcAdapter.BuildSpec(logger, bpmCfg, procCfg, user)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(spec.Process.Env).To(ContainElement("DB_PASSWORD=hunter2"))
+				Expect(spec.Process.Env).To(ContainElement("DB_URL=postgres://admin:hunter2@db"))
+				Expect(procCfg.Env["DB_PASSWORD"]).To(Equal("((/cf/example/db_password))"))
+			})
+
+			Context("when the secret does not exist", func() {
+				BeforeEach(func() {
+					procCfg.Env["API_KEY"] = "((/cf/example/api_key))"
+				})
+
+				It("returns an error", func() {
+					_, err := runcAdapter.BuildSpec(logger, bpmCfg, procCfg, user)
+					Expect(err).To(MatchError(ContainSubstring("/cf/example/api_key")))
+				})
+			})
+
+			Context("when no secret store is configured", func() {
+				JustBeforeEach(func() {
+					runcAdapter = NewRuncAdapter(features, filepath.Glob, mountSharer.MakeShared, volumeLocker, nil, classStore)
+				})
+
+				It("returns an error", func() {
+					_, err := runcAdapter.BuildSpec(logger, bpmCfg, procCfg, user)
+					Expect(err).To(HaveOccurred())
+				})
+			})
+		})
+
+		Context("when a timezone is provided", func() {
+			var originalZoneinfoDir string
+
+			BeforeEach(func() {
+				originalZoneinfoDir = zoneinfoDir
+				zoneinfoDir = filepath.Join(systemRoot, "zoneinfo")
+				Expect(os.MkdirAll(filepath.Join(zoneinfoDir, "Europe"), 0755)).To(Succeed())
+				Expect(ioutil.WriteFile(filepath.Join(zoneinfoDir, "Europe", "London"), []byte("TZif"), 0644)).To(Succeed())
+
+				procCfg.Timezone = "Europe/London"
+			})
+
+			AfterEach(func() {
+				zoneinfoDir = originalZoneinfoDir
+			})
+
+			It("sets the TZ environment variable", func() {
+				spec, err := runcAdapter.BuildSpec(logger, bpmCfg, procCfg, user)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(spec.Process.Env).To(ContainElement("TZ=Europe/London"))
+				Expect(procCfg.Env).NotTo(HaveKey("TZ"))
+			})
+
+			Context("when the process sets TZ itself", func() {
+				BeforeEach(func() {
+					procCfg.Env["TZ"] = "UTC"
+				})
+
+				It("uses the process's value", func() {
+					spec, err := runcAdapter.BuildSpec(logger, bpmCfg, procCfg, user)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(spec.Process.Env).To(ContainElement("TZ=UTC"))
+					Expect(spec.Process.Env).NotTo(ContainElement("TZ=Europe/London"))
+				})
+			})
+
+			Context("when the zone is not installed on the host", func() {
+				BeforeEach(func() {
+					procCfg.Timezone = "Mars/Olympus_Mons"
+				})
+
+				It("returns an error", func() {
+					_, err := runcAdapter.BuildSpec(logger, bpmCfg, procCfg, user)
+					Expect(err).To(MatchError(ContainSubstring("Mars/Olympus_Mons")))
+				})
+			})
+		})
+
+		Context("when a NUMA node is provided", func() {
+			var originalNUMANodeDir string
+
+			BeforeEach(func() {
+				originalNUMANodeDir = numaNodeDir
+				numaNodeDir = filepath.Join(systemRoot, "node")
+				Expect(os.MkdirAll(filepath.Join(numaNodeDir, "node1"), 0755)).To(Succeed())
+				Expect(ioutil.WriteFile(filepath.Join(numaNodeDir, "node1", "cpulist"), []byte("8-15,24-31\n"), 0644)).To(Succeed())
+
+				node := 1
+				procCfg.NUMANode = &node
+			})
+
+			AfterEach(func() {
+				numaNodeDir = originalNUMANodeDir
+			})
+
+			It("binds the process's CPUs and memory to the node", func() {
+				spec, err := runcAdapter.BuildSpec(logger, bpmCfg, procCfg, user)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(spec.Linux.Resources.CPU.Cpus).To(Equal("8-15,24-31"))
+				Expect(spec.Linux.Resources.CPU.Mems).To(Equal("1"))
+			})
+
+			Context("when the node does not exist on the host", func() {
+				BeforeEach(func() {
+					node := 3
+					procCfg.NUMANode = &node
+				})
+
+				It("returns an error", func() {
+					_, err := runcAdapter.BuildSpec(logger, bpmCfg, procCfg, user)
+					Expect(err).To(MatchError(ContainSubstring("node 3 does not exist")))
+				})
+			})
+		})
+
+		Context("when a cpuset is provided", func() {
+			var originalCPUDir, originalNUMANodeDir string
+
+			BeforeEach(func() {
+				originalCPUDir = cpuDir
+				cpuDir = filepath.Join(systemRoot, "cpu")
+				Expect(os.MkdirAll(cpuDir, 0755)).To(Succeed())
+				Expect(ioutil.WriteFile(filepath.Join(cpuDir, "online"), []byte("0-31\n"), 0644)).To(Succeed())
+
+				cpuset := "0-3,7"
+				procCfg.Limits = &config.Limits{CPUSet: &cpuset}
+			})
+
+			AfterEach(func() {
+				cpuDir = originalCPUDir
+			})
+
+			It("pins the process to the CPUs", func() {
+				spec, err := runcAdapter.BuildSpec(logger, bpmCfg, procCfg, user)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(spec.Linux.Resources.CPU.Cpus).To(Equal("0-3,7"))
+				Expect(spec.Linux.Resources.CPU.Mems).To(BeEmpty())
+			})
+
+			Context("when a CPU is not online", func() {
+				BeforeEach(func() {
+					cpuset := "30-33"
+					procCfg.Limits.CPUSet = &cpuset
+				})
+
+				It("returns an error", func() {
+					_, err := runcAdapter.BuildSpec(logger, bpmCfg, procCfg, user)
+					Expect(err).To(MatchError(`invalid cpuset "30-33": CPU 32 is not online on this host`))
+				})
+			})
+
+			Context("when the process is also bound to a NUMA node", func() {
+				BeforeEach(func() {
+					originalNUMANodeDir = numaNodeDir
+					numaNodeDir = filepath.Join(systemRoot, "node")
+					Expect(os.MkdirAll(filepath.Join(numaNodeDir, "node1"), 0755)).To(Succeed())
+					Expect(ioutil.WriteFile(filepath.Join(numaNodeDir, "node1", "cpulist"), []byte("8-15,24-31\n"), 0644)).To(Succeed())
+
+					node := 1
+					procCfg.NUMANode = &node
+
+					cpuset := "8-9"
+					procCfg.Limits.CPUSet = &cpuset
+				})
+
+				AfterEach(func() {
+					numaNodeDir = originalNUMANodeDir
+				})
+
+				It("pins the process to the CPUs and binds its memory to the node", func() {
+					spec, err := runcAdapter.BuildSpec(logger, bpmCfg, procCfg, user)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(spec.Linux.Resources.CPU.Cpus).To(Equal("8-9"))
+					Expect(spec.Linux.Resources.CPU.Mems).To(Equal("1"))
+				})
+
+				It("returns an error when a CPU is not on the node", func() {
+					cpuset := "7-8"
+					procCfg.Limits.CPUSet = &cpuset
+
+					_, err := runcAdapter.BuildSpec(logger, bpmCfg, procCfg, user)
+					Expect(err).To(MatchError(ContainSubstring("CPU 7 is not on the process's numa_node")))
+				})
+			})
+		})
+
+		Context("when a workdir is provided", func() {
+			BeforeEach(func() {
+				procCfg.WorkDir = "/I/AM/A/WORKDIR"
+			})
+
+			It("sets the current working directory of the process", func() {
 				spec, err := runcAdapter.BuildSpec(logger, bpmCfg, procCfg, user)
 				Expect(err).NotTo(HaveOccurred())
 				Expect(spec.Process.Cwd).To(Equal("/I/AM/A/WORKDIR"))
@@ -663,6 +1405,24 @@ var _ = Describe("RuncAdapter", func() {
 					Options:     []string{"nodev", "nosuid", "noexec", "rbind", "rw"},
 				}))
 			})
+
+			Context("and asks for it to be read-only", func() {
+				BeforeEach(func() {
+					procCfg.PersistentDiskReadOnly = true
+				})
+
+				It("bind mounts the store directory read-only", func() {
+					spec, err := runcAdapter.BuildSpec(logger, bpmCfg, procCfg, user)
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(spec.Mounts).To(HaveMount(specs.Mount{
+						Destination: filepath.Join("/var/vcap/store", jobName),
+						Type:        "bind",
+						Source:      filepath.Join(systemRoot, "store", "example"),
+						Options:     []string{"nodev", "nosuid", "noexec", "rbind", "ro"},
+					}))
+				})
+			})
 		})
 
 		Context("when the user requests an ephemeral disk", func() {
@@ -683,71 +1443,473 @@ var _ = Describe("RuncAdapter", func() {
 			})
 		})
 
-		Context("when limits are provided", func() {
-			BeforeEach(func() {
-				procCfg.Limits = &config.Limits{}
-			})
+		Context("when limits are provided", func() {
+			BeforeEach(func() {
+				procCfg.Limits = &config.Limits{}
+			})
+
+			It("sets no limits by default", func() {
+				_, err := runcAdapter.BuildSpec(logger, bpmCfg, procCfg, user)
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			Context("Memory", func() {
+				var expectedMemoryLimit string
+
+				BeforeEach(func() {
+					expectedMemoryLimit = "100G"
+					procCfg.Limits.Memory = &expectedMemoryLimit
+				})
+
+				Context("when the system supports swap", func() {
+					BeforeEach(func() {
+						features.SwapLimitSupported = true
+					})
+
+					It("sets the memory limit on the container", func() {
+						spec, err := runcAdapter.BuildSpec(logger, bpmCfg, procCfg, user)
+						Expect(err).NotTo(HaveOccurred())
+
+						expectedMemoryLimitInBytes, err := bytefmt.ToBytes(expectedMemoryLimit)
+						Expect(err).NotTo(HaveOccurred())
+						signedExpectedMemoryLimitInBytes := int64(expectedMemoryLimitInBytes)
+						Expect(spec.Linux.Resources.Memory).To(Equal(&specs.LinuxMemory{
+							Limit: &signedExpectedMemoryLimitInBytes,
+							Swap:  &signedExpectedMemoryLimitInBytes,
+						}))
+					})
+				})
+
+				Context("when the system does not support swap", func() {
+					BeforeEach(func() {
+						features.SwapLimitSupported = false
+					})
+
+					It("sets the memory (but not swap) limit on the container", func() {
+						spec, err := runcAdapter.BuildSpec(logger, bpmCfg, procCfg, user)
+						Expect(err).NotTo(HaveOccurred())
+
+						expectedMemoryLimitInBytes, err := bytefmt.ToBytes(expectedMemoryLimit)
+						Expect(err).NotTo(HaveOccurred())
+						signedExpectedMemoryLimitInBytes := int64(expectedMemoryLimitInBytes)
+						Expect(spec.Linux.Resources.Memory).To(Equal(&specs.LinuxMemory{
+							Limit: &signedExpectedMemoryLimitInBytes,
+						}))
+					})
+				})
+
+				Context("when the process has a swap limit", func() {
+					var swapLimit string
+
+					BeforeEach(func() {
+						swapLimit = "150G"
+						procCfg.Limits.Swap = &swapLimit
+						features.SwapLimitSupported = true
+					})
+
+					It("limits memory and swap together", func() {
+						spec, err := runcAdapter.BuildSpec(logger, bpmCfg, procCfg, user)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(*spec.Linux.Resources.Memory.Limit).To(Equal(int64(100 * bytefmt.GIGABYTE)))
+						Expect(*spec.Linux.Resources.Memory.Swap).To(Equal(int64(150 * bytefmt.GIGABYTE)))
+					})
+
+					Context("when the kernel does not account for swap", func() {
+						BeforeEach(func() {
+							features.SwapLimitSupported = false
+						})
+
+						It("returns an error", func() {
+							_, err := runcAdapter.BuildSpec(logger, bpmCfg, procCfg, user)
+							Expect(err).To(MatchError(ContainSubstring("the kernel does not account for swap")))
+						})
+					})
+
+					Context("when it is less than a memory limit given as a percentage", func() {
+						BeforeEach(func() {
+							features.MemoryTotal = 800 * bytefmt.GIGABYTE
+							memoryLimit := "25%"
+							procCfg.Limits.Memory = &memoryLimit
+						})
+
+						It("returns an error", func() {
+							_, err := runcAdapter.BuildSpec(logger, bpmCfg, procCfg, user)
+							Expect(err).To(MatchError(ContainSubstring("must be at least the memory limit")))
+						})
+					})
+				})
+
+				Context("when the memory limit is a percentage of the host's memory", func() {
+					BeforeEach(func() {
+						features.MemoryTotal = 8 * bytefmt.GIGABYTE
+						memoryLimit := "25%"
+						procCfg.Limits.Memory = &memoryLimit
+					})
+
+					It("sets that share of the host's memory as the limit", func() {
+						spec, err := runcAdapter.BuildSpec(logger, bpmCfg, procCfg, user)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(*spec.Linux.Resources.Memory.Limit).To(Equal(int64(2 * bytefmt.GIGABYTE)))
+					})
+				})
+
+				Context("when the memory limit is invalid", func() {
+					BeforeEach(func() {
+						memoryLimit := "invalid byte value"
+						procCfg.Limits.Memory = &memoryLimit
+					})
+
+					It("returns an error", func() {
+						_, err := runcAdapter.BuildSpec(logger, bpmCfg, procCfg, user)
+						Expect(err).To(HaveOccurred())
+					})
+				})
+			})
+
+			Context("MemoryReservation", func() {
+				BeforeEach(func() {
+					features.MemoryTotal = 8 * bytefmt.GIGABYTE
+					reservation := "25%"
+					procCfg.Limits.MemoryReservation = &reservation
+				})
+
+				It("sets the soft limit on the container without a hard limit", func() {
+					spec, err := runcAdapter.BuildSpec(logger, bpmCfg, procCfg, user)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(*spec.Linux.Resources.Memory.Reservation).To(Equal(int64(2 * bytefmt.GIGABYTE)))
+					Expect(spec.Linux.Resources.Memory.Limit).To(BeNil())
+				})
+
+				Context("when there is also a memory limit", func() {
+					BeforeEach(func() {
+						memoryLimit := "4G"
+						procCfg.Limits.Memory = &memoryLimit
+					})
+
+					It("sets both limits", func() {
+						spec, err := runcAdapter.BuildSpec(logger, bpmCfg, procCfg, user)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(*spec.Linux.Resources.Memory.Reservation).To(Equal(int64(2 * bytefmt.GIGABYTE)))
+						Expect(*spec.Linux.Resources.Memory.Limit).To(Equal(int64(4 * bytefmt.GIGABYTE)))
+					})
+				})
+
+				Context("when it is more than the memory limit on this host", func() {
+					BeforeEach(func() {
+						memoryLimit := "1G"
+						procCfg.Limits.Memory = &memoryLimit
+					})
+
+					It("returns an error", func() {
+						_, err := runcAdapter.BuildSpec(logger, bpmCfg, procCfg, user)
+						Expect(err).To(MatchError(`invalid memory reservation "25%": must not be more than the memory limit of 1073741824 bytes`))
+					})
+				})
+			})
+
+			Context("KernelMemory", func() {
+				BeforeEach(func() {
+					kernelMemory := "256M"
+					procCfg.Limits.KernelMemory = &kernelMemory
+				})
+
+				Context("when the kernel can limit kernel memory separately", func() {
+					BeforeEach(func() {
+						features.KernelMemoryLimitSupported = true
+					})
+
+					It("limits the kernel memory of the container", func() {
+						spec, err := runcAdapter.BuildSpec(logger, bpmCfg, procCfg, user)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(*spec.Linux.Resources.Memory.Kernel).To(Equal(int64(256 * bytefmt.MEGABYTE)))
+					})
+
+					It("keeps the kernel memory limit alongside a memory limit", func() {
+						memoryLimit := "1G"
+						procCfg.Limits.Memory = &memoryLimit
+
+						spec, err := runcAdapter.BuildSpec(logger, bpmCfg, procCfg, user)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(*spec.Linux.Resources.Memory.Kernel).To(Equal(int64(256 * bytefmt.MEGABYTE)))
+						Expect(*spec.Linux.Resources.Memory.Limit).To(Equal(int64(bytefmt.GIGABYTE)))
+					})
+				})
+
+				Context("when kernel memory is only charged to the memory limit", func() {
+					BeforeEach(func() {
+						features.KernelMemoryLimitSupported = false
+					})
+
+					It("does not limit it separately", func() {
+						spec, err := runcAdapter.BuildSpec(logger, bpmCfg, procCfg, user)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(spec.Linux.Resources.Memory).To(BeNil())
+						Expect(logger.LogMessages()).To(ContainElement("adapter.kernel-memory-limit-unsupported"))
+					})
+				})
+			})
+
+			Context("Swappiness", func() {
+				BeforeEach(func() {
+					swappiness := uint64(0)
+					procCfg.Limits.Swappiness = &swappiness
+				})
+
+				Context("when each cgroup has its own swappiness", func() {
+					BeforeEach(func() {
+						features.SwappinessSupported = true
+					})
+
+					It("sets the swappiness of the container", func() {
+						spec, err := runcAdapter.BuildSpec(logger, bpmCfg, procCfg, user)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(*spec.Linux.Resources.Memory.Swappiness).To(Equal(uint64(0)))
+					})
+				})
+
+				Context("when only the host has a swappiness", func() {
+					BeforeEach(func() {
+						features.SwappinessSupported = false
+					})
+
+					It("logs that it cannot be set", func() {
+						spec, err := runcAdapter.BuildSpec(logger, bpmCfg, procCfg, user)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(spec.Linux.Resources.Memory).To(BeNil())
+						Expect(logger.LogMessages()).To(ContainElement("adapter.swappiness-unsupported"))
+					})
+				})
+			})
+
+			Context("IOWeight", func() {
+				BeforeEach(func() {
+					weight := uint16(250)
+					procCfg.Limits.IOWeight = &weight
+				})
+
+				Context("when block I/O can be shared out by weight", func() {
+					BeforeEach(func() {
+						features.IOWeightSupported = true
+					})
+
+					It("sets the block I/O weight of the container", func() {
+						spec, err := runcAdapter.BuildSpec(logger, bpmCfg, procCfg, user)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(*spec.Linux.Resources.BlockIO.Weight).To(Equal(uint16(250)))
+					})
+				})
+
+				Context("when the host cannot weight block I/O", func() {
+					BeforeEach(func() {
+						features.IOWeightSupported = false
+					})
+
+					It("logs that it cannot be set", func() {
+						spec, err := runcAdapter.BuildSpec(logger, bpmCfg, procCfg, user)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(spec.Linux.Resources.BlockIO).To(BeNil())
+						Expect(logger.LogMessages()).To(ContainElement("adapter.io-weight-unsupported"))
+					})
+				})
+			})
+
+			Context("CPUs", func() {
+				BeforeEach(func() {
+					features.CPUCount = 8
+				})
+
+				DescribeTable("limits the CPU time of the process relative to the host's CPUs",
+					func(cpus string, expectedQuota int64) {
+						procCfg.Limits.CPUs = &cpus
+
+						spec, err := runcAdapter.BuildSpec(logger, bpmCfg, procCfg, user)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(*spec.Linux.Resources.CPU.Quota).To(Equal(expectedQuota))
+						Expect(*spec.Linux.Resources.CPU.Period).To(Equal(uint64(CPUPeriod)))
+					},
+					Entry("a number of CPUs", "1.5", int64(150000)),
+					Entry("a percentage of the host's CPUs", "50%", int64(400000)),
+					Entry("all but some of the host's CPUs", "all-but:1", int64(700000)),
+				)
+
+				It("returns an error when the limit leaves no CPUs", func() {
+					cpus := "all-but:8"
+					procCfg.Limits.CPUs = &cpus
+
+					_, err := runcAdapter.BuildSpec(logger, bpmCfg, procCfg, user)
+					Expect(err).To(MatchError(ContainSubstring("leaves no CPUs")))
+				})
+
+				It("computes the quota against the period in the limits", func() {
+					cpus := "1.5"
+					period := uint64(20000)
+					procCfg.Limits.CPUs = &cpus
+					procCfg.Limits.CPUPeriod = &period
+
+					spec, err := runcAdapter.BuildSpec(logger, bpmCfg, procCfg, user)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(*spec.Linux.Resources.CPU.Quota).To(Equal(int64(30000)))
+					Expect(*spec.Linux.Resources.CPU.Period).To(Equal(uint64(20000)))
+				})
+
+				It("sets the CPU shares of the process", func() {
+					shares := uint64(512)
+					procCfg.Limits.CPUShares = &shares
 
-			It("sets no limits by default", func() {
-				_, err := runcAdapter.BuildSpec(logger, bpmCfg, procCfg, user)
-				Expect(err).NotTo(HaveOccurred())
+					spec, err := runcAdapter.BuildSpec(logger, bpmCfg, procCfg, user)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(*spec.Linux.Resources.CPU.Shares).To(Equal(uint64(512)))
+					Expect(spec.Linux.Resources.CPU.Quota).To(BeNil())
+				})
 			})
 
-			Context("Memory", func() {
-				var expectedMemoryLimit string
-
+			Context("when the host is missing cgroup controllers", func() {
 				BeforeEach(func() {
-					expectedMemoryLimit = "100G"
-					procCfg.Limits.Memory = &expectedMemoryLimit
+					memory := "1G"
+					swap := "2G"
+					shares := uint64(512)
+					processes := int64(100)
+					cpuset := "0"
+					procCfg.Limits.Memory = &memory
+					procCfg.Limits.Swap = &swap
+					procCfg.Limits.CPUShares = &shares
+					procCfg.Limits.Processes = &processes
+					procCfg.Limits.CPUSet = &cpuset
+					features.CPUCount = 8
+					features.MissingControllers = []string{"memory", "pids"}
 				})
 
-				Context("when the system supports swap", func() {
+				It("skips the limits which they enforce", func() {
+					spec, err := runcAdapter.BuildSpec(logger, bpmCfg, procCfg, user)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(spec.Linux.Resources.Memory).To(BeNil())
+					Expect(spec.Linux.Resources.Pids).To(BeNil())
+					Expect(logger.LogMessages()).To(ContainElement("adapter.cgroup-controller-missing"))
+				})
+
+				It("keeps the limits of the controllers which it has", func() {
+					spec, err := runcAdapter.BuildSpec(logger, bpmCfg, procCfg, user)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(*spec.Linux.Resources.CPU.Shares).To(Equal(uint64(512)))
+					Expect(spec.Linux.Resources.CPU.Cpus).To(Equal("0"))
+				})
+
+				Context("when the cpu and cpuset controllers are missing too", func() {
 					BeforeEach(func() {
-						features.SwapLimitSupported = true
+						features.MissingControllers = append(features.MissingControllers, "cpu", "cpuset")
 					})
 
-					It("sets the memory limit on the container", func() {
+					It("skips all of the CPU limits", func() {
 						spec, err := runcAdapter.BuildSpec(logger, bpmCfg, procCfg, user)
 						Expect(err).NotTo(HaveOccurred())
+						Expect(spec.Linux.Resources.CPU).To(BeNil())
+					})
+				})
+			})
 
-						expectedMemoryLimitInBytes, err := bytefmt.ToBytes(expectedMemoryLimit)
-						Expect(err).NotTo(HaveOccurred())
-						signedExpectedMemoryLimitInBytes := int64(expectedMemoryLimitInBytes)
-						Expect(spec.Linux.Resources.Memory).To(Equal(&specs.LinuxMemory{
-							Limit: &signedExpectedMemoryLimitInBytes,
-							Swap:  &signedExpectedMemoryLimitInBytes,
-						}))
+			Context("Hugepages", func() {
+				var originalHugepagesDir string
+
+				BeforeEach(func() {
+					originalHugepagesDir = hugepagesDir
+					hugepagesDir = filepath.Join(systemRoot, "hugepages")
+					Expect(os.MkdirAll(filepath.Join(hugepagesDir, "hugepages-2048kB"), 0755)).To(Succeed())
+					Expect(os.MkdirAll(filepath.Join(hugepagesDir, "hugepages-1048576kB"), 0755)).To(Succeed())
+
+					procCfg.Limits.Hugepages = map[string]string{"1G": "2G", "2M": "512M"}
+				})
+
+				AfterEach(func() {
+					hugepagesDir = originalHugepagesDir
+				})
+
+				It("limits each size of huge page named as the kernel names it", func() {
+					spec, err := runcAdapter.BuildSpec(logger, bpmCfg, procCfg, user)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(spec.Linux.Resources.HugepageLimits).To(Equal([]specs.LinuxHugepageLimit{
+						{Pagesize: "2MB", Limit: 512 * bytefmt.MEGABYTE},
+						{Pagesize: "1GB", Limit: 2 * bytefmt.GIGABYTE},
+					}))
+				})
+
+				Context("when the host does not support a page size", func() {
+					BeforeEach(func() {
+						procCfg.Limits.Hugepages = map[string]string{"16M": "64M"}
+					})
+
+					It("returns an error", func() {
+						_, err := runcAdapter.BuildSpec(logger, bpmCfg, procCfg, user)
+						Expect(err).To(MatchError("invalid hugepages: this host does not support 16MB pages"))
 					})
 				})
+			})
 
-				Context("when the system does not support swap", func() {
+			Context("Blkio", func() {
+				var (
+					originalSysBlockDir string
+					major, minor        int64
+				)
+
+				BeforeEach(func() {
+					var stat unix.Stat_t
+					Expect(unix.Stat(systemRoot, &stat)).To(Succeed())
+					major, minor = int64(unix.Major(stat.Dev)), int64(unix.Minor(stat.Dev))
+
+					originalSysBlockDir = sysBlockDir
+					sysBlockDir = filepath.Join(systemRoot, "block")
+					Expect(os.MkdirAll(sysBlockDir, 0755)).To(Succeed())
+
+					procCfg.Limits.Blkio = []config.BlkioLimit{{
+						Device:    systemRoot,
+						ReadBPS:   "50M",
+						WriteIOPS: 500,
+					}}
+				})
+
+				AfterEach(func() {
+					sysBlockDir = originalSysBlockDir
+				})
+
+				It("throttles the device which holds the path", func() {
+					spec, err := runcAdapter.BuildSpec(logger, bpmCfg, procCfg, user)
+					Expect(err).NotTo(HaveOccurred())
+
+					blockIO := spec.Linux.Resources.BlockIO
+					Expect(blockIO.ThrottleReadBpsDevice).To(HaveLen(1))
+					Expect(blockIO.ThrottleReadBpsDevice[0].Major).To(Equal(major))
+					Expect(blockIO.ThrottleReadBpsDevice[0].Minor).To(Equal(minor))
+					Expect(blockIO.ThrottleReadBpsDevice[0].Rate).To(Equal(uint64(50 * bytefmt.MEGABYTE)))
+					Expect(blockIO.ThrottleWriteIOPSDevice).To(HaveLen(1))
+					Expect(blockIO.ThrottleWriteIOPSDevice[0].Rate).To(Equal(uint64(500)))
+					Expect(blockIO.ThrottleWriteBpsDevice).To(BeEmpty())
+					Expect(blockIO.ThrottleReadIOPSDevice).To(BeEmpty())
+				})
+
+				Context("when the path is on a partition", func() {
 					BeforeEach(func() {
-						features.SwapLimitSupported = false
+						disk := filepath.Join(sysBlockDir, "disk")
+						partition := filepath.Join(disk, "part1")
+						Expect(os.MkdirAll(partition, 0755)).To(Succeed())
+						Expect(ioutil.WriteFile(filepath.Join(disk, "dev"), []byte("259:0\n"), 0644)).To(Succeed())
+						Expect(ioutil.WriteFile(filepath.Join(partition, "partition"), []byte("1\n"), 0644)).To(Succeed())
+						Expect(os.Symlink(partition, filepath.Join(sysBlockDir, fmt.Sprintf("%d:%d", major, minor)))).To(Succeed())
 					})
 
-					It("sets the memory (but not swap) limit on the container", func() {
+					It("throttles the disk which the partition is on", func() {
 						spec, err := runcAdapter.BuildSpec(logger, bpmCfg, procCfg, user)
 						Expect(err).NotTo(HaveOccurred())
 
-						expectedMemoryLimitInBytes, err := bytefmt.ToBytes(expectedMemoryLimit)
-						Expect(err).NotTo(HaveOccurred())
-						signedExpectedMemoryLimitInBytes := int64(expectedMemoryLimitInBytes)
-						Expect(spec.Linux.Resources.Memory).To(Equal(&specs.LinuxMemory{
-							Limit: &signedExpectedMemoryLimitInBytes,
-						}))
+						device := spec.Linux.Resources.BlockIO.ThrottleReadBpsDevice[0]
+						Expect(device.Major).To(Equal(int64(259)))
+						Expect(device.Minor).To(Equal(int64(0)))
 					})
 				})
 
-				Context("when the memory limit is invalid", func() {
-					BeforeEach(func() {
-						memoryLimit := "invalid byte value"
-						procCfg.Limits.Memory = &memoryLimit
-					})
+				It("returns an error when the device does not exist", func() {
+					procCfg.Limits.Blkio[0].Device = filepath.Join(systemRoot, "missing")
 
-					It("returns an error", func() {
-						_, err := runcAdapter.BuildSpec(logger, bpmCfg, procCfg, user)
-						Expect(err).To(HaveOccurred())
-					})
+					_, err := runcAdapter.BuildSpec(logger, bpmCfg, procCfg, user)
+					Expect(err).To(MatchError(ContainSubstring("invalid blkio device")))
 				})
 			})
 
@@ -863,6 +2025,295 @@ var _ = Describe("RuncAdapter", func() {
 			})
 		})
 
+		Context("when the process has sockets", func() {
+			BeforeEach(func() {
+				procCfg.Sockets = []config.Socket{
+					{Path: "/var/vcap/sys/run/other-job/api.sock"},
+				}
+			})
+
+			It("bind mounts the socket directory into the container", func() {
+				spec, err := runcAdapter.BuildSpec(logger, bpmCfg, procCfg, user)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(spec.Mounts).To(HaveMount(specs.Mount{
+					Destination: "/var/vcap/sys/run/other-job",
+					Type:        "bind",
+					Source:      filepath.Join(systemRoot, "sys", "run", "other-job"),
+					Options:     []string{"nodev", "nosuid", "noexec", "rbind", "rw"},
+				}))
+			})
+		})
+
+		Context("when the process has labels", func() {
+			BeforeEach(func() {
+				procCfg.Labels = map[string]string{
+					"org.cloudfoundry.deployment": "cf",
+					"org.cloudfoundry.release":    "example-release",
+				}
+			})
+
+			It("records them as annotations on the container", func() {
+				spec, err := runcAdapter.BuildSpec(logger, bpmCfg, procCfg, user)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(spec.Annotations).To(HaveKeyWithValue("org.cloudfoundry.deployment", "cf"))
+				Expect(spec.Annotations).To(HaveKeyWithValue("org.cloudfoundry.release", "example-release"))
+			})
+		})
+
+		Context("when the process captures core dumps", func() {
+			BeforeEach(func() {
+				procCfg.CoreDumps = &config.CoreDumps{MaxSize: "64M", MaxCount: 5}
+				procCfg.Labels = map[string]string{coredump.MaxCountAnnotation: "100"}
+			})
+
+			It("limits the size of cores and records the limits for the core dump handler", func() {
+				spec, err := runcAdapter.BuildSpec(logger, bpmCfg, procCfg, user)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(spec.Process.Rlimits).To(ContainElement(specs.POSIXRlimit{
+					Type: "RLIMIT_CORE",
+					Hard: 64 * 1024 * 1024,
+					Soft: 64 * 1024 * 1024,
+				}))
+				Expect(spec.Annotations).To(HaveKeyWithValue(coredump.MaxSizeAnnotation, "67108864"))
+				Expect(spec.Annotations).To(HaveKeyWithValue(coredump.MaxCountAnnotation, "5"))
+			})
+		})
+
+		Context("when the process sets rlimits", func() {
+			BeforeEach(func() {
+				procCfg.Rlimits = map[string]string{"core": "unlimited"}
+			})
+
+			It("sets the soft and hard limits of the process", func() {
+				spec, err := runcAdapter.BuildSpec(logger, bpmCfg, procCfg, user)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(spec.Process.Rlimits).To(ContainElement(specs.POSIXRlimit{
+					Type: "RLIMIT_CORE",
+					Hard: math.MaxUint64,
+					Soft: math.MaxUint64,
+				}))
+			})
+
+			Context("when it sets sized and counted limits", func() {
+				BeforeEach(func() {
+					procCfg.Rlimits = map[string]string{"memlock": "64M", "msgqueue": "0", "nofile": "65536"}
+				})
+
+				It("sets each of them in bytes or as a number", func() {
+					spec, err := runcAdapter.BuildSpec(logger, bpmCfg, procCfg, user)
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(spec.Process.Rlimits).To(ContainElement(specs.POSIXRlimit{Type: "RLIMIT_MEMLOCK", Hard: 64 * 1024 * 1024, Soft: 64 * 1024 * 1024}))
+					Expect(spec.Process.Rlimits).To(ContainElement(specs.POSIXRlimit{Type: "RLIMIT_MSGQUEUE", Hard: 0, Soft: 0}))
+					Expect(spec.Process.Rlimits).To(ContainElement(specs.POSIXRlimit{Type: "RLIMIT_NOFILE", Hard: 65536, Soft: 65536}))
+				})
+			})
+		})
+
+		Context("when the process asks for realtime scheduling", func() {
+			BeforeEach(func() {
+				procCfg.Realtime = &config.Realtime{Policy: config.RealtimeRR, Priority: 20, Runtime: "250ms"}
+				features.RealtimeGroupsSupported = true
+			})
+
+			It("records the policy for runc to be started with and budgets the container", func() {
+				spec, err := runcAdapter.BuildSpec(logger, bpmCfg, procCfg, user)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(spec.Annotations).To(HaveKeyWithValue(client.RealtimeAnnotation, "rr:20"))
+				Expect(*spec.Linux.Resources.CPU.RealtimeRuntime).To(Equal(int64(250000)))
+				Expect(*spec.Linux.Resources.CPU.RealtimePeriod).To(Equal(uint64(1000000)))
+			})
+
+			Context("when the kernel does not budget realtime time per cgroup", func() {
+				BeforeEach(func() {
+					features.RealtimeGroupsSupported = false
+				})
+
+				It("only records the policy", func() {
+					spec, err := runcAdapter.BuildSpec(logger, bpmCfg, procCfg, user)
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(spec.Annotations).To(HaveKeyWithValue(client.RealtimeAnnotation, "rr:20"))
+					Expect(spec.Linux.Resources.CPU).To(BeNil())
+				})
+			})
+		})
+
+		Context("when the process sets oom_score_adj", func() {
+			BeforeEach(func() {
+				adj := -500
+				procCfg.OOMScoreAdj = &adj
+			})
+
+			It("sets the OOM score adjustment of the process", func() {
+				spec, err := runcAdapter.BuildSpec(logger, bpmCfg, procCfg, user)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(spec.Process.OOMScoreAdj).NotTo(BeNil())
+				Expect(*spec.Process.OOMScoreAdj).To(Equal(-500))
+			})
+		})
+
+		Context("when the process asks for devices", func() {
+			BeforeEach(func() {
+				procCfg.Devices = []config.Device{
+					{Path: "/dev/null"},
+					{Path: "/dev/zero", Permissions: "r"},
+				}
+			})
+
+			It("creates the device nodes and allows the process to use them", func() {
+				spec, err := runcAdapter.BuildSpec(logger, bpmCfg, procCfg, user)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(spec.Linux.Devices).To(HaveLen(2))
+				null := spec.Linux.Devices[0]
+				Expect(null.Path).To(Equal("/dev/null"))
+				Expect(null.Type).To(Equal("c"))
+				Expect(null.Major).To(Equal(int64(1)))
+				Expect(null.Minor).To(Equal(int64(3)))
+				Expect(*null.FileMode).To(Equal(os.FileMode(0666)))
+				Expect(*null.UID).To(Equal(uint32(0)))
+
+				major, null3, zero5 := int64(1), int64(3), int64(5)
+				Expect(spec.Linux.Resources.Devices).To(Equal([]specs.LinuxDeviceCgroup{
+					{Allow: true, Type: "c", Major: &major, Minor: &null3, Access: "rw"},
+					{Allow: true, Type: "c", Major: &major, Minor: &zero5, Access: "r"},
+				}))
+			})
+
+			It("returns an error for a device which does not exist", func() {
+				procCfg.Devices = []config.Device{{Path: "/dev/does-not-exist"}}
+
+				_, err := runcAdapter.BuildSpec(logger, bpmCfg, procCfg, user)
+				Expect(err).To(MatchError(ContainSubstring("invalid device /dev/does-not-exist")))
+			})
+
+			It("returns an error for a path which is not a device", func() {
+				procCfg.Devices = []config.Device{{Path: "/dev/shm"}}
+
+				_, err := runcAdapter.BuildSpec(logger, bpmCfg, procCfg, user)
+				Expect(err).To(MatchError("invalid device /dev/shm: not a character or block device"))
+			})
+		})
+
+		Context("when the process limits its egress rate", func() {
+			BeforeEach(func() {
+				procCfg.Network = &config.Network{EgressRate: "20M"}
+			})
+
+			Context("when packets can be tagged with a class ID", func() {
+				BeforeEach(func() {
+					features.NetClassSupported = true
+				})
+
+				Context("when the container holds a class", func() {
+					BeforeEach(func() {
+						classStore.classes[bpmCfg.ContainerID()] = 0xb90007
+					})
+
+					It("tags the packets of the container with its class ID", func() {
+						spec, err := runcAdapter.BuildSpec(logger, bpmCfg, procCfg, user)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(*spec.Linux.Resources.Network.ClassID).To(Equal(uint32(0xb90007)))
+					})
+				})
+
+				Context("when the container holds no class", func() {
+					It("does not allocate one", func() {
+						spec, err := runcAdapter.BuildSpec(logger, bpmCfg, procCfg, user)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(spec.Linux.Resources.Network).To(Equal(&specs.LinuxNetwork{}))
+						Expect(classStore.classes).To(BeEmpty())
+					})
+				})
+			})
+
+			Context("when the host has no net_cls controller", func() {
+				BeforeEach(func() {
+					features.NetClassSupported = false
+				})
+
+				It("logs that the rate cannot be enforced", func() {
+					spec, err := runcAdapter.BuildSpec(logger, bpmCfg, procCfg, user)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(spec.Linux.Resources.Network).To(BeNil())
+					Expect(logger.LogMessages()).To(ContainElement("adapter.egress-rate-unsupported"))
+				})
+			})
+		})
+
+		Context("when the process sets nice", func() {
+			BeforeEach(func() {
+				nice := 10
+				procCfg.Nice = &nice
+			})
+
+			It("records the niceness for runc to be started with", func() {
+				spec, err := runcAdapter.BuildSpec(logger, bpmCfg, procCfg, user)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(spec.Annotations).To(HaveKeyWithValue(client.NiceAnnotation, "10"))
+			})
+		})
+
+		Context("when the process has OCI hooks", func() {
+			var timeout int
+
+			BeforeEach(func() {
+				timeout = 5
+				procCfg.OCIHooks = &config.OCIHooks{
+					Prestart: []config.OCIHook{{
+						Path:    "/var/vcap/packages/cni/bin/setup",
+						Args:    []string{"--network", "overlay"},
+						Env:     map[string]string{"B": "2", "A": "1"},
+						Timeout: "4500ms",
+					}},
+					Poststop: []config.OCIHook{{Path: "/var/vcap/packages/cni/bin/teardown"}},
+				}
+			})
+
+			It("adds them to the spec", func() {
+				spec, err := runcAdapter.BuildSpec(logger, bpmCfg, procCfg, user)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(spec.Hooks).To(Equal(&specs.Hooks{
+					Prestart: []specs.Hook{{
+						Path:    "/var/vcap/packages/cni/bin/setup",
+						Args:    []string{"/var/vcap/packages/cni/bin/setup", "--network", "overlay"},
+						Env:     []string{"A=1", "B=2"},
+						Timeout: &timeout,
+					}},
+					Poststop: []specs.Hook{{
+						Path: "/var/vcap/packages/cni/bin/teardown",
+						Args: []string{"/var/vcap/packages/cni/bin/teardown"},
+					}},
+				}))
+			})
+		})
+
+		Context("when the user requests the host's hostname", func() {
+			BeforeEach(func() {
+				procCfg.Unsafe = &config.Unsafe{HostUTSNamespace: true}
+			})
+
+			It("shares the host's hostname and machine ID", func() {
+				spec, err := runcAdapter.BuildSpec(logger, bpmCfg, procCfg, user)
+				Expect(err).NotTo(HaveOccurred())
+
+				// The namespace is kept so that the process cannot change
+				// the host's hostname.
+				Expect(spec.Linux.Namespaces).To(ContainElement(specs.LinuxNamespace{Type: "uts"}))
+				Expect(spec.Hostname).To(BeEmpty())
+				for _, m := range spec.Mounts {
+					Expect(m.Destination).NotTo(Equal("/etc/machine-id"))
+				}
+			})
+		})
+
 		Context("when the user requests unrestricted volumes", func() {
 			BeforeEach(func() {
 				procCfg.Unsafe = &config.Unsafe{
@@ -912,7 +2363,7 @@ var _ = Describe("RuncAdapter", func() {
 							return []string{pattern}, nil
 						}
 					}
-					runcAdapter = NewRuncAdapter(features, fakeGlob, mountSharer.MakeShared, volumeLocker)
+					runcAdapter = NewRuncAdapter(features, fakeGlob, mountSharer.MakeShared, volumeLocker, secretStore, classStore)
 				})
 
 				It("adds volumes for whatever the volume matches", func() {
@@ -938,7 +2389,7 @@ var _ = Describe("RuncAdapter", func() {
 						fail := func(path string) ([]string, error) {
 							return nil, errors.New("doomed from the start")
 						}
-						runcAdapter = NewRuncAdapter(features, fail, mountSharer.MakeShared, volumeLocker)
+						runcAdapter = NewRuncAdapter(features, fail, mountSharer.MakeShared, volumeLocker, secretStore, classStore)
 					})
 
 					It("returns an error", func() {
@@ -1034,3 +2485,37 @@ func (ms *fakeMountSharer) MakeShared(path string) error {
 	ms.sharedMounts = append(ms.sharedMounts, path)
 	return nil
 }
+
+type fakeClassStore struct {
+	classes map[string]uint32
+	err     error
+}
+
+func (s *fakeClassStore) Allocate(containerID string) (uint32, error) {
+	if s.err != nil {
+		return 0, s.err
+	}
+	if id, ok := s.classes[containerID]; ok {
+		return id, nil
+	}
+	id := uint32(0xb90000 + len(s.classes) + 1)
+	s.classes[containerID] = id
+	return id, nil
+}
+
+func (s *fakeClassStore) Lookup(containerID string) (uint32, bool, error) {
+	id, ok := s.classes[containerID]
+	return id, ok, nil
+}
+
+type fakeSecretStore struct {
+	secrets map[string]string
+}
+
+func (s *fakeSecretStore) Get(name string) (string, error) {
+	value, ok := s.secrets[name]
+	if !ok {
+		return "", errors.New("secret not found")
+	}
+	return value, nil
+}
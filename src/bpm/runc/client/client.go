@@ -16,16 +16,27 @@
 package client
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"regexp"
+	"strconv"
+	"strings"
 	"syscall"
 
 	specs "github.com/opencontainers/runtime-spec/specs-go"
+
+	"bpm/cgroups"
+	"bpm/jobid"
+	"bpm/models"
+	"bpm/reaper"
 )
 
 type Signal int
@@ -33,6 +44,11 @@ type Signal int
 const (
 	Term Signal = iota
 	Quit
+	Hup
+	Int
+	Usr1
+	Usr2
+	Kill
 )
 
 func (s Signal) String() string {
@@ -41,11 +57,35 @@ func (s Signal) String() string {
 		return "TERM"
 	case Quit:
 		return "QUIT"
+	case Hup:
+		return "HUP"
+	case Int:
+		return "INT"
+	case Usr1:
+		return "USR1"
+	case Usr2:
+		return "USR2"
+	case Kill:
+		return "KILL"
 	default:
 		return "unknown"
 	}
 }
 
+// ParseSignal converts a signal name (with or without the SIG prefix) into a
+// Signal.
+func ParseSignal(name string) (Signal, error) {
+	name = strings.TrimPrefix(strings.ToUpper(name), "SIG")
+
+	for _, s := range []Signal{Term, Quit, Hup, Int, Usr1, Usr2, Kill} {
+		if s.String() == name {
+			return s, nil
+		}
+	}
+
+	return 0, fmt.Errorf("unsupported signal: %q", name)
+}
+
 // https://github.com/opencontainers/runc/blob/master/list.go#L24-L45
 type ContainerState struct {
 	// ID is the container ID
@@ -54,13 +94,22 @@ type ContainerState struct {
 	InitProcessPid int `json:"pid"`
 	// Status is the current status of the container, running, paused, ...
 	Status string `json:"status"`
+	// Annotations is the user defined annotations added to the config.
+	Annotations map[string]string `json:"annotations,omitempty"`
 }
 
 type RuncClient struct {
 	runcPath string
 	runcRoot string
 
+	// jobRoots is the directory which holds a runc root for each job. It
+	// is empty if every container is kept in runcRoot.
+	jobRoots string
+	perJob   bool
+
 	inSystemd bool
+
+	reaperPath string
 }
 
 func NewRuncClient(runcPath, runcRoot string, inSystemd bool) *RuncClient {
@@ -71,6 +120,80 @@ func NewRuncClient(runcPath, runcRoot string, inSystemd bool) *RuncClient {
 	}
 }
 
+// UseReaper makes RunContainer start detached containers through `bpm reap`
+// using the bpm executable at path so that the exit status of their
+// processes is recorded (see reaper.ExitFile).
+func (c *RuncClient) UseReaper(path string) {
+	c.reaperPath = path
+}
+
+// UseJobRoots finds containers in a runc root of their own job beneath dir
+// as well as in the shared root. If perJob is set then new containers are
+// created in their job's root, so that a corrupted state file only affects
+// the containers of one job. Existing containers keep being found in the root
+// which they were created in either way.
+func (c *RuncClient) UseJobRoots(dir string, perJob bool) {
+	c.jobRoots = dir
+	c.perJob = perJob
+}
+
+// jobRoot returns the runc root beneath dir of the job which a container
+// belongs to. Container IDs start with the encoded job name, which is
+// followed by the encoded separator and the process name if it differs from
+// the job's.
+func jobRoot(dir, containerID string) string {
+	separator := strings.TrimPrefix(jobid.Encode("."), "bpm-")
+	return filepath.Join(dir, strings.SplitN(containerID, separator, 2)[0])
+}
+
+// rootFor returns the runc root which the container is, or would be created,
+// in.
+func (c *RuncClient) rootFor(containerID string) string {
+	if c.jobRoots == "" {
+		return c.runcRoot
+	}
+
+	jobRoot := jobRoot(c.jobRoots, containerID)
+	switch {
+	case exists(filepath.Join(c.runcRoot, containerID)):
+		return c.runcRoot
+	case exists(filepath.Join(jobRoot, containerID)):
+		return jobRoot
+	case c.perJob:
+		return jobRoot
+	default:
+		return c.runcRoot
+	}
+}
+
+// roots returns the shared runc root and the runc root of every job.
+func (c *RuncClient) roots() ([]string, error) {
+	roots := []string{c.runcRoot}
+	if c.jobRoots == "" {
+		return roots, nil
+	}
+
+	infos, err := ioutil.ReadDir(c.jobRoots)
+	if os.IsNotExist(err) {
+		return roots, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	for _, info := range infos {
+		if info.IsDir() {
+			roots = append(roots, filepath.Join(c.jobRoots, info.Name()))
+		}
+	}
+
+	return roots, nil
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
 func (*RuncClient) CreateBundle(
 	bundlePath string,
 	jobSpec specs.Spec,
@@ -87,7 +210,7 @@ func (*RuncClient) CreateBundle(
 		return err
 	}
 
-	f, err := os.OpenFile(filepath.Join(bundlePath, "config.json"), os.O_RDWR|os.O_CREATE, 0600)
+	f, err := os.OpenFile(filepath.Join(bundlePath, "config.json"), os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
 	if err != nil {
 		// This is super hard to test as we are root.
 		return err
@@ -99,8 +222,18 @@ func (*RuncClient) CreateBundle(
 	return enc.Encode(&jobSpec)
 }
 
-func (c *RuncClient) RunContainer(pidFilePath, bundlePath, containerID string, detach bool, stdout, stderr io.Writer) (int, error) {
+func (c *RuncClient) RunContainer(ctx context.Context, pidFilePath, bundlePath, containerID string, detach bool, stdout, stderr io.Writer) (int, error) {
+	logFile, err := ioutil.TempFile("", "bpm-runc-log")
+	if err != nil {
+		return 1, err
+	}
+	logFile.Close()
+	defer os.Remove(logFile.Name())
+
 	args := []string{
+		logFile.Name(),
+		"--log-format", "json",
+		"run",
 		"--bundle", bundlePath,
 	}
 	if detach {
@@ -109,11 +242,31 @@ func (c *RuncClient) RunContainer(pidFilePath, bundlePath, containerID string, d
 	}
 	args = append(args, containerID)
 
-	runcCmd := c.buildCmd("run", args...)
+	root := c.rootFor(containerID)
+	if err := os.MkdirAll(root, 0700); err != nil {
+		return 1, err
+	}
+
+	runcCmd := c.buildCmd(ctx, root, "--log", args...)
 	runcCmd.Stdout = stdout
 	runcCmd.Stderr = stderr
 
-	if err := runcCmd.Run(); err != nil {
+	start := (*exec.Cmd).Start
+	if sched, ok := c.bundleScheduling(bundlePath); ok {
+		start = func(cmd *exec.Cmd) error { return startScheduled(cmd, sched) }
+	}
+
+	if detach && c.reaperPath != "" && isFile(stdout) && isFile(stderr) {
+		return c.runReaped(ctx, runcCmd, start, pidFilePath, logFile.Name())
+	}
+
+	err = start(runcCmd)
+	if err == nil {
+		err = runcCmd.Wait()
+	}
+	if err != nil {
+		err = runError(err, logFile.Name())
+
 		if status, ok := runcCmd.ProcessState.Sys().(syscall.WaitStatus); ok {
 			return status.ExitStatus(), err
 		}
@@ -126,15 +279,214 @@ func (c *RuncClient) RunContainer(pidFilePath, bundlePath, containerID string, d
 	return 0, nil
 }
 
-// Exec assumes you are launching an interactive shell.
-// We should improve the interface to mirror `runc exec` more generally.
-func (c *RuncClient) Exec(containerID, command string, stdin io.Reader, stdout, stderr io.Writer) error {
+// runReaped runs runcCmd as a child of `bpm reap`, which is started with
+// start. The reaper outlives us so, rather than waiting for it to exit, we
+// wait for it to report the exit status of runc.
+func (c *RuncClient) runReaped(ctx context.Context, runcCmd *exec.Cmd, start func(*exec.Cmd) error, pidFilePath, logPath string) (int, error) {
+	ready, readyW, err := os.Pipe()
+	if err != nil {
+		return 1, err
+	}
+	defer ready.Close()
+
+	args := []string{
+		"reap",
+		"--pid-file", pidFilePath,
+		"--exit-file", reaper.ExitFile(pidFilePath),
+		"--",
+	}
+	reaperCmd := exec.Command(c.reaperPath, append(args, runcCmd.Args...)...)
+	reaperCmd.Stdout = runcCmd.Stdout
+	reaperCmd.Stderr = runcCmd.Stderr
+	reaperCmd.ExtraFiles = []*os.File{readyW}
+	// The reaper must survive bpm being interrupted once the container has
+	// started.
+	reaperCmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+
+	err = start(reaperCmd)
+	readyW.Close()
+	if err != nil {
+		return 1, err
+	}
+
+	reported := make(chan []byte, 1)
+	go func() {
+		data, _ := ioutil.ReadAll(ready)
+		reported <- data
+	}()
+
+	var data []byte
+	select {
+	case data = <-reported:
+	case <-ctx.Done():
+		// runc is in the reaper's process group and needs to be stopped
+		// as well.
+		syscall.Kill(-reaperCmd.Process.Pid, syscall.SIGKILL)
+		reaperCmd.Wait()
+		return 1, runError(ctx.Err(), logPath)
+	}
+
+	status, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		// The reaper exited without telling us what happened to runc.
+		reaperCmd.Wait()
+		return 1, runError(errors.New("reaper failed before runc exited"), logPath)
+	}
+
+	if status != 0 {
+		reaperCmd.Wait()
+		return status, runError(fmt.Errorf("exit status %d", status), logPath)
+	}
+
+	return 0, reaperCmd.Process.Release()
+}
+
+func isFile(w io.Writer) bool {
+	_, ok := w.(*os.File)
+	return ok
+}
+
+// RunError is returned when runc fails to run a container. It includes the
+// error which runc logged (if any) so that callers can tell why it failed.
+type RunError struct {
+	Err     error
+	Message string
+
+	// Log is everything which runc logged while it tried to run the
+	// container, one entry per line. It includes the errors from runc's
+	// init process which happen before the process is executed and which
+	// would otherwise not be written anywhere.
+	Log string
+}
+
+func runError(err error, logPath string) *RunError {
+	return &RunError{
+		Err:     err,
+		Message: lastLoggedError(logPath),
+		Log:     loggedEntries(logPath),
+	}
+}
+
+func (e *RunError) Error() string {
+	if e.Message == "" {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("%s: %s", e.Err.Error(), e.Message)
+}
+
+// transientRunErrors are fragments of runc error messages caused by
+// conditions which usually clear up by themselves, such as the kernel not
+// yet having released a cgroup from a previous container or a race with
+// systemd while it creates the scope for the container.
+var transientRunErrors = []string{
+	"device or resource busy",
+	"resource temporarily unavailable",
+	"interrupted system call",
+	".scope already exists",
+}
+
+// IsTransient returns true if the error was returned by RunContainer and is
+// likely to go away if the container is run again.
+func IsTransient(err error) bool {
+	var runErr *RunError
+	if !errors.As(err, &runErr) {
+		return false
+	}
+
+	for _, fragment := range transientRunErrors {
+		if strings.Contains(runErr.Message, fragment) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// lastLoggedError returns the message of the last error in a runc JSON log
+// file or the empty string if there isn't one.
+func lastLoggedError(logPath string) string {
+	data, err := ioutil.ReadFile(logPath)
+	if err != nil {
+		return ""
+	}
+
+	var msg string
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		var entry struct {
+			Level string `json:"level"`
+			Msg   string `json:"msg"`
+		}
+		if err := json.Unmarshal(line, &entry); err != nil {
+			continue
+		}
+
+		if entry.Level == "error" || entry.Level == "fatal" {
+			msg = entry.Msg
+		}
+	}
+
+	return msg
+}
+
+// loggedEntries formats every entry in runc's JSON log as a line of text.
+// Lines which are not JSON are kept as they are.
+func loggedEntries(logPath string) string {
+	data, err := ioutil.ReadFile(logPath)
+	if err != nil {
+		return ""
+	}
+
+	var buf strings.Builder
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		var entry struct {
+			Level string `json:"level"`
+			Msg   string `json:"msg"`
+			Time  string `json:"time"`
+		}
+		if err := json.Unmarshal(line, &entry); err != nil {
+			buf.Write(line)
+			buf.WriteString("\n")
+			continue
+		}
+
+		if entry.Time != "" {
+			fmt.Fprintf(&buf, "%s ", entry.Time)
+		}
+		fmt.Fprintf(&buf, "%s: %s\n", entry.Level, entry.Msg)
+	}
+
+	return buf.String()
+}
+
+// Exec runs a new process inside an existing container. The full process
+// description is handed to runc so that the caller is in control of the
+// environment, working directory, and user of the new process rather than
+// having them merged with the values from the container's configuration.
+func (c *RuncClient) Exec(ctx context.Context, containerID string, process specs.Process, stdin io.Reader, stdout, stderr io.Writer) error {
+	f, err := ioutil.TempFile("", "bpm-exec-process")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	err = json.NewEncoder(f).Encode(&process)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+
 	runcCmd := c.buildCmd(
+		ctx,
+		c.rootFor(containerID),
 		"exec",
-		"--tty",
-		"--env", fmt.Sprintf("TERM=%s", os.Getenv("TERM")),
+		"--process", f.Name(),
 		containerID,
-		command,
 	)
 
 	runcCmd.Stdin = stdin
@@ -144,13 +496,32 @@ func (c *RuncClient) Exec(containerID, command string, stdin io.Reader, stdout,
 	return runcCmd.Run()
 }
 
+// BundleSpec reads back the runtime specification which was written into a
+// bundle by CreateBundle.
+func (*RuncClient) BundleSpec(bundlePath string) (*specs.Spec, error) {
+	f, err := os.Open(filepath.Join(bundlePath, "config.json"))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var spec specs.Spec
+	if err := json.NewDecoder(f).Decode(&spec); err != nil {
+		return nil, err
+	}
+
+	return &spec, nil
+}
+
 // ContainerState returns the following:
 // - state, nil if the job is running,and no errors were encountered.
 // - nil,nil if the container state is not running and no other errors were encountered
 // - nil,error if there is any other error getting the container state
 //   (e.g. the container is running but in an unreachable state)
-func (c *RuncClient) ContainerState(containerID string) (*specs.State, error) {
+func (c *RuncClient) ContainerState(ctx context.Context, containerID string) (*specs.State, error) {
 	runcCmd := c.buildCmd(
+		ctx,
+		c.rootFor(containerID),
 		"--log-format",
 		"json",
 		"state",
@@ -186,28 +557,96 @@ func decodeContainerStateErr(b []byte, err error) error {
 	return err
 }
 
-func (c *RuncClient) ListContainers() ([]ContainerState, error) {
+// OOMKillCount returns the number of processes in the container which have
+// been killed by the OOM killer. It uses the cgroup paths which runc records
+// in its private state for the container as runc does not expose them.
+func (c *RuncClient) OOMKillCount(containerID string) (uint64, error) {
+	paths, err := c.cgroupPaths(containerID)
+	if err != nil {
+		return 0, err
+	}
+
+	return cgroups.OOMKillCount(paths)
+}
+
+// CgroupLimits returns the limits which the kernel enforces on the cgroup of
+// the container.
+func (c *RuncClient) CgroupLimits(containerID string) (*models.CgroupLimits, error) {
+	paths, err := c.cgroupPaths(containerID)
+	if err != nil {
+		return nil, err
+	}
+
+	return cgroups.ReadLimits(paths)
+}
+
+// cgroupPaths returns the cgroup paths which runc recorded in its private
+// state for the container, keyed by subsystem.
+func (c *RuncClient) cgroupPaths(containerID string) (map[string]string, error) {
+	data, err := ioutil.ReadFile(filepath.Join(c.rootFor(containerID), containerID, "state.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	var state struct {
+		CgroupPaths map[string]string `json:"cgroup_paths"`
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+
+	return state.CgroupPaths, nil
+}
+
+// ListContainers returns the containers in the shared runc root and in the
+// root of every job.
+func (c *RuncClient) ListContainers(ctx context.Context) ([]ContainerState, error) {
+	roots, err := c.roots()
+	if err != nil {
+		return []ContainerState{}, err
+	}
+
+	var containerStates []ContainerState
+	for _, root := range roots {
+		states, err := c.listRoot(ctx, root)
+		if err != nil {
+			if root != c.runcRoot {
+				err = fmt.Errorf("failed to list the containers in %s: %s", root, err)
+			}
+			return []ContainerState{}, err
+		}
+
+		containerStates = append(containerStates, states...)
+	}
+
+	return containerStates, nil
+}
+
+func (c *RuncClient) listRoot(ctx context.Context, root string) ([]ContainerState, error) {
 	runcCmd := c.buildCmd(
+		ctx,
+		root,
 		"list",
 		"--format", "json",
 	)
 
 	data, err := runcCmd.Output()
 	if err != nil {
-		return []ContainerState{}, err
+		return nil, err
 	}
 
 	var containerStates []ContainerState
-	err = json.Unmarshal(data, &containerStates)
-	if err != nil {
-		return []ContainerState{}, err
+	if err := json.Unmarshal(data, &containerStates); err != nil {
+		return nil, err
 	}
 
 	return containerStates, nil
 }
 
-func (c *RuncClient) SignalContainer(containerID string, signal Signal) error {
+func (c *RuncClient) SignalContainer(ctx context.Context, containerID string, signal Signal) error {
 	runcCmd := c.buildCmd(
+		ctx,
+		c.rootFor(containerID),
 		"kill",
 		containerID,
 		signal.String(),
@@ -216,8 +655,52 @@ func (c *RuncClient) SignalContainer(containerID string, signal Signal) error {
 	return runcCmd.Run()
 }
 
-func (c *RuncClient) DeleteContainer(containerID string) error {
+func (c *RuncClient) PauseContainer(ctx context.Context, containerID string) error {
+	runcCmd := c.buildCmd(
+		ctx,
+		c.rootFor(containerID),
+		"pause",
+		containerID,
+	)
+
+	return runcCmd.Run()
+}
+
+func (c *RuncClient) ResumeContainer(ctx context.Context, containerID string) error {
+	runcCmd := c.buildCmd(
+		ctx,
+		c.rootFor(containerID),
+		"resume",
+		containerID,
+	)
+
+	return runcCmd.Run()
+}
+
+// UpdateContainer changes the resource limits of a running container. Only
+// the limits present in resources are changed.
+func (c *RuncClient) UpdateContainer(ctx context.Context, containerID string, resources *specs.LinuxResources) error {
+	data, err := json.Marshal(resources)
+	if err != nil {
+		return err
+	}
+
+	runcCmd := c.buildCmd(
+		ctx,
+		c.rootFor(containerID),
+		"update",
+		"--resources", "-",
+		containerID,
+	)
+	runcCmd.Stdin = bytes.NewReader(data)
+
+	return runcCmd.Run()
+}
+
+func (c *RuncClient) DeleteContainer(ctx context.Context, containerID string) error {
 	runcCmd := c.buildCmd(
+		ctx,
+		c.rootFor(containerID),
 		"delete",
 		"--force",
 		containerID,
@@ -230,12 +713,14 @@ func (*RuncClient) DestroyBundle(bundlePath string) error {
 	return os.RemoveAll(bundlePath)
 }
 
-func (c *RuncClient) buildCmd(command string, extra ...string) *exec.Cmd {
-	args := []string{"--root", c.runcRoot}
+// buildCmd returns a runc command which is killed if ctx is done before it
+// exits.
+func (c *RuncClient) buildCmd(ctx context.Context, root, command string, extra ...string) *exec.Cmd {
+	args := []string{"--root", root}
 	if c.inSystemd {
 		args = append(args, "--systemd-cgroup")
 	}
 	args = append(args, command)
 	args = append(args, extra...)
-	return exec.Command(c.runcPath, args...)
+	return exec.CommandContext(ctx, c.runcPath, args...)
 }
@@ -16,16 +16,22 @@
 package client_test
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"syscall"
+	"time"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	specs "github.com/opencontainers/runtime-spec/specs-go"
 
+	"bpm/models"
 	"bpm/runc/client"
 )
 
@@ -75,6 +81,17 @@ var _ = Describe("RuncClient", func() {
 			Expect(f.Mode() & os.ModePerm).To(Equal(os.FileMode(0700)))
 		})
 
+		It("replaces the spec of an existing bundle", func() {
+			longer := jobSpec
+			longer.Hostname = "a-much-longer-hostname-than-the-spec-which-replaces-it"
+			Expect(runcClient.CreateBundle(bundlePath, longer, user)).To(Succeed())
+			Expect(runcClient.CreateBundle(bundlePath, jobSpec, user)).To(Succeed())
+
+			spec, err := runcClient.BundleSpec(bundlePath)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(*spec).To(Equal(jobSpec))
+		})
+
 		It("makes an empty rootfs directory", func() {
 			err := runcClient.CreateBundle(bundlePath, jobSpec, user)
 			Expect(err).ToNot(HaveOccurred())
@@ -137,6 +154,242 @@ var _ = Describe("RuncClient", func() {
 		})
 	})
 
+	Describe("BundleSpec", func() {
+		var bundlesRoot string
+
+		BeforeEach(func() {
+			jobSpec = specs.Spec{
+				Version: "example-version",
+				Process: &specs.Process{
+					Env: []string{"FOO=BAR"},
+				},
+			}
+
+			var err error
+			bundlesRoot, err = ioutil.TempDir("", "bundle-reader")
+			Expect(err).ToNot(HaveOccurred())
+
+			bundlePath = filepath.Join(bundlesRoot, "bundle")
+		})
+
+		AfterEach(func() {
+			Expect(os.RemoveAll(bundlesRoot)).To(Succeed())
+		})
+
+		It("reads back the spec written by CreateBundle", func() {
+			Expect(runcClient.CreateBundle(bundlePath, jobSpec, user)).To(Succeed())
+
+			spec, err := runcClient.BundleSpec(bundlePath)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(*spec).To(Equal(jobSpec))
+		})
+
+		Context("when the bundle does not exist", func() {
+			It("returns the error", func() {
+				_, err := runcClient.BundleSpec(bundlePath)
+				Expect(err).To(HaveOccurred())
+			})
+		})
+	})
+
+	Describe("OOMKillCount", func() {
+		var runcRoot, cgroupDir string
+
+		BeforeEach(func() {
+			var err error
+			runcRoot, err = ioutil.TempDir("", "runc-root")
+			Expect(err).ToNot(HaveOccurred())
+
+			cgroupDir = filepath.Join(runcRoot, "cgroup")
+			Expect(os.MkdirAll(cgroupDir, 0755)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(cgroupDir, "memory.oom_control"), []byte("under_oom 0\noom_kill 1\n"), 0644)).To(Succeed())
+
+			Expect(os.MkdirAll(filepath.Join(runcRoot, "example"), 0700)).To(Succeed())
+			state := fmt.Sprintf(`{"id": "example", "cgroup_paths": {"memory": %q}}`, cgroupDir)
+			Expect(ioutil.WriteFile(filepath.Join(runcRoot, "example", "state.json"), []byte(state), 0600)).To(Succeed())
+
+			runcClient = client.NewRuncClient("/var/vcap/packages/runc/bin/runc", runcRoot, false)
+		})
+
+		AfterEach(func() {
+			Expect(os.RemoveAll(runcRoot)).To(Succeed())
+		})
+
+		It("reads the counter from the container's memory cgroup", func() {
+			count, err := runcClient.OOMKillCount("example")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(count).To(Equal(uint64(1)))
+		})
+
+		Context("when the container does not exist", func() {
+			It("returns an error", func() {
+				_, err := runcClient.OOMKillCount("missing")
+				Expect(err).To(HaveOccurred())
+			})
+		})
+	})
+
+	Describe("Stats and Events", func() {
+		var (
+			runcRoot     string
+			cgroupDir    string
+			fakeRuncPath string
+		)
+
+		writeFakeRunc := func(script string) {
+			Expect(ioutil.WriteFile(fakeRuncPath, []byte("#!/bin/sh\n"+script), 0700)).To(Succeed())
+		}
+
+		BeforeEach(func() {
+			var err error
+			runcRoot, err = ioutil.TempDir("", "runc-root")
+			Expect(err).ToNot(HaveOccurred())
+
+			cgroupDir = filepath.Join(runcRoot, "cgroup")
+			Expect(os.MkdirAll(cgroupDir, 0755)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(cgroupDir, "memory.oom_control"), []byte("under_oom 0\noom_kill 2\n"), 0644)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(cgroupDir, "memory.usage_in_bytes"), []byte("4096\n"), 0644)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(cgroupDir, "memory.limit_in_bytes"), []byte("9223372036854771712\n"), 0644)).To(Succeed())
+
+			Expect(os.MkdirAll(filepath.Join(runcRoot, "example"), 0700)).To(Succeed())
+			state := fmt.Sprintf(`{"id": "example", "cgroup_paths": {"memory": %q}}`, cgroupDir)
+			Expect(ioutil.WriteFile(filepath.Join(runcRoot, "example", "state.json"), []byte(state), 0600)).To(Succeed())
+
+			fakeRuncPath = filepath.Join(runcRoot, "fakeRunc")
+			runcClient = client.NewRuncClient(fakeRuncPath, runcRoot, false)
+		})
+
+		AfterEach(func() {
+			Expect(os.RemoveAll(runcRoot)).To(Succeed())
+		})
+
+		Describe("Stats", func() {
+			It("converts the stats reported by runc", func() {
+				writeFakeRunc(`echo '{"type":"stats","id":"example","data":{"cpu":{"usage":{"total":1500000},"throttling":{"periods":20,"throttledPeriods":4,"throttledTime":250000}},"memory":{"usage":{"usage":1024,"max":2048,"limit":9223372036854771712}},"pids":{"current":3,"limit":100}}}'`)
+
+				stats, err := runcClient.Stats(context.Background(), "example")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(stats).To(Equal(&models.Stats{
+					CPU:    models.CPUStats{UsageNanoseconds: 1500000, Periods: 20, ThrottledPeriods: 4, ThrottledNanoseconds: 250000},
+					Memory: models.MemoryStats{UsageBytes: 1024, MaxUsageBytes: 2048, OOMKills: 2},
+					Pids:   models.PidsStats{Current: 3, Limit: 100},
+				}))
+			})
+
+			Context("when runc cannot report the stats", func() {
+				BeforeEach(func() {
+					writeFakeRunc(`echo "unknown command events" >&2; exit 1`)
+				})
+
+				It("reads them from the container's cgroups", func() {
+					stats, err := runcClient.Stats(context.Background(), "example")
+					Expect(err).NotTo(HaveOccurred())
+					Expect(stats.Memory).To(Equal(models.MemoryStats{UsageBytes: 4096, OOMKills: 2}))
+				})
+
+				It("returns an error if the container does not exist", func() {
+					_, err := runcClient.Stats(context.Background(), "missing")
+					Expect(err).To(MatchError(ContainSubstring("failed to get stats from runc")))
+				})
+			})
+		})
+
+		Describe("Events", func() {
+			It("converts the events reported by runc", func() {
+				writeFakeRunc(`echo '{"type":"oom","id":"example"}'
+echo '{"type":"stats","id":"example","data":{"memory":{"usage":{"usage":1024}}}}'`)
+
+				var events []models.Event
+				err := runcClient.Events(context.Background(), "example", time.Second, func(e models.Event) {
+					events = append(events, e)
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(events).To(HaveLen(2))
+				Expect(events[0].Type).To(Equal(models.EventTypeOOM))
+				Expect(events[0].Stats).To(BeNil())
+				Expect(events[1].Type).To(Equal(models.EventTypeStats))
+				Expect(events[1].Stats.Memory.UsageBytes).To(Equal(uint64(1024)))
+			})
+
+			Context("when the container is in the unified hierarchy", func() {
+				BeforeEach(func() {
+					Expect(ioutil.WriteFile(filepath.Join(cgroupDir, "memory.events"), []byte("oom 0\noom_kill 0\n"), 0644)).To(Succeed())
+					state := fmt.Sprintf(`{"id": "example", "cgroup_paths": {"": %q}}`, cgroupDir)
+					Expect(ioutil.WriteFile(filepath.Join(runcRoot, "example", "state.json"), []byte(state), 0600)).To(Succeed())
+				})
+
+				It("reports an OOM when the count of OOM kills goes up", func() {
+					events := filepath.Join(cgroupDir, "memory.events")
+					writeFakeRunc(fmt.Sprintf(`echo '{"type":"stats","id":"example","data":{}}'
+sleep 0.1
+printf 'oom 1\noom_kill 1\n' > %s
+echo '{"type":"stats","id":"example","data":{}}'`, events))
+
+					var types []string
+					err := runcClient.Events(context.Background(), "example", time.Second, func(e models.Event) {
+						types = append(types, e.Type)
+					})
+					Expect(err).NotTo(HaveOccurred())
+					Expect(types).To(Equal([]string{models.EventTypeStats, models.EventTypeOOM, models.EventTypeStats}))
+				})
+
+				It("does not report an OOM twice when runc reports it", func() {
+					events := filepath.Join(cgroupDir, "memory.events")
+					writeFakeRunc(fmt.Sprintf(`echo '{"type":"stats","id":"example","data":{}}'
+sleep 0.1
+printf 'oom 1\noom_kill 1\n' > %s
+echo '{"type":"oom","id":"example"}'
+echo '{"type":"stats","id":"example","data":{}}'`, events))
+
+					var types []string
+					err := runcClient.Events(context.Background(), "example", time.Second, func(e models.Event) {
+						types = append(types, e.Type)
+					})
+					Expect(err).NotTo(HaveOccurred())
+					Expect(types).To(Equal([]string{models.EventTypeStats, models.EventTypeOOM, models.EventTypeStats}))
+				})
+			})
+
+			Context("when runc cannot report events", func() {
+				BeforeEach(func() {
+					writeFakeRunc(`exit 1`)
+				})
+
+				It("polls the container's cgroups until it is stopped", func() {
+					ctx, cancel := context.WithCancel(context.Background())
+					defer cancel()
+
+					events := make(chan models.Event, 10)
+					done := make(chan error)
+					go func() {
+						done <- runcClient.Events(ctx, "example", 10*time.Millisecond, func(e models.Event) {
+							events <- e
+						})
+					}()
+
+					var first models.Event
+					Eventually(events).Should(Receive(&first))
+					Expect(first.Type).To(Equal(models.EventTypeStats))
+					Expect(first.Stats.Memory.OOMKills).To(Equal(uint64(2)))
+
+					Expect(ioutil.WriteFile(filepath.Join(cgroupDir, "memory.oom_control"), []byte("under_oom 0\noom_kill 3\n"), 0644)).To(Succeed())
+					Eventually(events).Should(Receive(WithTransform(func(e models.Event) string { return e.Type }, Equal(models.EventTypeOOM))))
+
+					cancel()
+					Eventually(done).Should(Receive(BeNil()))
+				})
+
+				It("returns an error once the container's cgroup goes away", func() {
+					Expect(os.RemoveAll(cgroupDir)).To(Succeed())
+
+					err := runcClient.Events(context.Background(), "example", 10*time.Millisecond, func(models.Event) {})
+					Expect(err).To(HaveOccurred())
+				})
+			})
+		})
+	})
+
 	Describe("DestroyBundle", func() {
 		var bundlePath string
 
@@ -205,13 +458,95 @@ exit 0
 			})
 
 			It("ignores the error", func() {
-				containers, err := runcClient.ListContainers()
+				containers, err := runcClient.ListContainers(context.Background())
 				Expect(err).NotTo(HaveOccurred())
 				Expect(containers).To(BeEmpty())
 			})
 		})
 	})
 
+	Context("when jobs have their own runc roots", func() {
+		var (
+			tempDir    string
+			sharedRoot string
+			jobRoots   string
+		)
+
+		BeforeEach(func() {
+			var err error
+			tempDir, err = ioutil.TempDir("", "")
+			Expect(err).NotTo(HaveOccurred())
+
+			sharedRoot = filepath.Join(tempDir, "bpm-runc")
+			jobRoots = filepath.Join(tempDir, "bpm-runc-jobs")
+
+			// The fake reports the root which it was run with as the ID
+			// of the containers which it finds.
+			fakeRuncPath := filepath.Join(tempDir, "fakeRunc")
+			contents := []byte(`#!/bin/sh
+if echo "$@" | grep -q -- " list "; then
+  echo "[{\"id\": \"$2\"}]"
+else
+  echo "{\"id\": \"$2\"}"
+fi
+`)
+			Expect(ioutil.WriteFile(fakeRuncPath, contents, 0700)).To(Succeed())
+
+			runcClient = client.NewRuncClient(fakeRuncPath, sharedRoot, false)
+			runcClient.UseJobRoots(jobRoots, true)
+		})
+
+		AfterEach(func() {
+			Expect(os.RemoveAll(tempDir)).To(Succeed())
+		})
+
+		It("uses the root of the container's job", func() {
+			state, err := runcClient.ContainerState(context.Background(), "bpm-job.2eworker")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(state.ID).To(Equal(filepath.Join(jobRoots, "bpm-job")))
+		})
+
+		It("keeps using the shared root for containers which were created in it", func() {
+			Expect(os.MkdirAll(filepath.Join(sharedRoot, "bpm-job.2eworker"), 0700)).To(Succeed())
+
+			state, err := runcClient.ContainerState(context.Background(), "bpm-job.2eworker")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(state.ID).To(Equal(sharedRoot))
+		})
+
+		It("lists the containers in every root", func() {
+			Expect(os.MkdirAll(filepath.Join(jobRoots, "bpm-a"), 0700)).To(Succeed())
+			Expect(os.MkdirAll(filepath.Join(jobRoots, "bpm-b"), 0700)).To(Succeed())
+
+			containers, err := runcClient.ListContainers(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+
+			var ids []string
+			for _, c := range containers {
+				ids = append(ids, c.ID)
+			}
+			Expect(ids).To(ConsistOf(sharedRoot, filepath.Join(jobRoots, "bpm-a"), filepath.Join(jobRoots, "bpm-b")))
+		})
+
+		Context("when new containers are created in the shared root", func() {
+			BeforeEach(func() {
+				runcClient.UseJobRoots(jobRoots, false)
+			})
+
+			It("still finds containers in their job's root", func() {
+				Expect(os.MkdirAll(filepath.Join(jobRoots, "bpm-job", "bpm-job"), 0700)).To(Succeed())
+
+				state, err := runcClient.ContainerState(context.Background(), "bpm-job")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(state.ID).To(Equal(filepath.Join(jobRoots, "bpm-job")))
+
+				state, err = runcClient.ContainerState(context.Background(), "bpm-other")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(state.ID).To(Equal(sharedRoot))
+			})
+		})
+	})
+
 	Context("when running in systemd", func() {
 		var (
 			tempDir      string
@@ -247,7 +582,7 @@ fi
 		})
 
 		It("passes the --systemd-cgroup flag to runc", func() {
-			_, err := runcClient.ContainerState("foo")
+			_, err := runcClient.ContainerState(context.Background(), "foo")
 			Expect(err).NotTo(HaveOccurred())
 		})
 	})
@@ -285,7 +620,7 @@ exit 1
 			})
 
 			It("returns nil,nil", func() {
-				state, err := runcClient.ContainerState("foo")
+				state, err := runcClient.ContainerState(context.Background(), "foo")
 				Expect(err).NotTo(HaveOccurred())
 
 				Expect(state).To(BeNil())
@@ -304,7 +639,7 @@ exit 1
 				})
 
 				It("strips spaces from the error message", func() {
-					state, err := runcClient.ContainerState("foo")
+					state, err := runcClient.ContainerState(context.Background(), "foo")
 					Expect(err).NotTo(HaveOccurred())
 
 					Expect(state).To(BeNil())
@@ -324,11 +659,235 @@ exit 1
 			})
 
 			It("returns nil,nil", func() {
-				state, err := runcClient.ContainerState("foo")
+				state, err := runcClient.ContainerState(context.Background(), "foo")
 				Expect(err).To(HaveOccurred())
 
 				Expect(state).To(BeNil())
 			})
 		})
 	})
+
+	Describe("RunContainer", func() {
+		var (
+			tempDir      string
+			fakeRuncPath string
+		)
+
+		BeforeEach(func() {
+			var err error
+			tempDir, err = ioutil.TempDir("", "")
+			Expect(err).NotTo(HaveOccurred())
+
+			fakeRuncPath = filepath.Join(tempDir, "fakeRunc")
+
+			runcClient = client.NewRuncClient(fakeRuncPath, "/path/to/things", false)
+		})
+
+		AfterEach(func() {
+			err := os.RemoveAll(tempDir)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		Context("when runc fails", func() {
+			BeforeEach(func() {
+				contents := []byte(`#!/bin/sh
+echo '{"level":"warning","msg":"unrelated"}' >> "$4"
+echo '{"level":"error","msg":"container_linux.go:380: starting container process caused: device or resource busy"}' >> "$4"
+exit 2
+`)
+
+				err := ioutil.WriteFile(fakeRuncPath, contents, 0700)
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("returns the exit status and the error logged by runc", func() {
+				status, err := runcClient.RunContainer(context.Background(), "pidfile", "bundle", "container", true, ioutil.Discard, ioutil.Discard)
+				Expect(status).To(Equal(2))
+				Expect(err).To(MatchError(ContainSubstring("starting container process caused: device or resource busy")))
+				Expect(client.IsTransient(err)).To(BeTrue())
+			})
+
+			It("keeps everything which runc logged", func() {
+				_, err := runcClient.RunContainer(context.Background(), "pidfile", "bundle", "container", true, ioutil.Discard, ioutil.Discard)
+
+				var runErr *client.RunError
+				Expect(errors.As(err, &runErr)).To(BeTrue())
+				Expect(runErr.Log).To(Equal("warning: unrelated\nerror: container_linux.go:380: starting container process caused: device or resource busy\n"))
+			})
+		})
+
+		Context("when runc fails without logging an error", func() {
+			BeforeEach(func() {
+				contents := []byte(`#!/bin/sh
+exit 1
+`)
+
+				err := ioutil.WriteFile(fakeRuncPath, contents, 0700)
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("returns a non-transient error", func() {
+				status, err := runcClient.RunContainer(context.Background(), "pidfile", "bundle", "container", true, ioutil.Discard, ioutil.Discard)
+				Expect(status).To(Equal(1))
+				Expect(err).To(HaveOccurred())
+				Expect(client.IsTransient(err)).To(BeFalse())
+			})
+		})
+
+		Context("when the bundle records a niceness", func() {
+			BeforeEach(func() {
+				bundlePath = filepath.Join(tempDir, "bundle")
+				Expect(os.MkdirAll(bundlePath, 0700)).To(Succeed())
+
+				spec := specs.Spec{Annotations: map[string]string{client.NiceAnnotation: "7"}}
+				data, err := json.Marshal(spec)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(ioutil.WriteFile(filepath.Join(bundlePath, "config.json"), data, 0600)).To(Succeed())
+
+				contents := []byte(`#!/bin/sh
+nice > "$(dirname "$0")/niceness"
+`)
+				Expect(ioutil.WriteFile(fakeRuncPath, contents, 0700)).To(Succeed())
+			})
+
+			It("starts runc with that niceness", func() {
+				_, err := runcClient.RunContainer(context.Background(), "pidfile", bundlePath, "container", true, ioutil.Discard, ioutil.Discard)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(ioutil.ReadFile(filepath.Join(tempDir, "niceness"))).To(Equal([]byte("7\n")))
+			})
+
+			It("does not change the niceness of bpm", func() {
+				before, err := exec.Command("nice").Output()
+				Expect(err).NotTo(HaveOccurred())
+
+				for i := 0; i < 10; i++ {
+					_, err := runcClient.RunContainer(context.Background(), "pidfile", bundlePath, "container", true, ioutil.Discard, ioutil.Discard)
+					Expect(err).NotTo(HaveOccurred())
+				}
+
+				after, err := exec.Command("nice").Output()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(after).To(Equal(before))
+			})
+		})
+
+		Context("when the bundle records realtime scheduling", func() {
+			BeforeEach(func() {
+				bundlePath = filepath.Join(tempDir, "bundle")
+				Expect(os.MkdirAll(bundlePath, 0700)).To(Succeed())
+
+				spec := specs.Spec{Annotations: map[string]string{client.RealtimeAnnotation: "rr:10"}}
+				data, err := json.Marshal(spec)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(ioutil.WriteFile(filepath.Join(bundlePath, "config.json"), data, 0600)).To(Succeed())
+
+				contents := []byte(`#!/bin/sh
+chrt -p $$ > "$(dirname "$0")/scheduling"
+`)
+				Expect(ioutil.WriteFile(fakeRuncPath, contents, 0700)).To(Succeed())
+			})
+
+			It("starts runc with that policy and priority", func() {
+				_, err := runcClient.RunContainer(context.Background(), "pidfile", bundlePath, "container", true, ioutil.Discard, ioutil.Discard)
+				Expect(err).NotTo(HaveOccurred())
+
+				scheduling, err := ioutil.ReadFile(filepath.Join(tempDir, "scheduling"))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(scheduling)).To(ContainSubstring("SCHED_RR"))
+				Expect(string(scheduling)).To(ContainSubstring("priority: 10"))
+			})
+		})
+
+		Context("when a reaper is used", func() {
+			var (
+				fakeReaperPath string
+				stdout         *os.File
+			)
+
+			BeforeEach(func() {
+				fakeReaperPath = filepath.Join(tempDir, "fakeBpm")
+				contents := []byte(`#!/bin/sh
+echo "$@" > "$(dirname "$0")/reaper-args"
+shift 6
+"$@"
+echo $? >&3
+exec 3>&-
+sleep 0.1
+`)
+				Expect(ioutil.WriteFile(fakeReaperPath, contents, 0700)).To(Succeed())
+				runcClient.UseReaper(fakeReaperPath)
+
+				var err error
+				stdout, err = ioutil.TempFile(tempDir, "stdout")
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			AfterEach(func() {
+				stdout.Close()
+			})
+
+			It("runs runc through the reaper and returns once runc has finished", func() {
+				Expect(ioutil.WriteFile(fakeRuncPath, []byte("#!/bin/sh\necho started\n"), 0700)).To(Succeed())
+
+				status, err := runcClient.RunContainer(context.Background(), "/run/job/proc.pid", "bundle", "container", true, stdout, stdout)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(status).To(Equal(0))
+
+				Expect(ioutil.ReadFile(stdout.Name())).To(Equal([]byte("started\n")))
+
+				args, err := ioutil.ReadFile(filepath.Join(tempDir, "reaper-args"))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(args)).To(HavePrefix("reap --pid-file /run/job/proc.pid --exit-file /run/job/proc.exit -- " + fakeRuncPath + " --root /path/to/things --log "))
+			})
+
+			It("returns the exit status and the error logged by runc", func() {
+				contents := []byte(`#!/bin/sh
+echo '{"level":"error","msg":"device or resource busy"}' >> "$4"
+exit 2
+`)
+				Expect(ioutil.WriteFile(fakeRuncPath, contents, 0700)).To(Succeed())
+
+				status, err := runcClient.RunContainer(context.Background(), "pidfile", "bundle", "container", true, stdout, stdout)
+				Expect(status).To(Equal(2))
+				Expect(err).To(MatchError(ContainSubstring("device or resource busy")))
+				Expect(client.IsTransient(err)).To(BeTrue())
+			})
+
+			It("does not use the reaper for processes run in the foreground", func() {
+				Expect(ioutil.WriteFile(fakeRuncPath, []byte("#!/bin/sh\n"), 0700)).To(Succeed())
+
+				_, err := runcClient.RunContainer(context.Background(), "pidfile", "bundle", "container", false, stdout, stdout)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(filepath.Join(tempDir, "reaper-args")).NotTo(BeAnExistingFile())
+			})
+		})
+	})
+
+	Describe("IsTransient", func() {
+		It("recognizes errors which are likely to go away on retry", func() {
+			Expect(client.IsTransient(&client.RunError{Message: "mkdir /sys/fs/cgroup/cpu/foo: device or resource busy"})).To(BeTrue())
+			Expect(client.IsTransient(&client.RunError{Message: "fork/exec: resource temporarily unavailable"})).To(BeTrue())
+			Expect(client.IsTransient(&client.RunError{Message: "Unit runc-foo.scope already exists."})).To(BeTrue())
+		})
+
+		It("does not retry other errors", func() {
+			Expect(client.IsTransient(&client.RunError{Message: "exec: \"/bin/nope\": no such file or directory"})).To(BeFalse())
+			Expect(client.IsTransient(errors.New("device or resource busy"))).To(BeFalse())
+			Expect(client.IsTransient(nil)).To(BeFalse())
+		})
+	})
+
+	Describe("ParseSignal", func() {
+		It("parses signal names with or without the SIG prefix", func() {
+			Expect(client.ParseSignal("HUP")).To(Equal(client.Hup))
+			Expect(client.ParseSignal("SIGUSR2")).To(Equal(client.Usr2))
+			Expect(client.ParseSignal("kill")).To(Equal(client.Kill))
+		})
+
+		It("returns an error for unknown signals", func() {
+			_, err := client.ParseSignal("SIGWHAT")
+			Expect(err).To(HaveOccurred())
+		})
+	})
 })
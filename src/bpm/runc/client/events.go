@@ -0,0 +1,218 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"bpm/cgroups"
+	"bpm/models"
+)
+
+// runcEvent is the subset of the output of `runc events` which bpm uses. It
+// is converted to a models.Event so that changes to runc's output do not
+// reach bpm's users.
+type runcEvent struct {
+	Type string     `json:"type"`
+	ID   string     `json:"id"`
+	Data *runcStats `json:"data,omitempty"`
+}
+
+type runcStats struct {
+	CPU struct {
+		Usage struct {
+			Total uint64 `json:"total"`
+		} `json:"usage"`
+		Throttling struct {
+			Periods          uint64 `json:"periods"`
+			ThrottledPeriods uint64 `json:"throttledPeriods"`
+			ThrottledTime    uint64 `json:"throttledTime"`
+		} `json:"throttling"`
+	} `json:"cpu"`
+	Memory struct {
+		Usage struct {
+			Limit uint64 `json:"limit"`
+			Usage uint64 `json:"usage"`
+			Max   uint64 `json:"max"`
+		} `json:"usage"`
+	} `json:"memory"`
+	Pids struct {
+		Current uint64 `json:"current"`
+		Limit   uint64 `json:"limit"`
+	} `json:"pids"`
+}
+
+func (s *runcStats) stats() *models.Stats {
+	stats := &models.Stats{}
+	stats.CPU.UsageNanoseconds = s.CPU.Usage.Total
+	stats.CPU.Periods = s.CPU.Throttling.Periods
+	stats.CPU.ThrottledPeriods = s.CPU.Throttling.ThrottledPeriods
+	stats.CPU.ThrottledNanoseconds = s.CPU.Throttling.ThrottledTime
+	stats.Memory.UsageBytes = s.Memory.Usage.Usage
+	stats.Memory.MaxUsageBytes = s.Memory.Usage.Max
+	stats.Memory.LimitBytes = cgroups.Limit(s.Memory.Usage.Limit)
+	stats.Pids.Current = s.Pids.Current
+	stats.Pids.Limit = cgroups.Limit(s.Pids.Limit)
+	return stats
+}
+
+// Stats returns the current resource usage of a container. The usage is read
+// from `runc events --stats`, or directly from the container's cgroups if
+// runc cannot report it.
+func (c *RuncClient) Stats(ctx context.Context, containerID string) (*models.Stats, error) {
+	runcCmd := c.buildCmd(ctx, c.rootFor(containerID), "events", "--stats", containerID)
+
+	data, runcErr := runcCmd.Output()
+	if runcErr == nil {
+		var event runcEvent
+		if err := json.Unmarshal(data, &event); err == nil && event.Data != nil {
+			stats := event.Data.stats()
+			stats.Memory.OOMKills, _ = c.OOMKillCount(containerID)
+			return stats, nil
+		}
+	}
+
+	stats, err := c.cgroupStats(containerID)
+	if err != nil {
+		if runcErr != nil {
+			return nil, fmt.Errorf("failed to get stats from runc (%s) or cgroups (%s)", runcErr, err)
+		}
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+// Events calls handle with each event which happens to a container until ctx
+// is done or the container goes away. A stats event is sent every interval.
+// Events come from `runc events` or, if runc cannot provide them, by polling
+// the container's cgroups.
+func (c *RuncClient) Events(ctx context.Context, containerID string, interval time.Duration, handle func(models.Event)) error {
+	received, err := c.runcEvents(ctx, containerID, interval, handle)
+	if ctx.Err() != nil {
+		return nil
+	}
+
+	if err != nil && !received {
+		return c.pollEvents(ctx, containerID, interval, handle)
+	}
+
+	return err
+}
+
+func (c *RuncClient) runcEvents(ctx context.Context, containerID string, interval time.Duration, handle func(models.Event)) (bool, error) {
+	runcCmd := c.buildCmd(ctx, c.rootFor(containerID), "events", "--interval", interval.String(), containerID)
+
+	stdout, err := runcCmd.StdoutPipe()
+	if err != nil {
+		return false, err
+	}
+
+	if err := runcCmd.Start(); err != nil {
+		return false, err
+	}
+
+	// runc only notices OOM kills through cgroup v1's memory.oom_control.
+	// Under the unified hierarchy they are noticed from the count in
+	// memory.events going up between stats instead.
+	paths, _ := c.cgroupPaths(containerID)
+	_, unified := paths[""]
+
+	var (
+		oomKills uint64
+		sawOOM   bool
+		first    = true
+	)
+
+	received := false
+	decoder := json.NewDecoder(stdout)
+	for {
+		var event runcEvent
+		if err := decoder.Decode(&event); err == io.EOF {
+			break
+		} else if err != nil {
+			runcCmd.Process.Kill()
+			runcCmd.Wait()
+			return received, err
+		}
+
+		received = true
+
+		switch event.Type {
+		case models.EventTypeOOM:
+			sawOOM = true
+			handle(models.Event{Type: models.EventTypeOOM, Timestamp: time.Now()})
+		case models.EventTypeStats:
+			if event.Data == nil {
+				continue
+			}
+			stats := event.Data.stats()
+			stats.Memory.OOMKills, _ = c.OOMKillCount(containerID)
+
+			now := time.Now()
+			if unified && !first && !sawOOM && stats.Memory.OOMKills > oomKills {
+				handle(models.Event{Type: models.EventTypeOOM, Timestamp: now})
+			}
+			oomKills, sawOOM, first = stats.Memory.OOMKills, false, false
+
+			handle(models.Event{Type: models.EventTypeStats, Timestamp: now, Stats: stats})
+		}
+	}
+
+	return received, runcCmd.Wait()
+}
+
+// pollEvents reads the stats of the container from its cgroups every
+// interval. An OOM event is sent whenever the number of OOM kills goes up.
+func (c *RuncClient) pollEvents(ctx context.Context, containerID string, interval time.Duration, handle func(models.Event)) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var oomKills uint64
+	for first := true; ; first = false {
+		stats, err := c.cgroupStats(containerID)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		if !first && stats.Memory.OOMKills > oomKills {
+			handle(models.Event{Type: models.EventTypeOOM, Timestamp: now})
+		}
+		oomKills = stats.Memory.OOMKills
+
+		handle(models.Event{Type: models.EventTypeStats, Timestamp: now, Stats: stats})
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *RuncClient) cgroupStats(containerID string) (*models.Stats, error) {
+	paths, err := c.cgroupPaths(containerID)
+	if err != nil {
+		return nil, err
+	}
+
+	return cgroups.ReadStats(paths)
+}
@@ -0,0 +1,128 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package client
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// NiceAnnotation records the niceness which the process of a container is
+// started with. The runtime spec has no way to set it so runc is started with
+// it instead and the process inherits it from runc.
+const NiceAnnotation = "bpm.nice"
+
+// RealtimeAnnotation records the realtime scheduling policy and priority
+// which the process of a container is started with, such as fifo:50. Like
+// the niceness they are inherited from runc.
+const RealtimeAnnotation = "bpm.realtime"
+
+// schedPolicies are the realtime scheduling policies which may be recorded
+// in a RealtimeAnnotation, from sched.h.
+var schedPolicies = map[string]uintptr{
+	"fifo": 1,
+	"rr":   2,
+}
+
+// scheduling is how runc is scheduled when it starts a container.
+type scheduling struct {
+	nice *int
+
+	policy   uintptr
+	priority int
+}
+
+// parseRealtime parses the value of a RealtimeAnnotation.
+func parseRealtime(value string) (string, int, error) {
+	parts := strings.SplitN(value, ":", 2)
+	if len(parts) != 2 {
+		return "", 0, fmt.Errorf("invalid realtime scheduling %q", value)
+	}
+
+	if _, ok := schedPolicies[parts[0]]; !ok {
+		return "", 0, fmt.Errorf("invalid realtime scheduling %q: unknown policy", value)
+	}
+
+	priority, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid realtime scheduling %q: %s", value, err)
+	}
+
+	return parts[0], priority, nil
+}
+
+// bundleScheduling returns how the bundle asks for its process to be
+// scheduled, if it asks at all. A bundle which cannot be read is left for
+// runc to report.
+func (c *RuncClient) bundleScheduling(bundlePath string) (scheduling, bool) {
+	spec, err := c.BundleSpec(bundlePath)
+	if err != nil {
+		return scheduling{}, false
+	}
+
+	var sched scheduling
+	if value, ok := spec.Annotations[NiceAnnotation]; ok {
+		if nice, err := strconv.Atoi(value); err == nil {
+			sched.nice = &nice
+		}
+	}
+
+	if value, ok := spec.Annotations[RealtimeAnnotation]; ok {
+		if policy, priority, err := parseRealtime(value); err == nil {
+			sched.policy = schedPolicies[policy]
+			sched.priority = priority
+		}
+	}
+
+	return sched, sched.nice != nil || sched.policy != 0
+}
+
+// startScheduled starts cmd from a thread which is scheduled as sched asks,
+// which the command inherits. Scheduling belongs to a thread on Linux so the
+// goroutine keeps its thread to itself and exits without unlocking it, which
+// throws the thread away rather than returning it to the scheduler.
+func startScheduled(cmd *exec.Cmd, sched scheduling) error {
+	started := make(chan error, 1)
+
+	go func() {
+		runtime.LockOSThread()
+
+		if sched.nice != nil {
+			if err := syscall.Setpriority(syscall.PRIO_PROCESS, 0, *sched.nice); err != nil {
+				started <- err
+				return
+			}
+		}
+
+		if sched.policy != 0 {
+			param := struct{ priority int32 }{int32(sched.priority)}
+			_, _, errno := syscall.RawSyscall(syscall.SYS_SCHED_SETSCHEDULER, 0, sched.policy, uintptr(unsafe.Pointer(&param)))
+			if errno != 0 {
+				started <- fmt.Errorf("failed to set realtime scheduling: %s", errno)
+				return
+			}
+		}
+
+		started <- cmd.Start()
+	}()
+
+	return <-started
+}
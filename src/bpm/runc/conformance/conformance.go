@@ -0,0 +1,326 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+// Package conformance contains ginkgo specs which check that a runtime backend
+// behaves the way that bpm expects of a lifecycle.RuncClient. A backend calls
+// DescribeRuntime from its own test suite:
+//
+//	var _ = conformance.DescribeRuntime(conformance.Backend{
+//	        Name: "runc",
+//	        New:  func() lifecycle.RuncClient { return client.NewRuncClient(path, root, false) },
+//	})
+//
+// The specs run real containers so they must be run as root.
+package conformance
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+
+	"bpm/models"
+	"bpm/runc/client"
+	"bpm/runc/lifecycle"
+	"bpm/runc/specbuilder"
+)
+
+// Feature is a part of the contract which a backend may not support.
+type Feature int
+
+const (
+	// Pause is PauseContainer and ResumeContainer.
+	Pause Feature = iota
+	// Update is UpdateContainer.
+	Update
+)
+
+// Backend is the runtime under test.
+type Backend struct {
+	// Name is used in the descriptions of the specs.
+	Name string
+
+	// New returns a client for the backend. It is called before each spec
+	// and the containers it creates should not be visible to clients of
+	// other backends.
+	New func() lifecycle.RuncClient
+
+	// Unsupported lists the features which the backend does not implement.
+	// Instead of checking their behaviour the specs check that they fail
+	// rather than silently doing nothing.
+	Unsupported []Feature
+}
+
+func (b Backend) supports(f Feature) bool {
+	for _, u := range b.Unsupported {
+		if u == f {
+			return false
+		}
+	}
+	return true
+}
+
+// hostDirectories are bind mounted into the test containers so that they
+// have a shell to run.
+var hostDirectories = []string{"/bin", "/etc", "/lib", "/lib64", "/sbin", "/usr"}
+
+// DescribeRuntime declares the conformance specs for the backend.
+func DescribeRuntime(backend Backend) bool {
+	return Describe(fmt.Sprintf("%s runtime conformance", backend.Name), func() {
+		var (
+			runtime     lifecycle.RuncClient
+			ctx         context.Context
+			tempDir     string
+			bundlePath  string
+			pidFilePath string
+			containerID string
+		)
+
+		buildSpec := func(script string) specs.Spec {
+			var mounts []specs.Mount
+			for _, dir := range hostDirectories {
+				if _, err := os.Stat(dir); err != nil {
+					continue
+				}
+				mounts = append(mounts, specs.Mount{
+					Destination: dir,
+					Type:        "bind",
+					Source:      dir,
+					Options:     []string{"nodev", "nosuid", "exec", "bind", "ro"},
+				})
+			}
+
+			return *specbuilder.Build(
+				specbuilder.WithRootFilesystem(filepath.Join(bundlePath, "rootfs")),
+				specbuilder.WithUser(specs.User{UID: 0, GID: 0}),
+				specbuilder.WithProcess("/bin/sh", []string{"-c", script}, []string{"PATH=/usr/bin:/bin"}, "/"),
+				specbuilder.WithMounts(mounts),
+				specbuilder.WithNamespace("ipc"),
+				specbuilder.WithNamespace("mount"),
+				specbuilder.WithNamespace("pid"),
+				specbuilder.WithNamespace("uts"),
+			)
+		}
+
+		status := func() specs.ContainerState {
+			state, err := runtime.ContainerState(ctx, containerID)
+			Expect(err).NotTo(HaveOccurred())
+			if state == nil {
+				return ""
+			}
+			return state.Status
+		}
+
+		// runDetached starts a container which runs until it is sent
+		// SIGTERM.
+		runDetached := func() int {
+			spec := buildSpec(`trap 'exit 0' TERM; while true; do sleep 0.1; done`)
+			Expect(runtime.CreateBundle(bundlePath, spec, specs.User{})).To(Succeed())
+
+			code, err := runtime.RunContainer(ctx, pidFilePath, bundlePath, containerID, true, GinkgoWriter, GinkgoWriter)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(code).To(Equal(0))
+			Eventually(status).Should(Equal(specs.StateRunning))
+
+			pid, err := ioutil.ReadFile(pidFilePath)
+			Expect(err).NotTo(HaveOccurred())
+			n, err := strconv.Atoi(strings.TrimSpace(string(pid)))
+			Expect(err).NotTo(HaveOccurred())
+			return n
+		}
+
+		BeforeEach(func() {
+			runtime = backend.New()
+			ctx = context.Background()
+
+			var err error
+			tempDir, err = ioutil.TempDir("", "bpm-conformance")
+			Expect(err).NotTo(HaveOccurred())
+
+			bundlePath = filepath.Join(tempDir, "bundle")
+			pidFilePath = filepath.Join(tempDir, "pid")
+			containerID = fmt.Sprintf("bpm-conformance-%d-%d", GinkgoParallelNode(), time.Now().UnixNano())
+		})
+
+		AfterEach(func() {
+			// Most specs have already deleted their container or never
+			// created one.
+			_ = runtime.DeleteContainer(ctx, containerID)
+			Expect(runtime.DestroyBundle(bundlePath)).To(Succeed())
+			Expect(os.RemoveAll(tempDir)).To(Succeed())
+		})
+
+		Describe("bundles", func() {
+			It("reads back the spec which was written", func() {
+				spec := buildSpec("true")
+				Expect(runtime.CreateBundle(bundlePath, spec, specs.User{})).To(Succeed())
+
+				Expect(runtime.BundleSpec(bundlePath)).To(Equal(&spec))
+				Expect(filepath.Join(bundlePath, "rootfs")).To(BeADirectory())
+			})
+
+			It("destroys bundles, even ones which do not exist", func() {
+				Expect(runtime.CreateBundle(bundlePath, buildSpec("true"), specs.User{})).To(Succeed())
+
+				Expect(runtime.DestroyBundle(bundlePath)).To(Succeed())
+				Expect(bundlePath).NotTo(BeAnExistingFile())
+				Expect(runtime.DestroyBundle(bundlePath)).To(Succeed())
+			})
+		})
+
+		It("reports no state for containers which do not exist", func() {
+			state, err := runtime.ContainerState(ctx, containerID)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(state).To(BeNil())
+		})
+
+		It("returns the exit status of attached containers", func() {
+			Expect(runtime.CreateBundle(bundlePath, buildSpec("echo hello; exit 3"), specs.User{})).To(Succeed())
+
+			stdout := &bytes.Buffer{}
+			code, _ := runtime.RunContainer(ctx, pidFilePath, bundlePath, containerID, false, stdout, GinkgoWriter)
+			Expect(code).To(Equal(3))
+			Expect(stdout.String()).To(Equal("hello\n"))
+		})
+
+		Context("when a container is running detached", func() {
+			var pid int
+
+			BeforeEach(func() {
+				pid = runDetached()
+			})
+
+			It("reports the PID written to the PID file", func() {
+				state, err := runtime.ContainerState(ctx, containerID)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(state.ID).To(Equal(containerID))
+				Expect(state.Pid).To(Equal(pid))
+			})
+
+			It("lists the container", func() {
+				containers, err := runtime.ListContainers(ctx)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(containers).To(ContainElement(client.ContainerState{
+					ID:             containerID,
+					InitProcessPid: pid,
+					Status:         "running",
+				}))
+			})
+
+			It("runs other processes inside it", func() {
+				process := specs.Process{
+					Args: []string{"/bin/sh", "-c", "echo $GREETING"},
+					Env:  []string{"GREETING=hello"},
+					Cwd:  "/",
+				}
+
+				stdout := &bytes.Buffer{}
+				Expect(runtime.Exec(ctx, containerID, process, nil, stdout, GinkgoWriter)).To(Succeed())
+				Expect(stdout.String()).To(Equal("hello\n"))
+			})
+
+			It("keeps a stopped container until it is deleted", func() {
+				Expect(runtime.SignalContainer(ctx, containerID, client.Term)).To(Succeed())
+				Eventually(status).Should(Equal(specs.StateStopped))
+
+				Expect(runtime.DeleteContainer(ctx, containerID)).To(Succeed())
+				Expect(status()).To(BeEmpty())
+			})
+
+			It("deletes containers which are still running", func() {
+				Expect(runtime.DeleteContainer(ctx, containerID)).To(Succeed())
+				Expect(status()).To(BeEmpty())
+
+				containers, err := runtime.ListContainers(ctx)
+				Expect(err).NotTo(HaveOccurred())
+				for _, c := range containers {
+					Expect(c.ID).NotTo(Equal(containerID))
+				}
+			})
+
+			It("reports the usage of the container", func() {
+				stats, err := runtime.Stats(ctx, containerID)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(stats.Pids.Current).To(BeNumerically(">=", 1))
+				Expect(stats.Memory.UsageBytes).To(BeNumerically(">", 0))
+
+				count, err := runtime.OOMKillCount(containerID)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(count).To(BeZero())
+			})
+
+			It("reports the limits of the container's cgroup", func() {
+				_, err := runtime.CgroupLimits(containerID)
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("sends stats events until the context is done", func() {
+				eventsCtx, cancel := context.WithTimeout(ctx, 2500*time.Millisecond)
+				defer cancel()
+
+				var events []models.Event
+				err := runtime.Events(eventsCtx, containerID, time.Second, func(e models.Event) {
+					events = append(events, e)
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(events).NotTo(BeEmpty())
+				Expect(events[0].Type).To(Equal(models.EventTypeStats))
+				Expect(events[0].Stats).NotTo(BeNil())
+			})
+
+			if backend.supports(Pause) {
+				It("pauses and resumes the container", func() {
+					Expect(runtime.PauseContainer(ctx, containerID)).To(Succeed())
+					Expect(status()).To(Equal(specs.ContainerState("paused")))
+
+					Expect(runtime.ResumeContainer(ctx, containerID)).To(Succeed())
+					Expect(status()).To(Equal(specs.StateRunning))
+				})
+			} else {
+				It("fails to pause the container", func() {
+					Expect(runtime.PauseContainer(ctx, containerID)).NotTo(Succeed())
+					Expect(status()).To(Equal(specs.StateRunning))
+				})
+			}
+
+			if backend.supports(Update) {
+				It("changes the limits of the container", func() {
+					limit := int64(50)
+					resources := &specs.LinuxResources{Pids: &specs.LinuxPids{Limit: limit}}
+					Expect(runtime.UpdateContainer(ctx, containerID, resources)).To(Succeed())
+
+					stats, err := runtime.Stats(ctx, containerID)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(stats.Pids.Limit).To(Equal(uint64(limit)))
+				})
+			} else {
+				It("fails to change the limits of the container", func() {
+					resources := &specs.LinuxResources{Pids: &specs.LinuxPids{Limit: 50}}
+					Expect(runtime.UpdateContainer(ctx, containerID, resources)).NotTo(Succeed())
+				})
+			}
+		})
+	})
+}
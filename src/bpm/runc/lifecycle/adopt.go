@@ -0,0 +1,173 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+
+	"bpm/config"
+	"bpm/models"
+)
+
+// AdoptProcess registers a process which was started outside of bpm as the
+// job's process. bpm cannot move an existing process into a container so an
+// adopted process keeps running with its original namespaces, user, and
+// mounts, and the limits in the job's configuration are not applied to it.
+// Adoption allows bpm to report on and stop the process while the job is
+// migrated to being started by bpm.
+func (j *RuncLifecycle) AdoptProcess(ctx context.Context, logger lager.Logger, cfg *config.BPMConfig, pid int) error {
+	container, err := j.runcClient.ContainerState(ctx, cfg.ContainerID())
+	if err != nil {
+		return err
+	}
+	if container != nil {
+		return errors.New("a bpm container already exists for this process")
+	}
+
+	if !processAlive(pid) {
+		return fmt.Errorf("process %d is not running", pid)
+	}
+
+	if err := os.MkdirAll(cfg.PidDir().External(), 0700); err != nil {
+		return err
+	}
+
+	logger.Info("adopting-process", lager.Data{"pid": pid})
+	contents := []byte(strconv.Itoa(pid))
+	if err := ioutil.WriteFile(cfg.AdoptedFile().External(), contents, 0600); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(cfg.PidFile().External(), contents, 0644)
+}
+
+// StatAdoptedProcess returns the state of an adopted process. If no process
+// has been adopted then an error satisfying IsNotExist is returned.
+func (j *RuncLifecycle) StatAdoptedProcess(cfg *config.BPMConfig) (*models.Process, error) {
+	pid, err := readAdoptedPid(cfg)
+	if os.IsNotExist(err) {
+		return nil, isNotExistError
+	} else if err != nil {
+		return nil, err
+	}
+
+	process := &models.Process{
+		Name:   cfg.ContainerID(),
+		Pid:    pid,
+		Status: models.ProcessStateAdopted,
+	}
+
+	if !processAlive(pid) {
+		process.Pid = 0
+		process.Status = models.ProcessStateFailed
+	}
+
+	return process, nil
+}
+
+// StopAdoptedProcess sends SIGTERM to an adopted process and waits for it to
+// exit, sending SIGKILL if it has not exited within the timeout or ctx is
+// cancelled while waiting. The adoption is then forgotten.
+func (j *RuncLifecycle) StopAdoptedProcess(ctx context.Context, logger lager.Logger, cfg *config.BPMConfig, exitTimeout time.Duration) error {
+	pid, err := readAdoptedPid(cfg)
+	if err != nil {
+		return err
+	}
+
+	var interrupted error
+	if processAlive(pid) {
+		logger.Info("terminating-adopted-process", lager.Data{"pid": pid})
+		if err := syscall.Kill(pid, syscall.SIGTERM); err != nil && err != syscall.ESRCH {
+			return err
+		}
+
+		// An interrupted stop kills the process straight away rather
+		// than leaving it running without being tracked.
+		var exited bool
+		exited, interrupted = j.waitForExit(ctx, pid, exitTimeout)
+
+		if !exited {
+			logger.Info("killing-adopted-process", lager.Data{"pid": pid})
+			if err := syscall.Kill(pid, syscall.SIGKILL); err != nil && err != syscall.ESRCH {
+				return err
+			}
+		}
+	}
+
+	if err := j.ForgetAdoptedProcess(logger, cfg); err != nil {
+		return err
+	}
+
+	return interrupted
+}
+
+// ForgetAdoptedProcess removes the record of an adopted process without
+// signalling it.
+func (j *RuncLifecycle) ForgetAdoptedProcess(logger lager.Logger, cfg *config.BPMConfig) error {
+	logger.Info("forgetting-adopted-process")
+	if err := j.deleteFile(cfg.AdoptedFile().External()); err != nil {
+		return err
+	}
+
+	return j.deleteFile(cfg.PidFile().External())
+}
+
+// waitForExit polls until the process has exited or the timeout has passed.
+// It gives up with an error if ctx is done first.
+func (j *RuncLifecycle) waitForExit(ctx context.Context, pid int, timeout time.Duration) (bool, error) {
+	timer := j.clock.NewTimer(timeout)
+	defer timer.Stop()
+
+	ticker := j.clock.NewTicker(ContainerStatePollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C():
+			if !processAlive(pid) {
+				return true, nil
+			}
+		case <-timer.C():
+			return !processAlive(pid), nil
+		case <-ctx.Done():
+			return false, ctx.Err()
+		}
+	}
+}
+
+func readAdoptedPid(cfg *config.BPMConfig) (int, error) {
+	data, err := ioutil.ReadFile(cfg.AdoptedFile().External())
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.Atoi(strings.TrimSpace(string(data)))
+}
+
+func processAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
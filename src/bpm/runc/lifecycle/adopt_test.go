@@ -0,0 +1,206 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package lifecycle_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/lager/lagertest"
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+
+	"bpm/bosh"
+	"bpm/config"
+	"bpm/models"
+	"bpm/runc/lifecycle"
+	"bpm/runc/lifecycle/mock_lifecycle"
+)
+
+var _ = Describe("Adopted processes", func() {
+	var (
+		mockCtrl       *gomock.Controller
+		fakeRuncClient *mock_lifecycle.MockRuncClient
+		fakeClock      *fakeclock.FakeClock
+		logger         *lagertest.TestLogger
+		ctx            context.Context
+
+		boshRoot string
+		bpmCfg   *config.BPMConfig
+
+		legacy     *exec.Cmd
+		legacyDone chan struct{}
+
+		runcLifecycle *lifecycle.RuncLifecycle
+	)
+
+	BeforeEach(func() {
+		mockCtrl = gomock.NewController(GinkgoT())
+		fakeRuncClient = mock_lifecycle.NewMockRuncClient(mockCtrl)
+		fakeClock = fakeclock.NewFakeClock(time.Now())
+		logger = lagertest.NewTestLogger("adopt")
+		ctx = context.Background()
+
+		var err error
+		boshRoot, err = ioutil.TempDir("", "adopt")
+		Expect(err).NotTo(HaveOccurred())
+		bpmCfg = config.NewBPMConfig(bosh.NewEnv(boshRoot), "example", "server")
+
+		legacy = exec.Command("sleep", "100")
+		Expect(legacy.Start()).To(Succeed())
+
+		// Reap the process so that it does not linger as a zombie once it
+		// has been stopped.
+		legacyDone = make(chan struct{})
+		go func() {
+			legacy.Wait()
+			close(legacyDone)
+		}()
+
+		runcLifecycle = lifecycle.NewRuncLifecycle(
+			fakeRuncClient,
+			mock_lifecycle.NewMockRuncAdapter(mockCtrl),
+			mock_lifecycle.NewMockUserFinder(mockCtrl),
+			mock_lifecycle.NewMockCommandRunner(mockCtrl),
+			fakeClock,
+			os.Remove,
+			nil,
+			nil,
+			nil,
+			nil,
+		)
+	})
+
+	AfterEach(func() {
+		legacy.Process.Kill()
+		Eventually(legacyDone).Should(BeClosed())
+
+		mockCtrl.Finish()
+		Expect(os.RemoveAll(boshRoot)).To(Succeed())
+	})
+
+	adopt := func() {
+		fakeRuncClient.EXPECT().ContainerState(gomock.Any(), bpmCfg.ContainerID()).Return(nil, nil)
+		Expect(runcLifecycle.AdoptProcess(ctx, logger, bpmCfg, legacy.Process.Pid)).To(Succeed())
+	}
+
+	Describe("AdoptProcess", func() {
+		It("records the pid of the process", func() {
+			adopt()
+
+			pid := strconv.Itoa(legacy.Process.Pid)
+			Expect(ioutil.ReadFile(bpmCfg.AdoptedFile().External())).To(BeEquivalentTo(pid))
+			Expect(ioutil.ReadFile(bpmCfg.PidFile().External())).To(BeEquivalentTo(pid))
+		})
+
+		Context("when a container already exists for the process", func() {
+			It("returns an error", func() {
+				fakeRuncClient.
+					EXPECT().
+					ContainerState(gomock.Any(), bpmCfg.ContainerID()).
+					Return(&specs.State{Status: "running"}, nil)
+
+				err := runcLifecycle.AdoptProcess(ctx, logger, bpmCfg, legacy.Process.Pid)
+				Expect(err).To(HaveOccurred())
+			})
+		})
+
+		Context("when the process is not running", func() {
+			It("returns an error", func() {
+				Expect(legacy.Process.Kill()).To(Succeed())
+				Eventually(legacyDone).Should(BeClosed())
+
+				fakeRuncClient.EXPECT().ContainerState(gomock.Any(), bpmCfg.ContainerID()).Return(nil, nil)
+				err := runcLifecycle.AdoptProcess(ctx, logger, bpmCfg, legacy.Process.Pid)
+				Expect(err).To(HaveOccurred())
+			})
+		})
+	})
+
+	Describe("StatAdoptedProcess", func() {
+		It("reports the adopted process", func() {
+			adopt()
+
+			process, err := runcLifecycle.StatAdoptedProcess(bpmCfg)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(process).To(Equal(&models.Process{
+				Name:   bpmCfg.ContainerID(),
+				Pid:    legacy.Process.Pid,
+				Status: models.ProcessStateAdopted,
+			}))
+		})
+
+		Context("when the adopted process has exited", func() {
+			It("reports the process as failed", func() {
+				adopt()
+				Expect(legacy.Process.Kill()).To(Succeed())
+				Eventually(legacyDone).Should(BeClosed())
+
+				process, err := runcLifecycle.StatAdoptedProcess(bpmCfg)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(process.Status).To(Equal(models.ProcessStateFailed))
+			})
+		})
+
+		Context("when no process has been adopted", func() {
+			It("returns an 'IsNotExist' error", func() {
+				_, err := runcLifecycle.StatAdoptedProcess(bpmCfg)
+				Expect(lifecycle.IsNotExist(err)).To(BeTrue())
+			})
+		})
+	})
+
+	Describe("StopAdoptedProcess", func() {
+		It("terminates the process and forgets it", func() {
+			adopt()
+
+			errChan := make(chan error)
+			go func() {
+				errChan <- runcLifecycle.StopAdoptedProcess(ctx, logger, bpmCfg, 15*time.Second)
+			}()
+
+			Eventually(legacyDone).Should(BeClosed())
+			fakeClock.WaitForNWatchersAndIncrement(lifecycle.ContainerStatePollInterval, 2)
+			Eventually(errChan).Should(Receive(BeNil()))
+
+			Expect(bpmCfg.AdoptedFile().External()).NotTo(BeAnExistingFile())
+			Expect(bpmCfg.PidFile().External()).NotTo(BeAnExistingFile())
+		})
+
+		Context("when bpm is interrupted while waiting for the process to exit", func() {
+			It("kills the process, forgets it, and returns the context's error", func() {
+				adopt()
+
+				cancelCtx, cancel := context.WithCancel(ctx)
+				cancel()
+
+				err := runcLifecycle.StopAdoptedProcess(cancelCtx, logger, bpmCfg, 15*time.Second)
+				Expect(err).To(Equal(context.Canceled))
+
+				Eventually(legacyDone).Should(BeClosed())
+				Expect(bpmCfg.AdoptedFile().External()).NotTo(BeAnExistingFile())
+				Expect(bpmCfg.PidFile().External()).NotTo(BeAnExistingFile())
+			})
+		})
+	})
+})
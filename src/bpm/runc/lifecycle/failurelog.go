@@ -0,0 +1,65 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package lifecycle
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+
+	"bpm/config"
+	"bpm/runc/client"
+)
+
+// recordStartFailure writes what runc logged during a failed attempt to run
+// the container to the process's start failure log. runc's init can fail
+// before the process is executed (for example when the executable has the
+// wrong format) and what it logs then is not written anywhere else. The log is
+// started again by the first attempt of each start so that it only describes
+// the latest one. It returns the path of the log, or an empty string if it
+// could not be written.
+func (j *RuncLifecycle) recordStartFailure(logger lager.Logger, cfg *config.BPMConfig, attempt int, err error) string {
+	path := cfg.StartFailureLog().External()
+
+	flags := os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	if attempt == 1 {
+		flags |= os.O_TRUNC
+	}
+
+	f, ferr := os.OpenFile(path, flags, 0644)
+	if ferr != nil {
+		logger.Error("failed-to-record-start-failure", ferr)
+		return ""
+	}
+	defer f.Close()
+
+	fmt.Fprintf(f, "attempt %d at %s: %s\n", attempt, j.clock.Now().UTC().Format(time.RFC3339), err)
+
+	var runErr *client.RunError
+	if errors.As(err, &runErr) && runErr.Log != "" {
+		fmt.Fprint(f, runErr.Log)
+	}
+
+	if _, ferr := fmt.Fprintln(f); ferr != nil {
+		logger.Error("failed-to-record-start-failure", ferr)
+		return ""
+	}
+
+	return path
+}
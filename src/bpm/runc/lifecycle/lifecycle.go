@@ -16,11 +16,16 @@
 package lifecycle
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
 	specs "github.com/opencontainers/runtime-spec/specs-go"
@@ -29,8 +34,15 @@ import (
 	"code.cloudfoundry.org/lager"
 
 	"bpm/config"
+	"bpm/helpers"
+	"bpm/limitcheck"
+	"bpm/loglimit"
+	"bpm/logsink"
 	"bpm/models"
+	"bpm/portcheck"
+	"bpm/reaper"
 	"bpm/runc/client"
+	"bpm/tracing"
 	"bpm/usertools"
 )
 
@@ -38,6 +50,26 @@ const (
 	ContainerSigQuitGracePeriod = 2 * time.Second
 	ContainerStatePollInterval  = 1 * time.Second
 
+	// Cleanup which must finish even though bpm has been interrupted is
+	// given up to CleanupTimeout to run.
+	CleanupTimeout = 10 * time.Second
+
+	// The helpers of a process, such as its log relays, are given
+	// HelperGrace to finish and exit by themselves once its container has
+	// been deleted before they are stopped.
+	HelperGrace = 2 * time.Second
+
+	// Starting a container which fails for a transient reason is attempted
+	// up to StartRetryAttempts times in total. The delay between attempts
+	// starts at StartRetryInitialBackoff and doubles each time.
+	StartRetryAttempts       = 4
+	StartRetryInitialBackoff = 500 * time.Millisecond
+
+	// A throttled container may use ChaosThrottleQuota microseconds of CPU
+	// time in every ChaosThrottlePeriod microseconds.
+	ChaosThrottlePeriod = 100000
+	ChaosThrottleQuota  = 1000
+
 	ContainerStateRunning = "running"
 	ContainerStatePaused  = "paused"
 	ContainerStateStopped = "stopped"
@@ -48,36 +80,122 @@ var (
 	isNotExistError = errors.New("process is not running or could not be found")
 )
 
+// IsStopTimeout reports whether StopProcess failed because the process did
+// not exit within the timeout.
+func IsStopTimeout(err error) bool {
+	return err == timeoutError
+}
+
 func IsNotExist(err error) bool {
 	return err == isNotExistError
 }
 
-//go:generate go run -mod=vendor github.com/golang/mock/mockgen -copyright_file ./mock_lifecycle/header.txt -destination ./mock_lifecycle/mocks.go bpm/runc/lifecycle UserFinder,CommandRunner,RuncAdapter,RuncClient
+//go:generate go run -mod=vendor github.com/golang/mock/mockgen -copyright_file ./mock_lifecycle/header.txt -destination ./mock_lifecycle/mocks.go bpm/runc/lifecycle UserFinder,CommandRunner,RuncAdapter,RuncClient,SpecMutator,LogLimiter,ExecutableChecker,AdmissionController
 
 type UserFinder interface {
 	Lookup(username string) (specs.User, error)
 }
 
 type CommandRunner interface {
-	Run(*exec.Cmd) error
+	Run(context.Context, *exec.Cmd) error
 }
 
+// RuncAdapter turns the configuration of a process into what the runtime
+// needs to run it: the directories and log files on the host and the OCI
+// runtime specification of its container.
 type RuncAdapter interface {
-	CreateJobPrerequisites(bpmCfg *config.BPMConfig, procCfg *config.ProcessConfig, user specs.User) (*os.File, *os.File, error)
+	// CreateJobPrerequisites creates the directories which are mounted into
+	// the container of the process and opens its log files.
+	CreateJobPrerequisites(bpmCfg *config.BPMConfig, procCfg *config.ProcessConfig, user specs.User) (io.WriteCloser, io.WriteCloser, error)
+	// BuildSpec returns the OCI runtime specification of the container of
+	// the process.
 	BuildSpec(logger lager.Logger, bpmCfg *config.BPMConfig, procCfg *config.ProcessConfig, user specs.User) (specs.Spec, error)
 }
 
+// SpecMutator may adjust the spec built by the RuncAdapter before the bundle
+// is created from it.
+type SpecMutator interface {
+	MutateSpec(ctx context.Context, logger lager.Logger, bpmCfg *config.BPMConfig, procCfg *config.ProcessConfig, spec specs.Spec) (specs.Spec, error)
+}
+
+// ExecutableChecker checks that the executable of a process can be run inside
+// the container described by the final spec.
+type ExecutableChecker interface {
+	CheckExecutable(bpmCfg *config.BPMConfig, procCfg *config.ProcessConfig, spec specs.Spec) error
+}
+
+// AdmissionController decides whether a container may be created from the
+// final spec of a process.
+type AdmissionController interface {
+	Admit(ctx context.Context, logger lager.Logger, bpmCfg *config.BPMConfig, spec specs.Spec) error
+}
+
+// LogLimiter truncates overly long lines in the output of a process before
+// they reach its log files.
+type LogLimiter interface {
+	Relay(bpmCfg *config.BPMConfig, stream logsink.Stream) (*os.File, error)
+	Writer(w io.Writer) *loglimit.Truncator
+}
+
+// RuncClient is the runtime which bpm runs containers with. runc is the only
+// runtime which ships with bpm but any backend which implements this contract
+// can be used in its place. The conformance package contains specs which
+// check a backend against it.
+//
+// Containers are identified by the IDs which bpm gives them and are expected
+// to outlive the bpm command which started them.
 type RuncClient interface {
+	// CreateBundle writes jobSpec into a new OCI bundle at bundlePath
+	// (config.json and an empty rootfs directory) so that it can be run by
+	// RunContainer.
 	CreateBundle(bundlePath string, jobSpec specs.Spec, user specs.User) error
-	RunContainer(pidFilePath, bundlePath, containerID string, detach bool, stdout, stderr io.Writer) (int, error)
-	Exec(containerID, command string, stdin io.Reader, stdout, stderr io.Writer) error
-	ContainerState(containerID string) (*specs.State, error)
-	ListContainers() ([]client.ContainerState, error)
-	SignalContainer(containerID string, signal client.Signal) error
-	DeleteContainer(containerID string) error
+	// RunContainer creates and starts the container described by the bundle.
+	// If detach is set it returns once the process has started and has
+	// written its PID to pidFilePath. Otherwise it waits for the process to
+	// exit and returns its exit status.
+	RunContainer(ctx context.Context, pidFilePath, bundlePath, containerID string, detach bool, stdout, stderr io.Writer) (int, error)
+	// Exec runs process inside a running container and waits for it to exit.
+	// process is used as given rather than merged with the container's own.
+	Exec(ctx context.Context, containerID string, process specs.Process, stdin io.Reader, stdout, stderr io.Writer) error
+	// BundleSpec reads back the spec written by CreateBundle.
+	BundleSpec(bundlePath string) (*specs.Spec, error)
+	// ContainerState returns the state of a container, or nil and no error
+	// if it does not exist. A container whose process has exited keeps
+	// existing, with the status "stopped", until it is deleted.
+	ContainerState(ctx context.Context, containerID string) (*specs.State, error)
+	// ListContainers returns every container which exists.
+	ListContainers(ctx context.Context) ([]client.ContainerState, error)
+	// OOMKillCount returns how many processes in the container have been
+	// killed by the OOM killer.
+	OOMKillCount(containerID string) (uint64, error)
+	// CgroupLimits returns the limits which the kernel enforces on the
+	// cgroup of a container.
+	CgroupLimits(containerID string) (*models.CgroupLimits, error)
+	// Stats returns the current resource usage of a container.
+	Stats(ctx context.Context, containerID string) (*models.Stats, error)
+	// Events calls handle with the stats of a container every interval and
+	// whenever the OOM killer kills one of its processes. It returns nil
+	// once ctx is done.
+	Events(ctx context.Context, containerID string, interval time.Duration, handle func(models.Event)) error
+	// SignalContainer sends signal to the process of a container.
+	SignalContainer(ctx context.Context, containerID string, signal client.Signal) error
+	// PauseContainer freezes every process in a container.
+	PauseContainer(ctx context.Context, containerID string) error
+	// ResumeContainer thaws a container frozen by PauseContainer.
+	ResumeContainer(ctx context.Context, containerID string) error
+	// UpdateContainer changes the resource limits of a running container.
+	// Only the limits present in resources are changed.
+	UpdateContainer(ctx context.Context, containerID string, resources *specs.LinuxResources) error
+	// DeleteContainer removes a container, killing its processes if they
+	// are still running.
+	DeleteContainer(ctx context.Context, containerID string) error
+	// DestroyBundle removes a bundle. It succeeds if the bundle does not
+	// exist.
 	DestroyBundle(bundlePath string) error
 }
 
+var _ RuncClient = (*client.RuncClient)(nil)
+
 type RuncLifecycle struct {
 	clock         clock.Clock
 	commandRunner CommandRunner
@@ -85,6 +203,10 @@ type RuncLifecycle struct {
 	runcClient    RuncClient
 	userFinder    UserFinder
 	deleteFile    func(string) error
+	specMutator   SpecMutator
+	logLimiter    LogLimiter
+	execChecker   ExecutableChecker
+	admission     AdmissionController
 }
 
 func NewRuncLifecycle(
@@ -94,6 +216,10 @@ func NewRuncLifecycle(
 	commandRunner CommandRunner,
 	clock clock.Clock,
 	deleteFile func(string) error,
+	specMutator SpecMutator,
+	logLimiter LogLimiter,
+	execChecker ExecutableChecker,
+	admission AdmissionController,
 ) *RuncLifecycle {
 	return &RuncLifecycle{
 		clock:         clock,
@@ -102,98 +228,509 @@ func NewRuncLifecycle(
 		userFinder:    userFinder,
 		commandRunner: commandRunner,
 		deleteFile:    deleteFile,
+		specMutator:   specMutator,
+		logLimiter:    logLimiter,
+		execChecker:   execChecker,
+		admission:     admission,
 	}
 }
 
-func (j *RuncLifecycle) StartProcess(logger lager.Logger, bpmCfg *config.BPMConfig, procCfg *config.ProcessConfig) error {
+// StartProcess starts the process in a new container and returns once it is
+// running. If ctx is cancelled before then anything which was created for
+// the container is removed again.
+func (j *RuncLifecycle) StartProcess(ctx context.Context, logger lager.Logger, bpmCfg *config.BPMConfig, procCfg *config.ProcessConfig) error {
+	ctx, span := startSpan(ctx, "start-process", bpmCfg)
+	err := j.startProcess(ctx, logger, bpmCfg, procCfg)
+	span.End(err)
+	return err
+}
+
+func (j *RuncLifecycle) startProcess(ctx context.Context, logger lager.Logger, bpmCfg *config.BPMConfig, procCfg *config.ProcessConfig) error {
 	logger = logger.Session("start-process")
 	logger.Info("starting")
 	defer logger.Info("complete")
 
-	stdout, stderr, err := j.setupProcess(logger, bpmCfg, procCfg)
+	stdout, stderr, err := j.setupProcess(ctx, logger, bpmCfg, procCfg)
 	if err != nil {
+		j.abortIfCancelled(ctx, logger, bpmCfg)
 		return err
 	}
+
+	return j.runDetached(ctx, logger, bpmCfg, stdout, stderr)
+}
+
+// CanReuseBundle reports whether the bundle of a stopped process was built
+// from the same configuration as procCfg, so that ReviveProcess can start the
+// process from it.
+func (j *RuncLifecycle) CanReuseBundle(bpmCfg *config.BPMConfig, procCfg *config.ProcessConfig) bool {
+	checksum := procCfg.Checksum()
+	if checksum == "" {
+		return false
+	}
+
+	spec, err := j.runcClient.BundleSpec(bpmCfg.BundlePath())
+	if err != nil {
+		return false
+	}
+
+	return spec.Annotations[config.ConfigChecksumAnnotation] == checksum
+}
+
+// ReviveProcess starts a stopped process again from its existing bundle. Only
+// its container is deleted and created again, which skips building the spec
+// and the bundle. Callers should check CanReuseBundle first.
+func (j *RuncLifecycle) ReviveProcess(ctx context.Context, logger lager.Logger, bpmCfg *config.BPMConfig, procCfg *config.ProcessConfig) error {
+	ctx, span := startSpan(ctx, "revive-process", bpmCfg)
+	err := j.reviveProcess(ctx, logger, bpmCfg, procCfg)
+	span.End(err)
+	return err
+}
+
+func (j *RuncLifecycle) reviveProcess(ctx context.Context, logger lager.Logger, bpmCfg *config.BPMConfig, procCfg *config.ProcessConfig) error {
+	logger = logger.Session("revive-process")
+	logger.Info("starting")
+	defer logger.Info("complete")
+
+	spec, err := j.runcClient.BundleSpec(bpmCfg.BundlePath())
+	if err != nil {
+		return inPhase(PhaseBundleCreate, fmt.Errorf("failed to read bundle: %s", err))
+	}
+
+	// The policy may have changed since the bundle was admitted.
+	if err := j.admit(ctx, logger, bpmCfg, *spec); err != nil {
+		return inPhase(PhaseSpecBuild, err)
+	}
+
+	logger.Info("deleting-container")
+	if err := j.runcClient.DeleteContainer(ctx, bpmCfg.ContainerID()); err != nil {
+		return inPhase(PhaseRuncRun, err)
+	}
+
+	if err := j.deleteFile(reaper.ExitFile(bpmCfg.PidFile().External())); err != nil {
+		return inPhase(PhasePrerequisites, err)
+	}
+
+	if err := j.deleteFile(bpmCfg.PidFile().External()); err != nil {
+		return inPhase(PhasePrerequisites, err)
+	}
+
+	user, err := j.userFinder.Lookup(usertools.VcapUser)
+	if err != nil {
+		return inPhase(PhaseUserLookup, err)
+	}
+
+	logger.Info("creating-job-prerequisites")
+	stdout, stderr, err := j.runcAdapter.CreateJobPrerequisites(bpmCfg, procCfg, user)
+	if err != nil {
+		return inPhase(PhasePrerequisites, fmt.Errorf("failed to create system files: %s", err.Error()))
+	}
+
+	if err := j.runPreStart(ctx, logger, bpmCfg, procCfg, *spec, stdout, stderr); err != nil {
+		j.abortIfCancelled(ctx, logger, bpmCfg)
+		return inPhase(PhasePreStart, err)
+	}
+
+	return j.runDetached(ctx, logger, bpmCfg, stdout, stderr)
+}
+
+// runDetached runs the container of a process whose bundle has been created
+// in the background, retrying transient failures.
+func (j *RuncLifecycle) runDetached(ctx context.Context, logger lager.Logger, bpmCfg *config.BPMConfig, stdout, stderr io.WriteCloser) error {
+	var err error
+	if j.needsRelay(stdout, stderr) {
+		stdout, stderr, err = j.relayLogs(bpmCfg, stdout, stderr)
+		if err != nil {
+			logger.Error("failed-to-relay-logs", err)
+			return inPhase(PhasePrerequisites, err)
+		}
+	}
 	defer stdout.Close()
 	defer stderr.Close()
 
-	logger.Info("running-container")
-	_, err = j.runcClient.RunContainer(
-		bpmCfg.PidFile().External(),
-		bpmCfg.BundlePath(),
-		bpmCfg.ContainerID(),
-		true,
-		stdout,
-		stderr,
-	)
+	backoff := StartRetryInitialBackoff
+	for attempt := 1; ; attempt++ {
+		logger.Info("running-container", lager.Data{"attempt": attempt})
+		runCtx, span := startSpan(ctx, "runc-run", bpmCfg)
+		span.SetAttribute("bpm.attempt", attempt)
+		_, err = j.runcClient.RunContainer(
+			runCtx,
+			bpmCfg.PidFile().External(),
+			bpmCfg.BundlePath(),
+			bpmCfg.ContainerID(),
+			true,
+			stdout,
+			stderr,
+		)
+		span.End(err)
+		if err != nil && j.abortIfCancelled(ctx, logger, bpmCfg) {
+			return ctx.Err()
+		}
 
-	return err
+		if err == nil {
+			j.recordTimestamp(logger, bpmCfg, started)
+			return nil
+		}
+
+		failureLog := j.recordStartFailure(logger, bpmCfg, attempt, err)
+
+		if !client.IsTransient(err) || attempt >= StartRetryAttempts {
+			return &StartError{Phase: PhaseRuncRun, Err: err, Log: failureLog}
+		}
+
+		logger.Error("retrying-transient-failure", err, lager.Data{
+			"attempt": attempt,
+			"backoff": backoff.String(),
+		})
+
+		// runc may have got far enough to create the container before
+		// failing. It needs to be removed before we can try again.
+		if err := j.runcClient.DeleteContainer(ctx, bpmCfg.ContainerID()); err != nil {
+			logger.Error("failed-to-delete-container", err)
+		}
+
+		if err := j.sleep(ctx, backoff); err != nil {
+			j.abortIfCancelled(ctx, logger, bpmCfg)
+			return err
+		}
+		backoff *= 2
+	}
 }
 
-func (j *RuncLifecycle) RunProcess(logger lager.Logger, bpmCfg *config.BPMConfig, procCfg *config.ProcessConfig) (int, error) {
+// RunProcess runs the process in a new container and waits for it to exit. If
+// ctx is cancelled first then the container is killed and removed.
+func (j *RuncLifecycle) RunProcess(ctx context.Context, logger lager.Logger, bpmCfg *config.BPMConfig, procCfg *config.ProcessConfig) (int, error) {
 	logger = logger.Session("run-process")
 	logger.Info("starting")
 	defer logger.Info("complete")
 
-	stdout, stderr, err := j.setupProcess(logger, bpmCfg, procCfg)
+	stdout, stderr, err := j.setupProcess(ctx, logger, bpmCfg, procCfg)
 	if err != nil {
+		j.abortIfCancelled(ctx, logger, bpmCfg)
 		return 0, err
 	}
 	defer stdout.Close()
 	defer stderr.Close()
 
+	outWriter := io.MultiWriter(stdout, os.Stdout)
+	errWriter := io.MultiWriter(stderr, os.Stderr)
+	if j.logLimiter != nil {
+		out, errOut := j.logLimiter.Writer(outWriter), j.logLimiter.Writer(errWriter)
+		defer func() {
+			out.Close()
+			errOut.Close()
+			if n := out.Truncations() + errOut.Truncations(); n > 0 {
+				logger.Info("truncated-log-lines", lager.Data{"count": n})
+			}
+		}()
+		outWriter, errWriter = out, errOut
+	}
+
+	// runc does not return until the process exits when it is run in the
+	// foreground so the start time has to be recorded beforehand.
+	j.recordTimestamp(logger, bpmCfg, started)
+
 	logger.Info("running-container")
-	return j.runcClient.RunContainer(
+	status, err := j.runcClient.RunContainer(
+		ctx,
 		bpmCfg.PidFile().External(),
 		bpmCfg.BundlePath(),
 		bpmCfg.ContainerID(),
 		false,
-		io.MultiWriter(stdout, os.Stdout),
-		io.MultiWriter(stderr, os.Stderr),
+		outWriter,
+		errWriter,
 	)
+	if err != nil && j.abortIfCancelled(ctx, logger, bpmCfg) {
+		return status, ctx.Err()
+	}
+
+	// runc exits with the exit status of the process when it is run in the
+	// foreground so there is no need for the reaper.
+	if werr := reaper.WriteExitStatus(reaper.ExitFile(bpmCfg.PidFile().External()), status); werr != nil {
+		logger.Error("failed-to-record-exit-status", werr)
+	}
+
+	return status, err
 }
 
-func (j *RuncLifecycle) setupProcess(logger lager.Logger, bpmCfg *config.BPMConfig, procCfg *config.ProcessConfig) (io.WriteCloser, io.WriteCloser, error) {
-	user, err := j.userFinder.Lookup(usertools.VcapUser)
+// needsRelay reports whether the output of a process started in the
+// background has to be copied by a helper rather than written by the process
+// directly. This is the case when lines need to be limited or when the log
+// sink is not a plain file which runc can hand to the container.
+func (j *RuncLifecycle) needsRelay(stdout, stderr io.Writer) bool {
+	if j.logLimiter != nil {
+		return true
+	}
+
+	_, outDirect := logsink.Direct(stdout)
+	_, errDirect := logsink.Direct(stderr)
+	return !outDirect || !errDirect
+}
+
+// relayLogs replaces the log sinks of a process with pipes to helpers which
+// write to the sinks on its behalf, enforcing the log limits if there are
+// any. The sinks opened by bpm itself are closed.
+func (j *RuncLifecycle) relayLogs(bpmCfg *config.BPMConfig, stdout, stderr io.Closer) (io.WriteCloser, io.WriteCloser, error) {
+	stdout.Close()
+	stderr.Close()
+
+	relay := func(stream logsink.Stream) (*os.File, error) {
+		if j.logLimiter != nil {
+			return j.logLimiter.Relay(bpmCfg, stream)
+		}
+		return logsink.Relay(bpmCfg, stream, 0)
+	}
+
+	outRelay, err := relay(logsink.Stdout)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	errRelay, err := relay(logsink.Stderr)
 	if err != nil {
+		outRelay.Close()
 		return nil, nil, err
 	}
 
+	return outRelay, errRelay, nil
+}
+
+// abortIfCancelled removes the container, bundle, and PID file of a process
+// whose start was interrupted so that they are not left half created. It
+// reports whether ctx had been cancelled.
+func (j *RuncLifecycle) abortIfCancelled(ctx context.Context, logger lager.Logger, bpmCfg *config.BPMConfig) bool {
+	if ctx.Err() == nil {
+		return false
+	}
+
+	logger = logger.Session("aborting")
+	logger.Info("starting", lager.Data{"reason": ctx.Err().Error()})
+	defer logger.Info("complete")
+
+	// The original context is already done so a fresh one is needed for the
+	// cleanup to run at all.
+	cleanupCtx, cancel := cleanupContext()
+	defer cancel()
+
+	if err := j.runcClient.DeleteContainer(cleanupCtx, bpmCfg.ContainerID()); err != nil {
+		logger.Error("failed-to-delete-container", err)
+	}
+
+	if err := helpers.Stop(bpmCfg.HelpersDir().External(), HelperGrace); err != nil {
+		logger.Error("failed-to-stop-helpers", err)
+	}
+
+	if err := j.runcClient.DestroyBundle(bpmCfg.BundlePath()); err != nil {
+		logger.Error("failed-to-destroy-bundle", err)
+	}
+
+	if err := j.deleteFile(bpmCfg.PidFile().External()); err != nil {
+		logger.Error("failed-to-delete-pidfile", err)
+	}
+
+	return true
+}
+
+// cleanupContext returns a context for cleanup which must run to completion
+// even if bpm has been interrupted. It is only bounded by CleanupTimeout.
+func cleanupContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), CleanupTimeout)
+}
+
+// sleep waits for the duration to pass unless ctx is done first.
+func (j *RuncLifecycle) sleep(ctx context.Context, d time.Duration) error {
+	timer := j.clock.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C():
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (j *RuncLifecycle) setupProcess(ctx context.Context, logger lager.Logger, bpmCfg *config.BPMConfig, procCfg *config.ProcessConfig) (io.WriteCloser, io.WriteCloser, error) {
+	user, err := j.userFinder.Lookup(usertools.VcapUser)
+	if err != nil {
+		return nil, nil, inPhase(PhaseUserLookup, err)
+	}
+
 	logger.Info("creating-job-prerequisites")
+	_, span := startSpan(ctx, "create-job-prerequisites", bpmCfg)
 	stdout, stderr, err := j.runcAdapter.CreateJobPrerequisites(bpmCfg, procCfg, user)
+	span.End(err)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to create system files: %s", err.Error())
+		return nil, nil, inPhase(PhasePrerequisites, fmt.Errorf("failed to create system files: %s", err.Error()))
 	}
 
 	logger.Info("building-spec")
+	_, span = startSpan(ctx, "build-spec", bpmCfg)
 	spec, err := j.runcAdapter.BuildSpec(logger, bpmCfg, procCfg, user)
+	span.End(err)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, inPhase(PhaseSpecBuild, err)
+	}
+
+	if j.specMutator != nil {
+		logger.Info("mutating-spec")
+		spanCtx, span := startSpan(ctx, "mutate-spec", bpmCfg)
+		spec, err = j.specMutator.MutateSpec(spanCtx, logger, bpmCfg, procCfg, spec)
+		span.End(err)
+		if err != nil {
+			return nil, nil, inPhase(PhaseSpecBuild, err)
+		}
+	}
+
+	if j.execChecker != nil {
+		logger.Info("checking-executable")
+		_, span := startSpan(ctx, "check-executable", bpmCfg)
+		err := j.execChecker.CheckExecutable(bpmCfg, procCfg, spec)
+		span.End(err)
+		if err != nil {
+			return nil, nil, inPhase(PhaseSpecBuild, err)
+		}
+	}
+
+	if err := j.admit(ctx, logger, bpmCfg, spec); err != nil {
+		return nil, nil, inPhase(PhaseSpecBuild, err)
 	}
 
 	logger.Info("creating-bundle")
+	_, span = startSpan(ctx, "create-bundle", bpmCfg)
 	err = j.runcClient.CreateBundle(bpmCfg.BundlePath(), spec, user)
+	span.End(err)
 	if err != nil {
-		return nil, nil, fmt.Errorf("bundle build failure: %s", err.Error())
+		return nil, nil, inPhase(PhaseBundleCreate, fmt.Errorf("bundle build failure: %s", err.Error()))
+	}
+	j.recordTimestamp(logger, bpmCfg, created)
+
+	if err := j.runPreStart(ctx, logger, bpmCfg, procCfg, spec, stdout, stderr); err != nil {
+		return nil, nil, inPhase(PhasePreStart, err)
 	}
 
-	if procCfg.Hooks != nil {
+	return stdout, stderr, nil
+}
+
+// admit asks the admission controller, if there is one, whether a container
+// may be created from spec.
+func (j *RuncLifecycle) admit(ctx context.Context, logger lager.Logger, bpmCfg *config.BPMConfig, spec specs.Spec) error {
+	if j.admission == nil {
+		return nil
+	}
+
+	logger.Info("checking-admission")
+	ctx, span := startSpan(ctx, "check-admission", bpmCfg)
+	err := j.admission.Admit(ctx, logger, bpmCfg, spec)
+	span.End(err)
+	return err
+}
+
+// startSpan starts a tracing span for a step in the lifecycle of a process.
+func startSpan(ctx context.Context, name string, cfg *config.BPMConfig) (context.Context, *tracing.Span) {
+	ctx, span := tracing.Start(ctx, name)
+	span.SetAttribute("bpm.container_id", cfg.ContainerID())
+	return ctx, span
+}
+
+// runPreStart runs the pre_start hook of the process, if it has one. It runs
+// on the host with the environment of the container unless it has been asked
+// to run inside a container of its own.
+func (j *RuncLifecycle) runPreStart(ctx context.Context, logger lager.Logger, bpmCfg *config.BPMConfig, procCfg *config.ProcessConfig, spec specs.Spec, stdout, stderr io.Writer) error {
+	if procCfg.Hooks == nil || procCfg.Hooks.PreStart == "" {
+		return nil
+	}
+
+	ctx, span := tracing.Start(ctx, "pre-start-hook")
+	span.SetAttribute("bpm.hook", procCfg.Hooks.PreStart)
+
+	var err error
+	if procCfg.Hooks.PreStartInContainer {
+		err = j.runPreStartInContainer(ctx, logger, bpmCfg, procCfg, spec, stdout, stderr)
+	} else {
 		preStartCmd := exec.Command(procCfg.Hooks.PreStart)
 		preStartCmd.Env = spec.Process.Env
 		preStartCmd.Stdout = stdout
 		preStartCmd.Stderr = stderr
 
-		err := j.commandRunner.Run(preStartCmd)
-		if err != nil {
-			return nil, nil, fmt.Errorf("prestart hook failed: %s", err.Error())
-		}
+		err = j.commandRunner.Run(ctx, preStartCmd)
 	}
+	span.End(err)
 
-	return stdout, stderr, nil
+	if err != nil {
+		return fmt.Errorf("prestart hook failed: %s", err.Error())
+	}
+
+	return nil
+}
+
+// PreStartContainerSuffix is appended to the container ID of a process to
+// name the container which its pre_start hook runs in. Encoded job names never
+// contain it since "pr" is not a valid escape sequence.
+const PreStartContainerSuffix = ".pre-start"
+
+// runPreStartInContainer runs the pre_start hook in the foreground in a
+// container with the same spec as the process, so that it sees the same
+// mounts, user, and limits. The container shares the root filesystem of the
+// process's bundle but is given its own cgroup, and OCI hooks are not run for
+// it so that they only run once for the process.
+func (j *RuncLifecycle) runPreStartInContainer(ctx context.Context, logger lager.Logger, bpmCfg *config.BPMConfig, procCfg *config.ProcessConfig, spec specs.Spec, stdout, stderr io.Writer) error {
+	logger = logger.Session("pre-start-in-container")
+	logger.Info("starting")
+	defer logger.Info("complete")
+
+	process := *spec.Process
+	process.Args = []string{procCfg.Hooks.PreStart}
+	process.Terminal = false
+	spec.Process = &process
+	spec.Hooks = nil
+
+	if spec.Linux != nil {
+		linux := *spec.Linux
+		linux.CgroupsPath = ""
+		spec.Linux = &linux
+	}
+
+	user, err := j.userFinder.Lookup(usertools.VcapUser)
+	if err != nil {
+		return err
+	}
+
+	bundlePath := filepath.Join(bpmCfg.BundlePath(), "pre-start")
+	containerID := bpmCfg.ContainerID() + PreStartContainerSuffix
+
+	if err := j.runcClient.CreateBundle(bundlePath, spec, user); err != nil {
+		return fmt.Errorf("failed to create pre-start bundle: %s", err)
+	}
+
+	defer func() {
+		cleanupCtx, cancel := cleanupContext()
+		defer cancel()
+
+		if err := j.runcClient.DeleteContainer(cleanupCtx, containerID); err != nil {
+			logger.Error("failed-to-delete-container", err)
+		}
+
+		if err := j.runcClient.DestroyBundle(bundlePath); err != nil {
+			logger.Error("failed-to-destroy-bundle", err)
+		}
+	}()
+
+	_, err = j.runcClient.RunContainer(
+		ctx,
+		filepath.Join(bundlePath, "pid"),
+		bundlePath,
+		containerID,
+		false,
+		stdout,
+		stderr,
+	)
+	return err
 }
 
-func (j *RuncLifecycle) StatProcess(cfg *config.BPMConfig) (*models.Process, error) {
-	container, err := j.runcClient.ContainerState(cfg.ContainerID())
+func (j *RuncLifecycle) StatProcess(ctx context.Context, cfg *config.BPMConfig) (*models.Process, error) {
+	ctx, span := startSpan(ctx, "runc-state", cfg)
+	container, err := j.runcClient.ContainerState(ctx, cfg.ContainerID())
+	span.End(err)
 	if err != nil {
 		return nil, err
 	}
@@ -202,42 +739,331 @@ func (j *RuncLifecycle) StatProcess(cfg *config.BPMConfig) (*models.Process, err
 		return nil, isNotExistError
 	}
 
-	return newProcessFromContainerState(
+	process := newProcessFromContainerState(
 		container.ID,
 		container.Status,
 		container.Pid,
-	), nil
+		container.Annotations,
+	)
+	process.OOMKilled = j.oomKilled(container.ID)
+	ApplyExitStatus(cfg, process)
+	ApplyTimestamps(cfg, process)
+
+	return process, nil
 }
 
-func (j *RuncLifecycle) OpenShell(cfg *config.BPMConfig, stdin io.Reader, stdout, stderr io.Writer) error {
-	return j.runcClient.Exec(cfg.ContainerID(), "/bin/bash", stdin, stdout, stderr)
+// ProcessStats returns the resource usage of a running process.
+func (j *RuncLifecycle) ProcessStats(ctx context.Context, cfg *config.BPMConfig) (*models.Stats, error) {
+	if err := j.checkRunning(ctx, cfg); err != nil {
+		return nil, err
+	}
+
+	return j.runcClient.Stats(ctx, cfg.ContainerID())
+}
+
+// CheckLimits compares the resource and cgroup limits which a running process
+// actually has with the limits in the spec it was started with.
+func (j *RuncLifecycle) CheckLimits(ctx context.Context, cfg *config.BPMConfig) ([]models.LimitCheck, error) {
+	state, err := j.runcClient.ContainerState(ctx, cfg.ContainerID())
+	if err != nil {
+		return nil, err
+	}
+
+	if state == nil || state.Status != specs.StateRunning {
+		return nil, isNotExistError
+	}
+
+	spec, err := j.runcClient.BundleSpec(cfg.BundlePath())
+	if err != nil {
+		return nil, err
+	}
+
+	cgroupLimits, err := j.runcClient.CgroupLimits(cfg.ContainerID())
+	if err != nil {
+		return nil, err
+	}
+
+	rlimits, err := limitcheck.ReadProcLimits(state.Pid)
+	if err != nil {
+		return nil, err
+	}
+
+	return limitcheck.Compare(spec, rlimits, cgroupLimits), nil
+}
+
+// CheckPorts reports whether a running process, or any of its descendants, is
+// listening on each of the given ports.
+func (j *RuncLifecycle) CheckPorts(ctx context.Context, cfg *config.BPMConfig, ports []config.Port) ([]models.PortCheck, error) {
+	state, err := j.runcClient.ContainerState(ctx, cfg.ContainerID())
+	if err != nil {
+		return nil, err
+	}
+
+	if state == nil || state.Status != specs.StateRunning {
+		return nil, isNotExistError
+	}
+
+	listening, err := portcheck.Listening(state.Pid)
+	if err != nil {
+		return nil, err
+	}
+
+	checks := make([]models.PortCheck, 0, len(ports))
+	for _, port := range ports {
+		checks = append(checks, models.PortCheck{
+			Port:      port.String(),
+			Listening: listening[port.String()],
+		})
+	}
+
+	return checks, nil
+}
+
+// ProcessEvents calls handle with each event which happens to a running
+// process, and with its stats every interval, until ctx is done or the
+// process stops.
+func (j *RuncLifecycle) ProcessEvents(ctx context.Context, cfg *config.BPMConfig, interval time.Duration, handle func(models.Event)) error {
+	if err := j.checkRunning(ctx, cfg); err != nil {
+		return err
+	}
+
+	return j.runcClient.Events(ctx, cfg.ContainerID(), interval, handle)
+}
+
+func (j *RuncLifecycle) checkRunning(ctx context.Context, cfg *config.BPMConfig) error {
+	state, err := j.runcClient.ContainerState(ctx, cfg.ContainerID())
+	if err != nil {
+		return err
+	}
+
+	if state == nil || state.Status != specs.StateRunning {
+		return isNotExistError
+	}
+
+	return nil
+}
+
+// ApplyExitStatus adds the exit status and termination message of a process
+// whose container has stopped if they were recorded. A process which exited
+// successfully is marked as exited rather than failed. A process which was
+// stopped by bpm with its container preserved is marked as such instead; its
+// exit status only reflects how it was stopped.
+func ApplyExitStatus(cfg *config.BPMConfig, process *models.Process) {
+	if process.Status != models.ProcessStateFailed {
+		return
+	}
+
+	process.TerminationMessage = ReadTerminationLog(cfg)
+
+	if IsPreserved(cfg) {
+		process.Status = models.ProcessStatePreserved
+		return
+	}
+
+	status, err := reaper.ReadExitStatus(reaper.ExitFile(cfg.PidFile().External()))
+	if err != nil {
+		return
+	}
+
+	process.ExitStatus = &status
+	if status == 0 {
+		process.Status = models.ProcessStateExited
+	}
+}
+
+// MaxTerminationMessageLength is the number of bytes of a termination log
+// which are kept. The log is meant for a short human-readable reason, not for
+// output which belongs in the process's log files.
+const MaxTerminationMessageLength = 4096
+
+// ReadTerminationLog returns the message which the process left in its
+// termination log, or an empty string if it has no termination log.
+func ReadTerminationLog(cfg *config.BPMConfig) string {
+	f, err := os.Open(cfg.TerminationLog().External())
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	message, err := ioutil.ReadAll(io.LimitReader(f, MaxTerminationMessageLength))
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(string(message))
+}
+
+// ExecOptions alters how a process is executed inside a running container.
+type ExecOptions struct {
+	// CleanEnv starts the process with an empty environment (apart from
+	// TERM) rather than the environment of the job's process.
+	CleanEnv bool
+
+	// TTY allocates a pseudo-terminal for the process.
+	TTY bool
+
+	// Cwd runs the process in another working directory inside the
+	// container.
+	Cwd string
+
+	// Env are NAME=VALUE pairs which are added to the environment of the
+	// process, replacing any variables which have the same name.
+	Env []string
+
+	// User runs the process as another user.
+	User *specs.User
+}
+
+// OpenShell starts an interactive shell inside the container of a running
+// job. The best shell available in the container is used.
+func (j *RuncLifecycle) OpenShell(ctx context.Context, cfg *config.BPMConfig, opts ExecOptions, stdin io.Reader, stdout, stderr io.Writer) error {
+	state, err := j.runcClient.ContainerState(ctx, cfg.ContainerID())
+	if err != nil {
+		return err
+	}
+	if state == nil {
+		return isNotExistError
+	}
+
+	// The root of the container's mount namespace is visible through its
+	// init process. This lets us look for a shell from the host.
+	shell, err := FindShell(filepath.Join("/proc", strconv.Itoa(state.Pid), "root"))
+	if err != nil {
+		return err
+	}
+
+	opts.TTY = true
+	return j.ExecProcess(ctx, cfg, shell, opts, stdin, stdout, stderr)
+}
+
+// shellCandidates are the shells which OpenShell will use, in order of
+// preference, along with the arguments needed to start them.
+var shellCandidates = [][]string{
+	{"/bin/bash"},
+	{"/bin/sh"},
+	{"/bin/busybox", "sh"},
+}
+
+// FindShell returns the command line of the first shell which exists in the
+// filesystem at root.
+func FindShell(root string) ([]string, error) {
+	var tried []string
+	for _, candidate := range shellCandidates {
+		info, err := os.Stat(filepath.Join(root, candidate[0]))
+		if err == nil && info.Mode().IsRegular() && info.Mode()&0111 != 0 {
+			return candidate, nil
+		}
+
+		tried = append(tried, candidate[0])
+	}
+
+	return nil, fmt.Errorf("no shell found in the container (tried %s)", strings.Join(tried, ", "))
 }
 
-func (j *RuncLifecycle) ListProcesses() ([]*models.Process, error) {
-	containers, err := j.runcClient.ListContainers()
+// ExecProcess runs a command inside the container of a running job. The
+// command inherits the environment, user, and working directory which the
+// job's process was started with unless opts says otherwise.
+func (j *RuncLifecycle) ExecProcess(ctx context.Context, cfg *config.BPMConfig, args []string, opts ExecOptions, stdin io.Reader, stdout, stderr io.Writer) error {
+	spec, err := j.runcClient.BundleSpec(cfg.BundlePath())
+	if err != nil {
+		return fmt.Errorf("failed to read container configuration: %s", err.Error())
+	}
+
+	process := *spec.Process
+	process.Args = args
+	process.Terminal = opts.TTY
+
+	var env []string
+	if !opts.CleanEnv {
+		env = append(env, spec.Process.Env...)
+	}
+	if term, ok := os.LookupEnv("TERM"); ok {
+		env = append(env, fmt.Sprintf("TERM=%s", term))
+	}
+	process.Env = overrideEnv(env, opts.Env)
+
+	if opts.Cwd != "" {
+		process.Cwd = opts.Cwd
+	}
+
+	if opts.User != nil {
+		process.User = *opts.User
+	}
+
+	return j.runcClient.Exec(ctx, cfg.ContainerID(), process, stdin, stdout, stderr)
+}
+
+// overrideEnv adds the variables in extra to env, removing any earlier
+// variables with the same names.
+func overrideEnv(env, extra []string) []string {
+	if len(extra) == 0 {
+		return env
+	}
+
+	overridden := map[string]bool{}
+	for _, kv := range extra {
+		overridden[strings.SplitN(kv, "=", 2)[0]] = true
+	}
+
+	var result []string
+	for _, kv := range env {
+		if !overridden[strings.SplitN(kv, "=", 2)[0]] {
+			result = append(result, kv)
+		}
+	}
+
+	return append(result, extra...)
+}
+
+// ProcessEnvironment returns the environment which the job's process was
+// started with.
+func (j *RuncLifecycle) ProcessEnvironment(cfg *config.BPMConfig) ([]string, error) {
+	spec, err := j.runcClient.BundleSpec(cfg.BundlePath())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read container configuration: %s", err.Error())
+	}
+
+	return spec.Process.Env, nil
+}
+
+func (j *RuncLifecycle) ListProcesses(ctx context.Context) ([]*models.Process, error) {
+	ctx, span := tracing.Start(ctx, "runc-list")
+	containers, err := j.runcClient.ListContainers(ctx)
+	span.End(err)
 	if err != nil {
 		return nil, err
 	}
 
 	var processes []*models.Process
 	for _, c := range containers {
-		processes = append(processes, newProcessFromContainerState(
+		process := newProcessFromContainerState(
 			c.ID,
 			containerStateFromString(c.Status),
 			c.InitProcessPid,
-		))
+			c.Annotations,
+		)
+		process.OOMKilled = j.oomKilled(c.ID)
+
+		processes = append(processes, process)
 	}
 
 	return processes, nil
 }
 
-func (j *RuncLifecycle) StopProcess(logger lager.Logger, cfg *config.BPMConfig, exitTimeout time.Duration) error {
-	err := j.runcClient.SignalContainer(cfg.ContainerID(), client.Term)
+func (j *RuncLifecycle) StopProcess(ctx context.Context, logger lager.Logger, cfg *config.BPMConfig, exitTimeout time.Duration) error {
+	ctx, span := startSpan(ctx, "stop-process", cfg)
+	err := j.stopProcess(ctx, logger, cfg, exitTimeout)
+	span.End(err)
+	return err
+}
+
+func (j *RuncLifecycle) stopProcess(ctx context.Context, logger lager.Logger, cfg *config.BPMConfig, exitTimeout time.Duration) error {
+	err := j.runcClient.SignalContainer(ctx, cfg.ContainerID(), client.Term)
 	if err != nil {
 		return err
 	}
 
-	state, err := j.runcClient.ContainerState(cfg.ContainerID())
+	state, err := j.runcClient.ContainerState(ctx, cfg.ContainerID())
 	if err != nil {
 		logger.Error("failed-to-fetch-state", err)
 	} else {
@@ -253,7 +1079,7 @@ func (j *RuncLifecycle) StopProcess(logger lager.Logger, cfg *config.BPMConfig,
 	for {
 		select {
 		case <-stateTicker.C():
-			state, err = j.runcClient.ContainerState(cfg.ContainerID())
+			state, err = j.runcClient.ContainerState(ctx, cfg.ContainerID())
 			if err != nil {
 				logger.Error("failed-to-fetch-state", err)
 			} else {
@@ -262,20 +1088,154 @@ func (j *RuncLifecycle) StopProcess(logger lager.Logger, cfg *config.BPMConfig,
 				}
 			}
 		case <-timeout.C():
-			err := j.runcClient.SignalContainer(cfg.ContainerID(), client.Quit)
+			err := j.runcClient.SignalContainer(ctx, cfg.ContainerID(), client.Quit)
 			if err != nil {
 				logger.Error("failed-to-sigquit", err)
 			}
 
-			j.clock.Sleep(ContainerSigQuitGracePeriod)
+			if err := j.sleep(ctx, ContainerSigQuitGracePeriod); err != nil {
+				return err
+			}
 			return timeoutError
+		case <-ctx.Done():
+			// The process has already been asked to stop. Rather than
+			// leave it to shut down on its own after bpm has gone, it
+			// is killed so that the stop can be finished.
+			logger.Info("interrupted-killing-container")
+			cleanupCtx, cancel := cleanupContext()
+			defer cancel()
+
+			if err := j.runcClient.SignalContainer(cleanupCtx, cfg.ContainerID(), client.Kill); err != nil {
+				logger.Error("failed-to-sigkill", err)
+			}
+			return ctx.Err()
 		}
 	}
 }
 
-func (j *RuncLifecycle) RemoveProcess(logger lager.Logger, cfg *config.BPMConfig) error {
+// SignalProcess sends a signal to the job's process.
+func (j *RuncLifecycle) SignalProcess(ctx context.Context, logger lager.Logger, cfg *config.BPMConfig, signal client.Signal) error {
+	logger.Info("signalling-container", lager.Data{"signal": signal.String()})
+	return j.runcClient.SignalContainer(ctx, cfg.ContainerID(), signal)
+}
+
+// PauseProcess freezes every process in the job's container for the given
+// duration before thawing them again. The container is thawed early if ctx
+// is cancelled.
+func (j *RuncLifecycle) PauseProcess(ctx context.Context, logger lager.Logger, cfg *config.BPMConfig, duration time.Duration) error {
+	logger.Info("pausing-container", lager.Data{"duration": duration.String()})
+	if err := j.runcClient.PauseContainer(ctx, cfg.ContainerID()); err != nil {
+		return err
+	}
+
+	interrupted := j.sleep(ctx, duration)
+
+	if err := j.ThawProcess(logger, cfg); err != nil {
+		return err
+	}
+
+	return interrupted
+}
+
+// FreezeProcess freezes every process in the job's container until
+// ThawProcess is called.
+func (j *RuncLifecycle) FreezeProcess(ctx context.Context, logger lager.Logger, cfg *config.BPMConfig) error {
+	logger.Info("pausing-container")
+	return j.runcClient.PauseContainer(ctx, cfg.ContainerID())
+}
+
+// ThawProcess resumes the processes in a container which has been frozen. It
+// is not cancellable so that a container is never left frozen by an
+// interrupted bpm.
+func (j *RuncLifecycle) ThawProcess(logger lager.Logger, cfg *config.BPMConfig) error {
+	logger.Info("resuming-container")
+	return j.runcClient.ResumeContainer(context.Background(), cfg.ContainerID())
+}
+
+// RunBackupHook runs a pre_backup or post_backup hook of a running process.
+// Like the pre_start hook it runs on the host with the environment of the
+// process's container.
+func (j *RuncLifecycle) RunBackupHook(ctx context.Context, logger lager.Logger, cfg *config.BPMConfig, hook string, stdout, stderr io.Writer) error {
+	env, err := j.ProcessEnvironment(cfg)
+	if err != nil {
+		return err
+	}
+
+	logger.Info("running-backup-hook", lager.Data{"hook": hook})
+
+	ctx, span := tracing.Start(ctx, "backup-hook")
+	span.SetAttribute("bpm.hook", hook)
+
+	cmd := exec.Command(hook)
+	cmd.Env = env
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	err = j.commandRunner.Run(ctx, cmd)
+	span.End(err)
+
+	return err
+}
+
+// ThrottleProcess restricts the job's container to a tiny fraction of a CPU
+// for the given duration before restoring the CPU limits which the container
+// was started with. The limits are restored early if ctx is cancelled.
+func (j *RuncLifecycle) ThrottleProcess(ctx context.Context, logger lager.Logger, cfg *config.BPMConfig, duration time.Duration) error {
+	spec, err := j.runcClient.BundleSpec(cfg.BundlePath())
+	if err != nil {
+		return fmt.Errorf("failed to read container configuration: %s", err.Error())
+	}
+
+	var original specs.LinuxCPU
+	if spec.Linux != nil && spec.Linux.Resources != nil && spec.Linux.Resources.CPU != nil {
+		original = *spec.Linux.Resources.CPU
+	}
+	if original.Quota == nil {
+		unlimited := int64(-1)
+		original.Quota = &unlimited
+	}
+
+	period, quota := uint64(ChaosThrottlePeriod), int64(ChaosThrottleQuota)
+	throttled := &specs.LinuxCPU{Period: &period, Quota: &quota}
+
+	logger.Info("throttling-container", lager.Data{"duration": duration.String()})
+	if err := j.runcClient.UpdateContainer(ctx, cfg.ContainerID(), &specs.LinuxResources{CPU: throttled}); err != nil {
+		return err
+	}
+
+	interrupted := j.sleep(ctx, duration)
+
+	logger.Info("restoring-container-cpu-limits")
+	if err := j.runcClient.UpdateContainer(context.Background(), cfg.ContainerID(), &specs.LinuxResources{CPU: &original}); err != nil {
+		return err
+	}
+
+	return interrupted
+}
+
+// RemoveProcess deletes the container of a process along with its bundle and
+// files. It runs to completion even if ctx has already been cancelled so that
+// an interrupted stop does not leave a half removed container behind.
+func (j *RuncLifecycle) RemoveProcess(ctx context.Context, logger lager.Logger, cfg *config.BPMConfig) error {
+	// ctx only carries the tracing span: the removal itself runs with a
+	// fresh context.
+	_, span := startSpan(ctx, "remove-process", cfg)
+	err := j.removeProcess(logger, cfg)
+	span.End(err)
+	return err
+}
+
+func (j *RuncLifecycle) removeProcess(logger lager.Logger, cfg *config.BPMConfig) error {
+	ctx, cancel := cleanupContext()
+	defer cancel()
+
 	logger.Info("forcefully-deleting-container")
-	if err := j.runcClient.DeleteContainer(cfg.ContainerID()); err != nil {
+	if err := j.runcClient.DeleteContainer(ctx, cfg.ContainerID()); err != nil {
+		return err
+	}
+
+	logger.Info("stopping-helpers")
+	if err := helpers.Stop(cfg.HelpersDir().External(), HelperGrace); err != nil {
 		return err
 	}
 
@@ -284,22 +1244,59 @@ func (j *RuncLifecycle) RemoveProcess(logger lager.Logger, cfg *config.BPMConfig
 		return err
 	}
 
+	logger.Info("deleting-exit-file")
+	if err := j.deleteFile(reaper.ExitFile(cfg.PidFile().External())); err != nil {
+		return err
+	}
+
 	logger.Info("deleting-pidfile")
 	return j.deleteFile(cfg.PidFile().External())
 }
 
-func newProcessFromContainerState(id string, status specs.ContainerState, pid int) *models.Process {
+// oomKilled reports whether the OOM killer has killed any process in the
+// container. The kernel only exposes this through the container's cgroup so
+// it is best effort: a container whose cgroup cannot be read is reported as
+// not having been killed.
+func (j *RuncLifecycle) oomKilled(containerID string) bool {
+	count, err := j.runcClient.OOMKillCount(containerID)
+	return err == nil && count > 0
+}
+
+func newProcessFromContainerState(id string, status specs.ContainerState, pid int, annotations map[string]string) *models.Process {
 	return &models.Process{
 		Name:   id,
 		Pid:    pid,
 		Status: containerStateToString(status),
+		Labels: annotations,
+
+		CgroupPath: annotations[config.CgroupPathAnnotation],
 	}
 }
 
 type commandRunner struct{}
 
-func NewCommandRunner() CommandRunner          { return &commandRunner{} }
-func (*commandRunner) Run(cmd *exec.Cmd) error { return cmd.Run() }
+func NewCommandRunner() CommandRunner { return &commandRunner{} }
+
+// Run runs the command, killing it if ctx is done before it exits.
+func (*commandRunner) Run(ctx context.Context, cmd *exec.Cmd) error {
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	waitErr := make(chan error, 1)
+	go func() {
+		waitErr <- cmd.Wait()
+	}()
+
+	select {
+	case err := <-waitErr:
+		return err
+	case <-ctx.Done():
+		cmd.Process.Kill()
+		<-waitErr
+		return ctx.Err()
+	}
+}
 
 func containerStateToString(cs specs.ContainerState) string {
 	switch cs {
@@ -16,12 +16,19 @@
 package lifecycle_test
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 	"time"
 
 	specs "github.com/opencontainers/runtime-spec/specs-go"
@@ -38,12 +45,27 @@ import (
 	"bpm/bosh"
 	"bpm/config"
 	"bpm/jobid"
+	"bpm/loglimit"
+	"bpm/logsink"
 	"bpm/models"
+	"bpm/reaper"
 	"bpm/runc/client"
 	"bpm/runc/lifecycle"
 	"bpm/runc/lifecycle/mock_lifecycle"
+	"bpm/tracing"
 )
 
+// closeRecorder stands in for a log sink which is not a file.
+type closeRecorder struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (c *closeRecorder) Close() error {
+	c.closed = true
+	return nil
+}
+
 var _ = Describe("RuncJobLifecycle", func() {
 	var (
 		mockCtrl *gomock.Controller
@@ -55,6 +77,7 @@ var _ = Describe("RuncJobLifecycle", func() {
 		fakeFileRemover   *fileRemover
 
 		logger *lagertest.TestLogger
+		ctx    context.Context
 
 		bpmCfg  *config.BPMConfig
 		procCfg *config.ProcessConfig
@@ -87,6 +110,7 @@ var _ = Describe("RuncJobLifecycle", func() {
 		fakeFileRemover = &fileRemover{}
 
 		logger = lagertest.NewTestLogger("lifecycle")
+		ctx = context.Background()
 
 		expectedUser = specs.User{Username: "vcap", UID: 300, GID: 400}
 
@@ -119,6 +143,10 @@ var _ = Describe("RuncJobLifecycle", func() {
 			fakeCommandRunner,
 			fakeClock,
 			fakeFileRemover.Remove,
+			nil,
+			nil,
+			nil,
+			nil,
 		)
 		bpmCfg = config.NewBPMConfig(boshEnv, expectedJobName, expectedProcName)
 	})
@@ -162,12 +190,12 @@ var _ = Describe("RuncJobLifecycle", func() {
 
 		fakeRuncClient.
 			EXPECT().
-			RunContainer(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+			RunContainer(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
 			AnyTimes()
 
 		fakeRuncClient.
 			EXPECT().
-			DeleteContainer(gomock.Any()).
+			DeleteContainer(gomock.Any(), gomock.Any()).
 			AnyTimes()
 
 		fakeRuncClient.
@@ -177,7 +205,13 @@ var _ = Describe("RuncJobLifecycle", func() {
 
 		fakeCommandRunner.
 			EXPECT().
-			Run(gomock.Any()).
+			Run(gomock.Any(), gomock.Any()).
+			AnyTimes()
+
+		fakeRuncClient.
+			EXPECT().
+			OOMKillCount(gomock.Any()).
+			Return(uint64(0), nil).
 			AnyTimes()
 	}
 
@@ -197,7 +231,7 @@ var _ = Describe("RuncJobLifecycle", func() {
 
 				fakeCommandRunner.
 					EXPECT().
-					Run(expectedCommand).
+					Run(gomock.Any(), expectedCommand).
 					Times(1)
 
 				err := run(logger, bpmCfg, procCfg)
@@ -208,7 +242,7 @@ var _ = Describe("RuncJobLifecycle", func() {
 				BeforeEach(func() {
 					fakeCommandRunner.
 						EXPECT().
-						Run(gomock.Any()).
+						Run(gomock.Any(), gomock.Any()).
 						Return(errors.New("fake test error")).
 						Times(1)
 				})
@@ -220,6 +254,67 @@ var _ = Describe("RuncJobLifecycle", func() {
 			})
 		})
 
+		Context("when the PreStart Hook runs in the container", func() {
+			BeforeEach(func() {
+				procCfg.Hooks = &config.Hooks{
+					PreStart:            "/please/execute/me",
+					PreStartInContainer: true,
+				}
+				jobSpec.Linux = &specs.Linux{CgroupsPath: "/bpm/example"}
+				jobSpec.Hooks = &specs.Hooks{Prestart: []specs.Hook{{Path: "/bin/cni"}}}
+			})
+
+			It("runs the hook in a container with the process's spec", func() {
+				hookBundle := filepath.Join(bpmCfg.BundlePath(), "pre-start")
+				hookID := bpmCfg.ContainerID() + lifecycle.PreStartContainerSuffix
+
+				hookSpec := jobSpec
+				hookSpec.Process = &specs.Process{Env: []string{"foo=bar"}, Args: []string{"/please/execute/me"}}
+				hookSpec.Linux = &specs.Linux{}
+				hookSpec.Hooks = nil
+
+				gomock.InOrder(
+					fakeRuncClient.
+						EXPECT().
+						CreateBundle(hookBundle, hookSpec, expectedUser).
+						Times(1),
+					fakeRuncClient.
+						EXPECT().
+						RunContainer(gomock.Any(), gomock.Any(), hookBundle, hookID, false, expectedStdout, expectedStderr).
+						Times(1),
+					fakeRuncClient.
+						EXPECT().
+						DeleteContainer(gomock.Any(), hookID).
+						Times(1),
+					fakeRuncClient.
+						EXPECT().
+						DestroyBundle(hookBundle).
+						Times(1),
+				)
+				fakeCommandRunner.EXPECT().Run(gomock.Any(), gomock.Any()).Times(0)
+
+				err := run(logger, bpmCfg, procCfg)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(jobSpec.Linux.CgroupsPath).To(Equal("/bpm/example"))
+			})
+
+			Context("when the hook fails", func() {
+				BeforeEach(func() {
+					fakeRuncClient.
+						EXPECT().
+						RunContainer(gomock.Any(), gomock.Any(), gomock.Any(), bpmCfg.ContainerID()+lifecycle.PreStartContainerSuffix, false, gomock.Any(), gomock.Any()).
+						Return(3, errors.New("exit status 3")).
+						Times(1)
+				})
+
+				It("returns an error", func() {
+					err := run(logger, bpmCfg, procCfg)
+					Expect(err).To(MatchError("prestart hook failed: exit status 3"))
+					Expect(lifecycle.StartPhase(err)).To(Equal(lifecycle.PhasePreStart))
+				})
+			})
+		})
+
 		Context("when PreStart Hook is empty", func() {
 			BeforeEach(func() {
 				procCfg.Hooks = &config.Hooks{
@@ -239,7 +334,7 @@ var _ = Describe("RuncJobLifecycle", func() {
 
 				fakeRuncClient.
 					EXPECT().
-					RunContainer(gomock.Any(), gomock.Any(), jobid.Encode(expectedJobName), gomock.Any(), gomock.Any(), gomock.Any()).
+					RunContainer(gomock.Any(), gomock.Any(), gomock.Any(), jobid.Encode(expectedJobName), gomock.Any(), gomock.Any(), gomock.Any()).
 					Times(1)
 			})
 
@@ -331,6 +426,7 @@ var _ = Describe("RuncJobLifecycle", func() {
 			fakeRuncClient.
 				EXPECT().
 				RunContainer(
+					gomock.Any(),
 					bpmCfg.PidFile().External(),
 					rootPath,
 					expectedContainerID,
@@ -342,201 +438,831 @@ var _ = Describe("RuncJobLifecycle", func() {
 
 			setupMockDefaults()
 
-			err := runcLifecycle.StartProcess(logger, bpmCfg, procCfg)
+			err := runcLifecycle.StartProcess(ctx, logger, bpmCfg, procCfg)
 			Expect(err).NotTo(HaveOccurred())
 		})
 
-		Context("when running the container fails", func() {
+		Context("when the bundle can be written to", func() {
+			var root string
+
 			BeforeEach(func() {
+				var err error
+				root, err = ioutil.TempDir("", "lifecycle")
+				Expect(err).NotTo(HaveOccurred())
+
+				bpmCfg = config.NewBPMConfig(bosh.NewEnv(root), expectedJobName, expectedProcName)
+				Expect(os.MkdirAll(bpmCfg.BundlePath(), 0700)).To(Succeed())
+			})
+
+			AfterEach(func() {
+				Expect(os.RemoveAll(root)).To(Succeed())
+			})
+
+			It("records when the container was created and the process was started", func() {
+				createdAt := fakeClock.Now()
 				fakeRuncClient.
 					EXPECT().
-					RunContainer(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
-					Return(1, errors.New("fake test error"))
-			})
+					RunContainer(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+					DoAndReturn(func(context.Context, string, string, string, bool, io.Writer, io.Writer) (int, error) {
+						fakeClock.Increment(time.Second)
+						return 0, nil
+					})
+				fakeRuncClient.
+					EXPECT().
+					ContainerState(gomock.Any(), expectedContainerID).
+					Return(&specs.State{ID: expectedContainerID, Pid: 1234, Status: "running"}, nil)
 
-			It("returns an error", func() {
 				setupMockDefaults()
+				Expect(runcLifecycle.StartProcess(ctx, logger, bpmCfg, procCfg)).To(Succeed())
 
-				err := runcLifecycle.StartProcess(logger, bpmCfg, procCfg)
-				Expect(err).To(HaveOccurred())
+				process, err := runcLifecycle.StatProcess(ctx, bpmCfg)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(process.CreatedAt).To(BeTemporally("==", createdAt))
+				Expect(process.StartedAt).To(BeTemporally("==", createdAt.Add(time.Second)))
 			})
 		})
 
-		ItSetsUpAndRunsAProcess(func(logger lager.Logger, bpmCfg *config.BPMConfig, procCfg *config.ProcessConfig) error {
-			setupMockDefaults()
+		Context("when a log limiter is configured", func() {
+			var (
+				fakeLogLimiter           *mock_lifecycle.MockLogLimiter
+				stdoutRelay, stderrRelay *os.File
+			)
 
-			return runcLifecycle.StartProcess(logger, bpmCfg, procCfg)
-		})
-	})
+			BeforeEach(func() {
+				var err error
+				stdoutRelay, err = ioutil.TempFile("", "stdout-relay")
+				Expect(err).NotTo(HaveOccurred())
+				stderrRelay, err = ioutil.TempFile("", "stderr-relay")
+				Expect(err).NotTo(HaveOccurred())
 
-	Describe("RunProcess", func() {
-		It("builds the runc spec, bundle, and runs the container", func() {
-			fakeRuncAdapter.
-				EXPECT().
-				CreateJobPrerequisites(bpmCfg, procCfg, expectedUser).
-				Return(expectedStdout, expectedStderr, nil).
-				Times(1)
+				fakeLogLimiter = mock_lifecycle.NewMockLogLimiter(mockCtrl)
+				runcLifecycle = lifecycle.NewRuncLifecycle(
+					fakeRuncClient,
+					fakeRuncAdapter,
+					fakeUserFinder,
+					fakeCommandRunner,
+					fakeClock,
+					fakeFileRemover.Remove,
+					nil,
+					fakeLogLimiter,
+					nil,
+					nil,
+				)
+			})
 
-			fakeRuncAdapter.
-				EXPECT().
-				BuildSpec(gomock.Any(), bpmCfg, procCfg, expectedUser).
-				Return(jobSpec, nil).
-				Times(1)
+			AfterEach(func() {
+				Expect(os.RemoveAll(stdoutRelay.Name())).To(Succeed())
+				Expect(os.RemoveAll(stderrRelay.Name())).To(Succeed())
+			})
 
-			rootPath := filepath.Join(expectedSystemRoot, "data", "bpm", "bundles", expectedJobName, expectedProcName)
-			fakeRuncClient.
-				EXPECT().
-				CreateBundle(rootPath, jobSpec, expectedUser).
-				Times(1)
+			It("gives the container the relays rather than the log files", func() {
+				fakeLogLimiter.EXPECT().Relay(bpmCfg, logsink.Stdout).Return(stdoutRelay, nil)
+				fakeLogLimiter.EXPECT().Relay(bpmCfg, logsink.Stderr).Return(stderrRelay, nil)
 
-			fakeRuncClient.
-				EXPECT().
-				RunContainer(
-					bpmCfg.PidFile().External(),
-					rootPath,
-					expectedContainerID,
-					false,
-					gomock.Any(), // We can't assert on these because the function wraps them in io.MultiWriters.
-					gomock.Any(),
-				).
-				Return(0, nil).
-				Times(1)
+				fakeRuncClient.
+					EXPECT().
+					RunContainer(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), true, stdoutRelay, stderrRelay).
+					Times(1)
 
-			setupMockDefaults()
+				setupMockDefaults()
 
-			status, err := runcLifecycle.RunProcess(logger, bpmCfg, procCfg)
-			Expect(err).NotTo(HaveOccurred())
-			Expect(status).To(Equal(0))
+				err := runcLifecycle.StartProcess(ctx, logger, bpmCfg, procCfg)
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("closes log sinks which are not files once the relays have replaced them", func() {
+				stdoutSink, stderrSink := &closeRecorder{}, &closeRecorder{}
+				fakeRuncAdapter.
+					EXPECT().
+					CreateJobPrerequisites(bpmCfg, procCfg, expectedUser).
+					Return(stdoutSink, stderrSink, nil)
+
+				fakeLogLimiter.EXPECT().Relay(bpmCfg, logsink.Stdout).Return(stdoutRelay, nil)
+				fakeLogLimiter.EXPECT().Relay(bpmCfg, logsink.Stderr).Return(stderrRelay, nil)
+
+				fakeRuncClient.
+					EXPECT().
+					RunContainer(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), true, stdoutRelay, stderrRelay).
+					Times(1)
+
+				setupMockDefaults()
+
+				err := runcLifecycle.StartProcess(ctx, logger, bpmCfg, procCfg)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(stdoutSink.closed).To(BeTrue())
+				Expect(stderrSink.closed).To(BeTrue())
+			})
+
+			It("does not start the container if a relay cannot be started", func() {
+				fakeLogLimiter.EXPECT().Relay(bpmCfg, logsink.Stdout).Return(stdoutRelay, nil)
+				fakeLogLimiter.EXPECT().Relay(bpmCfg, logsink.Stderr).Return(nil, errors.New("boom"))
+
+				fakeRuncClient.
+					EXPECT().
+					RunContainer(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(0)
+
+				setupMockDefaults()
+
+				err := runcLifecycle.StartProcess(ctx, logger, bpmCfg, procCfg)
+				Expect(err).To(MatchError("boom"))
+				Expect(lifecycle.StartPhase(err)).To(Equal(lifecycle.PhasePrerequisites))
+			})
 		})
 
 		Context("when running the container fails", func() {
 			BeforeEach(func() {
 				fakeRuncClient.
 					EXPECT().
-					RunContainer(
-						gomock.Any(),
-						gomock.Any(),
-						gomock.Any(),
-						gomock.Any(),
-						gomock.Any(),
-						gomock.Any(),
-					).
+					RunContainer(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
 					Return(1, errors.New("fake test error"))
 			})
 
 			It("returns an error", func() {
 				setupMockDefaults()
 
-				status, err := runcLifecycle.RunProcess(logger, bpmCfg, procCfg)
+				err := runcLifecycle.StartProcess(ctx, logger, bpmCfg, procCfg)
 				Expect(err).To(HaveOccurred())
-				Expect(status).To(Equal(1))
 			})
 		})
 
-		ItSetsUpAndRunsAProcess(func(logger lager.Logger, bpmCfg *config.BPMConfig, procCfg *config.ProcessConfig) error {
-			setupMockDefaults()
-			// status is tested separately
-			_, err := runcLifecycle.RunProcess(logger, bpmCfg, procCfg)
-			return err
+		Context("when the context is cancelled while the container is being created", func() {
+			It("removes the partially created container", func() {
+				cancelCtx, cancel := context.WithCancel(ctx)
+
+				fakeRuncClient.
+					EXPECT().
+					RunContainer(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+					DoAndReturn(func(context.Context, string, string, string, bool, io.Writer, io.Writer) (int, error) {
+						cancel()
+						return 1, errors.New("signal: killed")
+					})
+
+				fakeRuncClient.
+					EXPECT().
+					DeleteContainer(gomock.Any(), expectedContainerID).
+					Times(1)
+
+				fakeRuncClient.
+					EXPECT().
+					DestroyBundle(bpmCfg.BundlePath()).
+					Times(1)
+
+				setupMockDefaults()
+
+				err := runcLifecycle.StartProcess(cancelCtx, logger, bpmCfg, procCfg)
+				Expect(err).To(Equal(context.Canceled))
+				Expect(fakeFileRemover.deletedFiles).To(ConsistOf(bpmCfg.PidFile().External()))
+			})
 		})
-	})
 
-	Describe("StopProcess", func() {
-		var exitTimeout time.Duration
+		Context("when a spec mutator is configured", func() {
+			var fakeSpecMutator *mock_lifecycle.MockSpecMutator
 
-		BeforeEach(func() {
-			exitTimeout = 5 * time.Second
+			BeforeEach(func() {
+				fakeSpecMutator = mock_lifecycle.NewMockSpecMutator(mockCtrl)
+				runcLifecycle = lifecycle.NewRuncLifecycle(
+					fakeRuncClient,
+					fakeRuncAdapter,
+					fakeUserFinder,
+					fakeCommandRunner,
+					fakeClock,
+					fakeFileRemover.Remove,
+					fakeSpecMutator,
+					nil,
+					nil,
+					nil,
+				)
+			})
+
+			It("creates the bundle from the mutated spec", func() {
+				mutatedSpec := jobSpec
+				mutatedSpec.Hostname = "mutated"
+
+				fakeSpecMutator.
+					EXPECT().
+					MutateSpec(gomock.Any(), gomock.Any(), bpmCfg, procCfg, jobSpec).
+					Return(mutatedSpec, nil)
+
+				fakeRuncClient.
+					EXPECT().
+					CreateBundle(bpmCfg.BundlePath(), mutatedSpec, expectedUser).
+					Times(1)
+
+				setupMockDefaults()
+
+				err := runcLifecycle.StartProcess(ctx, logger, bpmCfg, procCfg)
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("fails to start if the mutator fails", func() {
+				fakeSpecMutator.
+					EXPECT().
+					MutateSpec(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+					Return(specs.Spec{}, errors.New("policy violation"))
+
+				setupMockDefaults()
+
+				err := runcLifecycle.StartProcess(ctx, logger, bpmCfg, procCfg)
+				Expect(err).To(MatchError("policy violation"))
+				Expect(lifecycle.StartPhase(err)).To(Equal(lifecycle.PhaseSpecBuild))
+			})
 		})
 
-		It("stops the container", func() {
-			fakeRuncClient.
-				EXPECT().
-				ContainerState(expectedContainerID).
-				Return(&specs.State{
-					Status: "stopped",
-				}, nil)
+		Context("when the operation is traced", func() {
+			var (
+				collector *httptest.Server
+				exported  chan string
+			)
 
-			fakeRuncClient.
-				EXPECT().
-				SignalContainer(expectedContainerID, client.Term).
-				Times(1)
+			BeforeEach(func() {
+				exported = make(chan string, 1)
+				collector = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					body, _ := ioutil.ReadAll(r.Body)
+					exported <- string(body)
+				}))
+			})
 
-			setupMockDefaults()
-			err := runcLifecycle.StopProcess(logger, bpmCfg, exitTimeout)
-			Expect(err).ToNot(HaveOccurred())
+			AfterEach(func() {
+				collector.Close()
+			})
+
+			It("records a span for each step of the start", func() {
+				procCfg.Hooks = &config.Hooks{PreStart: "/please/execute/me"}
+				setupMockDefaults()
+
+				tracer := tracing.NewTracer(collector.URL, nil, nil)
+				tracedCtx := tracing.WithTracer(ctx, tracer)
+				Expect(runcLifecycle.StartProcess(tracedCtx, logger, bpmCfg, procCfg)).To(Succeed())
+				Expect(tracer.Flush(ctx)).To(Succeed())
+
+				var body string
+				Eventually(exported).Should(Receive(&body))
+				for _, name := range []string{"start-process", "create-job-prerequisites", "build-spec", "create-bundle", "pre-start-hook", "runc-run"} {
+					Expect(body).To(ContainSubstring(fmt.Sprintf(`"name":%q`, name)))
+				}
+				Expect(body).To(ContainSubstring(expectedContainerID))
+			})
 		})
 
-		Context("when the container does not stop immediately", func() {
-			It("polls the container state every second until it stops", func() {
+		Context("when an admission controller is configured", func() {
+			var fakeAdmission *mock_lifecycle.MockAdmissionController
+
+			BeforeEach(func() {
+				fakeAdmission = mock_lifecycle.NewMockAdmissionController(mockCtrl)
+				runcLifecycle = lifecycle.NewRuncLifecycle(
+					fakeRuncClient,
+					fakeRuncAdapter,
+					fakeUserFinder,
+					fakeCommandRunner,
+					fakeClock,
+					fakeFileRemover.Remove,
+					nil,
+					nil,
+					nil,
+					fakeAdmission,
+				)
+			})
+
+			It("creates the bundle once the spec has been admitted", func() {
 				gomock.InOrder(
-					fakeRuncClient.
-						EXPECT().
-						SignalContainer(expectedContainerID, client.Term).
-						Times(1),
-					fakeRuncClient.
-						EXPECT().
-						ContainerState(expectedContainerID).
-						DoAndReturn(func(id string) (*specs.State, error) {
-							go fakeClock.WaitForNWatchersAndIncrement(lifecycle.ContainerStatePollInterval, 2)
-							return &specs.State{Status: "running"}, nil
-						}).
-						Times(1),
-					fakeRuncClient.
+					fakeAdmission.
 						EXPECT().
-						ContainerState(expectedContainerID).
-						DoAndReturn(func(id string) (*specs.State, error) {
-							go fakeClock.WaitForNWatchersAndIncrement(lifecycle.ContainerStatePollInterval, 2)
-							return &specs.State{Status: "running"}, nil
-						}).
-						Times(1),
+						Admit(gomock.Any(), gomock.Any(), bpmCfg, jobSpec).
+						Return(nil),
 					fakeRuncClient.
 						EXPECT().
-						ContainerState(expectedContainerID).
-						DoAndReturn(func(id string) (*specs.State, error) {
-							return &specs.State{Status: "stopped"}, nil
-						}).
+						CreateBundle(bpmCfg.BundlePath(), jobSpec, expectedUser).
 						Times(1),
 				)
 
 				setupMockDefaults()
-				err := runcLifecycle.StopProcess(logger, bpmCfg, exitTimeout)
-				Expect(err).ToNot(HaveOccurred())
+
+				err := runcLifecycle.StartProcess(ctx, logger, bpmCfg, procCfg)
+				Expect(err).NotTo(HaveOccurred())
 			})
 
-			Context("and the exit timeout has passed", func() {
-				It("sends a SIGQUIT and returns a timeout error", func() {
-					gomock.InOrder(
-						fakeRuncClient.
-							EXPECT().
-							SignalContainer(expectedContainerID, client.Term).
-							Times(1),
-						fakeRuncClient.
-							EXPECT().
-							ContainerState(expectedContainerID).
-							DoAndReturn(func(id string) (*specs.State, error) {
-								go fakeClock.WaitForNWatchersAndIncrement(lifecycle.ContainerStatePollInterval, 2)
-								return &specs.State{Status: "running"}, nil
-							}).
-							Times(1),
-						fakeRuncClient.
-							EXPECT().
-							ContainerState(expectedContainerID).
-							DoAndReturn(func(id string) (*specs.State, error) {
-								go fakeClock.WaitForNWatchersAndIncrement(exitTimeout, 2)
-								return &specs.State{Status: "running"}, nil
-							}).
-							AnyTimes(),
-						fakeRuncClient.
-							EXPECT().
-							SignalContainer(expectedContainerID, client.Quit).
-							Do(func(id string, signal client.Signal) {
-								go fakeClock.WaitForNWatchersAndIncrement(lifecycle.ContainerSigQuitGracePeriod, 2)
-							}).
-							Times(1),
+			It("does not create the bundle if the spec is rejected", func() {
+				fakeAdmission.
+					EXPECT().
+					Admit(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+					Return(errors.New("no host network namespace"))
+				fakeRuncClient.EXPECT().CreateBundle(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+				fakeRuncClient.EXPECT().RunContainer(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+
+				setupMockDefaults()
+
+				err := runcLifecycle.StartProcess(ctx, logger, bpmCfg, procCfg)
+				Expect(err).To(MatchError("no host network namespace"))
+			})
+		})
+
+		Context("when executables are checked", func() {
+			var fakeExecChecker *mock_lifecycle.MockExecutableChecker
+
+			BeforeEach(func() {
+				fakeExecChecker = mock_lifecycle.NewMockExecutableChecker(mockCtrl)
+				runcLifecycle = lifecycle.NewRuncLifecycle(
+					fakeRuncClient,
+					fakeRuncAdapter,
+					fakeUserFinder,
+					fakeCommandRunner,
+					fakeClock,
+					fakeFileRemover.Remove,
+					nil,
+					nil,
+					fakeExecChecker,
+					nil,
+				)
+			})
+
+			It("checks the executable against the final spec", func() {
+				fakeExecChecker.
+					EXPECT().
+					CheckExecutable(bpmCfg, procCfg, jobSpec).
+					Return(nil)
+
+				setupMockDefaults()
+
+				err := runcLifecycle.StartProcess(ctx, logger, bpmCfg, procCfg)
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("fails to start if the check fails", func() {
+				fakeExecChecker.
+					EXPECT().
+					CheckExecutable(gomock.Any(), gomock.Any(), gomock.Any()).
+					Return(errors.New("libfoo.so.3 not found"))
+
+				setupMockDefaults()
+
+				err := runcLifecycle.StartProcess(ctx, logger, bpmCfg, procCfg)
+				Expect(err).To(MatchError("libfoo.so.3 not found"))
+			})
+		})
+
+		Context("when running the container fails transiently", func() {
+			var transientErr error
+
+			BeforeEach(func() {
+				transientErr = &client.RunError{
+					Err:     errors.New("exit status 1"),
+					Message: "mkdir /sys/fs/cgroup/memory/foo: device or resource busy",
+				}
+			})
+
+			It("deletes the partial container and tries again after a backoff", func() {
+				gomock.InOrder(
+					fakeRuncClient.
+						EXPECT().
+						RunContainer(gomock.Any(), gomock.Any(), gomock.Any(), expectedContainerID, true, gomock.Any(), gomock.Any()).
+						Return(1, transientErr),
+					fakeRuncClient.
+						EXPECT().
+						DeleteContainer(gomock.Any(), expectedContainerID),
+					fakeRuncClient.
+						EXPECT().
+						RunContainer(gomock.Any(), gomock.Any(), gomock.Any(), expectedContainerID, true, gomock.Any(), gomock.Any()).
+						Return(0, nil),
+				)
+				setupMockDefaults()
+
+				errChan := make(chan error)
+				go func() {
+					errChan <- runcLifecycle.StartProcess(ctx, logger, bpmCfg, procCfg)
+				}()
+
+				fakeClock.WaitForWatcherAndIncrement(lifecycle.StartRetryInitialBackoff)
+				Eventually(errChan).Should(Receive(BeNil()))
+				Expect(logger).To(gbytes.Say("retrying-transient-failure"))
+			})
+
+			It("gives up after a bounded number of attempts", func() {
+				fakeRuncClient.
+					EXPECT().
+					RunContainer(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+					Return(1, transientErr).
+					Times(lifecycle.StartRetryAttempts)
+				setupMockDefaults()
+
+				errChan := make(chan error)
+				go func() {
+					errChan <- runcLifecycle.StartProcess(ctx, logger, bpmCfg, procCfg)
+				}()
+
+				backoff := lifecycle.StartRetryInitialBackoff
+				for i := 1; i < lifecycle.StartRetryAttempts; i++ {
+					fakeClock.WaitForWatcherAndIncrement(backoff)
+					backoff *= 2
+				}
+
+				var err error
+				Eventually(errChan).Should(Receive(&err))
+				Expect(errors.Is(err, transientErr)).To(BeTrue())
+				Expect(lifecycle.StartPhase(err)).To(Equal(lifecycle.PhaseRuncRun))
+			})
+		})
+
+		Context("when running the container fails permanently", func() {
+			It("does not retry", func() {
+				fakeRuncClient.
+					EXPECT().
+					RunContainer(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+					Return(1, &client.RunError{Err: errors.New("exit status 1"), Message: "no such file or directory"}).
+					Times(1)
+				setupMockDefaults()
+
+				err := runcLifecycle.StartProcess(ctx, logger, bpmCfg, procCfg)
+				Expect(err).To(MatchError(ContainSubstring("no such file or directory")))
+			})
+
+			Context("when the job's log directory exists", func() {
+				var root string
+
+				BeforeEach(func() {
+					var err error
+					root, err = ioutil.TempDir("", "lifecycle")
+					Expect(err).NotTo(HaveOccurred())
+
+					bpmCfg = config.NewBPMConfig(bosh.NewEnv(root), expectedJobName, expectedProcName)
+					Expect(os.MkdirAll(bpmCfg.LogDir().External(), 0700)).To(Succeed())
+				})
+
+				AfterEach(func() {
+					Expect(os.RemoveAll(root)).To(Succeed())
+				})
+
+				It("records what runc logged in the start failure log", func() {
+					fakeRuncClient.
+						EXPECT().
+						RunContainer(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+						Return(1, &client.RunError{
+							Err:     errors.New("exit status 1"),
+							Message: "exec format error",
+							Log:     "error: exec user process caused: exec format error\n",
+						})
+					setupMockDefaults()
+
+					err := runcLifecycle.StartProcess(ctx, logger, bpmCfg, procCfg)
+					Expect(err).To(HaveOccurred())
+
+					path := bpmCfg.StartFailureLog().External()
+					Expect(lifecycle.StartFailureLog(err)).To(Equal(path))
+
+					contents, err := ioutil.ReadFile(path)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(string(contents)).To(HavePrefix("attempt 1 at "))
+					Expect(string(contents)).To(ContainSubstring("error: exec user process caused: exec format error\n"))
+				})
+			})
+		})
+
+		ItSetsUpAndRunsAProcess(func(logger lager.Logger, bpmCfg *config.BPMConfig, procCfg *config.ProcessConfig) error {
+			setupMockDefaults()
+
+			return runcLifecycle.StartProcess(ctx, logger, bpmCfg, procCfg)
+		})
+	})
+
+	Describe("CanReuseBundle", func() {
+		It("is true when the bundle was built from the same configuration", func() {
+			fakeRuncClient.
+				EXPECT().
+				BundleSpec(bpmCfg.BundlePath()).
+				Return(&specs.Spec{Annotations: map[string]string{
+					config.ConfigChecksumAnnotation: procCfg.Checksum(),
+				}}, nil)
+
+			Expect(runcLifecycle.CanReuseBundle(bpmCfg, procCfg)).To(BeTrue())
+		})
+
+		It("is false when the configuration has changed", func() {
+			fakeRuncClient.
+				EXPECT().
+				BundleSpec(bpmCfg.BundlePath()).
+				Return(&specs.Spec{Annotations: map[string]string{
+					config.ConfigChecksumAnnotation: "some-older-checksum",
+				}}, nil)
+
+			Expect(runcLifecycle.CanReuseBundle(bpmCfg, procCfg)).To(BeFalse())
+		})
+
+		It("is false when the bundle cannot be read", func() {
+			fakeRuncClient.
+				EXPECT().
+				BundleSpec(bpmCfg.BundlePath()).
+				Return(nil, errors.New("no such bundle"))
+
+			Expect(runcLifecycle.CanReuseBundle(bpmCfg, procCfg)).To(BeFalse())
+		})
+	})
+
+	Describe("ReviveProcess", func() {
+		BeforeEach(func() {
+			procCfg.Hooks = &config.Hooks{PreStart: "/please/execute/me"}
+		})
+
+		It("runs the existing bundle in a new container without rebuilding it", func() {
+			fakeRuncClient.
+				EXPECT().
+				BundleSpec(bpmCfg.BundlePath()).
+				Return(&jobSpec, nil)
+
+			gomock.InOrder(
+				fakeRuncClient.
+					EXPECT().
+					DeleteContainer(gomock.Any(), expectedContainerID).
+					Times(1),
+				fakeCommandRunner.
+					EXPECT().
+					Run(gomock.Any(), gomock.Any()).
+					Do(func(_ context.Context, cmd *exec.Cmd) {
+						Expect(cmd.Path).To(Equal("/please/execute/me"))
+						Expect(cmd.Env).To(Equal(jobSpec.Process.Env))
+					}).
+					Times(1),
+				fakeRuncClient.
+					EXPECT().
+					RunContainer(
+						gomock.Any(),
+						bpmCfg.PidFile().External(),
+						bpmCfg.BundlePath(),
+						expectedContainerID,
+						true,
+						expectedStdout,
+						expectedStderr,
+					).
+					Times(1),
+			)
+
+			fakeRuncAdapter.EXPECT().BuildSpec(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			fakeRuncClient.EXPECT().CreateBundle(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			fakeRuncClient.EXPECT().DestroyBundle(gomock.Any()).Times(0)
+
+			setupMockDefaults()
+			Expect(runcLifecycle.ReviveProcess(ctx, logger, bpmCfg, procCfg)).To(Succeed())
+
+			Expect(fakeFileRemover.deletedFiles).To(ConsistOf(
+				bpmCfg.PidFile().External(),
+				reaper.ExitFile(bpmCfg.PidFile().External()),
+			))
+		})
+
+		Context("when the bundle cannot be read", func() {
+			It("returns an error without touching the container", func() {
+				fakeRuncClient.
+					EXPECT().
+					BundleSpec(bpmCfg.BundlePath()).
+					Return(nil, errors.New("no such bundle"))
+				fakeRuncClient.EXPECT().DeleteContainer(gomock.Any(), gomock.Any()).Times(0)
+
+				err := runcLifecycle.ReviveProcess(ctx, logger, bpmCfg, procCfg)
+				Expect(err).To(MatchError("failed to read bundle: no such bundle"))
+				Expect(lifecycle.StartPhase(err)).To(Equal(lifecycle.PhaseBundleCreate))
+			})
+		})
+	})
+
+	Describe("RunProcess", func() {
+		It("builds the runc spec, bundle, and runs the container", func() {
+			fakeRuncAdapter.
+				EXPECT().
+				CreateJobPrerequisites(bpmCfg, procCfg, expectedUser).
+				Return(expectedStdout, expectedStderr, nil).
+				Times(1)
+
+			fakeRuncAdapter.
+				EXPECT().
+				BuildSpec(gomock.Any(), bpmCfg, procCfg, expectedUser).
+				Return(jobSpec, nil).
+				Times(1)
+
+			rootPath := filepath.Join(expectedSystemRoot, "data", "bpm", "bundles", expectedJobName, expectedProcName)
+			fakeRuncClient.
+				EXPECT().
+				CreateBundle(rootPath, jobSpec, expectedUser).
+				Times(1)
+
+			fakeRuncClient.
+				EXPECT().
+				RunContainer(
+					gomock.Any(),
+					bpmCfg.PidFile().External(),
+					rootPath,
+					expectedContainerID,
+					false,
+					gomock.Any(), // We can't assert on these because the function wraps them in io.MultiWriters.
+					gomock.Any(),
+				).
+				Return(0, nil).
+				Times(1)
+
+			setupMockDefaults()
+
+			status, err := runcLifecycle.RunProcess(ctx, logger, bpmCfg, procCfg)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(status).To(Equal(0))
+		})
+
+		Context("when a log limiter is configured", func() {
+			BeforeEach(func() {
+				runcLifecycle = lifecycle.NewRuncLifecycle(
+					fakeRuncClient,
+					fakeRuncAdapter,
+					fakeUserFinder,
+					fakeCommandRunner,
+					fakeClock,
+					fakeFileRemover.Remove,
+					nil,
+					loglimit.NewLimiter(5),
+					nil,
+					nil,
+				)
+			})
+
+			It("truncates long lines written to the log files", func() {
+				fakeRuncClient.
+					EXPECT().
+					RunContainer(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), false, gomock.Any(), gomock.Any()).
+					DoAndReturn(func(_ context.Context, _, _, _ string, _ bool, stdout, stderr io.Writer) (int, error) {
+						fmt.Fprintln(stdout, "short")
+						fmt.Fprintln(stdout, "much too long")
+						return 0, nil
+					})
+
+				setupMockDefaults()
+
+				_, err := runcLifecycle.RunProcess(ctx, logger, bpmCfg, procCfg)
+				Expect(err).NotTo(HaveOccurred())
+
+				contents, err := ioutil.ReadFile(expectedStdout.Name())
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(contents)).To(Equal("short\nmuch ... [8 bytes truncated by bpm]\n"))
+				Expect(logger).To(gbytes.Say("truncated-log-lines"))
+			})
+		})
+
+		Context("when running the container fails", func() {
+			BeforeEach(func() {
+				fakeRuncClient.
+					EXPECT().
+					RunContainer(
+						gomock.Any(),
+						gomock.Any(),
+						gomock.Any(),
+						gomock.Any(),
+						gomock.Any(),
+						gomock.Any(),
+						gomock.Any(),
+					).
+					Return(1, errors.New("fake test error"))
+			})
+
+			It("returns an error", func() {
+				setupMockDefaults()
+
+				status, err := runcLifecycle.RunProcess(ctx, logger, bpmCfg, procCfg)
+				Expect(err).To(HaveOccurred())
+				Expect(status).To(Equal(1))
+			})
+		})
+
+		ItSetsUpAndRunsAProcess(func(logger lager.Logger, bpmCfg *config.BPMConfig, procCfg *config.ProcessConfig) error {
+			setupMockDefaults()
+			// status is tested separately
+			_, err := runcLifecycle.RunProcess(ctx, logger, bpmCfg, procCfg)
+			return err
+		})
+	})
+
+	Describe("StopProcess", func() {
+		var exitTimeout time.Duration
+
+		BeforeEach(func() {
+			exitTimeout = 5 * time.Second
+		})
+
+		It("stops the container", func() {
+			fakeRuncClient.
+				EXPECT().
+				ContainerState(gomock.Any(), expectedContainerID).
+				Return(&specs.State{
+					Status: "stopped",
+				}, nil)
+
+			fakeRuncClient.
+				EXPECT().
+				SignalContainer(gomock.Any(), expectedContainerID, client.Term).
+				Times(1)
+
+			setupMockDefaults()
+			err := runcLifecycle.StopProcess(ctx, logger, bpmCfg, exitTimeout)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		Context("when the container does not stop immediately", func() {
+			It("polls the container state every second until it stops", func() {
+				gomock.InOrder(
+					fakeRuncClient.
+						EXPECT().
+						SignalContainer(gomock.Any(), expectedContainerID, client.Term).
+						Times(1),
+					fakeRuncClient.
+						EXPECT().
+						ContainerState(gomock.Any(), expectedContainerID).
+						DoAndReturn(func(_ context.Context, id string) (*specs.State, error) {
+							go fakeClock.WaitForNWatchersAndIncrement(lifecycle.ContainerStatePollInterval, 2)
+							return &specs.State{Status: "running"}, nil
+						}).
+						Times(1),
+					fakeRuncClient.
+						EXPECT().
+						ContainerState(gomock.Any(), expectedContainerID).
+						DoAndReturn(func(_ context.Context, id string) (*specs.State, error) {
+							go fakeClock.WaitForNWatchersAndIncrement(lifecycle.ContainerStatePollInterval, 2)
+							return &specs.State{Status: "running"}, nil
+						}).
+						Times(1),
+					fakeRuncClient.
+						EXPECT().
+						ContainerState(gomock.Any(), expectedContainerID).
+						DoAndReturn(func(_ context.Context, id string) (*specs.State, error) {
+							return &specs.State{Status: "stopped"}, nil
+						}).
+						Times(1),
+				)
+
+				setupMockDefaults()
+				err := runcLifecycle.StopProcess(ctx, logger, bpmCfg, exitTimeout)
+				Expect(err).ToNot(HaveOccurred())
+			})
+
+			Context("and bpm is interrupted while waiting", func() {
+				It("kills the container and returns the context's error", func() {
+					cancelCtx, cancel := context.WithCancel(ctx)
+					gomock.InOrder(
+						fakeRuncClient.
+							EXPECT().
+							SignalContainer(gomock.Any(), expectedContainerID, client.Term).
+							Times(1),
+						fakeRuncClient.
+							EXPECT().
+							ContainerState(gomock.Any(), expectedContainerID).
+							DoAndReturn(func(_ context.Context, id string) (*specs.State, error) {
+								cancel()
+								return &specs.State{Status: "running"}, nil
+							}).
+							Times(1),
+						fakeRuncClient.
+							EXPECT().
+							SignalContainer(gomock.Any(), expectedContainerID, client.Kill).
+							DoAndReturn(func(ctx context.Context, _ string, _ client.Signal) error {
+								Expect(ctx.Err()).NotTo(HaveOccurred())
+								return nil
+							}).
+							Times(1),
 					)
 
 					setupMockDefaults()
-					err := runcLifecycle.StopProcess(logger, bpmCfg, exitTimeout)
+					err := runcLifecycle.StopProcess(cancelCtx, logger, bpmCfg, exitTimeout)
+					Expect(err).To(Equal(context.Canceled))
+				})
+			})
+
+			Context("and the exit timeout has passed", func() {
+				It("sends a SIGQUIT and returns a timeout error", func() {
+					gomock.InOrder(
+						fakeRuncClient.
+							EXPECT().
+							SignalContainer(gomock.Any(), expectedContainerID, client.Term).
+							Times(1),
+						fakeRuncClient.
+							EXPECT().
+							ContainerState(gomock.Any(), expectedContainerID).
+							DoAndReturn(func(_ context.Context, id string) (*specs.State, error) {
+								go fakeClock.WaitForNWatchersAndIncrement(lifecycle.ContainerStatePollInterval, 2)
+								return &specs.State{Status: "running"}, nil
+							}).
+							Times(1),
+						fakeRuncClient.
+							EXPECT().
+							ContainerState(gomock.Any(), expectedContainerID).
+							DoAndReturn(func(_ context.Context, id string) (*specs.State, error) {
+								go fakeClock.WaitForNWatchersAndIncrement(exitTimeout, 2)
+								return &specs.State{Status: "running"}, nil
+							}).
+							AnyTimes(),
+						fakeRuncClient.
+							EXPECT().
+							SignalContainer(gomock.Any(), expectedContainerID, client.Quit).
+							Do(func(_ context.Context, id string, signal client.Signal) {
+								go fakeClock.WaitForNWatchersAndIncrement(lifecycle.ContainerSigQuitGracePeriod, 2)
+							}).
+							Times(1),
+					)
+
+					setupMockDefaults()
+					err := runcLifecycle.StopProcess(ctx, logger, bpmCfg, exitTimeout)
 					Expect(err).To(MatchError("failed to stop job within timeout"))
 				})
 			})
@@ -547,54 +1273,435 @@ var _ = Describe("RuncJobLifecycle", func() {
 				gomock.InOrder(
 					fakeRuncClient.
 						EXPECT().
-						SignalContainer(expectedContainerID, client.Term).
+						SignalContainer(gomock.Any(), expectedContainerID, client.Term).
 						Times(1),
 					fakeRuncClient.
 						EXPECT().
-						ContainerState(expectedContainerID).
-						DoAndReturn(func(id string) (*specs.State, error) {
+						ContainerState(gomock.Any(), expectedContainerID).
+						DoAndReturn(func(_ context.Context, id string) (*specs.State, error) {
 							go fakeClock.WaitForNWatchersAndIncrement(lifecycle.ContainerStatePollInterval, 2)
 							return nil, errors.New("fake test error")
 						}).
 						Times(1),
 					fakeRuncClient.
 						EXPECT().
-						ContainerState(expectedContainerID).
-						DoAndReturn(func(id string) (*specs.State, error) {
+						ContainerState(gomock.Any(), expectedContainerID).
+						DoAndReturn(func(_ context.Context, id string) (*specs.State, error) {
 							go fakeClock.WaitForNWatchersAndIncrement(exitTimeout, 2)
 							return nil, errors.New("fake test error")
 						}).
 						AnyTimes(),
 					fakeRuncClient.
 						EXPECT().
-						SignalContainer(expectedContainerID, client.Quit).
-						Do(func(id string, signal client.Signal) {
+						SignalContainer(gomock.Any(), expectedContainerID, client.Quit).
+						Do(func(_ context.Context, id string, signal client.Signal) {
 							go fakeClock.WaitForNWatchersAndIncrement(lifecycle.ContainerSigQuitGracePeriod, 2)
 						}).
 						Times(1),
 				)
 
-				setupMockDefaults()
-				err := runcLifecycle.StopProcess(logger, bpmCfg, exitTimeout)
-				Expect(err).To(MatchError("failed to stop job within timeout"))
+				setupMockDefaults()
+				err := runcLifecycle.StopProcess(ctx, logger, bpmCfg, exitTimeout)
+				Expect(err).To(MatchError("failed to stop job within timeout"))
+				Expect(lifecycle.IsStopTimeout(err)).To(BeTrue())
+			})
+		})
+
+		Context("when stopping a container fails", func() {
+			var expectedErr error
+
+			BeforeEach(func() {
+				expectedErr = errors.New("an error")
+				fakeRuncClient.
+					EXPECT().
+					SignalContainer(gomock.Any(), gomock.Any(), gomock.Any()).
+					Return(expectedErr)
+			})
+
+			It("returns an error", func() {
+				setupMockDefaults()
+				err := runcLifecycle.StopProcess(ctx, logger, bpmCfg, exitTimeout)
+				Expect(err).To(Equal(expectedErr))
+			})
+		})
+	})
+
+	Describe("ProcessEnvironment", func() {
+		It("returns the environment from the bundle", func() {
+			fakeRuncClient.
+				EXPECT().
+				BundleSpec(bpmCfg.BundlePath()).
+				Return(&specs.Spec{Process: &specs.Process{Env: []string{"FOO=bar", "BAZ=qux"}}}, nil)
+
+			env, err := runcLifecycle.ProcessEnvironment(bpmCfg)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(env).To(Equal([]string{"FOO=bar", "BAZ=qux"}))
+		})
+
+		Context("when the bundle cannot be read", func() {
+			It("returns an error", func() {
+				fakeRuncClient.
+					EXPECT().
+					BundleSpec(bpmCfg.BundlePath()).
+					Return(nil, errors.New("boom"))
+
+				_, err := runcLifecycle.ProcessEnvironment(bpmCfg)
+				Expect(err).To(HaveOccurred())
+			})
+		})
+	})
+
+	Describe("SignalProcess", func() {
+		It("signals the container", func() {
+			fakeRuncClient.
+				EXPECT().
+				SignalContainer(gomock.Any(), expectedContainerID, client.Usr1).
+				Return(nil)
+
+			err := runcLifecycle.SignalProcess(ctx, logger, bpmCfg, client.Usr1)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		Context("when signalling the container fails", func() {
+			It("returns an error", func() {
+				fakeRuncClient.
+					EXPECT().
+					SignalContainer(gomock.Any(), expectedContainerID, client.Usr1).
+					Return(errors.New("boom"))
+
+				err := runcLifecycle.SignalProcess(ctx, logger, bpmCfg, client.Usr1)
+				Expect(err).To(HaveOccurred())
+			})
+		})
+	})
+
+	Describe("PauseProcess", func() {
+		It("pauses the container for the duration and then resumes it", func() {
+			gomock.InOrder(
+				fakeRuncClient.EXPECT().PauseContainer(gomock.Any(), expectedContainerID).Return(nil),
+				fakeRuncClient.EXPECT().ResumeContainer(gomock.Any(), expectedContainerID).Return(nil),
+			)
+
+			errChan := make(chan error)
+			go func() {
+				errChan <- runcLifecycle.PauseProcess(ctx, logger, bpmCfg, 30*time.Second)
+			}()
+
+			Consistently(errChan).ShouldNot(Receive())
+			fakeClock.WaitForWatcherAndIncrement(30 * time.Second)
+			Eventually(errChan).Should(Receive(BeNil()))
+		})
+
+		Context("when the context is cancelled", func() {
+			It("resumes the container early", func() {
+				gomock.InOrder(
+					fakeRuncClient.EXPECT().PauseContainer(gomock.Any(), expectedContainerID).Return(nil),
+					fakeRuncClient.EXPECT().ResumeContainer(gomock.Any(), expectedContainerID).Return(nil),
+				)
+
+				cancelCtx, cancel := context.WithCancel(ctx)
+				errChan := make(chan error)
+				go func() {
+					errChan <- runcLifecycle.PauseProcess(cancelCtx, logger, bpmCfg, 30*time.Second)
+				}()
+
+				Consistently(errChan).ShouldNot(Receive())
+				cancel()
+				Eventually(errChan).Should(Receive(Equal(context.Canceled)))
+			})
+		})
+
+		Context("when pausing the container fails", func() {
+			It("returns an error without resuming it", func() {
+				fakeRuncClient.
+					EXPECT().
+					PauseContainer(gomock.Any(), expectedContainerID).
+					Return(errors.New("boom"))
+
+				err := runcLifecycle.PauseProcess(ctx, logger, bpmCfg, 30*time.Second)
+				Expect(err).To(HaveOccurred())
+			})
+		})
+	})
+
+	Describe("FreezeProcess and ThawProcess", func() {
+		It("pauses and resumes the container", func() {
+			gomock.InOrder(
+				fakeRuncClient.EXPECT().PauseContainer(gomock.Any(), expectedContainerID).Return(nil),
+				fakeRuncClient.EXPECT().ResumeContainer(gomock.Any(), expectedContainerID).Return(nil),
+			)
+
+			Expect(runcLifecycle.FreezeProcess(ctx, logger, bpmCfg)).To(Succeed())
+			Expect(runcLifecycle.ThawProcess(logger, bpmCfg)).To(Succeed())
+		})
+	})
+
+	Describe("RunBackupHook", func() {
+		BeforeEach(func() {
+			fakeRuncClient.
+				EXPECT().
+				BundleSpec(bpmCfg.BundlePath()).
+				Return(&specs.Spec{Process: &specs.Process{Env: []string{"FOO=bar"}}}, nil)
+		})
+
+		It("runs the hook on the host with the environment of the process", func() {
+			stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+			expectedCommand := exec.Command("/var/vcap/jobs/example/bin/pre-backup")
+			expectedCommand.Env = []string{"FOO=bar"}
+			expectedCommand.Stdout = stdout
+			expectedCommand.Stderr = stderr
+
+			fakeCommandRunner.
+				EXPECT().
+				Run(gomock.Any(), expectedCommand).
+				Return(nil)
+
+			Expect(runcLifecycle.RunBackupHook(ctx, logger, bpmCfg, "/var/vcap/jobs/example/bin/pre-backup", stdout, stderr)).To(Succeed())
+		})
+
+		It("returns the error of a failing hook", func() {
+			fakeCommandRunner.
+				EXPECT().
+				Run(gomock.Any(), gomock.Any()).
+				Return(errors.New("exit status 1"))
+
+			err := runcLifecycle.RunBackupHook(ctx, logger, bpmCfg, "/var/vcap/jobs/example/bin/pre-backup", ioutil.Discard, ioutil.Discard)
+			Expect(err).To(MatchError("exit status 1"))
+		})
+	})
+
+	Describe("ThrottleProcess", func() {
+		var (
+			bundleSpec *specs.Spec
+			updates    []*specs.LinuxResources
+		)
+
+		BeforeEach(func() {
+			updates = nil
+			bundleSpec = &specs.Spec{Linux: &specs.Linux{}}
+
+			fakeRuncClient.
+				EXPECT().
+				UpdateContainer(gomock.Any(), expectedContainerID, gomock.Any()).
+				DoAndReturn(func(_ context.Context, _ string, resources *specs.LinuxResources) error {
+					updates = append(updates, resources)
+					return nil
+				}).
+				AnyTimes()
+		})
+
+		throttle := func() {
+			errChan := make(chan error)
+			go func() {
+				errChan <- runcLifecycle.ThrottleProcess(ctx, logger, bpmCfg, time.Minute)
+			}()
+
+			fakeClock.WaitForWatcherAndIncrement(time.Minute)
+			Eventually(errChan).Should(Receive(BeNil()))
+		}
+
+		It("throttles the container's CPU for the duration and then lifts the quota", func() {
+			fakeRuncClient.
+				EXPECT().
+				BundleSpec(bpmCfg.BundlePath()).
+				Return(bundleSpec, nil)
+
+			throttle()
+
+			Expect(updates).To(HaveLen(2))
+			Expect(*updates[0].CPU.Period).To(Equal(uint64(lifecycle.ChaosThrottlePeriod)))
+			Expect(*updates[0].CPU.Quota).To(Equal(int64(lifecycle.ChaosThrottleQuota)))
+			Expect(*updates[1].CPU.Quota).To(Equal(int64(-1)))
+		})
+
+		Context("when the container was started with CPU limits", func() {
+			BeforeEach(func() {
+				shares := uint64(512)
+				quota := int64(50000)
+				bundleSpec.Linux.Resources = &specs.LinuxResources{
+					CPU: &specs.LinuxCPU{Shares: &shares, Quota: &quota},
+				}
+			})
+
+			It("restores them afterwards", func() {
+				fakeRuncClient.
+					EXPECT().
+					BundleSpec(bpmCfg.BundlePath()).
+					Return(bundleSpec, nil)
+
+				throttle()
+
+				Expect(updates).To(HaveLen(2))
+				Expect(updates[1].CPU).To(Equal(bundleSpec.Linux.Resources.CPU))
+			})
+		})
+
+		Context("when the bundle cannot be read", func() {
+			It("returns an error without throttling the container", func() {
+				fakeRuncClient.
+					EXPECT().
+					BundleSpec(bpmCfg.BundlePath()).
+					Return(nil, errors.New("boom"))
+
+				err := runcLifecycle.ThrottleProcess(ctx, logger, bpmCfg, time.Minute)
+				Expect(err).To(HaveOccurred())
+				Expect(updates).To(BeEmpty())
+			})
+		})
+	})
+
+	Describe("UpdateProcess", func() {
+		var (
+			current *specs.Spec
+			desired specs.Spec
+			updates []*specs.LinuxResources
+			written []specs.Spec
+		)
+
+		limits := func(memory, pids int64, checksum string) specs.Spec {
+			spec := specs.Spec{
+				Process:     &specs.Process{Env: []string{"foo=bar"}},
+				Annotations: map[string]string{config.ConfigChecksumAnnotation: checksum},
+				Linux: &specs.Linux{Resources: &specs.LinuxResources{
+					Memory: &specs.LinuxMemory{Limit: &memory},
+					Pids:   &specs.LinuxPids{Limit: pids},
+				}},
+			}
+			return spec
+		}
+
+		BeforeEach(func() {
+			updates, written = nil, nil
+			old := limits(1024, 100, "old")
+			current = &old
+			desired = limits(2048, 100, "new")
+
+			fakeUserFinder.EXPECT().Lookup("vcap").Return(expectedUser, nil).AnyTimes()
+			fakeRuncClient.EXPECT().BundleSpec(bpmCfg.BundlePath()).Return(current, nil).AnyTimes()
+			fakeRuncClient.
+				EXPECT().
+				UpdateContainer(gomock.Any(), expectedContainerID, gomock.Any()).
+				DoAndReturn(func(_ context.Context, _ string, resources *specs.LinuxResources) error {
+					updates = append(updates, resources)
+					return nil
+				}).
+				AnyTimes()
+			fakeRuncClient.
+				EXPECT().
+				CreateBundle(bpmCfg.BundlePath(), gomock.Any(), expectedUser).
+				DoAndReturn(func(_ string, spec specs.Spec, _ specs.User) error {
+					written = append(written, spec)
+					return nil
+				}).
+				AnyTimes()
+		})
+
+		JustBeforeEach(func() {
+			fakeRuncAdapter.EXPECT().BuildSpec(gomock.Any(), bpmCfg, procCfg, expectedUser).Return(desired, nil)
+		})
+
+		It("applies only the limits which changed to the running container", func() {
+			result, err := runcLifecycle.UpdateProcess(ctx, logger, bpmCfg, procCfg)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Changed).To(Equal([]string{"memory"}))
+			Expect(result.RestartNeeded).To(BeFalse())
+
+			Expect(updates).To(HaveLen(1))
+			Expect(*updates[0].Memory.Limit).To(Equal(int64(2048)))
+			Expect(updates[0].Pids).To(BeNil())
+			Expect(updates[0].CPU).To(BeNil())
+		})
+
+		It("records the new limits and configuration in the bundle", func() {
+			_, err := runcLifecycle.UpdateProcess(ctx, logger, bpmCfg, procCfg)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(written).To(HaveLen(1))
+			Expect(*written[0].Linux.Resources.Memory.Limit).To(Equal(int64(2048)))
+			Expect(written[0].Annotations[config.ConfigChecksumAnnotation]).To(Equal("new"))
+		})
+
+		Context("when the process has several environment variables", func() {
+			BeforeEach(func() {
+				env := []string{"A=1", "B=2", "C=3", "HOME=/var/vcap/data/example"}
+				current.Process.Env = env
+				desired.Process.Env = append([]string{}, env...)
+			})
+
+			It("does not ask for a restart and takes on the new checksum", func() {
+				result, err := runcLifecycle.UpdateProcess(ctx, logger, bpmCfg, procCfg)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(result.RestartNeeded).To(BeFalse())
+				Expect(written[0].Annotations[config.ConfigChecksumAnnotation]).To(Equal("new"))
+			})
+		})
+
+		Context("when a limit has been removed", func() {
+			BeforeEach(func() {
+				desired.Linux.Resources.Pids = nil
+			})
+
+			It("lifts it", func() {
+				result, err := runcLifecycle.UpdateProcess(ctx, logger, bpmCfg, procCfg)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(result.Changed).To(ContainElement("processes"))
+				Expect(updates[0].Pids.Limit).To(Equal(int64(-1)))
+				Expect(written[0].Linux.Resources.Pids).To(BeNil())
+			})
+		})
+
+		Context("when other settings have changed too", func() {
+			BeforeEach(func() {
+				desired.Process.Env = []string{"foo=baz"}
+			})
+
+			It("applies the limits but keeps the old configuration checksum", func() {
+				result, err := runcLifecycle.UpdateProcess(ctx, logger, bpmCfg, procCfg)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(result.RestartNeeded).To(BeTrue())
+				Expect(updates).To(HaveLen(1))
+
+				Expect(written).To(HaveLen(1))
+				Expect(written[0].Process.Env).To(Equal([]string{"foo=bar"}))
+				Expect(written[0].Annotations[config.ConfigChecksumAnnotation]).To(Equal("old"))
 			})
 		})
 
-		Context("when stopping a container fails", func() {
-			var expectedErr error
+		Context("when no limits have changed", func() {
+			BeforeEach(func() {
+				desired = limits(1024, 100, "old")
+			})
+
+			It("does not update the container", func() {
+				result, err := runcLifecycle.UpdateProcess(ctx, logger, bpmCfg, procCfg)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(result.Changed).To(BeEmpty())
+				Expect(updates).To(BeEmpty())
+			})
+		})
 
+		Context("when runc fails to update the container", func() {
 			BeforeEach(func() {
-				expectedErr = errors.New("an error")
-				fakeRuncClient.
-					EXPECT().
-					SignalContainer(gomock.Any(), gomock.Any()).
-					Return(expectedErr)
+				fakeRuncClient = mock_lifecycle.NewMockRuncClient(mockCtrl)
+				fakeRuncClient.EXPECT().BundleSpec(bpmCfg.BundlePath()).Return(current, nil)
+				fakeRuncClient.EXPECT().UpdateContainer(gomock.Any(), expectedContainerID, gomock.Any()).Return(errors.New("boom"))
+				runcLifecycle = lifecycle.NewRuncLifecycle(
+					fakeRuncClient,
+					fakeRuncAdapter,
+					fakeUserFinder,
+					fakeCommandRunner,
+					fakeClock,
+					fakeFileRemover.Remove,
+					nil,
+					nil,
+					nil,
+					nil,
+				)
 			})
 
-			It("returns an error", func() {
-				setupMockDefaults()
-				err := runcLifecycle.StopProcess(logger, bpmCfg, exitTimeout)
-				Expect(err).To(Equal(expectedErr))
+			It("returns the error without changing the bundle", func() {
+				_, err := runcLifecycle.UpdateProcess(ctx, logger, bpmCfg, procCfg)
+				Expect(err).To(MatchError("boom"))
 			})
 		})
 	})
@@ -603,11 +1710,11 @@ var _ = Describe("RuncJobLifecycle", func() {
 		It("deletes the container", func() {
 			fakeRuncClient.
 				EXPECT().
-				DeleteContainer(expectedContainerID).
+				DeleteContainer(gomock.Any(), expectedContainerID).
 				Times(1)
 
 			setupMockDefaults()
-			err := runcLifecycle.RemoveProcess(logger, bpmCfg)
+			err := runcLifecycle.RemoveProcess(ctx, logger, bpmCfg)
 			Expect(err).NotTo(HaveOccurred())
 		})
 
@@ -619,16 +1726,37 @@ var _ = Describe("RuncJobLifecycle", func() {
 				Times(1)
 
 			setupMockDefaults()
-			err := runcLifecycle.RemoveProcess(logger, bpmCfg)
+			err := runcLifecycle.RemoveProcess(ctx, logger, bpmCfg)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("deletes the container even if bpm has been interrupted", func() {
+			cancelCtx, cancel := context.WithCancel(ctx)
+			cancel()
+
+			fakeRuncClient.
+				EXPECT().
+				DeleteContainer(gomock.Any(), expectedContainerID).
+				DoAndReturn(func(ctx context.Context, _ string) error {
+					Expect(ctx.Err()).NotTo(HaveOccurred())
+					return nil
+				}).
+				Times(1)
+
+			setupMockDefaults()
+			err := runcLifecycle.RemoveProcess(cancelCtx, logger, bpmCfg)
 			Expect(err).NotTo(HaveOccurred())
 		})
 
-		It("deletes the pidfile", func() {
+		It("deletes the pidfile and recorded exit status", func() {
 			setupMockDefaults()
-			err := runcLifecycle.RemoveProcess(logger, bpmCfg)
+			err := runcLifecycle.RemoveProcess(ctx, logger, bpmCfg)
 			Expect(err).NotTo(HaveOccurred())
 
-			Expect(fakeFileRemover.deletedFiles).To(ConsistOf(bpmCfg.PidFile().External()))
+			Expect(fakeFileRemover.deletedFiles).To(ConsistOf(
+				bpmCfg.PidFile().External(),
+				reaper.ExitFile(bpmCfg.PidFile().External()),
+			))
 		})
 
 		Context("when the process name is the same as the job name", func() {
@@ -639,11 +1767,11 @@ var _ = Describe("RuncJobLifecycle", func() {
 			It("simplifies the container id", func() {
 				fakeRuncClient.
 					EXPECT().
-					DeleteContainer(jobid.Encode(expectedJobName)).
+					DeleteContainer(gomock.Any(), jobid.Encode(expectedJobName)).
 					Times(1)
 
 				setupMockDefaults()
-				err := runcLifecycle.RemoveProcess(logger, bpmCfg)
+				err := runcLifecycle.RemoveProcess(ctx, logger, bpmCfg)
 				Expect(err).NotTo(HaveOccurred())
 			})
 		})
@@ -655,13 +1783,13 @@ var _ = Describe("RuncJobLifecycle", func() {
 				expectedErr = errors.New("an error")
 				fakeRuncClient.
 					EXPECT().
-					DeleteContainer(gomock.Any()).
+					DeleteContainer(gomock.Any(), gomock.Any()).
 					Return(expectedErr)
 			})
 
 			It("returns an error", func() {
 				setupMockDefaults()
-				err := runcLifecycle.RemoveProcess(logger, bpmCfg)
+				err := runcLifecycle.RemoveProcess(ctx, logger, bpmCfg)
 				Expect(err).To(Equal(expectedErr))
 			})
 		})
@@ -675,7 +1803,7 @@ var _ = Describe("RuncJobLifecycle", func() {
 					Return(expectedErr)
 
 				setupMockDefaults()
-				err := runcLifecycle.RemoveProcess(logger, bpmCfg)
+				err := runcLifecycle.RemoveProcess(ctx, logger, bpmCfg)
 				Expect(err).To(Equal(expectedErr))
 			})
 		})
@@ -698,21 +1826,26 @@ var _ = Describe("RuncJobLifecycle", func() {
 					ID:             "job-process-3",
 					InitProcessPid: 0,
 					Status:         "stopped",
+					Annotations:    map[string]string{"org.cloudfoundry.release": "example"},
 				},
 			}
 			fakeRuncClient.
 				EXPECT().
-				ListContainers().
+				ListContainers(gomock.Any()).
 				Return(containerStates, nil)
+			fakeRuncClient.
+				EXPECT().
+				OOMKillCount("job-process-3").
+				Return(uint64(2), nil)
 
 			setupMockDefaults()
-			bpmJobs, err := runcLifecycle.ListProcesses()
+			bpmJobs, err := runcLifecycle.ListProcesses(ctx)
 			Expect(err).NotTo(HaveOccurred())
 
 			Expect(bpmJobs).To(ConsistOf([]*models.Process{
 				{Name: "job-process-2", Pid: 23456, Status: "created"},
 				{Name: "job-process-1", Pid: 34567, Status: "running"},
-				{Name: "job-process-3", Pid: 0, Status: "failed"},
+				{Name: "job-process-3", Pid: 0, Status: "failed", Labels: map[string]string{"org.cloudfoundry.release": "example"}, OOMKilled: true},
 			}))
 		})
 
@@ -721,11 +1854,11 @@ var _ = Describe("RuncJobLifecycle", func() {
 				expectedErr := errors.New("list jobs error")
 				fakeRuncClient.
 					EXPECT().
-					ListContainers().
+					ListContainers(gomock.Any()).
 					Return([]client.ContainerState{}, expectedErr)
 
 				setupMockDefaults()
-				_, err := runcLifecycle.ListProcesses()
+				_, err := runcLifecycle.ListProcesses(ctx)
 				Expect(err).To(Equal(expectedErr))
 			})
 		})
@@ -735,17 +1868,25 @@ var _ = Describe("RuncJobLifecycle", func() {
 		It("fetches the container state and translates it into a job", func() {
 			fakeRuncClient.
 				EXPECT().
-				ContainerState(expectedContainerID).
-				Return(&specs.State{ID: expectedContainerID, Pid: 1234, Status: "running"}, nil).
+				ContainerState(gomock.Any(), expectedContainerID).
+				Return(&specs.State{
+					ID:          expectedContainerID,
+					Pid:         1234,
+					Status:      "running",
+					Annotations: map[string]string{"org.cloudfoundry.release": "example", config.CgroupPathAnnotation: "/" + expectedContainerID},
+				}, nil).
 				Times(1)
 
 			setupMockDefaults()
-			process, err := runcLifecycle.StatProcess(bpmCfg)
+			process, err := runcLifecycle.StatProcess(ctx, bpmCfg)
 			Expect(err).NotTo(HaveOccurred())
 			Expect(process).To(Equal(&models.Process{
 				Name:   expectedContainerID,
 				Pid:    1234,
 				Status: "running",
+				Labels: map[string]string{"org.cloudfoundry.release": "example", config.CgroupPathAnnotation: "/" + expectedContainerID},
+
+				CgroupPath: "/" + expectedContainerID,
 			}))
 		})
 
@@ -753,14 +1894,14 @@ var _ = Describe("RuncJobLifecycle", func() {
 			BeforeEach(func() {
 				fakeRuncClient.
 					EXPECT().
-					ContainerState(expectedContainerID).
+					ContainerState(gomock.Any(), expectedContainerID).
 					Return(&specs.State{ID: expectedContainerID, Pid: 0, Status: "stopped"}, nil).
 					Times(1)
 			})
 
 			It("fetches the container state and translates it into a job", func() {
 				setupMockDefaults()
-				process, err := runcLifecycle.StatProcess(bpmCfg)
+				process, err := runcLifecycle.StatProcess(ctx, bpmCfg)
 				Expect(err).NotTo(HaveOccurred())
 				Expect(process).To(Equal(&models.Process{
 					Name:   expectedContainerID,
@@ -768,6 +1909,117 @@ var _ = Describe("RuncJobLifecycle", func() {
 					Status: "failed",
 				}))
 			})
+
+			Context("when the exit status of the process was recorded", func() {
+				var root string
+
+				BeforeEach(func() {
+					var err error
+					root, err = ioutil.TempDir("", "lifecycle")
+					Expect(err).NotTo(HaveOccurred())
+
+					bpmCfg = config.NewBPMConfig(bosh.NewEnv(root), expectedJobName, expectedProcName)
+					Expect(os.MkdirAll(bpmCfg.PidDir().External(), 0700)).To(Succeed())
+				})
+
+				AfterEach(func() {
+					Expect(os.RemoveAll(root)).To(Succeed())
+				})
+
+				It("reports a process which exited successfully as exited", func() {
+					Expect(reaper.WriteExitStatus(reaper.ExitFile(bpmCfg.PidFile().External()), 0)).To(Succeed())
+
+					setupMockDefaults()
+					process, err := runcLifecycle.StatProcess(ctx, bpmCfg)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(process.Status).To(Equal(models.ProcessStateExited))
+					Expect(*process.ExitStatus).To(Equal(0))
+				})
+
+				It("reports the message the process left in its termination log", func() {
+					Expect(reaper.WriteExitStatus(reaper.ExitFile(bpmCfg.PidFile().External()), 1)).To(Succeed())
+					Expect(ioutil.WriteFile(bpmCfg.TerminationLog().External(), []byte("out of disk\n"), 0600)).To(Succeed())
+
+					setupMockDefaults()
+					process, err := runcLifecycle.StatProcess(ctx, bpmCfg)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(process.TerminationMessage).To(Equal("out of disk"))
+				})
+
+				It("only keeps the start of a long termination log", func() {
+					Expect(reaper.WriteExitStatus(reaper.ExitFile(bpmCfg.PidFile().External()), 1)).To(Succeed())
+					long := strings.Repeat("x", lifecycle.MaxTerminationMessageLength+100)
+					Expect(ioutil.WriteFile(bpmCfg.TerminationLog().External(), []byte(long), 0600)).To(Succeed())
+
+					setupMockDefaults()
+					process, err := runcLifecycle.StatProcess(ctx, bpmCfg)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(process.TerminationMessage).To(HaveLen(lifecycle.MaxTerminationMessageLength))
+				})
+
+				It("reports a process which exited unsuccessfully as failed", func() {
+					Expect(reaper.WriteExitStatus(reaper.ExitFile(bpmCfg.PidFile().External()), 3)).To(Succeed())
+
+					setupMockDefaults()
+					process, err := runcLifecycle.StatProcess(ctx, bpmCfg)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(process.Status).To(Equal(models.ProcessStateFailed))
+					Expect(*process.ExitStatus).To(Equal(3))
+				})
+
+				It("reports a process whose container was preserved when it was stopped as preserved", func() {
+					Expect(reaper.WriteExitStatus(reaper.ExitFile(bpmCfg.PidFile().External()), 143)).To(Succeed())
+					Expect(os.MkdirAll(bpmCfg.BundlePath(), 0700)).To(Succeed())
+					Expect(runcLifecycle.PreserveProcess(logger, bpmCfg)).To(Succeed())
+
+					setupMockDefaults()
+					process, err := runcLifecycle.StatProcess(ctx, bpmCfg)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(process.Status).To(Equal(models.ProcessStatePreserved))
+					Expect(process.ExitStatus).To(BeNil())
+					Expect(process.HasExited()).To(BeTrue())
+				})
+			})
+		})
+
+		Context("when a process in the container was killed by the OOM killer", func() {
+			BeforeEach(func() {
+				fakeRuncClient.
+					EXPECT().
+					ContainerState(gomock.Any(), expectedContainerID).
+					Return(&specs.State{ID: expectedContainerID, Pid: 0, Status: "stopped"}, nil)
+				fakeRuncClient.
+					EXPECT().
+					OOMKillCount(expectedContainerID).
+					Return(uint64(1), nil)
+			})
+
+			It("reports that the process was OOM killed", func() {
+				setupMockDefaults()
+				process, err := runcLifecycle.StatProcess(ctx, bpmCfg)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(process.OOMKilled).To(BeTrue())
+			})
+		})
+
+		Context("when the OOM kill counter cannot be read", func() {
+			BeforeEach(func() {
+				fakeRuncClient.
+					EXPECT().
+					ContainerState(gomock.Any(), expectedContainerID).
+					Return(&specs.State{ID: expectedContainerID, Pid: 1234, Status: "running"}, nil)
+				fakeRuncClient.
+					EXPECT().
+					OOMKillCount(expectedContainerID).
+					Return(uint64(0), errors.New("no cgroup"))
+			})
+
+			It("reports that the process was not OOM killed", func() {
+				setupMockDefaults()
+				process, err := runcLifecycle.StatProcess(ctx, bpmCfg)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(process.OOMKilled).To(BeFalse())
+			})
 		})
 
 		Context("when the process name is the same as the job name", func() {
@@ -779,12 +2031,12 @@ var _ = Describe("RuncJobLifecycle", func() {
 				containerID := jobid.Encode(expectedJobName)
 				fakeRuncClient.
 					EXPECT().
-					ContainerState(containerID).
+					ContainerState(gomock.Any(), containerID).
 					Return(&specs.State{ID: containerID, Pid: 1234, Status: "running"}, nil).
 					Times(1)
 
 				setupMockDefaults()
-				_, err := runcLifecycle.StatProcess(bpmCfg)
+				_, err := runcLifecycle.StatProcess(ctx, bpmCfg)
 				Expect(err).NotTo(HaveOccurred())
 			})
 		})
@@ -793,13 +2045,13 @@ var _ = Describe("RuncJobLifecycle", func() {
 			BeforeEach(func() {
 				fakeRuncClient.
 					EXPECT().
-					ContainerState(gomock.Any()).
+					ContainerState(gomock.Any(), gomock.Any()).
 					Return(nil, nil)
 			})
 
 			It("returns nil and an 'IsNotExist' error", func() {
 				setupMockDefaults()
-				process, err := runcLifecycle.StatProcess(bpmCfg)
+				process, err := runcLifecycle.StatProcess(ctx, bpmCfg)
 				Expect(err).To(HaveOccurred())
 				Expect(process).To(BeNil())
 
@@ -813,37 +2065,230 @@ var _ = Describe("RuncJobLifecycle", func() {
 			BeforeEach(func() {
 				fakeRuncClient.
 					EXPECT().
-					ContainerState(gomock.Any()).
+					ContainerState(gomock.Any(), gomock.Any()).
 					Return(nil, err)
 			})
 
 			It("returns the underlying error", func() {
 				setupMockDefaults()
-				_, err := runcLifecycle.StatProcess(bpmCfg)
+				_, err := runcLifecycle.StatProcess(ctx, bpmCfg)
 				Expect(err).To(MatchError(err))
 				Expect(lifecycle.IsNotExist(err)).To(BeFalse())
 			})
 		})
 	})
 
+	Describe("ProcessStats", func() {
+		It("returns the stats of the running container", func() {
+			stats := &models.Stats{Memory: models.MemoryStats{UsageBytes: 1024}}
+			gomock.InOrder(
+				fakeRuncClient.EXPECT().ContainerState(gomock.Any(), expectedContainerID).Return(&specs.State{Status: "running"}, nil),
+				fakeRuncClient.EXPECT().Stats(gomock.Any(), expectedContainerID).Return(stats, nil),
+			)
+
+			Expect(runcLifecycle.ProcessStats(ctx, bpmCfg)).To(Equal(stats))
+		})
+
+		Context("when the process is not running", func() {
+			It("returns a not exist error", func() {
+				fakeRuncClient.EXPECT().ContainerState(gomock.Any(), expectedContainerID).Return(&specs.State{Status: "stopped"}, nil)
+
+				_, err := runcLifecycle.ProcessStats(ctx, bpmCfg)
+				Expect(lifecycle.IsNotExist(err)).To(BeTrue())
+			})
+		})
+	})
+
+	Describe("CheckLimits", func() {
+		It("compares the limits of the running process with its spec", func() {
+			spec := &specs.Spec{
+				Linux: &specs.Linux{
+					Resources: &specs.LinuxResources{Pids: &specs.LinuxPids{Limit: 100}},
+				},
+			}
+
+			gomock.InOrder(
+				fakeRuncClient.EXPECT().ContainerState(gomock.Any(), expectedContainerID).Return(&specs.State{Status: "running", Pid: os.Getpid()}, nil),
+				fakeRuncClient.EXPECT().BundleSpec(bpmCfg.BundlePath()).Return(spec, nil),
+				fakeRuncClient.EXPECT().CgroupLimits(expectedContainerID).Return(&models.CgroupLimits{Pids: 50}, nil),
+			)
+
+			checks, err := runcLifecycle.CheckLimits(ctx, bpmCfg)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(checks).To(Equal([]models.LimitCheck{
+				{Limit: "pids", Expected: "100", Actual: "50"},
+			}))
+		})
+
+		Context("when the process is not running", func() {
+			It("returns a not exist error", func() {
+				fakeRuncClient.EXPECT().ContainerState(gomock.Any(), expectedContainerID).Return(&specs.State{Status: "stopped"}, nil)
+
+				_, err := runcLifecycle.CheckLimits(ctx, bpmCfg)
+				Expect(lifecycle.IsNotExist(err)).To(BeTrue())
+			})
+		})
+	})
+
+	Describe("CheckPorts", func() {
+		var listener net.Listener
+
+		BeforeEach(func() {
+			var err error
+			listener, err = net.Listen("tcp", "127.0.0.1:0")
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			listener.Close()
+		})
+
+		It("checks whether the running process is listening on each port", func() {
+			port := listener.Addr().(*net.TCPAddr).Port
+			fakeRuncClient.EXPECT().ContainerState(gomock.Any(), expectedContainerID).Return(&specs.State{Status: "running", Pid: os.Getpid()}, nil)
+
+			checks, err := runcLifecycle.CheckPorts(ctx, bpmCfg, []config.Port{{Port: port}, {Port: port, Protocol: "udp"}})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(checks).To(Equal([]models.PortCheck{
+				{Port: fmt.Sprintf("%d/tcp", port), Listening: true},
+				{Port: fmt.Sprintf("%d/udp", port), Listening: false},
+			}))
+		})
+
+		Context("when the process is not running", func() {
+			It("returns a not exist error", func() {
+				fakeRuncClient.EXPECT().ContainerState(gomock.Any(), expectedContainerID).Return(nil, nil)
+
+				_, err := runcLifecycle.CheckPorts(ctx, bpmCfg, []config.Port{{Port: 8080}})
+				Expect(lifecycle.IsNotExist(err)).To(BeTrue())
+			})
+		})
+	})
+
+	Describe("ProcessEvents", func() {
+		It("passes on the events of the running container", func() {
+			fakeRuncClient.EXPECT().ContainerState(gomock.Any(), expectedContainerID).Return(&specs.State{Status: "running"}, nil)
+			fakeRuncClient.
+				EXPECT().
+				Events(gomock.Any(), expectedContainerID, 5*time.Second, gomock.Any()).
+				DoAndReturn(func(_ context.Context, _ string, _ time.Duration, handle func(models.Event)) error {
+					handle(models.Event{Type: models.EventTypeOOM})
+					return nil
+				})
+
+			var events []models.Event
+			err := runcLifecycle.ProcessEvents(ctx, bpmCfg, 5*time.Second, func(e models.Event) {
+				events = append(events, e)
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(events).To(Equal([]models.Event{{Type: models.EventTypeOOM}}))
+		})
+
+		Context("when the container does not exist", func() {
+			It("returns a not exist error", func() {
+				fakeRuncClient.EXPECT().ContainerState(gomock.Any(), expectedContainerID).Return(nil, nil)
+
+				err := runcLifecycle.ProcessEvents(ctx, bpmCfg, 5*time.Second, func(models.Event) {})
+				Expect(lifecycle.IsNotExist(err)).To(BeTrue())
+			})
+		})
+	})
+
 	Describe("OpenShell", func() {
-		var expectedStdin *gbytes.Buffer
+		var (
+			expectedStdin  *gbytes.Buffer
+			bundleSpec     *specs.Spec
+			containerState *specs.State
+		)
 
 		BeforeEach(func() {
 			expectedStdin = gbytes.BufferWithBytes([]byte("stdin"))
+			bundleSpec = &specs.Spec{
+				Process: &specs.Process{
+					Args: []string{"/var/vcap/packages/bpm/bin/tini", "--", "/bin/sleep"},
+					Env:  []string{"FOO=BAR", "PATH=/usr/bin"},
+					Cwd:  "/var/vcap/jobs/example",
+					User: expectedUser,
+				},
+			}
+
+			Expect(os.Setenv("TERM", "xterm-256color")).To(Succeed())
+
+			// The shell is looked for through the root of the container's
+			// init process. Using our own PID makes the host's root visible.
+			containerState = &specs.State{Pid: os.Getpid()}
+			fakeRuncClient.
+				EXPECT().
+				ContainerState(gomock.Any(), gomock.Any()).
+				DoAndReturn(func(context.Context, string) (*specs.State, error) {
+					return containerState, nil
+				}).
+				AnyTimes()
+		})
+
+		AfterEach(func() {
+			Expect(os.Unsetenv("TERM")).To(Succeed())
+		})
+
+		Context("when the container does not exist", func() {
+			It("returns an error", func() {
+				containerState = nil
+
+				err := runcLifecycle.OpenShell(ctx, bpmCfg, lifecycle.ExecOptions{}, expectedStdin, expectedStdout, expectedStderr)
+				Expect(lifecycle.IsNotExist(err)).To(BeTrue())
+			})
 		})
 
-		It("execs /bin/bash inside the container", func() {
+		It("execs /bin/bash inside the container with the environment of the process", func() {
+			bundlePath := filepath.Join(expectedSystemRoot, "data", "bpm", "bundles", expectedJobName, expectedProcName)
+			fakeRuncClient.
+				EXPECT().
+				BundleSpec(bundlePath).
+				Return(bundleSpec, nil).
+				Times(1)
+
 			fakeRuncClient.
 				EXPECT().
-				Exec(expectedContainerID, "/bin/bash", expectedStdin, expectedStdout, expectedStderr).
+				Exec(gomock.Any(), expectedContainerID, specs.Process{
+					Args:     []string{"/bin/bash"},
+					Env:      []string{"FOO=BAR", "PATH=/usr/bin", "TERM=xterm-256color"},
+					Cwd:      "/var/vcap/jobs/example",
+					User:     expectedUser,
+					Terminal: true,
+				}, expectedStdin, expectedStdout, expectedStderr).
 				Times(1)
 
 			setupMockDefaults()
-			err := runcLifecycle.OpenShell(bpmCfg, expectedStdin, expectedStdout, expectedStderr)
+			err := runcLifecycle.OpenShell(ctx, bpmCfg, lifecycle.ExecOptions{}, expectedStdin, expectedStdout, expectedStderr)
 			Expect(err).NotTo(HaveOccurred())
 		})
 
+		Context("when a clean environment is requested", func() {
+			It("only passes through the TERM environment variable", func() {
+				fakeRuncClient.
+					EXPECT().
+					BundleSpec(gomock.Any()).
+					Return(bundleSpec, nil).
+					Times(1)
+
+				fakeRuncClient.
+					EXPECT().
+					Exec(gomock.Any(), expectedContainerID, specs.Process{
+						Args:     []string{"/bin/bash"},
+						Env:      []string{"TERM=xterm-256color"},
+						Cwd:      "/var/vcap/jobs/example",
+						User:     expectedUser,
+						Terminal: true,
+					}, expectedStdin, expectedStdout, expectedStderr).
+					Times(1)
+
+				setupMockDefaults()
+				opts := lifecycle.ExecOptions{CleanEnv: true}
+				err := runcLifecycle.OpenShell(ctx, bpmCfg, opts, expectedStdin, expectedStdout, expectedStderr)
+				Expect(err).NotTo(HaveOccurred())
+			})
+		})
+
 		Context("when the process name is the same as the job name", func() {
 			BeforeEach(func() {
 				bpmCfg = config.NewBPMConfig(boshEnv, expectedJobName, expectedJobName)
@@ -852,29 +2297,179 @@ var _ = Describe("RuncJobLifecycle", func() {
 			It("simplifies the container id", func() {
 				fakeRuncClient.
 					EXPECT().
-					Exec(jobid.Encode(expectedJobName), "/bin/bash", expectedStdin, expectedStdout, expectedStderr).
+					BundleSpec(gomock.Any()).
+					Return(bundleSpec, nil).
+					Times(1)
+
+				fakeRuncClient.
+					EXPECT().
+					Exec(gomock.Any(), jobid.Encode(expectedJobName), gomock.Any(), expectedStdin, expectedStdout, expectedStderr).
 					Times(1)
+
 				setupMockDefaults()
-				err := runcLifecycle.OpenShell(bpmCfg, expectedStdin, expectedStdout, expectedStderr)
+				err := runcLifecycle.OpenShell(ctx, bpmCfg, lifecycle.ExecOptions{}, expectedStdin, expectedStdout, expectedStderr)
 				Expect(err).NotTo(HaveOccurred())
 			})
 		})
 
+		Context("when reading the container configuration fails", func() {
+			BeforeEach(func() {
+				fakeRuncClient.
+					EXPECT().
+					BundleSpec(gomock.Any()).
+					Return(nil, errors.New("fake test error"))
+			})
+
+			It("returns an error", func() {
+				setupMockDefaults()
+				err := runcLifecycle.OpenShell(ctx, bpmCfg, lifecycle.ExecOptions{}, expectedStdin, expectedStdout, expectedStderr)
+				Expect(err).To(HaveOccurred())
+			})
+		})
+
 		Context("when the exec command fails", func() {
 			BeforeEach(func() {
 				fakeRuncClient.
 					EXPECT().
-					Exec(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+					BundleSpec(gomock.Any()).
+					Return(bundleSpec, nil)
+
+				fakeRuncClient.
+					EXPECT().
+					Exec(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
 					Return(errors.New("fake test error"))
 			})
 
 			It("returns an error", func() {
 				setupMockDefaults()
-				err := runcLifecycle.OpenShell(bpmCfg, expectedStdin, expectedStdout, expectedStderr)
+				err := runcLifecycle.OpenShell(ctx, bpmCfg, lifecycle.ExecOptions{}, expectedStdin, expectedStdout, expectedStderr)
 				Expect(err).To(HaveOccurred())
 			})
 		})
 	})
+
+	Describe("ExecProcess", func() {
+		BeforeEach(func() {
+			Expect(os.Unsetenv("TERM")).To(Succeed())
+		})
+
+		It("execs the command without a terminal", func() {
+			fakeRuncClient.
+				EXPECT().
+				BundleSpec(gomock.Any()).
+				Return(&specs.Spec{Process: &specs.Process{Env: []string{"FOO=BAR"}}}, nil).
+				Times(1)
+
+			fakeRuncClient.
+				EXPECT().
+				Exec(gomock.Any(), expectedContainerID, specs.Process{
+					Args: []string{"/bin/ls", "-la"},
+					Env:  []string{"FOO=BAR"},
+				}, nil, expectedStdout, expectedStderr).
+				Times(1)
+
+			setupMockDefaults()
+			args := []string{"/bin/ls", "-la"}
+			err := runcLifecycle.ExecProcess(ctx, bpmCfg, args, lifecycle.ExecOptions{}, nil, expectedStdout, expectedStderr)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("overrides the working directory, environment, and user of the process", func() {
+			fakeRuncClient.
+				EXPECT().
+				BundleSpec(gomock.Any()).
+				Return(&specs.Spec{Process: &specs.Process{
+					Env:  []string{"FOO=BAR", "BAZ=QUX"},
+					Cwd:  "/var/vcap/jobs/example",
+					User: specs.User{UID: 1000, GID: 1000, AdditionalGids: []uint32{5}},
+				}}, nil).
+				Times(1)
+
+			fakeRuncClient.
+				EXPECT().
+				Exec(gomock.Any(), expectedContainerID, specs.Process{
+					Terminal: true,
+					Args:     []string{"/bin/ls", "-la"},
+					Env:      []string{"BAZ=QUX", "FOO=OVERRIDDEN", "DEBUG=1"},
+					Cwd:      "/tmp",
+					User:     specs.User{UID: 0, GID: 0, Username: "root"},
+				}, nil, expectedStdout, expectedStderr).
+				Times(1)
+
+			setupMockDefaults()
+			opts := lifecycle.ExecOptions{
+				TTY:  true,
+				Cwd:  "/tmp",
+				Env:  []string{"FOO=OVERRIDDEN", "DEBUG=1"},
+				User: &specs.User{UID: 0, GID: 0, Username: "root"},
+			}
+			err := runcLifecycle.ExecProcess(ctx, bpmCfg, []string{"/bin/ls", "-la"}, opts, nil, expectedStdout, expectedStderr)
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+})
+
+var _ = Describe("FindShell", func() {
+	var root string
+
+	BeforeEach(func() {
+		var err error
+		root, err = ioutil.TempDir("", "find-shell")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(os.MkdirAll(filepath.Join(root, "bin"), 0755)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(root)).To(Succeed())
+	})
+
+	install := func(name string) {
+		Expect(ioutil.WriteFile(filepath.Join(root, "bin", name), nil, 0755)).To(Succeed())
+	}
+
+	It("prefers bash", func() {
+		install("bash")
+		install("sh")
+		Expect(lifecycle.FindShell(root)).To(Equal([]string{"/bin/bash"}))
+	})
+
+	It("falls back to sh", func() {
+		install("sh")
+		Expect(lifecycle.FindShell(root)).To(Equal([]string{"/bin/sh"}))
+	})
+
+	It("falls back to the busybox shell", func() {
+		install("busybox")
+		Expect(lifecycle.FindShell(root)).To(Equal([]string{"/bin/busybox", "sh"}))
+	})
+
+	It("ignores files which are not executable", func() {
+		Expect(ioutil.WriteFile(filepath.Join(root, "bin", "bash"), nil, 0644)).To(Succeed())
+		install("sh")
+		Expect(lifecycle.FindShell(root)).To(Equal([]string{"/bin/sh"}))
+	})
+
+	It("lists every shell which was tried when none exist", func() {
+		_, err := lifecycle.FindShell(root)
+		Expect(err).To(MatchError("no shell found in the container (tried /bin/bash, /bin/sh, /bin/busybox)"))
+	})
+})
+
+var _ = Describe("CommandRunner", func() {
+	It("runs the command", func() {
+		err := lifecycle.NewCommandRunner().Run(context.Background(), exec.Command("true"))
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("kills the command when the context is done", func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		cmd := exec.Command("sleep", "10")
+		err := lifecycle.NewCommandRunner().Run(ctx, cmd)
+		Expect(err).To(Equal(context.DeadlineExceeded))
+		Expect(cmd.ProcessState.Exited()).To(BeFalse())
+	})
 })
 
 type fileRemover struct {
@@ -15,18 +15,23 @@
 //
 
 // Code generated by MockGen. DO NOT EDIT.
-// Source: bpm/runc/lifecycle (interfaces: UserFinder,CommandRunner,RuncAdapter,RuncClient)
+// Source: bpm/runc/lifecycle (interfaces: UserFinder,CommandRunner,RuncAdapter,RuncClient,SpecMutator,LogLimiter,ExecutableChecker,AdmissionController)
 
 // Package mock_lifecycle is a generated GoMock package.
 package mock_lifecycle
 
 import (
 	config "bpm/config"
+	loglimit "bpm/loglimit"
+	logsink "bpm/logsink"
+	models "bpm/models"
 	client "bpm/runc/client"
+	context "context"
 	io "io"
 	os "os"
 	exec "os/exec"
 	reflect "reflect"
+	time "time"
 
 	lager "code.cloudfoundry.org/lager"
 	gomock "github.com/golang/mock/gomock"
@@ -95,17 +100,17 @@ func (m *MockCommandRunner) EXPECT() *MockCommandRunnerMockRecorder {
 }
 
 // Run mocks base method
-func (m *MockCommandRunner) Run(arg0 *exec.Cmd) error {
+func (m *MockCommandRunner) Run(arg0 context.Context, arg1 *exec.Cmd) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Run", arg0)
+	ret := m.ctrl.Call(m, "Run", arg0, arg1)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // Run indicates an expected call of Run
-func (mr *MockCommandRunnerMockRecorder) Run(arg0 interface{}) *gomock.Call {
+func (mr *MockCommandRunnerMockRecorder) Run(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Run", reflect.TypeOf((*MockCommandRunner)(nil).Run), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Run", reflect.TypeOf((*MockCommandRunner)(nil).Run), arg0, arg1)
 }
 
 // MockRuncAdapter is a mock of RuncAdapter interface
@@ -147,11 +152,11 @@ func (mr *MockRuncAdapterMockRecorder) BuildSpec(arg0, arg1, arg2, arg3 interfac
 }
 
 // CreateJobPrerequisites mocks base method
-func (m *MockRuncAdapter) CreateJobPrerequisites(arg0 *config.BPMConfig, arg1 *config.ProcessConfig, arg2 specs.User) (*os.File, *os.File, error) {
+func (m *MockRuncAdapter) CreateJobPrerequisites(arg0 *config.BPMConfig, arg1 *config.ProcessConfig, arg2 specs.User) (io.WriteCloser, io.WriteCloser, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "CreateJobPrerequisites", arg0, arg1, arg2)
-	ret0, _ := ret[0].(*os.File)
-	ret1, _ := ret[1].(*os.File)
+	ret0, _ := ret[0].(io.WriteCloser)
+	ret1, _ := ret[1].(io.WriteCloser)
 	ret2, _ := ret[2].(error)
 	return ret0, ret1, ret2
 }
@@ -185,19 +190,49 @@ func (m *MockRuncClient) EXPECT() *MockRuncClientMockRecorder {
 	return m.recorder
 }
 
+// BundleSpec mocks base method
+func (m *MockRuncClient) BundleSpec(arg0 string) (*specs.Spec, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "BundleSpec", arg0)
+	ret0, _ := ret[0].(*specs.Spec)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// BundleSpec indicates an expected call of BundleSpec
+func (mr *MockRuncClientMockRecorder) BundleSpec(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BundleSpec", reflect.TypeOf((*MockRuncClient)(nil).BundleSpec), arg0)
+}
+
+// CgroupLimits mocks base method
+func (m *MockRuncClient) CgroupLimits(arg0 string) (*models.CgroupLimits, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CgroupLimits", arg0)
+	ret0, _ := ret[0].(*models.CgroupLimits)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CgroupLimits indicates an expected call of CgroupLimits
+func (mr *MockRuncClientMockRecorder) CgroupLimits(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CgroupLimits", reflect.TypeOf((*MockRuncClient)(nil).CgroupLimits), arg0)
+}
+
 // ContainerState mocks base method
-func (m *MockRuncClient) ContainerState(arg0 string) (*specs.State, error) {
+func (m *MockRuncClient) ContainerState(arg0 context.Context, arg1 string) (*specs.State, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "ContainerState", arg0)
+	ret := m.ctrl.Call(m, "ContainerState", arg0, arg1)
 	ret0, _ := ret[0].(*specs.State)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // ContainerState indicates an expected call of ContainerState
-func (mr *MockRuncClientMockRecorder) ContainerState(arg0 interface{}) *gomock.Call {
+func (mr *MockRuncClientMockRecorder) ContainerState(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ContainerState", reflect.TypeOf((*MockRuncClient)(nil).ContainerState), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ContainerState", reflect.TypeOf((*MockRuncClient)(nil).ContainerState), arg0, arg1)
 }
 
 // CreateBundle mocks base method
@@ -215,17 +250,17 @@ func (mr *MockRuncClientMockRecorder) CreateBundle(arg0, arg1, arg2 interface{})
 }
 
 // DeleteContainer mocks base method
-func (m *MockRuncClient) DeleteContainer(arg0 string) error {
+func (m *MockRuncClient) DeleteContainer(arg0 context.Context, arg1 string) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "DeleteContainer", arg0)
+	ret := m.ctrl.Call(m, "DeleteContainer", arg0, arg1)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // DeleteContainer indicates an expected call of DeleteContainer
-func (mr *MockRuncClientMockRecorder) DeleteContainer(arg0 interface{}) *gomock.Call {
+func (mr *MockRuncClientMockRecorder) DeleteContainer(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteContainer", reflect.TypeOf((*MockRuncClient)(nil).DeleteContainer), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteContainer", reflect.TypeOf((*MockRuncClient)(nil).DeleteContainer), arg0, arg1)
 }
 
 // DestroyBundle mocks base method
@@ -242,60 +277,310 @@ func (mr *MockRuncClientMockRecorder) DestroyBundle(arg0 interface{}) *gomock.Ca
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DestroyBundle", reflect.TypeOf((*MockRuncClient)(nil).DestroyBundle), arg0)
 }
 
+// Events mocks base method
+func (m *MockRuncClient) Events(arg0 context.Context, arg1 string, arg2 time.Duration, arg3 func(models.Event)) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Events", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Events indicates an expected call of Events
+func (mr *MockRuncClientMockRecorder) Events(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Events", reflect.TypeOf((*MockRuncClient)(nil).Events), arg0, arg1, arg2, arg3)
+}
+
 // Exec mocks base method
-func (m *MockRuncClient) Exec(arg0, arg1 string, arg2 io.Reader, arg3, arg4 io.Writer) error {
+func (m *MockRuncClient) Exec(arg0 context.Context, arg1 string, arg2 specs.Process, arg3 io.Reader, arg4, arg5 io.Writer) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Exec", arg0, arg1, arg2, arg3, arg4)
+	ret := m.ctrl.Call(m, "Exec", arg0, arg1, arg2, arg3, arg4, arg5)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // Exec indicates an expected call of Exec
-func (mr *MockRuncClientMockRecorder) Exec(arg0, arg1, arg2, arg3, arg4 interface{}) *gomock.Call {
+func (mr *MockRuncClientMockRecorder) Exec(arg0, arg1, arg2, arg3, arg4, arg5 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Exec", reflect.TypeOf((*MockRuncClient)(nil).Exec), arg0, arg1, arg2, arg3, arg4)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Exec", reflect.TypeOf((*MockRuncClient)(nil).Exec), arg0, arg1, arg2, arg3, arg4, arg5)
 }
 
 // ListContainers mocks base method
-func (m *MockRuncClient) ListContainers() ([]client.ContainerState, error) {
+func (m *MockRuncClient) ListContainers(arg0 context.Context) ([]client.ContainerState, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "ListContainers")
+	ret := m.ctrl.Call(m, "ListContainers", arg0)
 	ret0, _ := ret[0].([]client.ContainerState)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // ListContainers indicates an expected call of ListContainers
-func (mr *MockRuncClientMockRecorder) ListContainers() *gomock.Call {
+func (mr *MockRuncClientMockRecorder) ListContainers(arg0 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListContainers", reflect.TypeOf((*MockRuncClient)(nil).ListContainers))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListContainers", reflect.TypeOf((*MockRuncClient)(nil).ListContainers), arg0)
+}
+
+// OOMKillCount mocks base method
+func (m *MockRuncClient) OOMKillCount(arg0 string) (uint64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "OOMKillCount", arg0)
+	ret0, _ := ret[0].(uint64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// OOMKillCount indicates an expected call of OOMKillCount
+func (mr *MockRuncClientMockRecorder) OOMKillCount(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "OOMKillCount", reflect.TypeOf((*MockRuncClient)(nil).OOMKillCount), arg0)
+}
+
+// PauseContainer mocks base method
+func (m *MockRuncClient) PauseContainer(arg0 context.Context, arg1 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PauseContainer", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// PauseContainer indicates an expected call of PauseContainer
+func (mr *MockRuncClientMockRecorder) PauseContainer(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PauseContainer", reflect.TypeOf((*MockRuncClient)(nil).PauseContainer), arg0, arg1)
+}
+
+// ResumeContainer mocks base method
+func (m *MockRuncClient) ResumeContainer(arg0 context.Context, arg1 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ResumeContainer", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ResumeContainer indicates an expected call of ResumeContainer
+func (mr *MockRuncClientMockRecorder) ResumeContainer(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ResumeContainer", reflect.TypeOf((*MockRuncClient)(nil).ResumeContainer), arg0, arg1)
 }
 
 // RunContainer mocks base method
-func (m *MockRuncClient) RunContainer(arg0, arg1, arg2 string, arg3 bool, arg4, arg5 io.Writer) (int, error) {
+func (m *MockRuncClient) RunContainer(arg0 context.Context, arg1, arg2, arg3 string, arg4 bool, arg5, arg6 io.Writer) (int, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "RunContainer", arg0, arg1, arg2, arg3, arg4, arg5)
+	ret := m.ctrl.Call(m, "RunContainer", arg0, arg1, arg2, arg3, arg4, arg5, arg6)
 	ret0, _ := ret[0].(int)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // RunContainer indicates an expected call of RunContainer
-func (mr *MockRuncClientMockRecorder) RunContainer(arg0, arg1, arg2, arg3, arg4, arg5 interface{}) *gomock.Call {
+func (mr *MockRuncClientMockRecorder) RunContainer(arg0, arg1, arg2, arg3, arg4, arg5, arg6 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RunContainer", reflect.TypeOf((*MockRuncClient)(nil).RunContainer), arg0, arg1, arg2, arg3, arg4, arg5)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RunContainer", reflect.TypeOf((*MockRuncClient)(nil).RunContainer), arg0, arg1, arg2, arg3, arg4, arg5, arg6)
 }
 
 // SignalContainer mocks base method
-func (m *MockRuncClient) SignalContainer(arg0 string, arg1 client.Signal) error {
+func (m *MockRuncClient) SignalContainer(arg0 context.Context, arg1 string, arg2 client.Signal) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "SignalContainer", arg0, arg1)
+	ret := m.ctrl.Call(m, "SignalContainer", arg0, arg1, arg2)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // SignalContainer indicates an expected call of SignalContainer
-func (mr *MockRuncClientMockRecorder) SignalContainer(arg0, arg1 interface{}) *gomock.Call {
+func (mr *MockRuncClientMockRecorder) SignalContainer(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SignalContainer", reflect.TypeOf((*MockRuncClient)(nil).SignalContainer), arg0, arg1, arg2)
+}
+
+// Stats mocks base method
+func (m *MockRuncClient) Stats(arg0 context.Context, arg1 string) (*models.Stats, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Stats", arg0, arg1)
+	ret0, _ := ret[0].(*models.Stats)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Stats indicates an expected call of Stats
+func (mr *MockRuncClientMockRecorder) Stats(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Stats", reflect.TypeOf((*MockRuncClient)(nil).Stats), arg0, arg1)
+}
+
+// UpdateContainer mocks base method
+func (m *MockRuncClient) UpdateContainer(arg0 context.Context, arg1 string, arg2 *specs.LinuxResources) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateContainer", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateContainer indicates an expected call of UpdateContainer
+func (mr *MockRuncClientMockRecorder) UpdateContainer(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateContainer", reflect.TypeOf((*MockRuncClient)(nil).UpdateContainer), arg0, arg1, arg2)
+}
+
+// MockSpecMutator is a mock of SpecMutator interface
+type MockSpecMutator struct {
+	ctrl     *gomock.Controller
+	recorder *MockSpecMutatorMockRecorder
+}
+
+// MockSpecMutatorMockRecorder is the mock recorder for MockSpecMutator
+type MockSpecMutatorMockRecorder struct {
+	mock *MockSpecMutator
+}
+
+// NewMockSpecMutator creates a new mock instance
+func NewMockSpecMutator(ctrl *gomock.Controller) *MockSpecMutator {
+	mock := &MockSpecMutator{ctrl: ctrl}
+	mock.recorder = &MockSpecMutatorMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockSpecMutator) EXPECT() *MockSpecMutatorMockRecorder {
+	return m.recorder
+}
+
+// MutateSpec mocks base method
+func (m *MockSpecMutator) MutateSpec(arg0 context.Context, arg1 lager.Logger, arg2 *config.BPMConfig, arg3 *config.ProcessConfig, arg4 specs.Spec) (specs.Spec, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MutateSpec", arg0, arg1, arg2, arg3, arg4)
+	ret0, _ := ret[0].(specs.Spec)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// MutateSpec indicates an expected call of MutateSpec
+func (mr *MockSpecMutatorMockRecorder) MutateSpec(arg0, arg1, arg2, arg3, arg4 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MutateSpec", reflect.TypeOf((*MockSpecMutator)(nil).MutateSpec), arg0, arg1, arg2, arg3, arg4)
+}
+
+// MockLogLimiter is a mock of LogLimiter interface
+type MockLogLimiter struct {
+	ctrl     *gomock.Controller
+	recorder *MockLogLimiterMockRecorder
+}
+
+// MockLogLimiterMockRecorder is the mock recorder for MockLogLimiter
+type MockLogLimiterMockRecorder struct {
+	mock *MockLogLimiter
+}
+
+// NewMockLogLimiter creates a new mock instance
+func NewMockLogLimiter(ctrl *gomock.Controller) *MockLogLimiter {
+	mock := &MockLogLimiter{ctrl: ctrl}
+	mock.recorder = &MockLogLimiterMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockLogLimiter) EXPECT() *MockLogLimiterMockRecorder {
+	return m.recorder
+}
+
+// Relay mocks base method
+func (m *MockLogLimiter) Relay(arg0 *config.BPMConfig, arg1 logsink.Stream) (*os.File, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Relay", arg0, arg1)
+	ret0, _ := ret[0].(*os.File)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Relay indicates an expected call of Relay
+func (mr *MockLogLimiterMockRecorder) Relay(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Relay", reflect.TypeOf((*MockLogLimiter)(nil).Relay), arg0, arg1)
+}
+
+// Writer mocks base method
+func (m *MockLogLimiter) Writer(arg0 io.Writer) *loglimit.Truncator {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Writer", arg0)
+	ret0, _ := ret[0].(*loglimit.Truncator)
+	return ret0
+}
+
+// Writer indicates an expected call of Writer
+func (mr *MockLogLimiterMockRecorder) Writer(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Writer", reflect.TypeOf((*MockLogLimiter)(nil).Writer), arg0)
+}
+
+// MockExecutableChecker is a mock of ExecutableChecker interface
+type MockExecutableChecker struct {
+	ctrl     *gomock.Controller
+	recorder *MockExecutableCheckerMockRecorder
+}
+
+// MockExecutableCheckerMockRecorder is the mock recorder for MockExecutableChecker
+type MockExecutableCheckerMockRecorder struct {
+	mock *MockExecutableChecker
+}
+
+// NewMockExecutableChecker creates a new mock instance
+func NewMockExecutableChecker(ctrl *gomock.Controller) *MockExecutableChecker {
+	mock := &MockExecutableChecker{ctrl: ctrl}
+	mock.recorder = &MockExecutableCheckerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockExecutableChecker) EXPECT() *MockExecutableCheckerMockRecorder {
+	return m.recorder
+}
+
+// CheckExecutable mocks base method
+func (m *MockExecutableChecker) CheckExecutable(arg0 *config.BPMConfig, arg1 *config.ProcessConfig, arg2 specs.Spec) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CheckExecutable", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CheckExecutable indicates an expected call of CheckExecutable
+func (mr *MockExecutableCheckerMockRecorder) CheckExecutable(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CheckExecutable", reflect.TypeOf((*MockExecutableChecker)(nil).CheckExecutable), arg0, arg1, arg2)
+}
+
+// MockAdmissionController is a mock of AdmissionController interface
+type MockAdmissionController struct {
+	ctrl     *gomock.Controller
+	recorder *MockAdmissionControllerMockRecorder
+}
+
+// MockAdmissionControllerMockRecorder is the mock recorder for MockAdmissionController
+type MockAdmissionControllerMockRecorder struct {
+	mock *MockAdmissionController
+}
+
+// NewMockAdmissionController creates a new mock instance
+func NewMockAdmissionController(ctrl *gomock.Controller) *MockAdmissionController {
+	mock := &MockAdmissionController{ctrl: ctrl}
+	mock.recorder = &MockAdmissionControllerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockAdmissionController) EXPECT() *MockAdmissionControllerMockRecorder {
+	return m.recorder
+}
+
+// Admit mocks base method
+func (m *MockAdmissionController) Admit(arg0 context.Context, arg1 lager.Logger, arg2 *config.BPMConfig, arg3 specs.Spec) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Admit", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Admit indicates an expected call of Admit
+func (mr *MockAdmissionControllerMockRecorder) Admit(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SignalContainer", reflect.TypeOf((*MockRuncClient)(nil).SignalContainer), arg0, arg1)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Admit", reflect.TypeOf((*MockAdmissionController)(nil).Admit), arg0, arg1, arg2, arg3)
 }
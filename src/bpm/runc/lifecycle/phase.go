@@ -0,0 +1,80 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package lifecycle
+
+import "errors"
+
+// The phases of starting a process which a StartError can be tagged with.
+// They tell apart problems with the job's configuration (spec-build), with
+// the host's filesystem (prerequisites, bundle-create), with the job's own
+// hook (pre-start), and with the container runtime (runc-run).
+const (
+	PhaseUserLookup    = "user-lookup"
+	PhasePrerequisites = "prerequisites"
+	PhaseSpecBuild     = "spec-build"
+	PhaseBundleCreate  = "bundle-create"
+	PhasePreStart      = "pre-start"
+	PhaseRuncRun       = "runc-run"
+)
+
+// StartError is returned when a process could not be started, along with the
+// phase of starting it which failed. Its message is that of Err: callers
+// decide how to present the phase.
+type StartError struct {
+	Phase string
+	Err   error
+
+	// Log is a file which holds more detail about the failure, such as
+	// runc's own log when the container could not be run. It is empty
+	// when there is no such file.
+	Log string
+}
+
+func (e *StartError) Error() string { return e.Err.Error() }
+
+func (e *StartError) Unwrap() error { return e.Err }
+
+// StartPhase returns the phase which a failed start failed in, or an empty
+// string if err did not come from starting a process.
+func StartPhase(err error) string {
+	var startErr *StartError
+	if errors.As(err, &startErr) {
+		return startErr.Phase
+	}
+
+	return ""
+}
+
+// StartFailureLog returns the file which holds more detail about a failed
+// start, or an empty string if there is none.
+func StartFailureLog(err error) string {
+	var startErr *StartError
+	if errors.As(err, &startErr) {
+		return startErr.Log
+	}
+
+	return ""
+}
+
+// inPhase tags an error with the phase of starting a process which it
+// happened in. Errors which have already been tagged keep their phase.
+func inPhase(phase string, err error) error {
+	if err == nil || StartPhase(err) != "" {
+		return err
+	}
+
+	return &StartError{Phase: phase, Err: err}
+}
@@ -0,0 +1,70 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package lifecycle
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+
+	"bpm/config"
+	"bpm/models"
+)
+
+// PrerequisitePollInterval is how often the state of prerequisite processes
+// is checked while waiting for them to start.
+const PrerequisitePollInterval = 500 * time.Millisecond
+
+// WaitForProcesses blocks until every one of the processes is running. An
+// adopted process counts as running while it is alive. An error is returned
+// if they are not all running before the timeout.
+func (j *RuncLifecycle) WaitForProcesses(ctx context.Context, logger lager.Logger, cfgs []*config.BPMConfig, timeout time.Duration) error {
+	deadline := j.clock.Now().Add(timeout)
+
+	for _, cfg := range cfgs {
+		for !j.isRunning(ctx, cfg) {
+			if !j.clock.Now().Before(deadline) {
+				return fmt.Errorf("timed out waiting for %s/%s to start", cfg.JobName(), cfg.ProcName())
+			}
+
+			logger.Info("waiting-for-prerequisite", lager.Data{
+				"job":     cfg.JobName(),
+				"process": cfg.ProcName(),
+			})
+
+			if err := j.sleep(ctx, PrerequisitePollInterval); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (j *RuncLifecycle) isRunning(ctx context.Context, cfg *config.BPMConfig) bool {
+	if process, err := j.StatAdoptedProcess(cfg); err == nil {
+		return process.Status == models.ProcessStateAdopted
+	}
+
+	container, err := j.runcClient.ContainerState(ctx, cfg.ContainerID())
+	if err != nil || container == nil {
+		return false
+	}
+
+	return container.Status == ContainerStateRunning
+}
@@ -0,0 +1,145 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package lifecycle_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/lager/lagertest"
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+
+	"bpm/bosh"
+	"bpm/config"
+	"bpm/runc/lifecycle"
+	"bpm/runc/lifecycle/mock_lifecycle"
+)
+
+var _ = Describe("WaitForProcesses", func() {
+	var (
+		mockCtrl       *gomock.Controller
+		fakeRuncClient *mock_lifecycle.MockRuncClient
+		fakeClock      *fakeclock.FakeClock
+		logger         *lagertest.TestLogger
+		ctx            context.Context
+
+		boshRoot string
+		cfgs     []*config.BPMConfig
+
+		runcLifecycle *lifecycle.RuncLifecycle
+	)
+
+	BeforeEach(func() {
+		mockCtrl = gomock.NewController(GinkgoT())
+		fakeRuncClient = mock_lifecycle.NewMockRuncClient(mockCtrl)
+		fakeClock = fakeclock.NewFakeClock(time.Now())
+		logger = lagertest.NewTestLogger("prerequisites")
+		ctx = context.Background()
+
+		var err error
+		boshRoot, err = ioutil.TempDir("", "prerequisites")
+		Expect(err).NotTo(HaveOccurred())
+
+		env := bosh.NewEnv(boshRoot)
+		cfgs = []*config.BPMConfig{
+			config.NewBPMConfig(env, "database", "server"),
+			config.NewBPMConfig(env, "database", "backup"),
+		}
+
+		runcLifecycle = lifecycle.NewRuncLifecycle(
+			fakeRuncClient,
+			mock_lifecycle.NewMockRuncAdapter(mockCtrl),
+			mock_lifecycle.NewMockUserFinder(mockCtrl),
+			mock_lifecycle.NewMockCommandRunner(mockCtrl),
+			fakeClock,
+			os.Remove,
+			nil,
+			nil,
+			nil,
+			nil,
+		)
+	})
+
+	AfterEach(func() {
+		mockCtrl.Finish()
+		Expect(os.RemoveAll(boshRoot)).To(Succeed())
+	})
+
+	state := func(status specs.ContainerState) *specs.State {
+		return &specs.State{Status: status, Pid: 1234}
+	}
+
+	It("returns once every process is running", func() {
+		fakeRuncClient.EXPECT().ContainerState(gomock.Any(), cfgs[0].ContainerID()).Return(state("running"), nil)
+		fakeRuncClient.EXPECT().ContainerState(gomock.Any(), cfgs[1].ContainerID()).Return(state("running"), nil)
+
+		Expect(runcLifecycle.WaitForProcesses(ctx, logger, cfgs, time.Minute)).To(Succeed())
+	})
+
+	It("polls processes which are not yet running", func() {
+		gomock.InOrder(
+			fakeRuncClient.EXPECT().ContainerState(gomock.Any(), cfgs[0].ContainerID()).Return(nil, nil),
+			fakeRuncClient.EXPECT().ContainerState(gomock.Any(), cfgs[0].ContainerID()).Return(state("running"), nil),
+			fakeRuncClient.EXPECT().ContainerState(gomock.Any(), cfgs[1].ContainerID()).Return(state("running"), nil),
+		)
+
+		errCh := make(chan error)
+		go func() {
+			errCh <- runcLifecycle.WaitForProcesses(ctx, logger, cfgs, time.Minute)
+		}()
+
+		fakeClock.WaitForWatcherAndIncrement(lifecycle.PrerequisitePollInterval)
+		Eventually(errCh).Should(Receive(BeNil()))
+		Expect(logger).To(gbytes.Say("waiting-for-prerequisite"))
+	})
+
+	It("returns an error if a process does not start within the timeout", func() {
+		fakeRuncClient.EXPECT().ContainerState(gomock.Any(), cfgs[0].ContainerID()).Return(state("stopped"), nil).Times(2)
+
+		errCh := make(chan error)
+		go func() {
+			errCh <- runcLifecycle.WaitForProcesses(ctx, logger, cfgs, lifecycle.PrerequisitePollInterval)
+		}()
+
+		fakeClock.WaitForWatcherAndIncrement(lifecycle.PrerequisitePollInterval)
+
+		var err error
+		Eventually(errCh).Should(Receive(&err))
+		Expect(err).To(MatchError("timed out waiting for database/server to start"))
+	})
+
+	It("returns an error if the context is cancelled while waiting", func() {
+		fakeRuncClient.EXPECT().ContainerState(gomock.Any(), cfgs[0].ContainerID()).Return(nil, nil)
+
+		ctx, cancel := context.WithCancel(ctx)
+		errCh := make(chan error)
+		go func() {
+			errCh <- runcLifecycle.WaitForProcesses(ctx, logger, cfgs, time.Minute)
+		}()
+
+		Eventually(fakeClock.WatcherCount).Should(Equal(1))
+		cancel()
+
+		Eventually(errCh).Should(Receive(Equal(context.Canceled)))
+	})
+})
@@ -0,0 +1,47 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package lifecycle
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"code.cloudfoundry.org/lager"
+
+	"bpm/config"
+)
+
+// The marker which keeps a stopped container around lives in its bundle so
+// that it is removed along with everything else when the container is
+// finally deleted.
+func preservedPath(cfg *config.BPMConfig) string {
+	return filepath.Join(cfg.BundlePath(), "preserved")
+}
+
+// PreserveProcess marks the stopped container of a process as being kept for
+// inspection rather than having been left behind by a process which exited.
+func (j *RuncLifecycle) PreserveProcess(logger lager.Logger, cfg *config.BPMConfig) error {
+	logger.Info("preserving-container")
+	return ioutil.WriteFile(preservedPath(cfg), nil, 0600)
+}
+
+// IsPreserved reports whether the container of a process was kept when it was
+// stopped.
+func IsPreserved(cfg *config.BPMConfig) bool {
+	_, err := os.Stat(preservedPath(cfg))
+	return err == nil
+}
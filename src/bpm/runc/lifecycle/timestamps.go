@@ -0,0 +1,89 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package lifecycle
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+
+	"bpm/config"
+	"bpm/models"
+)
+
+// timestamps records when a process's container was created and when the
+// process in it was started. runc does not keep track of these for us so they
+// are stored alongside the bundle and are removed with it.
+type timestamps struct {
+	CreatedAt time.Time `json:"created_at"`
+	StartedAt time.Time `json:"started_at"`
+}
+
+func timestampsPath(cfg *config.BPMConfig) string {
+	return filepath.Join(cfg.BundlePath(), "timestamps.json")
+}
+
+func readTimestamps(cfg *config.BPMConfig) (timestamps, error) {
+	var ts timestamps
+
+	data, err := ioutil.ReadFile(timestampsPath(cfg))
+	if err != nil {
+		return ts, err
+	}
+
+	err = json.Unmarshal(data, &ts)
+	return ts, err
+}
+
+// recordTimestamp updates the stored timestamps of a process. Failing to do
+// so only affects what bpm reports so the error is logged rather than
+// returned.
+func (j *RuncLifecycle) recordTimestamp(logger lager.Logger, cfg *config.BPMConfig, update func(*timestamps, time.Time)) {
+	ts, _ := readTimestamps(cfg)
+	update(&ts, j.clock.Now())
+
+	data, err := json.Marshal(ts)
+	if err == nil {
+		err = ioutil.WriteFile(timestampsPath(cfg), data, 0600)
+	}
+
+	if err != nil {
+		logger.Error("failed-to-record-timestamps", err)
+	}
+}
+
+func created(ts *timestamps, now time.Time) {
+	*ts = timestamps{CreatedAt: now}
+}
+
+func started(ts *timestamps, now time.Time) {
+	ts.StartedAt = now
+}
+
+// ApplyTimestamps adds the creation and start times of a process if they
+// were recorded when it was started.
+func ApplyTimestamps(cfg *config.BPMConfig, process *models.Process) {
+	ts, err := readTimestamps(cfg)
+	if err != nil {
+		return
+	}
+
+	process.CreatedAt = ts.CreatedAt
+	process.StartedAt = ts.StartedAt
+}
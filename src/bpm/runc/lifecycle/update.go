@@ -0,0 +1,278 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package lifecycle
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"code.cloudfoundry.org/lager"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+
+	"bpm/config"
+	"bpm/usertools"
+)
+
+// LimitUpdate is what UpdateProcess changed about a running process. Changed
+// names the limits which were applied, by the names they have in the job
+// configuration. RestartNeeded is set when the configuration also changed in
+// ways which only take effect once the process is started again.
+type LimitUpdate struct {
+	Changed       []string
+	RestartNeeded bool
+}
+
+// UpdateProcess applies the memory, CPU, and pids limits which the
+// configuration of a process now gives it to its running container without
+// restarting it. The spec in the process's bundle is updated to match so that
+// the limits are not reported as having drifted.
+func (j *RuncLifecycle) UpdateProcess(ctx context.Context, logger lager.Logger, bpmCfg *config.BPMConfig, procCfg *config.ProcessConfig) (*LimitUpdate, error) {
+	ctx, span := startSpan(ctx, "update-process", bpmCfg)
+	update, err := j.updateProcess(ctx, logger, bpmCfg, procCfg)
+	span.End(err)
+	return update, err
+}
+
+func (j *RuncLifecycle) updateProcess(ctx context.Context, logger lager.Logger, bpmCfg *config.BPMConfig, procCfg *config.ProcessConfig) (*LimitUpdate, error) {
+	user, err := j.userFinder.Lookup(usertools.VcapUser)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("building-spec")
+	spec, err := j.runcAdapter.BuildSpec(logger, bpmCfg, procCfg, user)
+	if err != nil {
+		return nil, err
+	}
+
+	if j.specMutator != nil {
+		logger.Info("mutating-spec")
+		spec, err = j.specMutator.MutateSpec(ctx, logger, bpmCfg, procCfg, spec)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := j.admit(ctx, logger, bpmCfg, spec); err != nil {
+		return nil, err
+	}
+
+	current, err := j.runcClient.BundleSpec(bpmCfg.BundlePath())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read container configuration: %s", err)
+	}
+
+	resources, changed := updatedResources(current, &spec)
+	update := &LimitUpdate{Changed: changed}
+
+	if len(changed) > 0 {
+		logger.Info("updating-container", lager.Data{"limits": changed})
+		if err := j.runcClient.UpdateContainer(ctx, bpmCfg.ContainerID(), resources); err != nil {
+			return nil, err
+		}
+	}
+
+	// The bundle takes on the checksum of the new configuration only if
+	// nothing but the updated limits differ, so that a process whose
+	// other settings have changed is still restarted when it is next
+	// started with --reuse-bundle or noticed by `bpm watch`.
+	applyResources(current, &spec)
+	update.RestartNeeded = !sameSpec(current, &spec)
+	if !update.RestartNeeded {
+		if current.Annotations == nil {
+			current.Annotations = map[string]string{}
+		}
+		current.Annotations[config.ConfigChecksumAnnotation] = spec.Annotations[config.ConfigChecksumAnnotation]
+	}
+
+	if len(changed) == 0 && update.RestartNeeded {
+		return update, nil
+	}
+
+	logger.Info("updating-bundle")
+	if err := j.runcClient.CreateBundle(bpmCfg.BundlePath(), *current, user); err != nil {
+		return nil, fmt.Errorf("failed to update container configuration: %s", err)
+	}
+
+	return update, nil
+}
+
+// updatedResources returns the resources which runc must be given to bring
+// the limits of a container built from current up to those of desired, and
+// the names of the limits which differ. A limit which has been removed is
+// lifted rather than left out, which runc would take as no change.
+func updatedResources(current, desired *specs.Spec) (*specs.LinuxResources, []string) {
+	var (
+		from, to = resourcesOf(current), resourcesOf(desired)
+		changed  []string
+		update   specs.LinuxResources
+	)
+
+	unlimited := int64(-1)
+	defaultShares := uint64(1024)
+
+	memory := func(r *specs.LinuxResources) specs.LinuxMemory {
+		if r.Memory == nil {
+			return specs.LinuxMemory{}
+		}
+		return *r.Memory
+	}
+	cpu := func(r *specs.LinuxResources) specs.LinuxCPU {
+		if r.CPU == nil {
+			return specs.LinuxCPU{}
+		}
+		return *r.CPU
+	}
+
+	oldMem, newMem := memory(from), memory(to)
+	var mem specs.LinuxMemory
+	if !sameInt(oldMem.Limit, newMem.Limit) {
+		changed = append(changed, "memory")
+		mem.Limit = orInt(newMem.Limit, unlimited)
+	}
+	if !sameInt(oldMem.Swap, newMem.Swap) {
+		changed = append(changed, "swap")
+		mem.Swap = orInt(newMem.Swap, unlimited)
+	}
+	if !sameInt(oldMem.Reservation, newMem.Reservation) {
+		changed = append(changed, "memory_reservation")
+		mem.Reservation = orInt(newMem.Reservation, unlimited)
+	}
+	if mem != (specs.LinuxMemory{}) {
+		update.Memory = &mem
+	}
+
+	oldCPU, newCPU := cpu(from), cpu(to)
+	var c specs.LinuxCPU
+	if !sameInt(oldCPU.Quota, newCPU.Quota) || !sameUint(oldCPU.Period, newCPU.Period) {
+		changed = append(changed, "cpus")
+		c.Quota = orInt(newCPU.Quota, unlimited)
+		c.Period = newCPU.Period
+	}
+	if !sameUint(oldCPU.Shares, newCPU.Shares) {
+		changed = append(changed, "cpu_shares")
+		c.Shares = newCPU.Shares
+		if c.Shares == nil {
+			c.Shares = &defaultShares
+		}
+	}
+	if c != (specs.LinuxCPU{}) {
+		update.CPU = &c
+	}
+
+	oldPids, newPids := unlimited, unlimited
+	if from.Pids != nil {
+		oldPids = from.Pids.Limit
+	}
+	if to.Pids != nil {
+		newPids = to.Pids.Limit
+	}
+	if oldPids != newPids {
+		changed = append(changed, "processes")
+		update.Pids = &specs.LinuxPids{Limit: newPids}
+	}
+
+	return &update, changed
+}
+
+// applyResources copies the memory, CPU, and pids limits of desired into
+// spec, leaving the rest of spec as it is.
+func applyResources(spec, desired *specs.Spec) {
+	if spec.Linux == nil {
+		spec.Linux = &specs.Linux{}
+	}
+	if spec.Linux.Resources == nil {
+		spec.Linux.Resources = &specs.LinuxResources{}
+	}
+	res, want := spec.Linux.Resources, resourcesOf(desired)
+
+	var memory specs.LinuxMemory
+	if res.Memory != nil {
+		memory = *res.Memory
+	}
+	memory.Limit, memory.Swap, memory.Reservation = nil, nil, nil
+	if want.Memory != nil {
+		memory.Limit, memory.Swap, memory.Reservation = want.Memory.Limit, want.Memory.Swap, want.Memory.Reservation
+	}
+	res.Memory = nil
+	if memory != (specs.LinuxMemory{}) {
+		res.Memory = &memory
+	}
+
+	var cpu specs.LinuxCPU
+	if res.CPU != nil {
+		cpu = *res.CPU
+	}
+	cpu.Shares, cpu.Quota, cpu.Period = nil, nil, nil
+	if want.CPU != nil {
+		cpu.Shares, cpu.Quota, cpu.Period = want.CPU.Shares, want.CPU.Quota, want.CPU.Period
+	}
+	res.CPU = nil
+	if cpu != (specs.LinuxCPU{}) {
+		res.CPU = &cpu
+	}
+
+	res.Pids = want.Pids
+}
+
+// sameSpec reports whether two specs would create the same container, apart
+// from the checksum of the configuration they were built from.
+func sameSpec(a, b *specs.Spec) bool {
+	encode := func(spec *specs.Spec) []byte {
+		s := *spec
+		s.Annotations = map[string]string{}
+		for k, v := range spec.Annotations {
+			if k != config.ConfigChecksumAnnotation {
+				s.Annotations[k] = v
+			}
+		}
+
+		data, _ := json.Marshal(&s)
+		return data
+	}
+
+	return bytes.Equal(encode(a), encode(b))
+}
+
+func resourcesOf(spec *specs.Spec) *specs.LinuxResources {
+	if spec.Linux == nil || spec.Linux.Resources == nil {
+		return &specs.LinuxResources{}
+	}
+	return spec.Linux.Resources
+}
+
+func sameInt(a, b *int64) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func sameUint(a, b *uint64) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func orInt(v *int64, fallback int64) *int64 {
+	if v == nil {
+		return &fallback
+	}
+	return v
+}
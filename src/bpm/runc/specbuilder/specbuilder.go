@@ -119,6 +119,14 @@ func WithNamespace(namespace specs.LinuxNamespaceType) SpecOption {
 	}
 }
 
+// WithHostname sets the hostname of the container, which must have its own
+// UTS namespace.
+func WithHostname(hostname string) SpecOption {
+	return func(spec *specs.Spec) {
+		spec.Hostname = hostname
+	}
+}
+
 func WithUser(user specs.User) SpecOption {
 	return func(spec *specs.Spec) {
 		spec.Process.User = user
@@ -155,6 +163,24 @@ func WithMounts(mounts []specs.Mount) SpecOption {
 	}
 }
 
+func WithAnnotations(annotations map[string]string) SpecOption {
+	return func(spec *specs.Spec) {
+		if spec.Annotations == nil {
+			spec.Annotations = map[string]string{}
+		}
+
+		for k, v := range annotations {
+			spec.Annotations[k] = v
+		}
+	}
+}
+
+func WithHooks(hooks *specs.Hooks) SpecOption {
+	return func(spec *specs.Spec) {
+		spec.Hooks = hooks
+	}
+}
+
 func WithMemoryLimit(limit int64, features sysfeat.Features) SpecOption {
 	return func(spec *specs.Spec) {
 		spec.Linux.Resources.Memory = &specs.LinuxMemory{
@@ -167,6 +193,161 @@ func WithMemoryLimit(limit int64, features sysfeat.Features) SpecOption {
 	}
 }
 
+// WithSwapLimit limits the memory and swap which the process uses together.
+// It must follow WithMemoryLimit.
+func WithSwapLimit(limit int64) SpecOption {
+	return func(spec *specs.Spec) {
+		spec.Linux.Resources.Memory.Swap = &limit
+	}
+}
+
+// WithMemoryReservation sets a soft limit which the process's memory is
+// reclaimed down to when the host is short of memory.
+func WithMemoryReservation(reservation int64) SpecOption {
+	return func(spec *specs.Spec) {
+		if spec.Linux.Resources.Memory == nil {
+			spec.Linux.Resources.Memory = &specs.LinuxMemory{}
+		}
+
+		spec.Linux.Resources.Memory.Reservation = &reservation
+	}
+}
+
+// WithKernelMemoryLimit limits the memory which the kernel uses on behalf of
+// the process.
+func WithKernelMemoryLimit(limit int64) SpecOption {
+	return func(spec *specs.Spec) {
+		if spec.Linux.Resources.Memory == nil {
+			spec.Linux.Resources.Memory = &specs.LinuxMemory{}
+		}
+
+		spec.Linux.Resources.Memory.Kernel = &limit
+	}
+}
+
+// WithSwappiness sets how readily the kernel swaps out the process's memory.
+func WithSwappiness(swappiness uint64) SpecOption {
+	return func(spec *specs.Spec) {
+		if spec.Linux.Resources.Memory == nil {
+			spec.Linux.Resources.Memory = &specs.LinuxMemory{}
+		}
+
+		spec.Linux.Resources.Memory.Swappiness = &swappiness
+	}
+}
+
+// WithBlockIOWeight sets the process's share of the bandwidth of the disks it
+// uses when other processes are competing for them.
+func WithBlockIOWeight(weight uint16) SpecOption {
+	return func(spec *specs.Spec) {
+		if spec.Linux.Resources.BlockIO == nil {
+			spec.Linux.Resources.BlockIO = &specs.LinuxBlockIO{}
+		}
+
+		spec.Linux.Resources.BlockIO.Weight = &weight
+	}
+}
+
+// WithNetClassID tags the network packets which the process sends with a
+// net_cls class ID.
+func WithNetClassID(classID uint32) SpecOption {
+	return func(spec *specs.Spec) {
+		if spec.Linux.Resources.Network == nil {
+			spec.Linux.Resources.Network = &specs.LinuxNetwork{}
+		}
+
+		spec.Linux.Resources.Network.ClassID = &classID
+	}
+}
+
+// WithHugepageLimits limits how much of each size of huge page the process
+// may use.
+func WithHugepageLimits(limits []specs.LinuxHugepageLimit) SpecOption {
+	return func(spec *specs.Spec) {
+		spec.Linux.Resources.HugepageLimits = limits
+	}
+}
+
+// WithBlockIOThrottle adds limits on how fast the process may read from and
+// write to block devices.
+func WithBlockIOThrottle(readBPS, writeBPS, readIOPS, writeIOPS []specs.LinuxThrottleDevice) SpecOption {
+	return func(spec *specs.Spec) {
+		if spec.Linux.Resources.BlockIO == nil {
+			spec.Linux.Resources.BlockIO = &specs.LinuxBlockIO{}
+		}
+
+		blockIO := spec.Linux.Resources.BlockIO
+		blockIO.ThrottleReadBpsDevice = append(blockIO.ThrottleReadBpsDevice, readBPS...)
+		blockIO.ThrottleWriteBpsDevice = append(blockIO.ThrottleWriteBpsDevice, writeBPS...)
+		blockIO.ThrottleReadIOPSDevice = append(blockIO.ThrottleReadIOPSDevice, readIOPS...)
+		blockIO.ThrottleWriteIOPSDevice = append(blockIO.ThrottleWriteIOPSDevice, writeIOPS...)
+	}
+}
+
+// WithDevices creates device nodes in the container and adds rules to its
+// device cgroup which allow the process to use them.
+func WithDevices(devices []specs.LinuxDevice, rules []specs.LinuxDeviceCgroup) SpecOption {
+	return func(spec *specs.Spec) {
+		spec.Linux.Devices = append(spec.Linux.Devices, devices...)
+		spec.Linux.Resources.Devices = append(spec.Linux.Resources.Devices, rules...)
+	}
+}
+
+func WithCPUSet(cpus, mems string) SpecOption {
+	return func(spec *specs.Spec) {
+		if spec.Linux.Resources.CPU == nil {
+			spec.Linux.Resources.CPU = &specs.LinuxCPU{}
+		}
+
+		spec.Linux.Resources.CPU.Cpus = cpus
+		spec.Linux.Resources.CPU.Mems = mems
+	}
+}
+
+// WithRealtimeBudget limits how much CPU time the realtime tasks of the
+// container may use in every period, both in microseconds.
+func WithRealtimeBudget(runtime int64, period uint64) SpecOption {
+	return func(spec *specs.Spec) {
+		if spec.Linux.Resources.CPU == nil {
+			spec.Linux.Resources.CPU = &specs.LinuxCPU{}
+		}
+
+		spec.Linux.Resources.CPU.RealtimeRuntime = &runtime
+		spec.Linux.Resources.CPU.RealtimePeriod = &period
+	}
+}
+
+// WithCPULimit limits the process to the given amount of CPU time in every
+// period, both in microseconds.
+func WithCPULimit(quota int64, period uint64) SpecOption {
+	return func(spec *specs.Spec) {
+		if spec.Linux.Resources.CPU == nil {
+			spec.Linux.Resources.CPU = &specs.LinuxCPU{}
+		}
+
+		spec.Linux.Resources.CPU.Quota = &quota
+		spec.Linux.Resources.CPU.Period = &period
+	}
+}
+
+// WithCPUShares sets the weight of the process against the other processes on
+// the host when they compete for CPU time.
+func WithCPUShares(shares uint64) SpecOption {
+	return func(spec *specs.Spec) {
+		if spec.Linux.Resources.CPU == nil {
+			spec.Linux.Resources.CPU = &specs.LinuxCPU{}
+		}
+
+		spec.Linux.Resources.CPU.Shares = &shares
+	}
+}
+
+func WithCgroupsPath(path string) SpecOption {
+	return func(spec *specs.Spec) {
+		spec.Linux.CgroupsPath = path
+	}
+}
+
 func WithPidLimit(limit int64) SpecOption {
 	return func(spec *specs.Spec) {
 		spec.Linux.Resources.Pids = &specs.LinuxPids{
@@ -176,9 +357,28 @@ func WithPidLimit(limit int64) SpecOption {
 }
 
 func WithOpenFileLimit(limit uint64) SpecOption {
+	return WithRlimit("RLIMIT_NOFILE", limit)
+}
+
+// WithCoreLimit limits the size of the core dumps written for the process.
+func WithCoreLimit(limit uint64) SpecOption {
+	return WithRlimit("RLIMIT_CORE", limit)
+}
+
+// WithOOMScoreAdj biases the kernel's OOM killer towards (positive values) or
+// away from (negative values) the process.
+func WithOOMScoreAdj(adj int) SpecOption {
+	return func(spec *specs.Spec) {
+		spec.Process.OOMScoreAdj = &adj
+	}
+}
+
+// WithRlimit sets both the soft and hard values of a resource limit of the
+// process, such as RLIMIT_CORE.
+func WithRlimit(resource string, limit uint64) SpecOption {
 	return func(spec *specs.Spec) {
 		spec.Process.Rlimits = append(spec.Process.Rlimits, specs.POSIXRlimit{
-			Type: "RLIMIT_NOFILE",
+			Type: resource,
 			Hard: limit,
 			Soft: limit,
 		})
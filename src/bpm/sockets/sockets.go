@@ -0,0 +1,177 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+// Package sockets gives the unix sockets which a process serves on the
+// ownership and permissions which its configuration asks for. The process
+// creates its sockets itself, often some time after it has started and again
+// whenever it restarts its server, so they are watched for rather than set
+// once.
+package sockets
+
+import (
+	"fmt"
+	"os"
+	osuser "os/user"
+	"strconv"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"golang.org/x/sys/unix"
+
+	"bpm/config"
+	"bpm/helpers"
+)
+
+// HelperKind is the kind of the helper which watches for the sockets of a
+// process.
+const HelperKind = "socket-watch"
+
+// Socket is where a socket is on the host and the ownership and permissions
+// which it should have.
+type Socket struct {
+	Path string
+	UID  int
+	GID  int
+	Mode os.FileMode
+}
+
+// Ownership returns the user and group who should own a socket, which default
+// to those of the process.
+func Ownership(sock config.Socket, user specs.User) (int, int, error) {
+	uid, gid := int(user.UID), int(user.GID)
+
+	if sock.Owner != "" {
+		u, err := osuser.Lookup(sock.Owner)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid socket owner: %s", err)
+		}
+
+		uid, err = strconv.Atoi(u.Uid)
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+
+	if sock.Group != "" {
+		g, err := osuser.LookupGroup(sock.Group)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid socket group: %s", err)
+		}
+
+		gid, err = strconv.Atoi(g.Gid)
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+
+	return uid, gid, nil
+}
+
+// Resolve works out where each socket of a process is on the host and who
+// should own it.
+func Resolve(bpmCfg *config.BPMConfig, socks []config.Socket, user specs.User) ([]Socket, error) {
+	var resolved []Socket
+	for _, sock := range socks {
+		uid, gid, err := Ownership(sock, user)
+		if err != nil {
+			return nil, err
+		}
+
+		mode, err := sock.FileMode()
+		if err != nil {
+			return nil, err
+		}
+
+		resolved = append(resolved, Socket{
+			Path: bpmCfg.HostPath(sock.Path),
+			UID:  uid,
+			GID:  gid,
+			Mode: mode,
+		})
+	}
+
+	return resolved, nil
+}
+
+// Watcher applies the ownership and permissions of sockets when they appear.
+type Watcher struct {
+	sockets []Socket
+}
+
+func NewWatcher(sockets []Socket) *Watcher {
+	return &Watcher{sockets: sockets}
+}
+
+// Check applies the ownership and permissions of each socket which exists and
+// does not have them yet. It returns the paths of the sockets which it
+// changed.
+func (w *Watcher) Check() ([]string, error) {
+	var changed []string
+	for _, sock := range w.sockets {
+		ok, err := w.check(sock)
+		if err != nil {
+			return changed, err
+		}
+
+		if ok {
+			changed = append(changed, sock.Path)
+		}
+	}
+
+	return changed, nil
+}
+
+func (w *Watcher) check(sock Socket) (bool, error) {
+	// The socket's directory belongs to the process, which could replace
+	// the socket with a link to any other file, so the socket is opened
+	// without following links and changed through the open descriptor.
+	fd, err := unix.Open(sock.Path, unix.O_PATH|unix.O_NOFOLLOW|unix.O_CLOEXEC, 0)
+	if err == unix.ENOENT {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("failed to open socket %s: %s", sock.Path, err)
+	}
+	defer unix.Close(fd)
+
+	var st unix.Stat_t
+	if err := unix.Fstat(fd, &st); err != nil {
+		return false, fmt.Errorf("failed to stat socket %s: %s", sock.Path, err)
+	}
+
+	if st.Mode&unix.S_IFMT != unix.S_IFSOCK {
+		return false, fmt.Errorf("%s is not a socket", sock.Path)
+	}
+
+	if int(st.Uid) == sock.UID && int(st.Gid) == sock.GID && os.FileMode(st.Mode&0777) == sock.Mode {
+		return false, nil
+	}
+
+	if err := unix.Fchownat(fd, "", sock.UID, sock.GID, unix.AT_EMPTY_PATH); err != nil {
+		return false, fmt.Errorf("failed to change the owner of socket %s: %s", sock.Path, err)
+	}
+
+	// fchmod does not work on a descriptor opened with O_PATH, but the
+	// descriptor's link in /proc leads to the socket it was opened on.
+	if err := os.Chmod(fmt.Sprintf("/proc/self/fd/%d", fd), sock.Mode); err != nil {
+		return false, fmt.Errorf("failed to change the mode of socket %s: %s", sock.Path, err)
+	}
+
+	return true, nil
+}
+
+// Start starts the helper which watches for the sockets of the process until
+// it stops.
+func Start(bpmCfg *config.BPMConfig) error {
+	return helpers.Start(bpmCfg.HelpersDir().External(), HelperKind, "socket-watch", bpmCfg.JobName(), "--process", bpmCfg.ProcName())
+}
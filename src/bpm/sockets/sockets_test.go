@@ -0,0 +1,124 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package sockets_test
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+
+	"bpm/config"
+	"bpm/sockets"
+)
+
+var _ = Describe("Sockets", func() {
+	Describe("Ownership", func() {
+		It("defaults to the user and group of the process", func() {
+			uid, gid, err := sockets.Ownership(config.Socket{}, specs.User{UID: 200, GID: 300})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(uid).To(Equal(200))
+			Expect(gid).To(Equal(300))
+		})
+
+		It("looks up the configured owner and group", func() {
+			uid, gid, err := sockets.Ownership(config.Socket{Owner: "root", Group: "root"}, specs.User{UID: 200, GID: 300})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(uid).To(Equal(0))
+			Expect(gid).To(Equal(0))
+		})
+
+		It("returns an error when the group does not exist", func() {
+			_, _, err := sockets.Ownership(config.Socket{Group: "this-group-does-not-exist"}, specs.User{})
+			Expect(err).To(MatchError(ContainSubstring("invalid socket group")))
+		})
+	})
+
+	Describe("Watcher", func() {
+		var (
+			tempDir string
+			path    string
+			watcher *sockets.Watcher
+		)
+
+		listen := func() net.Listener {
+			l, err := net.Listen("unix", path)
+			Expect(err).NotTo(HaveOccurred())
+			return l
+		}
+
+		mode := func() os.FileMode {
+			info, err := os.Lstat(path)
+			Expect(err).NotTo(HaveOccurred())
+			return info.Mode() & os.ModePerm
+		}
+
+		BeforeEach(func() {
+			var err error
+			tempDir, err = ioutil.TempDir("", "sockets")
+			Expect(err).NotTo(HaveOccurred())
+
+			path = filepath.Join(tempDir, "api.sock")
+			watcher = sockets.NewWatcher([]sockets.Socket{
+				{Path: path, UID: os.Getuid(), GID: os.Getgid(), Mode: 0604},
+			})
+		})
+
+		AfterEach(func() {
+			Expect(os.RemoveAll(tempDir)).To(Succeed())
+		})
+
+		It("does nothing until the socket has been created", func() {
+			Expect(watcher.Check()).To(BeEmpty())
+		})
+
+		It("applies the ownership and mode once the socket has been created", func() {
+			l := listen()
+			defer l.Close()
+
+			Expect(watcher.Check()).To(Equal([]string{path}))
+			Expect(mode()).To(Equal(os.FileMode(0604)))
+		})
+
+		It("applies them again when the socket no longer has them", func() {
+			l := listen()
+			defer l.Close()
+			Expect(watcher.Check()).To(HaveLen(1))
+			Expect(watcher.Check()).To(BeEmpty())
+
+			Expect(os.Chmod(path, 0600)).To(Succeed())
+			Expect(watcher.Check()).To(Equal([]string{path}))
+			Expect(mode()).To(Equal(os.FileMode(0604)))
+		})
+
+		It("refuses to follow a link in place of the socket", func() {
+			target := filepath.Join(tempDir, "target")
+			Expect(ioutil.WriteFile(target, nil, 0600)).To(Succeed())
+			Expect(os.Symlink(target, path)).To(Succeed())
+
+			_, err := watcher.Check()
+			Expect(err).To(MatchError(path + " is not a socket"))
+
+			info, err := os.Stat(target)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.Mode() & os.ModePerm).To(Equal(os.FileMode(0600)))
+		})
+	})
+})
@@ -0,0 +1,145 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+// Package specmutator lets operators adjust the OCI spec which bpm generates
+// for a process before the container is created. This allows site-specific
+// policy (extra mounts, seccomp changes, etc.) to be applied without
+// modifying bpm.
+package specmutator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+
+	"bpm/config"
+)
+
+// CommandTimeout is how long a mutator command may run before it is killed
+// and the process fails to start.
+const CommandTimeout = 10 * time.Second
+
+// Mutator adjusts the spec of a process. Implementations in Go can be added
+// to a Chain alongside Commands.
+type Mutator interface {
+	Mutate(ctx context.Context, logger lager.Logger, bpmCfg *config.BPMConfig, procCfg *config.ProcessConfig, spec specs.Spec) (specs.Spec, error)
+}
+
+// Chain applies each of its mutators in order, handing the spec returned by
+// one to the next.
+type Chain []Mutator
+
+func (c Chain) MutateSpec(ctx context.Context, logger lager.Logger, bpmCfg *config.BPMConfig, procCfg *config.ProcessConfig, spec specs.Spec) (specs.Spec, error) {
+	for _, m := range c {
+		var err error
+		spec, err = m.Mutate(ctx, logger, bpmCfg, procCfg, spec)
+		if err != nil {
+			return specs.Spec{}, err
+		}
+	}
+
+	return spec, nil
+}
+
+// Command is a mutator which runs an executable. The executable is given the
+// spec as JSON on stdin and must write the (possibly modified) spec as JSON
+// to stdout. The job and process names are available in the BPM_JOB and
+// BPM_PROCESS environment variables.
+type Command struct {
+	Path string
+}
+
+// NewChain builds a chain of Commands from the paths of their executables.
+func NewChain(paths []string) (Chain, error) {
+	var chain Chain
+	for _, path := range paths {
+		if !filepath.IsAbs(path) {
+			return nil, fmt.Errorf("spec mutator path must be absolute: %s", path)
+		}
+		chain = append(chain, &Command{Path: path})
+	}
+
+	return chain, nil
+}
+
+func (c *Command) Mutate(ctx context.Context, logger lager.Logger, bpmCfg *config.BPMConfig, procCfg *config.ProcessConfig, spec specs.Spec) (specs.Spec, error) {
+	logger = logger.Session("spec-mutator", lager.Data{"path": c.Path})
+	logger.Info("starting")
+	defer logger.Info("complete")
+
+	input, err := json.Marshal(spec)
+	if err != nil {
+		return specs.Spec{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, CommandTimeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, c.Path)
+	cmd.Env = []string{
+		fmt.Sprintf("BPM_JOB=%s", bpmCfg.JobName()),
+		fmt.Sprintf("BPM_PROCESS=%s", bpmCfg.ProcName()),
+		"PATH=/usr/bin:/bin:/usr/sbin:/sbin",
+	}
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return specs.Spec{}, fmt.Errorf("spec mutator %s failed: %s: %s", c.Path, err, strings.TrimSpace(stderr.String()))
+	}
+
+	var mutated specs.Spec
+	if err := json.Unmarshal(stdout.Bytes(), &mutated); err != nil {
+		return specs.Spec{}, fmt.Errorf("spec mutator %s returned an invalid spec: %s", c.Path, err)
+	}
+
+	if err := validate(mutated); err != nil {
+		return specs.Spec{}, fmt.Errorf("spec mutator %s returned an invalid spec: %s", c.Path, err)
+	}
+
+	return mutated, nil
+}
+
+// validate catches mutators which have accidentally discarded the spec (for
+// example by printing nothing but "{}") rather than modified it.
+func validate(spec specs.Spec) error {
+	if spec.Process == nil {
+		return errors.New("process is missing")
+	}
+
+	if spec.Root == nil {
+		return errors.New("root is missing")
+	}
+
+	if spec.Linux == nil {
+		return errors.New("linux is missing")
+	}
+
+	return nil
+}
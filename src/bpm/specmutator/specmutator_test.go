@@ -0,0 +1,148 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package specmutator_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"code.cloudfoundry.org/lager"
+	"code.cloudfoundry.org/lager/lagertest"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+
+	"bpm/bosh"
+	"bpm/config"
+	"bpm/specmutator"
+)
+
+type mutatorFunc func(specs.Spec) (specs.Spec, error)
+
+func (f mutatorFunc) Mutate(_ context.Context, _ lager.Logger, _ *config.BPMConfig, _ *config.ProcessConfig, spec specs.Spec) (specs.Spec, error) {
+	return f(spec)
+}
+
+var _ = Describe("SpecMutator", func() {
+	var (
+		logger  *lagertest.TestLogger
+		bpmCfg  *config.BPMConfig
+		procCfg *config.ProcessConfig
+		spec    specs.Spec
+		tempDir string
+	)
+
+	BeforeEach(func() {
+		var err error
+		tempDir, err = ioutil.TempDir("", "specmutator")
+		Expect(err).NotTo(HaveOccurred())
+
+		logger = lagertest.NewTestLogger("specmutator")
+		bpmCfg = config.NewBPMConfig(bosh.NewEnv(tempDir), "example", "server")
+		procCfg = &config.ProcessConfig{Name: "server", Executable: "/bin/sleep"}
+		spec = specs.Spec{
+			Version:  "1.0.0",
+			Hostname: "example",
+			Process:  &specs.Process{Args: []string{"/bin/sleep"}},
+			Root:     &specs.Root{Path: "/"},
+			Linux:    &specs.Linux{},
+		}
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(tempDir)).To(Succeed())
+	})
+
+	writeMutator := func(name, script string) string {
+		path := filepath.Join(tempDir, name)
+		Expect(ioutil.WriteFile(path, []byte("#!/bin/sh\n"+script), 0700)).To(Succeed())
+		return path
+	}
+
+	Describe("Chain", func() {
+		It("applies each mutator in order", func() {
+			chain := specmutator.Chain{
+				mutatorFunc(func(s specs.Spec) (specs.Spec, error) {
+					s.Hostname = s.Hostname + "-first"
+					return s, nil
+				}),
+				mutatorFunc(func(s specs.Spec) (specs.Spec, error) {
+					s.Hostname = s.Hostname + "-second"
+					return s, nil
+				}),
+			}
+
+			mutated, err := chain.MutateSpec(context.Background(), logger, bpmCfg, procCfg, spec)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(mutated.Hostname).To(Equal("example-first-second"))
+		})
+
+		It("stops at the first error", func() {
+			called := false
+			chain := specmutator.Chain{
+				mutatorFunc(func(s specs.Spec) (specs.Spec, error) {
+					return s, errors.New("policy violation")
+				}),
+				mutatorFunc(func(s specs.Spec) (specs.Spec, error) {
+					called = true
+					return s, nil
+				}),
+			}
+
+			_, err := chain.MutateSpec(context.Background(), logger, bpmCfg, procCfg, spec)
+			Expect(err).To(MatchError("policy violation"))
+			Expect(called).To(BeFalse())
+		})
+	})
+
+	Describe("NewChain", func() {
+		It("rejects relative paths", func() {
+			_, err := specmutator.NewChain([]string{"bin/mutate"})
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("Command", func() {
+		It("passes the spec to the command and uses the spec it prints", func() {
+			path := writeMutator("mutate", `sed 's/"hostname":"example"/"hostname":"'"$BPM_JOB-$BPM_PROCESS"'"/'`)
+
+			chain, err := specmutator.NewChain([]string{path})
+			Expect(err).NotTo(HaveOccurred())
+
+			mutated, err := chain.MutateSpec(context.Background(), logger, bpmCfg, procCfg, spec)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(mutated.Hostname).To(Equal("example-server"))
+			Expect(mutated.Process.Args).To(Equal([]string{"/bin/sleep"}))
+		})
+
+		It("returns an error including stderr if the command fails", func() {
+			path := writeMutator("mutate", "echo 'mounts are not allowed' >&2\nexit 1\n")
+
+			_, err := (&specmutator.Command{Path: path}).Mutate(context.Background(), logger, bpmCfg, procCfg, spec)
+			Expect(err).To(MatchError(ContainSubstring("mounts are not allowed")))
+		})
+
+		It("returns an error if the command does not print a spec", func() {
+			path := writeMutator("mutate", "cat > /dev/null\necho '{}'\n")
+
+			_, err := (&specmutator.Command{Path: path}).Mutate(context.Background(), logger, bpmCfg, procCfg, spec)
+			Expect(err).To(MatchError(ContainSubstring("invalid spec")))
+		})
+	})
+})
@@ -0,0 +1,185 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+// Package statusfile maintains a small file for each process which records
+// what bpm last saw of it. Monitoring scripts can read the file instead of
+// running bpm, which would have to take the process's lock.
+//
+// The file contains one "key=value" pair per line:
+//
+//	state=running
+//	pid=1234
+//	started_at=2021-06-01T12:00:00Z
+//	checked_at=2021-06-01T12:00:05Z
+//	check=ok
+//
+// When the last check failed the check key is "failed" and an additional
+// error key contains the reason.
+package statusfile
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	CheckOK     = "ok"
+	CheckFailed = "failed"
+)
+
+// Status is the content of a status file.
+type Status struct {
+	State string
+	Pid   int
+
+	// StartedAt is when bpm first saw the process running. It is zero if
+	// the process is not running.
+	StartedAt time.Time
+
+	// CheckedAt is when bpm last checked on the process, and Check and Error
+	// are the result.
+	CheckedAt time.Time
+	Check     string
+	Error     string
+}
+
+// Update records that the process was found in the given state at time now.
+// checkErr is the problem bpm found with the process, if any. The start time
+// of a process which is still running with the same pid is kept.
+func Update(path string, now time.Time, state string, pid int, checkErr error) error {
+	status := &Status{
+		State:     state,
+		Pid:       pid,
+		CheckedAt: now,
+		Check:     CheckOK,
+	}
+
+	if checkErr != nil {
+		status.Check = CheckFailed
+		status.Error = checkErr.Error()
+	}
+
+	if pid != 0 {
+		status.StartedAt = now
+		if previous, err := Read(path); err == nil && previous.Pid == pid && !previous.StartedAt.IsZero() {
+			status.StartedAt = previous.StartedAt
+		}
+	}
+
+	return Write(path, status)
+}
+
+// Write replaces the status file at path. Readers never see a partially
+// written file.
+func Write(path string, status *Status) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "state=%s\n", status.State)
+	fmt.Fprintf(&b, "pid=%d\n", status.Pid)
+	fmt.Fprintf(&b, "started_at=%s\n", formatTime(status.StartedAt))
+	fmt.Fprintf(&b, "checked_at=%s\n", formatTime(status.CheckedAt))
+	fmt.Fprintf(&b, "check=%s\n", status.Check)
+	if status.Error != "" {
+		fmt.Fprintf(&b, "error=%s\n", strings.Replace(status.Error, "\n", " ", -1))
+	}
+
+	f, err := ioutil.TempFile(dir, filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.WriteString(b.String()); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Chmod(0644); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
+
+// Read parses the status file at path.
+func Read(path string) (*Status, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	status := &Status{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid status line: %q", scanner.Text())
+		}
+
+		key, value := parts[0], parts[1]
+		switch key {
+		case "state":
+			status.State = value
+		case "pid":
+			status.Pid, err = strconv.Atoi(value)
+		case "started_at":
+			status.StartedAt, err = parseTime(value)
+		case "checked_at":
+			status.CheckedAt, err = parseTime(value)
+		case "check":
+			status.Check = value
+		case "error":
+			status.Error = value
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %s", key, err)
+		}
+	}
+
+	return status, scanner.Err()
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+
+	return t.UTC().Format(time.RFC3339)
+}
+
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	return time.Parse(time.RFC3339, value)
+}
@@ -0,0 +1,117 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package statusfile_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"bpm/statusfile"
+)
+
+var _ = Describe("Status files", func() {
+	var (
+		dir  string
+		path string
+		now  time.Time
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "statusfile")
+		Expect(err).NotTo(HaveOccurred())
+
+		path = filepath.Join(dir, "status", "job.process")
+		now = time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dir)).To(Succeed())
+	})
+
+	It("writes a simple key value format", func() {
+		Expect(statusfile.Update(path, now, "running", 1234, nil)).To(Succeed())
+
+		contents, err := ioutil.ReadFile(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(contents)).To(Equal(`state=running
+pid=1234
+started_at=2021-06-01T12:00:00Z
+checked_at=2021-06-01T12:00:00Z
+check=ok
+`))
+
+		info, err := os.Stat(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Mode().Perm()).To(Equal(os.FileMode(0644)))
+	})
+
+	It("can be read back", func() {
+		Expect(statusfile.Update(path, now, "failed", 0, errors.New("it broke\nbadly"))).To(Succeed())
+
+		status, err := statusfile.Read(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(status).To(Equal(&statusfile.Status{
+			State:     "failed",
+			CheckedAt: now,
+			Check:     statusfile.CheckFailed,
+			Error:     "it broke badly",
+		}))
+	})
+
+	It("keeps the start time while the process keeps running", func() {
+		Expect(statusfile.Update(path, now, "running", 1234, nil)).To(Succeed())
+		Expect(statusfile.Update(path, now.Add(time.Minute), "running", 1234, nil)).To(Succeed())
+
+		status, err := statusfile.Read(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(status.StartedAt).To(Equal(now))
+		Expect(status.CheckedAt).To(Equal(now.Add(time.Minute)))
+	})
+
+	It("resets the start time when the process is replaced", func() {
+		Expect(statusfile.Update(path, now, "running", 1234, nil)).To(Succeed())
+		Expect(statusfile.Update(path, now.Add(time.Minute), "running", 5678, nil)).To(Succeed())
+
+		status, err := statusfile.Read(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(status.StartedAt).To(Equal(now.Add(time.Minute)))
+	})
+
+	It("does not leave temporary files behind", func() {
+		Expect(statusfile.Update(path, now, "stopped", 0, nil)).To(Succeed())
+
+		entries, err := ioutil.ReadDir(filepath.Dir(path))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(HaveLen(1))
+	})
+
+	Context("when the file is malformed", func() {
+		It("returns an error", func() {
+			Expect(os.MkdirAll(filepath.Dir(path), 0755)).To(Succeed())
+			Expect(ioutil.WriteFile(path, []byte("pid=abc\n"), 0644)).To(Succeed())
+
+			_, err := statusfile.Read(path)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
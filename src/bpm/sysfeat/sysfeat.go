@@ -18,34 +18,258 @@
 package sysfeat
 
 import (
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strings"
 
 	"github.com/opencontainers/runc/libcontainer/cgroups"
+	"golang.org/x/sys/unix"
 )
 
 const (
-	swapPath = "memory.memsw.limit_in_bytes"
+	swapPath            = "memory.memsw.limit_in_bytes"
+	kernelMemoryPath    = "memory.kmem.limit_in_bytes"
+	swappinessPath      = "memory.swappiness"
+	blkioWeightPath     = "blkio.weight"
+	blkioBFQWeightPath  = "blkio.bfq.weight"
+	netClassIDPath      = "net_cls.classid"
+	unifiedRoot         = "/sys/fs/cgroup"
+	unifiedControllers  = "/sys/fs/cgroup/cgroup.controllers"
+	unifiedSwapPath     = "memory.swap.max"
+	realtimeRuntimePath = "cpu.rt_runtime_us"
 )
 
+// Controllers are the cgroup controllers which bpm enforces the limits of a
+// process with.
+var Controllers = []string{"cpu", "cpuset", "memory", "pids", "blkio", "hugetlb", "devices"}
+
 // Features contains information about what features the host system supports.
 type Features struct {
 	// Whether the system supports limiting the swap space of a process or not.
 	SwapLimitSupported bool
+
+	// Whether the memory cgroup can limit the kernel memory of a process
+	// separately. cgroup v2 and newer kernels only charge kernel memory to
+	// the memory limit.
+	KernelMemoryLimitSupported bool
+
+	// Whether each memory cgroup has a swappiness of its own. cgroup v2
+	// only has the host's vm.swappiness.
+	SwappinessSupported bool
+
+	// Whether block I/O can be shared out between cgroups by weight. Under
+	// cgroup v1 this depends on the I/O scheduler of the host's disks and
+	// under cgroup v2 on the io controller being enabled.
+	IOWeightSupported bool
+
+	// Whether the packets sent by a cgroup can be tagged with a class ID
+	// for tc to shape. cgroup v2 has no net_cls controller.
+	NetClassSupported bool
+
+	// The total memory of the host in bytes, which limits expressed as a
+	// percentage are a share of.
+	MemoryTotal uint64
+
+	// The number of CPUs which bpm can use, which limits expressed relative
+	// to the host's CPUs are worked out from.
+	CPUCount int
+
+	// Whether the kernel gives each cgroup a budget of realtime CPU time,
+	// which a container with realtime processes must be given a share of.
+	RealtimeGroupsSupported bool
+
+	// Whether runc hands the cgroups of containers to systemd, which decides
+	// where they are placed.
+	SystemdCgroups bool
+
+	// Whether the host only has the unified hierarchy of cgroup v2. runc
+	// translates the limits of a process into its settings.
+	UnifiedCgroups bool
+
+	// The controllers which the host does not have. Nested hosts, such as
+	// bosh-lite and warden stemcells, often lack some of them and the limits
+	// which they enforce are skipped.
+	MissingControllers []string
+}
+
+// ControllerMissing reports whether the host lacks a cgroup controller.
+func (f Features) ControllerMissing(controller string) bool {
+	for _, missing := range f.MissingControllers {
+		if missing == controller {
+			return true
+		}
+	}
+	return false
 }
 
 func Fetch() (*Features, error) {
-	mountpoint, err := cgroups.FindCgroupMountpoint("", "memory")
-	if err != nil {
+	// Without a memory controller every feature of it is unsupported rather
+	// than bpm being unable to run at all.
+	var swap, kernelMemory, swappiness bool
+	unified := cgroups.IsCgroup2UnifiedMode()
+	if unified {
+		swap = unifiedSwapSupported()
+	} else if mountpoint, err := cgroups.FindCgroupMountpoint("", "memory"); err == nil {
+		swap = swapLimitSupported(mountpoint)
+		kernelMemory = kernelMemoryLimitSupported(mountpoint)
+		swappiness = swappinessSupported(mountpoint)
+	}
+
+	var info unix.Sysinfo_t
+	if err := unix.Sysinfo(&info); err != nil {
 		return nil, err
 	}
 
 	return &Features{
-		SwapLimitSupported: swapLimitSupported(mountpoint),
+		SwapLimitSupported:         swap,
+		KernelMemoryLimitSupported: kernelMemory,
+		SwappinessSupported:        swappiness,
+		IOWeightSupported:          ioWeightSupported(),
+		NetClassSupported:          netClassSupported(),
+		RealtimeGroupsSupported:    realtimeGroupsSupported(),
+		MemoryTotal:                uint64(info.Totalram) * uint64(info.Unit),
+		CPUCount:                   runtime.NumCPU(),
+		SystemdCgroups:             SystemdRunning(),
+		UnifiedCgroups:             unified,
+		MissingControllers:         missingControllers(),
 	}, nil
 }
 
+// SystemdRunning reports whether the host was booted with systemd.
+func SystemdRunning() bool {
+	systemdSystemDir, err := os.Lstat("/run/systemd/system")
+	if err != nil {
+		return false
+	}
+	return systemdSystemDir.IsDir()
+}
+
+func missingControllers() []string {
+	var missing []string
+
+	if cgroups.IsCgroup2UnifiedMode() {
+		data, err := ioutil.ReadFile(unifiedControllers)
+		if err != nil {
+			return nil
+		}
+
+		enabled := map[string]bool{}
+		for _, controller := range strings.Fields(string(data)) {
+			enabled[controller] = true
+		}
+
+		for _, controller := range Controllers {
+			switch controller {
+			case "blkio":
+				if !enabled["io"] {
+					missing = append(missing, controller)
+				}
+			case "devices":
+				// cgroup v2 controls devices with eBPF rather than a
+				// controller.
+			default:
+				if !enabled[controller] {
+					missing = append(missing, controller)
+				}
+			}
+		}
+
+		return missing
+	}
+
+	for _, controller := range Controllers {
+		if _, err := cgroups.FindCgroupMountpoint("", controller); err != nil {
+			missing = append(missing, controller)
+		}
+	}
+
+	return missing
+}
+
+// unifiedSwapSupported looks for the swap limit of the cgroup which bpm
+// itself is in. The root cgroup has no limits of its own so bpm running in it
+// can only tell whether the memory controller is enabled.
+func unifiedSwapSupported() bool {
+	if !unifiedControllerEnabled("memory") {
+		return false
+	}
+
+	paths, err := cgroups.ParseCgroupFile("/proc/self/cgroup")
+	if err != nil || paths[""] == "" || paths[""] == "/" {
+		return true
+	}
+
+	_, err = os.Stat(filepath.Join(unifiedRoot, paths[""], unifiedSwapPath))
+	return err == nil
+}
+
+func unifiedControllerEnabled(name string) bool {
+	data, err := ioutil.ReadFile(unifiedControllers)
+	if err != nil {
+		return false
+	}
+
+	for _, controller := range strings.Fields(string(data)) {
+		if controller == name {
+			return true
+		}
+	}
+
+	return false
+}
+
 func swapLimitSupported(mount string) bool {
 	_, err := os.Stat(filepath.Join(mount, swapPath))
 	return err == nil
 }
+
+func kernelMemoryLimitSupported(mount string) bool {
+	_, err := os.Stat(filepath.Join(mount, kernelMemoryPath))
+	return err == nil
+}
+
+func swappinessSupported(mount string) bool {
+	_, err := os.Stat(filepath.Join(mount, swappinessPath))
+	return err == nil
+}
+
+func ioWeightSupported() bool {
+	if cgroups.IsCgroup2UnifiedMode() {
+		return unifiedControllerEnabled("io")
+	}
+
+	mountpoint, err := cgroups.FindCgroupMountpoint("", "blkio")
+	if err != nil {
+		return false
+	}
+
+	for _, path := range []string{blkioWeightPath, blkioBFQWeightPath} {
+		if _, err := os.Stat(filepath.Join(mountpoint, path)); err == nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+func netClassSupported() bool {
+	mountpoint, err := cgroups.FindCgroupMountpoint("", "net_cls")
+	if err != nil {
+		return false
+	}
+
+	_, err = os.Stat(filepath.Join(mountpoint, netClassIDPath))
+	return err == nil
+}
+
+func realtimeGroupsSupported() bool {
+	mountpoint, err := cgroups.FindCgroupMountpoint("", "cpu")
+	if err != nil {
+		return false
+	}
+
+	_, err = os.Stat(filepath.Join(mountpoint, realtimeRuntimePath))
+	return err == nil
+}
@@ -0,0 +1,296 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+// Package tracing records spans for bpm's lifecycle operations and exports
+// them to an OpenTelemetry collector with OTLP over HTTP. It implements just
+// enough of OpenTelemetry for a short-lived command: spans are kept in memory
+// until the command finishes and are then sent in a single request.
+//
+// Spans are carried in a context. Starting a span from a context without a
+// tracer returns a nil span whose methods do nothing, so code can be
+// instrumented unconditionally.
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ExportTimeout is how long a tracer waits for the collector to accept its
+// spans.
+const ExportTimeout = 5 * time.Second
+
+// Tracer collects the spans of one bpm command.
+type Tracer struct {
+	endpoint string
+	headers  map[string]string
+	resource map[string]string
+	client   *http.Client
+
+	traceID string
+
+	mu       sync.Mutex
+	finished []*Span
+}
+
+// NewTracer returns a tracer which exports to the OTLP/HTTP collector at
+// endpoint (for example http://localhost:4318). The headers are added to the
+// export request and resource describes where the spans came from.
+func NewTracer(endpoint string, headers, resource map[string]string) *Tracer {
+	return &Tracer{
+		endpoint: strings.TrimSuffix(endpoint, "/") + "/v1/traces",
+		headers:  headers,
+		resource: resource,
+		client:   &http.Client{Timeout: ExportTimeout},
+		traceID:  randomID(16),
+	}
+}
+
+type contextKey struct{}
+
+type contextValue struct {
+	tracer *Tracer
+	span   *Span
+}
+
+// WithTracer returns a context in which spans are recorded by t.
+func WithTracer(ctx context.Context, t *Tracer) context.Context {
+	return context.WithValue(ctx, contextKey{}, contextValue{tracer: t})
+}
+
+// Span is a timed operation within a trace.
+type Span struct {
+	tracer *Tracer
+
+	name       string
+	id         string
+	parentID   string
+	start      time.Time
+	end        time.Time
+	attributes map[string]interface{}
+	err        error
+}
+
+// Start begins a span which is a child of the span in ctx, if there is one.
+// The returned context carries the new span.
+func Start(ctx context.Context, name string) (context.Context, *Span) {
+	value, ok := ctx.Value(contextKey{}).(contextValue)
+	if !ok || value.tracer == nil {
+		return ctx, nil
+	}
+
+	span := &Span{
+		tracer:     value.tracer,
+		name:       name,
+		id:         randomID(8),
+		start:      time.Now(),
+		attributes: map[string]interface{}{},
+	}
+	if value.span != nil {
+		span.parentID = value.span.id
+	}
+
+	return context.WithValue(ctx, contextKey{}, contextValue{tracer: value.tracer, span: span}), span
+}
+
+// SetAttribute records a string, integer, or boolean value on the span.
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+
+	s.attributes[key] = value
+}
+
+// End finishes the span. A non-nil err marks the span as failed.
+func (s *Span) End(err error) {
+	if s == nil {
+		return
+	}
+
+	s.end = time.Now()
+	s.err = err
+
+	s.tracer.mu.Lock()
+	s.tracer.finished = append(s.tracer.finished, s)
+	s.tracer.mu.Unlock()
+}
+
+// Flush exports the spans which have ended since the last flush.
+func (t *Tracer) Flush(ctx context.Context) error {
+	t.mu.Lock()
+	spans := t.finished
+	t.finished = nil
+	t.mu.Unlock()
+
+	if len(spans) == 0 {
+		return nil
+	}
+
+	body, err := json.Marshal(t.request(spans))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, t.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("collector responded with %s", resp.Status)
+	}
+
+	return nil
+}
+
+// The types below are the JSON encoding of an OTLP ExportTraceServiceRequest.
+// Trace and span IDs are hex encoded and 64-bit integers are strings.
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpAttribute struct {
+	Key   string                 `json:"key"`
+	Value map[string]interface{} `json:"value"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+const (
+	spanKindInternal = 1
+	statusCodeOK     = 1
+	statusCodeError  = 2
+)
+
+func (t *Tracer) request(spans []*Span) otlpRequest {
+	var encoded []otlpSpan
+	for _, s := range spans {
+		status := otlpStatus{Code: statusCodeOK}
+		if s.err != nil {
+			status = otlpStatus{Code: statusCodeError, Message: s.err.Error()}
+		}
+
+		encoded = append(encoded, otlpSpan{
+			TraceID:           t.traceID,
+			SpanID:            s.id,
+			ParentSpanID:      s.parentID,
+			Name:              s.name,
+			Kind:              spanKindInternal,
+			StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+			Attributes:        attributes(s.attributes),
+			Status:            status,
+		})
+	}
+
+	resource := map[string]interface{}{}
+	for k, v := range t.resource {
+		resource[k] = v
+	}
+
+	return otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource: otlpResource{Attributes: attributes(resource)},
+		ScopeSpans: []otlpScopeSpans{{
+			Scope: otlpScope{Name: "bpm"},
+			Spans: encoded,
+		}},
+	}}}
+}
+
+func attributes(values map[string]interface{}) []otlpAttribute {
+	var attrs []otlpAttribute
+	for k, v := range values {
+		var value map[string]interface{}
+		switch v := v.(type) {
+		case bool:
+			value = map[string]interface{}{"boolValue": v}
+		case int:
+			value = map[string]interface{}{"intValue": strconv.Itoa(v)}
+		case int64:
+			value = map[string]interface{}{"intValue": strconv.FormatInt(v, 10)}
+		default:
+			value = map[string]interface{}{"stringValue": fmt.Sprint(v)}
+		}
+		attrs = append(attrs, otlpAttribute{Key: k, Value: value})
+	}
+
+	// Keep the output stable so that it is easy to compare.
+	sort.Slice(attrs, func(i, j int) bool { return attrs[i].Key < attrs[j].Key })
+	return attrs
+}
+
+func randomID(n int) string {
+	b := make([]byte, n)
+	// crypto/rand only fails when the kernel cannot provide randomness, in
+	// which case a poor span ID is the least of bpm's problems.
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,138 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package tracing_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"bpm/tracing"
+)
+
+var _ = Describe("Tracing", func() {
+	var (
+		server   *httptest.Server
+		requests chan *http.Request
+		bodies   chan map[string]interface{}
+		status   int
+	)
+
+	BeforeEach(func() {
+		requests = make(chan *http.Request, 10)
+		bodies = make(chan map[string]interface{}, 10)
+		status = http.StatusOK
+
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			data, err := ioutil.ReadAll(r.Body)
+			Expect(err).NotTo(HaveOccurred())
+
+			var body map[string]interface{}
+			Expect(json.Unmarshal(data, &body)).To(Succeed())
+
+			requests <- r
+			bodies <- body
+			w.WriteHeader(status)
+		}))
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	spansOf := func(body map[string]interface{}) []interface{} {
+		resourceSpans := body["resourceSpans"].([]interface{})
+		Expect(resourceSpans).To(HaveLen(1))
+		scopeSpans := resourceSpans[0].(map[string]interface{})["scopeSpans"].([]interface{})
+		Expect(scopeSpans).To(HaveLen(1))
+		return scopeSpans[0].(map[string]interface{})["spans"].([]interface{})
+	}
+
+	It("exports nested spans to the collector", func() {
+		tracer := tracing.NewTracer(server.URL, map[string]string{"Authorization": "Bearer token"}, map[string]string{"service.name": "bpm"})
+		ctx := tracing.WithTracer(context.Background(), tracer)
+
+		ctx, parent := tracing.Start(ctx, "bpm start")
+		parent.SetAttribute("bpm.job", "example")
+		_, child := tracing.Start(ctx, "runc run")
+		child.SetAttribute("attempt", 1)
+		child.End(errors.New("container failed"))
+		parent.End(nil)
+
+		Expect(tracer.Flush(context.Background())).To(Succeed())
+
+		var req *http.Request
+		Eventually(requests).Should(Receive(&req))
+		Expect(req.URL.Path).To(Equal("/v1/traces"))
+		Expect(req.Header.Get("Content-Type")).To(Equal("application/json"))
+		Expect(req.Header.Get("Authorization")).To(Equal("Bearer token"))
+
+		var body map[string]interface{}
+		Eventually(bodies).Should(Receive(&body))
+		spans := spansOf(body)
+		Expect(spans).To(HaveLen(2))
+
+		childSpan := spans[0].(map[string]interface{})
+		parentSpan := spans[1].(map[string]interface{})
+		Expect(childSpan["name"]).To(Equal("runc run"))
+		Expect(parentSpan["name"]).To(Equal("bpm start"))
+		Expect(childSpan["traceId"]).To(Equal(parentSpan["traceId"]))
+		Expect(childSpan["traceId"]).To(HaveLen(32))
+		Expect(childSpan["parentSpanId"]).To(Equal(parentSpan["spanId"]))
+		Expect(parentSpan).NotTo(HaveKey("parentSpanId"))
+
+		Expect(childSpan["status"]).To(Equal(map[string]interface{}{"code": float64(2), "message": "container failed"}))
+		Expect(parentSpan["status"]).To(Equal(map[string]interface{}{"code": float64(1)}))
+		Expect(childSpan["attributes"]).To(ConsistOf(map[string]interface{}{
+			"key":   "attempt",
+			"value": map[string]interface{}{"intValue": "1"},
+		}))
+		Expect(parentSpan["attributes"]).To(ConsistOf(map[string]interface{}{
+			"key":   "bpm.job",
+			"value": map[string]interface{}{"stringValue": "example"},
+		}))
+	})
+
+	It("does nothing without a tracer", func() {
+		ctx, span := tracing.Start(context.Background(), "untraced")
+		Expect(span).To(BeNil())
+		Expect(ctx).To(Equal(context.Background()))
+
+		span.SetAttribute("key", "value")
+		span.End(nil)
+	})
+
+	It("does not send a request when there are no spans", func() {
+		tracer := tracing.NewTracer(server.URL, nil, nil)
+		Expect(tracer.Flush(context.Background())).To(Succeed())
+		Consistently(requests).ShouldNot(Receive())
+	})
+
+	It("returns an error when the collector refuses the spans", func() {
+		status = http.StatusServiceUnavailable
+		tracer := tracing.NewTracer(server.URL, nil, nil)
+		_, span := tracing.Start(tracing.WithTracer(context.Background(), tracer), "refused")
+		span.End(nil)
+
+		Expect(tracer.Flush(context.Background())).To(MatchError(ContainSubstring("503")))
+	})
+})
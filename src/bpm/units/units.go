@@ -0,0 +1,96 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+// Package units parses the sizes and durations which operators write in job
+// configuration, host configuration, and command line flags, so that each of
+// them accepts the same forms and rejects anything else with the same error.
+package units
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/bytefmt"
+)
+
+// ParseSize parses a number of bytes with a unit such as 512M, 1.5G, or 2Gi.
+// Decimal and binary prefixes both mean powers of 1024.
+func ParseSize(s string) (uint64, error) {
+	value := strings.TrimSpace(s)
+	if strings.HasSuffix(strings.ToUpper(value), "I") {
+		// bytefmt only knows binary prefixes when they are followed by a B.
+		value += "B"
+	}
+
+	size, err := bytefmt.ToBytes(value)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a size: must be a number with a unit such as 512M or 2Gi", s)
+	}
+
+	return size, nil
+}
+
+// ParseDuration parses a duration such as 90s, 2m, or 1h30m. A number without
+// a unit is a number of seconds so that settings which used to be given in
+// whole seconds keep working. Negative durations are rejected.
+func ParseDuration(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		seconds, serr := strconv.ParseFloat(s, 64)
+		if serr != nil {
+			return 0, fmt.Errorf("%q is not a duration: must be a number with a unit such as 90s or 2m", s)
+		}
+		d = time.Duration(seconds * float64(time.Second))
+	}
+
+	if d < 0 {
+		return 0, fmt.Errorf("%q is not a duration: must not be negative", s)
+	}
+
+	return d, nil
+}
+
+// Duration is a command line flag holding a duration which is parsed by
+// ParseDuration.
+type Duration time.Duration
+
+// DurationFlag returns a flag value which stores into d and starts out as
+// value.
+func DurationFlag(d *time.Duration, value time.Duration) *Duration {
+	*d = value
+	return (*Duration)(d)
+}
+
+func (d *Duration) Set(s string) error {
+	parsed, err := ParseDuration(s)
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d *Duration) String() string {
+	return time.Duration(*d).String()
+}
+
+func (d *Duration) Type() string {
+	return "duration"
+}
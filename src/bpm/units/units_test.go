@@ -0,0 +1,80 @@
+// Copyright (C) 2021-Present CloudFoundry.org Foundation, Inc. All rights reserved.
+//
+// This program and the accompanying materials are made available under
+// the terms of the under the Apache License, Version 2.0 (the "License”);
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package units_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+
+	"bpm/units"
+)
+
+var _ = Describe("Units", func() {
+	DescribeTable("ParseSize",
+		func(s string, expected uint64) {
+			Expect(units.ParseSize(s)).To(Equal(expected))
+		},
+		Entry("megabytes", "512M", uint64(512*1024*1024)),
+		Entry("binary gigabytes", "2Gi", uint64(2*1024*1024*1024)),
+		Entry("fractions", "1.5K", uint64(1536)),
+		Entry("bytes", "100B", uint64(100)),
+	)
+
+	It("rejects sizes without a unit", func() {
+		for _, s := range []string{"512", "lots", "-1M", ""} {
+			_, err := units.ParseSize(s)
+			Expect(err).To(MatchError(ContainSubstring("is not a size: must be a number with a unit such as 512M or 2Gi")), s)
+		}
+	})
+
+	DescribeTable("ParseDuration",
+		func(s string, expected time.Duration) {
+			Expect(units.ParseDuration(s)).To(Equal(expected))
+		},
+		Entry("seconds", "90s", 90*time.Second),
+		Entry("minutes", "2m", 2*time.Minute),
+		Entry("mixed units", "1h30m", 90*time.Minute),
+		Entry("a bare number of seconds", "15", 15*time.Second),
+		Entry("a fraction of a second", "0.5", 500*time.Millisecond),
+	)
+
+	It("rejects invalid and negative durations", func() {
+		_, err := units.ParseDuration("soon")
+		Expect(err).To(MatchError(`"soon" is not a duration: must be a number with a unit such as 90s or 2m`))
+
+		_, err = units.ParseDuration("-5s")
+		Expect(err).To(MatchError(`"-5s" is not a duration: must not be negative`))
+	})
+
+	Describe("Duration", func() {
+		It("is a flag which accepts the same durations", func() {
+			var d time.Duration
+			flag := units.DurationFlag(&d, 15*time.Second)
+			Expect(flag.String()).To(Equal("15s"))
+
+			Expect(flag.Set("2m")).To(Succeed())
+			Expect(d).To(Equal(2 * time.Minute))
+
+			Expect(flag.Set("30")).To(Succeed())
+			Expect(d).To(Equal(30 * time.Second))
+
+			Expect(flag.Set("soon")).To(HaveOccurred())
+		})
+	})
+})
@@ -16,23 +16,88 @@
 package usertools
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
 	"os/user"
+	"path/filepath"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 
+	"code.cloudfoundry.org/clock"
 	"github.com/opencontainers/runtime-spec/specs-go"
 )
 
 const VcapUser = "vcap"
 
-type UserFinder struct{}
+// DefaultCacheTTL is how long a successful user lookup is reused for before
+// the user database is consulted again.
+const DefaultCacheTTL = 5 * time.Minute
+
+// UserFinder resolves users into the form used by the runtime spec. Users can
+// be given by name or numerically as "uid:gid". Named users are looked up in
+// the user database (which may involve NSS modules such as LDAP) and the
+// result is cached to avoid the cost and failure modes of repeated lookups.
+// Processes always run as VcapUser, so a numeric user is only ever given by
+// the operator, such as with `bpm exec --user`.
+type UserFinder struct {
+	clock     clock.Clock
+	ttl       time.Duration
+	lookup    func(string) (*user.User, error)
+	cachePath string
+
+	mu    sync.Mutex
+	cache map[string]cachedUser
+}
+
+type cachedUser struct {
+	User    specs.User `json:"user"`
+	Expires time.Time  `json:"expires"`
+}
 
 func NewUserFinder() *UserFinder {
-	return &UserFinder{}
+	return NewCachingUserFinder(clock.NewClock(), DefaultCacheTTL)
+}
+
+// NewCachingUserFinder returns a UserFinder which caches lookups for the given
+// duration in memory, for as long as the UserFinder is used. A ttl of zero
+// disables the cache.
+func NewCachingUserFinder(clk clock.Clock, ttl time.Duration) *UserFinder {
+	return &UserFinder{
+		clock:  clk,
+		ttl:    ttl,
+		lookup: user.Lookup,
+		cache:  map[string]cachedUser{},
+	}
+}
+
+// NewPersistentUserFinder returns a UserFinder which also keeps its cache in
+// the file at cachePath, so that each run of bpm reuses the lookups of the
+// runs before it until they expire.
+func NewPersistentUserFinder(clk clock.Clock, ttl time.Duration, cachePath string) *UserFinder {
+	f := NewCachingUserFinder(clk, ttl)
+	f.cachePath = cachePath
+	return f
 }
 
 func (f *UserFinder) Lookup(username string) (specs.User, error) {
-	u, err := user.Lookup(username)
+	if strings.Contains(username, ":") {
+		return parseNumericUser(username)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := f.clock.Now()
+	if cached, ok := f.cached(username, now); ok {
+		return cached, nil
+	}
+
+	u, err := f.lookup(username)
 	if err != nil {
 		return specs.User{}, err
 	}
@@ -53,9 +118,124 @@ func (f *UserFinder) Lookup(username string) (specs.User, error) {
 		return specs.User{}, errors.New("GID can't be negative")
 	}
 
-	return specs.User{
+	found := specs.User{
 		UID:      uint32(uid),
 		GID:      uint32(gid),
 		Username: u.Username,
+	}
+
+	if f.ttl > 0 {
+		f.store(username, cachedUser{User: found, Expires: now.Add(f.ttl)}, now)
+	}
+
+	return found, nil
+}
+
+// cached returns the user cached under username if it has not expired. A user
+// cached by an earlier run with a longer ttl is only reused for this one's.
+func (f *UserFinder) cached(username string, now time.Time) (specs.User, bool) {
+	fresh := func(c cachedUser) bool {
+		return now.Before(c.Expires) && c.Expires.Sub(now) <= f.ttl
+	}
+
+	if c, ok := f.cache[username]; ok && fresh(c) {
+		return c.User, true
+	}
+
+	if f.ttl == 0 || f.cachePath == "" {
+		return specs.User{}, false
+	}
+
+	if c, ok := f.readCacheFile()[username]; ok && fresh(c) {
+		f.cache[username] = c
+		return c.User, true
+	}
+
+	return specs.User{}, false
+}
+
+// store caches a user under username. The cache only saves lookups, so
+// failing to write the cache file does not fail the lookup: the next run
+// consults the user database instead.
+func (f *UserFinder) store(username string, c cachedUser, now time.Time) {
+	f.cache[username] = c
+
+	if f.cachePath == "" {
+		return
+	}
+
+	cached := f.readCacheFile()
+	for name, other := range cached {
+		if !now.Before(other.Expires) {
+			delete(cached, name)
+		}
+	}
+	cached[username] = c
+
+	f.writeCacheFile(cached)
+}
+
+// readCacheFile returns the users in the cache file. A cache file which is
+// missing or cannot be read is treated as empty.
+func (f *UserFinder) readCacheFile() map[string]cachedUser {
+	cached := map[string]cachedUser{}
+
+	data, err := ioutil.ReadFile(f.cachePath)
+	if err != nil {
+		return cached
+	}
+
+	if err := json.Unmarshal(data, &cached); err != nil {
+		return map[string]cachedUser{}
+	}
+
+	return cached
+}
+
+// writeCacheFile replaces the cache file so that another run of bpm never
+// reads it half written.
+func (f *UserFinder) writeCacheFile(cached map[string]cachedUser) {
+	data, err := json.Marshal(cached)
+	if err != nil {
+		return
+	}
+
+	dir := filepath.Dir(f.cachePath)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return
+	}
+
+	tmp, err := ioutil.TempFile(dir, filepath.Base(f.cachePath)+".")
+	if err != nil {
+		return
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err != nil || cerr != nil {
+		return
+	}
+
+	os.Rename(tmp.Name(), f.cachePath)
+}
+
+// parseNumericUser parses a "uid:gid" user specification. It never consults
+// the user database so the resulting user has no name.
+func parseNumericUser(spec string) (specs.User, error) {
+	parts := strings.SplitN(spec, ":", 2)
+
+	uid, err := strconv.ParseUint(parts[0], 10, 32)
+	if err != nil {
+		return specs.User{}, fmt.Errorf("invalid user %q: UID must be a non-negative number", spec)
+	}
+
+	gid, err := strconv.ParseUint(parts[1], 10, 32)
+	if err != nil {
+		return specs.User{}, fmt.Errorf("invalid user %q: GID must be a non-negative number", spec)
+	}
+
+	return specs.User{
+		UID: uint32(uid),
+		GID: uint32(gid),
 	}, nil
 }
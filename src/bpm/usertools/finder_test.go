@@ -16,6 +16,14 @@
 package usertools_test
 
 import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	specs "github.com/opencontainers/runtime-spec/specs-go"
@@ -47,5 +55,164 @@ var _ = Describe("UserIDFinder", func() {
 				Expect(err).To(HaveOccurred())
 			})
 		})
+
+		Context("when the user is given as uid:gid", func() {
+			It("does not consult the user database", func() {
+				userFinder.SetLookup(func(string) (*user.User, error) {
+					return nil, errors.New("should not be called")
+				})
+
+				user, err := userFinder.Lookup("1234:5678")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(user).To(Equal(specs.User{UID: 1234, GID: 5678}))
+			})
+
+			It("returns an error if either ID is not a number", func() {
+				_, err := userFinder.Lookup("vcap:5678")
+				Expect(err).To(HaveOccurred())
+
+				_, err = userFinder.Lookup("1234:")
+				Expect(err).To(HaveOccurred())
+
+				_, err = userFinder.Lookup("-1:5678")
+				Expect(err).To(HaveOccurred())
+			})
+		})
+	})
+
+	Context("caching", func() {
+		var (
+			fakeClock *fakeclock.FakeClock
+			lookups   int
+			lookupErr error
+		)
+
+		BeforeEach(func() {
+			fakeClock = fakeclock.NewFakeClock(time.Now())
+			lookups = 0
+			lookupErr = nil
+
+			userFinder = usertools.NewCachingUserFinder(fakeClock, time.Minute)
+			userFinder.SetLookup(func(name string) (*user.User, error) {
+				lookups++
+				if lookupErr != nil {
+					return nil, lookupErr
+				}
+				return &user.User{Username: name, Uid: "2000", Gid: "3000"}, nil
+			})
+		})
+
+		It("reuses a lookup until it expires", func() {
+			_, err := userFinder.Lookup("vcap")
+			Expect(err).NotTo(HaveOccurred())
+			_, err = userFinder.Lookup("vcap")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(lookups).To(Equal(1))
+
+			fakeClock.Increment(time.Minute)
+
+			_, err = userFinder.Lookup("vcap")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(lookups).To(Equal(2))
+		})
+
+		It("does not cache failed lookups", func() {
+			lookupErr = errors.New("ldap is down")
+			_, err := userFinder.Lookup("vcap")
+			Expect(err).To(MatchError("ldap is down"))
+
+			lookupErr = nil
+			user, err := userFinder.Lookup("vcap")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(user.UID).To(Equal(uint32(2000)))
+			Expect(lookups).To(Equal(2))
+		})
+
+		It("does not cache when the ttl is zero", func() {
+			userFinder = usertools.NewCachingUserFinder(fakeClock, 0)
+			userFinder.SetLookup(func(name string) (*user.User, error) {
+				lookups++
+				return &user.User{Username: name, Uid: "2000", Gid: "3000"}, nil
+			})
+
+			_, _ = userFinder.Lookup("vcap")
+			_, _ = userFinder.Lookup("vcap")
+			Expect(lookups).To(Equal(2))
+		})
+	})
+
+	Context("persistent caching", func() {
+		var (
+			fakeClock *fakeclock.FakeClock
+			tempDir   string
+			cachePath string
+			lookups   int
+		)
+
+		newFinder := func(ttl time.Duration) *usertools.UserFinder {
+			f := usertools.NewPersistentUserFinder(fakeClock, ttl, cachePath)
+			f.SetLookup(func(name string) (*user.User, error) {
+				lookups++
+				return &user.User{Username: name, Uid: "2000", Gid: "3000"}, nil
+			})
+			return f
+		}
+
+		BeforeEach(func() {
+			var err error
+			tempDir, err = ioutil.TempDir("", "usertools")
+			Expect(err).NotTo(HaveOccurred())
+
+			fakeClock = fakeclock.NewFakeClock(time.Now())
+			cachePath = filepath.Join(tempDir, "bpm", "users.json")
+			lookups = 0
+		})
+
+		AfterEach(func() {
+			Expect(os.RemoveAll(tempDir)).To(Succeed())
+		})
+
+		It("reuses a lookup made by an earlier finder until it expires", func() {
+			_, err := newFinder(time.Minute).Lookup("vcap")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(lookups).To(Equal(1))
+
+			info, err := os.Stat(cachePath)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.Mode() & os.ModePerm).To(Equal(os.FileMode(0600)))
+
+			user, err := newFinder(time.Minute).Lookup("vcap")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(user).To(Equal(specs.User{UID: 2000, GID: 3000, Username: "vcap"}))
+			Expect(lookups).To(Equal(1))
+
+			fakeClock.Increment(time.Minute)
+
+			_, err = newFinder(time.Minute).Lookup("vcap")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(lookups).To(Equal(2))
+		})
+
+		It("does not reuse a lookup for longer than its own ttl", func() {
+			_, err := newFinder(time.Hour).Lookup("vcap")
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = newFinder(time.Minute).Lookup("vcap")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(lookups).To(Equal(2))
+		})
+
+		It("looks the user up when the cache file cannot be read", func() {
+			Expect(os.MkdirAll(filepath.Dir(cachePath), 0700)).To(Succeed())
+			Expect(ioutil.WriteFile(cachePath, []byte("{{"), 0600)).To(Succeed())
+
+			_, err := newFinder(time.Minute).Lookup("vcap")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(lookups).To(Equal(1))
+
+			_, err = newFinder(time.Minute).Lookup("vcap")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(lookups).To(Equal(1))
+		})
 	})
 })